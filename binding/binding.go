@@ -0,0 +1,199 @@
+// Package binding converts a CPE between its bindings: the URI of CPE 2.2, the formatted string of CPE 2.3 and the well-formed name (WFN).
+package binding
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+)
+
+// Bindings are a CPE in all the bindings
+type Bindings struct {
+	URI string `json:"uri"`
+	FS  string `json:"fs"`
+	// WFN is the well-formed name, e.g. wfn:[part="a",vendor="apache",product="http_server",version="2\.4\.58",...]
+	WFN string `json:"wfn"`
+	// WFNAttributes are the values of the attributes in the WFN, quoted, or ANY or NA
+	WFNAttributes map[string]string `json:"wfnAttributes"`
+	// Attributes are the values of the attributes unquoted, * for ANY and - for NA
+	Attributes map[string]string `json:"attributes"`
+}
+
+// attribute is an attribute of the WFN, by the name in the WFN and the key of go-cpe
+type attribute struct {
+	name string
+	key  string
+}
+
+var attributes = []attribute{
+	{"part", common.AttributePart},
+	{"vendor", common.AttributeVendor},
+	{"product", common.AttributeProduct},
+	{"version", common.AttributeVersion},
+	{"update", common.AttributeUpdate},
+	{"edition", common.AttributeEdition},
+	{"language", common.AttributeLanguage},
+	{"sw_edition", common.AttributeSwEdition},
+	{"target_sw", common.AttributeTargetSw},
+	{"target_hw", common.AttributeTargetHw},
+	{"other", common.AttributeOther},
+}
+
+var wfnAttributeRe = regexp.MustCompile(`(\w+)\s*=\s*("(?:[^"\\]|\\.)*"|ANY|NA)`)
+
+// wfnPartRe is the part of ANY in a WFN, replaced by WithPart
+var wfnPartRe = regexp.MustCompile(`part\s*=\s*ANY\s*,?\s*`)
+
+// Convert parses the CPE in any of the bindings, e.g. cpe:/a:apache:http_server:2.4.58,
+// cpe:2.3:a:apache:http_server:2.4.58:*:*:*:*:*:*:* or wfn:[part="a",vendor="apache",...], and returns all of them
+func Convert(cpe string) (*Bindings, error) {
+	cpe = strings.TrimSpace(cpe)
+	var wfn common.WellFormedName
+	var err error
+	switch {
+	case strings.HasPrefix(cpe, "cpe:2.3:"):
+		wfn, err = naming.UnbindFS(cpe)
+	case strings.HasPrefix(cpe, "cpe:/"):
+		wfn, err = naming.UnbindURI(cpe)
+	case strings.HasPrefix(cpe, "wfn:["):
+		var fs string
+		if fs, err = wfnToFS(cpe); err == nil {
+			wfn, err = naming.UnbindFS(fs)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown binding, expected cpe:/..., cpe:2.3:... or wfn:[...]: %s", cpe)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unbind. cpe: %s, err: %s", cpe, err)
+	}
+
+	b := Bindings{
+		URI:           naming.BindToURI(wfn),
+		FS:            naming.BindToFS(wfn),
+		WFNAttributes: map[string]string{},
+		Attributes:    map[string]string{},
+	}
+	pairs := []string{}
+	for _, a := range attributes {
+		v := wfn.GetString(a.key)
+		b.WFNAttributes[a.name] = v
+		switch v {
+		case "ANY":
+			b.Attributes[a.name] = "*"
+			pairs = append(pairs, a.name+"=ANY")
+		case "NA":
+			b.Attributes[a.name] = "-"
+			pairs = append(pairs, a.name+"=NA")
+		default:
+			b.Attributes[a.name] = unquote(v)
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, a.name, v))
+		}
+	}
+	b.WFN = "wfn:[" + strings.Join(pairs, ",") + "]"
+	return &b, nil
+}
+
+// MissingPart tells whether the CPE has no part, e.g. cpe:/:apache:http_server, cpe:2.3:*:apache:http_server:... or wfn:[vendor="apache",...].
+// Convert binds it with the part ANY, while the part of a CPE in the dictionary is always a, o or h.
+func MissingPart(cpe string) bool {
+	cpe = strings.TrimSpace(cpe)
+	switch {
+	case strings.HasPrefix(cpe, "cpe:2.3:"):
+		part := strings.SplitN(strings.TrimPrefix(cpe, "cpe:2.3:"), ":", 2)[0]
+		return part == "*" || part == ""
+	case strings.HasPrefix(cpe, "cpe:/"):
+		return strings.HasPrefix(cpe, "cpe:/:") || cpe == "cpe:/"
+	case strings.HasPrefix(cpe, "wfn:["):
+		for _, m := range wfnAttributeRe.FindAllStringSubmatch(cpe, -1) {
+			if m[1] == "part" {
+				return m[2] == "ANY"
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// WithPart returns the CPE missing the part as of MissingPart in the same binding with part, e.g. "o" for an operating system
+func WithPart(cpe, part string) string {
+	cpe = strings.TrimSpace(cpe)
+	switch {
+	case strings.HasPrefix(cpe, "cpe:2.3:"):
+		ss := strings.SplitN(strings.TrimPrefix(cpe, "cpe:2.3:"), ":", 2)
+		if len(ss) == 1 {
+			return "cpe:2.3:" + part
+		}
+		return "cpe:2.3:" + part + ":" + ss[1]
+	case strings.HasPrefix(cpe, "cpe:/"):
+		return "cpe:/" + part + strings.TrimPrefix(cpe, "cpe:/")
+	case strings.HasPrefix(cpe, "wfn:["):
+		rest := wfnPartRe.ReplaceAllString(strings.TrimPrefix(cpe, "wfn:["), "")
+		if rest == "]" {
+			return fmt.Sprintf(`wfn:[part="%s"]`, part)
+		}
+		return fmt.Sprintf(`wfn:[part="%s",%s`, part, rest)
+	}
+	return cpe
+}
+
+// wfnToFS binds the WFN string to the formatted string, the attributes missing in the WFN being ANY
+func wfnToFS(wfn string) (string, error) {
+	if !strings.HasSuffix(wfn, "]") {
+		return "", fmt.Errorf("The WFN doesn't end with ]")
+	}
+	values := map[string]string{}
+	for _, m := range wfnAttributeRe.FindAllStringSubmatch(wfn, -1) {
+		values[m[1]] = m[2]
+	}
+
+	fields := []string{}
+	for _, a := range attributes {
+		v, ok := values[a.name]
+		delete(values, a.name)
+		switch {
+		case !ok, v == "ANY":
+			fields = append(fields, "*")
+		case v == "NA":
+			fields = append(fields, "-")
+		default:
+			fields = append(fields, bindValueForFS(strings.Trim(v, `"`)))
+		}
+	}
+	for name := range values {
+		return "", fmt.Errorf("Unknown attribute of the WFN: %s", name)
+	}
+	if fields[0] == "*" {
+		return "", fmt.Errorf("The WFN has no part")
+	}
+	return "cpe:2.3:" + strings.Join(fields, ":"), nil
+}
+
+// bindValueForFS unquotes the characters the formatted string has unquoted, i.e. . - and _
+func bindValueForFS(v string) string {
+	var sb strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			i++
+			if strings.IndexByte(".-_", v[i]) == -1 {
+				sb.WriteByte('\\')
+			}
+		}
+		sb.WriteByte(v[i])
+	}
+	return sb.String()
+}
+
+// unquote removes the escapes of the quoted characters
+func unquote(v string) string {
+	var sb strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			i++
+		}
+		sb.WriteByte(v[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,96 @@
+package binding
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	apache := Bindings{
+		URI: "cpe:/a:apache:http_server:2.4.58",
+		FS:  "cpe:2.3:a:apache:http_server:2.4.58:*:*:*:*:*:*:*",
+		WFN: `wfn:[part="a",vendor="apache",product="http_server",version="2\.4\.58",update=ANY,edition=ANY,language=ANY,sw_edition=ANY,target_sw=ANY,target_hw=ANY,other=ANY]`,
+		WFNAttributes: map[string]string{
+			"part": "a", "vendor": "apache", "product": "http_server", "version": `2\.4\.58`, "update": "ANY", "edition": "ANY",
+			"language": "ANY", "sw_edition": "ANY", "target_sw": "ANY", "target_hw": "ANY", "other": "ANY",
+		},
+		Attributes: map[string]string{
+			"part": "a", "vendor": "apache", "product": "http_server", "version": "2.4.58", "update": "*", "edition": "*",
+			"language": "*", "sw_edition": "*", "target_sw": "*", "target_hw": "*", "other": "*",
+		},
+	}
+	tests := []struct {
+		name     string
+		cpe      string
+		expected *Bindings
+	}{
+		{name: "uri", cpe: "cpe:/a:apache:http_server:2.4.58", expected: &apache},
+		{name: "fs", cpe: "cpe:2.3:a:apache:http_server:2.4.58:*:*:*:*:*:*:*", expected: &apache},
+		{name: "wfn", cpe: `wfn:[part="a",vendor="apache",product="http_server",version="2\.4\.58"]`, expected: &apache},
+		{name: "wfn of all", cpe: apache.WFN, expected: &apache},
+		{name: "unknown", cpe: "apache:http_server:2.4.58"},
+		{name: "wfn without part", cpe: `wfn:[vendor="apache"]`},
+		{name: "wfn of unknown attribute", cpe: `wfn:[part="a",vendor="apache",arch="x64"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := Convert(tt.cpe)
+			if tt.expected == nil {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Convert: %s", err)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestBindValueForFS(t *testing.T) {
+	for v, expected := range map[string]string{
+		`2\.4\.58`:     `2.4.58`,
+		`http\_server`: `http_server`,
+		`a\!b`:         `a\!b`,
+		`a\\\.b`:       `a\\.b`,
+	} {
+		if actual := bindValueForFS(v); actual != expected {
+			t.Errorf("bindValueForFS(%s): expected %s, got %s", v, expected, actual)
+		}
+	}
+}
+
+func TestWithPart(t *testing.T) {
+	tests := []struct {
+		cpe      string
+		missing  bool
+		expected string
+	}{
+		{cpe: "cpe:/:microsoft:windows_10", missing: true, expected: "cpe:/o:microsoft:windows_10"},
+		{cpe: "cpe:2.3:*:microsoft:windows_10:1809:*:*:*:*:*:*:*", missing: true, expected: "cpe:2.3:o:microsoft:windows_10:1809:*:*:*:*:*:*:*"},
+		{cpe: `wfn:[vendor="microsoft",product="windows_10"]`, missing: true, expected: `wfn:[part="o",vendor="microsoft",product="windows_10"]`},
+		{cpe: `wfn:[part=ANY,vendor="microsoft",product="windows_10"]`, missing: true, expected: `wfn:[part="o",vendor="microsoft",product="windows_10"]`},
+		{cpe: "cpe:/a:apache:http_server"},
+		{cpe: "cpe:2.3:a:apache:http_server:2.4.58:*:*:*:*:*:*:*"},
+		{cpe: `wfn:[part="a",vendor="apache"]`},
+	}
+	for _, tt := range tests {
+		if actual := MissingPart(tt.cpe); actual != tt.missing {
+			t.Errorf("MissingPart(%s): expected %t, got %t", tt.cpe, tt.missing, actual)
+		}
+		if !tt.missing {
+			continue
+		}
+		actual := WithPart(tt.cpe, "o")
+		if actual != tt.expected {
+			t.Errorf("WithPart(%s): expected %s, got %s", tt.cpe, tt.expected, actual)
+		}
+		if _, err := Convert(actual); err != nil {
+			t.Errorf("Convert(%s): %s", actual, err)
+		}
+	}
+}
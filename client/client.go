@@ -0,0 +1,303 @@
+// Package client provides a typed client of go-cpe-dictionary.
+// Dictionary is implemented both over the HTTP server (New) and over a local DB (NewLocal),
+// so callers can switch between the modes without changing the lookups.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
+	"golang.org/x/xerrors"
+)
+
+// Dictionary is the lookups of go-cpe-dictionary
+type Dictionary interface {
+	Health(ctx context.Context) (*Health, error)
+	GetVendorProducts(ctx context.Context) ([]string, error)
+	GetVendorProductsByPopularity(ctx context.Context) ([]string, error)
+	SearchProducts(ctx context.Context, query string) ([]search.Result, error)
+	GetProductSummaries(ctx context.Context) ([]models.ProductSummary, error)
+	RankProducts(ctx context.Context, vendor, product string) ([]search.Candidate, error)
+	GetCpesByVendorProduct(ctx context.Context, vendor, product string) ([]string, []string, error)
+	GetCpeDetailsByVendorProduct(ctx context.Context, vendor, product string) (*models.CpeDetails, error)
+	GetSourcedCpesByVendorProduct(ctx context.Context, vendor, product string, sources []models.FetchType) ([]models.SourcedCpe, error)
+	GetProductsByVersion(ctx context.Context, version string) ([]string, error)
+	GetCpeByNameID(ctx context.Context, id string) (*models.SourcedCpe, error)
+	Identify(ctx context.Context, banners []string) ([]search.BannerResult, error)
+}
+
+// Health is the status of the dictionary
+type Health struct {
+	Status             string     `json:"status"`
+	LastFetchedAt      time.Time  `json:"lastFetchedAt"`
+	NVDDictVersion     string     `json:"nvdDictVersion"`
+	NVDDictGeneratedAt *time.Time `json:"nvdDictGeneratedAt"`
+}
+
+// Option : options for New
+type Option struct {
+	// HTTPClient sends the requests. When nil, a client keeping up to MaxIdleConns connections is used.
+	HTTPClient *http.Client
+	// MaxIdleConns is the number of idle connections kept to the server (default: 16)
+	MaxIdleConns int
+	// Timeout of a request (default: 30s)
+	Timeout time.Duration
+	// MaxRetries on network errors and 5xx responses (default: 3)
+	MaxRetries uint64
+}
+
+// acceptV1 pins the responses to the API v1 on the unversioned paths, which the servers before the versioning ignore
+const acceptV1 = "application/vnd.go-cpe-dictionary.v1+json"
+
+// HTTPClient is the Dictionary over the go-cpe-dictionary server
+type HTTPClient struct {
+	baseURL    string
+	httpClient *http.Client
+	maxRetries uint64
+}
+
+// New returns the client of the server at baseURL, e.g. http://127.0.0.1:1328
+func New(baseURL string, option Option) *HTTPClient {
+	if option.MaxIdleConns == 0 {
+		option.MaxIdleConns = 16
+	}
+	if option.Timeout == 0 {
+		option.Timeout = 30 * time.Second
+	}
+	if option.MaxRetries == 0 {
+		option.MaxRetries = 3
+	}
+	httpClient := option.HTTPClient
+	if httpClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConns = option.MaxIdleConns
+		transport.MaxIdleConnsPerHost = option.MaxIdleConns
+		httpClient = &http.Client{Transport: transport, Timeout: option.Timeout}
+	}
+	return &HTTPClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+		maxRetries: option.MaxRetries,
+	}
+}
+
+// Health : GET /health
+func (c *HTTPClient) Health(ctx context.Context) (*Health, error) {
+	var health Health
+	if err := c.get(ctx, "/health", nil, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// GetVendorProducts : GET /products
+func (c *HTTPClient) GetVendorProducts(ctx context.Context) (vendorProducts []string, err error) {
+	err = c.get(ctx, "/products", nil, &vendorProducts)
+	return vendorProducts, err
+}
+
+// GetVendorProductsByPopularity : GET /products?sort=popularity
+func (c *HTTPClient) GetVendorProductsByPopularity(ctx context.Context) (vendorProducts []string, err error) {
+	err = c.get(ctx, "/products", url.Values{"sort": {"popularity"}}, &vendorProducts)
+	return vendorProducts, err
+}
+
+// SearchProducts : GET /products/search?q=
+func (c *HTTPClient) SearchProducts(ctx context.Context, query string) (results []search.Result, err error) {
+	err = c.get(ctx, "/products/search", url.Values{"q": {query}}, &results)
+	return results, err
+}
+
+// GetProductSummaries : GET /products/catalog
+func (c *HTTPClient) GetProductSummaries(ctx context.Context) (summaries []models.ProductSummary, err error) {
+	err = c.get(ctx, "/products/catalog", nil, &summaries)
+	return summaries, err
+}
+
+// RankProducts : GET /products/rank?vendor=&product=
+func (c *HTTPClient) RankProducts(ctx context.Context, vendor, product string) (candidates []search.Candidate, err error) {
+	err = c.get(ctx, "/products/rank", url.Values{"vendor": {vendor}, "product": {product}}, &candidates)
+	return candidates, err
+}
+
+// GetCpesByVendorProduct : GET /cpes/:vendor/:product
+func (c *HTTPClient) GetCpesByVendorProduct(ctx context.Context, vendor, product string) ([]string, []string, error) {
+	var res struct {
+		CpeURIs    []string `json:"cpeURIs"`
+		Deprecated []string `json:"deprecated"`
+	}
+	if err := c.get(ctx, fmt.Sprintf("/cpes/%s/%s", url.PathEscape(vendor), url.PathEscape(product)), nil, &res); err != nil {
+		return nil, nil, err
+	}
+	return res.CpeURIs, res.Deprecated, nil
+}
+
+// GetCpeDetailsByVendorProduct : GET /cpes/:vendor/:product?detail=true
+func (c *HTTPClient) GetCpeDetailsByVendorProduct(ctx context.Context, vendor, product string) (*models.CpeDetails, error) {
+	var details models.CpeDetails
+	if err := c.get(ctx, fmt.Sprintf("/cpes/%s/%s", url.PathEscape(vendor), url.PathEscape(product)), url.Values{"detail": {"true"}}, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// GetCpeDetailsAsOf : GET /cpes/:vendor/:product?detail=true&asOf=, the CPEs as they were at asOf
+func (c *HTTPClient) GetCpeDetailsAsOf(ctx context.Context, vendor, product string, asOf time.Time) (*models.CpeDetails, error) {
+	var details models.CpeDetails
+	query := url.Values{"detail": {"true"}, "asOf": {asOf.UTC().Format(time.RFC3339)}}
+	if err := c.get(ctx, fmt.Sprintf("/cpes/%s/%s", url.PathEscape(vendor), url.PathEscape(product)), query, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// GetSourcedCpesByVendorProduct : GET /cpes/:vendor/:product?sources=
+// Empty sources means all sources.
+func (c *HTTPClient) GetSourcedCpesByVendorProduct(ctx context.Context, vendor, product string, sources []models.FetchType) (cpes []models.SourcedCpe, err error) {
+	if len(sources) == 0 {
+		sources = []models.FetchType{models.NVD, models.JVN, models.Windows}
+	}
+	ss := make([]string, 0, len(sources))
+	for _, s := range sources {
+		ss = append(ss, string(s))
+	}
+	err = c.get(ctx, fmt.Sprintf("/cpes/%s/%s", url.PathEscape(vendor), url.PathEscape(product)), url.Values{"sources": {strings.Join(ss, ",")}}, &cpes)
+	return cpes, err
+}
+
+// GetProductsByVersion : GET /versions/:version/products
+func (c *HTTPClient) GetProductsByVersion(ctx context.Context, version string) (vendorProducts []string, err error) {
+	err = c.get(ctx, fmt.Sprintf("/versions/%s/products", url.PathEscape(version)), nil, &vendorProducts)
+	return vendorProducts, err
+}
+
+// GetCpeByNameID : GET /cpe-names/:id
+// It returns nil when no CPE has the cpeNameId.
+func (c *HTTPClient) GetCpeByNameID(ctx context.Context, id string) (*models.SourcedCpe, error) {
+	var cpe models.SourcedCpe
+	if err := c.get(ctx, fmt.Sprintf("/cpe-names/%s", url.PathEscape(id)), nil, &cpe); err != nil {
+		var serr *statusError
+		if xerrors.As(err, &serr) && serr.statusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &cpe, nil
+}
+
+// Identify : POST /identify
+func (c *HTTPClient) Identify(ctx context.Context, banners []string) (results []search.BannerResult, err error) {
+	err = c.post(ctx, "/identify", map[string][]string{"banners": banners}, &results)
+	return results, err
+}
+
+// Exists : POST /cpes:exists, telling which of the CPEs are in the dictionary in their order
+func (c *HTTPClient) Exists(ctx context.Context, cpes []string) ([]bool, error) {
+	var existence models.CpeExistence
+	if err := c.post(ctx, "/cpes:exists", map[string][]string{"cpes": cpes}, &existence); err != nil {
+		return nil, err
+	}
+	return existence.Exists, nil
+}
+
+// GetVendorHashes : GET /hashes
+func (c *HTTPClient) GetVendorHashes(ctx context.Context) (*models.VendorHashes, error) {
+	var hashes models.VendorHashes
+	if err := c.get(ctx, "/hashes", nil, &hashes); err != nil {
+		return nil, err
+	}
+	return &hashes, nil
+}
+
+// GetProductHashes : GET /hashes/:vendor, nil when the vendor isn't in the dictionary
+func (c *HTTPClient) GetProductHashes(ctx context.Context, vendor string) (*models.ProductHashes, error) {
+	var hashes models.ProductHashes
+	if err := c.get(ctx, fmt.Sprintf("/hashes/%s", url.PathEscape(vendor)), nil, &hashes); err != nil {
+		var serr *statusError
+		if xerrors.As(err, &serr) && serr.statusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &hashes, nil
+}
+
+// get sends GET, retrying on network errors and 5xx responses, and decodes the JSON response into v
+func (c *HTTPClient) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	u := c.baseURL + path
+	if 0 < len(query) {
+		u += "?" + query.Encode()
+	}
+	return c.do(ctx, http.MethodGet, u, nil, v)
+}
+
+// post sends in as JSON by POST, which must be idempotent as it's retried like get
+func (c *HTTPClient) post(ctx context.Context, path string, in, v interface{}) error {
+	j, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal. err: %s", err)
+	}
+	return c.do(ctx, http.MethodPost, c.baseURL+path, j, v)
+}
+
+// statusError is a response of the status code not retried
+type statusError struct {
+	url        string
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("HTTP error. url: %s, status code: %d", e.url, e.statusCode)
+}
+
+func (c *HTTPClient) do(ctx context.Context, method, u string, reqBody []byte, v interface{}) error {
+	var body []byte
+	f := func() error {
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(reqBody))
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("Failed to create request. url: %s, err: %s", u, err))
+		}
+		req.Header.Set("Accept", acceptV1)
+		if reqBody != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("HTTP error. url: %s, err: %s", u, err)
+		}
+		defer resp.Body.Close()
+		if body, err = ioutil.ReadAll(resp.Body); err != nil {
+			return fmt.Errorf("Failed to read response. url: %s, err: %s", u, err)
+		}
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return nil
+		case http.StatusInternalServerError <= resp.StatusCode:
+			return fmt.Errorf("HTTP error. url: %s, status code: %d", u, resp.StatusCode)
+		default:
+			return backoff.Permanent(&statusError{url: u, statusCode: resp.StatusCode})
+		}
+	}
+	b := backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), c.maxRetries), ctx)
+	if err := backoff.Retry(f, b); err != nil {
+		if perr, ok := err.(*backoff.PermanentError); ok {
+			return perr.Err
+		}
+		return err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("Failed to unmarshal. url: %s, err: %s", u, err)
+	}
+	return nil
+}
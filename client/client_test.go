@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func TestHTTPClient(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Accept") != acceptV1 {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/products":
+			if r.URL.Query().Get("sort") == "popularity" {
+				_, _ = w.Write([]byte(`["v2::p2","v1::p1"]`))
+				return
+			}
+			_, _ = w.Write([]byte(`["v1::p1","v2::p2"]`))
+		case "/cpes/vendor%2Fname/product":
+			if r.URL.Query().Get("sources") == "jvn" {
+				_, _ = w.Write([]byte(`[{"cpeURI":"cpe:/a:v:p:1","deprecated":false,"sources":["jvn"]}]`))
+				return
+			}
+			if r.URL.Query().Get("detail") == "true" {
+				_, _ = w.Write([]byte(`{"active":[{"cpeURI":"cpe:/a:v:p:1"}],"deprecated":[{"cpeURI":"cpe:/a:v:p:0","deprecatedBy":["cpe:/a:v:p:1"]}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"cpeURIs":["cpe:/a:v:p:1"],"deprecated":["cpe:/a:v:p:0"]}`))
+		case "/cpe-names/87316812-5F2C-4286-94FE-CC98B9EAEF53":
+			_, _ = w.Write([]byte(`{"cpeURI":"cpe:/a:v:p:1","cpeNameId":"87316812-5F2C-4286-94FE-CC98B9EAEF53","deprecated":false,"sources":["nvd"]}`))
+		case "/versions/1.0/products":
+			// fails once to be retried
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(`["v1::p1"]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := New(ts.URL+"/", Option{})
+
+	vps, err := c.GetVendorProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetVendorProducts: %s", err)
+	}
+	if expected := []string{"v1::p1", "v2::p2"}; !reflect.DeepEqual(vps, expected) {
+		t.Errorf("actual %#v, expected %#v", vps, expected)
+	}
+
+	vps, err = c.GetVendorProductsByPopularity(ctx)
+	if err != nil {
+		t.Fatalf("GetVendorProductsByPopularity: %s", err)
+	}
+	if expected := []string{"v2::p2", "v1::p1"}; !reflect.DeepEqual(vps, expected) {
+		t.Errorf("actual %#v, expected %#v", vps, expected)
+	}
+
+	cpeURIs, deprecated, err := c.GetCpesByVendorProduct(ctx, "vendor/name", "product")
+	if err != nil {
+		t.Fatalf("GetCpesByVendorProduct: %s", err)
+	}
+	if !reflect.DeepEqual(cpeURIs, []string{"cpe:/a:v:p:1"}) || !reflect.DeepEqual(deprecated, []string{"cpe:/a:v:p:0"}) {
+		t.Errorf("actual %#v %#v", cpeURIs, deprecated)
+	}
+
+	details, err := c.GetCpeDetailsByVendorProduct(ctx, "vendor/name", "product")
+	if err != nil {
+		t.Fatalf("GetCpeDetailsByVendorProduct: %s", err)
+	}
+	if expected := (&models.CpeDetails{
+		Active:     []models.CpeDetail{{CpeURI: "cpe:/a:v:p:1"}},
+		Deprecated: []models.CpeDetail{{CpeURI: "cpe:/a:v:p:0", DeprecatedBy: []string{"cpe:/a:v:p:1"}}},
+	}); !reflect.DeepEqual(details, expected) {
+		t.Errorf("actual %#v, expected %#v", details, expected)
+	}
+
+	sourced, err := c.GetSourcedCpesByVendorProduct(ctx, "vendor/name", "product", []models.FetchType{models.JVN})
+	if err != nil {
+		t.Fatalf("GetSourcedCpesByVendorProduct: %s", err)
+	}
+	if expected := []models.SourcedCpe{{CpeURI: "cpe:/a:v:p:1", Sources: []models.FetchType{models.JVN}}}; !reflect.DeepEqual(sourced, expected) {
+		t.Errorf("actual %#v, expected %#v", sourced, expected)
+	}
+
+	cpe, err := c.GetCpeByNameID(ctx, "87316812-5F2C-4286-94FE-CC98B9EAEF53")
+	if err != nil {
+		t.Fatalf("GetCpeByNameID: %s", err)
+	}
+	if expected := (&models.SourcedCpe{CpeURI: "cpe:/a:v:p:1", CpeNameID: "87316812-5F2C-4286-94FE-CC98B9EAEF53", Sources: []models.FetchType{models.NVD}}); !reflect.DeepEqual(cpe, expected) {
+		t.Errorf("actual %#v, expected %#v", cpe, expected)
+	}
+	if cpe, err := c.GetCpeByNameID(ctx, "unknown"); err != nil || cpe != nil {
+		t.Errorf("actual %#v, %v, expected nil for 404", cpe, err)
+	}
+
+	vps, err = c.GetProductsByVersion(ctx, "1.0")
+	if err != nil {
+		t.Fatalf("GetProductsByVersion: %s", err)
+	}
+	if expected := []string{"v1::p1"}; !reflect.DeepEqual(vps, expected) {
+		t.Errorf("actual %#v, expected %#v", vps, expected)
+	}
+	if calls != 2 {
+		t.Errorf("actual %d calls, expected 2", calls)
+	}
+
+	// 4xx is not retried
+	if _, err := c.Health(ctx); err == nil {
+		t.Errorf("expected an error of 404")
+	}
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
+)
+
+// LocalClient is the Dictionary over a local DB, answering the same as the server
+type LocalClient struct {
+	driver db.DB
+}
+
+// NewLocal returns the client reading the DB directly
+func NewLocal(driver db.DB) *LocalClient {
+	return &LocalClient{driver: driver}
+}
+
+// Health returns the status of the DB
+func (c *LocalClient) Health(_ context.Context) (*Health, error) {
+	fetchMeta, err := c.driver.GetFetchMeta()
+	if err != nil {
+		return nil, err
+	}
+	return &Health{
+		Status:             "ok",
+		LastFetchedAt:      fetchMeta.LastFetchedAt,
+		NVDDictVersion:     fetchMeta.NVDDictVersion,
+		NVDDictGeneratedAt: fetchMeta.NVDDictGeneratedAt,
+	}, nil
+}
+
+// GetVendorProducts : GetVendorProducts
+func (c *LocalClient) GetVendorProducts(_ context.Context) ([]string, error) {
+	return c.driver.GetVendorProducts()
+}
+
+// GetVendorProductsByPopularity : GetVendorProductsByPopularity
+func (c *LocalClient) GetVendorProductsByPopularity(_ context.Context) ([]string, error) {
+	return c.driver.GetVendorProductsByPopularity()
+}
+
+// SearchProducts : SearchProducts
+func (c *LocalClient) SearchProducts(_ context.Context, query string) ([]search.Result, error) {
+	return search.Products(c.driver, query)
+}
+
+// GetProductSummaries : GetProductSummaries
+func (c *LocalClient) GetProductSummaries(_ context.Context) ([]models.ProductSummary, error) {
+	return c.driver.GetProductSummaries()
+}
+
+// RankProducts : RankProducts
+func (c *LocalClient) RankProducts(_ context.Context, vendor, product string) ([]search.Candidate, error) {
+	return search.Rank(c.driver, db.LikePattern(vendor, false), db.LikePattern(product, false))
+}
+
+// GetCpesByVendorProduct : GetCpesByVendorProduct
+func (c *LocalClient) GetCpesByVendorProduct(_ context.Context, vendor, product string) ([]string, []string, error) {
+	return c.driver.GetCpesByVendorProduct(db.LikePattern(vendor, false), db.LikePattern(product, false))
+}
+
+// GetCpeDetailsByVendorProduct : GetCpeDetailsByVendorProduct
+func (c *LocalClient) GetCpeDetailsByVendorProduct(_ context.Context, vendor, product string) (*models.CpeDetails, error) {
+	return c.driver.GetCpeDetailsByVendorProduct(db.LikePattern(vendor, false), db.LikePattern(product, false))
+}
+
+// GetSourcedCpesByVendorProduct : GetSourcedCpesByVendorProduct
+func (c *LocalClient) GetSourcedCpesByVendorProduct(_ context.Context, vendor, product string, sources []models.FetchType) ([]models.SourcedCpe, error) {
+	return c.driver.GetSourcedCpesByVendorProduct(db.LikePattern(vendor, false), db.LikePattern(product, false), sources)
+}
+
+// GetProductsByVersion : GetProductsByVersion
+func (c *LocalClient) GetProductsByVersion(_ context.Context, version string) ([]string, error) {
+	return c.driver.GetProductsByVersion(version)
+}
+
+// GetCpeByNameID : GetCpeByNameID
+func (c *LocalClient) GetCpeByNameID(_ context.Context, id string) (*models.SourcedCpe, error) {
+	return c.driver.GetCpeByNameID(id)
+}
+
+var (
+	_ Dictionary = (*HTTPClient)(nil)
+	_ Dictionary = (*LocalClient)(nil)
+)
+
+// Identify : Identify
+func (c *LocalClient) Identify(_ context.Context, banners []string) ([]search.BannerResult, error) {
+	return search.IdentifyBanners(c.driver, banners)
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of the data-modifying operations",
+	Long:  "Show the audit log of the data-modifying operations: the fetches, the watchlist changes, gc and check-integrity --repair",
+}
+
+var auditListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the data-modifying operations",
+	Long:  "List the data-modifying operations, oldest first",
+	RunE:  executeAuditList,
+}
+
+func init() {
+	RootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditListCmd)
+
+	auditListCmd.Flags().Duration("since", 30*24*time.Hour, "list the operations within the duration")
+	auditListCmd.Flags().String("operation", "", "list only the operations of the kind, e.g. fetch, watch, unwatch, gc or repair (default: all)")
+}
+
+// recordAudit records a data-modifying operation in the audit log.
+// A failure is only logged, since the operation is already done.
+func recordAudit(driver db.DB, operation, target string, count int64, detail string) {
+	entry := models.AuditEntry{
+		OperatedAt: time.Now(),
+		Actor:      auditActor(),
+		Operation:  operation,
+		Target:     target,
+		Count:      count,
+		Detail:     detail,
+	}
+	if err := retryOnLocked("insert AuditEntry", func() error { return driver.InsertAuditEntry(&entry) }); err != nil {
+		log15.Warn("Failed to insert AuditEntry to DB.", "operation", operation, "target", target, "err", err)
+	}
+}
+
+// auditActor returns who runs the operations: --audit-actor, or the user and the host running the process
+func auditActor() string {
+	if actor := viper.GetString("audit-actor"); actor != "" {
+		return actor
+	}
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+	return name + "@" + host
+}
+
+func executeAuditList(cmd *cobra.Command, args []string) error {
+	since, err := cmd.Flags().GetDuration("since")
+	if err != nil {
+		return err
+	}
+	operation, err := cmd.Flags().GetString("operation")
+	if err != nil {
+		return err
+	}
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	entries, err := driver.GetAuditEntries(time.Now().Add(-since))
+	if err != nil {
+		log15.Error("Failed to get the audit log.", "err", err)
+		return err
+	}
+	fmt.Println("operated at\tactor\toperation\ttarget\tcount\tdetail")
+	for _, e := range entries {
+		if operation != "" && e.Operation != operation {
+			continue
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%d\t%s\n", e.OperatedAt.Format(time.RFC3339), e.Actor, e.Operation, e.Target, e.Count, e.Detail)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/spf13/cobra"
+)
+
+var checkIntegrityCmd = &cobra.Command{
+	Use:   "check-integrity",
+	Short: "Find duplicated CPEs, CPEs without the vendor and malformed CPE URIs in the DB",
+	Long:  "Find duplicated CPEs, CPEs without the vendor and malformed CPE URIs left in the DB by the older versions, and optionally repair them",
+	RunE:  executeCheckIntegrity,
+}
+
+func init() {
+	RootCmd.AddCommand(checkIntegrityCmd)
+
+	checkIntegrityCmd.PersistentFlags().Bool("repair", false, "delete the duplicates and the malformed CPEs, restore the vendors from the CPE URIs and add the unique index")
+}
+
+func executeCheckIntegrity(cmd *cobra.Command, args []string) error {
+	repair, err := cmd.Flags().GetBool("repair")
+	if err != nil {
+		return err
+	}
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
+		return err
+	}
+
+	var report *db.IntegrityReport
+	if err := retryOnLocked("check-integrity", func() (err error) {
+		report, err = driver.CheckIntegrity(repair)
+		return err
+	}); err != nil {
+		log15.Error("Failed to check integrity.", "err", err)
+		return err
+	}
+	if repair {
+		recordAudit(driver, models.AuditRepair, "", report.Repaired, fmt.Sprintf("%d issues", len(report.Issues)))
+	}
+
+	for _, i := range report.Issues {
+		fmt.Printf("%s\t%s\t%s\t%d rows\n", i.Kind, i.FetchType, i.CpeURI, i.Rows)
+	}
+	fmt.Printf("%d issues, %d rows repaired\n", len(report.Issues), report.Repaired)
+	if 0 < len(report.Issues) && !repair {
+		return fmt.Errorf("Found %d integrity issues. Run check-integrity --repair to repair them", len(report.Issues))
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/client"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compare the CPEs of the DB with those of another server",
+	Long:  "Compare the CPEs of the DB with those of another running server by the hashes of the vendors and then of the products of the vendors differing, e.g. to verify the replicas of a deployment are in sync",
+	RunE:  executeCompare,
+}
+
+func init() {
+	RootCmd.AddCommand(compareCmd)
+
+	compareCmd.PersistentFlags().String("remote", "", "URL of the server compared with, e.g. http://other-dict:1328")
+	compareCmd.PersistentFlags().Duration("request-timeout", 5*time.Minute, "timeout of a request to the server, which hashes its CPEs on the first request after a fetch")
+	addTimeoutFlags(compareCmd, "bound the comparison, e.g. 10m (default: no limit)")
+}
+
+// Kinds of the divergence printed by compare
+const (
+	divergeOnlyLocal  = "only local"
+	divergeOnlyRemote = "only remote"
+	divergeDiffer     = "differ"
+)
+
+func executeCompare(cmd *cobra.Command, args []string) error {
+	remote, err := cmd.Flags().GetString("remote")
+	if err != nil {
+		return err
+	}
+	if remote == "" {
+		return xerrors.Errorf("Specify --remote: %w", errConfig)
+	}
+	requestTimeout, err := cmd.Flags().GetDuration("request-timeout")
+	if err != nil {
+		return err
+	}
+	ctx, cancel, err := timeoutContext(cmd)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
+		return err
+	}
+
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		log15.Error("Failed to get FetchMeta from DB.", "err", err)
+		return err
+	}
+	local, err := db.ComputeHashes(driver)
+	if err != nil {
+		log15.Error("Failed to compute the hashes.", "err", err)
+		return err
+	}
+	c := client.New(remote, client.Option{Timeout: requestTimeout})
+	remoteVendors, err := c.GetVendorHashes(ctx)
+	if err != nil {
+		log15.Error("Failed to get the hashes of the remote.", "remote", remote, "err", err)
+		return err
+	}
+	log15.Info("Comparing", "local generation", fetchMeta.Generation, "remote generation", remoteVendors.Generation)
+	if local.Total == remoteVendors.Total {
+		fmt.Printf("in sync: %s\n", local.Total)
+		return nil
+	}
+
+	vendors := map[string]bool{}
+	for vendor := range local.Vendors {
+		vendors[vendor] = true
+	}
+	for vendor := range remoteVendors.Vendors {
+		vendors[vendor] = true
+	}
+	sorted := make([]string, 0, len(vendors))
+	for vendor := range vendors {
+		if local.Vendors[vendor] != remoteVendors.Vendors[vendor] {
+			sorted = append(sorted, vendor)
+		}
+	}
+	sort.Strings(sorted)
+
+	diverged := 0
+	for _, vendor := range sorted {
+		remoteProducts := map[string]string{}
+		if _, ok := remoteVendors.Vendors[vendor]; ok {
+			h, err := c.GetProductHashes(ctx, vendor)
+			if err != nil {
+				log15.Error("Failed to get the hashes of the remote.", "remote", remote, "vendor", vendor, "err", err)
+				return err
+			}
+			if h != nil {
+				remoteProducts = h.Products
+			}
+		}
+		for _, d := range diffHashes(local.Products[vendor], remoteProducts) {
+			fmt.Printf("%s\t%s::%s\n", d.kind, vendor, d.key)
+			diverged++
+		}
+	}
+	return xerrors.Errorf("%d vendor/products diverged from %s. err: %w", diverged, remote, errDiverged)
+}
+
+// hashDiff is a key whose hash differs between the local and the remote
+type hashDiff struct {
+	kind string
+	key  string
+}
+
+// diffHashes returns the keys whose hashes differ in the order of the keys
+func diffHashes(local, remote map[string]string) []hashDiff {
+	diffs := []hashDiff{}
+	for key, hash := range local {
+		switch r, ok := remote[key]; {
+		case !ok:
+			diffs = append(diffs, hashDiff{kind: divergeOnlyLocal, key: key})
+		case r != hash:
+			diffs = append(diffs, hashDiff{kind: divergeDiffer, key: key})
+		}
+	}
+	for key := range remote {
+		if _, ok := local[key]; !ok {
+			diffs = append(diffs, hashDiff{kind: divergeOnlyRemote, key: key})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].key < diffs[j].key })
+	return diffs
+}
@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
+	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+// configErrors collects the invalid flags and config values, so that all of them are told at once
+type configErrors []string
+
+// add records an invalid field with what to do about it
+func (errs *configErrors) add(field, format string, args ...interface{}) {
+	msg := fmt.Sprintf("--%s: %s", field, fmt.Sprintf(format, args...))
+	log15.Error("Invalid configuration", "field", field, "err", fmt.Sprintf(format, args...))
+	*errs = append(*errs, msg)
+}
+
+func (errs configErrors) err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return xerrors.Errorf("Invalid configuration. %s, err: %w", strings.Join(errs, "; "), errConfig)
+}
+
+// validateConfig checks the flags and the config values common to the commands on startup
+func validateConfig() error {
+	var errs configErrors
+	if proxy := viper.GetString("http-proxy"); proxy != "" {
+		if u, err := url.Parse(proxy); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			errs.add("http-proxy", "expected http://proxy-url:port, got %q", proxy)
+		}
+	}
+	if viper.GetBool("otlp-insecure") && viper.GetString("otlp-endpoint") == "" {
+		errs.add("otlp-insecure", "given without --otlp-endpoint")
+	}
+	if viper.GetDuration("lock-retry-timeout") < 0 {
+		errs.add("lock-retry-timeout", "expected 0 or more, got %s", viper.GetDuration("lock-retry-timeout"))
+	}
+	if _, err := newCollator(); err != nil {
+		errs.add("collate", "expected a locale, e.g. ja or en-US, got %q", viper.GetString("collate"))
+	}
+	if _, err := util.ParseLogLevels(viper.GetString("log-level")); err != nil {
+		errs.add("log-level", "expected the levels of the components as component=level, e.g. db=debug,fetch=info, got %q", viper.GetString("log-level"))
+	}
+	if viper.GetDuration("slow-query") < 0 {
+		errs.add("slow-query", "expected 0 or more, got %s", viper.GetDuration("slow-query"))
+	}
+	if _, err := sourcePriority(); err != nil {
+		errs.add("source-priority", "expected the sources of nvd, jvn and windows, e.g. nvd,jvn, got %q", viper.GetString("source-priority"))
+	}
+	return errs.err()
+}
+
+// sourcePriority returns the sources of --source-priority, or nil without it
+func sourcePriority() ([]models.FetchType, error) {
+	param := viper.GetString("source-priority")
+	if param == "" {
+		return nil, nil
+	}
+	return models.ParseFetchTypes(param)
+}
+
+// newCollator returns the Collator of --collate, or nil without it
+func newCollator() (*search.Collator, error) {
+	locale := viper.GetString("collate")
+	if locale == "" {
+		return nil, nil
+	}
+	return search.NewCollator(locale)
+}
+
+// iamAuth returns the IAM authentication of the RDB given by --rds-iam-auth or --cloudsql-iam-auth, or empty
+func iamAuth() string {
+	switch {
+	case viper.GetBool("rds-iam-auth"):
+		return db.IAMAuthRDS
+	case viper.GetBool("cloudsql-iam-auth"):
+		return db.IAMAuthCloudSQL
+	}
+	return ""
+}
+
+// validateDBConfig checks the flags of the DB before connecting, so that a typo isn't told by gorm or go-redis
+func validateDBConfig(dbType string) error {
+	var errs configErrors
+	dbPath := viper.GetString("dbpath")
+	cache, store := viper.GetString("cache"), viper.GetString("store")
+	if dbType == "tiered" {
+		if cache == "" {
+			errs.add("cache", "required by --dbtype tiered, e.g. redis://localhost:6379/0")
+		} else if t := db.DetectType(cache); t == "tiered" {
+			errs.add("cache", "expected a DB other than tiered")
+		} else if err := db.ValidatePath(t, cache); err != nil {
+			errs.add("cache", "%s", err)
+		}
+		if store == "" {
+			store = dbPath
+		}
+		if err := db.ValidatePath(db.DetectType(store), store); err != nil {
+			errs.add("store", "%s", err)
+		}
+	} else {
+		if cache != "" {
+			errs.add("cache", "only used by --dbtype tiered, got --dbtype %s", dbType)
+		}
+		if store != "" {
+			errs.add("store", "only used by --dbtype tiered, got --dbtype %s", dbType)
+		}
+		if err := db.ValidatePath(dbType, dbPath); err != nil {
+			errs.add("dbpath", "%s", err)
+		}
+	}
+
+	if viper.GetInt("batch-size") < 0 {
+		errs.add("batch-size", "expected 0 or more, got %d", viper.GetInt("batch-size"))
+	}
+	if viper.GetInt("delete-batch-size") < 0 {
+		errs.add("delete-batch-size", "expected 0 or more, got %d", viper.GetInt("delete-batch-size"))
+	}
+	if viper.GetInt("threads") < 0 {
+		errs.add("threads", "expected 0 or more, got %d", viper.GetInt("threads"))
+	}
+	if viper.GetDuration("delete-pause") < 0 {
+		errs.add("delete-pause", "expected 0 or more, got %s", viper.GetDuration("delete-pause"))
+	}
+	if viper.GetBool("pg-partition") && dbType != "postgres" && !(dbType == "tiered" && db.DetectType(store) == "postgres") {
+		errs.add("pg-partition", "only supported by PostgreSQL, got --dbtype %s", dbType)
+	}
+	if ttl := viper.GetDuration("redis-key-ttl"); ttl < 0 {
+		errs.add("redis-key-ttl", "expected 0 or more, got %s", ttl)
+	} else if 0 < ttl {
+		switch {
+		case dbType == "tiered" && db.DetectType(cache) == "redis":
+			// the cache refills the expired keys from the store
+		case dbType == "redis":
+			log15.Warn("The CPEs expire by --redis-key-ttl and are lost until the next fetch, since redis is the only DB. Use it for the cache of --dbtype tiered", "redis-key-ttl", ttl)
+		default:
+			errs.add("redis-key-ttl", "only used by redis, got --dbtype %s", dbType)
+		}
+	}
+	// the CPEs loaded into memory are searched by the wildcards whatever the DB is
+	if viper.GetBool("glob") && !viper.GetBool("in-memory") && (dbType == "dynamodb" || (dbType == "tiered" && db.DetectType(store) == "dynamodb")) {
+		errs.add("glob", "not supported by DynamoDB, which looks up the vendor/products by the names only, got --dbtype %s", dbType)
+	}
+	if viper.GetBool("rds-iam-auth") && viper.GetBool("cloudsql-iam-auth") {
+		errs.add("cloudsql-iam-auth", "can't be used with --rds-iam-auth")
+	} else if auth := iamAuth(); auth != "" {
+		rdbType := dbType
+		if dbType == "tiered" {
+			rdbType = db.DetectType(store)
+		}
+		if err := db.ValidateIAMAuth(rdbType, auth); err != nil {
+			errs.add(auth+"-iam-auth", "%s", err)
+		}
+	}
+	if (dbType == "redis" || dbType == "dynamodb") && (viper.GetBool("fast-read") || viper.GetBool("prepare-stmt") || viper.GetInt("batch-size") != 0 || viper.GetInt("delete-batch-size") != 0 || viper.GetDuration("delete-pause") != 0) {
+		log15.Warn("--fast-read, --prepare-stmt, --batch-size, --delete-batch-size and --delete-pause are ignored by the DB other than RDB", "dbtype", dbType)
+	}
+	return errs.err()
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/binding"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert cpe...",
+	Short: "Convert CPEs to all the bindings",
+	Long: `Convert CPEs in any of the URI of CPE 2.2, the formatted string of CPE 2.3 and the WFN to all of them and the attributes, printed as JSON Lines.
+With --infer-part, the part of a CPE given without one, e.g. cpe:2.3:*:microsoft:windows_10:1809:*:*:*:*:*:*:*, is inferred from the CPEs of the dictionary and asked to be confirmed, otherwise bound with the part ANY`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: executeConvert,
+}
+
+func init() {
+	RootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().Bool("infer-part", false, "infer the part of the CPEs without one from the CPEs of the same vendor/product or vendor in the DB")
+	convertCmd.Flags().Bool("yes", false, "take the parts inferred by --infer-part without asking")
+}
+
+func executeConvert(cmd *cobra.Command, args []string) error {
+	inferPart, err := cmd.Flags().GetBool("infer-part")
+	if err != nil {
+		return err
+	}
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+
+	var driver db.DB
+	in := bufio.NewReader(os.Stdin)
+	for _, cpe := range args {
+		// without --infer-part, a CPE without the part is bound with the part ANY as it is
+		if inferPart && binding.MissingPart(cpe) {
+			if driver == nil {
+				if driver, err = openQueryDB(); err != nil {
+					return err
+				}
+				defer func() {
+					_ = driver.CloseDB()
+				}()
+			}
+			if cpe, err = confirmPart(driver, in, os.Stderr, cpe, yes); err != nil {
+				return err
+			}
+		}
+		bindings, err := binding.Convert(cpe)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(bindings)
+		if err != nil {
+			return fmt.Errorf("Failed to marshal. err: %s", err)
+		}
+		fmt.Println(string(b))
+	}
+	return nil
+}
+
+// confirmPart infers the part of cpe without one, and returns cpe with it once it's confirmed on in, or by yes
+func confirmPart(driver db.DB, in *bufio.Reader, out io.Writer, cpe string, yes bool) (string, error) {
+	// the vendor and the product are read as they are whatever the part is
+	b, err := binding.Convert(binding.WithPart(cpe, "a"))
+	if err != nil {
+		return "", err
+	}
+	vendor, product := b.WFNAttributes["vendor"], b.WFNAttributes["product"]
+	inference, err := search.InferPart(driver, vendor, product)
+	if err != nil {
+		return "", err
+	}
+
+	var reason string
+	switch inference.Basis {
+	case "default":
+		reason = fmt.Sprintf("no CPEs of %s in the DB, taken as an application", vendor)
+	default:
+		reason = fmt.Sprintf("%.0f%% of the %d CPEs of the %s", inference.Share*100, inference.CPEs, inference.Basis)
+	}
+	if yes {
+		log15.Info("Inferred the part", "cpe", cpe, "part", inference.Part, "from", reason)
+		return binding.WithPart(cpe, inference.Part), nil
+	}
+
+	fmt.Fprintf(out, "%s has no part. Use %s, inferred from %s? [y/N] ", cpe, inference.Part, reason)
+	answer, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", xerrors.Errorf("Failed to read the answer. err: %w", err)
+	}
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return "", xerrors.Errorf("The part is not confirmed, give it as a, o or h. cpe: %s", cpe)
+	}
+	return binding.WithPart(cpe, inference.Part), nil
+}
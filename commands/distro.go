@@ -0,0 +1,15 @@
+package commands
+
+import (
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/distro"
+)
+
+// loadDistroPackages reloads the mapping of the distribution packages shipped with this binary.
+// A failure is only logged, since the CPEs are already stored.
+func loadDistroPackages(driver db.DB) {
+	if err := retryOnLocked("insert distribution packages", func() error { return driver.InsertDistroPackages(distro.Packages()) }); err != nil {
+		log15.Warn("Failed to insert the distribution packages to DB.", "err", err)
+	}
+}
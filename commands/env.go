@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// envPrefix is the prefix of the environment variables setting the flags, e.g. GO_CPE_DICTIONARY_DBPATH sets --dbpath
+const envPrefix = "GO_CPE_DICTIONARY_"
+
+// envName returns the environment variable setting the flag
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// setFlagsFromEnv sets the flags not given on the command line from their environment variables.
+// The flags set this way are read as if they were given, so the command line takes precedence over
+// the environment variables, which take precedence over the config file.
+func setFlagsFromEnv(flags *pflag.FlagSet) error {
+	var errs configErrors
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed || f.Name == "help" {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if err := flags.Set(f.Name, value); err != nil {
+			errs.add(f.Name, "invalid %s=%q: %s", envName(f.Name), value, err)
+		}
+	})
+	return errs.err()
+}
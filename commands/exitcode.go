@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"golang.org/x/xerrors"
+)
+
+// Exit codes of go-cpe-dictionary, for wrapper scripts and CI to branch on
+const (
+	// ExitOK : succeeded
+	ExitOK = 0
+	// ExitError : failed for other reasons
+	ExitError = 1
+	// ExitPartialFetch : fetched, but some feeds were skipped (--on-error skip or record)
+	ExitPartialFetch = 2
+	// ExitSchemaMismatch : the DB was created by an incompatible schema version
+	ExitSchemaMismatch = 3
+	// ExitDBLocked : the DB stayed locked by another process beyond --lock-retry-timeout
+	ExitDBLocked = 4
+	// ExitRateLimited : the feed server kept rate limiting the requests
+	ExitRateLimited = 5
+	// ExitTimeout : the command didn't finish within --timeout
+	ExitTimeout = 6
+	// ExitShrink : the fetched CPEs were fewer than those in the DB by more than --max-shrink, and not stored
+	ExitShrink = 7
+	// ExitConfig : a flag or a config value is invalid
+	ExitConfig = 8
+	// ExitStale : the DB was never fetched, or last fetched before --max-age of healthcheck
+	ExitStale = 9
+	// ExitRejected : the feeds had malformed CPEs rejected by --strict, and nothing was stored
+	ExitRejected = 10
+	// ExitDiverged : compare found the CPEs differing from those of the remote
+	ExitDiverged = 11
+	// ExitAPIKeyInvalid : the NVD API rejected --api-key
+	ExitAPIKeyInvalid = 12
+	// ExitMaintenance : the NVD API was under maintenance
+	ExitMaintenance = 13
+)
+
+var (
+	errPartialFetch   = xerrors.New("some feeds could not be fetched")
+	errSchemaMismatch = xerrors.New("schema version mismatch")
+	errShrink         = xerrors.New("fetched CPEs shrank")
+	errConfig         = xerrors.New("invalid configuration")
+	errStale          = xerrors.New("stale dictionary")
+	errRejected       = xerrors.New("malformed CPEs rejected")
+	errDiverged       = xerrors.New("diverged from the remote")
+)
+
+// ExitCode returns the exit code for the error returned by RootCmd.Execute
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case xerrors.Is(err, errPartialFetch):
+		return ExitPartialFetch
+	case xerrors.Is(err, errSchemaMismatch):
+		return ExitSchemaMismatch
+	case xerrors.Is(err, db.ErrLocked):
+		return ExitDBLocked
+	case xerrors.Is(err, util.ErrRateLimited):
+		return ExitRateLimited
+	case xerrors.Is(err, context.DeadlineExceeded):
+		return ExitTimeout
+	case xerrors.Is(err, errShrink):
+		return ExitShrink
+	case xerrors.Is(err, errConfig), xerrors.Is(err, db.ErrEvictingRedis):
+		return ExitConfig
+	case xerrors.Is(err, errStale):
+		return ExitStale
+	case xerrors.Is(err, errRejected):
+		return ExitRejected
+	case xerrors.Is(err, errDiverged):
+		return ExitDiverged
+	case xerrors.Is(err, fetcher.ErrNVDAPIKeyInvalid):
+		return ExitAPIKeyInvalid
+	case xerrors.Is(err, fetcher.ErrNVDAPIMaintenance):
+		return ExitMaintenance
+	}
+	return ExitError
+}
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/seed"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the CPEs of the DB, or only those changed since a generation or a time",
+	Long: `Export the CPEs of the DB to a gzipped JSON Lines file in the seed format.
+With --since-generation or --since, only the CPEs added, changed or deprecated after it are exported, so that a mirror
+consumes a small incremental file rather than a full dump. The header tells the generation to pass to the next export.
+The changes are tracked by the RDB only.`,
+	Args: cobra.NoArgs,
+	RunE: executeExport,
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+
+	pwd := os.Getenv("PWD")
+	exportCmd.PersistentFlags().String("out", filepath.Join(pwd, "cpes-export.jsonl.gz"), "/path/to/file to write the CPEs to")
+	exportCmd.PersistentFlags().String("since", "", "export only the CPEs changed at or after the date or the time, e.g. 2024-01-01 or 2024-01-01T00:00:00Z (default: all)")
+	exportCmd.PersistentFlags().Uint64("since-generation", 0, "export only the CPEs changed by the fetches after the generation, e.g. the generation of the header of the last export (default: all)")
+}
+
+func executeExport(cmd *cobra.Command, args []string) (err error) {
+	path, err := cmd.Flags().GetString("out")
+	if err != nil {
+		return err
+	}
+	sinceGeneration, err := cmd.Flags().GetUint64("since-generation")
+	if err != nil {
+		return err
+	}
+	param, err := cmd.Flags().GetString("since")
+	if err != nil {
+		return err
+	}
+	since, err := parseSince(param)
+	if err != nil {
+		return err
+	}
+	if 0 < sinceGeneration && !since.IsZero() {
+		return xerrors.Errorf("Invalid --since and --since-generation, expected either: %w", errConfig)
+	}
+
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
+		return err
+	}
+
+	// FetchMeta is read first, so that a fetch during the export is exported again by the next one rather than missed
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		log15.Error("Failed to get FetchMeta from DB.", "err", err)
+		return err
+	}
+	cpes, err := driver.GetCpesChangedSince(sinceGeneration, since)
+	if err != nil {
+		log15.Error("Failed to get the changed CPEs.", "err", err)
+		return err
+	}
+
+	header := seed.Header{
+		SchemaVersion:      models.LatestSchemaVersion,
+		FetchedAt:          fetchMeta.LastFetchedAt,
+		NVDDictVersion:     fetchMeta.NVDDictVersion,
+		NVDDictGeneratedAt: fetchMeta.NVDDictGeneratedAt,
+		Generation:         fetchMeta.Generation,
+		SinceGeneration:    sinceGeneration,
+	}
+	if !since.IsZero() {
+		header.Since = &since
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return xerrors.Errorf("Failed to create the export. path: %s, err: %w", path, err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	if err := seed.Write(f, header, cpes); err != nil {
+		return xerrors.Errorf("Failed to write the export. path: %s, err: %w", path, err)
+	}
+	log15.Info(fmt.Sprintf("Wrote %d CPEs to %s", len(cpes), path), "generation", fetchMeta.Generation)
+	return nil
+}
+
+// parseSince parses --since, a date or an RFC 3339 time, zero when it's empty
+func parseSince(param string) (time.Time, error) {
+	if param == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, param); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, xerrors.Errorf("Invalid --since: %s, expected a date or an RFC 3339 time, e.g. 2024-01-01: %w", param, errConfig)
+}
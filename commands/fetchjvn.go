@@ -2,12 +2,16 @@ package commands
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/inconshreveable/log15"
-	"github.com/kotakanbe/go-cpe-dictionary/db"
 	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/seed"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
 )
 
 var fetchJvnCmd = &cobra.Command{
@@ -22,50 +26,153 @@ func init() {
 
 	fetchJvnCmd.PersistentFlags().Bool("stdout", false, "display all CPEs to stdout")
 	_ = viper.BindPFlag("stdout", fetchJvnCmd.PersistentFlags().Lookup("stdout"))
+
+	addOutputFlags(fetchJvnCmd)
+	addRawFlags(fetchJvnCmd)
+	addWatchFlags(fetchJvnCmd)
+	addShrinkFlags(fetchJvnCmd)
+	addTimeoutFlags(fetchJvnCmd, "bound the whole fetch, including the HTTP requests and the DB operations, e.g. 1h (default: no limit)")
+	addMemoryFlags(fetchJvnCmd)
+	addPipelineFlags(fetchJvnCmd)
+	addSwapFlags(fetchJvnCmd)
+	addRejectFlags(fetchJvnCmd)
+	addReplayFlags(fetchJvnCmd)
+	addProfileFlags(fetchJvnCmd)
+
+	fetchJvnCmd.PersistentFlags().String("base-url", fetcher.DefaultJVNBaseURL, "base URL of the JVN feeds, e.g. a mirror")
+	_ = viper.BindPFlag("jvn-base-url", fetchJvnCmd.PersistentFlags().Lookup("base-url"))
 }
 
 func fetchJvn(cmd *cobra.Command, args []string) (err error) {
-	log15.Info("Initialize Database")
-	driver, locked, err := db.NewDB(viper.GetString("dbtype"), viper.GetString("dbpath"), viper.GetBool("debug-sql"))
+	ctx, cancel, err := timeoutContext(cmd)
 	if err != nil {
-		if locked {
-			log15.Error("Failed to initialize DB. Close DB connection before fetching", "err", err)
-		}
 		return err
 	}
+	defer cancel()
+	if err := applyMemoryLimit(cmd); err != nil {
+		return err
+	}
+	if err := applyPipeline(cmd); err != nil {
+		return err
+	}
+	stopProfile, err := startProfile(cmd)
+	if err != nil {
+		return err
+	}
+	defer stopProfile()
 
-	cpes, err := fetcher.FetchJVN()
+	outOpt, err := outputOption(cmd)
+	if err != nil {
+		return err
+	}
+	replay, err := replayPath(cmd)
+	if err != nil {
+		return err
+	}
+	guard, err := newShrinkGuard(cmd)
+	if err != nil {
+		return err
+	}
+	policy, err := newRejectPolicy(cmd)
 	if err != nil {
-		log15.Error("Failed to fetch.", "err", err)
 		return err
 	}
-	log15.Info("Fetched", "Number of CPEs", len(cpes))
 
-	if !viper.GetBool("stdout") {
-		if err = driver.InsertCpes(cpes); err != nil {
-			log15.Error("Failed to insert.", "err", err)
-			return fmt.Errorf("Failed to insert cpes. err : %s", err)
+	log15.Info("Initialize Database")
+	driver, swap, err := newFetchDB(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = swap(err)
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
+		return err
+	}
+
+	startedAt := time.Now()
+	var (
+		header  seed.Header
+		cpes    []models.CategorizedCpe
+		rejects []models.RejectedCpe
+	)
+	if replay != "" {
+		if header, cpes, err = readReplay(replay, models.JVN); err != nil {
+			log15.Error("Failed to replay.", "err", err)
+			return err
 		}
-		log15.Info(fmt.Sprintf("Inserted %d CPEs", len(cpes)))
 	} else {
-		for _, cpe := range cpes {
-			fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s%t\n",
-				cpe.CpeURI,
-				cpe.CpeFS,
-				cpe.Part,
-				cpe.Vendor,
-				cpe.Product,
-				cpe.Version,
-				cpe.Update,
-				cpe.Edition,
-				cpe.Language,
-				cpe.SoftwareEdition,
-				cpe.TargetSoftware,
-				cpe.TargetHardware,
-				cpe.Other,
-				cpe.Deprecated,
-			)
+		fetcher.JVNBaseURL = strings.TrimSuffix(viper.GetString("jvn-base-url"), "/")
+		finishRaw, err := setupRaw(cmd)
+		if err != nil {
+			log15.Error("Failed to set up the raw feeds.", "err", err)
+			return err
+		}
+		cpes, err = fetcher.FetchJVN(ctx)
+		finishRaw()
+		if err != nil {
+			log15.Error("Failed to fetch.", "err", err)
+			return err
+		}
+		log15.Info("Fetched", "Number of CPEs", len(cpes))
+		if rejects, err = policy.take(models.JVN); err != nil {
+			return err
+		}
+		header = seed.Header{Source: models.JVN, FetchedAt: time.Now()}
+	}
+
+	if outOpt == nil {
+		if err := ctx.Err(); err != nil {
+			return xerrors.Errorf("Timed out before inserting. err: %w", err)
 		}
+		ahead := &aheadFile{}
+		if replay == "" {
+			ahead = writeAhead(cmd, header, cpes)
+		}
+		defer ahead.keep()
+		if err := guard.check(driver, models.JVN, cpes); err != nil {
+			return err
+		}
+		// the malformed CPEs aren't written ahead, so a replay leaves the quarantined ones as is
+		if replay == "" {
+			if err := policy.quarantine(driver, models.JVN, rejects); err != nil {
+				log15.Error("Failed to quarantine.", "err", err)
+				return err
+			}
+		}
+		hash, err := insertChangedCpes(driver, models.JVN, cpes, true)
+		if err != nil {
+			log15.Error("Failed to insert.", "err", err)
+			return err
+		}
+
+		fetchMeta, err := driver.GetFetchMeta()
+		if err != nil {
+			log15.Error("Failed to get FetchMeta from DB.", "err", err)
+			return err
+		}
+		// a replay is as old as its fetch
+		fetchMeta.LastFetchedAt = header.FetchedAt
+		fetchMeta.Generation++
+		fetchMeta.SetSourceHash(models.JVN, hash)
+		if err := retryOnLocked("upsert FetchMeta", func() error { return driver.UpsertFetchMeta(fetchMeta) }); err != nil {
+			log15.Error("Failed to upsert FetchMeta to DB.", "err", err)
+			return err
+		}
+		ahead.commit()
+		recordFetch(driver, models.JVN, startedAt, len(cpes), "")
+		loadDistroPackages(driver)
+		saveSearchIndex(driver)
+		webhookURL, err := cmd.Flags().GetString("webhook-url")
+		if err != nil {
+			return err
+		}
+		checkWatchlist(ctx, driver, webhookURL)
+		log15.Info(fmt.Sprintf("Inserted %d CPEs", len(cpes)))
+	} else if err := dumpCpes(*outOpt, cpes); err != nil {
+		log15.Error("Failed to write CPEs.", "err", err)
+		return err
 	}
 
 	return nil
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+var fetchKEVCmd = &cobra.Command{
+	Use:   "fetchkev",
+	Short: "Fetch the vendor/products of the CISA Known Exploited Vulnerabilities catalog",
+	Long:  "Fetch the vendor/products of the CISA Known Exploited Vulnerabilities catalog, and flag the matching vendor/products of the dictionary as knownExploited. Run it after the fetch of the CPEs",
+	RunE:  fetchKEV,
+}
+
+func init() {
+	RootCmd.AddCommand(fetchKEVCmd)
+
+	addTimeoutFlags(fetchKEVCmd, "bound the whole fetch, including the HTTP request and the DB operations, e.g. 10m (default: no limit)")
+
+	fetchKEVCmd.PersistentFlags().String("url", fetcher.DefaultKEVURL, "URL of the JSON of the CISA Known Exploited Vulnerabilities catalog, e.g. a mirror")
+	_ = viper.BindPFlag("kev-url", fetchKEVCmd.PersistentFlags().Lookup("url"))
+}
+
+func fetchKEV(cmd *cobra.Command, args []string) (err error) {
+	ctx, cancel, err := timeoutContext(cmd)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	log15.Info("Initialize Database")
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
+		return err
+	}
+
+	fetcher.KEVURL = viper.GetString("kev-url")
+	products, version, err := fetcher.FetchKEV(ctx)
+	if err != nil {
+		log15.Error("Failed to fetch.", "err", err)
+		return err
+	}
+	vendorProducts, err := driver.GetVendorProducts()
+	if err != nil {
+		log15.Error("Failed to get the vendor/products from DB.", "err", err)
+		return err
+	}
+	matched, unmatched := fetcher.MatchKEV(products, vendorProducts)
+	log15.Info("Fetched", "catalogVersion", version, "Number of vendor/products", len(products), "matched", len(matched), "not in the dictionary", unmatched)
+
+	if err := ctx.Err(); err != nil {
+		return xerrors.Errorf("Timed out before inserting. err: %w", err)
+	}
+	if err := retryOnLocked("replace known exploited products", func() error { return driver.ReplaceKnownExploited(matched) }); err != nil {
+		log15.Error("Failed to replace the known exploited products.", "err", err)
+		return err
+	}
+	recordAudit(driver, models.AuditFetch, "kev", int64(len(matched)), "catalog version "+version)
+
+	// the responses flagging the products change, though the CPEs don't
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		log15.Error("Failed to get FetchMeta from DB.", "err", err)
+		return err
+	}
+	fetchMeta.Generation++
+	if err := retryOnLocked("upsert FetchMeta", func() error { return driver.UpsertFetchMeta(fetchMeta) }); err != nil {
+		log15.Error("Failed to upsert FetchMeta to DB.", "err", err)
+		return err
+	}
+	saveSearchIndex(driver)
+	log15.Info(fmt.Sprintf("Flagged %d vendor/products as known exploited", len(matched)))
+	return nil
+}
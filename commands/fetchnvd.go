@@ -1,13 +1,18 @@
 package commands
 
 import (
-	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/inconshreveable/log15"
-	"github.com/kotakanbe/go-cpe-dictionary/db"
 	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/seed"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
 )
 
 var fetchNvdCmd = &cobra.Command{
@@ -22,50 +27,273 @@ func init() {
 
 	fetchNvdCmd.PersistentFlags().Bool("stdout", false, "display all CPEs to stdout")
 	_ = viper.BindPFlag("stdout", fetchNvdCmd.PersistentFlags().Lookup("stdout"))
+
+	addOutputFlags(fetchNvdCmd)
+	addRawFlags(fetchNvdCmd)
+	addWatchFlags(fetchNvdCmd)
+	addShrinkFlags(fetchNvdCmd)
+	addTimeoutFlags(fetchNvdCmd, "bound the whole fetch, including the HTTP requests and the DB operations, e.g. 2h (default: no limit)")
+	addMemoryFlags(fetchNvdCmd)
+	addPipelineFlags(fetchNvdCmd)
+	addSwapFlags(fetchNvdCmd)
+	addRejectFlags(fetchNvdCmd)
+	addReplayFlags(fetchNvdCmd)
+	addProfileFlags(fetchNvdCmd)
+
+	fetchNvdCmd.PersistentFlags().String("base-url", fetcher.DefaultNVDBaseURL, "base URL of the NVD feeds, e.g. a mirror")
+	_ = viper.BindPFlag("nvd-base-url", fetchNvdCmd.PersistentFlags().Lookup("base-url"))
+
+	fetchNvdCmd.PersistentFlags().Bool("count-cve-refs", false, "count CVEs referencing each vendor/product and store it as popularity")
+	_ = viper.BindPFlag("count-cve-refs", fetchNvdCmd.PersistentFlags().Lookup("count-cve-refs"))
+
+	fetchNvdCmd.PersistentFlags().String("on-error", fetcher.OnErrorFail, "policy when a feed can't be fetched (fail, skip or record)")
+	_ = viper.BindPFlag("on-error", fetchNvdCmd.PersistentFlags().Lookup("on-error"))
+
+	pwd := os.Getenv("PWD")
+	fetchNvdCmd.PersistentFlags().String("failed-feeds-path", filepath.Join(pwd, "cpe-failed-feeds.json"), "/path/to/file recording the failed feeds, reported as recovered once a later run fetches them (record)")
+	_ = viper.BindPFlag("failed-feeds-path", fetchNvdCmd.PersistentFlags().Lookup("failed-feeds-path"))
+
+	fetchNvdCmd.PersistentFlags().String("cpe-match-string", "", "fetch only the CPEs matching the CPE 2.3 prefix from the NVD CPE API instead of the feeds, e.g. cpe:2.3:*:cisco")
+	fetchNvdCmd.PersistentFlags().String("keyword-search", "", "fetch only the CPEs whose titles have the words from the NVD CPE API instead of the feeds")
+	fetchNvdCmd.PersistentFlags().String("api-cache-dir", "", "/path/to/dir to cache the pages of the NVD CPE API, replayed by the fetches re-run within --api-cache-ttl (default: disabled)")
+	fetchNvdCmd.PersistentFlags().Duration("api-cache-ttl", 6*time.Hour, "how long the cached pages of the NVD CPE API are replayed")
+	fetchNvdCmd.PersistentFlags().String("api-key", "", "API key of the NVD CPE API, raising its rate limit, e.g. by GO_CPE_DICTIONARY_API_KEY (default: none)")
+
+	fetchNvdCmd.PersistentFlags().String("filter-vendors", "", "/path/to/file listing the vendors to persist, one vendor per line (default: all vendors)")
+	_ = viper.BindPFlag("filter-vendors", fetchNvdCmd.PersistentFlags().Lookup("filter-vendors"))
 }
 
 func fetchNvd(cmd *cobra.Command, args []string) (err error) {
-	log15.Info("Initialize Database")
-	driver, locked, err := db.NewDB(viper.GetString("dbtype"), viper.GetString("dbpath"), viper.GetBool("debug-sql"))
+	ctx, cancel, err := timeoutContext(cmd)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	if err := applyMemoryLimit(cmd); err != nil {
+		return err
+	}
+	if err := applyPipeline(cmd); err != nil {
+		return err
+	}
+	stopProfile, err := startProfile(cmd)
+	if err != nil {
+		return err
+	}
+	defer stopProfile()
+
+	onError := viper.GetString("on-error")
+	if err := fetcher.ValidateOnError(onError); err != nil {
+		return err
+	}
+	outOpt, err := outputOption(cmd)
+	if err != nil {
+		return err
+	}
+	replay, err := replayPath(cmd)
+	if err != nil {
+		return err
+	}
+
+	var vendors fetcher.VendorFilter
+	if path := viper.GetString("filter-vendors"); path != "" {
+		if vendors, err = fetcher.LoadVendorFilter(path); err != nil {
+			log15.Error("Failed to load vendor filter.", "err", err)
+			return err
+		}
+		log15.Info("Filtering vendors", "Number of vendors", len(vendors))
+	}
+
+	var query fetcher.NVDAPIQuery
+	if query.CpeMatchString, err = cmd.Flags().GetString("cpe-match-string"); err != nil {
+		return err
+	}
+	if query.KeywordSearch, err = cmd.Flags().GetString("keyword-search"); err != nil {
+		return err
+	}
+	if err := query.Validate(); err != nil {
+		return err
+	}
+	if fetcher.NVDAPIKey, err = cmd.Flags().GetString("api-key"); err != nil {
+		return err
+	}
+	cacheDir, err := cmd.Flags().GetString("api-cache-dir")
 	if err != nil {
-		if locked {
-			log15.Error("Failed to initialize DB. Close DB connection before fetching", "err", err)
+		return err
+	}
+	if cacheDir != "" {
+		ttl, err := cmd.Flags().GetDuration("api-cache-ttl")
+		if err != nil {
+			return err
+		}
+		if fetcher.NVDAPICache, err = fetcher.NewPageCache(cacheDir, ttl); err != nil {
+			return err
 		}
+	}
+	guard, err := newShrinkGuard(cmd)
+	if err != nil {
+		return err
+	}
+	policy, err := newRejectPolicy(cmd)
+	if err != nil {
 		return err
 	}
 
-	cpes, err := fetcher.FetchNVD()
+	log15.Info("Initialize Database")
+	driver, swap, err := newFetchDB(cmd)
 	if err != nil {
-		log15.Error("Failed to fetch.", "err", err)
 		return err
 	}
-	log15.Info("Fetched", "Number of CPEs", len(cpes))
+	defer func() {
+		err = swap(err)
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
+		return err
+	}
 
-	if !viper.GetBool("stdout") {
-		if err = driver.InsertCpes(cpes); err != nil {
-			log15.Error("Failed to insert.", "err", err)
-			return fmt.Errorf("Failed to insert cpes. err : %s", err)
+	startedAt := time.Now()
+	var (
+		header  seed.Header
+		cpes    []models.CategorizedCpe
+		stamp   fetcher.DictionaryStamp
+		failed  []fetcher.FailedFeed
+		rejects []models.RejectedCpe
+	)
+	if replay != "" {
+		if header, cpes, err = readReplay(replay, models.NVD); err != nil {
+			log15.Error("Failed to replay.", "err", err)
+			return err
 		}
+		stamp.Version, stamp.GeneratedAt = header.NVDDictVersion, header.NVDDictGeneratedAt
 	} else {
-		for _, cpe := range cpes {
-			fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%t\n",
-				cpe.CpeURI,
-				cpe.CpeFS,
-				cpe.Part,
-				cpe.Vendor,
-				cpe.Product,
-				cpe.Version,
-				cpe.Update,
-				cpe.Edition,
-				cpe.Language,
-				cpe.SoftwareEdition,
-				cpe.TargetSoftware,
-				cpe.TargetHardware,
-				cpe.Other,
-				cpe.Deprecated,
-			)
+		failedFeedsPath := viper.GetString("failed-feeds-path")
+		var prevFailed []fetcher.FailedFeed
+		if onError == fetcher.OnErrorRecord {
+			if prevFailed, err = fetcher.LoadFailedFeeds(failedFeedsPath); err != nil {
+				log15.Error("Failed to load failed feeds.", "err", err)
+				return err
+			}
+			for _, f := range prevFailed {
+				log15.Info("Fetching again the feed failed in the previous run", "URL", f.URL, "failedAt", f.FailedAt)
+			}
+		}
+
+		fetcher.NVDBaseURL = strings.TrimSuffix(viper.GetString("nvd-base-url"), "/")
+		finishRaw, err := setupRaw(cmd)
+		if err != nil {
+			log15.Error("Failed to set up the raw feeds.", "err", err)
+			return err
+		}
+		result, err := fetcher.FetchNVDResult(ctx, fetcher.NVDOption{
+			CountCveRefs: viper.GetBool("count-cve-refs"),
+			OnError:      onError,
+			Vendors:      vendors,
+			Query:        query,
+		})
+		finishRaw()
+		if err != nil {
+			log15.Error("Failed to fetch.", "err", err)
+			return err
+		}
+		cpes, stamp, failed = result.CPEs, result.Stamp, result.Failed
+		log15.Info("Fetched", "Number of CPEs", len(cpes))
+		defer summarizeFailedFeeds(prevFailed, failed)
+		if rejects, err = policy.take(models.NVD); err != nil {
+			return err
+		}
+
+		if onError == fetcher.OnErrorRecord {
+			if err := fetcher.SaveFailedFeeds(failedFeedsPath, failed); err != nil {
+				log15.Error("Failed to save failed feeds.", "err", err)
+				return err
+			}
+		}
+		header = seed.Header{Source: models.NVD, FetchedAt: time.Now(), NVDDictVersion: stamp.Version, NVDDictGeneratedAt: stamp.GeneratedAt}
+	}
+
+	if outOpt == nil {
+		if err := ctx.Err(); err != nil {
+			return xerrors.Errorf("Timed out before inserting. err: %w", err)
 		}
+		ahead := &aheadFile{}
+		if replay == "" {
+			ahead = writeAhead(cmd, header, cpes)
+		}
+		defer ahead.keep()
+		// a part of NVD, fetched from the API, of the filtered vendors or without the failed feeds, leaves the other CPEs as they are.
+		// A replay may be of such a part too.
+		replace := replay == "" && query.Empty() && vendors == nil && len(failed) == 0
+		if replace {
+			if err := guard.check(driver, models.NVD, cpes); err != nil {
+				return err
+			}
+		}
+		// the malformed CPEs aren't written ahead, so a replay leaves the quarantined ones as is
+		if replay == "" {
+			if err := policy.quarantine(driver, models.NVD, rejects); err != nil {
+				log15.Error("Failed to quarantine.", "err", err)
+				return err
+			}
+		}
+		hash, err := insertChangedCpes(driver, models.NVD, cpes, replace)
+		if err != nil {
+			log15.Error("Failed to insert.", "err", err)
+			return err
+		}
+
+		fetchMeta, err := driver.GetFetchMeta()
+		if err != nil {
+			log15.Error("Failed to get FetchMeta from DB.", "err", err)
+			return err
+		}
+		// a replay is as old as its fetch
+		fetchMeta.LastFetchedAt = header.FetchedAt
+		fetchMeta.Generation++
+		fetchMeta.SetSourceHash(models.NVD, hash)
+		if stamp.GeneratedAt != nil {
+			fetchMeta.NVDDictVersion = stamp.Version
+			fetchMeta.NVDDictGeneratedAt = stamp.GeneratedAt
+		}
+		if err := retryOnLocked("upsert FetchMeta", func() error { return driver.UpsertFetchMeta(fetchMeta) }); err != nil {
+			log15.Error("Failed to upsert FetchMeta to DB.", "err", err)
+			return err
+		}
+		ahead.commit()
+		recordFetch(driver, models.NVD, startedAt, len(cpes), stamp.Version)
+		loadDistroPackages(driver)
+		saveSearchIndex(driver)
+		webhookURL, err := cmd.Flags().GetString("webhook-url")
+		if err != nil {
+			return err
+		}
+		checkWatchlist(ctx, driver, webhookURL)
+	} else if err := dumpCpes(*outOpt, cpes); err != nil {
+		log15.Error("Failed to write CPEs.", "err", err)
+		return err
 	}
 
+	if 0 < len(failed) {
+		return xerrors.Errorf("Fetched partially. Number of failed feeds: %d, err: %w", len(failed), errPartialFetch)
+	}
 	return nil
 }
+
+func summarizeFailedFeeds(prevFailed, failed []fetcher.FailedFeed) {
+	stillFailed := map[string]bool{}
+	for _, f := range failed {
+		stillFailed[f.URL] = true
+	}
+	for _, f := range prevFailed {
+		if !stillFailed[f.URL] {
+			log15.Info("Recovered the feed failed in the previous run", "URL", f.URL)
+		}
+	}
+
+	if len(failed) == 0 {
+		return
+	}
+	log15.Warn("Fetched with gaps. CPEs in the following feeds are missing", "Number of failed feeds", len(failed))
+	for _, f := range failed {
+		log15.Warn("Failed feed", "URL", f.URL, "err", f.Err)
+	}
+}
@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/seed"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+var fetchWindowsCmd = &cobra.Command{
+	Use:   "fetchwindows",
+	Short: "Fetch CPE of the Windows products from MSRC",
+	Long:  "Fetch CPE of the Windows products from MSRC",
+	RunE:  fetchWindows,
+}
+
+func init() {
+	RootCmd.AddCommand(fetchWindowsCmd)
+
+	fetchWindowsCmd.PersistentFlags().Bool("stdout", false, "display all CPEs to stdout")
+	_ = viper.BindPFlag("stdout", fetchWindowsCmd.PersistentFlags().Lookup("stdout"))
+
+	addOutputFlags(fetchWindowsCmd)
+	addRawFlags(fetchWindowsCmd)
+	addWatchFlags(fetchWindowsCmd)
+	addShrinkFlags(fetchWindowsCmd)
+	addTimeoutFlags(fetchWindowsCmd, "bound the whole fetch, including the HTTP requests and the DB operations, e.g. 1h (default: no limit)")
+	addMemoryFlags(fetchWindowsCmd)
+	addSwapFlags(fetchWindowsCmd)
+	addRejectFlags(fetchWindowsCmd)
+	addReplayFlags(fetchWindowsCmd)
+	addProfileFlags(fetchWindowsCmd)
+
+	fetchWindowsCmd.PersistentFlags().String("base-url", fetcher.DefaultMSRCBaseURL, "base URL of the CVRF API of MSRC, e.g. a mirror")
+	_ = viper.BindPFlag("msrc-base-url", fetchWindowsCmd.PersistentFlags().Lookup("base-url"))
+}
+
+func fetchWindows(cmd *cobra.Command, args []string) (err error) {
+	ctx, cancel, err := timeoutContext(cmd)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	if err := applyMemoryLimit(cmd); err != nil {
+		return err
+	}
+	stopProfile, err := startProfile(cmd)
+	if err != nil {
+		return err
+	}
+	defer stopProfile()
+
+	outOpt, err := outputOption(cmd)
+	if err != nil {
+		return err
+	}
+	replay, err := replayPath(cmd)
+	if err != nil {
+		return err
+	}
+	guard, err := newShrinkGuard(cmd)
+	if err != nil {
+		return err
+	}
+	policy, err := newRejectPolicy(cmd)
+	if err != nil {
+		return err
+	}
+
+	log15.Info("Initialize Database")
+	driver, swap, err := newFetchDB(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = swap(err)
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
+		return err
+	}
+
+	startedAt := time.Now()
+	var (
+		header  seed.Header
+		cpes    []models.CategorizedCpe
+		rejects []models.RejectedCpe
+	)
+	if replay != "" {
+		if header, cpes, err = readReplay(replay, models.Windows); err != nil {
+			log15.Error("Failed to replay.", "err", err)
+			return err
+		}
+	} else {
+		fetcher.MSRCBaseURL = strings.TrimSuffix(viper.GetString("msrc-base-url"), "/")
+		finishRaw, err := setupRaw(cmd)
+		if err != nil {
+			log15.Error("Failed to set up the raw feeds.", "err", err)
+			return err
+		}
+		cpes, err = fetcher.FetchWindows(ctx)
+		finishRaw()
+		if err != nil {
+			log15.Error("Failed to fetch.", "err", err)
+			return err
+		}
+		log15.Info("Fetched", "Number of CPEs", len(cpes))
+		if rejects, err = policy.take(models.Windows); err != nil {
+			return err
+		}
+		header = seed.Header{Source: models.Windows, FetchedAt: time.Now()}
+	}
+
+	if outOpt == nil {
+		if err := ctx.Err(); err != nil {
+			return xerrors.Errorf("Timed out before inserting. err: %w", err)
+		}
+		ahead := &aheadFile{}
+		if replay == "" {
+			ahead = writeAhead(cmd, header, cpes)
+		}
+		defer ahead.keep()
+		if err := guard.check(driver, models.Windows, cpes); err != nil {
+			return err
+		}
+		// the malformed CPEs aren't written ahead, so a replay leaves the quarantined ones as is
+		if replay == "" {
+			if err := policy.quarantine(driver, models.Windows, rejects); err != nil {
+				log15.Error("Failed to quarantine.", "err", err)
+				return err
+			}
+		}
+		hash, err := insertChangedCpes(driver, models.Windows, cpes, true)
+		if err != nil {
+			log15.Error("Failed to insert.", "err", err)
+			return err
+		}
+
+		fetchMeta, err := driver.GetFetchMeta()
+		if err != nil {
+			log15.Error("Failed to get FetchMeta from DB.", "err", err)
+			return err
+		}
+		// a replay is as old as its fetch
+		fetchMeta.LastFetchedAt = header.FetchedAt
+		fetchMeta.Generation++
+		fetchMeta.SetSourceHash(models.Windows, hash)
+		if err := retryOnLocked("upsert FetchMeta", func() error { return driver.UpsertFetchMeta(fetchMeta) }); err != nil {
+			log15.Error("Failed to upsert FetchMeta to DB.", "err", err)
+			return err
+		}
+		ahead.commit()
+		recordFetch(driver, models.Windows, startedAt, len(cpes), "")
+		loadDistroPackages(driver)
+		saveSearchIndex(driver)
+		webhookURL, err := cmd.Flags().GetString("webhook-url")
+		if err != nil {
+			return err
+		}
+		checkWatchlist(ctx, driver, webhookURL)
+		log15.Info(fmt.Sprintf("Inserted %d CPEs", len(cpes)))
+	} else if err := dumpCpes(*outOpt, cpes); err != nil {
+		log15.Error("Failed to write CPEs.", "err", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/spf13/cobra"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove orphaned and superseded rows from the DB",
+	Long:  "Remove orphaned and superseded rows from the DB",
+	RunE:  executeGC,
+}
+
+func init() {
+	RootCmd.AddCommand(gcCmd)
+}
+
+func executeGC(cmd *cobra.Command, args []string) error {
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
+		return err
+	}
+
+	var stats []db.GCStat
+	if err := retryOnLocked("gc", func() (err error) {
+		stats, err = driver.GC()
+		return err
+	}); err != nil {
+		log15.Error("Failed to gc.", "err", err)
+		return err
+	}
+	var rows int64
+	tables := []string{}
+	for _, s := range stats {
+		rows += s.Rows
+		tables = append(tables, fmt.Sprintf("%s: %d", s.Table, s.Rows))
+	}
+	recordAudit(driver, models.AuditGC, "", rows, strings.Join(tables, ", "))
+
+	for _, s := range stats {
+		if s.Bytes != 0 {
+			fmt.Printf("%s: %d rows, %d bytes reclaimed\n", s.Table, s.Rows, s.Bytes)
+		} else {
+			fmt.Printf("%s: %d rows\n", s.Table, s.Rows)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "Check the DB is ready to serve, e.g. as HEALTHCHECK of a container",
+	Long:  "Check the DB opens, has the current schema version and was fetched within --max-age, exiting with 0 only then. Use it as HEALTHCHECK of a container without curl",
+	RunE:  executeHealthcheck,
+}
+
+func init() {
+	RootCmd.AddCommand(healthcheckCmd)
+
+	healthcheckCmd.Flags().Duration("max-age", 0, "fail when the DB was last fetched longer ago than this, e.g. 48h (default: no limit)")
+}
+
+func executeHealthcheck(cmd *cobra.Command, args []string) error {
+	maxAge, err := cmd.Flags().GetDuration("max-age")
+	if err != nil {
+		return err
+	}
+
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		return err
+	}
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	if fetchMeta.LastFetchedAt.IsZero() {
+		return xerrors.Errorf("The DB was never fetched. err: %w", errStale)
+	}
+	age := time.Since(fetchMeta.LastFetchedAt)
+	if 0 < maxAge && maxAge < age {
+		return xerrors.Errorf("The DB was last fetched %s ago, more than --max-age %s. lastFetchedAt: %s, err: %w", age.Round(time.Second), maxAge, fetchMeta.LastFetchedAt.Format(time.RFC3339), errStale)
+	}
+	fmt.Printf("healthy: last fetched at %s\n", fetchMeta.LastFetchedAt.Format(time.RFC3339))
+	return nil
+}
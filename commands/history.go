@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+// recordFetch records a fetch of source started at startedAt in the FetchHistory and the audit log.
+// A failure is only logged, since the CPEs are already stored.
+func recordFetch(driver db.DB, source models.FetchType, startedAt time.Time, cpes int, dataVersion string) {
+	history := models.FetchHistory{
+		FetchType:   source,
+		StartedAt:   startedAt,
+		FinishedAt:  time.Now(),
+		CPEs:        cpes,
+		DataVersion: dataVersion,
+	}
+	if err := retryOnLocked("insert FetchHistory", func() error { return driver.InsertFetchHistory(&history) }); err != nil {
+		log15.Warn("Failed to insert FetchHistory to DB.", "source", source, "err", err)
+	}
+	detail := ""
+	if dataVersion != "" {
+		detail = "data version " + dataVersion
+	}
+	recordAudit(driver, models.AuditFetch, string(source), int64(cpes), detail)
+}
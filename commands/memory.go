@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// lowMemoryBatchSize is the number of rows inserted by a statement under --max-memory-mb without --batch-size
+	lowMemoryBatchSize = 200
+	// lowMemoryGCPercent runs the GC when the heap grows by the percentage since the last GC, instead of 100
+	lowMemoryGCPercent = 25
+	// memoryCheckInterval is how often the heap is checked against --max-memory-mb
+	memoryCheckInterval = time.Second
+)
+
+// addMemoryFlags adds --max-memory-mb and --temp-dir to cmd
+func addMemoryFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Int("max-memory-mb", 0, "keep the fetch within about the memory, e.g. 512 on a VM of 1GB, by streaming the NVD feeds from temp files one by one, inserting in smaller batches and running the GC more often (default: no limit)")
+	cmd.PersistentFlags().String("temp-dir", "", "/path/to/dir of the temp files of the feeds under --max-memory-mb (default: the temp directory of the OS)")
+}
+
+// applyMemoryLimit tunes the fetches for --max-memory-mb of cmd, before the DB is opened.
+// The heap is freed back to the OS whenever it grows beyond 80% of the limit, which bounds the process rather than the heap only.
+func applyMemoryLimit(cmd *cobra.Command) error {
+	limit, err := cmd.Flags().GetInt("max-memory-mb")
+	if err != nil {
+		return err
+	}
+	if limit < 0 {
+		return xerrors.Errorf("--max-memory-mb must be 0 or more, got %d: %w", limit, errConfig)
+	}
+	if limit == 0 {
+		return nil
+	}
+	if fetcher.TempDir, err = cmd.Flags().GetString("temp-dir"); err != nil {
+		return err
+	}
+	fetcher.LowMemory = true
+	if viper.GetInt("batch-size") == 0 {
+		viper.Set("batch-size", lowMemoryBatchSize)
+	}
+	debug.SetGCPercent(lowMemoryGCPercent)
+	log15.Info("Fetching within the memory limit", "max-memory-mb", limit, "batch-size", viper.GetInt("batch-size"))
+
+	threshold := uint64(limit) * 1024 * 1024 * 8 / 10
+	go func() {
+		var stats runtime.MemStats
+		for range time.Tick(memoryCheckInterval) {
+			runtime.ReadMemStats(&stats)
+			if threshold < stats.HeapAlloc {
+				log15.Debug("Freeing the memory", "heapAlloc", stats.HeapAlloc, "max-memory-mb", limit)
+				debug.FreeOSMemory()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/output"
+	"github.com/spf13/cobra"
+)
+
+// addOutputFlags adds the flags to dump the fetched CPEs instead of inserting them into the DB
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("out", "", "/path/to/file to write all CPEs to instead of the DB")
+	cmd.PersistentFlags().Bool("gzip", false, "gzip the CPEs written by --stdout or --out")
+	cmd.PersistentFlags().Int64("rotate-size", 0, "start a new file when --out exceeds this size in MB before compression (default: no rotation)")
+}
+
+// outputOption returns the output option of cmd, or nil when the CPEs go to the DB.
+// The flags are read from cmd, since fetch commands share their names.
+func outputOption(cmd *cobra.Command) (*output.Option, error) {
+	stdout, err := cmd.Flags().GetBool("stdout")
+	if err != nil {
+		return nil, err
+	}
+	path, err := cmd.Flags().GetString("out")
+	if err != nil {
+		return nil, err
+	}
+	if !stdout && path == "" {
+		return nil, nil
+	}
+	gzip, err := cmd.Flags().GetBool("gzip")
+	if err != nil {
+		return nil, err
+	}
+	rotateSize, err := cmd.Flags().GetInt64("rotate-size")
+	if err != nil {
+		return nil, err
+	}
+	if 0 < rotateSize && path == "" {
+		return nil, fmt.Errorf("--rotate-size needs --out")
+	}
+	return &output.Option{Path: path, Gzip: gzip, RotateSize: rotateSize * 1024 * 1024}, nil
+}
+
+// dumpCpes writes the CPEs as TSV
+func dumpCpes(option output.Option, cpes []models.CategorizedCpe) (err error) {
+	w, err := output.New(option)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for _, cpe := range cpes {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%t\n",
+			cpe.CpeURI,
+			cpe.CpeFS,
+			cpe.Part,
+			cpe.Vendor,
+			cpe.Product,
+			cpe.Version,
+			cpe.Update,
+			cpe.Edition,
+			cpe.Language,
+			cpe.SoftwareEdition,
+			cpe.TargetSoftware,
+			cpe.TargetHardware,
+			cpe.Other,
+			cpe.Deprecated,
+		); err != nil {
+			return fmt.Errorf("Failed to write CPEs. err: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+// addPipelineFlags adds the workers of the stages of the fetch of the feeds to cmd
+func addPipelineFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Int("download-workers", 0, "number of the feeds downloaded concurrently (default: 2)")
+	cmd.PersistentFlags().Int("parse-workers", 0, "number of the feeds decoded concurrently (default: --threads)")
+	cmd.PersistentFlags().Int("transform-workers", 0, "number of the feeds converted into the CPEs concurrently (default: --threads)")
+	cmd.PersistentFlags().Int("stage-buffer", 0, "number of the feeds waiting between two stages of the fetch (default: 1)")
+}
+
+// applyPipeline sets the workers of the stages of the fetch by the flags of cmd, the parse and the transform by --threads without them
+func applyPipeline(cmd *cobra.Command) error {
+	var stages fetcher.Stages
+	for _, f := range []struct {
+		name    string
+		workers *int
+	}{
+		{name: "download-workers", workers: &stages.Download},
+		{name: "parse-workers", workers: &stages.Parse},
+		{name: "transform-workers", workers: &stages.Transform},
+		{name: "stage-buffer", workers: &stages.Buffer},
+	} {
+		n, err := cmd.Flags().GetInt(f.name)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return xerrors.Errorf("--%s must be 0 or more, got %d: %w", f.name, n, errConfig)
+		}
+		*f.workers = n
+	}
+	if threads := viper.GetInt("threads"); 0 < threads {
+		if stages.Parse == 0 {
+			stages.Parse = threads
+		}
+		if stages.Transform == 0 {
+			stages.Transform = threads
+		}
+	}
+	fetcher.Pipeline = stages
+	return nil
+}
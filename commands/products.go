@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+)
+
+var productsCmd = &cobra.Command{
+	Use:   "products",
+	Short: "List vendor/products with the number of versions and deprecated CPEs",
+	Long:  "List vendor/products with the number of versions and deprecated CPEs",
+	RunE:  executeProducts,
+}
+
+func init() {
+	RootCmd.AddCommand(productsCmd)
+}
+
+func executeProducts(cmd *cobra.Command, args []string) (err error) {
+	collator, err := newCollator()
+	if err != nil {
+		return err
+	}
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	if err := checkSchemaVersion(driver); err != nil {
+		return err
+	}
+
+	summaries, err := driver.GetProductSummaries()
+	if err != nil {
+		log15.Error("Failed to get product summaries.", "err", err)
+		return err
+	}
+	collator.SortSummaries(summaries)
+	fmt.Println("vendor\tproduct\tversions\tdeprecated\tparts")
+	for _, s := range summaries {
+		fmt.Printf("%s\t%s\t%d\t%d\t%s\n", s.Vendor, s.Product, s.Versions, s.Deprecated, strings.Join(s.Parts, ","))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+// addProfileFlags adds --perf-profile to cmd
+func addProfileFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("perf-profile", "", "/path/to/dir to write the pprof profiles of the fetch to: cpu.pprof, heap.pprof and allocs.pprof (default: disabled)")
+}
+
+// startProfile starts the CPU profile of --perf-profile of cmd.
+// The returned stop writes the other profiles at the end of the command; it's a no-op without --perf-profile.
+func startProfile(cmd *cobra.Command) (stop func(), err error) {
+	dir, err := cmd.Flags().GetString("perf-profile")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return func() {}, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, xerrors.Errorf("Failed to create the dir of --perf-profile. dir: %s, err: %w", dir, err)
+	}
+
+	cpu, err := os.Create(filepath.Join(dir, "cpu.pprof"))
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to create the CPU profile. err: %w", err)
+	}
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		_ = cpu.Close()
+		return nil, xerrors.Errorf("Failed to start the CPU profile. err: %w", err)
+	}
+	log15.Info("Profiling", "dir", dir)
+
+	return func() {
+		pprof.StopCPUProfile()
+		if err := cpu.Close(); err != nil {
+			log15.Warn("Failed to close the CPU profile.", "err", err)
+		}
+		// the heap is of the live objects as of the last GC, so it's run to include the end of the fetch
+		runtime.GC()
+		for _, name := range []string{"heap", "allocs"} {
+			if err := writeProfile(filepath.Join(dir, name+".pprof"), name); err != nil {
+				log15.Warn("Failed to write the profile.", "profile", name, "err", err)
+			}
+		}
+		log15.Info("Wrote the profiles", "dir", dir)
+	}, nil
+}
+
+// writeProfile writes the pprof profile of name to path
+func writeProfile(path, name string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,308 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Read the vendors, the products and the CPEs of the DB",
+	Long:  "Read the vendors, the products and the CPEs of the DB without sqlite3 or the server",
+}
+
+var queryVendorsCmd = &cobra.Command{
+	Use:   "vendors",
+	Short: "List the vendors with the number of their products",
+	Long:  "List the vendors with the number of their products",
+	Args:  cobra.NoArgs,
+	RunE:  executeQueryVendors,
+}
+
+var queryProductsCmd = &cobra.Command{
+	Use:   "products vendor",
+	Short: "List the products of the vendor",
+	Long:  "List the products of the vendor, and whether they're in the CISA Known Exploited Vulnerabilities catalog",
+	Args:  cobra.ExactArgs(1),
+	RunE:  executeQueryProducts,
+}
+
+var queryCpesCmd = &cobra.Command{
+	Use:   "cpes vendor product",
+	Short: "List the CPEs of the vendor/product",
+	Long:  "List the CPEs of the vendor/product, the deprecated ones with the CPEs replacing them. Both match as they are, or with --glob * and ? match any string and any character as in GET /cpes/:vendor/:product, e.g. microsoft 'windows_*'",
+	Args:  cobra.ExactArgs(2),
+	RunE:  executeQueryCpes,
+}
+
+func init() {
+	RootCmd.AddCommand(queryCmd)
+	queryCmd.AddCommand(queryVendorsCmd, queryProductsCmd, queryCpesCmd)
+
+	queryCmd.PersistentFlags().String("output", "table", "output format (table or json)")
+	queryCmd.PersistentFlags().String("as-of", "", "list the vendors, the products and the CPEs as they were at a date or an RFC 3339 time, e.g. 2023-06-01 (RDB only)")
+}
+
+// queryOutput returns --output of cmd
+func queryOutput(cmd *cobra.Command) (string, error) {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return "", err
+	}
+	switch output {
+	case "table", "json":
+		return output, nil
+	default:
+		return "", xerrors.Errorf("Invalid --output: %s, expected table or json: %w", output, errConfig)
+	}
+}
+
+// queryAsOf returns --as-of of cmd, a date (its start in UTC) or an RFC 3339 time, zero when it's empty
+func queryAsOf(cmd *cobra.Command) (time.Time, error) {
+	param, err := cmd.Flags().GetString("as-of")
+	if err != nil || param == "" {
+		return time.Time{}, err
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, param); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, xerrors.Errorf("Invalid --as-of: %s, expected a date or an RFC 3339 time, e.g. 2023-06-01: %w", param, errConfig)
+}
+
+// queryVendorProducts returns the vendor/products of the DB, as they were at asOf unless it's zero
+func queryVendorProducts(driver db.DB, asOf time.Time) ([]string, error) {
+	if asOf.IsZero() {
+		return driver.GetVendorProducts()
+	}
+	return driver.GetVendorProductsAsOf(asOf)
+}
+
+// openQueryDB opens the DB for a query
+func openQueryDB() (db.DB, error) {
+	driver, err := newDB()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchemaVersion(driver); err != nil {
+		_ = driver.CloseDB()
+		return nil, err
+	}
+	return driver, nil
+}
+
+// writeQuery writes the rows as a table aligned by tabs with the header, or v as JSON
+func writeQuery(w io.Writer, output string, v interface{}, header []string, rows [][]string) error {
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			return xerrors.Errorf("Failed to write JSON. err: %w", err)
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return xerrors.Errorf("Failed to write the table. err: %w", err)
+	}
+	return nil
+}
+
+// queriedVendor is a vendor listed by query vendors
+type queriedVendor struct {
+	Vendor   string `json:"vendor"`
+	Products int    `json:"products"`
+}
+
+// queriedProduct is a product listed by query products
+type queriedProduct struct {
+	Vendor         string `json:"vendor"`
+	Product        string `json:"product"`
+	Title          string `json:"title,omitempty"`
+	KnownExploited bool   `json:"knownExploited"`
+}
+
+// queriedCpe is a CPE listed by query cpes
+type queriedCpe struct {
+	CpeURI       string   `json:"cpeURI"`
+	Deprecated   bool     `json:"deprecated"`
+	DeprecatedBy []string `json:"deprecatedBy,omitempty"`
+	Quality      int      `json:"quality"`
+}
+
+func executeQueryVendors(cmd *cobra.Command, args []string) error {
+	output, err := queryOutput(cmd)
+	if err != nil {
+		return err
+	}
+	asOf, err := queryAsOf(cmd)
+	if err != nil {
+		return err
+	}
+	collator, err := newCollator()
+	if err != nil {
+		return err
+	}
+	driver, err := openQueryDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	vendorProducts, err := queryVendorProducts(driver, asOf)
+	if err != nil {
+		log15.Error("Failed to get the vendor/products.", "err", err)
+		return err
+	}
+	counts := map[string]int{}
+	for _, vp := range vendorProducts {
+		counts[strings.SplitN(vp, "::", 2)[0]]++
+	}
+	vendors := make([]queriedVendor, 0, len(counts))
+	for vendor, n := range counts {
+		vendors = append(vendors, queriedVendor{Vendor: vendor, Products: n})
+	}
+	if collator != nil {
+		collator.Sort(len(vendors), func(i int) []string { return []string{vendors[i].Vendor} }, func(i, j int) { vendors[i], vendors[j] = vendors[j], vendors[i] })
+	} else {
+		sort.Slice(vendors, func(i, j int) bool { return vendors[i].Vendor < vendors[j].Vendor })
+	}
+
+	rows := make([][]string, 0, len(vendors))
+	for _, v := range vendors {
+		rows = append(rows, []string{v.Vendor, fmt.Sprint(v.Products)})
+	}
+	return writeQuery(os.Stdout, output, vendors, []string{"VENDOR", "PRODUCTS"}, rows)
+}
+
+func executeQueryProducts(cmd *cobra.Command, args []string) error {
+	output, err := queryOutput(cmd)
+	if err != nil {
+		return err
+	}
+	asOf, err := queryAsOf(cmd)
+	if err != nil {
+		return err
+	}
+	collator, err := newCollator()
+	if err != nil {
+		return err
+	}
+	driver, err := openQueryDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	vendorProducts, err := queryVendorProducts(driver, asOf)
+	if err != nil {
+		log15.Error("Failed to get the vendor/products.", "err", err)
+		return err
+	}
+	titles, err := driver.GetVendorProductTitles()
+	if err != nil {
+		log15.Error("Failed to get the titles of the vendor/products.", "err", err)
+		return err
+	}
+	known, err := driver.GetKnownExploited()
+	if err != nil {
+		log15.Error("Failed to get the known exploited products.", "err", err)
+		return err
+	}
+	exploited := map[string]bool{}
+	for _, k := range known {
+		exploited[k.Vendor+"::"+k.Product] = true
+	}
+
+	products := []queriedProduct{}
+	for _, vp := range vendorProducts {
+		ss := strings.SplitN(vp, "::", 2)
+		if len(ss) != 2 || ss[0] != args[0] {
+			continue
+		}
+		products = append(products, queriedProduct{Vendor: ss[0], Product: ss[1], Title: titles[vp], KnownExploited: exploited[vp]})
+	}
+	if len(products) == 0 {
+		return xerrors.Errorf("No products of the vendor: %s", args[0])
+	}
+	if collator != nil {
+		collator.Sort(len(products), func(i int) []string { return []string{products[i].Product} }, func(i, j int) { products[i], products[j] = products[j], products[i] })
+	} else {
+		sort.Slice(products, func(i, j int) bool { return products[i].Product < products[j].Product })
+	}
+
+	rows := make([][]string, 0, len(products))
+	for _, p := range products {
+		rows = append(rows, []string{p.Product, fmt.Sprint(p.KnownExploited), p.Title})
+	}
+	return writeQuery(os.Stdout, output, products, []string{"PRODUCT", "KNOWN EXPLOITED", "TITLE"}, rows)
+}
+
+func executeQueryCpes(cmd *cobra.Command, args []string) error {
+	output, err := queryOutput(cmd)
+	if err != nil {
+		return err
+	}
+	asOf, err := queryAsOf(cmd)
+	if err != nil {
+		return err
+	}
+	driver, err := openQueryDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	glob := viper.GetBool("glob")
+	vendor, product := db.LikePattern(args[0], glob), db.LikePattern(args[1], glob)
+	var details *models.CpeDetails
+	if asOf.IsZero() {
+		details, err = driver.GetCpeDetailsByVendorProduct(vendor, product)
+	} else {
+		details, err = driver.GetCpeDetailsAsOf(vendor, product, asOf)
+	}
+	if err != nil {
+		log15.Error("Failed to get the CPEs.", "vendor", args[0], "product", args[1], "err", err)
+		return err
+	}
+	if len(details.Active)+len(details.Deprecated) == 0 {
+		return xerrors.Errorf("No CPEs of the vendor/product: %s::%s", args[0], args[1])
+	}
+	cpes := make([]queriedCpe, 0, len(details.Active)+len(details.Deprecated))
+	for _, c := range details.Active {
+		cpes = append(cpes, queriedCpe{CpeURI: c.CpeURI, Quality: c.Quality})
+	}
+	for _, c := range details.Deprecated {
+		cpes = append(cpes, queriedCpe{CpeURI: c.CpeURI, Deprecated: true, DeprecatedBy: c.DeprecatedBy, Quality: c.Quality})
+	}
+
+	rows := make([][]string, 0, len(cpes))
+	for _, c := range cpes {
+		rows = append(rows, []string{c.CpeURI, fmt.Sprint(c.Deprecated), strings.Join(c.DeprecatedBy, ","), fmt.Sprint(c.Quality)})
+	}
+	return writeQuery(os.Stdout, output, cpes, []string{"CPE", "DEPRECATED", "DEPRECATED BY", "QUALITY"}, rows)
+}
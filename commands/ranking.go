@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"plugin"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+// addRankingFlags adds the flags tuning the relevance score of the ranked vendor/products
+func addRankingFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("ranking-config", "", "/path/to/file (yaml, json or toml) of the weights of the relevance score of /products/rank, e.g. exact_vendor: 40 (default: the built-in weights)")
+	_ = viper.BindPFlag("ranking-config", cmd.PersistentFlags().Lookup("ranking-config"))
+
+	cmd.PersistentFlags().String("ranking-plugin", "", "/path/to/Go plugin (.so) exporting Score, rescoring each candidate of /products/rank after the weights (default: disabled)")
+	_ = viper.BindPFlag("ranking-plugin", cmd.PersistentFlags().Lookup("ranking-plugin"))
+}
+
+// loadRanking sets the ranking of search.Rank by --ranking-config and --ranking-plugin
+func loadRanking() error {
+	ranking := search.Ranking{Weights: search.DefaultWeights()}
+	if path := viper.GetString("ranking-config"); path != "" {
+		v := viper.New()
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return xerrors.Errorf("Failed to read the ranking config. path: %s, err: %w", path, err)
+		}
+		// the weights not in the file keep the defaults, and a misspelled one is an error rather than ignored
+		if err := v.UnmarshalExact(&ranking.Weights); err != nil {
+			return xerrors.Errorf("Failed to parse the ranking config. path: %s, err: %s: %w", path, err, errConfig)
+		}
+		log15.Info("Ranking by the weights of the config", "path", path, "weights", ranking.Weights)
+	}
+	if path := viper.GetString("ranking-plugin"); path != "" {
+		scorer, err := loadScorer(path)
+		if err != nil {
+			return err
+		}
+		ranking.Scorer = scorer
+		log15.Info("Ranking by the plugin", "path", path)
+	}
+	search.SetRanking(ranking)
+	return nil
+}
+
+// loadScorer returns the Score of the Go plugin at path, either a func or a search.Scorer variable.
+// The plugin is built by the Go toolchain and against the version of go-cpe-dictionary of the binary loading it.
+func loadScorer(path string) (search.Scorer, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to open the ranking plugin. path: %s, err: %w", path, err)
+	}
+	sym, err := p.Lookup("Score")
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to look up Score of the ranking plugin. path: %s, err: %s: %w", path, err, errConfig)
+	}
+	switch score := sym.(type) {
+	case func(search.Candidate, models.ProductSummary) float64:
+		return score, nil
+	case *search.Scorer:
+		return *score, nil
+	case *func(search.Candidate, models.ProductSummary) float64:
+		return *score, nil
+	default:
+		return nil, xerrors.Errorf("Score of the ranking plugin is %T, not func(search.Candidate, models.ProductSummary) float64. path: %s: %w", sym, path, errConfig)
+	}
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/kotakanbe/go-cpe-dictionary/sign"
+	"github.com/spf13/cobra"
+)
+
+// addRawFlags adds the flags to archive the raw payloads and to replay them
+func addRawFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("keep-raw", "", "/path/to/dir to archive the raw feeds fetched, for audits and reproducible DB builds")
+	cmd.PersistentFlags().String("from-file", "", "/path/to/manifest-*.json written by --keep-raw to replay instead of fetching")
+	cmd.PersistentFlags().String("sign-key", "", "/path/to/private key generated by keygen to sign the manifest written by --keep-raw")
+}
+
+// setupRaw archives or replays the raw payloads as requested by the flags of cmd.
+// The returned func writes the manifest once the fetch is done.
+func setupRaw(cmd *cobra.Command) (func(), error) {
+	dir, err := cmd.Flags().GetString("keep-raw")
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := cmd.Flags().GetString("from-file")
+	if err != nil {
+		return nil, err
+	}
+	keyPath, err := cmd.Flags().GetString("sign-key")
+	if err != nil {
+		return nil, err
+	}
+	if keyPath != "" && dir == "" {
+		return nil, fmt.Errorf("--sign-key requires --keep-raw")
+	}
+
+	switch {
+	case dir != "" && manifest != "":
+		return nil, fmt.Errorf("--keep-raw and --from-file can't be used together")
+	case manifest != "":
+		log15.Info("Replaying the archived feeds", "manifest", manifest)
+		return func() {}, fetcher.ReplayRaw(manifest)
+	case dir != "":
+		var key ed25519.PrivateKey
+		if keyPath != "" {
+			if key, err = sign.LoadPrivateKey(keyPath); err != nil {
+				return nil, err
+			}
+		}
+		writeManifest, err := fetcher.KeepRaw(dir)
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			path, err := writeManifest()
+			if err != nil {
+				log15.Error("Failed to write the manifest of the raw feeds.", "err", err)
+				return
+			}
+			log15.Info("Archived the raw feeds", "manifest", path)
+			if key == nil {
+				return
+			}
+			sigPath, err := sign.SignFile(path, key)
+			if err != nil {
+				log15.Error("Failed to sign the manifest of the raw feeds.", "err", err)
+				return
+			}
+			log15.Info("Signed the manifest", "signature", sigPath)
+		}, nil
+	}
+	return func() {}, nil
+}
@@ -0,0 +1,292 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+var rejectsCmd = &cobra.Command{
+	Use:   "rejects",
+	Short: "Review the malformed CPEs quarantined by the fetches with --lenient",
+	Long:  "Review the malformed CPEs quarantined by the fetches with --lenient",
+}
+
+var rejectsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the quarantined CPEs with the reasons",
+	Long:  "List the quarantined CPEs with the reasons",
+	RunE:  executeRejectsList,
+}
+
+var rejectsExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the quarantined CPEs as JSON Lines",
+	Long:  "Export the quarantined CPEs as JSON Lines",
+	RunE:  executeRejectsExport,
+}
+
+var rejectsRetryCmd = &cobra.Command{
+	Use:   "retry",
+	Short: "Parse the quarantined CPEs again and store the ones parsed",
+	Long:  "Parse the quarantined CPEs again, e.g. after an upgrade fixing the parser, store the ones parsed and keep the others quarantined",
+	RunE:  executeRejectsRetry,
+}
+
+var rejectsPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete the quarantined CPEs",
+	Long:  "Delete the quarantined CPEs",
+	RunE:  executeRejectsPurge,
+}
+
+func init() {
+	RootCmd.AddCommand(rejectsCmd)
+	rejectsCmd.AddCommand(rejectsListCmd, rejectsExportCmd, rejectsRetryCmd, rejectsPurgeCmd)
+
+	rejectsCmd.PersistentFlags().String("sources", "", "comma separated sources of the quarantined CPEs, e.g. nvd,jvn (default: all sources)")
+	rejectsExportCmd.Flags().String("out", "", "/path/to/file to write the quarantined CPEs to (default: stdout)")
+}
+
+// rejectsSources returns the sources by --sources of cmd
+func rejectsSources(cmd *cobra.Command) ([]models.FetchType, error) {
+	param, err := cmd.Flags().GetString("sources")
+	if err != nil {
+		return nil, err
+	}
+	if param == "" {
+		return []models.FetchType{models.NVD, models.JVN, models.Windows}, nil
+	}
+	sources, err := models.ParseFetchTypes(param)
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid --sources. err: %s: %w", err, errConfig)
+	}
+	return sources, nil
+}
+
+// getRejects returns the quarantined CPEs of the sources
+func getRejects(driver db.DB, sources []models.FetchType) ([]models.RejectedCpe, error) {
+	rejects := []models.RejectedCpe{}
+	for _, source := range sources {
+		rs, err := driver.GetRejectedCpes(source)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to get the rejected CPEs. source: %s, err: %w", source, err)
+		}
+		rejects = append(rejects, rs...)
+	}
+	return rejects, nil
+}
+
+func executeRejectsList(cmd *cobra.Command, args []string) error {
+	sources, err := rejectsSources(cmd)
+	if err != nil {
+		return err
+	}
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	rejects, err := getRejects(driver, sources)
+	if err != nil {
+		log15.Error("Failed to list the rejected CPEs.", "err", err)
+		return err
+	}
+	fmt.Println("rejected at\tsource\tcpe\treason")
+	for _, r := range rejects {
+		fmt.Printf("%s\t%s\t%s\t%s\n", r.RejectedAt.Format(time.RFC3339), r.FetchType, r.Cpe, r.Reason)
+	}
+	return nil
+}
+
+func executeRejectsExport(cmd *cobra.Command, args []string) (err error) {
+	sources, err := rejectsSources(cmd)
+	if err != nil {
+		return err
+	}
+	path, err := cmd.Flags().GetString("out")
+	if err != nil {
+		return err
+	}
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	rejects, err := getRejects(driver, sources)
+	if err != nil {
+		log15.Error("Failed to export the rejected CPEs.", "err", err)
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return xerrors.Errorf("Failed to create the file. path: %s, err: %w", path, err)
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil && cerr != nil {
+				err = xerrors.Errorf("Failed to close the file. path: %s, err: %w", path, cerr)
+			}
+		}()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	for _, r := range rejects {
+		if err := enc.Encode(r); err != nil {
+			return xerrors.Errorf("Failed to write the rejected CPE. err: %w", err)
+		}
+	}
+	if path != "" {
+		log15.Info("Exported the rejected CPEs", "path", path, "Number of CPEs", len(rejects))
+	}
+	return nil
+}
+
+func executeRejectsRetry(cmd *cobra.Command, args []string) error {
+	sources, err := rejectsSources(cmd)
+	if err != nil {
+		return err
+	}
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	for _, source := range sources {
+		rejects, err := driver.GetRejectedCpes(source)
+		if err != nil {
+			log15.Error("Failed to get the rejected CPEs.", "source", source, "err", err)
+			return err
+		}
+		if len(rejects) == 0 {
+			continue
+		}
+		cpes, remaining := []models.CategorizedCpe{}, []models.RejectedCpe{}
+		for _, r := range rejects {
+			c, err := fetcher.Reparse(r)
+			if err != nil {
+				r.Reason = err.Error()
+				remaining = append(remaining, r)
+				continue
+			}
+			cpes = append(cpes, c)
+		}
+		if 0 < len(cpes) {
+			if err := retryOnLocked("insert CPEs", func() error { return driver.InsertCpes(cpes) }); err != nil {
+				log15.Error("Failed to insert.", "source", source, "err", err)
+				return err
+			}
+		}
+		if err := retryOnLocked("replace rejected CPEs", func() error { return driver.ReplaceRejectedCpes(source, remaining) }); err != nil {
+			log15.Error("Failed to update the rejected CPEs.", "source", source, "err", err)
+			return err
+		}
+		log15.Info("Retried the rejected CPEs", "source", source, "stored", len(cpes), "rejected", len(remaining))
+	}
+	return nil
+}
+
+func executeRejectsPurge(cmd *cobra.Command, args []string) error {
+	sources, err := rejectsSources(cmd)
+	if err != nil {
+		return err
+	}
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	for _, source := range sources {
+		if err := retryOnLocked("purge rejected CPEs", func() error { return driver.ReplaceRejectedCpes(source, nil) }); err != nil {
+			log15.Error("Failed to purge the rejected CPEs.", "source", source, "err", err)
+			return err
+		}
+	}
+	log15.Info("Purged the rejected CPEs", "sources", sources)
+	return nil
+}
+
+// rejectPolicy decides what a fetch does with the CPEs the fetcher rejected, e.g. of invalid escaping or without the vendor.
+// By default they're skipped with warnings.
+type rejectPolicy struct {
+	// strict fails the fetch on any of them
+	strict bool
+	// lenient quarantines them in the DB with the reasons
+	lenient bool
+}
+
+// addRejectFlags adds --strict and --lenient to cmd
+func addRejectFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool("strict", false, "fail without storing anything when the feeds have malformed CPEs, e.g. of invalid escaping or without the vendor or the product")
+	cmd.PersistentFlags().Bool("lenient", false, "skip the malformed CPEs of the feeds and store them with the reasons in the rejects table")
+}
+
+// newRejectPolicy returns the policy by the flags of cmd
+func newRejectPolicy(cmd *cobra.Command) (rejectPolicy, error) {
+	strict, err := cmd.Flags().GetBool("strict")
+	if err != nil {
+		return rejectPolicy{}, err
+	}
+	lenient, err := cmd.Flags().GetBool("lenient")
+	if err != nil {
+		return rejectPolicy{}, err
+	}
+	if strict && lenient {
+		return rejectPolicy{}, xerrors.Errorf("Specify either --strict or --lenient: %w", errConfig)
+	}
+	return rejectPolicy{strict: strict, lenient: lenient}, nil
+}
+
+// take returns the CPEs of source rejected by the fetch, failing with errRejected on any of them by --strict
+func (p rejectPolicy) take(source models.FetchType) ([]models.RejectedCpe, error) {
+	rejects, dropped := fetcher.TakeRejects()
+	if len(rejects) == 0 {
+		return nil, nil
+	}
+	if p.strict {
+		log15.Error("The feeds have malformed CPEs. Pass --lenient to quarantine them, or omit --strict to skip them",
+			"source", source, "rejected", len(rejects)+dropped, "first", rejects[0].Cpe, "reason", rejects[0].Reason)
+		return nil, xerrors.Errorf("Rejected %d malformed CPEs of %s: %w", len(rejects)+dropped, source, errRejected)
+	}
+	if 0 < dropped {
+		log15.Warn("Too many malformed CPEs. The rest are not kept", "source", source, "kept", len(rejects), "dropped", dropped)
+	}
+	log15.Warn("Skipped the malformed CPEs", "source", source, "rejected", len(rejects)+dropped)
+	return rejects, nil
+}
+
+// quarantine replaces the rejected CPEs of source in the DB by --lenient
+func (p rejectPolicy) quarantine(driver db.DB, source models.FetchType, rejects []models.RejectedCpe) error {
+	if !p.lenient {
+		return nil
+	}
+	if err := retryOnLocked("replace rejected CPEs", func() error { return driver.ReplaceRejectedCpes(source, rejects) }); err != nil {
+		return xerrors.Errorf("Failed to quarantine the rejected CPEs. source: %s, err: %w", source, err)
+	}
+	if 0 < len(rejects) {
+		log15.Info("Quarantined the malformed CPEs", "source", source, "rejected", len(rejects))
+	}
+	return nil
+}
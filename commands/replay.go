@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/seed"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+// addReplayFlags adds the flags writing the fetched CPEs ahead of the insert, and inserting them again by --replay
+func addReplayFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("replay", "", "/path/to/file written ahead by a fetch whose insert failed, to insert instead of fetching again")
+	cmd.PersistentFlags().String("write-ahead-dir", "", "/path/to/dir to write the fetched CPEs to before inserting them, kept for --replay when the insert fails (default: the temp dir)")
+}
+
+// replayPath returns --replay of cmd, empty when the CPEs are fetched
+func replayPath(cmd *cobra.Command) (string, error) {
+	return cmd.Flags().GetString("replay")
+}
+
+// readReplay reads the CPEs of source written ahead to path
+func readReplay(path string, source models.FetchType) (seed.Header, []models.CategorizedCpe, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return seed.Header{}, nil, xerrors.Errorf("Failed to open the file to replay. path: %s, err: %w", path, err)
+	}
+	defer f.Close()
+
+	header, cpes, err := seed.Read(f)
+	if err != nil {
+		return seed.Header{}, nil, xerrors.Errorf("Failed to read the file to replay. path: %s, err: %w", path, err)
+	}
+	if header.SchemaVersion != models.LatestSchemaVersion {
+		return seed.Header{}, nil, xerrors.Errorf("The file to replay is of another schema version. SchemaVersion: %d, expected: %d, err: %w", header.SchemaVersion, models.LatestSchemaVersion, errSchemaMismatch)
+	}
+	if header.Source != source {
+		return seed.Header{}, nil, xerrors.Errorf("The file to replay has the CPEs of %q, not of %s: %w", header.Source, source, errConfig)
+	}
+	log15.Info("Replaying the CPEs written ahead", "path", path, "fetchedAt", header.FetchedAt, "Number of CPEs", len(cpes))
+	return header, cpes, nil
+}
+
+// aheadFile is the file the fetched CPEs are written to before the insert
+type aheadFile struct {
+	path string
+}
+
+// writeAhead writes the fetched CPEs to a gzipped file before they're inserted, so that a failed insert
+// at the end of a long fetch is retried by --replay without fetching again.
+// A failure to write is only logged, since the insert may still succeed.
+func writeAhead(cmd *cobra.Command, header seed.Header, cpes []models.CategorizedCpe) *aheadFile {
+	dir, err := cmd.Flags().GetString("write-ahead-dir")
+	if err != nil {
+		log15.Warn("Failed to get --write-ahead-dir.", "err", err)
+		return &aheadFile{}
+	}
+	f, err := ioutil.TempFile(dir, "go-cpe-dictionary-"+string(header.Source)+"-*.jsonl.gz")
+	if err != nil {
+		log15.Warn("Failed to create the file to write the CPEs ahead.", "err", err)
+		return &aheadFile{}
+	}
+	header.SchemaVersion = models.LatestSchemaVersion
+	err = seed.Write(f, header, cpes)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log15.Warn("Failed to write the CPEs ahead.", "path", f.Name(), "err", err)
+		_ = os.Remove(f.Name())
+		return &aheadFile{}
+	}
+	log15.Debug("Wrote the CPEs ahead", "path", f.Name())
+	return &aheadFile{path: f.Name()}
+}
+
+// commit removes the file, as the CPEs are stored
+func (a *aheadFile) commit() {
+	if a.path == "" {
+		return
+	}
+	if err := os.Remove(a.path); err != nil {
+		log15.Warn("Failed to remove the CPEs written ahead.", "path", a.path, "err", err)
+	}
+	a.path = ""
+}
+
+// keep tells how to replay the file not committed
+func (a *aheadFile) keep() {
+	if a.path == "" {
+		return
+	}
+	log15.Error("Failed to store the fetched CPEs. Insert them again without fetching by --replay", "replay", a.path)
+}
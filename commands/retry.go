@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+// retryOnLocked retries op with exponential backoff while it fails with db.ErrLocked,
+// for up to --lock-retry-timeout. Other errors are returned immediately.
+func retryOnLocked(name string, op func() error) error {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = viper.GetDuration("lock-retry-timeout")
+	if d := untilDeadline(); 0 < d && d < b.MaxElapsedTime {
+		b.MaxElapsedTime = d
+	}
+
+	f := func() error {
+		if err := op(); err != nil {
+			if xerrors.Is(err, db.ErrLocked) {
+				return err
+			}
+			return backoff.Permanent(err)
+		}
+		return nil
+	}
+	notify := func(err error, t time.Duration) {
+		log15.Warn("DB is locked", "operation", name, "retrying in", t, "err", err)
+	}
+	if err := backoff.RetryNotify(f, b, notify); err != nil {
+		if perr, ok := err.(*backoff.PermanentError); ok {
+			return perr.Err
+		}
+		return err
+	}
+	return nil
+}
+
+// resolveDBType returns --dbtype, or the type inferred from --dbpath when it is not given
+func resolveDBType() string {
+	dbPath := viper.GetString("dbpath")
+	detected := db.DetectType(dbPath)
+	dbType := viper.GetString("dbtype")
+	if dbType == "" {
+		return detected
+	}
+	if dbType != detected && dbType != "tiered" {
+		log15.Warn("--dbtype does not look like the type of --dbpath. Using --dbtype", "dbtype", dbType, "inferred", detected)
+	}
+	return dbType
+}
+
+// newDB opens the DB specified by the flags, retrying while it is locked
+func newDB() (driver db.DB, err error) {
+	return newDBAt(viper.GetString("dbpath"))
+}
+
+// newDBAt opens the DB specified by the flags but at dbPath, e.g. the temporary copy of --into-temp-then-swap
+func newDBAt(dbPath string) (driver db.DB, err error) {
+	dbType := resolveDBType()
+	if err := validateDBConfig(dbType); err != nil {
+		return nil, err
+	}
+	priority, err := sourcePriority()
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid --source-priority: %s, err: %w", err, errConfig)
+	}
+	db.SetSourcePriority(priority)
+	err = retryOnLocked("open", func() (err error) {
+		driver, err = db.Open(dbType, dbPath,
+			db.WithDebugSQL(logLevels()["db"] == log15.LvlDebug),
+			db.WithSlowQuery(viper.GetDuration("slow-query")),
+			db.WithLogger(util.Logger("db")),
+			db.WithFastRead(viper.GetBool("fast-read")),
+			db.WithPrepareStmt(viper.GetBool("prepare-stmt")),
+			db.WithNamespace(viper.GetString("table-prefix")),
+			db.WithBatchSize(viper.GetInt("batch-size")),
+			db.WithDeleteBatch(viper.GetInt("delete-batch-size"), viper.GetDuration("delete-pause")),
+			db.WithPartition(viper.GetBool("pg-partition")),
+			db.WithTiers(viper.GetString("cache"), viper.GetString("store")),
+			db.WithKeyTTL(viper.GetDuration("redis-key-ttl")),
+			db.WithAllowEviction(viper.GetBool("allow-evicting-redis")),
+			db.WithThreads(viper.GetInt("threads")),
+			db.WithIAMAuth(iamAuth()),
+			db.WithInMemory(viper.GetBool("in-memory")),
+			db.WithTimeout(untilDeadline()),
+		)
+		return err
+	})
+	if err != nil {
+		if xerrors.Is(err, db.ErrLocked) {
+			log15.Error("Failed to initialize DB. Close DB connection before fetching", "err", err)
+		} else if xerrors.Is(err, db.ErrEvictingRedis) {
+			log15.Error("Failed to initialize DB. Set maxmemory-policy of redis to noeviction, or pass --allow-evicting-redis to run anyway", "err", err)
+		}
+		return nil, err
+	}
+	if viper.GetBool("embedded-seed") {
+		if err := loadEmbeddedSeed(driver); err != nil {
+			_ = driver.CloseDB()
+			return nil, err
+		}
+	}
+	return driver, nil
+}
+
+// checkSchemaVersion fails when the DB was created by an incompatible schema version
+func checkSchemaVersion(driver db.DB) error {
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	if fetchMeta.OutDated() {
+		return xerrors.Errorf("SchemaVersion is old. Drop the DB and fetch again. SchemaVersion: %d, expected: %d, err: %w", fetchMeta.SchemaVersion, models.LatestSchemaVersion, errSchemaMismatch)
+	}
+	return nil
+}
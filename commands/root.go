@@ -1,9 +1,11 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/inconshreveable/log15"
 	"github.com/kotakanbe/go-cpe-dictionary/util"
@@ -21,8 +23,41 @@ var RootCmd = &cobra.Command{
 	Long:          `GO CPE Dictionary`,
 	SilenceErrors: true,
 	SilenceUsage:  true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if rootEnvErr != nil {
+			return rootEnvErr
+		}
+		// the flags of the command, the global flags are set by initConfig
+		if err := setFlagsFromEnv(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := validateConfig(); err != nil {
+			return err
+		}
+		endpoint := viper.GetString("otlp-endpoint")
+		if endpoint == "" {
+			return nil
+		}
+		shutdown, err := util.InitTracerProvider(context.Background(), endpoint, viper.GetBool("otlp-insecure"))
+		if err != nil {
+			return err
+		}
+		shutdownTracerProvider = shutdown
+		return nil
+	},
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		if shutdownTracerProvider == nil {
+			return nil
+		}
+		return shutdownTracerProvider(context.Background())
+	},
 }
 
+var shutdownTracerProvider func(context.Context) error
+
+// rootEnvErr is the error of setting the global flags from the environment variables, returned before running the command
+var rootEnvErr error
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -37,22 +72,100 @@ func init() {
 	RootCmd.PersistentFlags().Bool("debug", false, "debug mode (default: false)")
 	_ = viper.BindPFlag("debug", RootCmd.PersistentFlags().Lookup("debug"))
 
-	RootCmd.PersistentFlags().Bool("debug-sql", false, "SQL debug mode")
+	RootCmd.PersistentFlags().Bool("debug-sql", false, "log the SQL statements, the same as --log-level db=debug")
 	_ = viper.BindPFlag("debug-sql", RootCmd.PersistentFlags().Lookup("debug-sql"))
 
+	RootCmd.PersistentFlags().String("log-level", "", "comma separated levels of the logs as component=level, e.g. db=debug,fetch=info, of the components db and fetch, a level without a component being that of the others (default: info, debug by --debug)")
+	_ = viper.BindPFlag("log-level", RootCmd.PersistentFlags().Lookup("log-level"))
+
+	RootCmd.PersistentFlags().Duration("slow-query", time.Second, "log the SQL statements taking longer as warnings, even without --debug-sql, 0 to disable (RDB only)")
+	_ = viper.BindPFlag("slow-query", RootCmd.PersistentFlags().Lookup("slow-query"))
+
+	RootCmd.PersistentFlags().Bool("fast-read", false, "use prepared raw SQL statements for read queries (RDB only)")
+	_ = viper.BindPFlag("fast-read", RootCmd.PersistentFlags().Lookup("fast-read"))
+
+	RootCmd.PersistentFlags().Bool("prepare-stmt", false, "prepare the multi-row INSERT once and reuse it for the batches of a fetch (RDB only)")
+	_ = viper.BindPFlag("prepare-stmt", RootCmd.PersistentFlags().Lookup("prepare-stmt"))
+
+	RootCmd.PersistentFlags().String("table-prefix", "", "prefix of the table names, e.g. gocpe_ to share the DB with other dictionaries (RDB only)")
+	_ = viper.BindPFlag("table-prefix", RootCmd.PersistentFlags().Lookup("table-prefix"))
+
+	RootCmd.PersistentFlags().Int("batch-size", 0, "number of rows inserted by a statement (RDB only) (default: tuned by the placeholder limit of the DB and max_allowed_packet of MySQL)")
+	_ = viper.BindPFlag("batch-size", RootCmd.PersistentFlags().Lookup("batch-size"))
+
+	RootCmd.PersistentFlags().Int("delete-batch-size", 0, "number of rows deleted by a statement, each committed on its own (RDB only) (default: 500)")
+	_ = viper.BindPFlag("delete-batch-size", RootCmd.PersistentFlags().Lookup("delete-batch-size"))
+
+	RootCmd.PersistentFlags().Duration("delete-pause", 0, "pause between the delete statements, e.g. 100ms to let the replicas of MySQL catch up (RDB only)")
+	_ = viper.BindPFlag("delete-pause", RootCmd.PersistentFlags().Lookup("delete-pause"))
+
+	RootCmd.PersistentFlags().Bool("pg-partition", false, "create the CPE table partitioned by the source on a new DB, so that a source is refreshed by truncating its partition (PostgreSQL only)")
+	_ = viper.BindPFlag("pg-partition", RootCmd.PersistentFlags().Lookup("pg-partition"))
+
+	RootCmd.PersistentFlags().Duration("redis-key-ttl", 0, "expire the keys of the CPEs of each vendor/product written to redis after the duration, e.g. 24h for the cache of --dbtype tiered refilled from the store (redis only) (default: never)")
+	_ = viper.BindPFlag("redis-key-ttl", RootCmd.PersistentFlags().Lookup("redis-key-ttl"))
+
+	RootCmd.PersistentFlags().Bool("allow-evicting-redis", false, "run on a redis whose maxmemory-policy is allkeys-*, which evicts the CPEs silently, only warning (redis only)")
+	_ = viper.BindPFlag("allow-evicting-redis", RootCmd.PersistentFlags().Lookup("allow-evicting-redis"))
+
+	RootCmd.PersistentFlags().Int("threads", 0, "number of the workers decoding and converting the fetched feeds, binding the rows inserted (RDB) and reading the vendor/products found by a search with a wildcard, e.g. /cpes/vendor*/product* with --glob (redis) (default: the number of CPUs)")
+	_ = viper.BindPFlag("threads", RootCmd.PersistentFlags().Lookup("threads"))
+
+	RootCmd.PersistentFlags().Bool("glob", false, "take * and ? of the vendor/product of /cpes/:vendor/:product, /products/rank and query cpes for any string and any character, otherwise they match as they are, as % and _ do")
+	_ = viper.BindPFlag("glob", RootCmd.PersistentFlags().Lookup("glob"))
+
+	RootCmd.PersistentFlags().String("collate", "", "locale whose collation orders the listings of the vendor/products of GET /products, /products/catalog, products and query, e.g. ja (default: the order of the DB)")
+	_ = viper.BindPFlag("collate", RootCmd.PersistentFlags().Lookup("collate"))
+
+	RootCmd.PersistentFlags().String("source-priority", "", "comma separated sources, e.g. nvd,jvn, whose deprecation of a CPE defined by several sources wins over the later ones, and in whose order the sources of a CPE are listed (default: deprecated by any source, listed by name)")
+	_ = viper.BindPFlag("source-priority", RootCmd.PersistentFlags().Lookup("source-priority"))
+
+	RootCmd.PersistentFlags().Bool("rds-iam-auth", false, "connect to Amazon RDS with an IAM auth token signed by the AWS credentials of the environment or the web identity of EKS instead of the password of --dbpath (MySQL and PostgreSQL only)")
+	_ = viper.BindPFlag("rds-iam-auth", RootCmd.PersistentFlags().Lookup("rds-iam-auth"))
+
+	RootCmd.PersistentFlags().Bool("cloudsql-iam-auth", false, "connect to Cloud SQL with the access token of the service account of the GCE metadata server, e.g. of Workload Identity of GKE, instead of the password of --dbpath (MySQL and PostgreSQL only)")
+	_ = viper.BindPFlag("cloudsql-iam-auth", RootCmd.PersistentFlags().Lookup("cloudsql-iam-auth"))
+
+	RootCmd.PersistentFlags().Bool("embedded-seed", false, "load the seed dictionary embedded in the binary into a DB never fetched before, so that it works offline and the fetches only update it")
+	_ = viper.BindPFlag("embedded-seed", RootCmd.PersistentFlags().Lookup("embedded-seed"))
+
 	pwd := os.Getenv("PWD")
 	RootCmd.PersistentFlags().String("dbpath", filepath.Join(pwd, "cpe.sqlite3"), "/path/to/sqlite3 or SQL connection string")
 	_ = viper.BindPFlag("dbpath", RootCmd.PersistentFlags().Lookup("dbpath"))
 
-	RootCmd.PersistentFlags().String("dbtype", "sqlite3", "Database type to store data in (sqlite3, mysql, postgres or redis supported)")
+	RootCmd.PersistentFlags().String("dbtype", "", "Database type to store data in (sqlite3, mysql, postgres, redis, dynamodb or tiered supported) (default: inferred from --dbpath)")
 	_ = viper.BindPFlag("dbtype", RootCmd.PersistentFlags().Lookup("dbtype"))
 
+	RootCmd.PersistentFlags().String("cache", "", "DB read first by --dbtype tiered, e.g. redis://localhost/0")
+	_ = viper.BindPFlag("cache", RootCmd.PersistentFlags().Lookup("cache"))
+
+	RootCmd.PersistentFlags().String("store", "", "DB of the source of truth of --dbtype tiered, e.g. postgres://... (default: --dbpath)")
+	_ = viper.BindPFlag("store", RootCmd.PersistentFlags().Lookup("store"))
+
+	RootCmd.PersistentFlags().Duration("lock-retry-timeout", 2*time.Minute, "how long to keep retrying while the DB is locked by another process")
+	_ = viper.BindPFlag("lock-retry-timeout", RootCmd.PersistentFlags().Lookup("lock-retry-timeout"))
+
+	RootCmd.PersistentFlags().String("search-index", "", "/path/to/the search index file written by the fetches and loaded by the server on starting (default: <dbpath>.search-index for sqlite3, in memory only for the others)")
+	_ = viper.BindPFlag("search-index", RootCmd.PersistentFlags().Lookup("search-index"))
+
+	RootCmd.PersistentFlags().String("audit-actor", "", "who is recorded in the audit log as running the data-modifying operations (default: user@host of the process)")
+	_ = viper.BindPFlag("audit-actor", RootCmd.PersistentFlags().Lookup("audit-actor"))
+
 	RootCmd.PersistentFlags().String("http-proxy", "", "http://proxy-url:port (default: empty)")
 	_ = viper.BindPFlag("http-proxy", RootCmd.PersistentFlags().Lookup("http-proxy"))
+
+	RootCmd.PersistentFlags().String("otlp-endpoint", "", "OTLP gRPC endpoint to export traces to, e.g. localhost:4317 (default: tracing disabled)")
+	_ = viper.BindPFlag("otlp-endpoint", RootCmd.PersistentFlags().Lookup("otlp-endpoint"))
+
+	RootCmd.PersistentFlags().Bool("otlp-insecure", false, "disable TLS for the OTLP endpoint")
+	_ = viper.BindPFlag("otlp-insecure", RootCmd.PersistentFlags().Lookup("otlp-insecure"))
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
+	// before the config file and the logger, which the global flags choose
+	rootEnvErr = setFlagsFromEnv(RootCmd.PersistentFlags())
+
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
 	} else {
@@ -68,7 +181,8 @@ func initConfig() {
 		viper.SetConfigName(".go-cpe-dictionary")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// read in environment variables that match, e.g. DBPATH, kept for the setups before GO_CPE_DICTIONARY_*
+	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
@@ -77,5 +191,18 @@ func initConfig() {
 	logDir := viper.GetString("log-dir")
 	debug := viper.GetBool("debug")
 	logJSON := viper.GetBool("log-json")
-	util.SetLogger(logDir, debug, logJSON)
+	util.SetLogger(logDir, debug, logJSON, logLevels())
+}
+
+// logLevels returns the levels of --log-level, db=debug by --debug-sql unless it's given.
+// An invalid --log-level is rejected by validateConfig, so it's ignored here.
+func logLevels() util.LogLevels {
+	levels, err := util.ParseLogLevels(viper.GetString("log-level"))
+	if err != nil {
+		levels = util.LogLevels{}
+	}
+	if _, ok := levels["db"]; !ok && viper.GetBool("debug-sql") {
+		levels["db"] = log15.LvlDebug
+	}
+	return levels
 }
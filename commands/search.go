@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
+	"github.com/spf13/cobra"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "Search vendor/products by name in romaji or kana",
+	Long:  "Search vendor/products by name in romaji or kana",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  executeSearch,
+}
+
+func init() {
+	RootCmd.AddCommand(searchCmd)
+}
+
+func executeSearch(cmd *cobra.Command, args []string) (err error) {
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	if err := checkSchemaVersion(driver); err != nil {
+		return err
+	}
+
+	results, err := search.Products(driver, strings.Join(args, " "))
+	if err != nil {
+		log15.Error("Failed to search.", "err", err)
+		return err
+	}
+	for _, r := range results {
+		fmt.Printf("%s\t%s\t%s\n", r.Vendor, r.Product, r.Title)
+	}
+	return nil
+}
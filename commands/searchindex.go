@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+// searchIndexPath returns the path of the search index file: --search-index, or <dbpath>.search-index for sqlite3.
+// It's empty for the other DBs without --search-index, which keep the index in memory only.
+func searchIndexPath() string {
+	if path := viper.GetString("search-index"); path != "" {
+		return path
+	}
+	if resolveDBType() != "sqlite3" {
+		return ""
+	}
+	return viper.GetString("dbpath") + ".search-index"
+}
+
+// rebuildSearchIndex builds the search index from the DB, serves it and writes it to searchIndexPath
+func rebuildSearchIndex(driver db.DB) (*search.Index, error) {
+	ix, err := search.BuildIndex(driver)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to build the search index. err: %w", err)
+	}
+	search.SetIndex(ix)
+	path := searchIndexPath()
+	if path == "" {
+		return ix, nil
+	}
+	if err := ix.Save(path); err != nil {
+		return ix, xerrors.Errorf("Failed to save the search index. path: %s, err: %w", path, err)
+	}
+	log15.Info("Saved the search index", "path", path, "vendorProducts", len(ix.Entries))
+	return ix, nil
+}
+
+// saveSearchIndex rebuilds the search index after a fetch.
+// A failure is only logged, since the CPEs are already stored and the searches read the DB without the index.
+func saveSearchIndex(driver db.DB) {
+	if _, err := rebuildSearchIndex(driver); err != nil {
+		log15.Warn("Failed to rebuild the search index.", "err", err)
+	}
+}
+
+// loadSearchIndex serves the search index saved by the last fetch. When it's missing or of another generation than the DB,
+// the searches read the DB until the index is rebuilt in the background.
+func loadSearchIndex(driver db.DB) {
+	path := searchIndexPath()
+	if path != "" {
+		ix, err := search.LoadIndex(path)
+		if err == nil {
+			if fetchMeta, err := driver.GetFetchMeta(); err == nil && fetchMeta.Generation == ix.Generation {
+				search.SetIndex(ix)
+				log15.Info("Loaded the search index", "path", path, "vendorProducts", len(ix.Entries))
+				return
+			}
+			log15.Info("The search index is stale. Rebuilding it", "path", path, "generation", ix.Generation)
+		} else {
+			log15.Info("Rebuilding the search index", "path", path, "reason", err)
+		}
+	}
+	go saveSearchIndex(driver)
+}
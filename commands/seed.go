@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/seed"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+var seedCmd = &cobra.Command{
+	Use:   "seed",
+	Short: "Fetch the sources into the seed dictionary embedded in a release",
+	Long:  "Fetch the sources into the seed dictionary, embedded in the binary built with the embedseed tag and loaded by --embedded-seed",
+	RunE:  generateSeed,
+}
+
+func init() {
+	RootCmd.AddCommand(seedCmd)
+
+	seedCmd.PersistentFlags().String("out", "seed/cpes.jsonl.gz", "/path/to/file to write the seed to")
+	seedCmd.PersistentFlags().String("sources", "nvd,jvn", "comma separated sources of the seed")
+	addTimeoutFlags(seedCmd, "bound the whole fetch, e.g. 1h (default: no limit)")
+}
+
+func generateSeed(cmd *cobra.Command, args []string) (err error) {
+	ctx, cancel, err := timeoutContext(cmd)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	path, err := cmd.Flags().GetString("out")
+	if err != nil {
+		return err
+	}
+	param, err := cmd.Flags().GetString("sources")
+	if err != nil {
+		return err
+	}
+	sources, err := models.ParseFetchTypes(param)
+	if err != nil {
+		return err
+	}
+
+	header := seed.Header{SchemaVersion: models.LatestSchemaVersion, FetchedAt: time.Now()}
+	all := []models.CategorizedCpe{}
+	for _, source := range sources {
+		var cpes []models.CategorizedCpe
+		switch source {
+		case models.NVD:
+			var result fetcher.NVDResult
+			result, err = fetcher.FetchNVDResult(ctx, fetcher.NVDOption{OnError: fetcher.OnErrorFail})
+			cpes = result.CPEs
+			header.NVDDictVersion, header.NVDDictGeneratedAt = result.Stamp.Version, result.Stamp.GeneratedAt
+		case models.JVN:
+			cpes, err = fetcher.FetchJVN(ctx)
+		case models.Windows:
+			cpes, err = fetcher.FetchWindows(ctx)
+		}
+		if err != nil {
+			log15.Error("Failed to fetch.", "source", source, "err", err)
+			return err
+		}
+		log15.Info("Fetched", "source", source, "Number of CPEs", len(cpes))
+		all = append(all, cpes...)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return xerrors.Errorf("Failed to create the seed. path: %s, err: %w", path, err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	if err := seed.Write(f, header, all); err != nil {
+		return xerrors.Errorf("Failed to write the seed. path: %s, err: %w", path, err)
+	}
+	log15.Info(fmt.Sprintf("Wrote %d CPEs to %s", len(all), path))
+	return nil
+}
+
+// loadEmbeddedSeed loads the seed embedded in the binary into the DB never fetched before.
+// A DB fetched once is left as is, so the seed never overwrites newer CPEs.
+func loadEmbeddedSeed(driver db.DB) error {
+	data := seed.Embedded()
+	if data == nil {
+		return xerrors.New("The binary has no embedded seed. Build it by make seed build-seed")
+	}
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	if !fetchMeta.LastFetchedAt.IsZero() {
+		return nil
+	}
+
+	header, cpes, err := seed.Read(bytes.NewReader(data))
+	if err != nil {
+		return xerrors.Errorf("Failed to read the embedded seed. err: %w", err)
+	}
+	if header.SchemaVersion != models.LatestSchemaVersion {
+		return xerrors.Errorf("The embedded seed is of another schema version. SchemaVersion: %d, expected: %d, err: %w", header.SchemaVersion, models.LatestSchemaVersion, errSchemaMismatch)
+	}
+	log15.Info("Loading the embedded seed", "fetchedAt", header.FetchedAt.Format(time.RFC3339), "Number of CPEs", len(cpes))
+	if err := retryOnLocked("insert", func() error { return driver.InsertCpes(cpes) }); err != nil {
+		return xerrors.Errorf("Failed to insert the embedded seed. err: %w", err)
+	}
+
+	// the seed is as old as its fetch, so Data currency tells how stale it is
+	fetchMeta.LastFetchedAt = header.FetchedAt
+	fetchMeta.Generation++
+	if header.NVDDictGeneratedAt != nil {
+		fetchMeta.NVDDictVersion = header.NVDDictVersion
+		fetchMeta.NVDDictGeneratedAt = header.NVDDictGeneratedAt
+	}
+	if err := retryOnLocked("upsert FetchMeta", func() error { return driver.UpsertFetchMeta(fetchMeta) }); err != nil {
+		return xerrors.Errorf("Failed to upsert FetchMeta to DB. err: %w", err)
+	}
+	loadDistroPackages(driver)
+	saveSearchIndex(driver)
+	return nil
+}
@@ -1,11 +1,22 @@
 package commands
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
 	"github.com/inconshreveable/log15"
 	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
 	"github.com/kotakanbe/go-cpe-dictionary/server"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
 )
 
 var serverCmd = &cobra.Command{
@@ -23,23 +34,266 @@ func init() {
 
 	serverCmd.PersistentFlags().String("port", "1328", "HTTP server port number (default: 1328")
 	_ = viper.BindPFlag("port", serverCmd.PersistentFlags().Lookup("port"))
+
+	serverCmd.PersistentFlags().Duration("fetch-interval", 0, "fetch the sources in the server every interval, e.g. 24h (default: disabled)")
+	_ = viper.BindPFlag("fetch-interval", serverCmd.PersistentFlags().Lookup("fetch-interval"))
+
+	serverCmd.PersistentFlags().String("fetch-sources", "nvd,jvn", "comma separated sources fetched by --fetch-interval")
+	_ = viper.BindPFlag("fetch-sources", serverCmd.PersistentFlags().Lookup("fetch-sources"))
+
+	serverCmd.PersistentFlags().Bool("ui", false, "serve the web UI at /")
+	_ = viper.BindPFlag("ui", serverCmd.PersistentFlags().Lookup("ui"))
+
+	serverCmd.PersistentFlags().String("admin-token-file", "", "/path/to/file holding the bearer token of the admin endpoints triggering a fetch (default: disabled)")
+	_ = viper.BindPFlag("admin-token-file", serverCmd.PersistentFlags().Lookup("admin-token-file"))
+
+	serverCmd.PersistentFlags().Int("hot-products", 0, "count the lookups of the vendor/products and report the N most looked up ones as hot_products of /metrics (default: disabled)")
+	_ = viper.BindPFlag("hot-products", serverCmd.PersistentFlags().Lookup("hot-products"))
+
+	serverCmd.PersistentFlags().Bool("compat-vuls", false, "serve the unversioned /health, /products and /cpes/:vendor/:product in the shapes before the API versioning, for Vuls")
+	_ = viper.BindPFlag("compat-vuls", serverCmd.PersistentFlags().Lookup("compat-vuls"))
+
+	serverCmd.PersistentFlags().Bool("in-memory", false, "load the CPEs into memory on starting and serve the lookups without querying the DB, reloading them after the fetches of the server")
+	_ = viper.BindPFlag("in-memory", serverCmd.PersistentFlags().Lookup("in-memory"))
+
+	serverCmd.PersistentFlags().String("cors-origins", "", "comma separated origins whose pages may call the API from the browsers, e.g. https://dashboard.example.com, or * for any (default: disabled)")
+	_ = viper.BindPFlag("cors-origins", serverCmd.PersistentFlags().Lookup("cors-origins"))
+
+	serverCmd.PersistentFlags().String("cors-methods", "GET,HEAD,POST", "comma separated methods allowed to --cors-origins")
+	_ = viper.BindPFlag("cors-methods", serverCmd.PersistentFlags().Lookup("cors-methods"))
+
+	serverCmd.PersistentFlags().String("cors-headers", "Accept,Authorization,Content-Type,If-None-Match,If-Modified-Since", "comma separated request headers allowed to --cors-origins")
+	_ = viper.BindPFlag("cors-headers", serverCmd.PersistentFlags().Lookup("cors-headers"))
+
+	limits := server.DefaultLimits()
+	serverCmd.PersistentFlags().Int("max-query-length", limits.MaxQueryLength, "max bytes of the query string of a request, answered with 400 beyond it")
+	_ = viper.BindPFlag("max-query-length", serverCmd.PersistentFlags().Lookup("max-query-length"))
+
+	serverCmd.PersistentFlags().Int("max-param-length", limits.MaxParamLength, "max bytes of a path or a query parameter of a request, e.g. the product, answered with 400 beyond it")
+	_ = viper.BindPFlag("max-param-length", serverCmd.PersistentFlags().Lookup("max-param-length"))
+
+	serverCmd.PersistentFlags().Int64("max-body-bytes", limits.MaxBodyBytes, "max bytes of the body of a request, e.g. of POST /identify, answered with 400 beyond it")
+	_ = viper.BindPFlag("max-body-bytes", serverCmd.PersistentFlags().Lookup("max-body-bytes"))
+
+	serverCmd.PersistentFlags().Int("max-batch", limits.MaxBatch, "max number of the items of a request, e.g. the banners of POST /identify, answered with 400 beyond it")
+	_ = viper.BindPFlag("max-batch", serverCmd.PersistentFlags().Lookup("max-batch"))
+
+	addWatchFlags(serverCmd)
+	addShrinkFlags(serverCmd)
+	addRankingFlags(serverCmd)
+	addTimeoutFlags(serverCmd, "bound each scheduled fetch, including the HTTP requests and the DB operations, e.g. 2h (default: no limit)")
+	addMemoryFlags(serverCmd)
+	addPipelineFlags(serverCmd)
 }
 
 func executeServer(cmd *cobra.Command, args []string) (err error) {
 	logDir := viper.GetString("log-dir")
-	driver, locked, err := db.NewDB(viper.GetString("dbtype"), viper.GetString("dbpath"), viper.GetBool("debug-sql"))
+	if err := applyMemoryLimit(cmd); err != nil {
+		return err
+	}
+	if err := applyPipeline(cmd); err != nil {
+		return err
+	}
+	driver, err := newDB()
 	if err != nil {
-		if locked {
-			log15.Error("Failed to initialize DB. Close DB connection before fetching", "err", err)
-		}
+		return err
+	}
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
 		return err
 	}
 
+	sources, err := models.ParseFetchTypes(viper.GetString("fetch-sources"))
+	if err != nil {
+		return err
+	}
+	webhookURL, err := cmd.Flags().GetString("webhook-url")
+	if err != nil {
+		return err
+	}
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return err
+	}
+	serviceName, err := cmd.Flags().GetString("service-name")
+	if err != nil {
+		return err
+	}
+	guard, err := newShrinkGuard(cmd)
+	if err != nil {
+		return err
+	}
+	adminToken, err := loadAdminToken(viper.GetString("admin-token-file"))
+	if err != nil {
+		return err
+	}
+	if err := loadRanking(); err != nil {
+		return err
+	}
+	collator, err := newCollator()
+	if err != nil {
+		return err
+	}
+	cors, err := corsOption()
+	if err != nil {
+		return err
+	}
+
+	loadSearchIndex(driver)
+
+	option := server.Option{
+		FetchInterval: viper.GetDuration("fetch-interval"),
+		Fetch:         refresh(driver, sources, webhookURL, timeout, guard),
+		UI:            viper.GetBool("ui"),
+		AdminToken:    adminToken,
+		HotProducts:   viper.GetInt("hot-products"),
+		CompatVuls:    viper.GetBool("compat-vuls"),
+		Glob:          viper.GetBool("glob"),
+		Limits: server.Limits{
+			MaxQueryLength: viper.GetInt("max-query-length"),
+			MaxParamLength: viper.GetInt("max-param-length"),
+			MaxBodyBytes:   viper.GetInt64("max-body-bytes"),
+			MaxBatch:       viper.GetInt("max-batch"),
+		},
+		Collator:     collator,
+		CORS:         cors,
+		RebuildIndex: func() (*search.Index, error) { return rebuildSearchIndex(driver) },
+	}
+
 	log15.Info("Starting HTTP Server...")
-	if err = server.Start(logDir, driver); err != nil {
+	if err = runServer(serviceName, func() error { return server.Start(logDir, driver, option) }); err != nil {
 		log15.Error("Failed to start server.", "err", err)
 		return err
 	}
 
 	return nil
 }
+
+// loadAdminToken reads the bearer token of the admin endpoints, empty when path is empty
+func loadAdminToken(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", xerrors.Errorf("Failed to read the admin token. err: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", xerrors.Errorf("The admin token is empty. path: %s", path)
+	}
+	return token, nil
+}
+
+// refresh returns the fetch run by the server, which fetches the sources and inserts them
+// as fetchnvd and fetchjvn do with the default flags, and then checks the watchlist.
+// The sources requested to the fetch replace the sources unless they're empty.
+// The CPEs not fetched any more are removed, and a source is not stored when guard rejects it.
+// A fetch is canceled after timeout unless it's 0.
+func refresh(driver db.DB, sources []models.FetchType, webhookURL string, timeout time.Duration, guard shrinkGuard) server.FetchFunc {
+	return func(ctx context.Context, requested []models.FetchType) error {
+		sources := sources
+		if 0 < len(requested) {
+			sources = requested
+		}
+		if 0 < timeout {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		var stamp fetcher.DictionaryStamp
+		hashes := map[models.FetchType]string{}
+		for _, source := range sources {
+			startedAt := time.Now()
+			var cpes []models.CategorizedCpe
+			var err error
+			switch source {
+			case models.NVD:
+				var result fetcher.NVDResult
+				result, err = fetcher.FetchNVDResult(ctx, fetcher.NVDOption{OnError: fetcher.OnErrorFail})
+				cpes, stamp = result.CPEs, result.Stamp
+			case models.JVN:
+				cpes, err = fetcher.FetchJVN(ctx)
+			case models.Windows:
+				cpes, err = fetcher.FetchWindows(ctx)
+			}
+			if err != nil {
+				return xerrors.Errorf("Failed to fetch. source: %s, err: %w", source, err)
+			}
+			// skipped with warnings as by default of the fetch commands
+			if _, err := (rejectPolicy{}).take(source); err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return xerrors.Errorf("Timed out before inserting. source: %s, err: %w", source, err)
+			}
+			if err := guard.check(driver, source, cpes); err != nil {
+				return err
+			}
+			hash, err := insertChangedCpes(driver, source, cpes, true)
+			if err != nil {
+				return xerrors.Errorf("Failed to insert cpes. source: %s, err: %w", source, err)
+			}
+			hashes[source] = hash
+			log15.Info(fmt.Sprintf("Inserted %d CPEs", len(cpes)), "source", source)
+			version := ""
+			if source == models.NVD {
+				version = stamp.Version
+			}
+			recordFetch(driver, source, startedAt, len(cpes), version)
+		}
+
+		fetchMeta, err := driver.GetFetchMeta()
+		if err != nil {
+			return xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+		}
+		fetchMeta.LastFetchedAt = time.Now()
+		fetchMeta.Generation++
+		for source, hash := range hashes {
+			fetchMeta.SetSourceHash(source, hash)
+		}
+		if stamp.GeneratedAt != nil {
+			fetchMeta.NVDDictVersion = stamp.Version
+			fetchMeta.NVDDictGeneratedAt = stamp.GeneratedAt
+		}
+		if err := retryOnLocked("upsert FetchMeta", func() error { return driver.UpsertFetchMeta(fetchMeta) }); err != nil {
+			return err
+		}
+		loadDistroPackages(driver)
+		saveSearchIndex(driver)
+		checkWatchlist(ctx, driver, webhookURL)
+		return nil
+	}
+}
+
+// corsOption returns the CORS of --cors-origins, --cors-methods and --cors-headers
+func corsOption() (server.CORS, error) {
+	cors := server.CORS{
+		Origins: splitFlag(viper.GetString("cors-origins")),
+		Methods: splitFlag(viper.GetString("cors-methods")),
+		Headers: splitFlag(viper.GetString("cors-headers")),
+	}
+	for _, origin := range cors.Origins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return server.CORS{}, xerrors.Errorf("Invalid --cors-origins: %s, expected * or the origins, e.g. https://dashboard.example.com: %w", origin, errConfig)
+		}
+	}
+	for i, method := range cors.Methods {
+		cors.Methods[i] = strings.ToUpper(method)
+	}
+	return cors, nil
+}
+
+// splitFlag splits a comma separated flag into its trimmed items, nil when it's empty
+func splitFlag(param string) []string {
+	var items []string
+	for _, item := range strings.Split(param, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
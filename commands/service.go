@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+var serverInstallServiceCmd = &cobra.Command{
+	Use:   "install-service",
+	Short: "Install the server as a systemd unit or a Windows service",
+	Long: `Install the server as a systemd unit on Linux or a Windows service, started on boot and restarted on failure.
+The server of the service runs with the flags given to install-service, e.g. --dbpath, --port and --fetch-interval, and the config file read`,
+	Args: cobra.NoArgs,
+	RunE: executeInstallService,
+}
+
+func init() {
+	serverCmd.AddCommand(serverInstallServiceCmd)
+
+	serverInstallServiceCmd.Flags().String("name", "go-cpe-dictionary", "name of the service")
+	serverInstallServiceCmd.Flags().String("user", "", "user running the server of the systemd unit (default: root)")
+	serverInstallServiceCmd.Flags().String("unit-dir", "/etc/systemd/system", "directory the systemd unit is written to")
+	serverInstallServiceCmd.Flags().Bool("dry-run", false, "print the systemd unit or the command line of the Windows service without installing it")
+	serverInstallServiceCmd.Flags().Bool("no-start", false, "install the service without enabling and starting it")
+
+	// the name of the Windows service is given to the server by the command line of the service, to write to its event log
+	serverCmd.Flags().String("service-name", "", "name of the Windows service running the server")
+	_ = serverCmd.Flags().MarkHidden("service-name")
+}
+
+// serviceConfig is the service installed by install-service
+type serviceConfig struct {
+	name    string
+	user    string
+	unitDir string
+	dryRun  bool
+	noStart bool
+	// exe is the absolute path of the running binary
+	exe string
+	// args are the arguments of the server run by the service
+	args []string
+	// workDir is the directory install-service runs in, where the relative paths of args are resolved
+	workDir string
+	// logDir is --log-dir given to install-service, empty by default
+	logDir string
+}
+
+func executeInstallService(cmd *cobra.Command, args []string) error {
+	var c serviceConfig
+	var err error
+	if c.name, err = cmd.Flags().GetString("name"); err != nil {
+		return err
+	}
+	if c.name == "" {
+		return xerrors.Errorf("--name is empty: %w", errConfig)
+	}
+	if c.user, err = cmd.Flags().GetString("user"); err != nil {
+		return err
+	}
+	if c.unitDir, err = cmd.Flags().GetString("unit-dir"); err != nil {
+		return err
+	}
+	if c.dryRun, err = cmd.Flags().GetBool("dry-run"); err != nil {
+		return err
+	}
+	if c.noStart, err = cmd.Flags().GetBool("no-start"); err != nil {
+		return err
+	}
+	if c.exe, err = os.Executable(); err != nil {
+		return xerrors.Errorf("Failed to get the path of the binary. err: %w", err)
+	}
+	if c.workDir, err = os.Getwd(); err != nil {
+		return xerrors.Errorf("Failed to get the working directory. err: %w", err)
+	}
+	if c.args, err = serviceArgs(cmd); err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("log-dir") {
+		c.logDir = viper.GetString("log-dir")
+	}
+	return installService(c)
+}
+
+// serviceArgs returns the arguments running the server with the flags given to install-service except its own,
+// and --config of the config file read by install-service
+func serviceArgs(cmd *cobra.Command) ([]string, error) {
+	own := cmd.LocalNonPersistentFlags()
+	args := []string{"server"}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if own.Lookup(f.Name) != nil || f.Name == "config" {
+			return
+		}
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range s.GetSlice() {
+				args = append(args, fmt.Sprintf("--%s=%s", f.Name, v))
+			}
+			return
+		}
+		args = append(args, fmt.Sprintf("--%s=%s", f.Name, f.Value.String()))
+	})
+	if config := viper.ConfigFileUsed(); config != "" {
+		abs, err := filepath.Abs(config)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to get the path of the config file. err: %w", err)
+		}
+		args = append(args, "--config="+abs)
+	}
+	return args, nil
+}
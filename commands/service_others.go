@@ -0,0 +1,97 @@
+//go:build !windows
+// +build !windows
+
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+)
+
+// installService writes the systemd unit running the server, and enables and starts it
+func installService(c serviceConfig) error {
+	if runtime.GOOS != "linux" {
+		return xerrors.Errorf("install-service supports systemd on Linux and the Windows services, not %s: %w", runtime.GOOS, errConfig)
+	}
+	unit := systemdUnit(c)
+	if c.dryRun {
+		fmt.Print(unit)
+		return nil
+	}
+	path := filepath.Join(c.unitDir, c.name+".service")
+	if err := ioutil.WriteFile(path, []byte(unit), 0644); err != nil {
+		return xerrors.Errorf("Failed to write the systemd unit. err: %w", err)
+	}
+	log15.Info("Wrote the systemd unit", "path", path)
+	if c.noStart {
+		return nil
+	}
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "--now", c.name + ".service"}} {
+		if out, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+			return xerrors.Errorf("Failed to systemctl %s. out: %s, err: %w", strings.Join(args, " "), strings.TrimSpace(string(out)), err)
+		}
+	}
+	log15.Info("Enabled and started the service", "name", c.name)
+	return nil
+}
+
+// runServer runs the server, which is the process itself on systemd
+func runServer(serviceName string, run func() error) error {
+	return run()
+}
+
+// systemdUnit returns the unit running the server of c. The logs go to the journal and,
+// without --log-dir, to /var/log/<name> made by systemd for the user of the unit
+func systemdUnit(c serviceConfig) string {
+	args := append([]string{c.exe}, c.args...)
+	logsDirectory := ""
+	if c.logDir == "" {
+		logsDirectory = c.name
+		args = append(args, "--log-dir="+filepath.Join("/var/log", c.name))
+	}
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=go-cpe-dictionary server (%s)\n", c.name)
+	b.WriteString("Documentation=https://github.com/kotakanbe/go-cpe-dictionary\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdQuote(c.workDir))
+	if c.user != "" {
+		fmt.Fprintf(&b, "User=%s\n", c.user)
+	}
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=10\n")
+	b.WriteString("StandardOutput=journal\n")
+	b.WriteString("StandardError=journal\n")
+	fmt.Fprintf(&b, "SyslogIdentifier=%s\n", c.name)
+	if logsDirectory != "" {
+		fmt.Fprintf(&b, "LogsDirectory=%s\n", logsDirectory)
+	}
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+	return b.String()
+}
+
+// systemdQuote quotes an argument of ExecStart, escaping the specifiers (%) and the variables ($) of systemd
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
@@ -0,0 +1,128 @@
+//go:build windows
+// +build windows
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+	"golang.org/x/xerrors"
+)
+
+// installService registers the Windows service running the server and its source of the event log, and starts it
+func installService(c serviceConfig) error {
+	args := append(c.args, "--service-name="+c.name)
+	if c.logDir == "" {
+		args = append(args, "--log-dir="+filepath.Join(os.Getenv("ProgramData"), c.name))
+	}
+	if c.dryRun {
+		fmt.Println(strings.Join(append([]string{c.exe}, args...), " "))
+		return nil
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return xerrors.Errorf("Failed to connect to the service control manager. err: %w", err)
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(c.name); err == nil {
+		s.Close()
+		return xerrors.Errorf("The service already exists. name: %s: %w", c.name, errConfig)
+	}
+	s, err := m.CreateService(c.name, c.exe, mgr.Config{
+		DisplayName: c.name,
+		Description: "go-cpe-dictionary server",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return xerrors.Errorf("Failed to create the service. err: %w", err)
+	}
+	defer s.Close()
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 10 * time.Second}}, uint32((24 * time.Hour).Seconds())); err != nil {
+		log15.Warn("Failed to set the restart on failure of the service.", "err", err)
+	}
+	if err := eventlog.InstallAsEventCreate(c.name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		log15.Warn("Failed to install the source of the event log. The logs go to --log-dir only.", "err", err)
+	}
+	log15.Info("Installed the service", "name", c.name)
+	if c.noStart {
+		return nil
+	}
+	if err := s.Start(); err != nil {
+		return xerrors.Errorf("Failed to start the service. err: %w", err)
+	}
+	log15.Info("Started the service", "name", c.name)
+	return nil
+}
+
+// runServer runs the server under the service control manager when the process is the Windows service, writing the logs to its event log too
+func runServer(serviceName string, run func() error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return xerrors.Errorf("Failed to detect the Windows service. err: %w", err)
+	}
+	if !isService {
+		return run()
+	}
+	if elog, err := eventlog.Open(serviceName); err == nil {
+		defer elog.Close()
+		log15.Root().SetHandler(log15.MultiHandler(log15.Root().GetHandler(), eventLogHandler(elog)))
+	} else {
+		log15.Warn("Failed to open the event log.", "name", serviceName, "err", err)
+	}
+	return svc.Run(serviceName, &service{run: run})
+}
+
+// service is the Windows service of the server, stopped by the service control manager
+type service struct {
+	run func() error
+}
+
+// Execute runs the server until the service is stopped, or exits with 1 when the server fails so that the service is restarted
+func (s *service) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.run()
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-errs:
+			log15.Error("The server stopped.", "err", err)
+			return true, 1
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				changes <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				return false, 0
+			}
+		}
+	}
+}
+
+// eventLogHandler writes the logs of Info and above to the event log
+func eventLogHandler(elog *eventlog.Log) log15.Handler {
+	format := log15.LogfmtFormat()
+	return log15.LvlFilterHandler(log15.LvlInfo, log15.FuncHandler(func(r *log15.Record) error {
+		msg := string(format.Format(r))
+		switch r.Lvl {
+		case log15.LvlCrit, log15.LvlError:
+			return elog.Error(1, msg)
+		case log15.LvlWarn:
+			return elog.Warning(1, msg)
+		default:
+			return elog.Info(1, msg)
+		}
+	}))
+}
@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+// shrinkGuard rejects a fetch with much fewer CPEs than the DB has, e.g. of a truncated upstream feed,
+// before the CPEs missing from it are removed from the DB by ReplaceCpes
+type shrinkGuard struct {
+	allow bool
+	// maxPercent is how many percent fewer CPEs than the DB a fetch may have
+	maxPercent int
+}
+
+// addShrinkFlags adds --allow-shrink and --max-shrink to cmd
+func addShrinkFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool("allow-shrink", false, "store the fetched CPEs even when they are fewer than those in the DB by more than --max-shrink")
+	cmd.PersistentFlags().Int("max-shrink", 20, "percentage by which the fetched CPEs of a source may be fewer than those in the DB, e.g. of a truncated feed")
+}
+
+// newShrinkGuard returns the guard by the flags of cmd
+func newShrinkGuard(cmd *cobra.Command) (shrinkGuard, error) {
+	allow, err := cmd.Flags().GetBool("allow-shrink")
+	if err != nil {
+		return shrinkGuard{}, err
+	}
+	maxPercent, err := cmd.Flags().GetInt("max-shrink")
+	if err != nil {
+		return shrinkGuard{}, err
+	}
+	if maxPercent < 0 || 100 < maxPercent {
+		return shrinkGuard{}, xerrors.Errorf("Invalid --max-shrink. It must be from 0 to 100: %d", maxPercent)
+	}
+	return shrinkGuard{allow: allow, maxPercent: maxPercent}, nil
+}
+
+// check fails with errShrink when the CPEs fetched from source are fewer than those in the DB by more than maxPercent
+func (g shrinkGuard) check(driver db.DB, source models.FetchType, cpes []models.CategorizedCpe) error {
+	stored, err := driver.CountCpes(source)
+	if err != nil {
+		return xerrors.Errorf("Failed to count the CPEs. source: %s, err: %w", source, err)
+	}
+	uris := map[string]struct{}{}
+	for _, c := range cpes {
+		uris[c.CpeURI] = struct{}{}
+	}
+	fetched := len(uris)
+	if stored == 0 || stored <= fetched {
+		return nil
+	}
+
+	percent := (stored - fetched) * 100 / stored
+	if percent <= g.maxPercent {
+		return nil
+	}
+	if g.allow {
+		log15.Warn("Fetched fewer CPEs than the DB has. Storing them by --allow-shrink", "source", source, "fetched", fetched, "stored", stored, "shrink(%)", percent)
+		return nil
+	}
+	log15.Error("Fetched fewer CPEs than the DB has, which may be of a truncated feed. Pass --allow-shrink to store them anyway",
+		"source", source, "fetched", fetched, "stored", stored, "shrink(%)", percent, "max-shrink(%)", g.maxPercent)
+	return xerrors.Errorf("Fetched %d CPEs of %s, %d%% fewer than %d in the DB: %w", fetched, source, percent, stored, errShrink)
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/sign"
+	"github.com/spf13/cobra"
+)
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate an Ed25519 key pair to sign the snapshots",
+	Long:  "Generate an Ed25519 key pair to sign the snapshots: <out>.key (PEM PKCS #8, keep it secret) and <out>.pub (PEM PKIX, publish it)",
+	RunE:  executeKeygen,
+}
+
+var signCmd = &cobra.Command{
+	Use:   "sign file...",
+	Short: "Sign snapshots of the dictionary, e.g. the SQLite DB, writing <file>.sig",
+	Long:  "Sign snapshots of the dictionary, e.g. the SQLite DB or the manifest of the raw feeds, writing <file>.sig",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  executeSign,
+}
+
+var verifySnapshotCmd = &cobra.Command{
+	Use:   "verify-snapshot file",
+	Short: "Verify a snapshot of the dictionary with its signature",
+	Long:  "Verify a snapshot of the dictionary with its signature, to prove it's the one published by the owner of the key",
+	Args:  cobra.ExactArgs(1),
+	RunE:  executeVerifySnapshot,
+}
+
+func init() {
+	RootCmd.AddCommand(keygenCmd, signCmd, verifySnapshotCmd)
+
+	keygenCmd.Flags().String("out", "cpe", "prefix of the key files")
+	signCmd.Flags().String("key", "", "/path/to/private key generated by keygen")
+	_ = signCmd.MarkFlagRequired("key")
+	verifySnapshotCmd.Flags().String("pubkey", "", "/path/to/public key of the publisher")
+	_ = verifySnapshotCmd.MarkFlagRequired("pubkey")
+	verifySnapshotCmd.Flags().String("signature", "", "/path/to/signature (default: <file>.sig)")
+}
+
+func executeKeygen(cmd *cobra.Command, args []string) error {
+	out, err := cmd.Flags().GetString("out")
+	if err != nil {
+		return err
+	}
+	priv, pub, err := sign.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(out+".key", priv, 0600); err != nil {
+		return fmt.Errorf("Failed to write private key. err: %s", err)
+	}
+	if err := ioutil.WriteFile(out+".pub", pub, 0644); err != nil {
+		return fmt.Errorf("Failed to write public key. err: %s", err)
+	}
+	log15.Info("Generated key pair", "private", out+".key", "public", out+".pub")
+	return nil
+}
+
+func executeSign(cmd *cobra.Command, args []string) error {
+	path, err := cmd.Flags().GetString("key")
+	if err != nil {
+		return err
+	}
+	priv, err := sign.LoadPrivateKey(path)
+	if err != nil {
+		return err
+	}
+	for _, file := range args {
+		sigPath, err := sign.SignFile(file, priv)
+		if err != nil {
+			log15.Error("Failed to sign.", "file", file, "err", err)
+			return err
+		}
+		log15.Info("Signed", "file", file, "signature", sigPath)
+	}
+	return nil
+}
+
+func executeVerifySnapshot(cmd *cobra.Command, args []string) error {
+	pubPath, err := cmd.Flags().GetString("pubkey")
+	if err != nil {
+		return err
+	}
+	sigPath, err := cmd.Flags().GetString("signature")
+	if err != nil {
+		return err
+	}
+	if sigPath == "" {
+		sigPath = args[0] + sign.SignatureExt
+	}
+	pub, err := sign.LoadPublicKey(pubPath)
+	if err != nil {
+		return err
+	}
+	s, err := sign.VerifyFile(args[0], sigPath, pub)
+	if err != nil {
+		log15.Error("Failed to verify.", "file", args[0], "err", err)
+		return err
+	}
+	fmt.Printf("%s: OK (key ID: %s, sha256: %s, signed at: %s)\n", args[0], s.KeyID, s.SHA256, s.SignedAt.Format(time.RFC3339))
+	return nil
+}
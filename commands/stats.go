@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/server"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show statistics of the DB",
+	Long:  "Show statistics of the DB",
+	RunE:  executeStats,
+}
+
+var statsHotCmd = &cobra.Command{
+	Use:   "hot",
+	Short: "Show the most looked up vendor/products of a running server",
+	Long:  "Show the most looked up vendor/products of a running server started with --hot-products",
+	RunE:  executeStatsHot,
+}
+
+var statsAttributesCmd = &cobra.Command{
+	Use:   "attributes",
+	Short: "Show the distinct and the top values of the WFN attributes",
+	Long:  "Show the number of distinct values and the values of the most CPEs of the WFN attributes, e.g. target_sw",
+	RunE:  executeStatsAttributes,
+}
+
+func init() {
+	RootCmd.AddCommand(statsCmd)
+	statsCmd.AddCommand(statsHotCmd)
+	statsCmd.AddCommand(statsAttributesCmd)
+
+	statsHotCmd.Flags().String("server-url", "http://127.0.0.1:1328", "URL of the server")
+	statsAttributesCmd.Flags().String("attributes", "target_sw,sw_edition,language", "comma separated WFN attributes, e.g. part,vendor,product,version,update,edition,language,sw_edition,target_sw,target_hw,other")
+	statsAttributesCmd.Flags().Int("top", 10, "number of the top values of each attribute, 0 for all")
+}
+
+func executeStats(cmd *cobra.Command, args []string) error {
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		log15.Error("Failed to get FetchMeta from DB.", "err", err)
+		return err
+	}
+	histories, err := driver.GetLatestFetchHistories()
+	if err != nil {
+		log15.Error("Failed to get FetchHistory from DB.", "err", err)
+		return err
+	}
+	vendorProducts, err := driver.GetVendorProducts()
+	if err != nil {
+		log15.Error("Failed to get vendor products.", "err", err)
+		return err
+	}
+
+	fmt.Printf("DB type: %s\n", driver.Name())
+	fmt.Printf("Schema version: %d\n", fetchMeta.SchemaVersion)
+	fmt.Printf("Last fetched at: %s\n", fetchMeta.LastFetchedAt.Format(time.RFC3339))
+	printDictionaryStamp(fetchMeta)
+	fmt.Printf("Vendor/products: %d\n", len(vendorProducts))
+	for _, h := range histories {
+		version := ""
+		if h.DataVersion != "" {
+			version = fmt.Sprintf(", data version %s", h.DataVersion)
+		}
+		fmt.Printf("Last fetch of %s: %s (took %s), %d CPEs%s\n", h.FetchType, h.FinishedAt.Format(time.RFC3339), h.Duration().Round(time.Second), h.CPEs, version)
+	}
+	return nil
+}
+
+func executeStatsHot(cmd *cobra.Command, args []string) error {
+	serverURL, err := cmd.Flags().GetString("server-url")
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(serverURL, "/") + "/metrics"
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return xerrors.Errorf("Failed to get the metrics. url: %s, err: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("Failed to get the metrics. url: %s, status code: %d", url, resp.StatusCode)
+	}
+	var metrics struct {
+		HotProducts []server.HotProduct `json:"hot_products"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return xerrors.Errorf("Failed to decode the metrics. url: %s, err: %w", url, err)
+	}
+
+	if len(metrics.HotProducts) == 0 {
+		log15.Info("No lookups are counted. Start the server with --hot-products to count them.")
+		return nil
+	}
+	for _, h := range metrics.HotProducts {
+		fmt.Printf("%d\t%s\n", h.Count, h.VendorProduct)
+	}
+	return nil
+}
+
+func executeStatsAttributes(cmd *cobra.Command, args []string) error {
+	param, err := cmd.Flags().GetString("attributes")
+	if err != nil {
+		return err
+	}
+	top, err := cmd.Flags().GetInt("top")
+	if err != nil {
+		return err
+	}
+	attributes := []string{}
+	for _, a := range strings.Split(param, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			attributes = append(attributes, a)
+		}
+	}
+
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	stats, err := driver.GetAttributeStats(attributes, top)
+	if err != nil {
+		log15.Error("Failed to get the attribute statistics.", "err", err)
+		return err
+	}
+	for _, s := range stats {
+		fmt.Printf("%s: %d distinct values\n", s.Attribute, s.Distinct)
+		for _, v := range s.Top {
+			fmt.Printf("\t%d\t%s\n", v.CPEs, v.Value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
+)
+
+func addSwapFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().Bool("into-temp-then-swap", false, "fetch into a temporary copy of the sqlite3 DB and rename it over --dbpath on success, so that the readers never see a partial fetch")
+}
+
+// newFetchDB opens the DB to fetch into and returns swap, to be called with the result of the fetch.
+// With --into-temp-then-swap, the DB is a copy of the sqlite3 DB next to it, and swap renames it over the DB on success
+// and removes it on failure. Otherwise the DB is --dbpath and swap returns the result as is.
+func newFetchDB(cmd *cobra.Command) (db.DB, func(error) error, error) {
+	intoTemp, err := cmd.Flags().GetBool("into-temp-then-swap")
+	if err != nil {
+		return nil, nil, err
+	}
+	if !intoTemp {
+		driver, err := newDB()
+		return driver, func(err error) error { return err }, err
+	}
+
+	dbType := resolveDBType()
+	if dbType != "sqlite3" {
+		return nil, nil, xerrors.Errorf("--into-temp-then-swap supports only sqlite3, not %s", dbType)
+	}
+	dbPath := viper.GetString("dbpath")
+	tmpPath := dbPath + ".swap"
+	removeSqlite3(tmpPath)
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := db.Snapshot(dbType, dbPath, tmpPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	driver, err := newDBAt(tmpPath)
+	if err != nil {
+		removeSqlite3(tmpPath)
+		return nil, nil, err
+	}
+	log15.Info("Fetching into the temporary copy of the DB", "path", tmpPath)
+
+	swap := func(err error) error {
+		if cerr := driver.CloseDB(); err == nil && cerr != nil {
+			err = xerrors.Errorf("Failed to close the temporary copy of the DB. err: %w", cerr)
+		}
+		if err != nil {
+			removeSqlite3(tmpPath)
+			return err
+		}
+		// the readers having the DB open keep reading the old file, and the ones opening it afterwards read the new one
+		if err := os.Rename(tmpPath, dbPath); err != nil {
+			removeSqlite3(tmpPath)
+			return xerrors.Errorf("Failed to swap the DB. path: %s, err: %w", dbPath, err)
+		}
+		log15.Info("Swapped the DB", "path", dbPath)
+		return nil
+	}
+	return driver, swap, nil
+}
+
+// removeSqlite3 removes the sqlite3 DB at the path with its journal
+func removeSqlite3(path string) {
+	for _, p := range []string{path, path + "-journal"} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log15.Warn("Failed to remove.", "path", p, "err", err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/fixture"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+var testdataCmd = &cobra.Command{
+	Use:   "testdata",
+	Short: "Generate a small deterministic dictionary for integration tests",
+	Long:  "Generate a small deterministic dictionary of a few hundred representative CPEs, including deprecated CPEs, Japanese titles and quoted punctuation, into the DB or to a file",
+	RunE:  generateTestdata,
+}
+
+func init() {
+	RootCmd.AddCommand(testdataCmd)
+
+	testdataCmd.PersistentFlags().Bool("stdout", false, "display all CPEs to stdout")
+	addOutputFlags(testdataCmd)
+}
+
+func generateTestdata(cmd *cobra.Command, args []string) error {
+	outOpt, err := outputOption(cmd)
+	if err != nil {
+		return err
+	}
+	cpes, err := fixture.CPEs()
+	if err != nil {
+		return err
+	}
+	if outOpt != nil {
+		if err := dumpCpes(*outOpt, cpes); err != nil {
+			log15.Error("Failed to write CPEs.", "err", err)
+			return err
+		}
+		return nil
+	}
+
+	log15.Info("Initialize Database")
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
+		return err
+	}
+	if err := retryOnLocked("insert", func() error { return driver.InsertCpes(cpes) }); err != nil {
+		log15.Error("Failed to insert.", "err", err)
+		return xerrors.Errorf("Failed to insert cpes. err : %w", err)
+	}
+
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		log15.Error("Failed to get FetchMeta from DB.", "err", err)
+		return err
+	}
+	// fixed, so that the DB is the same on every run
+	fetchedAt := fixture.FetchedAt
+	fetchMeta.LastFetchedAt = fetchedAt
+	fetchMeta.Generation++
+	fetchMeta.NVDDictVersion = fixture.Version
+	fetchMeta.NVDDictGeneratedAt = &fetchedAt
+	if err := retryOnLocked("upsert FetchMeta", func() error { return driver.UpsertFetchMeta(fetchMeta) }); err != nil {
+		log15.Error("Failed to upsert FetchMeta to DB.", "err", err)
+		return err
+	}
+	loadDistroPackages(driver)
+	saveSearchIndex(driver)
+	log15.Info(fmt.Sprintf("Inserted %d CPEs", len(cpes)))
+	return nil
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spf13/cobra"
+)
+
+// timeoutGrace is how long a command may keep running after its --timeout, to return the error of the context,
+// before the process is killed by itself
+const timeoutGrace = 30 * time.Second
+
+// deadline is when the running command times out by --timeout, zero when it doesn't.
+// It bounds the DB operations outside the context: opening the DB and the retries on the locks.
+var deadline time.Time
+
+// addTimeoutFlags adds --timeout to cmd
+func addTimeoutFlags(cmd *cobra.Command, usage string) {
+	cmd.PersistentFlags().Duration("timeout", 0, usage)
+}
+
+// timeoutContext returns the context bounded by --timeout of cmd.
+// If the command is still running timeoutGrace after the timeout, e.g. blocked in a DB call,
+// the process exits with ExitTimeout, so a hung cron job doesn't hold the SQLite lock.
+func timeoutContext(cmd *cobra.Command) (context.Context, context.CancelFunc, error) {
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return nil, nil, err
+	}
+	if timeout <= 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		return ctx, cancel, nil
+	}
+
+	deadline = time.Now().Add(timeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	watchdog := time.AfterFunc(timeout+timeoutGrace, func() {
+		log15.Crit("Timed out. Exiting", "timeout", timeout)
+		os.Exit(ExitTimeout)
+	})
+	return ctx, func() {
+		watchdog.Stop()
+		cancel()
+	}, nil
+}
+
+// untilDeadline returns the time left until the deadline of the command, 0 when it has no deadline
+func untilDeadline() time.Duration {
+	if deadline.IsZero() {
+		return 0
+	}
+	if d := time.Until(deadline); 0 < d {
+		return d
+	}
+	// already timed out, the shortest wait
+	return time.Nanosecond
+}
@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+// insertChangedCpes inserts the CPEs of the source unless they're the same as those of its last fetch,
+// and returns their hash to be stored by FetchMeta.SetSourceHash.
+// With replace, for a complete fetch of the source, the CPEs of the source missing from them are removed.
+// The inserted CPEs are stamped by the generation the fetch increments FetchMeta to.
+// Skipping the same CPEs saves rewriting all of them, e.g. the binlog of MySQL replicas.
+func insertChangedCpes(driver db.DB, source models.FetchType, cpes []models.CategorizedCpe, replace bool) (string, error) {
+	hash := models.HashCpes(cpes)
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return "", xerrors.Errorf("Failed to get FetchMeta from DB. err: %w", err)
+	}
+	if fetchMeta.SourceHash(source) == hash {
+		// the CPEs may have been deleted since, e.g. by truncating the partition of the source
+		if count, err := driver.CountCpes(source); err == nil && 0 < count {
+			log15.Info("No changes since the last fetch. Skip inserting", "source", source, "hash", hash)
+			return hash, nil
+		}
+	}
+	// stamped by the generation of this fetch, for the delta export of the changed CPEs
+	changedAt := time.Now()
+	for i := range cpes {
+		cpes[i].Generation, cpes[i].ChangedAt = fetchMeta.Generation+1, &changedAt
+	}
+	insert := func() error { return driver.InsertCpes(cpes) }
+	if replace {
+		insert = func() error { return driver.ReplaceCpes(source, cpes) }
+	}
+	if err := retryOnLocked("insert", insert); err != nil {
+		return "", xerrors.Errorf("Failed to insert cpes. err : %w", err)
+	}
+	return hash, nil
+}
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/fetcher"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Compare the number of CPEs in the DB with the sources",
+	Long:  "Compare the number of CPEs in the DB with the sources to find truncated or failed fetches",
+	RunE:  executeVerify,
+}
+
+func init() {
+	RootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.PersistentFlags().String("sources", "nvd,jvn", "comma separated sources to verify")
+	verifyCmd.PersistentFlags().String("filter-vendors", "", "/path/to/file listing the vendors passed to fetchnvd --filter-vendors (default: all vendors)")
+}
+
+func executeVerify(cmd *cobra.Command, args []string) (err error) {
+	param, err := cmd.Flags().GetString("sources")
+	if err != nil {
+		return err
+	}
+	sources, err := models.ParseFetchTypes(param)
+	if err != nil {
+		return err
+	}
+
+	var vendors fetcher.VendorFilter
+	path, err := cmd.Flags().GetString("filter-vendors")
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		if vendors, err = fetcher.LoadVendorFilter(path); err != nil {
+			log15.Error("Failed to load vendor filter.", "err", err)
+			return err
+		}
+	}
+
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := checkSchemaVersion(driver); err != nil {
+		log15.Error("Failed to check the schema version.", "err", err)
+		return err
+	}
+
+	truncated := []models.FetchType{}
+	for _, source := range sources {
+		var cpes []models.CategorizedCpe
+		switch source {
+		case models.NVD:
+			cpes, err = fetcher.FetchNVD(context.Background(), fetcher.NVDOption{Vendors: vendors})
+		case models.JVN:
+			cpes, err = fetcher.FetchJVN(context.Background())
+		case models.Windows:
+			cpes, err = fetcher.FetchWindows(context.Background())
+		}
+		if err != nil {
+			log15.Error("Failed to fetch.", "source", source, "err", err)
+			return err
+		}
+		upstream := map[string]bool{}
+		for _, c := range cpes {
+			upstream[c.CpeURI] = true
+		}
+
+		count, err := driver.CountCpes(source)
+		if err != nil {
+			log15.Error("Failed to count CPEs.", "source", source, "err", err)
+			return err
+		}
+
+		fmt.Printf("%s: source %d, DB %d, diff %+d\n", source, len(upstream), count, count-len(upstream))
+		switch {
+		case count < len(upstream):
+			log15.Error("The DB has fewer CPEs than the source. The fetch may have been truncated or failed.", "source", source)
+			truncated = append(truncated, source)
+		case len(upstream) < count:
+			log15.Warn("The DB has more CPEs than the source. CPEs removed from the source are kept until the DB is rebuilt.", "source", source)
+		}
+	}
+
+	if 0 < len(truncated) {
+		return fmt.Errorf("The DB has fewer CPEs than the sources: %v", truncated)
+	}
+	return nil
+}
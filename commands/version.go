@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/config"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/spf13/cobra"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show version",
+	Long:  "Show version of go-cpe-dictionary and the NVD CPE dictionary in the DB",
+	RunE:  executeVersion,
+}
+
+func init() {
+	RootCmd.AddCommand(versionCmd)
+}
+
+func executeVersion(cmd *cobra.Command, args []string) error {
+	fmt.Printf("go-cpe-dictionary %s %s\n", config.Version, config.Revision)
+
+	driver, err := newDB()
+	if err != nil {
+		log15.Warn("Failed to open DB. Skip showing the dictionary version", "err", err)
+		return nil
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		log15.Error("Failed to get FetchMeta from DB.", "err", err)
+		return err
+	}
+	printDictionaryStamp(fetchMeta)
+	return nil
+}
+
+// printDictionaryStamp prints the version and generation time of the NVD CPE dictionary
+func printDictionaryStamp(fetchMeta *models.FetchMeta) {
+	if fetchMeta.NVDDictGeneratedAt == nil {
+		fmt.Println("NVD CPE dictionary: not fetched")
+		return
+	}
+	fmt.Printf("NVD CPE dictionary: %s (generated at %s)\n", fetchMeta.NVDDictVersion, fetchMeta.NVDDictGeneratedAt.Format(time.RFC3339))
+}
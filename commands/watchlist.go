@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/watch"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+var watchlistCmd = &cobra.Command{
+	Use:   "watchlist",
+	Short: "Manage the vendor/products checked for new versions and deprecations after every fetch",
+	Long:  "Manage the vendor/products checked for new versions and deprecations after every fetch",
+}
+
+var watchlistAddCmd = &cobra.Command{
+	Use:   "add vendor::product...",
+	Short: "Watch vendor/products",
+	Long:  "Watch vendor/products. What they have now is the baseline of the next check",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  executeWatchlistAdd,
+}
+
+var watchlistRemoveCmd = &cobra.Command{
+	Use:   "remove vendor::product...",
+	Short: "Stop watching vendor/products",
+	Long:  "Stop watching vendor/products",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  executeWatchlistRemove,
+}
+
+var watchlistListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the watched vendor/products",
+	Long:  "List the watched vendor/products",
+	RunE:  executeWatchlistList,
+}
+
+var watchlistChangesCmd = &cobra.Command{
+	Use:   "changes",
+	Short: "List the changes of the watched vendor/products",
+	Long:  "List the changes of the watched vendor/products",
+	RunE:  executeWatchlistChanges,
+}
+
+func init() {
+	RootCmd.AddCommand(watchlistCmd)
+	watchlistCmd.AddCommand(watchlistAddCmd, watchlistRemoveCmd, watchlistListCmd, watchlistChangesCmd)
+
+	watchlistChangesCmd.Flags().Duration("since", 7*24*time.Hour, "list the changes detected within the duration")
+}
+
+// addWatchFlags adds the flags of the watchlist check run after the fetch of cmd
+func addWatchFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("webhook-url", "", "URL to POST the changes of the watched vendor/products to as JSON after the fetch (default: no notification)")
+}
+
+// checkWatchlist checks the watchlist after a fetch and posts the changes to webhookURL.
+// A failure is only logged, since the CPEs are already stored.
+func checkWatchlist(ctx context.Context, driver db.DB, webhookURL string) {
+	changes, err := watch.Check(driver)
+	if err != nil {
+		log15.Warn("Failed to check the watchlist.", "err", err)
+		return
+	}
+	for _, c := range changes {
+		log15.Info("Watched product changed", "vendor", c.Vendor, "product", c.Product, "kind", c.Kind, "value", c.Value)
+	}
+	if webhookURL == "" || len(changes) == 0 {
+		return
+	}
+	if err := watch.Notify(ctx, webhookURL, changes); err != nil {
+		log15.Warn("Failed to notify the changes of the watchlist.", "err", err)
+	}
+}
+
+func executeWatchlistAdd(cmd *cobra.Command, args []string) error {
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	for _, arg := range args {
+		vendor, product, err := watch.ParseVendorProduct(arg)
+		if err != nil {
+			return err
+		}
+		if err := watch.Add(driver, vendor, product); err != nil {
+			log15.Error("Failed to watch.", "vendor::product", arg, "err", err)
+			return err
+		}
+		recordAudit(driver, models.AuditWatch, arg, 1, "")
+		log15.Info("Watching", "vendor::product", arg)
+	}
+	return nil
+}
+
+func executeWatchlistRemove(cmd *cobra.Command, args []string) error {
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	for _, arg := range args {
+		vendor, product, err := watch.ParseVendorProduct(arg)
+		if err != nil {
+			return err
+		}
+		deleted, err := driver.DeleteWatchedProduct(vendor, product)
+		if err != nil {
+			log15.Error("Failed to stop watching.", "vendor::product", arg, "err", err)
+			return err
+		}
+		if !deleted {
+			return xerrors.Errorf("Not watched: %s", arg)
+		}
+		recordAudit(driver, models.AuditUnwatch, arg, 1, "")
+		log15.Info("Stopped watching", "vendor::product", arg)
+	}
+	return nil
+}
+
+func executeWatchlistList(cmd *cobra.Command, args []string) error {
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	watchlist, err := driver.GetWatchlist()
+	if err != nil {
+		log15.Error("Failed to get the watchlist.", "err", err)
+		return err
+	}
+	fmt.Println("vendor\tproduct\tchecked at")
+	for _, w := range watchlist {
+		fmt.Printf("%s\t%s\t%s\n", w.Vendor, w.Product, w.CheckedAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func executeWatchlistChanges(cmd *cobra.Command, args []string) error {
+	since, err := cmd.Flags().GetDuration("since")
+	if err != nil {
+		return err
+	}
+	driver, err := newDB()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	changes, err := driver.GetWatchChanges(time.Now().Add(-since))
+	if err != nil {
+		log15.Error("Failed to get the changes of the watchlist.", "err", err)
+		return err
+	}
+	fmt.Println("detected at\tvendor\tproduct\tkind\tvalue")
+	for _, c := range changes {
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", c.DetectedAt.Format(time.RFC3339), c.Vendor, c.Product, c.Kind, c.Value)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package db
+
+import (
+	"time"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+// ErrNoHistory is returned by the queries as of a past time on the DBs not tracking the history of the CPEs, all but the RDB
+var ErrNoHistory = xerrors.New("the history of the CPEs is tracked by the RDB only")
+
+// deprecatedAsOf returns the CPEs as they were at asOf: those deprecated after it are active, without the CPEs replacing them.
+// The CPEs deprecated before the history was tracked stay deprecated.
+func deprecatedAsOf(cpes []models.CategorizedCpe, asOf time.Time) []models.CategorizedCpe {
+	for i, c := range cpes {
+		if c.Deprecated && c.DeprecatedAt != nil && c.DeprecatedAt.After(asOf) {
+			cpes[i].Deprecated, cpes[i].DeprecatedBy = false, ""
+		}
+	}
+	return cpes
+}
@@ -0,0 +1,91 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+func TestAsOfSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	added := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	deprecated := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	if err := driver.InsertCpes([]models.CategorizedCpe{
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.8", Part: "a", Vendor: "ntp", Product: "ntp", Version: "4\\.2\\.8", FetchType: models.NVD, ChangedAt: &added},
+	}); err != nil {
+		t.Fatalf("InsertCpes: %s", err)
+	}
+	if err := driver.InsertCpes([]models.CategorizedCpe{
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.8", Part: "a", Vendor: "ntp", Product: "ntp", Version: "4\\.2\\.8", FetchType: models.NVD, Deprecated: true, DeprecatedBy: "cpe:/a:ntp:ntp:4.2.8:p1", ChangedAt: &deprecated},
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.8:p1", Part: "a", Vendor: "ntp", Product: "ntp", Version: "4\\.2\\.8", Update: "p1", FetchType: models.NVD, ChangedAt: &deprecated},
+	}); err != nil {
+		t.Fatalf("InsertCpes: %s", err)
+	}
+
+	var tests = []struct {
+		asOf       time.Time
+		products   []string
+		active     []string
+		deprecated []string
+	}{
+		// before the CPEs were added
+		{
+			asOf:     added.Add(-time.Hour),
+			products: []string{},
+		},
+		// added, not deprecated yet
+		{
+			asOf:     deprecated.Add(-time.Hour),
+			products: []string{"ntp::ntp"},
+			active:   []string{"cpe:/a:ntp:ntp:4.2.8"},
+		},
+		// deprecated by the one added at the same time
+		{
+			asOf:       deprecated,
+			products:   []string{"ntp::ntp"},
+			active:     []string{"cpe:/a:ntp:ntp:4.2.8:p1"},
+			deprecated: []string{"cpe:/a:ntp:ntp:4.2.8"},
+		},
+	}
+	for i, tt := range tests {
+		products, err := driver.GetVendorProductsAsOf(tt.asOf)
+		if err != nil {
+			t.Fatalf("[%d] GetVendorProductsAsOf: %s", i, err)
+		}
+		if len(products) != len(tt.products) || (0 < len(products) && !reflect.DeepEqual(products, tt.products)) {
+			t.Errorf("[%d] products: actual %v, expected %v", i, products, tt.products)
+		}
+
+		details, err := driver.GetCpeDetailsAsOf("ntp", "ntp", tt.asOf)
+		if err != nil {
+			t.Fatalf("[%d] GetCpeDetailsAsOf: %s", i, err)
+		}
+		active, deprecated := details.CpeURIs()
+		if len(active) != len(tt.active) || (0 < len(active) && !reflect.DeepEqual(active, tt.active)) {
+			t.Errorf("[%d] active: actual %v, expected %v", i, active, tt.active)
+		}
+		if len(deprecated) != len(tt.deprecated) || (0 < len(deprecated) && !reflect.DeepEqual(deprecated, tt.deprecated)) {
+			t.Errorf("[%d] deprecated: actual %v, expected %v", i, deprecated, tt.deprecated)
+		}
+	}
+}
+
+func TestAsOfNoHistory(t *testing.T) {
+	var driver DB = &RedisDriver{}
+	if _, err := driver.GetVendorProductsAsOf(time.Now()); !xerrors.Is(err, ErrNoHistory) {
+		t.Errorf("actual %v, expected ErrNoHistory", err)
+	}
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"hash/fnv"
+	"math"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+)
+
+// bloomBitsPerCpe and bloomHashes size the filter for about 1% of false positives
+const (
+	bloomBitsPerCpe = 10
+	bloomHashes     = 7
+)
+
+// CpeFilter is a bloom filter of the CPE URIs of a DB, active and deprecated.
+// MayContain is false for a CPE surely not in the DB, so that only the others are looked up in the DB
+type CpeFilter struct {
+	bits []uint64
+}
+
+// NewCpeFilter returns the filter of all the CPEs of driver
+func NewCpeFilter(driver DB) (*CpeFilter, error) {
+	vendorProducts, err := driver.GetVendorProducts()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get the vendor/products. err: %w", err)
+	}
+	cpes, err := loadAllCpes(driver, vendorProducts, log15.Root())
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to load the CPEs. err: %w", err)
+	}
+	f := newCpeFilter(len(cpes))
+	for _, c := range cpes {
+		f.Add(c.CpeURI)
+	}
+	return f, nil
+}
+
+// newCpeFilter returns an empty filter sized for n CPEs
+func newCpeFilter(n int) *CpeFilter {
+	words := int(math.Ceil(float64(n*bloomBitsPerCpe) / 64))
+	if words == 0 {
+		words = 1
+	}
+	return &CpeFilter{bits: make([]uint64, words)}
+}
+
+// Add adds the CPE URI to the filter
+func (f *CpeFilter) Add(cpeURI string) {
+	h1, h2 := bloomHash(cpeURI)
+	m := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain is false when the CPE URI is surely not in the filter
+func (f *CpeFilter) MayContain(cpeURI string) bool {
+	h1, h2 := bloomHash(cpeURI)
+	m := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHash returns the two hashes of s combined into the bloomHashes positions (Kirsch and Mitzenmacher)
+func bloomHash(s string) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	h1 := h.Sum64()
+	_, _ = h.Write([]byte{0})
+	// odd, so that the positions don't repeat when m is a power of 2
+	return h1, h.Sum64() | 1
+}
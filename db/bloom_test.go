@@ -0,0 +1,34 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCpeFilter(t *testing.T) {
+	const n = 10000
+	f := newCpeFilter(n)
+	for i := 0; i < n; i++ {
+		f.Add(fmt.Sprintf("cpe:/a:vendor%d:product:%d", i%100, i))
+	}
+	for i := 0; i < n; i++ {
+		if cpeURI := fmt.Sprintf("cpe:/a:vendor%d:product:%d", i%100, i); !f.MayContain(cpeURI) {
+			t.Fatalf("%s is added but not in the filter", cpeURI)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.MayContain(fmt.Sprintf("cpe:/a:other%d:product:%d", i%100, i)) {
+			falsePositives++
+		}
+	}
+	// about 1%, with a margin
+	if n*3/100 < falsePositives {
+		t.Errorf("%d false positives of %d", falsePositives, n)
+	}
+
+	if newCpeFilter(0).MayContain("cpe:/a:ntp:ntp:4.2.8") {
+		t.Errorf("an empty filter contains a CPE")
+	}
+}
@@ -0,0 +1,322 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+// contractTests are the behaviors every driver must share, run against a fresh DB each.
+// The per-method tests of common_test.go cover the usual data, these the edges.
+var contractTests = []struct {
+	name string
+	test func(t *testing.T, driver DB)
+}{
+	{name: "empty DB", test: testContractEmpty},
+	{name: "unicode vendor", test: testContractUnicode},
+	{name: "huge product", test: testContractHugeProduct},
+	{name: "deprecation", test: testContractDeprecation},
+	{name: "integrity", test: testContractIntegrity},
+}
+
+// testContract runs contractTests against the DBs opened by open
+func testContract(t *testing.T, open func(tb testing.TB) DB) {
+	for _, tt := range contractTests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+// testContractEmpty calls every read of a DB never fetched, which finds nothing without an error
+func testContractEmpty(t *testing.T, driver DB) {
+	for name, read := range map[string]func() (int, error){
+		"GetVendorProducts": func() (int, error) {
+			vps, err := driver.GetVendorProducts()
+			return len(vps), err
+		},
+		"GetVendorProductsByPopularity": func() (int, error) {
+			vps, err := driver.GetVendorProductsByPopularity()
+			return len(vps), err
+		},
+		"GetVendorProductTitles": func() (int, error) {
+			titles, err := driver.GetVendorProductTitles()
+			return len(titles), err
+		},
+		"GetProductSummaries": func() (int, error) {
+			summaries, err := driver.GetProductSummaries()
+			return len(summaries), err
+		},
+		"GetCpesByVendorProduct": func() (int, error) {
+			cpeURIs, deprecated, err := driver.GetCpesByVendorProduct("ntp", "ntp")
+			return len(cpeURIs) + len(deprecated), err
+		},
+		"GetCpeDetailsByVendorProduct": func() (int, error) {
+			details, err := driver.GetCpeDetailsByVendorProduct("ntp", "ntp")
+			if err != nil {
+				return 0, err
+			}
+			return len(details.Active) + len(details.Deprecated), nil
+		},
+		"GetSourcedCpesByVendorProduct": func() (int, error) {
+			cpes, err := driver.GetSourcedCpesByVendorProduct("ntp", "ntp", nil)
+			return len(cpes), err
+		},
+		"GetProductsByVersion": func() (int, error) {
+			vps, err := driver.GetProductsByVersion("4.2.8")
+			return len(vps), err
+		},
+		"GetVersionsByVendorProduct": func() (int, error) {
+			versions, err := driver.GetVersionsByVendorProduct("ntp", "ntp", "", "")
+			return len(versions), err
+		},
+		"CountCpes": func() (int, error) {
+			return driver.CountCpes(models.NVD)
+		},
+		"GetAttributeStats": func() (int, error) {
+			stats, err := driver.GetAttributeStats([]string{"vendor"}, 3)
+			if err != nil || len(stats) != 1 {
+				return len(stats), err
+			}
+			return stats[0].Distinct, nil
+		},
+		"IsDeprecated": func() (int, error) {
+			deprecated, err := driver.IsDeprecated("cpe:/a:ntp:ntp:4.2.8")
+			if deprecated {
+				return 1, err
+			}
+			return 0, err
+		},
+		"GetCpeByNameID": func() (int, error) {
+			cpe, err := driver.GetCpeByNameID("87316812-5F2C-4286-94FE-CC98B9EAEF53")
+			if cpe != nil {
+				return 1, err
+			}
+			return 0, err
+		},
+		"GetDistroPackages": func() (int, error) {
+			packages, err := driver.GetDistroPackages("debian", "ntp")
+			return len(packages), err
+		},
+		"GetCpesByDistroPackage": func() (int, error) {
+			cpeURIs, deprecated, err := driver.GetCpesByDistroPackage("debian", "ntp")
+			return len(cpeURIs) + len(deprecated), err
+		},
+		"GetKnownExploited": func() (int, error) {
+			products, err := driver.GetKnownExploited()
+			return len(products), err
+		},
+		"GetLatestFetchHistories": func() (int, error) {
+			histories, err := driver.GetLatestFetchHistories()
+			return len(histories), err
+		},
+		"GetWatchlist": func() (int, error) {
+			watchlist, err := driver.GetWatchlist()
+			return len(watchlist), err
+		},
+		"GetWatchChanges": func() (int, error) {
+			changes, err := driver.GetWatchChanges(time.Time{})
+			return len(changes), err
+		},
+		"GetRejectedCpes": func() (int, error) {
+			rejects, err := driver.GetRejectedCpes("")
+			return len(rejects), err
+		},
+	} {
+		n, err := read()
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if n != 0 {
+			t.Errorf("%s: actual %d, expected nothing found", name, n)
+		}
+	}
+
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		t.Fatalf("GetFetchMeta: %s", err)
+	}
+	// a DB never fetched was last fetched in the year 1000
+	if fetchMeta.SchemaVersion != models.LatestSchemaVersion || fetchMeta.LastFetchedAt.Year() != 1000 {
+		t.Errorf("actual %#v, expected the FetchMeta of a new DB", fetchMeta)
+	}
+	if deleted, err := driver.DeleteWatchedProduct("ntp", "ntp"); err != nil || deleted {
+		t.Errorf("actual %t, %v, expected not found", deleted, err)
+	}
+}
+
+// testContractUnicode stores the vendors and the products of the JVN, which may be in Japanese, as they are
+func testContractUnicode(t *testing.T, driver DB) {
+	if err := driver.InsertCpes([]models.CategorizedCpe{
+		{FetchType: models.JVN, CpeURI: "cpe:/a:サイボウズ:ガルーン:4.0", Vendor: "サイボウズ", Product: "ガルーン", Version: `4\.0`, Title: "サイボウズ ガルーン"},
+		{FetchType: models.JVN, CpeURI: "cpe:/a:サイボウズ:ガルーン:5.0", Vendor: "サイボウズ", Product: "ガルーン", Version: `5\.0`, Title: "サイボウズ ガルーン"},
+		{FetchType: models.JVN, CpeURI: "cpe:/a:サイボウズ:オフィス:10.0", Vendor: "サイボウズ", Product: "オフィス", Version: `10\.0`},
+	}); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	vendorProducts, err := driver.GetVendorProducts()
+	if err != nil {
+		t.Fatalf("GetVendorProducts: %s", err)
+	}
+	if !containsAll(vendorProducts, "サイボウズ::ガルーン", "サイボウズ::オフィス") || len(vendorProducts) != 2 {
+		t.Errorf("actual %#v", vendorProducts)
+	}
+
+	cpeURIs, deprecated, err := driver.GetCpesByVendorProduct("サイボウズ", "ガルーン")
+	if err != nil {
+		t.Fatalf("GetCpesByVendorProduct: %s", err)
+	}
+	if !containsAll(cpeURIs, "cpe:/a:サイボウズ:ガルーン:4.0", "cpe:/a:サイボウズ:ガルーン:5.0") || len(cpeURIs) != 2 || len(deprecated) != 0 {
+		t.Errorf("actual %#v, %#v", cpeURIs, deprecated)
+	}
+
+	sourced, err := driver.GetSourcedCpesByVendorProduct("サイボウズ", "オフィス", []models.FetchType{models.JVN})
+	if err != nil {
+		t.Fatalf("GetSourcedCpesByVendorProduct: %s", err)
+	}
+	if len(sourced) != 1 || sourced[0].CpeURI != "cpe:/a:サイボウズ:オフィス:10.0" {
+		t.Errorf("actual %#v", sourced)
+	}
+
+	titles, err := driver.GetVendorProductTitles()
+	if err != nil {
+		t.Fatalf("GetVendorProductTitles: %s", err)
+	}
+	if titles["サイボウズ::ガルーン"] != "サイボウズ ガルーン" || len(titles) != 1 {
+		t.Errorf("actual %#v", titles)
+	}
+
+	if count, err := driver.CountCpes(models.JVN); err != nil || count != 3 {
+		t.Errorf("actual %d, %v, expected 3", count, err)
+	}
+}
+
+// testContractHugeProduct reads a product of more CPEs than a page or a batch of any driver
+func testContractHugeProduct(t *testing.T, driver DB) {
+	const n = 1200
+	cpes := make([]models.CategorizedCpe, 0, n)
+	for i := 0; i < n; i++ {
+		cpes = append(cpes, models.CategorizedCpe{
+			FetchType: models.NVD,
+			CpeURI:    fmt.Sprintf("cpe:/a:linux:linux_kernel:5.%d", i),
+			Vendor:    "linux",
+			Product:   "linux_kernel",
+			Version:   fmt.Sprintf(`5\.%d`, i),
+		})
+	}
+	if err := driver.InsertCpes(cpes); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	cpeURIs, deprecated, err := driver.GetCpesByVendorProduct("linux", LikePattern("linux_kernel", false))
+	if err != nil {
+		t.Fatalf("GetCpesByVendorProduct: %s", err)
+	}
+	if len(cpeURIs) != n || len(deprecated) != 0 {
+		t.Errorf("actual %d, %d, expected %d CPEs", len(cpeURIs), len(deprecated), n)
+	}
+	if count, err := driver.CountCpes(models.NVD); err != nil || count != n {
+		t.Errorf("actual %d, %v, expected %d", count, err, n)
+	}
+
+	versions, err := driver.GetVersionsByVendorProduct("linux", "linux_kernel", "", "")
+	if err != nil {
+		t.Fatalf("GetVersionsByVendorProduct: %s", err)
+	}
+	if len(versions) != n || versions[0] != `5\.0` || versions[n-1] != fmt.Sprintf(`5\.%d`, n-1) {
+		t.Errorf("actual %d versions, expected %d in the order of the versions", len(versions), n)
+	}
+
+	summaries, err := driver.GetProductSummaries()
+	if err != nil {
+		t.Fatalf("GetProductSummaries: %s", err)
+	}
+	if len(summaries) != 1 || summaries[0].Vendor != "linux" || summaries[0].Product != "linux_kernel" || summaries[0].CPEs != n {
+		t.Errorf("actual %#v", summaries)
+	}
+}
+
+// testContractDeprecation reads the deprecation of a CPE alike by IsDeprecated and GetCpeDetailsByVendorProduct
+func testContractDeprecation(t *testing.T, driver DB) {
+	if err := driver.InsertCpes([]models.CategorizedCpe{
+		{FetchType: models.NVD, CpeURI: "cpe:/a:ntp:ntp:4.2.7", Vendor: "ntp", Product: "ntp", Version: `4\.2\.7`, Deprecated: true, DeprecatedBy: "cpe:/a:ntp:ntp:4.2.8"},
+		{FetchType: models.NVD, CpeURI: "cpe:/a:ntp:ntp:4.2.8", Vendor: "ntp", Product: "ntp", Version: `4\.2\.8`},
+	}); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	for cpeURI, expected := range map[string]bool{
+		"cpe:/a:ntp:ntp:4.2.7": true,
+		"cpe:/a:ntp:ntp:4.2.8": false,
+		"cpe:/a:ntp:ntp:4.2.9": false,
+	} {
+		deprecated, err := driver.IsDeprecated(cpeURI)
+		if err != nil {
+			t.Fatalf("IsDeprecated: %s", err)
+		}
+		if deprecated != expected {
+			t.Errorf("%s: actual %t, expected %t", cpeURI, deprecated, expected)
+		}
+	}
+
+	details, err := driver.GetCpeDetailsByVendorProduct("ntp", "ntp")
+	if err != nil {
+		t.Fatalf("GetCpeDetailsByVendorProduct: %s", err)
+	}
+	if len(details.Active) != 1 || details.Active[0].CpeURI != "cpe:/a:ntp:ntp:4.2.8" {
+		t.Errorf("actual %#v", details.Active)
+	}
+	if len(details.Deprecated) != 1 || details.Deprecated[0].CpeURI != "cpe:/a:ntp:ntp:4.2.7" {
+		t.Errorf("actual %#v", details.Deprecated)
+	}
+}
+
+// testContractIntegrity finds no issues in the CPEs inserted by InsertCpes, before and after GC
+func testContractIntegrity(t *testing.T, driver DB) {
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+	before, err := driver.GetVendorProducts()
+	if err != nil {
+		t.Fatalf("GetVendorProducts: %s", err)
+	}
+	if _, err := driver.GC(); err != nil {
+		t.Fatalf("GC: %s", err)
+	}
+	report, err := driver.CheckIntegrity(false)
+	if err != nil {
+		t.Fatalf("CheckIntegrity: %s", err)
+	}
+	if len(report.Issues) != 0 || report.Repaired != 0 {
+		t.Errorf("actual %#v, expected no issues", report)
+	}
+	after, err := driver.GetVendorProducts()
+	if err != nil {
+		t.Fatalf("GetVendorProducts: %s", err)
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("actual %#v, expected %#v kept by GC", after, before)
+	}
+}
+
+func containsAll(values []string, wanted ...string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, v := range values {
+			if v == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
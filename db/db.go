@@ -2,11 +2,119 @@ package db
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/inconshreveable/log15"
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/distro"
 	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
 )
 
+// ErrLocked is returned when an operation failed because the database is locked by another
+// connection or transaction (SQLite BUSY/LOCKED, MySQL lock wait timeout, Redis BUSY).
+// Check it with errors.Is; the operation may succeed when retried.
+var ErrLocked = xerrors.New("database is locked")
+
+// lockedError wraps a driver error caused by lock contention
+type lockedError struct {
+	err error
+}
+
+func (e *lockedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *lockedError) Unwrap() error {
+	return e.err
+}
+
+func (e *lockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// Supported DB dialects.
+const (
+	dialectSqlite3    = "sqlite3"
+	dialectMysql      = "mysql"
+	dialectPostgreSQL = "postgres"
+	dialectRedis      = "redis"
+	dialectDynamoDB   = "dynamodb"
+)
+
+// buildTags are the build tags excluding the driver of each dialect from the binary
+var buildTags = map[string]string{
+	dialectSqlite3:    "nosqlite",
+	dialectMysql:      "nomysql",
+	dialectPostgreSQL: "nopostgres",
+	dialectRedis:      "noredis",
+	dialectDynamoDB:   "nodynamodb",
+}
+
+// drivers are the constructors of the drivers compiled in, registered by the file of each dialect
+var drivers = map[string]func() DB{}
+
+// snapshotters write a consistent copy of the DB at the path to another path, registered by the file of each dialect supporting it
+var snapshotters = map[string]func(src, dst string) error{}
+
+// Snapshot writes a consistent copy of the DB of dbType at src to dst, even while the DB is written.
+// Only sqlite3 supports it.
+func Snapshot(dbType, src, dst string) error {
+	snapshot, ok := snapshotters[dbType]
+	if !ok {
+		return xerrors.Errorf("Snapshot is not supported by %s, only by sqlite3", dbType)
+	}
+	return snapshot(src, dst)
+}
+
+// Option is the option for opening the DB
+type Option struct {
+	// FastRead uses prepared raw SQL instead of GORM for the hot read queries (RDB only)
+	FastRead bool
+	// PrepareStmt prepares the multi-row INSERT of the full batches once per insert and reuses it (RDB only).
+	// gorm v1 has neither PrepareStmt nor SkipDefaultTransaction of gorm v2; the insert already runs in a single transaction.
+	PrepareStmt bool
+	// TablePrefix is prepended to the table names, e.g. to share the DB with other dictionaries (RDB only)
+	TablePrefix string
+	// BatchSize is the number of rows inserted by a statement (RDB only). 0 tunes it by the dialect.
+	BatchSize int
+	// DeleteBatchSize is the number of rows deleted by a statement, each committed on its own (RDB only). 0 is 500.
+	DeleteBatchSize int
+	// DeletePause is the pause between the delete statements, e.g. to let the replicas of MySQL catch up (RDB only)
+	DeletePause time.Duration
+	// Partition creates the CPE table partitioned by the source (PostgreSQL only)
+	Partition bool
+	// DebugSQL logs the SQL statements to Logger at the debug level (RDB only)
+	DebugSQL bool
+	// SlowQuery logs the SQL statements taking longer to Logger as warnings, even without DebugSQL (RDB only). 0 disables it.
+	SlowQuery time.Duration
+	// Timeout bounds connecting to the DB and, on sqlite3, waiting for a lock. 0 is the default of the driver.
+	Timeout time.Duration
+	// ReadOnly rejects the writes with ErrReadOnly
+	ReadOnly bool
+	// InMemory serves the reads of the CPEs from a snapshot of the DB in memory, reloaded by the writes through the driver
+	InMemory bool
+	// Logger receives the logs of the driver (default: the root logger of log15)
+	Logger log15.Logger
+	// Cache is the DB read first, e.g. redis://localhost/0 (tiered only)
+	Cache string
+	// Store is the DB of the source of truth, e.g. postgres://... (tiered only, default: dbPath)
+	Store string
+	// KeyTTL expires the keys of the CPEs of each vendor/product after the duration since they're written (redis only).
+	// 0 never expires them. The tiered driver applies it to its cache only, which refills them from the store on a miss.
+	KeyTTL time.Duration
+	// AllowEviction opens a redis whose maxmemory-policy may evict any key, only warning (redis only)
+	AllowEviction bool
+	// Threads bounds the workers binding the values of the batches of an insert (RDB) and reading the vendor/products found by a wildcard search (redis).
+	// 0 is the number of CPUs.
+	Threads int
+	// IAMAuth connects with a short-lived token of IAMAuthRDS or IAMAuthCloudSQL as the password (MySQL and PostgreSQL only)
+	IAMAuth string
+}
+
 // DB is interface for a database driver
 type DB interface {
 	Name() string
@@ -14,39 +122,350 @@ type DB interface {
 	CloseDB() error
 	MigrateDB() error
 
+	GetFetchMeta() (*models.FetchMeta, error)
+	UpsertFetchMeta(*models.FetchMeta) error
+	InsertFetchHistory(*models.FetchHistory) error
+	GetLatestFetchHistories() ([]models.FetchHistory, error)
+	// InsertAuditEntry records a data-modifying operation
+	InsertAuditEntry(*models.AuditEntry) error
+	// GetAuditEntries returns the operations at or after since, oldest first
+	GetAuditEntries(since time.Time) ([]models.AuditEntry, error)
+
+	GetWatchlist() ([]models.WatchedProduct, error)
+	UpsertWatchedProduct(*models.WatchedProduct) error
+	DeleteWatchedProduct(vendor, product string) (bool, error)
+	InsertWatchChanges([]models.WatchChange) error
+	GetWatchChanges(since time.Time) ([]models.WatchChange, error)
+
+	// ReplaceRejectedCpes replaces the rejected CPEs of the source
+	ReplaceRejectedCpes(source models.FetchType, rejects []models.RejectedCpe) error
+	// GetRejectedCpes returns the rejected CPEs of the source, or of all the sources when source is empty
+	GetRejectedCpes(source models.FetchType) ([]models.RejectedCpe, error)
+
 	GetVendorProducts() ([]string, error)
+	GetVendorProductsByPopularity() ([]string, error)
+	GetVendorProductTitles() (map[string]string, error)
+	GetProductSummaries() ([]models.ProductSummary, error)
+	// GetCpesByVendorProduct returns the URIs of the active and the deprecated CPEs of GetCpeDetailsByVendorProduct
 	GetCpesByVendorProduct(string, string) ([]string, []string, error)
+	// GetCpeDetailsByVendorProduct returns the CPEs of vendor/product split by the deprecation,
+	// the deprecated ones with the CPEs replacing them. Both are LIKE patterns on RDB, and on redis when either has a wildcard,
+	// where LikeEscape escapes a % or _ to match itself, e.g. by LikePattern.
+	GetCpeDetailsByVendorProduct(vendor, product string) (*models.CpeDetails, error)
+	GetSourcedCpesByVendorProduct(string, string, []models.FetchType) ([]models.SourcedCpe, error)
+	GetProductsByVersion(string) ([]string, error)
+	// GetVersionsByVendorProduct returns the versions of vendor/product between from and to in the order of versionOrdinal.
+	// An empty from or to doesn't bound the range.
+	GetVersionsByVendorProduct(vendor, product, from, to string) ([]string, error)
+	CountCpes(models.FetchType) (int, error)
+	// GetAttributeStats returns the number of distinct values and the top values of the WFN attributes, e.g. target_sw
+	GetAttributeStats(attributes []string, top int) ([]models.AttributeStat, error)
 	InsertCpes([]models.CategorizedCpe) error
+	// ReplaceCpes inserts the CPEs of a complete fetch of source, and removes the CPEs of source missing from it (RDB only).
+	// Redis and DynamoDB keep them, inserting the CPEs as InsertCpes does.
+	ReplaceCpes(source models.FetchType, cpes []models.CategorizedCpe) error
+	// GetCpesChangedSince returns the CPEs added or changed after generation and at or after since, all of them when both are zero.
+	// Only the RDB tracks the changes; the other drivers return an error.
+	GetCpesChangedSince(generation uint64, since time.Time) ([]models.CategorizedCpe, error)
+	// GetVendorProductsAsOf and GetCpeDetailsAsOf return the vendor/products and the CPEs as they were at asOf, for reproducing the past scans.
+	// The CPEs added or deprecated before the history was tracked are taken as they are now.
+	// Only the RDB tracks the history; the other drivers return ErrNoHistory.
+	GetVendorProductsAsOf(asOf time.Time) ([]string, error)
+	GetCpeDetailsAsOf(vendor, product string, asOf time.Time) (*models.CpeDetails, error)
 	IsDeprecated(string) (bool, error)
+	GetCpeByNameID(string) (*models.SourcedCpe, error)
+
+	InsertDistroPackages([]models.DistroPackage) error
+	GetDistroPackages(distro, pkg string) ([]models.DistroPackage, error)
+	GetCpesByDistroPackage(distro, pkg string) ([]string, []string, error)
+
+	// ReplaceKnownExploited replaces the vendor/products of the CISA Known Exploited Vulnerabilities catalog
+	ReplaceKnownExploited([]models.KnownExploitedProduct) error
+	GetKnownExploited() ([]models.KnownExploitedProduct, error)
+
+	GC() ([]GCStat, error)
+	CheckIntegrity(repair bool) (*IntegrityReport, error)
+}
+
+// Kinds of IntegrityIssue
+const (
+	// IssueDuplicate : more than one row of a CPE and a source
+	IssueDuplicate = "duplicate"
+	// IssueEmptyVendor : a CPE without the vendor or the product
+	IssueEmptyVendor = "empty_vendor"
+	// IssueMalformedURI : a CPE URI which can't be parsed
+	IssueMalformedURI = "malformed_uri"
+)
+
+// IntegrityIssue is a problem found by CheckIntegrity
+type IntegrityIssue struct {
+	Kind      string
+	CpeURI    string
+	FetchType models.FetchType
+	// Rows is the number of the rows (redis: members) in trouble, e.g. the extra rows of a duplicate
+	Rows int64
+}
+
+// IntegrityReport is the result of CheckIntegrity
+type IntegrityReport struct {
+	Issues []IntegrityIssue
+	// Repaired is the number of the rows (redis: members) fixed or removed by the repair
+	Repaired int64
+}
+
+// GCStat is what GC removed from a table (a key prefix on redis)
+type GCStat struct {
+	Table string
+	// Rows is the number of rows (redis: keys or members) removed
+	Rows int64
+	// Bytes is the space reclaimed, 0 when the DB can't tell
+	Bytes int64
+}
+
+// neverFetchedAt is the LastFetchedAt of the FetchMeta of a DB never fetched
+var neverFetchedAt = time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// fetched tells whether fetchMeta is of a DB fetched at least once
+func fetched(fetchMeta *models.FetchMeta) bool {
+	return !fetchMeta.LastFetchedAt.IsZero() && !fetchMeta.LastFetchedAt.Equal(neverFetchedAt)
 }
 
 // NewDB returns db driver
+//
+// Deprecated: Use Open, which takes the other options as OpenOption.
 func NewDB(dbType string, dbPath string, debugSQL bool) (driver DB, locked bool, err error) {
-	if driver, err = newDB(dbType); err != nil {
-		log15.Error("Failed to new db.", "err", err)
-		return driver, false, err
+	if driver, err = Open(dbType, dbPath, WithDebugSQL(debugSQL)); err != nil {
+		return nil, xerrors.Is(err, ErrLocked), err
+	}
+	return driver, false, nil
+}
+
+// DetectType infers the dbtype from dbPath: redis, dynamodb and postgres from the URL scheme,
+// mysql from the go-sql-driver DSN (user:pass@tcp(host:port)/dbname) and sqlite3 otherwise.
+func DetectType(dbPath string) string {
+	switch {
+	case strings.HasPrefix(dbPath, "redis://"), strings.HasPrefix(dbPath, "rediss://"):
+		return dialectRedis
+	case strings.HasPrefix(dbPath, "dynamodb://"):
+		return dialectDynamoDB
+	case strings.HasPrefix(dbPath, "postgres://"), strings.HasPrefix(dbPath, "postgresql://"):
+		return dialectPostgreSQL
+	case strings.Contains(dbPath, "host=") && strings.Contains(dbPath, "dbname="):
+		// key=value connection string of lib/pq
+		return dialectPostgreSQL
+	case strings.Contains(dbPath, "@tcp("), strings.Contains(dbPath, "@unix("), strings.HasPrefix(dbPath, "tcp("):
+		return dialectMysql
 	}
+	return dialectSqlite3
+}
 
-	if locked, err := driver.OpenDB(dbType, dbPath, debugSQL); err != nil {
-		if locked {
-			return nil, true, err
+// cpesByDistroPackage returns the CPEs of the vendor/products a package is mapped to.
+// The package is looked up by the names of distro.Names in the distributions of distro.Distros, and the first found is used.
+func cpesByDistroPackage(driver DB, distroName, pkg string) (cpeURIs, deprecated []string, err error) {
+	cpeURIs, deprecated = []string{}, []string{}
+	for _, d := range distro.Distros(distroName) {
+		for _, name := range distro.Names(pkg) {
+			mapped, err := driver.GetDistroPackages(d, name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(mapped) == 0 {
+				continue
+			}
+			for _, m := range mapped {
+				uris, deps, err := driver.GetCpesByVendorProduct(LikePattern(quoteWFN(m.Vendor), false), LikePattern(quoteWFN(m.Product), false))
+				if err != nil {
+					return nil, nil, err
+				}
+				cpeURIs = append(cpeURIs, uris...)
+				deprecated = append(deprecated, deps...)
+			}
+			return cpeURIs, deprecated, nil
 		}
-		return nil, false, err
 	}
+	return cpeURIs, deprecated, nil
+}
 
-	if err := driver.MigrateDB(); err != nil {
-		log15.Error("Failed to migrate db.", "err", err)
-		return driver, false, err
+// cpeDetails dedupes the CPEs defined by multiple sources by dedupe and splits them by the deprecation, keeping the order.
+// The quality of a CPE is scored by the references of all its sources.
+func cpeDetails(results []models.CategorizedCpe) *models.CpeDetails {
+	references := map[string][]models.CpeReference{}
+	for _, r := range results {
+		references[r.CpeURI] = append(references[r.CpeURI], r.ReferenceList()...)
 	}
-	return driver, false, nil
+	details := &models.CpeDetails{Active: []models.CpeDetail{}, Deprecated: []models.CpeDetail{}}
+	for _, c := range dedupe(results) {
+		quality := models.CpeQuality(c.CpeURI, references[c.CpeURI], c.Deprecated)
+		if c.Deprecated {
+			details.Deprecated = append(details.Deprecated, models.CpeDetail{CpeURI: c.CpeURI, DeprecatedBy: c.DeprecatedBy, Quality: quality})
+		} else {
+			details.Active = append(details.Active, models.CpeDetail{CpeURI: c.CpeURI, Quality: quality})
+		}
+	}
+	return details
+}
+
+// wfnAttributes are the keys of go-cpe of the WFN attributes by their names
+var wfnAttributes = map[string]string{
+	"part":       common.AttributePart,
+	"vendor":     common.AttributeVendor,
+	"product":    common.AttributeProduct,
+	"version":    common.AttributeVersion,
+	"update":     common.AttributeUpdate,
+	"edition":    common.AttributeEdition,
+	"language":   common.AttributeLanguage,
+	"sw_edition": common.AttributeSwEdition,
+	"target_sw":  common.AttributeTargetSw,
+	"target_hw":  common.AttributeTargetHw,
+	"other":      common.AttributeOther,
+}
+
+// validateAttributes rejects the names not of the WFN attributes
+func validateAttributes(attributes []string) error {
+	for _, a := range attributes {
+		if _, ok := wfnAttributes[a]; !ok {
+			return xerrors.Errorf("Unknown attribute: %s, expected one of part, vendor, product, version, update, edition, language, sw_edition, target_sw, target_hw, other", a)
+		}
+	}
+	return nil
+}
+
+// attributeStats counts the values of the attributes by reading the CPEs of every vendor/product,
+// for the DBs which can't group the CPEs by an attribute
+func attributeStats(driver DB, attributes []string, top int) ([]models.AttributeStat, error) {
+	if err := validateAttributes(attributes); err != nil {
+		return nil, err
+	}
+	vendorProducts, err := driver.GetVendorProducts()
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]map[string]int, len(attributes))
+	for i := range counts {
+		counts[i] = map[string]int{}
+	}
+	for _, vp := range vendorProducts {
+		ss := strings.SplitN(vp, "::", 2)
+		if len(ss) != 2 {
+			continue
+		}
+		cpeURIs, deprecated, err := driver.GetCpesByVendorProduct(LikePattern(ss[0], false), LikePattern(ss[1], false))
+		if err != nil {
+			return nil, err
+		}
+		for _, cpeURI := range append(cpeURIs, deprecated...) {
+			wfn, err := naming.UnbindURI(cpeURI)
+			if err != nil {
+				continue
+			}
+			for i, a := range attributes {
+				counts[i][wfn.GetString(wfnAttributes[a])]++
+			}
+		}
+	}
+
+	stats := make([]models.AttributeStat, 0, len(attributes))
+	for i, a := range attributes {
+		stats = append(stats, topAttributeValues(a, counts[i], top))
+	}
+	return stats, nil
+}
+
+// topAttributeValues returns the stat of the counts of the values of the attribute.
+// Ties are broken by the value, and top <= 0 returns all the values.
+func topAttributeValues(attribute string, counts map[string]int, top int) models.AttributeStat {
+	values := make([]models.AttributeValueCount, 0, len(counts))
+	for v, n := range counts {
+		values = append(values, models.AttributeValueCount{Value: v, CPEs: n})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].CPEs != values[j].CPEs {
+			return values[j].CPEs < values[i].CPEs
+		}
+		return values[i].Value < values[j].Value
+	})
+	stat := models.AttributeStat{Attribute: attribute, Distinct: len(values), Top: values}
+	if 0 < top && top < len(values) {
+		stat.Top = values[:top]
+	}
+	return stat
+}
+
+// appendUnique appends the values not in values yet
+func appendUnique(values []string, added ...string) []string {
+	for _, a := range added {
+		found := false
+		for _, v := range values {
+			if v == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values = append(values, a)
+		}
+	}
+	return values
+}
+
+// splitSources splits the CPEs merged over the sources into the rows of each source, parsing the attributes from the URIs
+func splitSources(sourced []models.SourcedCpe) []models.CategorizedCpe {
+	cpes := []models.CategorizedCpe{}
+	for _, s := range sourced {
+		wfn, err := naming.UnbindURI(s.CpeURI)
+		if err != nil {
+			continue
+		}
+		c := models.CategorizedCpe{
+			CpeURI:       s.CpeURI,
+			CpeNameID:    s.CpeNameID,
+			Part:         wfn.GetString(common.AttributePart),
+			Vendor:       wfn.GetString(common.AttributeVendor),
+			Product:      wfn.GetString(common.AttributeProduct),
+			Version:      wfn.GetString(common.AttributeVersion),
+			Deprecated:   s.Deprecated,
+			DeprecatedBy: strings.Join(s.DeprecatedBy, "\n"),
+		}
+		if len(s.Sources) == 0 {
+			cpes = append(cpes, c)
+		}
+		for _, source := range s.Sources {
+			c.FetchType = source
+			cpes = append(cpes, c)
+		}
+	}
+	return cpes
+}
+
+// mergeSources merges the rows of the same CPE from multiple sources by dedupe, sorted by CPE URI
+func mergeSources(results []models.CategorizedCpe) []models.SourcedCpe {
+	cpes := dedupe(results)
+	sort.Slice(cpes, func(i, j int) bool { return cpes[i].CpeURI < cpes[j].CpeURI })
+	return cpes
+}
+
+// quoteWFN quotes a value the way it is stored in the WFN attributes,
+// e.g. 2.4.49 -> 2\.4\.49. A value already containing a backslash is returned as is.
+func quoteWFN(value string) string {
+	if strings.Contains(value, `\`) {
+		return value
+	}
+	var sb strings.Builder
+	for _, r := range value {
+		if !(r == '_' || ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
 }
 
 func newDB(dbType string) (DB, error) {
-	switch dbType {
-	case dialectSqlite3, dialectMysql, dialectPostgreSQL:
-		return &RDBDriver{name: dbType}, nil
-	case dialectRedis:
-		return &RedisDriver{name: dbType}, nil
+	if newDriver, ok := drivers[dbType]; ok {
+		return newDriver(), nil
+	}
+	if tag, ok := buildTags[dbType]; ok {
+		return nil, fmt.Errorf("%s is not supported by this binary built with the %s tag", dbType, tag)
 	}
 	return nil, fmt.Errorf("Invalid database dialect, %s", dbType)
 }
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"sort"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+// sourcePriority is the order of the sources preferred for a CPE defined by several of them, set by SetSourcePriority
+var sourcePriority []models.FetchType
+
+// SetSourcePriority sets the order of the sources preferred for a CPE defined by several of them, e.g. nvd,jvn.
+// The deprecation and the CPEs replacing a CPE are of the source first in it, and the sources not in it come after those in it.
+// Without it, the default, they're merged over the sources: a CPE deprecated by any source is deprecated.
+// The drivers storing a CPE once for all the sources, redis and dynamodb, merge them on the insert, so the priority orders the sources only.
+func SetSourcePriority(priority []models.FetchType) {
+	sourcePriority = priority
+}
+
+// sourceRank is the rank of the source in sourcePriority, the same for all the sources without it
+func sourceRank(f models.FetchType) int {
+	for i, p := range sourcePriority {
+		if p == f {
+			return i
+		}
+	}
+	return len(sourcePriority)
+}
+
+// dedupe resolves the rows of the CPEs of results, a row per source, into a CPE per CPE URI in the order of their first rows.
+// The fields of the rows of the source ranked first by sourcePriority win, and those of the rows of the same rank are merged.
+// The sources are ordered by sourcePriority, then by their names.
+func dedupe(results []models.CategorizedCpe) []models.SourcedCpe {
+	cpes, ranks, index := []models.SourcedCpe{}, []int{}, map[string]int{}
+	for _, r := range results {
+		rank := sourceRank(r.FetchType)
+		i, ok := index[r.CpeURI]
+		if !ok {
+			i = len(cpes)
+			index[r.CpeURI] = i
+			cpes = append(cpes, models.SourcedCpe{CpeURI: r.CpeURI, Sources: []models.FetchType{}})
+			ranks = append(ranks, rank)
+		}
+		c := &cpes[i]
+		switch {
+		case rank < ranks[i]:
+			c.Deprecated, c.DeprecatedBy = r.Deprecated, appendUnique(nil, r.DeprecatedByURIs()...)
+			ranks[i] = rank
+		case rank == ranks[i]:
+			c.Deprecated = c.Deprecated || r.Deprecated
+			c.DeprecatedBy = appendUnique(c.DeprecatedBy, r.DeprecatedByURIs()...)
+		}
+		if r.CpeNameID != "" {
+			c.CpeNameID = r.CpeNameID
+		}
+		if r.FetchType != "" && !hasSource(c.Sources, r.FetchType) {
+			c.Sources = append(c.Sources, r.FetchType)
+		}
+	}
+
+	for _, c := range cpes {
+		sources := c.Sources
+		sort.Slice(sources, func(i, j int) bool {
+			if ri, rj := sourceRank(sources[i]), sourceRank(sources[j]); ri != rj {
+				return ri < rj
+			}
+			return sources[i] < sources[j]
+		})
+	}
+	return cpes
+}
+
+func hasSource(sources []models.FetchType, f models.FetchType) bool {
+	for _, s := range sources {
+		if s == f {
+			return true
+		}
+	}
+	return false
+}
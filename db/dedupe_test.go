@@ -0,0 +1,86 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func TestDedupe(t *testing.T) {
+	defer SetSourcePriority(nil)
+
+	results := []models.CategorizedCpe{
+		{CpeURI: "cpe:/a:cybozu:office:10.0", FetchType: models.JVN, Deprecated: true, DeprecatedBy: "cpe:/a:cybozu:office:10.1"},
+		{CpeURI: "cpe:/a:cybozu:garoon:5.0", FetchType: models.JVN},
+		{CpeURI: "cpe:/a:cybozu:office:10.0", FetchType: models.NVD, CpeNameID: "1E2D3C4B-0000-0000-0000-000000000000"},
+		{CpeURI: "cpe:/a:cybozu:office:10.0", FetchType: models.NVD},
+	}
+
+	var tests = []struct {
+		priority []models.FetchType
+		expected []models.SourcedCpe
+	}{
+		// merged over the sources without the priority
+		{
+			priority: nil,
+			expected: []models.SourcedCpe{
+				{CpeURI: "cpe:/a:cybozu:office:10.0", CpeNameID: "1E2D3C4B-0000-0000-0000-000000000000", Deprecated: true, Sources: []models.FetchType{models.JVN, models.NVD}, DeprecatedBy: []string{"cpe:/a:cybozu:office:10.1"}},
+				{CpeURI: "cpe:/a:cybozu:garoon:5.0", Sources: []models.FetchType{models.JVN}},
+			},
+		},
+		// NVD wins over JVN deprecating it
+		{
+			priority: []models.FetchType{models.NVD, models.JVN},
+			expected: []models.SourcedCpe{
+				{CpeURI: "cpe:/a:cybozu:office:10.0", CpeNameID: "1E2D3C4B-0000-0000-0000-000000000000", Sources: []models.FetchType{models.NVD, models.JVN}},
+				{CpeURI: "cpe:/a:cybozu:garoon:5.0", Sources: []models.FetchType{models.JVN}},
+			},
+		},
+		// the sources not in the priority come after those in it
+		{
+			priority: []models.FetchType{models.JVN},
+			expected: []models.SourcedCpe{
+				{CpeURI: "cpe:/a:cybozu:office:10.0", CpeNameID: "1E2D3C4B-0000-0000-0000-000000000000", Deprecated: true, Sources: []models.FetchType{models.JVN, models.NVD}, DeprecatedBy: []string{"cpe:/a:cybozu:office:10.1"}},
+				{CpeURI: "cpe:/a:cybozu:garoon:5.0", Sources: []models.FetchType{models.JVN}},
+			},
+		},
+	}
+	for i, tt := range tests {
+		SetSourcePriority(tt.priority)
+		if actual := dedupe(results); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("[%d] actual %#v, expected %#v", i, actual, tt.expected)
+		}
+	}
+
+	SetSourcePriority([]models.FetchType{models.NVD})
+	cpeURIs, deprecated := splitDeprecated(results)
+	if !reflect.DeepEqual(cpeURIs, []string{"cpe:/a:cybozu:office:10.0", "cpe:/a:cybozu:garoon:5.0"}) || len(deprecated) != 0 {
+		t.Errorf("actual %v, %v", cpeURIs, deprecated)
+	}
+}
+
+func TestCpeDetailsQuality(t *testing.T) {
+	results := []models.CategorizedCpe{
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.8", FetchType: models.NVD, References: "Vendor\thttps://www.ntp.org/\nChange Log\thttps://www.ntp.org/ChangeLog"},
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.8", FetchType: models.JVN},
+		{CpeURI: "cpe:/a:ntp:ntp", FetchType: models.JVN},
+		{CpeURI: "cpe:/a:ntp:ntp:-", FetchType: models.NVD, References: "Version\thttps://www.ntp.org/downloads/"},
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.7", FetchType: models.NVD, Deprecated: true},
+	}
+	details := cpeDetails(results)
+	quality := map[string]int{}
+	for _, d := range append(details.Active, details.Deprecated...) {
+		quality[d.CpeURI] = d.Quality
+	}
+	expected := map[string]int{
+		// the references of NVD score the CPE defined by JVN too
+		"cpe:/a:ntp:ntp:4.2.8": 100,
+		"cpe:/a:ntp:ntp":       30,
+		"cpe:/a:ntp:ntp:-":     60,
+		"cpe:/a:ntp:ntp:4.2.7": 30,
+	}
+	if !reflect.DeepEqual(quality, expected) {
+		t.Errorf("actual %v, expected %v", quality, expected)
+	}
+}
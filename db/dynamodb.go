@@ -0,0 +1,1159 @@
+//go:build !nodynamodb
+// +build !nodynamodb
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/inconshreveable/log15"
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/config"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+// The items of the table are keyed by the partition key PK and the sort key SK:
+//
+//	PK                        SK                   attributes
+//	VENDORPRODUCTS            <vendor>::<product>  popularity, title
+//	VP#<vendor>::<product>    CPE#<CPE URI>        sources, deprecated, deprecatedBy, cpeNameId
+//	VERSION#<version>         <vendor>::<product>
+//	CPENAMEID                 <cpeNameId>          cpeURI, vendorProduct
+//	META                      FETCHMETA            revision, schemaVersion, lastFetchedAt, nvdDictVersion, nvdDictGeneratedAt
+//	HISTORY#<fetch type>      <started at>         json
+//	AUDIT                     <operated at>#<op>   json
+//	WATCHLIST                 <vendor>::<product>  json
+//	WATCHCHANGES              <detected at>#<n>    json
+//	DISTRO                    <distro>::<package>  json
+//	REJECTED                  <source>#<n>         json
+const (
+	dynamoVendorProducts = "VENDORPRODUCTS"
+	dynamoVPPrefix       = "VP#"
+	dynamoCpePrefix      = "CPE#"
+	dynamoVersionPrefix  = "VERSION#"
+	dynamoCpeNameIDs     = "CPENAMEID"
+	dynamoMeta           = "META"
+	dynamoFetchMeta      = "FETCHMETA"
+	dynamoHistoryPrefix  = "HISTORY#"
+	dynamoAudit          = "AUDIT"
+	dynamoWatchlist      = "WATCHLIST"
+	dynamoWatchChanges   = "WATCHCHANGES"
+	dynamoDistro         = "DISTRO"
+	dynamoRejected       = "REJECTED"
+	dynamoKnownExploited = "KEV"
+	dynamoSep            = "::"
+
+	// dynamoBatchSize is the maximum number of the requests in a BatchWriteItem
+	dynamoBatchSize = 25
+	// dynamoTimeFormat sorts lexically in time order
+	dynamoTimeFormat = "2006-01-02T15:04:05.000000000Z"
+)
+
+func init() {
+	drivers[dialectDynamoDB] = func() DB { return &DynamoDBDriver{name: dialectDynamoDB} }
+	pathValidators[dialectDynamoDB] = func(dbPath string) error {
+		// the URL, the region and the credentials
+		_, _, err := newDynamoClient(dbPath, 0)
+		return err
+	}
+}
+
+// dynamoAPI calls an operation of DynamoDB, replaced by a fake in the tests
+type dynamoAPI interface {
+	call(ctx context.Context, op string, in, out interface{}) error
+}
+
+// DynamoDBDriver is Driver for DynamoDB, keeping the dictionary in a single table
+type DynamoDBDriver struct {
+	name  string
+	log   log15.Logger
+	api   dynamoAPI
+	table string
+}
+
+// Name return db name
+func (d *DynamoDBDriver) Name() string {
+	return d.name
+}
+
+// OpenDB opens Database. dbPath is dynamodb://<table>?region=<region>&endpoint=<URL>
+func (d *DynamoDBDriver) OpenDB(dbType, dbPath string, debugSQL bool) (locked bool, err error) {
+	return d.openDB(dbType, dbPath, Option{DebugSQL: debugSQL})
+}
+
+// openDB opens Database with the options of Open
+func (d *DynamoDBDriver) openDB(dbType, dbPath string, option Option) (locked bool, err error) {
+	d.log = option.Logger
+	if d.log == nil {
+		d.log = log15.Root()
+	}
+	client, table, err := newDynamoClient(dbPath, option.Timeout)
+	if err != nil {
+		return false, xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, dbPath, err)
+	}
+	d.api, d.table = client, option.TablePrefix+table
+	return false, nil
+}
+
+// CloseDB close Database
+func (d *DynamoDBDriver) CloseDB() error {
+	return nil
+}
+
+// MigrateDB creates the table unless it exists
+func (d *DynamoDBDriver) MigrateDB() error {
+	ctx := context.Background()
+	status, err := d.tableStatus(ctx)
+	if err != nil {
+		if !isDynamoError(err, "ResourceNotFoundException") {
+			return xerrors.Errorf("Failed to DescribeTable. err: %w", err)
+		}
+		in := map[string]interface{}{
+			"TableName": d.table,
+			"AttributeDefinitions": []map[string]string{
+				{"AttributeName": "PK", "AttributeType": "S"},
+				{"AttributeName": "SK", "AttributeType": "S"},
+			},
+			"KeySchema": []map[string]string{
+				{"AttributeName": "PK", "KeyType": "HASH"},
+				{"AttributeName": "SK", "KeyType": "RANGE"},
+			},
+			"BillingMode": "PAY_PER_REQUEST",
+		}
+		if err := d.api.call(ctx, "CreateTable", in, nil); err != nil {
+			return xerrors.Errorf("Failed to CreateTable. table: %s, err: %w", d.table, err)
+		}
+		d.log.Info("Created DynamoDB table.", "table", d.table)
+	}
+
+	// a new table can't be written until it's active
+	for i := 0; status != "ACTIVE"; i++ {
+		if 60 <= i {
+			return fmt.Errorf("The table is not active. table: %s, status: %s", d.table, status)
+		}
+		if i != 0 {
+			time.Sleep(time.Second)
+		}
+		if status, err = d.tableStatus(ctx); err != nil {
+			return xerrors.Errorf("Failed to DescribeTable. err: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *DynamoDBDriver) tableStatus(ctx context.Context) (string, error) {
+	var out struct {
+		Table struct {
+			TableStatus string
+		}
+	}
+	if err := d.api.call(ctx, "DescribeTable", map[string]string{"TableName": d.table}, &out); err != nil {
+		return "", err
+	}
+	return out.Table.TableStatus, nil
+}
+
+func dynamoKey(pk, sk string) dynamoItem {
+	return dynamoItem{"PK": dynamoS(pk), "SK": dynamoS(sk)}
+}
+
+func (d *DynamoDBDriver) putItem(ctx context.Context, item dynamoItem) error {
+	return d.api.call(ctx, "PutItem", map[string]interface{}{"TableName": d.table, "Item": item}, nil)
+}
+
+// getItem returns nil when the item doesn't exist
+func (d *DynamoDBDriver) getItem(ctx context.Context, pk, sk string) (dynamoItem, error) {
+	var out struct {
+		Item dynamoItem
+	}
+	in := map[string]interface{}{"TableName": d.table, "Key": dynamoKey(pk, sk), "ConsistentRead": true}
+	if err := d.api.call(ctx, "GetItem", in, &out); err != nil {
+		return nil, err
+	}
+	return out.Item, nil
+}
+
+// deleteItem returns whether the item existed
+func (d *DynamoDBDriver) deleteItem(ctx context.Context, pk, sk string) (bool, error) {
+	var out struct {
+		Attributes dynamoItem
+	}
+	in := map[string]interface{}{"TableName": d.table, "Key": dynamoKey(pk, sk), "ReturnValues": "ALL_OLD"}
+	if err := d.api.call(ctx, "DeleteItem", in, &out); err != nil {
+		return false, err
+	}
+	return 0 < len(out.Attributes), nil
+}
+
+// dynamoQuery is a Query of the items in a partition
+type dynamoQuery struct {
+	pk string
+	// skAtLeast limits the items to the sort keys at or after it
+	skAtLeast string
+	// reverse returns the items in the descending order of the sort key
+	reverse bool
+	// limit is the maximum number of the items, 0 for all
+	limit int
+}
+
+// query returns the items in the partition in the order of the sort key, following the pages
+func (d *DynamoDBDriver) query(ctx context.Context, q dynamoQuery) ([]dynamoItem, error) {
+	values := dynamoItem{":pk": dynamoS(q.pk)}
+	cond := "PK = :pk"
+	if q.skAtLeast != "" {
+		cond += " AND SK >= :sk"
+		values[":sk"] = dynamoS(q.skAtLeast)
+	}
+	in := map[string]interface{}{
+		"TableName":                 d.table,
+		"KeyConditionExpression":    cond,
+		"ExpressionAttributeValues": values,
+		"ConsistentRead":            true,
+		"ScanIndexForward":          !q.reverse,
+	}
+	if 0 < q.limit {
+		in["Limit"] = q.limit
+	}
+
+	items := []dynamoItem{}
+	for {
+		var out struct {
+			Items            []dynamoItem
+			LastEvaluatedKey dynamoItem
+		}
+		if err := d.api.call(ctx, "Query", in, &out); err != nil {
+			return nil, err
+		}
+		items = append(items, out.Items...)
+		if len(out.LastEvaluatedKey) == 0 || (0 < q.limit && q.limit <= len(items)) {
+			return items, nil
+		}
+		in["ExclusiveStartKey"] = out.LastEvaluatedKey
+	}
+}
+
+// batchWrite puts and deletes the items by BatchWriteItem, retrying the unprocessed ones
+func (d *DynamoDBDriver) batchWrite(ctx context.Context, puts []dynamoItem, deletes []dynamoItem) error {
+	requests := make([]map[string]interface{}, 0, len(puts)+len(deletes))
+	for _, item := range puts {
+		requests = append(requests, map[string]interface{}{"PutRequest": map[string]interface{}{"Item": item}})
+	}
+	for _, key := range deletes {
+		requests = append(requests, map[string]interface{}{"DeleteRequest": map[string]interface{}{"Key": key}})
+	}
+
+	for i := 0; i < len(requests); i += dynamoBatchSize {
+		end := i + dynamoBatchSize
+		if len(requests) < end {
+			end = len(requests)
+		}
+		batch := requests[i:end]
+		for retry := 0; 0 < len(batch); retry++ {
+			if 10 <= retry {
+				return &lockedError{err: fmt.Errorf("Failed to process %d items of BatchWriteItem after retries", len(batch))}
+			}
+			if retry != 0 {
+				time.Sleep(time.Duration(retry*retry) * 50 * time.Millisecond)
+			}
+			var out struct {
+				UnprocessedItems map[string][]map[string]interface{}
+			}
+			in := map[string]interface{}{"RequestItems": map[string]interface{}{d.table: batch}}
+			if err := d.api.call(ctx, "BatchWriteItem", in, &out); err != nil {
+				return err
+			}
+			batch = out.UnprocessedItems[d.table]
+		}
+	}
+	return nil
+}
+
+// GetFetchMeta get FetchMeta from Database
+func (d *DynamoDBDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	item, err := d.getItem(context.Background(), dynamoMeta, dynamoFetchMeta)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to GetItem FetchMeta. err: %w", err)
+	}
+	if item == nil {
+		return &models.FetchMeta{GoCPEDictRevision: config.Revision, SchemaVersion: models.LatestSchemaVersion, LastFetchedAt: neverFetchedAt}, nil
+	}
+
+	date, err := time.Parse(time.RFC3339, item.str("lastFetchedAt"))
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to Parse date. err: %w", err)
+	}
+	fetchMeta := models.FetchMeta{GoCPEDictRevision: item.str("revision"), SchemaVersion: uint(item.num("schemaVersion")), LastFetchedAt: date, NVDDictVersion: item.str("nvdDictVersion"), SourceHashes: item.str("sourceHashes"), Generation: uint64(item.num("generation"))}
+	if s := item.str("nvdDictGeneratedAt"); s != "" {
+		generated, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to Parse date. err: %w", err)
+		}
+		fetchMeta.NVDDictGeneratedAt = &generated
+	}
+	return &fetchMeta, nil
+}
+
+// UpsertFetchMeta upsert FetchMeta to Database
+func (d *DynamoDBDriver) UpsertFetchMeta(fetchMeta *models.FetchMeta) error {
+	ctx := context.Background()
+	item := dynamoKey(dynamoMeta, dynamoFetchMeta)
+	item["revision"] = dynamoS(config.Revision)
+	item["schemaVersion"] = dynamoN(models.LatestSchemaVersion)
+	item["lastFetchedAt"] = dynamoS(fetchMeta.LastFetchedAt.Format(time.RFC3339))
+	item["generation"] = dynamoN(int64(fetchMeta.Generation))
+	if fetchMeta.SourceHashes != "" {
+		item["sourceHashes"] = dynamoS(fetchMeta.SourceHashes)
+	}
+	if fetchMeta.NVDDictGeneratedAt != nil {
+		item["nvdDictVersion"] = dynamoS(fetchMeta.NVDDictVersion)
+		item["nvdDictGeneratedAt"] = dynamoS(fetchMeta.NVDDictGeneratedAt.Format(time.RFC3339))
+	} else {
+		// keep the version of the dictionary as HSet does on redis
+		old, err := d.getItem(ctx, dynamoMeta, dynamoFetchMeta)
+		if err != nil {
+			return xerrors.Errorf("Failed to GetItem FetchMeta. err: %w", err)
+		}
+		for _, name := range []string{"nvdDictVersion", "nvdDictGeneratedAt"} {
+			if v, ok := old[name]; ok {
+				item[name] = v
+			}
+		}
+	}
+	if err := d.putItem(ctx, item); err != nil {
+		return xerrors.Errorf("Failed to PutItem FetchMeta. err: %w", err)
+	}
+	return nil
+}
+
+// InsertFetchHistory records a fetch of a source
+func (d *DynamoDBDriver) InsertFetchHistory(history *models.FetchHistory) error {
+	j, err := json.Marshal(history)
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal FetchHistory. err: %w", err)
+	}
+	item := dynamoKey(dynamoHistoryPrefix+string(history.FetchType), history.StartedAt.UTC().Format(dynamoTimeFormat))
+	item["json"] = dynamoS(string(j))
+	if err := d.putItem(context.Background(), item); err != nil {
+		return xerrors.Errorf("Failed to PutItem FetchHistory. err: %w", err)
+	}
+	return nil
+}
+
+// GetLatestFetchHistories returns the latest fetch of each source
+func (d *DynamoDBDriver) GetLatestFetchHistories() ([]models.FetchHistory, error) {
+	ctx := context.Background()
+	histories := []models.FetchHistory{}
+	// the sources are known, so there's no need to scan the table for the partitions
+	for _, fetchType := range []models.FetchType{models.JVN, models.NVD, models.Windows} {
+		items, err := d.query(ctx, dynamoQuery{pk: dynamoHistoryPrefix + string(fetchType), reverse: true, limit: 1})
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to Query FetchHistory. err: %w", err)
+		}
+		if len(items) == 0 {
+			continue
+		}
+		var history models.FetchHistory
+		if err := json.Unmarshal([]byte(items[0].str("json")), &history); err != nil {
+			return nil, xerrors.Errorf("Failed to unmarshal FetchHistory. err: %w", err)
+		}
+		histories = append(histories, history)
+	}
+	return histories, nil
+}
+
+// InsertAuditEntry records a data-modifying operation
+func (d *DynamoDBDriver) InsertAuditEntry(entry *models.AuditEntry) error {
+	j, err := json.Marshal(entry)
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal AuditEntry. err: %w", err)
+	}
+	// the operation and the target keep the operations at the same time apart
+	item := dynamoKey(dynamoAudit, fmt.Sprintf("%s#%s#%s", entry.OperatedAt.UTC().Format(dynamoTimeFormat), entry.Operation, entry.Target))
+	item["json"] = dynamoS(string(j))
+	if err := d.putItem(context.Background(), item); err != nil {
+		return xerrors.Errorf("Failed to PutItem AuditEntry. err: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEntries returns the operations at or after since, oldest first
+func (d *DynamoDBDriver) GetAuditEntries(since time.Time) ([]models.AuditEntry, error) {
+	items, err := d.query(context.Background(), dynamoQuery{pk: dynamoAudit, skAtLeast: since.UTC().Format(dynamoTimeFormat)})
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to Query AuditEntry. err: %w", err)
+	}
+	entries := []models.AuditEntry{}
+	for _, item := range items {
+		var entry models.AuditEntry
+		if err := json.Unmarshal([]byte(item.str("json")), &entry); err != nil {
+			return nil, xerrors.Errorf("Failed to unmarshal AuditEntry. err: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// GetWatchlist returns the watched products
+func (d *DynamoDBDriver) GetWatchlist() ([]models.WatchedProduct, error) {
+	items, err := d.query(context.Background(), dynamoQuery{pk: dynamoWatchlist})
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to Query watchlist. err: %w", err)
+	}
+	watchlist := []models.WatchedProduct{}
+	for _, item := range items {
+		var watched dynamoWatchedProduct
+		if err := json.Unmarshal([]byte(item.str("json")), &watched); err != nil {
+			return nil, xerrors.Errorf("Failed to unmarshal watched product. err: %w", err)
+		}
+		watched.WatchedProduct.Versions = watched.Versions
+		watched.WatchedProduct.DeprecatedCpes = watched.DeprecatedCpes
+		watchlist = append(watchlist, watched.WatchedProduct)
+	}
+	sort.Slice(watchlist, func(i, j int) bool {
+		if watchlist[i].Vendor != watchlist[j].Vendor {
+			return watchlist[i].Vendor < watchlist[j].Vendor
+		}
+		return watchlist[i].Product < watchlist[j].Product
+	})
+	return watchlist, nil
+}
+
+// dynamoWatchedProduct is the JSON of a watched product, which keeps the fields hidden from the API
+type dynamoWatchedProduct struct {
+	models.WatchedProduct
+	Versions       string `json:"versions"`
+	DeprecatedCpes string `json:"deprecatedCpes"`
+}
+
+// UpsertWatchedProduct puts a product on the watchlist, or updates it
+func (d *DynamoDBDriver) UpsertWatchedProduct(watched *models.WatchedProduct) error {
+	j, err := json.Marshal(dynamoWatchedProduct{WatchedProduct: *watched, Versions: watched.Versions, DeprecatedCpes: watched.DeprecatedCpes})
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal watched product. err: %w", err)
+	}
+	item := dynamoKey(dynamoWatchlist, watched.Vendor+dynamoSep+watched.Product)
+	item["json"] = dynamoS(string(j))
+	if err := d.putItem(context.Background(), item); err != nil {
+		return xerrors.Errorf("Failed to PutItem watchlist. err: %w", err)
+	}
+	return nil
+}
+
+// DeleteWatchedProduct removes a product from the watchlist, and returns whether it was there
+func (d *DynamoDBDriver) DeleteWatchedProduct(vendor, product string) (bool, error) {
+	deleted, err := d.deleteItem(context.Background(), dynamoWatchlist, vendor+dynamoSep+product)
+	if err != nil {
+		return false, xerrors.Errorf("Failed to DeleteItem watchlist. err: %w", err)
+	}
+	return deleted, nil
+}
+
+// InsertWatchChanges records the changes of the watched products
+func (d *DynamoDBDriver) InsertWatchChanges(changes []models.WatchChange) error {
+	items := make([]dynamoItem, 0, len(changes))
+	for i, c := range changes {
+		j, err := json.Marshal(c)
+		if err != nil {
+			return xerrors.Errorf("Failed to marshal watch change. err: %w", err)
+		}
+		// the index keeps the changes detected at the same time apart
+		item := dynamoKey(dynamoWatchChanges, fmt.Sprintf("%s#%06d", c.DetectedAt.UTC().Format(dynamoTimeFormat), i))
+		item["json"] = dynamoS(string(j))
+		items = append(items, item)
+	}
+	if err := d.batchWrite(context.Background(), items, nil); err != nil {
+		return xerrors.Errorf("Failed to BatchWriteItem watch changes. err: %w", err)
+	}
+	return nil
+}
+
+// GetWatchChanges returns the changes of the watched products detected at or after since, oldest first
+func (d *DynamoDBDriver) GetWatchChanges(since time.Time) ([]models.WatchChange, error) {
+	items, err := d.query(context.Background(), dynamoQuery{pk: dynamoWatchChanges, skAtLeast: since.UTC().Format(dynamoTimeFormat)})
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to Query watch changes. err: %w", err)
+	}
+	changes := []models.WatchChange{}
+	for _, item := range items {
+		var c models.WatchChange
+		if err := json.Unmarshal([]byte(item.str("json")), &c); err != nil {
+			return nil, xerrors.Errorf("Failed to unmarshal watch change. err: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// ReplaceRejectedCpes replaces the rejected CPEs of the source
+func (d *DynamoDBDriver) ReplaceRejectedCpes(source models.FetchType, rejects []models.RejectedCpe) error {
+	ctx := context.Background()
+	puts := make([]dynamoItem, 0, len(rejects))
+	written := map[string]bool{}
+	for i, c := range rejects {
+		c.FetchType = source
+		j, err := json.Marshal(c)
+		if err != nil {
+			return xerrors.Errorf("Failed to marshal rejected CPE. err: %w", err)
+		}
+		sk := fmt.Sprintf("%s#%08d", source, i)
+		item := dynamoKey(dynamoRejected, sk)
+		item["json"] = dynamoS(string(j))
+		puts = append(puts, item)
+		written[sk] = true
+	}
+
+	items, err := d.rejectedItems(ctx, source)
+	if err != nil {
+		return err
+	}
+	deletes := []dynamoItem{}
+	for _, item := range items {
+		if !written[item.str("SK")] {
+			deletes = append(deletes, dynamoKey(dynamoRejected, item.str("SK")))
+		}
+	}
+	if err := d.batchWrite(ctx, puts, deletes); err != nil {
+		return xerrors.Errorf("Failed to BatchWriteItem rejected CPEs. err: %w", err)
+	}
+	return nil
+}
+
+// GetRejectedCpes returns the rejected CPEs of the source, or of all the sources when source is empty
+func (d *DynamoDBDriver) GetRejectedCpes(source models.FetchType) ([]models.RejectedCpe, error) {
+	items, err := d.rejectedItems(context.Background(), source)
+	if err != nil {
+		return nil, err
+	}
+	rejects := []models.RejectedCpe{}
+	for _, item := range items {
+		var c models.RejectedCpe
+		if err := json.Unmarshal([]byte(item.str("json")), &c); err != nil {
+			return nil, xerrors.Errorf("Failed to unmarshal rejected CPE. err: %w", err)
+		}
+		rejects = append(rejects, c)
+	}
+	return rejects, nil
+}
+
+// rejectedItems returns the items of the rejected CPEs of the source, or of all the sources when source is empty
+func (d *DynamoDBDriver) rejectedItems(ctx context.Context, source models.FetchType) ([]dynamoItem, error) {
+	prefix := ""
+	if source != "" {
+		prefix = string(source) + "#"
+	}
+	items, err := d.query(ctx, dynamoQuery{pk: dynamoRejected, skAtLeast: prefix})
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to Query rejected CPEs. err: %w", err)
+	}
+	filtered := []dynamoItem{}
+	for _, item := range items {
+		if strings.HasPrefix(item.str("SK"), prefix) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
+
+// vendorProductItems returns the items of the vendor/products sorted by vendor::product
+func (d *DynamoDBDriver) vendorProductItems(ctx context.Context) ([]dynamoItem, error) {
+	items, err := d.query(ctx, dynamoQuery{pk: dynamoVendorProducts})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to Query vendorProduct. err: %s", err)
+	}
+	return items, nil
+}
+
+// cpeItems returns the items of the CPEs of vendor::product sorted by CPE URI
+func (d *DynamoDBDriver) cpeItems(ctx context.Context, vendorProduct string) ([]dynamoItem, error) {
+	items, err := d.query(ctx, dynamoQuery{pk: dynamoVPPrefix + vendorProduct})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to Query CPE. err: %s", err)
+	}
+	return items, nil
+}
+
+func cpeURIOf(item dynamoItem) string {
+	return strings.TrimPrefix(item.str("SK"), dynamoCpePrefix)
+}
+
+// deprecatedByOf returns the CPE URIs replacing the deprecated CPE of the item
+func deprecatedByOf(item dynamoItem) []string {
+	if item.str("deprecatedBy") == "" {
+		return nil
+	}
+	return strings.Split(item.str("deprecatedBy"), "\n")
+}
+
+func sourcesOf(item dynamoItem) []models.FetchType {
+	fetchTypes := []models.FetchType{}
+	for _, s := range strings.Split(item.str("sources"), ",") {
+		if s != "" {
+			fetchTypes = append(fetchTypes, models.FetchType(s))
+		}
+	}
+	return fetchTypes
+}
+
+// GetVendorProducts : GetVendorProducts
+func (d *DynamoDBDriver) GetVendorProducts() ([]string, error) {
+	items, err := d.vendorProductItems(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	vendorProducts := make([]string, 0, len(items))
+	for _, item := range items {
+		vendorProducts = append(vendorProducts, item.str("SK"))
+	}
+	return vendorProducts, nil
+}
+
+// GetVendorProductsByPopularity : GetVendorProducts sorted by the number of referencing CVEs
+func (d *DynamoDBDriver) GetVendorProductsByPopularity() ([]string, error) {
+	items, err := d.vendorProductItems(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].num("popularity") > items[j].num("popularity") })
+	vendorProducts := make([]string, 0, len(items))
+	for _, item := range items {
+		vendorProducts = append(vendorProducts, item.str("SK"))
+	}
+	return vendorProducts, nil
+}
+
+// GetVendorProductTitles : GetVendorProductTitles returns the titles keyed by vendor::product
+func (d *DynamoDBDriver) GetVendorProductTitles() (map[string]string, error) {
+	items, err := d.vendorProductItems(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	titles := map[string]string{}
+	for _, item := range items {
+		if title := item.str("title"); title != "" {
+			titles[item.str("SK")] = title
+		}
+	}
+	return titles, nil
+}
+
+// GetProductSummaries : GetProductSummaries groups the CPEs by vendor/product
+func (d *DynamoDBDriver) GetProductSummaries() ([]models.ProductSummary, error) {
+	ctx := context.Background()
+	vpItems, err := d.vendorProductItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]models.ProductSummary, 0, len(vpItems))
+	for _, vpItem := range vpItems {
+		vp := vpItem.str("SK")
+		ss := strings.SplitN(vp, dynamoSep, 2)
+		if len(ss) != 2 {
+			continue
+		}
+		items, err := d.cpeItems(ctx, vp)
+		if err != nil {
+			return nil, err
+		}
+
+		summary := models.ProductSummary{Vendor: ss[0], Product: ss[1], CPEs: len(items), Popularity: int(vpItem.num("popularity")), Parts: []string{}}
+		versions, parts := map[string]bool{}, map[string]bool{}
+		for _, item := range items {
+			if item.boolean("deprecated") {
+				summary.Deprecated++
+			}
+			wfn, err := naming.UnbindURI(cpeURIOf(item))
+			if err != nil {
+				continue
+			}
+			switch v := wfn.GetString(common.AttributeVersion); v {
+			case "", "ANY", "NA":
+			default:
+				versions[v] = true
+			}
+			parts[wfn.GetString(common.AttributePart)] = true
+		}
+		summary.Versions = len(versions)
+		for p := range parts {
+			summary.Parts = append(summary.Parts, p)
+		}
+		sort.Strings(summary.Parts)
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// GetCpesByVendorProduct : GetCpesByVendorProduct
+func (d *DynamoDBDriver) GetCpesByVendorProduct(vendor, product string) ([]string, []string, error) {
+	if vendor == "" || product == "" {
+		return nil, nil, nil
+	}
+	details, err := d.GetCpeDetailsByVendorProduct(vendor, product)
+	if err != nil {
+		return nil, nil, err
+	}
+	cpeURIs, deprecated := details.CpeURIs()
+	return cpeURIs, deprecated, nil
+}
+
+// GetCpeDetailsByVendorProduct : GetCpeDetailsByVendorProduct
+func (d *DynamoDBDriver) GetCpeDetailsByVendorProduct(vendor, product string) (*models.CpeDetails, error) {
+	if vendor == "" || product == "" {
+		return cpeDetails(nil), nil
+	}
+	if HasLikeWildcard(vendor) || HasLikeWildcard(product) {
+		return nil, xerrors.Errorf("Failed to query DynamoDB. vendor: %s, product: %s, err: %w", vendor, product, ErrWildcardUnsupported)
+	}
+	// an escaped % or _ is the name
+	vendor, product = UnescapeLike(vendor), UnescapeLike(product)
+	items, err := d.cpeItems(context.Background(), vendor+dynamoSep+product)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]models.CategorizedCpe, 0, len(items))
+	for _, item := range items {
+		results = append(results, models.CategorizedCpe{CpeURI: cpeURIOf(item), Deprecated: item.boolean("deprecated"), DeprecatedBy: item.str("deprecatedBy")})
+	}
+	return cpeDetails(results), nil
+}
+
+// GetSourcedCpesByVendorProduct : GetSourcedCpesByVendorProduct merges the CPEs over the sources.
+// Empty sources means all sources.
+func (d *DynamoDBDriver) GetSourcedCpesByVendorProduct(vendor, product string, sources []models.FetchType) ([]models.SourcedCpe, error) {
+	if vendor == "" || product == "" {
+		return []models.SourcedCpe{}, nil
+	}
+	if HasLikeWildcard(vendor) || HasLikeWildcard(product) {
+		return nil, xerrors.Errorf("Failed to query DynamoDB. vendor: %s, product: %s, err: %w", vendor, product, ErrWildcardUnsupported)
+	}
+	// an escaped % or _ is the name
+	vendor, product = UnescapeLike(vendor), UnescapeLike(product)
+	items, err := d.cpeItems(context.Background(), vendor+dynamoSep+product)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[models.FetchType]bool{}
+	for _, s := range sources {
+		wanted[s] = true
+	}
+	results := []models.CategorizedCpe{}
+	for _, item := range items {
+		for _, f := range sourcesOf(item) {
+			if len(wanted) == 0 || wanted[f] {
+				results = append(results, models.CategorizedCpe{CpeURI: cpeURIOf(item), Deprecated: item.boolean("deprecated"), FetchType: f, CpeNameID: item.str("cpeNameId"), DeprecatedBy: item.str("deprecatedBy")})
+			}
+		}
+	}
+	return mergeSources(results), nil
+}
+
+// GetCpeByNameID returns the CPE of the cpeNameId of NVD API 2.0 merged over the sources, nil when it's not found
+func (d *DynamoDBDriver) GetCpeByNameID(id string) (*models.SourcedCpe, error) {
+	ctx := context.Background()
+	found, err := d.getItem(ctx, dynamoCpeNameIDs, strings.ToUpper(id))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to GetItem cpeNameId. err: %s", err)
+	}
+	if found == nil {
+		return nil, nil
+	}
+	item, err := d.getItem(ctx, dynamoVPPrefix+found.str("vendorProduct"), dynamoCpePrefix+found.str("cpeURI"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to GetItem CPE. err: %s", err)
+	}
+	if item == nil {
+		return nil, nil
+	}
+	return &models.SourcedCpe{CpeURI: cpeURIOf(item), Deprecated: item.boolean("deprecated"), Sources: sourcesOf(item), CpeNameID: item.str("cpeNameId"), DeprecatedBy: deprecatedByOf(item)}, nil
+}
+
+// GetProductsByVersion : GetProductsByVersion returns vendor::product having the version
+func (d *DynamoDBDriver) GetProductsByVersion(version string) ([]string, error) {
+	items, err := d.query(context.Background(), dynamoQuery{pk: dynamoVersionPrefix + quoteWFN(version)})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to Query products. err: %s", err)
+	}
+	vendorProducts := make([]string, 0, len(items))
+	for _, item := range items {
+		vendorProducts = append(vendorProducts, item.str("SK"))
+	}
+	return vendorProducts, nil
+}
+
+// GetVersionsByVendorProduct : GetVersionsByVendorProduct returns the versions of vendor/product between from and to.
+// The items don't hold the versions, so they are taken from the CPE URIs of vendor::product.
+func (d *DynamoDBDriver) GetVersionsByVendorProduct(vendor, product, from, to string) ([]string, error) {
+	items, err := d.cpeItems(context.Background(), vendor+dynamoSep+product)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, 0, len(items))
+	for _, item := range items {
+		wfn, err := naming.UnbindURI(cpeURIOf(item))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, wfn.GetString(common.AttributeVersion))
+	}
+	return versionsInRange(versions, from, to), nil
+}
+
+// GetAttributeStats counts the attributes of the CPEs of every vendor/product
+func (d *DynamoDBDriver) GetAttributeStats(attributes []string, top int) ([]models.AttributeStat, error) {
+	return attributeStats(d, attributes, top)
+}
+
+// CountCpes returns the number of CPEs defined by the source.
+// It reads every CPE item, as CountCpes on redis scans every key.
+func (d *DynamoDBDriver) CountCpes(fetchType models.FetchType) (int, error) {
+	ctx := context.Background()
+	vpItems, err := d.vendorProductItems(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, vpItem := range vpItems {
+		items, err := d.cpeItems(ctx, vpItem.str("SK"))
+		if err != nil {
+			return 0, err
+		}
+		for _, item := range items {
+			for _, f := range sourcesOf(item) {
+				if f == fetchType {
+					count++
+				}
+			}
+		}
+	}
+	return count, nil
+}
+
+// GetCpesChangedSince returns an error, since DynamoDB doesn't track the changes of the CPEs
+func (d *DynamoDBDriver) GetCpesChangedSince(uint64, time.Time) ([]models.CategorizedCpe, error) {
+	return nil, xerrors.New("The changes of the CPEs are not tracked by DynamoDB, only by the RDB")
+}
+
+// GetVendorProductsAsOf returns ErrNoHistory, since DynamoDB doesn't track the history of the CPEs
+func (d *DynamoDBDriver) GetVendorProductsAsOf(time.Time) ([]string, error) {
+	return nil, xerrors.Errorf("Failed to query DynamoDB as of a time. err: %w", ErrNoHistory)
+}
+
+// GetCpeDetailsAsOf returns ErrNoHistory, since DynamoDB doesn't track the history of the CPEs
+func (d *DynamoDBDriver) GetCpeDetailsAsOf(string, string, time.Time) (*models.CpeDetails, error) {
+	return nil, xerrors.Errorf("Failed to query DynamoDB as of a time. err: %w", ErrNoHistory)
+}
+
+// InsertCpes Select Cve information from DB.
+// The CPEs are merged with the items of the same vendor/product, so a CPE defined by both sources is a single item.
+func (d *DynamoDBDriver) InsertCpes(cpes []models.CategorizedCpe) error {
+	ctx := context.Background()
+	vpItems, err := d.vendorProductItems(ctx)
+	if err != nil {
+		return err
+	}
+	vps := map[string]dynamoItem{}
+	for _, item := range vpItems {
+		vps[item.str("SK")] = item
+	}
+
+	byVP := map[string][]models.CategorizedCpe{}
+	order := []string{}
+	for _, c := range cpes {
+		vp := c.Vendor + dynamoSep + c.Product
+		if _, ok := byVP[vp]; !ok {
+			order = append(order, vp)
+		}
+		byVP[vp] = append(byVP[vp], c)
+	}
+
+	bar := pb.New(len(cpes))
+	bar.Start()
+	changedVPs, versions, nameIDs := []dynamoItem{}, []dynamoItem{}, []dynamoItem{}
+	for _, vp := range order {
+		items, err := d.cpeItems(ctx, vp)
+		if err != nil {
+			return err
+		}
+		existing := map[string]dynamoItem{}
+		for _, item := range items {
+			existing[item.str("SK")] = item
+		}
+
+		vpItem, ok := vps[vp]
+		changed := !ok
+		if !ok {
+			vpItem = dynamoKey(dynamoVendorProducts, vp)
+			vpItem["popularity"] = dynamoN(0)
+			vps[vp] = vpItem
+		}
+		puts := map[string]dynamoItem{}
+		for _, c := range byVP[vp] {
+			bar.Increment()
+			// Don't reset the popularity when the source has no popularity.
+			if 0 < c.Popularity && int64(c.Popularity) != vpItem.num("popularity") {
+				vpItem["popularity"] = dynamoN(int64(c.Popularity))
+				changed = true
+			}
+			if c.Title != "" && c.Title != vpItem.str("title") {
+				vpItem["title"] = dynamoS(c.Title)
+				changed = true
+			}
+			if hasVersion(c.Version) {
+				versions = append(versions, dynamoKey(dynamoVersionPrefix+c.Version, vp))
+			}
+
+			sk := dynamoCpePrefix + c.CpeURI
+			item, ok := puts[sk]
+			if !ok {
+				item = dynamoKey(dynamoVPPrefix+vp, sk)
+				if old, ok := existing[sk]; ok {
+					item = old
+				}
+			}
+			sources := sourcesOf(item)
+			if c.FetchType != "" {
+				sources = append(sources, c.FetchType)
+			}
+			item["sources"] = dynamoS(joinSources(sources))
+			item["deprecated"] = dynamoBool(item.boolean("deprecated") || c.Deprecated)
+			if c.DeprecatedBy != "" {
+				item["deprecatedBy"] = dynamoS(c.DeprecatedBy)
+			}
+			if c.CpeNameID != "" {
+				item["cpeNameId"] = dynamoS(c.CpeNameID)
+				nameID := dynamoKey(dynamoCpeNameIDs, c.CpeNameID)
+				nameID["cpeURI"], nameID["vendorProduct"] = dynamoS(c.CpeURI), dynamoS(vp)
+				nameIDs = append(nameIDs, nameID)
+			}
+			puts[sk] = item
+		}
+		if changed {
+			changedVPs = append(changedVPs, vpItem)
+		}
+
+		items = make([]dynamoItem, 0, len(puts))
+		for _, item := range puts {
+			items = append(items, item)
+		}
+		if err := d.batchWrite(ctx, items, nil); err != nil {
+			return xerrors.Errorf("Failed to BatchWriteItem CPEs. err: %w", err)
+		}
+	}
+	if err := d.batchWrite(ctx, append(append(changedVPs, dedupItems(versions)...), dedupItems(nameIDs)...), nil); err != nil {
+		return xerrors.Errorf("Failed to BatchWriteItem vendorProduct. err: %w", err)
+	}
+	bar.Finish()
+	d.log.Info(fmt.Sprintf("Refreshed %d CPEs.", len(cpes)))
+	return nil
+}
+
+// joinSources returns the sources without the duplicates, sorted and comma separated
+func joinSources(sources []models.FetchType) string {
+	uniq := map[string]bool{}
+	for _, s := range sources {
+		uniq[string(s)] = true
+	}
+	ss := make([]string, 0, len(uniq))
+	for s := range uniq {
+		ss = append(ss, s)
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ",")
+}
+
+// dedupItems removes the items of the same key, which a BatchWriteItem rejects
+func dedupItems(items []dynamoItem) []dynamoItem {
+	seen := map[string]bool{}
+	uniq := []dynamoItem{}
+	for _, item := range items {
+		key := item.str("PK") + "\x00" + item.str("SK")
+		if !seen[key] {
+			seen[key] = true
+			uniq = append(uniq, item)
+		}
+	}
+	return uniq
+}
+
+// ReplaceCpes inserts the CPEs as InsertCpes does. The CPEs of source missing from them are kept,
+// since the items of the vendor/products hold the CPEs of every source.
+func (d *DynamoDBDriver) ReplaceCpes(_ models.FetchType, cpes []models.CategorizedCpe) error {
+	return d.InsertCpes(cpes)
+}
+
+// InsertDistroPackages replaces the mapping of the distribution packages
+func (d *DynamoDBDriver) InsertDistroPackages(packages []models.DistroPackage) error {
+	ctx := context.Background()
+	grouped := map[string][]models.DistroPackage{}
+	for _, p := range packages {
+		sk := p.Distro + dynamoSep + p.Package
+		grouped[sk] = append(grouped[sk], p)
+	}
+	puts := make([]dynamoItem, 0, len(grouped))
+	for sk, ps := range grouped {
+		j, err := json.Marshal(ps)
+		if err != nil {
+			return xerrors.Errorf("Failed to marshal distribution packages. err: %w", err)
+		}
+		item := dynamoKey(dynamoDistro, sk)
+		item["json"] = dynamoS(string(j))
+		puts = append(puts, item)
+	}
+
+	items, err := d.query(ctx, dynamoQuery{pk: dynamoDistro})
+	if err != nil {
+		return xerrors.Errorf("Failed to Query distribution packages. err: %w", err)
+	}
+	deletes := []dynamoItem{}
+	for _, item := range items {
+		if _, ok := grouped[item.str("SK")]; !ok {
+			deletes = append(deletes, dynamoKey(dynamoDistro, item.str("SK")))
+		}
+	}
+	if err := d.batchWrite(ctx, puts, deletes); err != nil {
+		return xerrors.Errorf("Failed to BatchWriteItem distribution packages. err: %w", err)
+	}
+	return nil
+}
+
+// GetDistroPackages returns the vendor/products the package of the distribution is mapped to
+func (d *DynamoDBDriver) GetDistroPackages(distro, pkg string) ([]models.DistroPackage, error) {
+	packages := []models.DistroPackage{}
+	item, err := d.getItem(context.Background(), dynamoDistro, distro+dynamoSep+pkg)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to GetItem distribution packages. err: %w", err)
+	}
+	if item == nil {
+		return packages, nil
+	}
+	if err := json.Unmarshal([]byte(item.str("json")), &packages); err != nil {
+		return nil, xerrors.Errorf("Failed to unmarshal distribution packages. err: %w", err)
+	}
+	return packages, nil
+}
+
+// GetCpesByDistroPackage returns the CPEs of the package of the distribution
+func (d *DynamoDBDriver) GetCpesByDistroPackage(distro, pkg string) ([]string, []string, error) {
+	return cpesByDistroPackage(d, distro, pkg)
+}
+
+// ReplaceKnownExploited replaces the vendor/products of the CISA Known Exploited Vulnerabilities catalog
+func (d *DynamoDBDriver) ReplaceKnownExploited(products []models.KnownExploitedProduct) error {
+	ctx := context.Background()
+	puts := make([]dynamoItem, 0, len(products))
+	keep := map[string]bool{}
+	for _, p := range products {
+		sk := p.Vendor + dynamoSep + p.Product
+		item := dynamoKey(dynamoKnownExploited, sk)
+		item["cves"] = dynamoN(int64(p.CVEs))
+		puts = append(puts, item)
+		keep[sk] = true
+	}
+
+	items, err := d.query(ctx, dynamoQuery{pk: dynamoKnownExploited})
+	if err != nil {
+		return xerrors.Errorf("Failed to Query known exploited products. err: %w", err)
+	}
+	deletes := []dynamoItem{}
+	for _, item := range items {
+		if !keep[item.str("SK")] {
+			deletes = append(deletes, dynamoKey(dynamoKnownExploited, item.str("SK")))
+		}
+	}
+	if err := d.batchWrite(ctx, puts, deletes); err != nil {
+		return xerrors.Errorf("Failed to BatchWriteItem known exploited products. err: %w", err)
+	}
+	return nil
+}
+
+// GetKnownExploited returns the vendor/products of the CISA Known Exploited Vulnerabilities catalog
+func (d *DynamoDBDriver) GetKnownExploited() ([]models.KnownExploitedProduct, error) {
+	items, err := d.query(context.Background(), dynamoQuery{pk: dynamoKnownExploited})
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to Query known exploited products. err: %w", err)
+	}
+	products := make([]models.KnownExploitedProduct, 0, len(items))
+	for _, item := range items {
+		ss := strings.SplitN(item.str("SK"), dynamoSep, 2)
+		if len(ss) != 2 {
+			continue
+		}
+		products = append(products, models.KnownExploitedProduct{Vendor: ss[0], Product: ss[1], CVEs: int(item.num("cves"))})
+	}
+	return products, nil
+}
+
+// IsDeprecated : IsDeprecated
+func (d *DynamoDBDriver) IsDeprecated(cpeURI string) (bool, error) {
+	wfn, err := naming.UnbindURI(cpeURI)
+	if err != nil {
+		// a malformed URI can't be in the dictionary
+		return false, nil
+	}
+	vp := wfn.GetString(common.AttributeVendor) + dynamoSep + wfn.GetString(common.AttributeProduct)
+	item, err := d.getItem(context.Background(), dynamoVPPrefix+vp, dynamoCpePrefix+cpeURI)
+	if err != nil {
+		return false, fmt.Errorf("Failed to get deprecated CPE. err :%s", err)
+	}
+	return item.boolean("deprecated"), nil
+}
+
+// GC removes nothing. Every item is written along with the vendor/product it belongs to,
+// and DynamoDB reclaims the space itself.
+func (d *DynamoDBDriver) GC() ([]GCStat, error) {
+	return []GCStat{}, nil
+}
+
+// CheckIntegrity finds the vendor/products without the vendor or the product and the malformed CPE URIs.
+// A key can't hold duplicates, so there are none to find. With repair, they are removed.
+func (d *DynamoDBDriver) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	ctx := context.Background()
+	report := &IntegrityReport{Issues: []IntegrityIssue{}}
+
+	vpItems, err := d.vendorProductItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deletes := []dynamoItem{}
+	for _, vpItem := range vpItems {
+		vp := vpItem.str("SK")
+		items, err := d.cpeItems(ctx, vp)
+		if err != nil {
+			return nil, err
+		}
+		ss := strings.SplitN(vp, dynamoSep, 2)
+		if len(ss) != 2 || ss[0] == "" || ss[1] == "" {
+			report.Issues = append(report.Issues, IntegrityIssue{Kind: IssueEmptyVendor, CpeURI: vp, Rows: 1})
+			deletes = append(deletes, dynamoKey(dynamoVendorProducts, vp))
+			for _, item := range items {
+				deletes = append(deletes, dynamoKey(item.str("PK"), item.str("SK")))
+			}
+			continue
+		}
+		for _, item := range items {
+			cpeURI := cpeURIOf(item)
+			if _, err := naming.UnbindURI(cpeURI); err == nil {
+				continue
+			}
+			report.Issues = append(report.Issues, IntegrityIssue{Kind: IssueMalformedURI, CpeURI: cpeURI, Rows: 1})
+			deletes = append(deletes, dynamoKey(item.str("PK"), item.str("SK")))
+		}
+	}
+	if !repair {
+		return report, nil
+	}
+	if err := d.batchWrite(ctx, nil, deletes); err != nil {
+		return nil, xerrors.Errorf("Failed to BatchWriteItem deletes. err: %w", err)
+	}
+	report.Repaired = int64(len(report.Issues))
+	return report, nil
+}
@@ -0,0 +1,193 @@
+//go:build !nodynamodb
+// +build !nodynamodb
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// dynamoValue is an attribute value of DynamoDB. The driver uses strings, numbers and booleans only.
+type dynamoValue struct {
+	S    *string `json:"S,omitempty"`
+	N    *string `json:"N,omitempty"`
+	BOOL *bool   `json:"BOOL,omitempty"`
+}
+
+// dynamoItem is an item of DynamoDB
+type dynamoItem map[string]dynamoValue
+
+func dynamoS(s string) dynamoValue {
+	return dynamoValue{S: &s}
+}
+
+func dynamoN(n int64) dynamoValue {
+	s := fmt.Sprint(n)
+	return dynamoValue{N: &s}
+}
+
+func dynamoBool(b bool) dynamoValue {
+	return dynamoValue{BOOL: &b}
+}
+
+// str returns the string attribute, "" when it's missing
+func (i dynamoItem) str(name string) string {
+	if v, ok := i[name]; ok && v.S != nil {
+		return *v.S
+	}
+	return ""
+}
+
+// num returns the number attribute, 0 when it's missing
+func (i dynamoItem) num(name string) int64 {
+	var n int64
+	if v, ok := i[name]; ok && v.N != nil {
+		_, _ = fmt.Sscan(*v.N, &n)
+	}
+	return n
+}
+
+// boolean returns the boolean attribute, false when it's missing
+func (i dynamoItem) boolean(name string) bool {
+	if v, ok := i[name]; ok && v.BOOL != nil {
+		return *v.BOOL
+	}
+	return false
+}
+
+// dynamoError is an error response of DynamoDB
+type dynamoError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+	Status  int    `json:"-"`
+}
+
+func (e *dynamoError) Error() string {
+	return fmt.Sprintf("DynamoDB error. status code: %d, type: %s, message: %s", e.Status, e.Type, e.Message)
+}
+
+// is tells whether the error is of the exception, e.g. ResourceNotFoundException
+func (e *dynamoError) is(exception string) bool {
+	return strings.HasSuffix(e.Type, "#"+exception) || e.Type == exception
+}
+
+// isDynamoError tells whether err is the exception of DynamoDB
+func isDynamoError(err error, exception string) bool {
+	var e *dynamoError
+	return xerrors.As(err, &e) && e.is(exception)
+}
+
+// wrapDynamoLocked marks the throttling errors as ErrLocked, which succeed when retried later
+func wrapDynamoLocked(err error) error {
+	for _, exception := range []string{"ProvisionedThroughputExceededException", "ThrottlingException", "RequestLimitExceeded", "TransactionConflictException"} {
+		if isDynamoError(err, exception) {
+			return &lockedError{err: err}
+		}
+	}
+	return err
+}
+
+// dynamoClient calls the JSON API of DynamoDB, signed with AWS Signature Version 4
+type dynamoClient struct {
+	endpoint    string
+	region      string
+	credentials awsCredentials
+	http        *http.Client
+	// now is replaced by the tests
+	now func() time.Time
+}
+
+// newDynamoClient parses dynamodb://<table>?region=<region>&endpoint=<URL>.
+// The credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN as on AWS Lambda,
+// and the region from AWS_REGION (or AWS_DEFAULT_REGION) unless it's in the URL.
+func newDynamoClient(dbPath string, timeout time.Duration) (*dynamoClient, string, error) {
+	u, err := url.Parse(dbPath)
+	if err != nil || u.Scheme != "dynamodb" || u.Host == "" {
+		return nil, "", fmt.Errorf("Invalid DynamoDB URL, expected dynamodb://<table>?region=<region>: %s", dbPath)
+	}
+	table := u.Host
+
+	region := u.Query().Get("region")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, "", fmt.Errorf("The region of DynamoDB is not given. Set ?region= or AWS_REGION")
+	}
+	endpoint := u.Query().Get("endpoint")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://dynamodb.%s.amazonaws.com", region)
+	}
+
+	c := &dynamoClient{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		region:   region,
+		credentials: awsCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		},
+		http: &http.Client{Timeout: 60 * time.Second},
+		now:  time.Now,
+	}
+	if 0 < timeout {
+		c.http.Timeout = timeout
+	}
+	if c.credentials.AccessKeyID == "" || c.credentials.SecretAccessKey == "" {
+		return nil, "", fmt.Errorf("The credentials of DynamoDB are not given. Set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return c, table, nil
+}
+
+// call calls the operation of the API, e.g. PutItem, with in as the request and out as the response
+func (c *dynamoClient) call(ctx context.Context, op string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal %s request. err: %w", op, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return xerrors.Errorf("Failed to create %s request. err: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810."+op)
+	signV4(req, body, c.credentials, c.region, "dynamodb", c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return xerrors.Errorf("Failed to call %s. err: %w", op, err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return xerrors.Errorf("Failed to read %s response. err: %w", op, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := &dynamoError{Status: resp.StatusCode}
+		if err := json.Unmarshal(b, e); err != nil {
+			e.Message = string(b)
+		}
+		return wrapDynamoLocked(e)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return xerrors.Errorf("Failed to unmarshal %s response. err: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+//go:build !nodynamodb
+// +build !nodynamodb
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"golang.org/x/xerrors"
+)
+
+// fakeDynamo is an in-memory DynamoDB serving the operations the driver calls
+type fakeDynamo struct {
+	mu     sync.Mutex
+	tables map[string]map[string]map[string]dynamoItem
+	// pageSize is the number of the items in a page of Query, small to follow the pages
+	pageSize int
+	// unprocessed makes the first request of every BatchWriteItem unprocessed once
+	unprocessed bool
+}
+
+func (f *fakeDynamo) call(ctx context.Context, op string, in, out interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	var req struct {
+		TableName                 string
+		Key                       dynamoItem
+		Item                      dynamoItem
+		ReturnValues              string
+		KeyConditionExpression    string
+		ExpressionAttributeValues dynamoItem
+		ScanIndexForward          bool
+		Limit                     int
+		ExclusiveStartKey         dynamoItem
+		RequestItems              map[string][]struct {
+			PutRequest    *struct{ Item dynamoItem }
+			DeleteRequest *struct{ Key dynamoItem }
+		}
+	}
+	if err := json.Unmarshal(b, &req); err != nil {
+		return err
+	}
+	notFound := &dynamoError{Type: "com.amazonaws.dynamodb.v20120810#ResourceNotFoundException", Status: http.StatusBadRequest}
+	table := f.tables[req.TableName]
+	if table == nil && op != "CreateTable" && op != "BatchWriteItem" {
+		return notFound
+	}
+
+	var resp interface{}
+	switch op {
+	case "DescribeTable":
+		resp = map[string]interface{}{"Table": map[string]string{"TableStatus": "ACTIVE"}}
+	case "CreateTable":
+		f.tables[req.TableName] = map[string]map[string]dynamoItem{}
+	case "PutItem":
+		f.put(table, req.Item)
+	case "GetItem":
+		resp = map[string]interface{}{"Item": table[req.Key.str("PK")][req.Key.str("SK")]}
+	case "DeleteItem":
+		old := table[req.Key.str("PK")][req.Key.str("SK")]
+		delete(table[req.Key.str("PK")], req.Key.str("SK"))
+		resp = map[string]interface{}{"Attributes": old}
+	case "Query":
+		sks := []string{}
+		for sk := range table[req.ExpressionAttributeValues.str(":pk")] {
+			if strings.Contains(req.KeyConditionExpression, "SK >= :sk") && sk < req.ExpressionAttributeValues.str(":sk") {
+				continue
+			}
+			sks = append(sks, sk)
+		}
+		sort.Strings(sks)
+		if !req.ScanIndexForward {
+			sort.Sort(sort.Reverse(sort.StringSlice(sks)))
+		}
+		if req.ExclusiveStartKey != nil {
+			for i, sk := range sks {
+				if sk == req.ExclusiveStartKey.str("SK") {
+					sks = sks[i+1:]
+					break
+				}
+			}
+		}
+		n := f.pageSize
+		if 0 < req.Limit && req.Limit < n {
+			n = req.Limit
+		}
+		page := map[string]interface{}{}
+		if n < len(sks) {
+			sks = sks[:n]
+			page["LastEvaluatedKey"] = table[req.ExpressionAttributeValues.str(":pk")][sks[n-1]]
+		}
+		items := []dynamoItem{}
+		for _, sk := range sks {
+			items = append(items, table[req.ExpressionAttributeValues.str(":pk")][sk])
+		}
+		page["Items"] = items
+		resp = page
+	case "BatchWriteItem":
+		unprocessed := map[string][]interface{}{}
+		for name, requests := range req.RequestItems {
+			if 25 < len(requests) {
+				return &dynamoError{Type: "ValidationException", Message: "too many items", Status: http.StatusBadRequest}
+			}
+			if f.tables[name] == nil {
+				return notFound
+			}
+			for i, r := range requests {
+				if i == 0 && f.unprocessed && r.PutRequest != nil && r.PutRequest.Item["retried"].BOOL == nil {
+					r.PutRequest.Item["retried"] = dynamoBool(true)
+					unprocessed[name] = append(unprocessed[name], map[string]interface{}{"PutRequest": r.PutRequest})
+					continue
+				}
+				if r.PutRequest != nil {
+					delete(r.PutRequest.Item, "retried")
+					f.put(f.tables[name], r.PutRequest.Item)
+				}
+				if r.DeleteRequest != nil {
+					delete(f.tables[name][r.DeleteRequest.Key.str("PK")], r.DeleteRequest.Key.str("SK"))
+				}
+			}
+		}
+		resp = map[string]interface{}{"UnprocessedItems": unprocessed}
+	default:
+		return &dynamoError{Type: "UnknownOperationException", Status: http.StatusBadRequest}
+	}
+
+	if out == nil || resp == nil {
+		return nil
+	}
+	if b, err = json.Marshal(resp); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+func (f *fakeDynamo) put(table map[string]map[string]dynamoItem, item dynamoItem) {
+	pk := item.str("PK")
+	if table[pk] == nil {
+		table[pk] = map[string]dynamoItem{}
+	}
+	table[pk][item.str("SK")] = item
+}
+
+func setupDynamoDB(tb testing.TB) DB {
+	driver := &DynamoDBDriver{
+		name:  dialectDynamoDB,
+		log:   log15.Root(),
+		api:   &fakeDynamo{tables: map[string]map[string]map[string]dynamoItem{}, pageSize: 3, unprocessed: true},
+		table: "cpe",
+	}
+	if err := driver.MigrateDB(); err != nil {
+		tb.Fatalf("Failed to migrate db: %s", err)
+	}
+	return driver
+}
+
+func TestGetVendorProductsDynamoDB(t *testing.T) {
+	testGetVendorProducts(t, setupDynamoDB(t))
+}
+
+func TestGetCpesByVendorProductDynamoDB(t *testing.T) {
+	testGetCpesByVendorProduct(t, setupDynamoDB(t))
+}
+
+func TestGetVendorProductsByPopularityDynamoDB(t *testing.T) {
+	testGetVendorProductsByPopularity(t, setupDynamoDB(t))
+}
+
+func TestUpsertFetchMetaDynamoDB(t *testing.T) {
+	testUpsertFetchMeta(t, setupDynamoDB(t))
+}
+
+func TestFetchHistoryDynamoDB(t *testing.T) {
+	testFetchHistory(t, setupDynamoDB(t))
+}
+
+func TestAuditEntriesDynamoDB(t *testing.T) {
+	testAuditEntries(t, setupDynamoDB(t))
+}
+
+func TestWatchlistDynamoDB(t *testing.T) {
+	testWatchlist(t, setupDynamoDB(t))
+}
+
+func TestRejectedCpesDynamoDB(t *testing.T) {
+	testRejectedCpes(t, setupDynamoDB(t))
+}
+
+func TestGetProductsByVersionDynamoDB(t *testing.T) {
+	testGetProductsByVersion(t, setupDynamoDB(t))
+}
+
+func TestGetCpeDetailsByVendorProductDynamoDB(t *testing.T) {
+	testGetCpeDetailsByVendorProduct(t, setupDynamoDB(t))
+}
+
+func TestGetVersionsByVendorProductDynamoDB(t *testing.T) {
+	testGetVersionsByVendorProduct(t, setupDynamoDB(t))
+}
+
+func TestGetSourcedCpesByVendorProductDynamoDB(t *testing.T) {
+	testGetSourcedCpesByVendorProduct(t, setupDynamoDB(t))
+}
+
+func TestCountCpesDynamoDB(t *testing.T) {
+	testCountCpes(t, setupDynamoDB(t))
+}
+
+func TestGetAttributeStatsDynamoDB(t *testing.T) {
+	testGetAttributeStats(t, setupDynamoDB(t))
+}
+
+func TestGetCpeByNameIDDynamoDB(t *testing.T) {
+	testGetCpeByNameID(t, setupDynamoDB(t))
+}
+
+func TestGetCpesByDistroPackageDynamoDB(t *testing.T) {
+	testGetCpesByDistroPackage(t, setupDynamoDB(t))
+}
+
+func TestKnownExploitedDynamoDB(t *testing.T) {
+	testKnownExploited(t, setupDynamoDB(t))
+}
+
+func TestGetProductSummariesDynamoDB(t *testing.T) {
+	testGetProductSummaries(t, setupDynamoDB(t))
+}
+
+func TestContractDynamoDB(t *testing.T) {
+	testContract(t, setupDynamoDB)
+}
+
+func TestDynamoDBDriver_IsDeprecated(t *testing.T) {
+	driver := setupDynamoDB(t)
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+	for cpeURI, expected := range map[string]bool{
+		"cpe:/a:vendorName6:productName6:6.0::~~~targetSoftware6~targetHardware6~":   true,
+		`cpe:/a:vendorName1:productName1-2:1.2::~~~targetSoftware1~targetHardware1~`: false,
+		"malformed": false,
+	} {
+		actual, err := driver.IsDeprecated(cpeURI)
+		if err != nil {
+			t.Errorf("%s: IsDeprecated: %s", cpeURI, err)
+		}
+		if actual != expected {
+			t.Errorf("%s: actual %t, expected %t", cpeURI, actual, expected)
+		}
+	}
+}
+
+// TestWildcardDynamoDB checks a LIKE pattern with a wildcard fails rather than matching the names as they are
+func TestWildcardDynamoDB(t *testing.T) {
+	driver := setupDynamoDB(t)
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+	if _, _, err := driver.GetCpesByVendorProduct("ntp", "%"); !xerrors.Is(err, ErrWildcardUnsupported) {
+		t.Errorf("actual %v, expected ErrWildcardUnsupported", err)
+	}
+	if _, err := driver.GetSourcedCpesByVendorProduct("nt_", "ntp", nil); !xerrors.Is(err, ErrWildcardUnsupported) {
+		t.Errorf("actual %v, expected ErrWildcardUnsupported", err)
+	}
+	if cpeURIs, _, err := driver.GetCpesByVendorProduct("ntp", "ntp"); err != nil || len(cpeURIs) != 2 {
+		t.Errorf("actual %#v, %v, expected the CPEs of ntp", cpeURIs, err)
+	}
+}
+
+// TestSignV4 checks the signing with the post-vanilla case of the AWS Signature Version 4 test suite
+func TestSignV4(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, cred, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"
+	if actual := req.Header.Get("Authorization"); actual != expected {
+		t.Errorf("actual %s, expected %s", actual, expected)
+	}
+}
+
+func BenchmarkInsertCpesDynamoDB(b *testing.B) {
+	benchInsertCpes(b, setupDynamoDB(b))
+}
+
+func BenchmarkGetVendorProductsDynamoDB(b *testing.B) {
+	benchGetVendorProducts(b, setupDynamoDB(b))
+}
+
+func BenchmarkGetCpesByVendorProductDynamoDB(b *testing.B) {
+	benchGetCpesByVendorProduct(b, setupDynamoDB(b))
+}
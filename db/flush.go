@@ -0,0 +1,22 @@
+package db
+
+// FlushCache drops what driver keeps of the DB beneath it, so that the reads see the DB as it is now, e.g. after a fetch by another process
+// or a cache gone inconsistent: the snapshot of WithInMemory is loaded again, and the cache of the tiered dbtype is taken as out of sync,
+// its listings read from the store. The DBs without a cache are left as they are.
+func FlushCache(driver DB) error {
+	switch d := driver.(type) {
+	case tracedDriver:
+		return FlushCache(d.DB)
+	case readOnlyDriver:
+		return FlushCache(d.DB)
+	case *memoryDriver:
+		// the cache beneath first, which the snapshot is loaded from
+		if err := FlushCache(d.DB); err != nil {
+			return err
+		}
+		return d.reload()
+	case *TieredDriver:
+		d.flushCache()
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+// Hashes are the SHA-256 of the CPEs of a DB by the vendor and by the vendor/product,
+// compared with those of another DB to find where they diverge without transferring the CPEs
+type Hashes struct {
+	// Total is the hash of all the vendors, equal when the DBs are in sync
+	Total string
+	// Vendors are the hashes of the products of each vendor
+	Vendors map[string]string
+	// Products are the hashes of the CPEs of each product by the vendor
+	Products map[string]map[string]string
+}
+
+// ComputeHashes hashes the CPEs of driver as the API serves them: the CPE URI, the sources, the deprecation,
+// the CPEs replacing it and the cpeNameId, so that the hashes are equal among the DB types, e.g. a PostgreSQL and its redis replica.
+// The generation and the time of the changes, which differ among the DBs fetched on their own, aren't hashed.
+func ComputeHashes(driver DB) (*Hashes, error) {
+	vendorProducts, err := driver.GetVendorProducts()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get the vendor/products. err: %w", err)
+	}
+	cpes, err := loadAllCpes(driver, vendorProducts, log15.Root())
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to load the CPEs. err: %w", err)
+	}
+
+	byProduct := map[string]map[string][]models.CategorizedCpe{}
+	for _, c := range cpes {
+		products, ok := byProduct[c.Vendor]
+		if !ok {
+			products = map[string][]models.CategorizedCpe{}
+			byProduct[c.Vendor] = products
+		}
+		products[c.Product] = append(products[c.Product], c)
+	}
+
+	h := &Hashes{Vendors: map[string]string{}, Products: map[string]map[string]string{}}
+	for vendor, products := range byProduct {
+		hashes := map[string]string{}
+		for product, cpes := range products {
+			hashes[product] = hashSourcedCpes(mergeSources(cpes))
+		}
+		h.Products[vendor] = hashes
+		h.Vendors[vendor] = hashMap(hashes)
+	}
+	h.Total = hashMap(h.Vendors)
+	return h, nil
+}
+
+// hashSourcedCpes returns the SHA-256 of the CPEs regardless of the order of them, their sources and the CPEs replacing them
+func hashSourcedCpes(cpes []models.SourcedCpe) string {
+	lines := make([]string, 0, len(cpes))
+	for _, c := range cpes {
+		c.Sources = append([]models.FetchType{}, c.Sources...)
+		sort.Slice(c.Sources, func(i, j int) bool { return c.Sources[i] < c.Sources[j] })
+		c.DeprecatedBy = append([]string{}, c.DeprecatedBy...)
+		sort.Strings(c.DeprecatedBy)
+		b, _ := json.Marshal(c)
+		lines = append(lines, string(b))
+	}
+	sort.Strings(lines)
+	return hashLines(lines)
+}
+
+// hashMap returns the SHA-256 of the key=value lines of hashes in the order of the keys
+func hashMap(hashes map[string]string) string {
+	lines := make([]string, 0, len(hashes))
+	for k, v := range hashes {
+		lines = append(lines, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(lines)
+	return hashLines(lines)
+}
+
+func hashLines(lines []string) string {
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte("\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadAllCpes returns all the CPEs of driver by a query where the driver tracks the changes,
+// otherwise by the vendor/products
+func loadAllCpes(driver DB, vendorProducts []string, log log15.Logger) ([]models.CategorizedCpe, error) {
+	cpes, err := driver.GetCpesChangedSince(0, time.Time{})
+	if err == nil {
+		return cpes, nil
+	}
+	log.Info("Loading the CPEs by the vendor/products", "reason", err)
+
+	cpes = []models.CategorizedCpe{}
+	for _, vp := range vendorProducts {
+		ss := strings.SplitN(vp, "::", 2)
+		if len(ss) != 2 {
+			continue
+		}
+		sourced, err := driver.GetSourcedCpesByVendorProduct(LikePattern(ss[0], false), LikePattern(ss[1], false), nil)
+		if err != nil {
+			return nil, err
+		}
+		cpes = append(cpes, splitSources(sourced)...)
+	}
+	return cpes, nil
+}
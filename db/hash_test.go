@@ -0,0 +1,77 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package db
+
+import (
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func TestComputeHashesSqlite(t *testing.T) {
+	drivers := []DB{}
+	for i := 0; i < 2; i++ {
+		driver, _, err := NewDB("sqlite3", ":memory:", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			_ = driver.CloseDB()
+		}()
+		if err := prepareTestData(driver); err != nil {
+			t.Fatalf("Inserting CPEs: %s", err)
+		}
+		drivers = append(drivers, driver)
+	}
+
+	local, err := ComputeHashes(drivers[0])
+	if err != nil {
+		t.Fatalf("ComputeHashes: %s", err)
+	}
+	remote, err := ComputeHashes(drivers[1])
+	if err != nil {
+		t.Fatalf("ComputeHashes: %s", err)
+	}
+	if local.Total != remote.Total {
+		t.Errorf("expected the same totals, actual %s and %s", local.Total, remote.Total)
+	}
+	if len(local.Vendors) != 8 || len(local.Products["vendorName1"]) != 2 {
+		t.Errorf("actual vendors %v, products of vendorName1 %v", local.Vendors, local.Products["vendorName1"])
+	}
+
+	if err := drivers[1].InsertCpes([]models.CategorizedCpe{
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.9", Part: "a", Vendor: "ntp", Product: "ntp", Version: "4\\.2\\.9"},
+	}); err != nil {
+		t.Fatalf("InsertCpes: %s", err)
+	}
+	if remote, err = ComputeHashes(drivers[1]); err != nil {
+		t.Fatalf("ComputeHashes: %s", err)
+	}
+	if local.Total == remote.Total {
+		t.Errorf("expected the totals to differ")
+	}
+	for vendor, hash := range local.Vendors {
+		if differ := remote.Vendors[vendor] != hash; differ != (vendor == "ntp") {
+			t.Errorf("vendor %s: actual differ %t", vendor, differ)
+		}
+	}
+}
+
+func TestHashSourcedCpes(t *testing.T) {
+	a := []models.SourcedCpe{
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.8", Sources: []models.FetchType{models.NVD, models.JVN}},
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.7", Deprecated: true, DeprecatedBy: []string{"cpe:/a:ntp:ntp:4.2.8", "cpe:/a:ntp:ntp:4.2.8:p1"}},
+	}
+	b := []models.SourcedCpe{
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.7", Deprecated: true, DeprecatedBy: []string{"cpe:/a:ntp:ntp:4.2.8:p1", "cpe:/a:ntp:ntp:4.2.8"}},
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.8", Sources: []models.FetchType{models.JVN, models.NVD}},
+	}
+	if hashSourcedCpes(a) != hashSourcedCpes(b) {
+		t.Errorf("expected the same hashes regardless of the order")
+	}
+	b[0].Deprecated = false
+	if hashSourcedCpes(a) == hashSourcedCpes(b) {
+		t.Errorf("expected the hashes to differ by the deprecation")
+	}
+}
@@ -0,0 +1,415 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// IAM authentications of RDB, connecting with a short-lived token as the password instead of a static one
+const (
+	// IAMAuthRDS authenticates to Amazon RDS with the IAM auth token signed by the AWS credentials
+	IAMAuthRDS = "rds"
+	// IAMAuthCloudSQL authenticates to Cloud SQL with the OAuth2 access token of the service account of the GCE metadata server
+	IAMAuthCloudSQL = "cloudsql"
+)
+
+// rdsTokenExpiry is how long an RDS IAM auth token is valid, the maximum RDS accepts
+const rdsTokenExpiry = 15 * time.Minute
+
+var (
+	// stsEndpoint is replaced by the tests
+	stsEndpoint = func(region string) string { return fmt.Sprintf("https://sts.%s.amazonaws.com", region) }
+	// ecsCredentialsURL is the base URL of AWS_CONTAINER_CREDENTIALS_RELATIVE_URI, the ECS agent, replaced by the tests
+	ecsCredentialsURL = func() string { return "http://169.254.170.2" }
+	// ec2MetadataURL is the base URL of IMDS, replaced by the tests
+	ec2MetadataURL = func() string {
+		if endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"); endpoint != "" {
+			return strings.TrimSuffix(endpoint, "/")
+		}
+		return "http://169.254.169.254"
+	}
+	// gceMetadataURL is the base URL of the GCE metadata server, replaced by the tests
+	gceMetadataURL = func() string {
+		if host := os.Getenv("GCE_METADATA_HOST"); host != "" {
+			return "http://" + host
+		}
+		return "http://metadata.google.internal"
+	}
+)
+
+// iamTarget is what a token is issued for
+type iamTarget struct {
+	// addr is host:port of the DB
+	addr string
+	user string
+	// withPassword returns the DSN with the token as the password
+	withPassword func(token string) string
+	sqlDriver    driver.Driver
+}
+
+// iamTargets parse the DSN of the dialects supporting the IAM authentications.
+// The dialect files register them like lockErrors.
+var iamTargets = map[string]func(dsn, auth string) (iamTarget, error){}
+
+// ValidateIAMAuth checks the IAM authentication is supported by the dbType
+func ValidateIAMAuth(dbType, auth string) error {
+	switch auth {
+	case "":
+		return nil
+	case IAMAuthRDS, IAMAuthCloudSQL:
+	default:
+		return fmt.Errorf("Unknown IAM authentication: %s, expected %s or %s", auth, IAMAuthRDS, IAMAuthCloudSQL)
+	}
+	if _, ok := iamTargets[dbType]; !ok {
+		return fmt.Errorf("The IAM authentication is supported by MySQL and PostgreSQL, not %s", dbType)
+	}
+	return nil
+}
+
+// openIAM opens the DB connecting with a fresh token of auth on every new connection of the pool,
+// since a token expires in minutes
+func openIAM(dialect, dsn, auth string, timeout time.Duration) (*sql.DB, error) {
+	if err := ValidateIAMAuth(dialect, auth); err != nil {
+		return nil, err
+	}
+	target, err := iamTargets[dialect](dsn, auth)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	if 0 < timeout {
+		client.Timeout = timeout
+	}
+
+	var token func(ctx context.Context) (string, error)
+	switch auth {
+	case IAMAuthRDS:
+		region, err := rdsRegion(target.addr)
+		if err != nil {
+			return nil, err
+		}
+		creds := &cachedToken{fetch: func(ctx context.Context) (string, time.Time, error) {
+			return fetchAWSCredentials(ctx, client, region)
+		}}
+		token = func(ctx context.Context) (string, error) {
+			j, err := creds.get(ctx)
+			if err != nil {
+				return "", err
+			}
+			var cred awsCredentials
+			if err := json.Unmarshal([]byte(j), &cred); err != nil {
+				return "", xerrors.Errorf("Failed to unmarshal the AWS credentials. err: %w", err)
+			}
+			return rdsAuthToken(target.addr, region, target.user, cred, time.Now()), nil
+		}
+	case IAMAuthCloudSQL:
+		access := &cachedToken{fetch: func(ctx context.Context) (string, time.Time, error) {
+			return fetchGCEAccessToken(ctx, client)
+		}}
+		token = access.get
+	}
+
+	db := sql.OpenDB(iamConnector{target: target, token: token})
+	// the connections outliving the tokens keep working, as the token is checked only on connecting
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// iamConnector connects to the target with the token as the password
+type iamConnector struct {
+	target iamTarget
+	token  func(ctx context.Context) (string, error)
+}
+
+func (c iamConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	token, err := c.token(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get the IAM auth token. err: %w", err)
+	}
+	return c.target.sqlDriver.Open(c.target.withPassword(token))
+}
+
+func (c iamConnector) Driver() driver.Driver {
+	return c.target.sqlDriver
+}
+
+// cachedToken returns the token fetched last until a minute before it expires
+type cachedToken struct {
+	fetch func(ctx context.Context) (string, time.Time, error)
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func (c *cachedToken) get(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Add(time.Minute).Before(c.expiresAt) {
+		return c.token, nil
+	}
+	token, expiresAt, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expiresAt = token, expiresAt
+	return token, nil
+}
+
+// rdsAuthToken returns the IAM auth token of RDS for the user, a URL presigned for the rds-db service without the scheme
+func rdsAuthToken(addr, region, user string, cred awsCredentials, now time.Time) string {
+	u := url.URL{Scheme: "https", Host: addr, Path: "/", RawQuery: url.Values{"Action": {"connect"}, "DBUser": {user}}.Encode()}
+	empty := sha256.Sum256(nil)
+	return strings.TrimPrefix(presignV4(u, hex.EncodeToString(empty[:]), cred, region, "rds-db", now, rdsTokenExpiry), "https://")
+}
+
+// rdsRegion returns AWS_REGION (or AWS_DEFAULT_REGION), or the region in the endpoint of RDS, e.g. <name>.<id>.us-east-1.rds.amazonaws.com
+func rdsRegion(addr string) (string, error) {
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(env); region != "" {
+			return region, nil
+		}
+	}
+	host := strings.Split(addr, ":")[0]
+	labels := strings.Split(host, ".")
+	for i, l := range labels {
+		if l == "rds" && 0 < i {
+			return labels[i-1], nil
+		}
+	}
+	return "", fmt.Errorf("The region of RDS is not given. Set AWS_REGION: %s", addr)
+}
+
+// fetchAWSCredentials returns the AWS credentials as JSON, found in the order of the default chain of the AWS SDKs:
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN,
+// AssumeRoleWithWebIdentity with AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN, e.g. of IAM roles for service accounts of EKS,
+// the container credentials of AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or AWS_CONTAINER_CREDENTIALS_FULL_URI, e.g. of the task role of ECS,
+// and the role of the EC2 instance from IMDSv2
+func fetchAWSCredentials(ctx context.Context, client *http.Client, region string) (string, time.Time, error) {
+	var (
+		cred      awsCredentials
+		expiresAt time.Time
+		err       error
+	)
+	switch {
+	case os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "":
+		cred = awsCredentials{AccessKeyID: os.Getenv("AWS_ACCESS_KEY_ID"), SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), SessionToken: os.Getenv("AWS_SESSION_TOKEN")}
+		// the environment of the process doesn't change, so they're read again an hour later only to keep up with the other sources
+		expiresAt = time.Now().Add(time.Hour)
+	case os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "" && os.Getenv("AWS_ROLE_ARN") != "":
+		cred, expiresAt, err = assumeRoleWithWebIdentity(ctx, client, region, os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN"))
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		cred, expiresAt, err = fetchContainerCredentials(ctx, client)
+	case strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true"):
+		return "", time.Time{}, fmt.Errorf("The AWS credentials are not given. Set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN, or AWS_CONTAINER_CREDENTIALS_RELATIVE_URI, or unset AWS_EC2_METADATA_DISABLED")
+	default:
+		cred, expiresAt, err = fetchInstanceCredentials(ctx, client)
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	j, err := json.Marshal(cred)
+	if err != nil {
+		return "", time.Time{}, xerrors.Errorf("Failed to marshal the AWS credentials. err: %w", err)
+	}
+	return string(j), expiresAt, nil
+}
+
+// assumeRoleWithWebIdentity returns the credentials of roleARN assumed with the web identity token in tokenFile
+func assumeRoleWithWebIdentity(ctx context.Context, client *http.Client, region, tokenFile, roleARN string) (awsCredentials, time.Time, error) {
+	identity, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to read the web identity token. path: %s, err: %w", tokenFile, err)
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = "go-cpe-dictionary"
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(identity))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stsEndpoint(region)+"/", strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to create AssumeRoleWithWebIdentity request. err: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to call AssumeRoleWithWebIdentity. err: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to read AssumeRoleWithWebIdentity response. err: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("Failed to call AssumeRoleWithWebIdentity. status: %d, body: %s", resp.StatusCode, b)
+	}
+	var res struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(b, &res); err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to unmarshal AssumeRoleWithWebIdentity response. err: %w", err)
+	}
+	c := res.Credentials
+	return awsCredentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken}, c.Expiration, nil
+}
+
+// fetchContainerCredentials returns the credentials of the container, e.g. of the task role of ECS,
+// from AWS_CONTAINER_CREDENTIALS_RELATIVE_URI on the ECS agent or AWS_CONTAINER_CREDENTIALS_FULL_URI,
+// authorized by AWS_CONTAINER_AUTHORIZATION_TOKEN or AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE, e.g. of EKS Pod Identity
+func fetchContainerCredentials(ctx context.Context, client *http.Client) (awsCredentials, time.Time, error) {
+	u := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		u = ecsCredentialsURL() + relative
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to create the container credentials request. err: %w", err)
+	}
+	authorization := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to read the container authorization token. path: %s, err: %w", path, err)
+		}
+		authorization = strings.TrimSpace(string(b))
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return fetchMetadataCredentials(client, req, "container")
+}
+
+// fetchInstanceCredentials returns the credentials of the role of the EC2 instance from IMDSv2,
+// getting the session token, the name of the role and then its credentials
+func fetchInstanceCredentials(ctx context.Context, client *http.Client) (awsCredentials, time.Time, error) {
+	// not on EC2, the metadata service doesn't answer, so it's given up soon
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	base := ec2MetadataURL()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, base+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to create the IMDS token request. err: %w", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("The AWS credentials are not given, nor found on IMDS. Set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN, or AWS_CONTAINER_CREDENTIALS_RELATIVE_URI. err: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to read the IMDS token. err: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("Failed to get the IMDS token. status: %d", resp.StatusCode)
+	}
+	token := string(b)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, base+"/latest/meta-data/iam/security-credentials/", nil)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to create the IMDS role request. err: %w", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	resp, err = client.Do(req)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to get the role of the instance. err: %w", err)
+	}
+	defer resp.Body.Close()
+	if b, err = ioutil.ReadAll(resp.Body); err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to read the role of the instance. err: %w", err)
+	}
+	role := strings.TrimSpace(strings.SplitN(string(b), "\n", 2)[0])
+	if resp.StatusCode != http.StatusOK || role == "" {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("The instance has no role. status: %d", resp.StatusCode)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, base+"/latest/meta-data/iam/security-credentials/"+role, nil)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to create the IMDS credentials request. err: %w", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	return fetchMetadataCredentials(client, req, "instance")
+}
+
+// fetchMetadataCredentials returns the credentials in the JSON of the container credentials and IMDS answering req
+func fetchMetadataCredentials(client *http.Client, req *http.Request, source string) (awsCredentials, time.Time, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to get the %s credentials. err: %w", source, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("Failed to get the %s credentials. status: %d", source, resp.StatusCode)
+	}
+	var res struct {
+		Code            string    `json:"Code"`
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return awsCredentials{}, time.Time{}, xerrors.Errorf("Failed to decode the %s credentials. err: %w", source, err)
+	}
+	// IMDS answers Code, while the container credentials don't
+	if res.Code != "" && res.Code != "Success" {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("Failed to get the %s credentials. code: %s", source, res.Code)
+	}
+	return awsCredentials{AccessKeyID: res.AccessKeyID, SecretAccessKey: res.SecretAccessKey, SessionToken: res.Token}, res.Expiration, nil
+}
+
+// fetchGCEAccessToken returns the OAuth2 access token of the default service account from the GCE metadata server,
+// e.g. of Workload Identity of GKE
+func fetchGCEAccessToken(ctx context.Context, client *http.Client) (string, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gceMetadataURL()+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", time.Time{}, xerrors.Errorf("Failed to create the metadata request. err: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, xerrors.Errorf("Failed to get the access token from the metadata server. err: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("Failed to get the access token from the metadata server. status: %d", resp.StatusCode)
+	}
+	var res struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", time.Time{}, xerrors.Errorf("Failed to decode the access token. err: %w", err)
+	}
+	return res.AccessToken, time.Now().Add(time.Duration(res.ExpiresIn) * time.Second), nil
+}
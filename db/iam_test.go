@@ -0,0 +1,322 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRDSAuthToken(t *testing.T) {
+	cred := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", SessionToken: "session"}
+	token := rdsAuthToken("db.abc.us-east-1.rds.amazonaws.com:5432", "us-east-1", "app", cred, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	if !strings.HasPrefix(token, "db.abc.us-east-1.rds.amazonaws.com:5432/?") {
+		t.Fatalf("expected the token without the scheme, actual %s", token)
+	}
+	u, err := url.Parse("https://" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	for k, v := range map[string]string{
+		"Action":               "connect",
+		"DBUser":               "app",
+		"X-Amz-Credential":     "AKIDEXAMPLE/20150830/us-east-1/rds-db/aws4_request",
+		"X-Amz-Date":           "20150830T123600Z",
+		"X-Amz-Expires":        "900",
+		"X-Amz-Security-Token": "session",
+		"X-Amz-SignedHeaders":  "host",
+	} {
+		if q.Get(k) != v {
+			t.Errorf("%s: expected %s, actual %s", k, v, q.Get(k))
+		}
+	}
+	if len(q.Get("X-Amz-Signature")) != 64 {
+		t.Errorf("expected a signature, actual %q", q.Get("X-Amz-Signature"))
+	}
+}
+
+func TestRDSRegion(t *testing.T) {
+	setenv(t, "AWS_REGION", "")
+	setenv(t, "AWS_DEFAULT_REGION", "")
+	region, err := rdsRegion("db.abc.ap-northeast-1.rds.amazonaws.com:3306")
+	if err != nil || region != "ap-northeast-1" {
+		t.Errorf("expected ap-northeast-1, actual %s, %v", region, err)
+	}
+	if _, err := rdsRegion("localhost:3306"); err == nil {
+		t.Error("expected an error without the region")
+	}
+	setenv(t, "AWS_REGION", "eu-west-1")
+	if region, _ := rdsRegion("localhost:3306"); region != "eu-west-1" {
+		t.Errorf("expected AWS_REGION, actual %s", region)
+	}
+}
+
+func TestCachedToken(t *testing.T) {
+	fetched := 0
+	expiresIn := time.Hour
+	c := cachedToken{fetch: func(ctx context.Context) (string, time.Time, error) {
+		fetched++
+		return fmt.Sprintf("token%d", fetched), time.Now().Add(expiresIn), nil
+	}}
+	for _, expected := range []string{"token1", "token1"} {
+		if token, _ := c.get(context.Background()); token != expected {
+			t.Errorf("expected %s, actual %s", expected, token)
+		}
+	}
+	// expiring within a minute is fetched again
+	c.expiresAt = time.Now().Add(30 * time.Second)
+	if token, _ := c.get(context.Background()); token != "token2" {
+		t.Errorf("expected token2, actual %s", token)
+	}
+}
+
+func TestFetchAWSCredentialsWebIdentity(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("Action") != "AssumeRoleWithWebIdentity" || r.Form.Get("WebIdentityToken") != "jwt" || r.Form.Get("RoleArn") != "arn:aws:iam::123456789012:role/app" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIA</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>session</SessionToken><Expiration>2030-01-01T00:00:00Z</Expiration>
+</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`)
+	}))
+	defer srv.Close()
+	orig := stsEndpoint
+	stsEndpoint = func(string) string { return srv.URL }
+	defer func() { stsEndpoint = orig }()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "AWS_ACCESS_KEY_ID", "")
+	setenv(t, "AWS_SECRET_ACCESS_KEY", "")
+	setenv(t, "AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	setenv(t, "AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/app")
+
+	j, expiresAt, err := fetchAWSCredentials(context.Background(), srv.Client(), "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"AccessKeyID":"ASIA","SecretAccessKey":"secret","SessionToken":"session"}`; j != expected {
+		t.Errorf("expected %s, actual %s", expected, j)
+	}
+	if !expiresAt.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the expiration, actual %s", expiresAt)
+	}
+}
+
+// unsetAWSCredentials clears the sources of the AWS credentials preferred to the one tested
+func unsetAWSCredentials(t *testing.T) {
+	for _, env := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", "AWS_EC2_METADATA_DISABLED"} {
+		setenv(t, env, "")
+	}
+}
+
+func TestFetchAWSCredentialsContainer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/credentials/task" || r.Header.Get("Authorization") != "secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"AccessKeyId":"ASIA","SecretAccessKey":"secret","Token":"session","Expiration":"2030-01-01T00:00:00Z"}`)
+	}))
+	defer srv.Close()
+	orig := ecsCredentialsURL
+	ecsCredentialsURL = func() string { return srv.URL }
+	defer func() { ecsCredentialsURL = orig }()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	unsetAWSCredentials(t)
+	setenv(t, "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/v2/credentials/task")
+	setenv(t, "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", tokenFile)
+
+	j, expiresAt, err := fetchAWSCredentials(context.Background(), srv.Client(), "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"AccessKeyID":"ASIA","SecretAccessKey":"secret","SessionToken":"session"}`; j != expected {
+		t.Errorf("expected %s, actual %s", expected, j)
+	}
+	if !expiresAt.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the expiration, actual %s", expiresAt)
+	}
+}
+
+func TestFetchAWSCredentialsInstance(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+			if r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, "imds-token")
+			return
+		}
+		if r.Method != http.MethodGet || r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "app-role")
+		case "/latest/meta-data/iam/security-credentials/app-role":
+			fmt.Fprint(w, `{"Code":"Success","Type":"AWS-HMAC","AccessKeyId":"ASIA","SecretAccessKey":"secret","Token":"session","Expiration":"2030-01-01T00:00:00Z"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	orig := ec2MetadataURL
+	ec2MetadataURL = func() string { return srv.URL }
+	defer func() { ec2MetadataURL = orig }()
+	unsetAWSCredentials(t)
+
+	j, expiresAt, err := fetchAWSCredentials(context.Background(), srv.Client(), "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"AccessKeyID":"ASIA","SecretAccessKey":"secret","SessionToken":"session"}`; j != expected {
+		t.Errorf("expected %s, actual %s", expected, j)
+	}
+	if !expiresAt.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the expiration, actual %s", expiresAt)
+	}
+
+	setenv(t, "AWS_EC2_METADATA_DISABLED", "true")
+	if _, _, err := fetchAWSCredentials(context.Background(), srv.Client(), "us-east-1"); err == nil {
+		t.Error("expected an error with AWS_EC2_METADATA_DISABLED")
+	}
+}
+
+func TestFetchGCEAccessToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`)
+	}))
+	defer srv.Close()
+	orig := gceMetadataURL
+	gceMetadataURL = func() string { return srv.URL }
+	defer func() { gceMetadataURL = orig }()
+
+	token, expiresAt, err := fetchGCEAccessToken(context.Background(), srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "ya29.token" {
+		t.Errorf("expected ya29.token, actual %s", token)
+	}
+	if time.Until(expiresAt) < 59*time.Minute {
+		t.Errorf("expected to expire in an hour, actual %s", expiresAt)
+	}
+}
+
+func TestIAMTargets(t *testing.T) {
+	var tests = []struct {
+		dialect  string
+		dsn      string
+		auth     string
+		addr     string
+		user     string
+		password string
+		wantErr  bool
+	}{
+		{
+			dialect:  dialectMysql,
+			dsn:      "app@tcp(db.abc.us-east-1.rds.amazonaws.com:3306)/cpe?parseTime=true&tls=true",
+			auth:     IAMAuthRDS,
+			addr:     "db.abc.us-east-1.rds.amazonaws.com:3306",
+			user:     "app",
+			password: "app:tok%en@tcp(db.abc.us-east-1.rds.amazonaws.com:3306)/cpe?allowCleartextPasswords=true&parseTime=true&tls=true",
+		},
+		{
+			dialect: dialectMysql,
+			dsn:     "app@tcp(localhost:3306)/cpe?parseTime=true",
+			auth:    IAMAuthCloudSQL,
+			wantErr: true,
+		},
+		{
+			dialect:  dialectPostgreSQL,
+			dsn:      "postgres://app@db.abc.us-east-1.rds.amazonaws.com/cpe?sslmode=require",
+			auth:     IAMAuthRDS,
+			addr:     "db.abc.us-east-1.rds.amazonaws.com:5432",
+			user:     "app",
+			password: " password='tok%en'",
+		},
+		{
+			dialect:  dialectPostgreSQL,
+			dsn:      "host=10.0.0.3 port=5433 user='app@project.iam' dbname=cpe",
+			auth:     IAMAuthCloudSQL,
+			addr:     "10.0.0.3:5433",
+			user:     "app@project.iam",
+			password: "host=10.0.0.3 port=5433 user='app@project.iam' dbname=cpe password='tok%en'",
+		},
+		{
+			dialect: dialectPostgreSQL,
+			dsn:     "host=localhost user=app dbname=cpe sslmode=disable",
+			auth:    IAMAuthRDS,
+			wantErr: true,
+		},
+	}
+	for i, tt := range tests {
+		parse, ok := iamTargets[tt.dialect]
+		if !ok {
+			continue
+		}
+		target, err := parse(tt.dsn, tt.auth)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("[%d] expected error: %t, actual %v", i, tt.wantErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if target.addr != tt.addr || target.user != tt.user {
+			t.Errorf("[%d] expected %s %s, actual %s %s", i, tt.addr, tt.user, target.addr, target.user)
+		}
+		if dsn := target.withPassword("tok%en"); !strings.HasSuffix(dsn, tt.password) {
+			t.Errorf("[%d] expected to end with %s, actual %s", i, tt.password, dsn)
+		}
+	}
+}
+
+func TestValidateIAMAuth(t *testing.T) {
+	if err := ValidateIAMAuth(dialectSqlite3, ""); err != nil {
+		t.Errorf("expected no IAM authentication to be valid, actual %v", err)
+	}
+	if err := ValidateIAMAuth(dialectSqlite3, IAMAuthRDS); err == nil {
+		t.Error("expected sqlite3 to reject the IAM authentication")
+	}
+	if err := ValidateIAMAuth(dialectPostgreSQL, "azure"); err == nil {
+		t.Error("expected an unknown IAM authentication to be rejected")
+	}
+}
+
+// setenv sets the environment variable till the test ends
+func setenv(t *testing.T, key, value string) {
+	orig, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, orig)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
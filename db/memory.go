@@ -0,0 +1,416 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+// memoryDriver serves the reads of the CPEs, the vendor/products and FetchMeta from a snapshot of the DB in memory,
+// indexed by maps and a radix tree of the vendor/products, so that a lookup never queries the DB.
+// The other reads, e.g. of the watchlist and the distribution packages, and the writes go to the DB.
+//
+// The snapshot is reloaded after the writes through the driver, e.g. the fetches of the server,
+// and replaced at once, so that the reads during a reload are answered by the previous one.
+// The writes by another process, e.g. fetchnvd, aren't seen until the restart.
+type memoryDriver struct {
+	DB
+	log log15.Logger
+
+	// mu serializes the reloads
+	mu       sync.Mutex
+	snapshot atomic.Value
+}
+
+// memorySnapshot is the content of the DB loaded by memoryDriver.load
+type memorySnapshot struct {
+	fetchMeta      models.FetchMeta
+	vendorProducts []string
+	byPopularity   []string
+	titles         map[string]string
+	summaries      []models.ProductSummary
+	knownExploited []models.KnownExploitedProduct
+
+	// products are the CPEs by vendor::product, whose keys are in names for the wildcard searches
+	products map[string]*memoryProduct
+	names    radixTree
+	// byVersion are the sorted vendor::products by the version of their CPEs
+	byVersion map[string][]string
+	// byNameID are the vendor::products of the CPEs by the cpeNameId
+	byNameID   map[string]memoryNameID
+	deprecated map[string]bool
+	counts     map[models.FetchType]int
+}
+
+// memoryProduct is a vendor/product with the rows of its CPEs, one per source
+type memoryProduct struct {
+	vendor  string
+	product string
+	cpes    []memoryCpe
+}
+
+// memoryCpe is a row of a CPE, only of the columns read from the snapshot
+type memoryCpe struct {
+	cpeURI       string
+	fetchType    models.FetchType
+	version      string
+	cpeNameID    string
+	deprecated   bool
+	deprecatedBy string
+	references   string
+}
+
+type memoryNameID struct {
+	vendorProduct string
+	cpeURI        string
+}
+
+func (c memoryCpe) categorized() models.CategorizedCpe {
+	return models.CategorizedCpe{
+		CpeURI:       c.cpeURI,
+		FetchType:    c.fetchType,
+		Version:      c.version,
+		CpeNameID:    c.cpeNameID,
+		Deprecated:   c.deprecated,
+		DeprecatedBy: c.deprecatedBy,
+		References:   c.references,
+	}
+}
+
+// newMemoryDriver loads the snapshot of driver
+func newMemoryDriver(driver DB, log log15.Logger) (*memoryDriver, error) {
+	m := &memoryDriver{DB: driver, log: log}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *memoryDriver) current() *memorySnapshot {
+	return m.snapshot.Load().(*memorySnapshot)
+}
+
+// reload loads the snapshot again and replaces the current one
+func (m *memoryDriver) reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	started := time.Now()
+	s, err := m.load()
+	if err != nil {
+		return xerrors.Errorf("Failed to load the DB into memory. err: %w", err)
+	}
+	m.snapshot.Store(s)
+	m.log.Info("Loaded the DB into memory", "vendorProducts", len(s.products), "elapsed", time.Since(started))
+	return nil
+}
+
+// reloadAfter reloads the snapshot after the write by the driver succeeded.
+// A failed reload is only logged, since the write is done; the previous snapshot is served until the next one.
+func (m *memoryDriver) reloadAfter(err error) error {
+	if err != nil {
+		return err
+	}
+	if err := m.reload(); err != nil {
+		m.log.Error("Failed to reload the DB into memory. Serving the previous snapshot", "err", err)
+	}
+	return nil
+}
+
+// update replaces the snapshot by a copy changed by fn, e.g. of the FetchMeta just written.
+// A failure is only logged as in reloadAfter.
+func (m *memoryDriver) update(fn func(s *memorySnapshot) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := *m.current()
+	if err := fn(&s); err != nil {
+		m.log.Error("Failed to reload the DB into memory. Serving the previous snapshot", "err", err)
+		return nil
+	}
+	m.snapshot.Store(&s)
+	return nil
+}
+
+func (m *memoryDriver) load() (*memorySnapshot, error) {
+	fetchMeta, err := m.DB.GetFetchMeta()
+	if err != nil {
+		return nil, err
+	}
+	s := &memorySnapshot{
+		fetchMeta:  *fetchMeta,
+		products:   map[string]*memoryProduct{},
+		byVersion:  map[string][]string{},
+		byNameID:   map[string]memoryNameID{},
+		deprecated: map[string]bool{},
+		counts:     map[models.FetchType]int{},
+	}
+	if s.vendorProducts, err = m.DB.GetVendorProducts(); err != nil {
+		return nil, err
+	}
+	if s.byPopularity, err = m.DB.GetVendorProductsByPopularity(); err != nil {
+		return nil, err
+	}
+	if s.titles, err = m.DB.GetVendorProductTitles(); err != nil {
+		return nil, err
+	}
+	if s.summaries, err = m.DB.GetProductSummaries(); err != nil {
+		return nil, err
+	}
+	if s.knownExploited, err = m.DB.GetKnownExploited(); err != nil {
+		return nil, err
+	}
+
+	cpes, err := loadAllCpes(m.DB, s.vendorProducts, m.log)
+	if err != nil {
+		return nil, err
+	}
+	versions, counted := map[string]map[string]bool{}, map[models.FetchType]map[string]bool{}
+	for _, c := range cpes {
+		vp := fmt.Sprintf("%s::%s", c.Vendor, c.Product)
+		p, ok := s.products[vp]
+		if !ok {
+			p = &memoryProduct{vendor: c.Vendor, product: c.Product}
+			s.products[vp] = p
+			s.names.insert(vp)
+		}
+		p.cpes = append(p.cpes, memoryCpe{
+			cpeURI:       c.CpeURI,
+			fetchType:    c.FetchType,
+			version:      c.Version,
+			cpeNameID:    c.CpeNameID,
+			deprecated:   c.Deprecated,
+			deprecatedBy: c.DeprecatedBy,
+			references:   c.References,
+		})
+
+		if versions[c.Version] == nil {
+			versions[c.Version] = map[string]bool{}
+		}
+		versions[c.Version][vp] = true
+		if c.CpeNameID != "" {
+			s.byNameID[c.CpeNameID] = memoryNameID{vendorProduct: vp, cpeURI: c.CpeURI}
+		}
+		if counted[c.FetchType] == nil {
+			counted[c.FetchType] = map[string]bool{}
+		}
+		if !counted[c.FetchType][c.CpeURI] {
+			counted[c.FetchType][c.CpeURI] = true
+			s.counts[c.FetchType]++
+		}
+	}
+	for _, c := range dedupe(cpes) {
+		if c.Deprecated {
+			s.deprecated[c.CpeURI] = true
+		}
+	}
+	for version, set := range versions {
+		vps := make([]string, 0, len(set))
+		for vp := range set {
+			vps = append(vps, vp)
+		}
+		sort.Strings(vps)
+		s.byVersion[version] = vps
+	}
+	return s, nil
+}
+
+// loadCpes reads all the CPEs at once from the RDB, or by the vendor/products from the other drivers
+// match returns the vendor/products matching the LIKE patterns, in the order of vendor::product
+func (s *memorySnapshot) match(vendor, product string) []*memoryProduct {
+	if !HasLikeWildcard(vendor) && !HasLikeWildcard(product) {
+		if p, ok := s.products[fmt.Sprintf("%s::%s", UnescapeLike(vendor), UnescapeLike(product))]; ok {
+			return []*memoryProduct{p}
+		}
+		return nil
+	}
+
+	prefix := likePrefix(vendor)
+	if !HasLikeWildcard(vendor) {
+		prefix += "::" + likePrefix(product)
+	}
+	vendorMatch, productMatch := likeRegexp(vendor), likeRegexp(product)
+	matched := []*memoryProduct{}
+	s.names.walkPrefix(prefix, func(vp string) bool {
+		if p := s.products[vp]; vendorMatch.MatchString(p.vendor) && productMatch.MatchString(p.product) {
+			matched = append(matched, p)
+		}
+		return true
+	})
+	return matched
+}
+
+// rows returns the rows of the CPEs of the vendor/products matching the LIKE patterns, of sources unless it's empty
+func (s *memorySnapshot) rows(vendor, product string, sources []models.FetchType) []models.CategorizedCpe {
+	wanted := map[models.FetchType]bool{}
+	for _, source := range sources {
+		wanted[source] = true
+	}
+	rows := []models.CategorizedCpe{}
+	for _, p := range s.match(vendor, product) {
+		for _, c := range p.cpes {
+			if len(wanted) == 0 || wanted[c.fetchType] {
+				rows = append(rows, c.categorized())
+			}
+		}
+	}
+	return rows
+}
+
+// GetFetchMeta : GetFetchMeta of the snapshot
+func (m *memoryDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	fetchMeta := m.current().fetchMeta
+	return &fetchMeta, nil
+}
+
+// UpsertFetchMeta : UpsertFetchMeta, reloading FetchMeta of the snapshot
+func (m *memoryDriver) UpsertFetchMeta(fetchMeta *models.FetchMeta) error {
+	if err := m.DB.UpsertFetchMeta(fetchMeta); err != nil {
+		return err
+	}
+	return m.update(func(s *memorySnapshot) error {
+		upserted, err := m.DB.GetFetchMeta()
+		if err != nil {
+			return err
+		}
+		s.fetchMeta = *upserted
+		return nil
+	})
+}
+
+// GetVendorProducts : GetVendorProducts of the snapshot
+func (m *memoryDriver) GetVendorProducts() ([]string, error) {
+	return append([]string(nil), m.current().vendorProducts...), nil
+}
+
+// GetVendorProductsByPopularity : GetVendorProductsByPopularity of the snapshot
+func (m *memoryDriver) GetVendorProductsByPopularity() ([]string, error) {
+	return append([]string(nil), m.current().byPopularity...), nil
+}
+
+// GetVendorProductTitles : GetVendorProductTitles of the snapshot
+func (m *memoryDriver) GetVendorProductTitles() (map[string]string, error) {
+	titles := map[string]string{}
+	for vp, title := range m.current().titles {
+		titles[vp] = title
+	}
+	return titles, nil
+}
+
+// GetProductSummaries : GetProductSummaries of the snapshot
+func (m *memoryDriver) GetProductSummaries() ([]models.ProductSummary, error) {
+	return append([]models.ProductSummary{}, m.current().summaries...), nil
+}
+
+// GetCpesByVendorProduct : GetCpesByVendorProduct of the snapshot
+func (m *memoryDriver) GetCpesByVendorProduct(vendor, product string) ([]string, []string, error) {
+	cpeURIs, deprecated := splitDeprecated(m.current().rows(vendor, product, nil))
+	return cpeURIs, deprecated, nil
+}
+
+// GetCpeDetailsByVendorProduct : GetCpeDetailsByVendorProduct of the snapshot.
+// Unlike RDB, the patterns are case-sensitive, as on redis.
+func (m *memoryDriver) GetCpeDetailsByVendorProduct(vendor, product string) (*models.CpeDetails, error) {
+	return cpeDetails(m.current().rows(vendor, product, nil)), nil
+}
+
+// GetSourcedCpesByVendorProduct : GetSourcedCpesByVendorProduct of the snapshot
+func (m *memoryDriver) GetSourcedCpesByVendorProduct(vendor, product string, sources []models.FetchType) ([]models.SourcedCpe, error) {
+	return mergeSources(m.current().rows(vendor, product, sources)), nil
+}
+
+// GetProductsByVersion : GetProductsByVersion of the snapshot
+func (m *memoryDriver) GetProductsByVersion(version string) ([]string, error) {
+	return append([]string{}, m.current().byVersion[quoteWFN(version)]...), nil
+}
+
+// GetVersionsByVendorProduct : GetVersionsByVendorProduct of the snapshot
+func (m *memoryDriver) GetVersionsByVendorProduct(vendor, product, from, to string) ([]string, error) {
+	versions := []string{}
+	if p, ok := m.current().products[fmt.Sprintf("%s::%s", vendor, product)]; ok {
+		for _, c := range p.cpes {
+			versions = append(versions, c.version)
+		}
+	}
+	return versionsInRange(versions, from, to), nil
+}
+
+// CountCpes : CountCpes of the snapshot
+func (m *memoryDriver) CountCpes(fetchType models.FetchType) (int, error) {
+	return m.current().counts[fetchType], nil
+}
+
+// InsertCpes : InsertCpes, reloading the snapshot
+func (m *memoryDriver) InsertCpes(cpes []models.CategorizedCpe) error {
+	return m.reloadAfter(m.DB.InsertCpes(cpes))
+}
+
+// ReplaceCpes : ReplaceCpes, reloading the snapshot
+func (m *memoryDriver) ReplaceCpes(source models.FetchType, cpes []models.CategorizedCpe) error {
+	return m.reloadAfter(m.DB.ReplaceCpes(source, cpes))
+}
+
+// IsDeprecated : IsDeprecated of the snapshot
+func (m *memoryDriver) IsDeprecated(cpeURI string) (bool, error) {
+	return m.current().deprecated[cpeURI], nil
+}
+
+// GetCpeByNameID : GetCpeByNameID of the snapshot
+func (m *memoryDriver) GetCpeByNameID(id string) (*models.SourcedCpe, error) {
+	s := m.current()
+	found, ok := s.byNameID[strings.ToUpper(id)]
+	if !ok {
+		return nil, nil
+	}
+	rows := []models.CategorizedCpe{}
+	for _, c := range s.products[found.vendorProduct].cpes {
+		if c.cpeURI == found.cpeURI {
+			rows = append(rows, c.categorized())
+		}
+	}
+	cpes := mergeSources(rows)
+	return &cpes[0], nil
+}
+
+// GetCpesByDistroPackage : GetCpesByDistroPackage reading the mapping from the DB and the CPEs from the snapshot
+func (m *memoryDriver) GetCpesByDistroPackage(distro, pkg string) ([]string, []string, error) {
+	return cpesByDistroPackage(m, distro, pkg)
+}
+
+// ReplaceKnownExploited : ReplaceKnownExploited, reloading the known exploited products of the snapshot
+func (m *memoryDriver) ReplaceKnownExploited(products []models.KnownExploitedProduct) error {
+	if err := m.DB.ReplaceKnownExploited(products); err != nil {
+		return err
+	}
+	return m.update(func(s *memorySnapshot) (err error) {
+		s.knownExploited, err = m.DB.GetKnownExploited()
+		return err
+	})
+}
+
+// GetKnownExploited : GetKnownExploited of the snapshot
+func (m *memoryDriver) GetKnownExploited() ([]models.KnownExploitedProduct, error) {
+	return append([]models.KnownExploitedProduct{}, m.current().knownExploited...), nil
+}
+
+// GC : GC, reloading the snapshot
+func (m *memoryDriver) GC() ([]GCStat, error) {
+	stats, err := m.DB.GC()
+	return stats, m.reloadAfter(err)
+}
+
+// CheckIntegrity : CheckIntegrity, reloading the snapshot after a repair
+func (m *memoryDriver) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	report, err := m.DB.CheckIntegrity(repair)
+	if !repair {
+		return report, err
+	}
+	return report, m.reloadAfter(err)
+}
@@ -0,0 +1,155 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func newMemorySqlite(t *testing.T) DB {
+	driver, err := Open("sqlite3", filepath.Join(t.TempDir(), "cpe.sqlite3"), WithInMemory(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+func TestMemory(t *testing.T) {
+	for name, test := range map[string]func(*testing.T, DB){
+		"GetVendorProducts":             testGetVendorProducts,
+		"GetCpesByVendorProduct":        testGetCpesByVendorProduct,
+		"GetCpeDetailsByVendorProduct":  testGetCpeDetailsByVendorProduct,
+		"GetVendorProductsByPopularity": testGetVendorProductsByPopularity,
+		"UpsertFetchMeta":               testUpsertFetchMeta,
+		"GetProductsByVersion":          testGetProductsByVersion,
+		"GetVersionsByVendorProduct":    testGetVersionsByVendorProduct,
+		"GetSourcedCpesByVendorProduct": testGetSourcedCpesByVendorProduct,
+		"GetProductSummaries":           testGetProductSummaries,
+		"CountCpes":                     testCountCpes,
+		"GetCpeByNameID":                testGetCpeByNameID,
+		"GetCpesByDistroPackage":        testGetCpesByDistroPackage,
+		"KnownExploited":                testKnownExploited,
+	} {
+		t.Run(name, func(t *testing.T) {
+			driver := newMemorySqlite(t)
+			defer func() {
+				_ = driver.CloseDB()
+			}()
+			test(t, driver)
+		})
+	}
+}
+
+func TestMemoryWildcard(t *testing.T) {
+	driver := newMemorySqlite(t)
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	var tests = []struct {
+		vendor     string
+		product    string
+		expected   []string
+		deprecated []string
+	}{
+		{
+			vendor:  "vendorName1",
+			product: "product%",
+			expected: []string{
+				"cpe:/a:vendorName1:productName1-1:1.1::~~~targetSoftware1~targetHardware1~",
+				"cpe:/a:vendorName1:productName1-2:1.2::~~~targetSoftware1~targetHardware1~",
+			},
+		},
+		{
+			vendor:     "vendorName_",
+			product:    "productName6",
+			deprecated: []string{"cpe:/a:vendorName6:productName6:6.0::~~~targetSoftware6~targetHardware6~"},
+		},
+		{
+			vendor:   "%",
+			product:  "ntp",
+			expected: []string{"cpe:/a:ntp:ntp:4.2.5p48", "cpe:/a:ntp:ntp:4.2.8:p1-beta1"},
+		},
+		{
+			// the escaped _ is the character
+			vendor:  LikePattern("vendorName_", false),
+			product: "productName6",
+		},
+	}
+	for _, tt := range tests {
+		cpeURIs, deprecated, err := driver.GetCpesByVendorProduct(tt.vendor, tt.product)
+		if err != nil {
+			t.Fatalf("GetCpesByVendorProduct: %s", err)
+		}
+		if len(cpeURIs) != len(tt.expected) || (0 < len(cpeURIs) && !reflect.DeepEqual(cpeURIs, tt.expected)) {
+			t.Errorf("%s/%s: actual %#v, expected %#v", tt.vendor, tt.product, cpeURIs, tt.expected)
+		}
+		if len(deprecated) != len(tt.deprecated) || (0 < len(deprecated) && !reflect.DeepEqual(deprecated, tt.deprecated)) {
+			t.Errorf("%s/%s: actual %#v, expected %#v", tt.vendor, tt.product, deprecated, tt.deprecated)
+		}
+	}
+}
+
+func TestMemoryReload(t *testing.T) {
+	driver := newMemorySqlite(t)
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	m := driver.(tracedDriver).DB.(*memoryDriver)
+
+	// a write to the DB not through the driver isn't read until the reload
+	if err := m.DB.InsertCpes([]models.CategorizedCpe{{FetchType: models.NVD, CpeURI: "cpe:/a:cybozu:office:10.0.0", Vendor: "cybozu", Product: "office"}}); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+	if cpeURIs, _, err := driver.GetCpesByVendorProduct("cybozu", "office"); err != nil || len(cpeURIs) != 0 {
+		t.Errorf("actual %#v, %v, expected the snapshot before the insert", cpeURIs, err)
+	}
+	if err := m.reload(); err != nil {
+		t.Fatalf("reload: %s", err)
+	}
+	if cpeURIs, _, err := driver.GetCpesByVendorProduct("cybozu", "office"); err != nil || len(cpeURIs) != 1 {
+		t.Errorf("actual %#v, %v, expected the CPE reloaded", cpeURIs, err)
+	}
+}
+
+// TestMemoryFlushCache checks the CPEs inserted by another process are served after FlushCache
+func TestMemoryFlushCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpe.sqlite3")
+	driver, err := Open("sqlite3", path, WithInMemory(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	other, err := Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = other.CloseDB()
+	}()
+
+	if err := other.InsertCpes([]models.CategorizedCpe{
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.8", Part: "a", Vendor: "ntp", Product: "ntp", Version: "4\\.2\\.8", FetchType: models.NVD},
+	}); err != nil {
+		t.Fatalf("InsertCpes: %s", err)
+	}
+	if cpeURIs, _, err := driver.GetCpesByVendorProduct("ntp", "ntp"); err != nil || len(cpeURIs) != 0 {
+		t.Fatalf("actual %v, %v, expected the snapshot before the insert", cpeURIs, err)
+	}
+	if err := FlushCache(driver); err != nil {
+		t.Fatalf("FlushCache: %s", err)
+	}
+	if cpeURIs, _, err := driver.GetCpesByVendorProduct("ntp", "ntp"); err != nil || !reflect.DeepEqual(cpeURIs, []string{"cpe:/a:ntp:ntp:4.2.8"}) {
+		t.Errorf("actual %v, %v, expected the CPE inserted", cpeURIs, err)
+	}
+}
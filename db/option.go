@@ -0,0 +1,241 @@
+package db
+
+import (
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+// ErrReadOnly is returned by the writes to a DB opened WithReadOnly
+var ErrReadOnly = xerrors.New("database is opened read-only")
+
+// ErrSchemaVersion is returned by opening WithReadOnly a DB of another schema version, which can't be migrated
+var ErrSchemaVersion = xerrors.New("schema version of the database is not the latest")
+
+// OpenOption configures Open
+type OpenOption func(*Option)
+
+// WithDebugSQL logs the SQL statements at the debug level (RDB only)
+func WithDebugSQL(debugSQL bool) OpenOption {
+	return func(o *Option) { o.DebugSQL = debugSQL }
+}
+
+// WithSlowQuery logs the SQL statements taking longer than d as warnings, even without WithDebugSQL (RDB only)
+func WithSlowQuery(d time.Duration) OpenOption {
+	return func(o *Option) { o.SlowQuery = d }
+}
+
+// WithFastRead uses prepared raw SQL for the hot read queries (RDB only)
+func WithFastRead(fastRead bool) OpenOption {
+	return func(o *Option) { o.FastRead = fastRead }
+}
+
+// WithPrepareStmt reuses a prepared statement for the batches of the insert (RDB only)
+func WithPrepareStmt(prepareStmt bool) OpenOption {
+	return func(o *Option) { o.PrepareStmt = prepareStmt }
+}
+
+// WithNamespace prefixes the table names with namespace, e.g. gocpe_, to share the DB with other dictionaries (RDB only)
+func WithNamespace(namespace string) OpenOption {
+	return func(o *Option) { o.TablePrefix = namespace }
+}
+
+// WithBatchSize sets the number of rows inserted by a statement (RDB only). 0 tunes it by the dialect.
+func WithBatchSize(batchSize int) OpenOption {
+	return func(o *Option) { o.BatchSize = batchSize }
+}
+
+// WithDeleteBatch sets the number of rows deleted by a statement and the pause between the statements (RDB only).
+// Each statement is committed on its own, so that a large delete doesn't hold the locks or stall the replicas.
+func WithDeleteBatch(batchSize int, pause time.Duration) OpenOption {
+	return func(o *Option) {
+		o.DeleteBatchSize = batchSize
+		o.DeletePause = pause
+	}
+}
+
+// WithPartition creates the CPE table partitioned by the source on a new DB (PostgreSQL only),
+// so that a source can be refreshed by truncating its partition
+func WithPartition(partition bool) OpenOption {
+	return func(o *Option) { o.Partition = partition }
+}
+
+// WithTimeout bounds connecting to the DB and, on sqlite3, waiting for a lock
+func WithTimeout(timeout time.Duration) OpenOption {
+	return func(o *Option) { o.Timeout = timeout }
+}
+
+// WithReadOnly rejects the writes with ErrReadOnly, e.g. for a server on a replica.
+// The DB is not migrated, and opening it fails with ErrSchemaVersion unless it's of the latest schema version.
+func WithReadOnly(readOnly bool) OpenOption {
+	return func(o *Option) { o.ReadOnly = readOnly }
+}
+
+// WithInMemory loads the CPEs into in-memory indexes on opening and serves their reads from them, never querying the DB per lookup.
+// The writes through the driver, e.g. a fetch of the server, reload them.
+func WithInMemory(inMemory bool) OpenOption {
+	return func(o *Option) { o.InMemory = inMemory }
+}
+
+// WithLogger sends the logs of the driver, including the SQL logged WithDebugSQL and WithSlowQuery, to logger
+func WithLogger(logger log15.Logger) OpenOption {
+	return func(o *Option) { o.Logger = logger }
+}
+
+// WithTiers sets the cache read first and the store of the source of truth of the tiered dbtype
+func WithTiers(cache, store string) OpenOption {
+	return func(o *Option) {
+		o.Cache = cache
+		o.Store = store
+	}
+}
+
+// WithKeyTTL expires the keys of the CPEs of each vendor/product after ttl (redis only), e.g. for the cache of the tiered dbtype
+func WithKeyTTL(ttl time.Duration) OpenOption {
+	return func(o *Option) { o.KeyTTL = ttl }
+}
+
+// WithAllowEviction opens a redis whose maxmemory-policy may evict the dictionary, only warning instead of failing with ErrEvictingRedis
+func WithAllowEviction(allow bool) OpenOption {
+	return func(o *Option) { o.AllowEviction = allow }
+}
+
+// WithThreads bounds the workers binding the values of the batches of an insert (RDB) and reading the vendor/products found by a wildcard search (redis).
+// 0 is the number of CPUs.
+func WithThreads(threads int) OpenOption {
+	return func(o *Option) { o.Threads = threads }
+}
+
+// WithIAMAuth connects with a token of auth, IAMAuthRDS or IAMAuthCloudSQL, as the password instead of the one of the DSN (MySQL and PostgreSQL only).
+// The token is fetched again for each new connection, since it expires in minutes.
+func WithIAMAuth(auth string) OpenOption {
+	return func(o *Option) { o.IAMAuth = auth }
+}
+
+// optionOpener is a driver opened with the options of Open, while DB.OpenDB takes debugSQL only
+type optionOpener interface {
+	openDB(dbType, dbPath string, option Option) (bool, error)
+}
+
+// openDB opens driver with option, or with option.DebugSQL only when the driver doesn't take the options
+func openDB(driver DB, dbType, dbPath string, option Option) (bool, error) {
+	if o, ok := driver.(optionOpener); ok {
+		return o.openDB(dbType, dbPath, option)
+	}
+	return driver.OpenDB(dbType, dbPath, option.DebugSQL)
+}
+
+// Open opens and migrates the DB of dbType at dbPath.
+// When the DB is locked by another process, the error is ErrLocked.
+func Open(dbType, dbPath string, opts ...OpenOption) (DB, error) {
+	option := Option{Logger: log15.Root()}
+	for _, opt := range opts {
+		opt(&option)
+	}
+
+	driver, err := newDB(dbType)
+	if err != nil {
+		option.Logger.Error("Failed to new db.", "err", err)
+		return nil, err
+	}
+	if _, err := openDB(driver, dbType, dbPath, option); err != nil {
+		return nil, err
+	}
+	if option.ReadOnly {
+		if err := checkSchemaVersion(driver); err != nil {
+			_ = driver.CloseDB()
+			return nil, err
+		}
+		driver = readOnlyDriver{DB: driver}
+	} else if err := driver.MigrateDB(); err != nil {
+		option.Logger.Error("Failed to migrate db.", "err", err)
+		_ = driver.CloseDB()
+		return nil, err
+	}
+	if option.InMemory {
+		opened := driver
+		if driver, err = newMemoryDriver(driver, option.Logger); err != nil {
+			_ = opened.CloseDB()
+			return nil, err
+		}
+	}
+	return tracedDriver{DB: driver}, nil
+}
+
+// checkSchemaVersion fails with ErrSchemaVersion unless driver is of the latest schema version.
+// The tiered DB checks whether the cache is in sync too, as its MigrateDB does.
+func checkSchemaVersion(driver DB) error {
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return xerrors.Errorf("Failed to get FetchMeta. err: %w", err)
+	}
+	if fetchMeta.OutDated() {
+		return xerrors.Errorf("Failed to open the DB read-only. SchemaVersion: %d, expected: %d, err: %w", fetchMeta.SchemaVersion, models.LatestSchemaVersion, ErrSchemaVersion)
+	}
+	if t, ok := driver.(*TieredDriver); ok {
+		t.checkSync()
+	}
+	return nil
+}
+
+// readOnlyDriver rejects the writes
+type readOnlyDriver struct {
+	DB
+}
+
+func (readOnlyDriver) UpsertFetchMeta(*models.FetchMeta) error {
+	return ErrReadOnly
+}
+
+func (readOnlyDriver) InsertFetchHistory(*models.FetchHistory) error {
+	return ErrReadOnly
+}
+
+func (readOnlyDriver) InsertAuditEntry(*models.AuditEntry) error {
+	return ErrReadOnly
+}
+
+func (readOnlyDriver) UpsertWatchedProduct(*models.WatchedProduct) error {
+	return ErrReadOnly
+}
+
+func (readOnlyDriver) DeleteWatchedProduct(string, string) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (readOnlyDriver) InsertWatchChanges([]models.WatchChange) error {
+	return ErrReadOnly
+}
+
+func (readOnlyDriver) ReplaceRejectedCpes(models.FetchType, []models.RejectedCpe) error {
+	return ErrReadOnly
+}
+
+func (readOnlyDriver) InsertCpes([]models.CategorizedCpe) error {
+	return ErrReadOnly
+}
+
+func (readOnlyDriver) ReplaceCpes(models.FetchType, []models.CategorizedCpe) error {
+	return ErrReadOnly
+}
+
+func (readOnlyDriver) InsertDistroPackages([]models.DistroPackage) error {
+	return ErrReadOnly
+}
+
+func (readOnlyDriver) ReplaceKnownExploited([]models.KnownExploitedProduct) error {
+	return ErrReadOnly
+}
+
+func (readOnlyDriver) GC() ([]GCStat, error) {
+	return nil, ErrReadOnly
+}
+
+func (d readOnlyDriver) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	if repair {
+		return nil, ErrReadOnly
+	}
+	return d.DB.CheckIntegrity(false)
+}
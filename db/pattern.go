@@ -0,0 +1,129 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrWildcardUnsupported is returned by GetCpesByVendorProduct and the like given a LIKE pattern with a wildcard on DynamoDB,
+// which looks up the vendor/products by the names only
+var ErrWildcardUnsupported = xerrors.New("the wildcards of the vendor/product are not supported")
+
+// LikeEscape escapes a % or _ of the LIKE patterns of GetCpesByVendorProduct and the like to match itself, e.g. http!_server.
+// It's not a backslash, which MySQL and PostgreSQL take as the escape by default and the WFN escapes of the CPEs, e.g. node\.js, are made of.
+const LikeEscape = '!'
+
+// LikePattern returns the LIKE pattern matching the vendor or the product name given by a user as is.
+// With glob, * and ? of name match any string and any character instead, except escaped by a backslash as in WFN, e.g. \*.
+// ? matches a character of the name as stored, so a character escaped in WFN, e.g. the \- of productName1\-1, takes ?? to match.
+func LikePattern(name string, glob bool) string {
+	var b strings.Builder
+	escaped := false
+	for _, c := range name {
+		switch {
+		case escaped:
+			escaped = false
+			b.WriteString(escapeLike(c))
+		case c == '\\':
+			escaped = true
+			b.WriteRune(c)
+		case glob && c == '*':
+			b.WriteByte('%')
+		case glob && c == '?':
+			b.WriteByte('_')
+		default:
+			b.WriteString(escapeLike(c))
+		}
+	}
+	return b.String()
+}
+
+// escapeLike escapes c to match itself in a LIKE pattern
+func escapeLike(c rune) string {
+	switch c {
+	case '%', '_', LikeEscape:
+		return string([]rune{LikeEscape, c})
+	default:
+		return string(c)
+	}
+}
+
+// HasLikeWildcard tells the LIKE pattern has a % or _ not escaped, matching more than a name
+func HasLikeWildcard(pattern string) bool {
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case c == LikeEscape:
+			escaped = true
+		case c == '%', c == '_':
+			return true
+		}
+	}
+	return false
+}
+
+// UnescapeLike returns the name matched by the LIKE pattern without a wildcard
+func UnescapeLike(pattern string) string {
+	if !strings.ContainsRune(pattern, LikeEscape) {
+		return pattern
+	}
+	var b strings.Builder
+	escaped := false
+	for _, c := range pattern {
+		if !escaped && c == LikeEscape {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// likePrefix returns the name the LIKE pattern matches up to its first wildcard
+func likePrefix(pattern string) string {
+	var b strings.Builder
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			b.WriteRune(c)
+		case c == LikeEscape:
+			escaped = true
+		case c == '%', c == '_':
+			return b.String()
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// likeRegexp compiles the LIKE pattern into the regexp matching the same names, case-sensitively
+func likeRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		case c == LikeEscape:
+			escaped = true
+		case c == '%':
+			b.WriteString(".*")
+		case c == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,59 @@
+package db
+
+import "testing"
+
+func TestLikePattern(t *testing.T) {
+	var tests = []struct {
+		name     string
+		glob     bool
+		expected string
+	}{
+		{name: "cybozu", expected: "cybozu"},
+		{name: "http_server", expected: "http!_server"},
+		{name: "100%!", expected: "100!%!!"},
+		{name: "windows*", expected: "windows*"},
+		{name: "windows*", glob: true, expected: "windows%"},
+		{name: "http?server_*", glob: true, expected: "http_server!_%"},
+		{name: `node\.js\*`, glob: true, expected: `node\.js\*`},
+		{name: `a\_b`, expected: `a\!_b`},
+	}
+	for _, tt := range tests {
+		if actual := LikePattern(tt.name, tt.glob); actual != tt.expected {
+			t.Errorf("%s, glob %t: actual %s, expected %s", tt.name, tt.glob, actual, tt.expected)
+		}
+	}
+}
+
+func TestHasLikeWildcard(t *testing.T) {
+	for pattern, expected := range map[string]bool{
+		"cybozu":        false,
+		"http!_server":  false,
+		"100!%!!":       false,
+		"http_server":   true,
+		"windows%":      true,
+		"windows!!%":    true,
+		`node\.js`:      false,
+		"http!_server%": true,
+	} {
+		if actual := HasLikeWildcard(pattern); actual != expected {
+			t.Errorf("%s: actual %t, expected %t", pattern, actual, expected)
+		}
+	}
+}
+
+func TestUnescapeLike(t *testing.T) {
+	for pattern, expected := range map[string]string{
+		"cybozu":       "cybozu",
+		"http!_server": "http_server",
+		"100!%!!":      "100%!",
+	} {
+		if actual := UnescapeLike(pattern); actual != expected {
+			t.Errorf("%s: actual %s, expected %s", pattern, actual, expected)
+		}
+	}
+	for _, name := range []string{"http_server", "100%!", `node\.js`} {
+		if actual := UnescapeLike(LikePattern(name, false)); actual != name {
+			t.Errorf("%s: actual %s, expected the name", name, actual)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"sort"
+	"strings"
+)
+
+// radixTree is a set of strings compressed by their common prefixes, walked by a prefix in the order of the strings
+type radixTree struct {
+	root radixNode
+}
+
+type radixNode struct {
+	// label is the part of the key after the parent's
+	label string
+	// leaf tells a key ends at the node
+	leaf     bool
+	children []*radixNode
+}
+
+// insert adds key to the tree
+func (t *radixTree) insert(key string) {
+	n := &t.root
+	for {
+		if key == "" {
+			n.leaf = true
+			return
+		}
+		i := sort.Search(len(n.children), func(i int) bool { return key[0] <= n.children[i].label[0] })
+		if i == len(n.children) || n.children[i].label[0] != key[0] {
+			child := &radixNode{label: key, leaf: true}
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = child
+			return
+		}
+
+		child := n.children[i]
+		common := commonPrefixLen(child.label, key)
+		if common < len(child.label) {
+			// split the child at the end of the common prefix
+			split := &radixNode{label: child.label[:common], children: []*radixNode{child}}
+			child.label = child.label[common:]
+			n.children[i] = split
+			child = split
+		}
+		n, key = child, key[common:]
+	}
+}
+
+// walkPrefix calls fn with the keys starting with prefix in order, until fn returns false
+func (t *radixTree) walkPrefix(prefix string, fn func(key string) bool) {
+	n, path := &t.root, ""
+	for prefix != "" {
+		i := sort.Search(len(n.children), func(i int) bool { return prefix[0] <= n.children[i].label[0] })
+		if i == len(n.children) || n.children[i].label[0] != prefix[0] {
+			return
+		}
+		child := n.children[i]
+		switch {
+		case strings.HasPrefix(prefix, child.label):
+			prefix = prefix[len(child.label):]
+		case strings.HasPrefix(child.label, prefix):
+			prefix = ""
+		default:
+			return
+		}
+		n, path = child, path+child.label
+	}
+	n.walk(path, fn)
+}
+
+// walk calls fn with the keys under n, path being the key of n
+func (n *radixNode) walk(path string, fn func(key string) bool) bool {
+	if n.leaf && !fn(path) {
+		return false
+	}
+	for _, child := range n.children {
+		if !child.walk(path+child.label, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
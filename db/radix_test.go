@@ -0,0 +1,45 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRadixTree(t *testing.T) {
+	var tree radixTree
+	for _, key := range []string{"microsoft::windows_10", "microsoft::office", "mozilla::firefox", "microsoft::windows", "m", "microsoft::windows_10"} {
+		tree.insert(key)
+	}
+
+	var tests = []struct {
+		prefix   string
+		expected []string
+	}{
+		{prefix: "", expected: []string{"m", "microsoft::office", "microsoft::windows", "microsoft::windows_10", "mozilla::firefox"}},
+		{prefix: "microsoft::win", expected: []string{"microsoft::windows", "microsoft::windows_10"}},
+		{prefix: "microsoft::windows", expected: []string{"microsoft::windows", "microsoft::windows_10"}},
+		{prefix: "mo", expected: []string{"mozilla::firefox"}},
+		{prefix: "microsoft::windows_100", expected: []string{}},
+		{prefix: "apple", expected: []string{}},
+	}
+	for _, tt := range tests {
+		actual := []string{}
+		tree.walkPrefix(tt.prefix, func(key string) bool {
+			actual = append(actual, key)
+			return true
+		})
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%q: actual %#v, expected %#v", tt.prefix, actual, tt.expected)
+		}
+	}
+
+	// the walk stops when fn returns false
+	n := 0
+	tree.walkPrefix("micro", func(string) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("actual %d keys walked, expected 1", n)
+	}
+}
@@ -1,34 +1,92 @@
 package db
 
 import (
+	"database/sql"
 	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/cheggaaa/pb/v3"
+	"github.com/inconshreveable/log15"
 	"github.com/jinzhu/gorm"
 	"github.com/k0kubun/pp"
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/config"
 	"github.com/kotakanbe/go-cpe-dictionary/models"
-	sqlite3 "github.com/mattn/go-sqlite3"
 	"golang.org/x/xerrors"
+)
 
-	// Required MySQL.  See http://jinzhu.me/gorm/database.html#connecting-to-a-database
-	_ "github.com/jinzhu/gorm/dialects/mysql"
-	_ "github.com/jinzhu/gorm/dialects/postgres"
+// lockErrors tell whether an error of a dialect is caused by lock contention.
+// They are registered by the files of the dialects compiled in.
+var lockErrors []func(error) bool
 
-	// Required SQLite3.
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
-)
+// retryableErrors tell whether an error of a dialect aborted the transaction, which succeeds when run again,
+// e.g. a deadlock or a serialization failure. They are registered by the files of the dialects compiled in.
+var retryableErrors []func(error) bool
 
-// Supported DB dialects.
-const (
-	dialectSqlite3    = "sqlite3"
-	dialectMysql      = "mysql"
-	dialectPostgreSQL = "postgres"
-)
+// maxTransactionRetries is the number of the retries of a transaction aborted by a retryable error
+const maxTransactionRetries = 3
+
+// transactionRetryWait is the wait before the first retry of a transaction, doubled on each retry
+var transactionRetryWait = 100 * time.Millisecond
+
+// tablePrefixKey is the gorm setting of the table prefix of a connection, kept by the transactions and the scopes cloned from it
+const tablePrefixKey = "go-cpe-dictionary:table_prefix"
+
+// gorm v1 names the tables through this global handler, which takes the prefix of the connection naming the table,
+// so that the DBs of the different prefixes can be open at once, e.g. the cache and the store of the tiered DB
+func init() {
+	gorm.DefaultTableNameHandler = func(db *gorm.DB, defaultTableName string) string {
+		if db == nil {
+			return defaultTableName
+		}
+		if prefix, ok := db.Get(tablePrefixKey); ok {
+			return prefix.(string) + defaultTableName
+		}
+		return defaultTableName
+	}
+}
+
+// partitioners create the CPE table partitioned by the source on the dialects supporting it.
+// They are registered by the files of the dialects compiled in.
+var partitioners = map[string]func(*RDBDriver) error{}
+
+// partitionTruncaters truncate the partition of a source in a transaction, telling whether the source has its own partition.
+// They are registered by the files of the dialects compiled in.
+var partitionTruncaters = map[string]func(*RDBDriver, *gorm.DB, models.FetchType) (bool, error){}
+
+// maxPlaceholders are the number of placeholders a statement can have on each dialect
+var maxPlaceholders = map[string]int{
+	// SQLITE_MAX_VARIABLE_NUMBER before sqlite 3.32.0
+	dialectSqlite3:    999,
+	dialectMysql:      65535,
+	dialectPostgreSQL: 65535,
+}
+
+// estimatedRowBytes is a rough size of a CPE row in an INSERT statement, used to fit max_allowed_packet of MySQL
+const estimatedRowBytes = 1024
 
 // RDBDriver is Driver for RDB
 type RDBDriver struct {
-	name string
-	conn *gorm.DB
+	name      string
+	conn      *gorm.DB
+	log       log15.Logger
+	batchSize int
+
+	deleteBatchSize int
+	deletePause     time.Duration
+	partition       bool
+
+	prepareStmt bool
+	// threads bounds the workers binding the values of the batches of the insert ahead of the statements
+	threads int
+
+	fastRead                bool
+	stmtVendorProducts      *sql.Stmt
+	stmtCpesByVendorProduct *sql.Stmt
 }
 
 // Name return db name
@@ -38,29 +96,174 @@ func (r *RDBDriver) Name() string {
 
 // OpenDB opens Database
 func (r *RDBDriver) OpenDB(dbType, dbPath string, debugSQL bool) (locked bool, err error) {
-	r.conn, err = gorm.Open(dbType, dbPath)
-	if err != nil {
-		msg := fmt.Sprintf("Failed to open DB. dbtype: %s, dbpath: %s, err: %s", dbType, dbPath, err)
-		if r.name == dialectSqlite3 {
-			switch err.(sqlite3.Error).Code {
-			case sqlite3.ErrLocked, sqlite3.ErrBusy:
-				return true, fmt.Errorf(msg)
-			}
+	return r.openDB(dbType, dbPath, Option{DebugSQL: debugSQL})
+}
+
+// openDB opens Database with the options of Open
+func (r *RDBDriver) openDB(dbType, dbPath string, option Option) (locked bool, err error) {
+	r.log = option.Logger
+	if r.log == nil {
+		r.log = log15.Root()
+	}
+	r.fastRead = option.FastRead
+	r.prepareStmt = option.PrepareStmt
+	r.threads = option.Threads
+	if r.threads <= 0 {
+		r.threads = runtime.NumCPU()
+	}
+	r.batchSize = option.BatchSize
+	r.deleteBatchSize = option.DeleteBatchSize
+	r.deletePause = option.DeletePause
+	r.partition = option.Partition
+	if option.IAMAuth != "" {
+		var sqlDB *sql.DB
+		if sqlDB, err = openIAM(r.name, withTimeout(r.name, dbPath, option.Timeout), option.IAMAuth, option.Timeout); err == nil {
+			r.conn, err = gorm.Open(dbType, sqlDB)
 		}
-		return false, fmt.Errorf(msg)
+	} else {
+		r.conn, err = gorm.Open(dbType, withTimeout(r.name, dbPath, option.Timeout))
 	}
-	r.conn.LogMode(debugSQL)
+	if err != nil {
+		err = r.wrapLocked(err)
+		return xerrors.Is(err, ErrLocked), xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, dbPath, err)
+	}
+	r.conn = r.conn.Set(tablePrefixKey, option.TablePrefix)
+	// gorm passes the statements to the logger in its detailed mode only, which gormLogger filters
+	r.conn.LogMode(option.DebugSQL || 0 < option.SlowQuery)
+	r.conn.SetLogger(gormLogger{log: r.log, debugSQL: option.DebugSQL, slowQuery: option.SlowQuery})
 	if r.name == dialectSqlite3 {
 		r.conn.Exec("PRAGMA foreign_keys = ON")
 	}
 	return false, nil
 }
 
+// gormLogger sends the logs of gorm to a log15 logger instead of stdout: the SQL statements and the errors at the debug level by debugSQL,
+// and the statements taking longer than slowQuery as warnings
+type gormLogger struct {
+	log       log15.Logger
+	debugSQL  bool
+	slowQuery time.Duration
+}
+
+// maxSlowSQL is the length of the slow statements logged, cutting the inserts of large batches short
+const maxSlowSQL = 512
+
+// Print takes "sql", the source, the elapsed time, the statement, its vars and the rows affected from gorm,
+// or "log" or "error", the source and the messages
+func (l gormLogger) Print(v ...interface{}) {
+	if len(v) < 6 || v[0] != "sql" {
+		if l.debugSQL && 2 < len(v) {
+			l.log.Debug(strings.TrimSpace(fmt.Sprint(v[2:]...)), "source", v[1])
+		}
+		return
+	}
+	source, _ := v[1].(string)
+	elapsed, _ := v[2].(time.Duration)
+	statement, _ := v[3].(string)
+	vars, _ := v[4].([]interface{})
+	if 0 < l.slowQuery && l.slowQuery <= elapsed {
+		if maxSlowSQL < len(statement) {
+			statement = statement[:maxSlowSQL] + "..."
+		}
+		l.log.Warn("Slow query", "elapsed", elapsed, "sql", statement, "vars", len(vars), "rows", v[5], "source", source)
+		return
+	}
+	if l.debugSQL {
+		l.log.Debug("SQL", "elapsed", elapsed, "sql", statement, "vars", vars, "rows", v[5], "source", source)
+	}
+}
+
+// withTimeout adds the connect timeout (sqlite3: the busy timeout) to the DSN of the dialect
+func withTimeout(dialect, dsn string, timeout time.Duration) string {
+	if timeout <= 0 {
+		return dsn
+	}
+	switch dialect {
+	case dialectSqlite3:
+		return appendDSNParam(dsn, fmt.Sprintf("_busy_timeout=%d", timeout.Milliseconds()))
+	case dialectMysql:
+		return appendDSNParam(dsn, fmt.Sprintf("timeout=%s", timeout))
+	case dialectPostgreSQL:
+		// connect_timeout is in seconds
+		param := fmt.Sprintf("connect_timeout=%d", int(math.Ceil(timeout.Seconds())))
+		if strings.Contains(dsn, "://") {
+			return appendDSNParam(dsn, param)
+		}
+		return dsn + " " + param
+	}
+	return dsn
+}
+
+func appendDSNParam(dsn, param string) string {
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + param
+	}
+	return dsn + "?" + param
+}
+
+// wrapLocked marks errors caused by lock contention as ErrLocked
+func (r *RDBDriver) wrapLocked(err error) error {
+	for _, isLocked := range lockErrors {
+		if isLocked(err) {
+			return &lockedError{err: err}
+		}
+	}
+	return err
+}
+
+// withTransactionRetry runs fn in a transaction of conn, and runs the whole transaction again
+// when it's aborted by a deadlock, a serialization failure or SQLITE_BUSY, up to maxTransactionRetries times.
+// fn may run more than once, so it must not change anything outside the transaction.
+func (r *RDBDriver) withTransactionRetry(conn *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	wait := transactionRetryWait
+	for retries := 0; ; retries++ {
+		if err = r.transaction(conn, fn); err == nil || maxTransactionRetries <= retries || !isRetryable(err) {
+			return err
+		}
+		r.log.Warn("Retrying the transaction", "retries", retries+1, "wait", wait, "err", err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// transaction runs fn in a transaction of conn, committed when fn succeeds and rolled back otherwise
+func (r *RDBDriver) transaction(conn *gorm.DB, fn func(tx *gorm.DB) error) error {
+	tx := conn.Begin()
+	if err := tx.Error; err != nil {
+		return xerrors.Errorf("Failed to begin a transaction. err: %w", r.wrapLocked(err))
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return xerrors.Errorf("Failed to commit. err: %w", r.wrapLocked(err))
+	}
+	return nil
+}
+
+// isRetryable tells whether err, or an error wrapped in it, is retryable on a dialect
+func isRetryable(err error) bool {
+	for ; err != nil; err = xerrors.Unwrap(err) {
+		for _, retryable := range retryableErrors {
+			if retryable(err) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // CloseDB close Database
 func (r *RDBDriver) CloseDB() (err error) {
 	if r.conn == nil {
 		return
 	}
+	for _, stmt := range []*sql.Stmt{r.stmtVendorProducts, r.stmtCpesByVendorProduct} {
+		if stmt != nil {
+			_ = stmt.Close()
+		}
+	}
 	if err = r.conn.Close(); err != nil {
 		return xerrors.Errorf("Failed to close DB. Type: %s. err: %w", r.name, err)
 	}
@@ -69,24 +272,262 @@ func (r *RDBDriver) CloseDB() (err error) {
 
 // MigrateDB migrates Database
 func (r *RDBDriver) MigrateDB() error {
+	if r.partition {
+		if partition, ok := partitioners[r.name]; !ok {
+			r.log.Warn("Partitioning is only supported by PostgreSQL. Ignored", "dialect", r.name)
+		} else if err := partition(r); err != nil {
+			return fmt.Errorf("Failed to create the partitioned table. err: %s", err)
+		}
+	}
 	if err := r.conn.AutoMigrate(
+		&models.FetchMeta{},
 		&models.CategorizedCpe{},
+		&models.FetchHistory{},
+		&models.WatchedProduct{},
+		&models.WatchChange{},
+		&models.RejectedCpe{},
+		&models.VendorProduct{},
+		&models.DistroPackage{},
+		&models.KnownExploitedProduct{},
+		&models.AuditEntry{},
 	).Error; err != nil {
 		return fmt.Errorf("Failed to migrate. err: %s", err)
 	}
+	if err := r.backfillVendorProducts(); err != nil {
+		return fmt.Errorf("Failed to build the vendor/products. err: %s", err)
+	}
+	if err := r.addUniqueIndex(); err != nil {
+		// a DB of the older versions may have duplicates
+		r.log.Warn("Failed to add the unique index on (cpe_uri, fetch_type). Run check-integrity --repair", "err", err)
+	}
+	if r.fastRead {
+		if err := r.prepareStmts(); err != nil {
+			return fmt.Errorf("Failed to prepare statements. err: %s", err)
+		}
+	}
+	return nil
+}
+
+// backfillVendorProducts builds the vendor/products of a DB fetched by the older versions
+func (r *RDBDriver) backfillVendorProducts() error {
+	built, err := r.hasRows(&models.VendorProduct{})
+	if err != nil || built {
+		return err
+	}
+	fetched, err := r.hasRows(&models.CategorizedCpe{})
+	if err != nil || !fetched {
+		return err
+	}
+	return r.refreshVendorProducts(r.conn)
+}
+
+func (r *RDBDriver) hasRows(model interface{}) (bool, error) {
+	err := r.conn.Select("id").First(model).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, r.wrapLocked(err)
+	}
+	return true, nil
+}
+
+// refreshVendorProducts rebuilds the vendor/products from the CPEs.
+// It runs once per fetch, so GetVendorProducts and the like read a small table instead of grouping every CPE.
+func (r *RDBDriver) refreshVendorProducts(tx *gorm.DB) error {
+	table := tx.NewScope(&models.VendorProduct{}).QuotedTableName()
+	if err := tx.Exec(fmt.Sprintf("DELETE FROM %s", table)).Error; err != nil {
+		return r.wrapLocked(err)
+	}
+	if err := tx.Exec(fmt.Sprintf("INSERT INTO %s (vendor, product, popularity, title) SELECT vendor, product, MAX(popularity), MAX(title) FROM %s GROUP BY vendor, product",
+		table, tx.NewScope(&models.CategorizedCpe{}).QuotedTableName())).Error; err != nil {
+		return r.wrapLocked(err)
+	}
+	return nil
+}
+
+// addUniqueIndex adds the unique index on (cpe_uri, fetch_type).
+// The index is named after the table, since index names are shared by the tables of a prefix on some dialects.
+func (r *RDBDriver) addUniqueIndex() error {
+	table := r.conn.NewScope(&models.CategorizedCpe{}).TableName()
+	name := fmt.Sprintf("uix_%s_cpe_uri_fetch_type", table)
+	if r.conn.Dialect().HasIndex(table, name) {
+		return nil
+	}
+	return r.conn.Model(&models.CategorizedCpe{}).AddUniqueIndex(name, "cpe_uri", "fetch_type").Error
+}
+
+// likeVendorProduct is the condition of the vendor/product LIKE patterns, escaping a wildcard by LikeEscape
+var likeVendorProduct = fmt.Sprintf("vendor LIKE ? ESCAPE '%c' and product LIKE ? ESCAPE '%c'", LikeEscape, LikeEscape)
+
+// prepareStmts prepares the raw SQL used by the fast read path.
+// They need the tables, so this runs after the migration.
+func (r *RDBDriver) prepareStmts() (err error) {
+	placeholders := []interface{}{"?", "?"}
+	if r.name == dialectPostgreSQL {
+		placeholders = []interface{}{"$1", "$2"}
+	}
+	table := r.conn.NewScope(&models.CategorizedCpe{}).TableName()
+
+	if r.stmtVendorProducts, err = r.conn.DB().Prepare(
+		fmt.Sprintf("SELECT vendor, product FROM %s ORDER BY vendor, product", r.conn.NewScope(&models.VendorProduct{}).TableName())); err != nil {
+		return err
+	}
+	if r.stmtCpesByVendorProduct, err = r.conn.DB().Prepare(
+		fmt.Sprintf("SELECT DISTINCT cpe_uri, deprecated, fetch_type FROM %s WHERE vendor LIKE %s ESCAPE '%c' AND product LIKE %s ESCAPE '%c'", table, placeholders[0], LikeEscape, placeholders[1], LikeEscape)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetFetchMeta get FetchMeta from Database
+func (r *RDBDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	fetchMeta := models.FetchMeta{}
+	if err := r.conn.Take(&fetchMeta).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return nil, xerrors.Errorf("Failed to get FetchMeta. err: %w", err)
+		}
+		return &models.FetchMeta{GoCPEDictRevision: config.Revision, SchemaVersion: models.LatestSchemaVersion, LastFetchedAt: neverFetchedAt}, nil
+	}
+	return &fetchMeta, nil
+}
+
+// UpsertFetchMeta upsert FetchMeta to Database
+func (r *RDBDriver) UpsertFetchMeta(fetchMeta *models.FetchMeta) error {
+	fetchMeta.GoCPEDictRevision = config.Revision
+	fetchMeta.SchemaVersion = models.LatestSchemaVersion
+	if err := r.conn.Save(fetchMeta).Error; err != nil {
+		return xerrors.Errorf("Failed to upsert FetchMeta. err: %w", r.wrapLocked(err))
+	}
 	return nil
 }
 
+// InsertFetchHistory records a fetch of a source
+func (r *RDBDriver) InsertFetchHistory(history *models.FetchHistory) error {
+	if err := r.conn.Create(history).Error; err != nil {
+		return xerrors.Errorf("Failed to insert FetchHistory. err: %w", r.wrapLocked(err))
+	}
+	return nil
+}
+
+// GetLatestFetchHistories returns the latest fetch of each source
+func (r *RDBDriver) GetLatestFetchHistories() ([]models.FetchHistory, error) {
+	table := r.conn.NewScope(&models.FetchHistory{}).TableName()
+	histories := []models.FetchHistory{}
+	if err := r.conn.Where(fmt.Sprintf("id IN (SELECT MAX(id) FROM %s GROUP BY fetch_type)", table)).Order("fetch_type").Find(&histories).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to get FetchHistory. err: %w", err)
+	}
+	return histories, nil
+}
+
+// InsertAuditEntry records a data-modifying operation
+func (r *RDBDriver) InsertAuditEntry(entry *models.AuditEntry) error {
+	if err := r.conn.Create(entry).Error; err != nil {
+		return xerrors.Errorf("Failed to insert AuditEntry. err: %w", r.wrapLocked(err))
+	}
+	return nil
+}
+
+// GetAuditEntries returns the operations at or after since, oldest first
+func (r *RDBDriver) GetAuditEntries(since time.Time) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	if err := r.conn.Where("operated_at >= ?", since).Order("operated_at, id").Find(&entries).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to get AuditEntry. err: %w", err)
+	}
+	return entries, nil
+}
+
+// GetWatchlist returns the watched products
+func (r *RDBDriver) GetWatchlist() ([]models.WatchedProduct, error) {
+	watchlist := []models.WatchedProduct{}
+	if err := r.conn.Order("vendor, product").Find(&watchlist).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to get watchlist. err: %w", err)
+	}
+	return watchlist, nil
+}
+
+// UpsertWatchedProduct puts a product on the watchlist, or updates it
+func (r *RDBDriver) UpsertWatchedProduct(watched *models.WatchedProduct) error {
+	if err := r.conn.Where(models.WatchedProduct{Vendor: watched.Vendor, Product: watched.Product}).
+		// a map, since a struct skips the emptied fields
+		Assign(map[string]interface{}{"versions": watched.Versions, "deprecated_cpes": watched.DeprecatedCpes, "checked_at": watched.CheckedAt}).
+		FirstOrCreate(watched).Error; err != nil {
+		return xerrors.Errorf("Failed to upsert watched product. err: %w", r.wrapLocked(err))
+	}
+	return nil
+}
+
+// DeleteWatchedProduct removes a product from the watchlist, and returns whether it was there
+func (r *RDBDriver) DeleteWatchedProduct(vendor, product string) (bool, error) {
+	res := r.conn.Where("vendor = ? AND product = ?", vendor, product).Delete(&models.WatchedProduct{})
+	if res.Error != nil {
+		return false, xerrors.Errorf("Failed to delete watched product. err: %w", r.wrapLocked(res.Error))
+	}
+	return 0 < res.RowsAffected, nil
+}
+
+// InsertWatchChanges records the changes of the watched products
+func (r *RDBDriver) InsertWatchChanges(changes []models.WatchChange) error {
+	return r.withTransactionRetry(r.conn, func(tx *gorm.DB) error {
+		for i := range changes {
+			// the ID assigned by a rolled back attempt is assigned again
+			changes[i].ID = 0
+			if err := tx.Create(&changes[i]).Error; err != nil {
+				return xerrors.Errorf("Failed to insert watch change. err: %w", r.wrapLocked(err))
+			}
+		}
+		return nil
+	})
+}
+
+// GetWatchChanges returns the changes of the watched products detected at or after since, oldest first
+func (r *RDBDriver) GetWatchChanges(since time.Time) ([]models.WatchChange, error) {
+	changes := []models.WatchChange{}
+	if err := r.conn.Where("detected_at >= ?", since).Order("detected_at, id").Find(&changes).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to get watch changes. err: %w", err)
+	}
+	return changes, nil
+}
+
+// ReplaceRejectedCpes replaces the rejected CPEs of the source
+func (r *RDBDriver) ReplaceRejectedCpes(source models.FetchType, rejects []models.RejectedCpe) error {
+	return r.withTransactionRetry(r.conn, func(tx *gorm.DB) error {
+		if err := tx.Where("fetch_type = ?", source).Delete(&models.RejectedCpe{}).Error; err != nil {
+			return xerrors.Errorf("Failed to delete rejected CPEs. err: %w", r.wrapLocked(err))
+		}
+		for i := range rejects {
+			c := rejects[i]
+			c.ID = 0
+			c.FetchType = source
+			if err := tx.Create(&c).Error; err != nil {
+				return xerrors.Errorf("Failed to insert rejected CPE. err: %w", r.wrapLocked(err))
+			}
+		}
+		return nil
+	})
+}
+
+// GetRejectedCpes returns the rejected CPEs of the source, or of all the sources when source is empty
+func (r *RDBDriver) GetRejectedCpes(source models.FetchType) ([]models.RejectedCpe, error) {
+	rejects := []models.RejectedCpe{}
+	q := r.conn
+	if source != "" {
+		q = q.Where("fetch_type = ?", source)
+	}
+	if err := q.Order("fetch_type, id").Find(&rejects).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to get rejected CPEs. err: %w", r.wrapLocked(err))
+	}
+	return rejects, nil
+}
+
 // GetVendorProducts : GetVendorProducts
 func (r *RDBDriver) GetVendorProducts() (vendorProducts []string, err error) {
-	var results []struct {
-		Vendor  string
-		Product string
+	if r.stmtVendorProducts != nil {
+		return r.getVendorProductsFast()
 	}
 
-	// TODO Is there a better way to use distinct with GORM? Needing
-	// explicit column names seems like an antipattern for an orm.
-	if err = r.conn.Select("DISTINCT vendor, product").Find(&models.CategorizedCpe{}).Scan(&results).Error; err != nil && err != gorm.ErrRecordNotFound {
+	var results []models.VendorProduct
+	if err = r.conn.Select("vendor, product").Order("vendor, product").Find(&results).Error; err != nil && err != gorm.ErrRecordNotFound {
 		return nil, fmt.Errorf("Failed to select results. err: %s", err)
 	}
 
@@ -96,54 +537,944 @@ func (r *RDBDriver) GetVendorProducts() (vendorProducts []string, err error) {
 	return
 }
 
+func (r *RDBDriver) getVendorProductsFast() (vendorProducts []string, err error) {
+	rows, err := r.stmtVendorProducts.Query()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vendor, product string
+		if err := rows.Scan(&vendor, &product); err != nil {
+			return nil, fmt.Errorf("Failed to scan results. err: %s", err)
+		}
+		vendorProducts = append(vendorProducts, fmt.Sprintf("%s::%s", vendor, product))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+	return vendorProducts, nil
+}
+
+// GetVendorProductsByPopularity : GetVendorProducts sorted by the number of referencing CVEs
+func (r *RDBDriver) GetVendorProductsByPopularity() (vendorProducts []string, err error) {
+	var results []models.VendorProduct
+	if err = r.conn.Select("vendor, product").Order("popularity DESC, vendor, product").Find(&results).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+
+	for _, vp := range results {
+		vendorProducts = append(vendorProducts, fmt.Sprintf("%s::%s", vp.Vendor, vp.Product))
+	}
+	return
+}
+
+// GetVendorProductTitles : GetVendorProductTitles returns the titles keyed by vendor::product
+func (r *RDBDriver) GetVendorProductTitles() (map[string]string, error) {
+	var results []models.VendorProduct
+	if err := r.conn.Select("vendor, product, title").Where("title <> ?", "").Find(&results).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+
+	titles := map[string]string{}
+	for _, vp := range results {
+		titles[fmt.Sprintf("%s::%s", vp.Vendor, vp.Product)] = vp.Title
+	}
+	return titles, nil
+}
+
+// GetProductSummaries : GetProductSummaries groups the CPEs by vendor/product
+func (r *RDBDriver) GetProductSummaries() ([]models.ProductSummary, error) {
+	var results []struct {
+		Vendor     string
+		Product    string
+		Versions   int
+		Cpes       int
+		Deprecated int
+		Popularity int
+	}
+	if err := r.conn.Model(&models.CategorizedCpe{}).
+		Select("vendor, product, COUNT(DISTINCT CASE WHEN version NOT IN ('', 'ANY', 'NA') THEN version END) AS versions, COUNT(DISTINCT cpe_uri) AS cpes, COUNT(DISTINCT CASE WHEN deprecated THEN cpe_uri END) AS deprecated, MAX(popularity) AS popularity").
+		Group("vendor, product").Order("vendor, product").Scan(&results).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+
+	var parts []struct {
+		Vendor  string
+		Product string
+		Part    string
+	}
+	if err := r.conn.Model(&models.CategorizedCpe{}).Select("DISTINCT vendor, product, part").Order("part").Scan(&parts).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+	partsByVP := map[string][]string{}
+	for _, p := range parts {
+		vp := fmt.Sprintf("%s::%s", p.Vendor, p.Product)
+		partsByVP[vp] = append(partsByVP[vp], p.Part)
+	}
+
+	summaries := make([]models.ProductSummary, 0, len(results))
+	for _, res := range results {
+		summaries = append(summaries, models.ProductSummary{
+			Vendor:     res.Vendor,
+			Product:    res.Product,
+			Versions:   res.Versions,
+			CPEs:       res.Cpes,
+			Deprecated: res.Deprecated,
+			Popularity: res.Popularity,
+			Parts:      partsByVP[fmt.Sprintf("%s::%s", res.Vendor, res.Product)],
+		})
+	}
+	return summaries, nil
+}
+
 // GetCpesByVendorProduct : GetCpesByVendorProduct
 func (r *RDBDriver) GetCpesByVendorProduct(vendor, product string) ([]string, []string, error) {
+	if r.stmtCpesByVendorProduct != nil {
+		return r.getCpesByVendorProductFast(vendor, product)
+	}
+
+	details, err := r.GetCpeDetailsByVendorProduct(vendor, product)
+	if err != nil {
+		return nil, nil, err
+	}
+	cpeURIs, deprecated := details.CpeURIs()
+	return cpeURIs, deprecated, nil
+}
+
+// GetCpeDetailsByVendorProduct : GetCpeDetailsByVendorProduct
+func (r *RDBDriver) GetCpeDetailsByVendorProduct(vendor, product string) (*models.CpeDetails, error) {
 	results := []models.CategorizedCpe{}
-	err := r.conn.Select("DISTINCT cpe_uri, deprecated").Find(&results, "vendor LIKE ? and product LIKE ?", vendor, product).Error
+	err := r.conn.Select("DISTINCT cpe_uri, deprecated, deprecated_by, fetch_type, refs").Find(&results, likeVendorProduct, vendor, product).Error
 	if err != nil && err != gorm.ErrRecordNotFound {
-		return nil, nil, fmt.Errorf("Failed to select results. err: %s", err)
+		return nil, fmt.Errorf("Failed to select results. err: %s", err)
 	}
-	cpeURIs, deprecated := []string{}, []string{}
-	for _, r := range results {
-		if r.Deprecated {
-			deprecated = append(deprecated, r.CpeURI)
+	return cpeDetails(results), nil
+}
+
+// splitDeprecated dedupes the CPEs defined by multiple sources by dedupe and splits them by the deprecation, keeping the order
+func splitDeprecated(results []models.CategorizedCpe) (cpeURIs, deprecated []string) {
+	cpeURIs, deprecated = []string{}, []string{}
+	for _, c := range dedupe(results) {
+		if c.Deprecated {
+			deprecated = append(deprecated, c.CpeURI)
 		} else {
-			cpeURIs = append(cpeURIs, r.CpeURI)
+			cpeURIs = append(cpeURIs, c.CpeURI)
 		}
 	}
+	return cpeURIs, deprecated
+}
+
+// GetSourcedCpesByVendorProduct : GetSourcedCpesByVendorProduct merges the CPEs over the sources.
+// Empty sources means all sources.
+func (r *RDBDriver) GetSourcedCpesByVendorProduct(vendor, product string, sources []models.FetchType) ([]models.SourcedCpe, error) {
+	q := r.conn.Select("DISTINCT cpe_uri, deprecated, fetch_type, cpe_name_id, deprecated_by").Where(likeVendorProduct, vendor, product)
+	if 0 < len(sources) {
+		q = q.Where("fetch_type IN (?)", sources)
+	}
+	results := []models.CategorizedCpe{}
+	if err := q.Find(&results).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+	return mergeSources(results), nil
+}
+
+func (r *RDBDriver) getCpesByVendorProductFast(vendor, product string) ([]string, []string, error) {
+	rows, err := r.stmtCpesByVendorProduct.Query(vendor, product)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+	defer rows.Close()
+
+	results := []models.CategorizedCpe{}
+	for rows.Next() {
+		var c models.CategorizedCpe
+		if err := rows.Scan(&c.CpeURI, &c.Deprecated, &c.FetchType); err != nil {
+			return nil, nil, fmt.Errorf("Failed to scan results. err: %s", err)
+		}
+		results = append(results, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+	cpeURIs, deprecated := splitDeprecated(results)
 	return cpeURIs, deprecated, nil
 }
 
+// GetProductsByVersion : GetProductsByVersion returns vendor::product having the version
+func (r *RDBDriver) GetProductsByVersion(version string) ([]string, error) {
+	var results []struct {
+		Vendor  string
+		Product string
+	}
+
+	if err := r.conn.Model(&models.CategorizedCpe{}).Select("DISTINCT vendor, product").Where("version = ?", quoteWFN(version)).Order("vendor, product").Scan(&results).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+
+	vendorProducts := []string{}
+	for _, vp := range results {
+		vendorProducts = append(vendorProducts, fmt.Sprintf("%s::%s", vp.Vendor, vp.Product))
+	}
+	return vendorProducts, nil
+}
+
+// GetVersionsByVendorProduct : GetVersionsByVendorProduct returns the versions of vendor/product between from and to.
+// SQL can't order the versions, so the distinct versions are filtered by versionOrdinal.
+func (r *RDBDriver) GetVersionsByVendorProduct(vendor, product, from, to string) ([]string, error) {
+	var versions []string
+	if err := r.conn.Model(&models.CategorizedCpe{}).Where("vendor = ? AND product = ?", vendor, product).Pluck("DISTINCT version", &versions).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("Failed to select versions. err: %s", err)
+	}
+	return versionsInRange(versions, from, to), nil
+}
+
+// CountCpes returns the number of CPEs defined by the source
+func (r *RDBDriver) CountCpes(fetchType models.FetchType) (count int, err error) {
+	if err := r.conn.Model(&models.CategorizedCpe{}).Where("fetch_type = ?", fetchType).Select("COUNT(DISTINCT cpe_uri)").Row().Scan(&count); err != nil {
+		return 0, xerrors.Errorf("Failed to count CPEs. fetchType: %s, err: %w", fetchType, err)
+	}
+	return count, nil
+}
+
+// GetCpesChangedSince returns the CPEs added or changed by the fetches after generation and at or after since, in the order of insertion.
+// Zero generation and since return all the CPEs.
+func (r *RDBDriver) GetCpesChangedSince(generation uint64, since time.Time) ([]models.CategorizedCpe, error) {
+	q := r.conn.Order("id")
+	if 0 < generation {
+		q = q.Where("generation > ?", generation)
+	}
+	if !since.IsZero() {
+		q = q.Where("changed_at >= ?", since)
+	}
+	cpes := []models.CategorizedCpe{}
+	if err := q.Find(&cpes).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to get the changed CPEs. err: %w", err)
+	}
+	return cpes, nil
+}
+
+// addedAsOf is the condition of the CPEs added at or before a time, including those added before the history was tracked
+const addedAsOf = "added_at IS NULL OR added_at <= ?"
+
+// GetVendorProductsAsOf returns the vendor/products having the CPEs added at or before asOf, sorted
+func (r *RDBDriver) GetVendorProductsAsOf(asOf time.Time) ([]string, error) {
+	var results []struct {
+		Vendor  string
+		Product string
+	}
+	if err := r.conn.Model(&models.CategorizedCpe{}).Select("DISTINCT vendor, product").Where(addedAsOf, asOf).
+		Order("vendor, product").Scan(&results).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, xerrors.Errorf("Failed to select the vendor/products. asOf: %s, err: %w", asOf, err)
+	}
+	vendorProducts := make([]string, 0, len(results))
+	for _, vp := range results {
+		vendorProducts = append(vendorProducts, fmt.Sprintf("%s::%s", vp.Vendor, vp.Product))
+	}
+	return vendorProducts, nil
+}
+
+// GetCpeDetailsAsOf returns the CPEs of vendor/product added at or before asOf, deprecated when they were deprecated by then
+func (r *RDBDriver) GetCpeDetailsAsOf(vendor, product string, asOf time.Time) (*models.CpeDetails, error) {
+	results := []models.CategorizedCpe{}
+	err := r.conn.Select("DISTINCT cpe_uri, deprecated, deprecated_by, deprecated_at, fetch_type, refs").Where(likeVendorProduct, vendor, product).Where(addedAsOf, asOf).Find(&results).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, xerrors.Errorf("Failed to select the CPEs. asOf: %s, err: %w", asOf, err)
+	}
+	return cpeDetails(deprecatedAsOf(results, asOf)), nil
+}
+
+// attributeColumns are the columns of the WFN attributes by their names
+var attributeColumns = map[string]string{
+	"part":       "part",
+	"vendor":     "vendor",
+	"product":    "product",
+	"version":    "version",
+	"update":     "update",
+	"edition":    "edition",
+	"language":   "language",
+	"sw_edition": "software_edition",
+	"target_sw":  "target_software",
+	"target_hw":  "target_hardware",
+	"other":      "other",
+}
+
+// GetAttributeStats groups the CPEs by each of the attributes
+func (r *RDBDriver) GetAttributeStats(attributes []string, top int) ([]models.AttributeStat, error) {
+	if err := validateAttributes(attributes); err != nil {
+		return nil, err
+	}
+	stats := make([]models.AttributeStat, 0, len(attributes))
+	for _, a := range attributes {
+		column := r.conn.Dialect().Quote(attributeColumns[a])
+		var results []struct {
+			Value string
+			Cpes  int
+		}
+		if err := r.conn.Model(&models.CategorizedCpe{}).
+			Select(fmt.Sprintf("%s AS value, COUNT(DISTINCT cpe_uri) AS cpes", column)).
+			Group(column).Scan(&results).Error; err != nil && err != gorm.ErrRecordNotFound {
+			return nil, xerrors.Errorf("Failed to group CPEs. attribute: %s, err: %w", a, err)
+		}
+		counts := map[string]int{}
+		for _, res := range results {
+			// the attributes not set are ANY, as in the WFN
+			if res.Value == "" {
+				res.Value = "ANY"
+			}
+			counts[res.Value] += res.Cpes
+		}
+		stats = append(stats, topAttributeValues(a, counts, top))
+	}
+	return stats, nil
+}
+
 // InsertCpes inserts Cpe Information into DB
 func (r *RDBDriver) InsertCpes(cpes []models.CategorizedCpe) error {
-	return r.deleteAndInsertCpes(r.conn, cpes)
+	return r.deleteAndInsertCpes(r.conn, cpes, "")
 }
 
-func (r *RDBDriver) deleteAndInsertCpes(conn *gorm.DB, cpes []models.CategorizedCpe) (err error) {
-	bar := pb.StartNew(len(cpes))
-	tx := conn.Begin()
-	defer func() {
+// ReplaceCpes inserts the CPEs of a complete fetch of source, and deletes the rows of source missing from it in the same transaction
+func (r *RDBDriver) ReplaceCpes(source models.FetchType, cpes []models.CategorizedCpe) error {
+	for _, c := range cpes {
+		if c.FetchType != source {
+			return xerrors.Errorf("Failed to replace the CPEs of %s. The CPE is of another source. cpe: %s, source: %s", source, c.CpeURI, c.FetchType)
+		}
+	}
+	return r.deleteAndInsertCpes(r.conn, cpes, source)
+}
+
+// deleteAndInsertCpes inserts cpes, and deletes the rows of replace missing from them unless replace is empty.
+// With Option.Partition, the partition of replace is truncated and reloaded instead.
+func (r *RDBDriver) deleteAndInsertCpes(conn *gorm.DB, cpes []models.CategorizedCpe, replace models.FetchType) error {
+	// merge the duplicates, keeping the attributes set by any of them
+	rows := []models.CategorizedCpe{}
+	idx := map[cpeKey]int{}
+	for _, c := range cpes {
+		k := cpeKey{fetchType: c.FetchType, cpeURI: c.CpeURI}
+		i, ok := idx[k]
+		if !ok {
+			idx[k] = len(rows)
+			rows = append(rows, c)
+			continue
+		}
+		if 0 < c.Popularity {
+			rows[i].Popularity = c.Popularity
+		}
+		if c.Title != "" {
+			rows[i].Title = c.Title
+		}
+		if c.CpeNameID != "" {
+			rows[i].CpeNameID = c.CpeNameID
+		}
+		if c.DeprecatedBy != "" {
+			rows[i].DeprecatedBy = c.DeprecatedBy
+		}
+		if c.References != "" {
+			rows[i].References = c.References
+		}
+	}
+
+	return r.withTransactionRetry(conn, func(tx *gorm.DB) error {
+		// started over by a retry
+		bar := pb.StartNew(len(rows))
+
+		existing, err := r.findStoredCpes(tx, rows)
 		if err != nil {
-			tx.Rollback()
-			return
+			return err
+		}
+		// a source is refreshed by truncating its partition rather than updating and deleting its rows one by one
+		truncated := false
+		if truncate, ok := partitionTruncaters[r.name]; ok && r.partition && replace != "" {
+			if truncated, err = truncate(r, tx, replace); err != nil {
+				return xerrors.Errorf("Failed to truncate the partition. source: %s, err: %w", replace, err)
+			}
+		}
+
+		// the history of the CPEs kept for the queries as of a past time, by the time of the fetch or now without it
+		now := time.Now()
+		inserts := []models.CategorizedCpe{}
+		for _, c := range rows {
+			at := c.ChangedAt
+			if at == nil {
+				at = &now
+			}
+			stored, ok := existing[cpeKey{fetchType: c.FetchType, cpeURI: c.CpeURI}]
+			if truncated && ok {
+				inserts = append(inserts, reloadedCpe(c, stored, at))
+				continue
+			}
+			if !ok {
+				if c.AddedAt == nil {
+					c.AddedAt = at
+				}
+				if c.Deprecated && c.DeprecatedAt == nil {
+					c.DeprecatedAt = at
+				}
+				inserts = append(inserts, c)
+				continue
+			}
+			// keep the attributes set by the other source, and leave the unchanged ones as is
+			assign := map[string]interface{}{}
+			if 0 < c.Popularity && c.Popularity != stored.Popularity {
+				assign["popularity"] = c.Popularity
+			}
+			if c.Title != "" && c.Title != stored.Title {
+				assign["title"] = c.Title
+			}
+			if c.CpeNameID != "" && c.CpeNameID != stored.CpeNameID {
+				assign["cpe_name_id"] = c.CpeNameID
+			}
+			if c.References != "" && c.References != stored.Refs {
+				assign["refs"] = c.References
+			}
+			if c.DeprecatedBy != "" && (!stored.Deprecated || c.DeprecatedBy != stored.DeprecatedBy) {
+				assign["deprecated"] = true
+				assign["deprecated_by"] = c.DeprecatedBy
+				if !stored.Deprecated {
+					assign["deprecated_at"] = at
+				}
+			}
+			// stamped by the fetch, telling the delta export what changed
+			if 0 < len(assign) && 0 < c.Generation {
+				assign["generation"] = c.Generation
+				assign["changed_at"] = c.ChangedAt
+			}
+			if 0 < len(assign) {
+				if err := tx.Model(&models.CategorizedCpe{ID: stored.ID}).Updates(assign).Error; err != nil {
+					return xerrors.Errorf("Failed to update. cpe: %s, err: %w",
+						pp.Sprintf("%v", c), r.wrapLocked(err))
+				}
+			}
+			bar.Increment()
+		}
+
+		scope := tx.NewScope(&models.CategorizedCpe{})
+		columns := []string{}
+		for _, f := range scope.Fields() {
+			if f.IsNormal && !f.IsPrimaryKey {
+				columns = append(columns, scope.Quote(f.DBName))
+			}
+		}
+		placeholders := "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+		batchSize := r.tuneBatchSize(tx, len(columns))
+
+		// the full batches share a prepared statement, the last partial one is executed as is
+		var stmt *sql.Stmt
+		if r.prepareStmt && batchSize < len(inserts) {
+			if stmt, err = tx.CommonDB().Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", scope.QuotedTableName(), strings.Join(columns, ","), r.bindVars(batchSize, len(columns)))); err != nil {
+				return xerrors.Errorf("Failed to prepare the insert. err: %w", r.wrapLocked(err))
+			}
+			defer stmt.Close()
+		}
+
+		// the values of the next batches are bound by r.threads workers while a batch is executed, in the order of the batches
+		done := make(chan struct{})
+		defer close(done)
+		for bound := range bindBatches(tx, inserts, batchSize, r.threads, done) {
+			b := <-bound
+			if stmt != nil && b.rows == batchSize {
+				if _, err := stmt.Exec(b.vars...); err != nil {
+					return xerrors.Errorf("Failed to insert. err: %w", r.wrapLocked(err))
+				}
+			} else if err := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", scope.QuotedTableName(), strings.Join(columns, ","), strings.TrimSuffix(strings.Repeat(placeholders+",", b.rows), ",")), b.vars...).Error; err != nil {
+				return xerrors.Errorf("Failed to insert. err: %w", r.wrapLocked(err))
+			}
+			bar.Add(b.rows)
+		}
+		bar.Finish()
+
+		if replace != "" && !truncated {
+			if err := r.deleteMissingCpes(tx, replace, rows); err != nil {
+				return err
+			}
+		}
+		if err := r.refreshVendorProducts(tx); err != nil {
+			return xerrors.Errorf("Failed to refresh the vendor/products. err: %w", err)
+		}
+		return nil
+	})
+}
+
+// reloadedCpe returns c to be inserted again into its truncated partition, merged with the row stored for it as the update does:
+// the attributes not fetched and the history are kept, and so is the generation unless c changes the row
+func reloadedCpe(c models.CategorizedCpe, stored storedCpe, at *time.Time) models.CategorizedCpe {
+	changed := false
+	if c.Popularity <= 0 {
+		c.Popularity = stored.Popularity
+	} else if c.Popularity != stored.Popularity {
+		changed = true
+	}
+	if c.Title == "" {
+		c.Title = stored.Title
+	} else if c.Title != stored.Title {
+		changed = true
+	}
+	if c.CpeNameID == "" {
+		c.CpeNameID = stored.CpeNameID
+	} else if c.CpeNameID != stored.CpeNameID {
+		changed = true
+	}
+	if c.References == "" {
+		c.References = stored.Refs
+	} else if c.References != stored.Refs {
+		changed = true
+	}
+	if c.DeprecatedBy != "" && (!stored.Deprecated || c.DeprecatedBy != stored.DeprecatedBy) {
+		changed = true
+		c.Deprecated, c.DeprecatedAt = true, stored.DeprecatedAt
+		if !stored.Deprecated {
+			c.DeprecatedAt = at
+		}
+	} else {
+		c.Deprecated, c.DeprecatedBy, c.DeprecatedAt = stored.Deprecated, stored.DeprecatedBy, stored.DeprecatedAt
+	}
+	c.AddedAt = stored.AddedAt
+	if !changed || c.Generation == 0 {
+		c.Generation, c.ChangedAt = stored.Generation, stored.ChangedAt
+	}
+	return c
+}
+
+// deleteMissingCpes deletes the rows of source whose CPEs are not in fetched
+func (r *RDBDriver) deleteMissingCpes(tx *gorm.DB, source models.FetchType, fetched []models.CategorizedCpe) error {
+	uris := map[string]struct{}{}
+	for _, c := range fetched {
+		uris[c.CpeURI] = struct{}{}
+	}
+	stored := []struct {
+		ID     int64
+		CpeURI string
+	}{}
+	if err := tx.Model(&models.CategorizedCpe{}).Select("id, cpe_uri").Where("fetch_type = ?", source).Scan(&stored).Error; err != nil {
+		return xerrors.Errorf("Failed to select stored CPEs. source: %s, err: %w", source, r.wrapLocked(err))
+	}
+	ids := []int64{}
+	for _, s := range stored {
+		if _, ok := uris[s.CpeURI]; !ok {
+			ids = append(ids, s.ID)
+		}
+	}
+	n := maxPlaceholders[r.name]
+	for i := 0; i < len(ids); i += n {
+		j := i + n
+		if len(ids) < j {
+			j = len(ids)
+		}
+		if err := tx.Where("id IN (?)", ids[i:j]).Delete(&models.CategorizedCpe{}).Error; err != nil {
+			return xerrors.Errorf("Failed to delete the CPEs not fetched. source: %s, err: %w", source, r.wrapLocked(err))
+		}
+	}
+	if 0 < len(ids) {
+		r.log.Info("Deleted the CPEs not fetched any more", "source", source, "rows", len(ids))
+	}
+	return nil
+}
+
+// insertBatch is the rows of a statement of the insert with their values bound
+type insertBatch struct {
+	rows int
+	vars []interface{}
+}
+
+// bindBatches binds the values of inserts by batchSize rows, up to workers batches ahead of the one received.
+// A batch is received from its channel sent in the order of the batches, until done is closed.
+func bindBatches(tx *gorm.DB, inserts []models.CategorizedCpe, batchSize, workers int, done <-chan struct{}) <-chan chan insertBatch {
+	ordered := make(chan chan insertBatch, workers)
+	go func() {
+		defer close(ordered)
+		for i := 0; i < len(inserts); i += batchSize {
+			j := i + batchSize
+			if len(inserts) < j {
+				j = len(inserts)
+			}
+			bound := make(chan insertBatch, 1)
+			select {
+			case ordered <- bound:
+			case <-done:
+				return
+			}
+			go func(rows []models.CategorizedCpe) {
+				vars := []interface{}{}
+				for k := range rows {
+					for _, f := range tx.NewScope(&rows[k]).Fields() {
+						if f.IsNormal && !f.IsPrimaryKey {
+							vars = append(vars, f.Field.Interface())
+						}
+					}
+				}
+				bound <- insertBatch{rows: len(rows), vars: vars}
+			}(inserts[i:j])
 		}
-		tx.Commit()
 	}()
+	return ordered
+}
+
+// cpeKey identifies a CPE row
+type cpeKey struct {
+	fetchType models.FetchType
+	cpeURI    string
+}
+
+// storedCpe is the row stored for a CPE, with the attributes updated by another fetch
+type storedCpe struct {
+	ID           int64
+	CpeURI       string
+	Popularity   int
+	Title        string
+	CpeNameID    string
+	Deprecated   bool
+	DeprecatedBy string
+	Refs         string
+	// the history and the generation, reloaded into a truncated partition
+	Generation   uint64
+	ChangedAt    *time.Time
+	AddedAt      *time.Time
+	DeprecatedAt *time.Time
+}
 
+// findStoredCpes returns the rows already stored for cpes.
+// When a CPE has duplicated rows, the first one is returned as FirstOrCreate does.
+func (r *RDBDriver) findStoredCpes(tx *gorm.DB, cpes []models.CategorizedCpe) (map[cpeKey]storedCpe, error) {
+	byType := map[models.FetchType][]string{}
 	for _, c := range cpes {
-		if err := tx.FirstOrCreate(&c, models.CategorizedCpe{CpeURI: c.CpeURI}).Error; err != nil {
-			return fmt.Errorf("Failed to insert. cpe: %s, err: %s",
-				pp.Sprintf("%v", c), err)
+		byType[c.FetchType] = append(byType[c.FetchType], c.CpeURI)
+	}
+
+	stored := map[cpeKey]storedCpe{}
+	// one placeholder is taken by fetch_type
+	n := maxPlaceholders[r.name] - 1
+	for fetchType, uris := range byType {
+		for i := 0; i < len(uris); i += n {
+			j := i + n
+			if len(uris) < j {
+				j = len(uris)
+			}
+			found := []storedCpe{}
+			if err := tx.Model(&models.CategorizedCpe{}).Select("id, cpe_uri, popularity, title, cpe_name_id, deprecated, deprecated_by, refs, generation, changed_at, added_at, deprecated_at").Where("fetch_type = ? AND cpe_uri IN (?)", fetchType, uris[i:j]).Scan(&found).Error; err != nil {
+				return nil, xerrors.Errorf("Failed to select stored CPEs. err: %w", r.wrapLocked(err))
+			}
+			for _, f := range found {
+				k := cpeKey{fetchType: fetchType, cpeURI: f.CpeURI}
+				if s, ok := stored[k]; !ok || f.ID < s.ID {
+					stored[k] = f
+				}
+			}
+		}
+	}
+	return stored, nil
+}
+
+// tuneBatchSize returns the number of rows inserted by a statement having columns placeholders per row.
+// It's --batch-size when given, or the most rows fitting the placeholder limit of the dialect
+// and, on MySQL, max_allowed_packet.
+func (r *RDBDriver) tuneBatchSize(tx *gorm.DB, columns int) int {
+	limit := maxPlaceholders[r.name] / columns
+	if 0 < r.batchSize {
+		if limit < r.batchSize {
+			r.log.Warn("--batch-size exceeds the placeholder limit of the DB. Capped", "batch-size", r.batchSize, "limit", limit)
+			return limit
+		}
+		return r.batchSize
+	}
+
+	n := limit
+	if r.name == dialectMysql {
+		var packet int64
+		if err := tx.Raw("SELECT @@max_allowed_packet").Row().Scan(&packet); err != nil {
+			r.log.Warn("Failed to get max_allowed_packet. Tuning batch size by the placeholder limit only", "err", err)
+		} else if m := int(packet / estimatedRowBytes); m < n {
+			n = m
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+	r.log.Debug("Tuned batch size", "dialect", r.name, "rows", n)
+	return n
+}
+
+// bindVars returns the placeholders of the rows of columns for a statement prepared outside gorm,
+// which doesn't rewrite ? into the numbered placeholders of PostgreSQL
+func (r *RDBDriver) bindVars(rows, columns int) string {
+	values := make([]string, 0, rows)
+	for i := 0; i < rows; i++ {
+		vars := make([]string, 0, columns)
+		for j := 0; j < columns; j++ {
+			if r.name == dialectPostgreSQL {
+				vars = append(vars, fmt.Sprintf("$%d", i*columns+j+1))
+			} else {
+				vars = append(vars, "?")
+			}
 		}
-		bar.Increment()
+		values = append(values, "("+strings.Join(vars, ",")+")")
 	}
-	bar.Finish()
+	return strings.Join(values, ",")
+}
+
+// defaultDeleteBatchSize is the number of rows deleted by a statement unless WithDeleteBatch is given
+const defaultDeleteBatchSize = 500
 
+// deleteByIDs deletes the rows of model by the IDs in chunks, each committed on its own outside a transaction,
+// so that deleting many rows neither holds the locks till the end nor replicates as a single huge transaction.
+// The callers keep the DB consistent between the chunks by deleting only the rows a reader doesn't need.
+func (r *RDBDriver) deleteByIDs(model interface{}, ids []int64) error {
+	size := r.deleteBatchSize
+	if size <= 0 {
+		size = defaultDeleteBatchSize
+	}
+	if limit, ok := maxPlaceholders[r.name]; ok && limit < size {
+		size = limit
+	}
+	for i := 0; i < len(ids); i += size {
+		if 0 < i && 0 < r.deletePause {
+			// yield to the other writers and the replicas between the chunks
+			time.Sleep(r.deletePause)
+		}
+		j := i + size
+		if len(ids) < j {
+			j = len(ids)
+		}
+		if err := r.conn.Where("id IN (?)", ids[i:j]).Delete(model).Error; err != nil {
+			return r.wrapLocked(err)
+		}
+	}
+	if size < len(ids) {
+		r.log.Debug("Deleted in chunks", "rows", len(ids), "batch-size", size)
+	}
 	return nil
 }
 
-// IsDeprecated : IsDeprecated
+// CheckIntegrity finds the duplicated rows of a CPE and a source, the rows without the vendor or the product,
+// and the malformed CPE URIs left by the older versions. With repair, the duplicates and the malformed rows
+// are deleted, the vendor and the product are restored from the CPE URI, and the unique index is added.
+func (r *RDBDriver) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	report := &IntegrityReport{Issues: []IntegrityIssue{}}
+	table := r.conn.NewScope(&models.CategorizedCpe{}).TableName()
+
+	dups := []struct {
+		CpeURI    string
+		FetchType string
+		Count     int64
+	}{}
+	if err := r.conn.Table(table).Select("cpe_uri, fetch_type, COUNT(*) AS count").Group("cpe_uri, fetch_type").Having("COUNT(*) > 1").Scan(&dups).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to select duplicates. err: %w", r.wrapLocked(err))
+	}
+	for _, d := range dups {
+		report.Issues = append(report.Issues, IntegrityIssue{Kind: IssueDuplicate, CpeURI: d.CpeURI, FetchType: models.FetchType(d.FetchType), Rows: d.Count - 1})
+	}
+
+	rows, err := r.conn.Table(table).Select("id, cpe_uri, fetch_type, vendor, product").Rows()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to select CPEs. err: %w", r.wrapLocked(err))
+	}
+	malformed := []int64{}
+	restore := map[int64]common.WellFormedName{}
+	for rows.Next() {
+		var id int64
+		var cpeURI, fetchType, vendor, product sql.NullString
+		if err := rows.Scan(&id, &cpeURI, &fetchType, &vendor, &product); err != nil {
+			rows.Close()
+			return nil, xerrors.Errorf("Failed to scan CPEs. err: %w", err)
+		}
+		wfn, err := naming.UnbindURI(cpeURI.String)
+		if err != nil {
+			malformed = append(malformed, id)
+			report.Issues = append(report.Issues, IntegrityIssue{Kind: IssueMalformedURI, CpeURI: cpeURI.String, FetchType: models.FetchType(fetchType.String), Rows: 1})
+			continue
+		}
+		if vendor.String == "" || product.String == "" {
+			restore[id] = wfn
+			report.Issues = append(report.Issues, IntegrityIssue{Kind: IssueEmptyVendor, CpeURI: cpeURI.String, FetchType: models.FetchType(fetchType.String), Rows: 1})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.Errorf("Failed to scan CPEs. err: %w", err)
+	}
+	if !repair || len(report.Issues) == 0 {
+		return report, nil
+	}
+
+	// the malformed rows can't be read and the duplicates but the first are never read, so deleting them
+	// chunk by chunk outside the transaction doesn't change what a reader sees in between
+	if err := r.deleteByIDs(&models.CategorizedCpe{}, malformed); err != nil {
+		return nil, xerrors.Errorf("Failed to delete malformed CPEs. err: %w", err)
+	}
+	report.Repaired += int64(len(malformed))
+
+	ids := []int64{}
+	if err := r.conn.Table(table).Where(fmt.Sprintf("id NOT IN (SELECT MIN(id) FROM %s GROUP BY cpe_uri, fetch_type)", table)).Pluck("id", &ids).Error; err != nil {
+		return nil, xerrors.Errorf("Failed to select duplicates. err: %w", r.wrapLocked(err))
+	}
+	if err := r.deleteByIDs(&models.CategorizedCpe{}, ids); err != nil {
+		return nil, xerrors.Errorf("Failed to delete duplicates. err: %w", err)
+	}
+	report.Repaired += int64(len(ids))
+
+	tx := r.conn.Begin()
+	for id, wfn := range restore {
+		if err := tx.Model(&models.CategorizedCpe{ID: id}).Updates(map[string]interface{}{
+			"vendor":  wfn.GetString(common.AttributeVendor),
+			"product": wfn.GetString(common.AttributeProduct),
+		}).Error; err != nil {
+			tx.Rollback()
+			return nil, xerrors.Errorf("Failed to restore the vendor and the product. err: %w", r.wrapLocked(err))
+		}
+		report.Repaired++
+	}
+	if err := r.refreshVendorProducts(tx); err != nil {
+		tx.Rollback()
+		return nil, xerrors.Errorf("Failed to refresh the vendor/products. err: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, xerrors.Errorf("Failed to commit. err: %w", r.wrapLocked(err))
+	}
+
+	if err := r.addUniqueIndex(); err != nil {
+		return nil, xerrors.Errorf("Failed to add the unique index. err: %w", r.wrapLocked(err))
+	}
+	return report, nil
+}
+
+// GetCpeByNameID returns the CPE of the cpeNameId of NVD API 2.0 merged over the sources, nil when it's not found
+func (r *RDBDriver) GetCpeByNameID(id string) (*models.SourcedCpe, error) {
+	found := models.CategorizedCpe{}
+	if err := r.conn.Select("cpe_uri").Where("cpe_name_id = ?", strings.ToUpper(id)).First(&found).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to select CPE. err: %s", err)
+	}
+	results := []models.CategorizedCpe{}
+	if err := r.conn.Select("DISTINCT cpe_uri, deprecated, fetch_type, cpe_name_id, deprecated_by").Where("cpe_uri = ?", found.CpeURI).Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("Failed to select results. err: %s", err)
+	}
+	cpes := mergeSources(results)
+	return &cpes[0], nil
+}
+
+// InsertDistroPackages replaces the mapping of the distribution packages
+func (r *RDBDriver) InsertDistroPackages(packages []models.DistroPackage) error {
+	return r.withTransactionRetry(r.conn, func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("DELETE FROM %s", tx.NewScope(&models.DistroPackage{}).QuotedTableName())).Error; err != nil {
+			return xerrors.Errorf("Failed to delete the distribution packages. err: %w", r.wrapLocked(err))
+		}
+		for i := range packages {
+			p := packages[i]
+			p.ID = 0
+			if err := tx.Create(&p).Error; err != nil {
+				return xerrors.Errorf("Failed to insert the distribution package. err: %w", r.wrapLocked(err))
+			}
+		}
+		return nil
+	})
+}
+
+// GetDistroPackages returns the vendor/products the package of the distribution is mapped to
+func (r *RDBDriver) GetDistroPackages(distro, pkg string) ([]models.DistroPackage, error) {
+	packages := []models.DistroPackage{}
+	if err := r.conn.Where("distro = ? AND package = ?", distro, pkg).Order("id").Find(&packages).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, xerrors.Errorf("Failed to select the distribution packages. err: %w", r.wrapLocked(err))
+	}
+	return packages, nil
+}
+
+// GetCpesByDistroPackage returns the CPEs of the package of the distribution
+func (r *RDBDriver) GetCpesByDistroPackage(distro, pkg string) ([]string, []string, error) {
+	return cpesByDistroPackage(r, distro, pkg)
+}
+
+// ReplaceKnownExploited replaces the vendor/products of the CISA Known Exploited Vulnerabilities catalog
+func (r *RDBDriver) ReplaceKnownExploited(products []models.KnownExploitedProduct) error {
+	return r.withTransactionRetry(r.conn, func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("DELETE FROM %s", tx.NewScope(&models.KnownExploitedProduct{}).QuotedTableName())).Error; err != nil {
+			return xerrors.Errorf("Failed to delete the known exploited products. err: %w", r.wrapLocked(err))
+		}
+		for i := range products {
+			p := products[i]
+			p.ID = 0
+			if err := tx.Create(&p).Error; err != nil {
+				return xerrors.Errorf("Failed to insert the known exploited product. err: %w", r.wrapLocked(err))
+			}
+		}
+		return nil
+	})
+}
+
+// GetKnownExploited returns the vendor/products of the CISA Known Exploited Vulnerabilities catalog
+func (r *RDBDriver) GetKnownExploited() ([]models.KnownExploitedProduct, error) {
+	products := []models.KnownExploitedProduct{}
+	if err := r.conn.Order("vendor, product").Find(&products).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return nil, xerrors.Errorf("Failed to select the known exploited products. err: %w", r.wrapLocked(err))
+	}
+	return products, nil
+}
+
+// IsDeprecated : IsDeprecated tells whether the CPE is deprecated, by the sources resolved by dedupe
 func (r *RDBDriver) IsDeprecated(cpeURI string) (bool, error) {
-	// not implemented yet
-	return false, nil
+	results := []models.CategorizedCpe{}
+	if err := r.conn.Select("DISTINCT cpe_uri, deprecated, fetch_type").Where("cpe_uri = ?", cpeURI).Find(&results).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return false, xerrors.Errorf("Failed to select the CPE. cpeURI: %s, err: %w", cpeURI, err)
+	}
+	cpes := dedupe(results)
+	return 0 < len(cpes) && cpes[0].Deprecated, nil
+}
+
+// GC removes the duplicated CPE rows left by concurrent fetches and the superseded FetchMeta rows.
+// On sqlite3 the file is vacuumed afterwards to reclaim the space.
+func (r *RDBDriver) GC() ([]GCStat, error) {
+	stats := []GCStat{}
+	for _, m := range []struct {
+		model interface{}
+		// the rows to keep are the first of each group
+		groupBy string
+	}{
+		{model: &models.CategorizedCpe{}, groupBy: "cpe_uri, fetch_type"},
+		{model: &models.FetchMeta{}},
+	} {
+		table := r.conn.NewScope(m.model).TableName()
+		keep := fmt.Sprintf("SELECT MIN(id) FROM %s", table)
+		if m.groupBy != "" {
+			keep += " GROUP BY " + m.groupBy
+		}
+		ids := []int64{}
+		// select first, since mysql can't delete from the table of the subquery
+		if err := r.conn.Table(table).Where(fmt.Sprintf("id NOT IN (%s)", keep)).Pluck("id", &ids).Error; err != nil {
+			return nil, xerrors.Errorf("Failed to select superseded rows. table: %s, err: %w", table, r.wrapLocked(err))
+		}
+		if err := r.deleteByIDs(m.model, ids); err != nil {
+			return nil, xerrors.Errorf("Failed to delete superseded rows. table: %s, err: %w", table, err)
+		}
+		stats = append(stats, GCStat{Table: table, Rows: int64(len(ids))})
+	}
+
+	if r.name == dialectSqlite3 {
+		before, err := r.sqliteSize()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.conn.Exec("VACUUM").Error; err != nil {
+			return nil, xerrors.Errorf("Failed to vacuum. err: %w", r.wrapLocked(err))
+		}
+		after, err := r.sqliteSize()
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, GCStat{Table: "(vacuum)", Bytes: before - after})
+	}
+	return stats, nil
+}
+
+// sqliteSize returns the size of the sqlite3 database in bytes
+func (r *RDBDriver) sqliteSize() (int64, error) {
+	var pageCount, pageSize int64
+	if err := r.conn.DB().QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, fmt.Errorf("Failed to get page_count. err: %s", err)
+	}
+	if err := r.conn.DB().QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("Failed to get page_size. err: %s", err)
+	}
+	return pageCount * pageSize, nil
 }
@@ -0,0 +1,61 @@
+//go:build !nosqlite && !nomysql
+// +build !nosqlite,!nomysql
+
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"golang.org/x/xerrors"
+)
+
+func TestRDBDriver_wrapLocked(t *testing.T) {
+	tests := []struct {
+		name   string
+		dbType string
+		err    error
+		locked bool
+	}{
+		{name: "sqlite busy", dbType: dialectSqlite3, err: sqlite3.Error{Code: sqlite3.ErrBusy}, locked: true},
+		{name: "sqlite locked", dbType: dialectSqlite3, err: sqlite3.Error{Code: sqlite3.ErrLocked}, locked: true},
+		{name: "sqlite constraint", dbType: dialectSqlite3, err: sqlite3.Error{Code: sqlite3.ErrConstraint}, locked: false},
+		{name: "mysql lock wait timeout", dbType: dialectMysql, err: &mysql.MySQLError{Number: 1205}, locked: true},
+		{name: "mysql syntax error", dbType: dialectMysql, err: &mysql.MySQLError{Number: 1064}, locked: false},
+		{name: "other", dbType: dialectPostgreSQL, err: errors.New("connection refused"), locked: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RDBDriver{name: tt.dbType}
+			err := xerrors.Errorf("Failed to insert. err: %w", r.wrapLocked(tt.err))
+			if got := xerrors.Is(err, ErrLocked); got != tt.locked {
+				t.Errorf("xerrors.Is(err, ErrLocked) = %v, want %v", got, tt.locked)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{name: "sqlite busy", err: sqlite3.Error{Code: sqlite3.ErrBusy}, retryable: true},
+		{name: "sqlite locked", err: sqlite3.Error{Code: sqlite3.ErrLocked}, retryable: false},
+		{name: "mysql deadlock", err: &mysql.MySQLError{Number: 1213}, retryable: true},
+		{name: "mysql lock wait timeout", err: &mysql.MySQLError{Number: 1205}, retryable: false},
+		{name: "other", err: errors.New("connection refused"), retryable: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RDBDriver{}
+			err := xerrors.Errorf("Failed to commit. err: %w", r.wrapLocked(tt.err))
+			if got := isRetryable(err); got != tt.retryable {
+				t.Errorf("isRetryable(err) = %v, want %v", got, tt.retryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+//go:build !nomysql
+// +build !nomysql
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+
+	// Required MySQL.  See http://jinzhu.me/gorm/database.html#connecting-to-a-database
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+)
+
+func init() {
+	drivers[dialectMysql] = func() DB { return &RDBDriver{name: dialectMysql} }
+	lockErrors = append(lockErrors, func(err error) bool {
+		e, ok := err.(*mysql.MySQLError)
+		// 1205: Lock wait timeout exceeded, 1213: Deadlock found
+		return ok && (e.Number == 1205 || e.Number == 1213)
+	})
+	retryableErrors = append(retryableErrors, func(err error) bool {
+		e, ok := err.(*mysql.MySQLError)
+		// 1213: Deadlock found, which rolls back the transaction
+		return ok && e.Number == 1213
+	})
+	pathValidators[dialectMysql] = validateMySQLPath
+	iamTargets[dialectMysql] = mysqlIAMTarget
+}
+
+// validateMySQLPath checks the DSN of go-sql-driver, which isn't a URL
+func validateMySQLPath(dbPath string) error {
+	cfg, err := mysql.ParseDSN(dbPath)
+	if err != nil {
+		return fmt.Errorf("Invalid MySQL DSN, expected user:password@tcp(host:3306)/dbname?parseTime=true: %s", err)
+	}
+	if cfg.DBName == "" {
+		return fmt.Errorf("The MySQL DSN has no database name, expected user:password@tcp(host:3306)/dbname?parseTime=true")
+	}
+	return nil
+}
+
+// mysqlIAMTarget connects with the token as the cleartext password, which both RDS and Cloud SQL require,
+// so the DSN must enable TLS, e.g. tls=true
+func mysqlIAMTarget(dsn, auth string) (iamTarget, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return iamTarget{}, fmt.Errorf("Invalid MySQL DSN: %s", err)
+	}
+	if cfg.TLSConfig == "" || cfg.TLSConfig == "false" {
+		return iamTarget{}, fmt.Errorf("The IAM authentication of MySQL sends the token in cleartext. Add tls=true to the DSN")
+	}
+	if cfg.User == "" {
+		return iamTarget{}, fmt.Errorf("The MySQL DSN has no user, expected user@tcp(host:3306)/dbname")
+	}
+	cfg.AllowCleartextPasswords = true
+	return iamTarget{
+		addr: cfg.Addr,
+		user: cfg.User,
+		withPassword: func(token string) string {
+			c := *cfg
+			c.Passwd = token
+			return c.FormatDSN()
+		},
+		sqlDriver: &mysql.MySQLDriver{},
+	}, nil
+}
@@ -0,0 +1,60 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+
+	// Required SQLite3.
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+func init() {
+	drivers[dialectSqlite3] = func() DB { return &RDBDriver{name: dialectSqlite3} }
+	lockErrors = append(lockErrors, func(err error) bool {
+		e, ok := err.(sqlite3.Error)
+		return ok && (e.Code == sqlite3.ErrLocked || e.Code == sqlite3.ErrBusy)
+	})
+	retryableErrors = append(retryableErrors, func(err error) bool {
+		e, ok := err.(sqlite3.Error)
+		return ok && e.Code == sqlite3.ErrBusy
+	})
+	pathValidators[dialectSqlite3] = validateSqlite3Path
+	snapshotters[dialectSqlite3] = snapshotSqlite3
+}
+
+// snapshotSqlite3 copies the DB by VACUUM INTO, which reads it in a transaction, so the copy never has a half-done write
+func snapshotSqlite3(src, dst string) error {
+	conn, err := sql.Open(dialectSqlite3, src)
+	if err != nil {
+		return fmt.Errorf("Failed to open sqlite3. path: %s, err: %s", src, err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec("VACUUM INTO ?", dst); err != nil {
+		return fmt.Errorf("Failed to copy sqlite3. path: %s, to: %s, err: %s", src, dst, err)
+	}
+	return nil
+}
+
+// validateSqlite3Path checks the directory of the file exists, since sqlite3 creates the file but not the directory
+func validateSqlite3Path(dbPath string) error {
+	if dbPath == ":memory:" || strings.HasPrefix(dbPath, "file:") {
+		return nil
+	}
+	path := strings.SplitN(dbPath, "?", 2)[0]
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("The sqlite3 dbpath is a directory, expected /path/to/cpe.sqlite3: %s", dbPath)
+	}
+	dir := filepath.Dir(path)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("The directory of the sqlite3 dbpath does not exist, create it first: %s", dir)
+	}
+	return nil
+}
@@ -1,8 +1,21 @@
+//go:build !nosqlite
+// +build !nosqlite
+
 package db
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/jinzhu/gorm"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"golang.org/x/xerrors"
 )
 
 // Notes:
@@ -34,6 +47,468 @@ func TestGetCpesByVendorProductSqlite(t *testing.T) {
 	testGetCpesByVendorProduct(t, driver)
 }
 
+func TestGetVendorProductsByPopularitySqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetVendorProductsByPopularity(t, driver)
+}
+
+func TestUpsertFetchMetaSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testUpsertFetchMeta(t, driver)
+}
+
+func TestFetchHistorySqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testFetchHistory(t, driver)
+}
+
+func TestAuditEntriesSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testAuditEntries(t, driver)
+}
+
+func TestWatchlistSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testWatchlist(t, driver)
+}
+
+func TestRejectedCpesSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testRejectedCpes(t, driver)
+}
+
+func TestGetProductsByVersionSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetProductsByVersion(t, driver)
+}
+
+func TestGetCpeDetailsByVendorProductSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetCpeDetailsByVendorProduct(t, driver)
+}
+
+func TestGetVersionsByVendorProductSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetVersionsByVendorProduct(t, driver)
+}
+
+func TestGetSourcedCpesByVendorProductSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetSourcedCpesByVendorProduct(t, driver)
+}
+
+func TestCountCpesSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testCountCpes(t, driver)
+}
+
+func TestGetAttributeStatsSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetAttributeStats(t, driver)
+}
+
+func TestGetCpeByNameIDSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetCpeByNameID(t, driver)
+}
+
+func TestGetCpesByDistroPackageSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetCpesByDistroPackage(t, driver)
+}
+
+func TestKnownExploitedSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testKnownExploited(t, driver)
+}
+
+func TestGetProductSummariesSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetProductSummaries(t, driver)
+}
+
+func TestContractSqlite(t *testing.T) {
+	testContract(t, func(t testing.TB) DB {
+		driver, err := Open("sqlite3", filepath.Join(t.TempDir(), "cpe.sqlite3"))
+		if err != nil {
+			t.Fatalf("Failed to open db: %s", err)
+		}
+		t.Cleanup(func() { _ = driver.CloseDB() })
+		return driver
+	})
+}
+
+func TestTablePrefixSqlite(t *testing.T) {
+	driver, err := Open("sqlite3", ":memory:", WithNamespace("gocpe_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	conn := driver.(tracedDriver).DB.(*RDBDriver).conn
+	for _, table := range []string{"gocpe_categorized_cpes", "gocpe_fetch_meta"} {
+		if !conn.HasTable(table) {
+			t.Errorf("table %s is not created", table)
+		}
+	}
+	if conn.HasTable("categorized_cpes") {
+		t.Errorf("table categorized_cpes is created without the prefix")
+	}
+
+	testGetCpesByVendorProduct(t, driver)
+}
+
+// TestTablePrefixesSqlite checks a DB keeps its prefix while another DB of a different prefix is open
+func TestTablePrefixesSqlite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpe.sqlite3")
+	prefixed, err := Open("sqlite3", path, WithNamespace("gocpe_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = prefixed.CloseDB()
+	}()
+	plain, err := Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = plain.CloseDB()
+	}()
+
+	if err := prepareTestData(prefixed); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+	if vendorProducts, err := prefixed.GetVendorProducts(); err != nil || len(vendorProducts) == 0 {
+		t.Errorf("expected the vendor/products of the prefixed tables, actual %v, err: %v", vendorProducts, err)
+	}
+	if vendorProducts, err := plain.GetVendorProducts(); err != nil || len(vendorProducts) != 0 {
+		t.Errorf("expected no vendor/products of the tables without the prefix, actual %v, err: %v", vendorProducts, err)
+	}
+}
+
+// fast read tests use a file since each connection of the pool gets its own :memory: database
+func newFastReadSqlite(tb testing.TB, fastRead bool) DB {
+	driver, err := Open("sqlite3", filepath.Join(tb.TempDir(), "cpe.sqlite3"), WithFastRead(fastRead))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return driver
+}
+
+func TestGetVendorProductsSqliteFastRead(t *testing.T) {
+	driver := newFastReadSqlite(t, true)
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetVendorProducts(t, driver)
+}
+
+// TestBackfillVendorProductsSqlite opens a DB fetched by the versions without the vendor/products table
+func TestBackfillVendorProductsSqlite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpe.sqlite3")
+	driver, _, err := NewDB("sqlite3", path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+	if err := driver.(tracedDriver).DB.(*RDBDriver).conn.DropTable(&models.VendorProduct{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	_ = driver.CloseDB()
+
+	driver, err = Open("sqlite3", path, WithFastRead(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	vendorProducts, err := driver.GetVendorProducts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vendorProducts) != 9 || vendorProducts[0] != "ntp::ntp" {
+		t.Errorf("actual %#v, expected the 9 vendor/products of the CPEs", vendorProducts)
+	}
+}
+
+func TestGetCpesByVendorProductSqliteFastRead(t *testing.T) {
+	driver := newFastReadSqlite(t, true)
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testGetCpesByVendorProduct(t, driver)
+}
+
+func BenchmarkGetVendorProductsSqlite(b *testing.B) {
+	for _, fastRead := range []bool{false, true} {
+		b.Run(fmt.Sprintf("fastRead=%t", fastRead), func(b *testing.B) {
+			driver := newFastReadSqlite(b, fastRead)
+			defer func() {
+				_ = driver.CloseDB()
+			}()
+			if err := prepareTestData(driver); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := driver.GetVendorProducts(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetCpesByVendorProductSqlite(b *testing.B) {
+	for _, fastRead := range []bool{false, true} {
+		b.Run(fmt.Sprintf("fastRead=%t", fastRead), func(b *testing.B) {
+			driver := newFastReadSqlite(b, fastRead)
+			defer func() {
+				_ = driver.CloseDB()
+			}()
+			if err := prepareTestData(driver); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := driver.GetCpesByVendorProduct("vendorName1", "productName1%"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInsertCpesSqlite(b *testing.B) {
+	for _, prepareStmt := range []bool{false, true} {
+		b.Run(fmt.Sprintf("prepareStmt=%t", prepareStmt), func(b *testing.B) {
+			// a batch of 100 rows makes the 1000 CPEs a time 10 statements to prepare once
+			driver, err := Open("sqlite3", filepath.Join(b.TempDir(), "cpe.sqlite3"), WithPrepareStmt(prepareStmt), WithBatchSize(100))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer func() {
+				_ = driver.CloseDB()
+			}()
+
+			benchInsertCpes(b, driver)
+		})
+	}
+}
+
+// BenchmarkInsertCpesRDB measures the dialects given by the DSN of GO_CPE_DICTIONARY_BENCH_MYSQL and GO_CPE_DICTIONARY_BENCH_POSTGRES.
+// The DB is left with the inserted CPEs, so give a scratch one.
+func BenchmarkInsertCpesRDB(b *testing.B) {
+	for dialect, env := range map[string]string{dialectMysql: "GO_CPE_DICTIONARY_BENCH_MYSQL", dialectPostgreSQL: "GO_CPE_DICTIONARY_BENCH_POSTGRES"} {
+		for _, prepareStmt := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/prepareStmt=%t", dialect, prepareStmt), func(b *testing.B) {
+				dsn := os.Getenv(env)
+				if dsn == "" {
+					b.Skipf("%s is not set", env)
+				}
+				driver, err := Open(dialect, dsn, WithPrepareStmt(prepareStmt))
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer func() {
+					_ = driver.CloseDB()
+				}()
+
+				benchInsertCpes(b, driver)
+			})
+		}
+	}
+}
+
+func TestGetCpesChangedSinceSqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	stamp := func(generation uint64, changedAt time.Time, cpes ...models.CategorizedCpe) []models.CategorizedCpe {
+		for i := range cpes {
+			cpes[i].Generation, cpes[i].ChangedAt = generation, &changedAt
+		}
+		return cpes
+	}
+	ntp := models.CategorizedCpe{FetchType: models.NVD, CpeURI: "cpe:/a:ntp:ntp:4.2.8", Vendor: "ntp", Product: "ntp", Version: "4.2.8"}
+	openssl := models.CategorizedCpe{FetchType: models.NVD, CpeURI: "cpe:/a:openssl:openssl:1.1.1", Vendor: "openssl", Product: "openssl", Version: "1.1.1"}
+	first, second, third := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	if err := driver.InsertCpes(stamp(1, first, ntp)); err != nil {
+		t.Fatal(err)
+	}
+	// the same ntp is left at the first generation
+	if err := driver.InsertCpes(stamp(2, second, ntp, openssl)); err != nil {
+		t.Fatal(err)
+	}
+	deprecated := ntp
+	deprecated.DeprecatedBy = "cpe:/a:ntp:ntp:4.2.8p1"
+	if err := driver.InsertCpes(stamp(3, third, deprecated)); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		generation uint64
+		since      time.Time
+		expected   []string
+	}{
+		{expected: []string{"cpe:/a:ntp:ntp:4.2.8", "cpe:/a:openssl:openssl:1.1.1"}},
+		{generation: 1, expected: []string{"cpe:/a:ntp:ntp:4.2.8", "cpe:/a:openssl:openssl:1.1.1"}},
+		{generation: 2, expected: []string{"cpe:/a:ntp:ntp:4.2.8"}},
+		{generation: 3, expected: []string{}},
+		{since: second, expected: []string{"cpe:/a:ntp:ntp:4.2.8", "cpe:/a:openssl:openssl:1.1.1"}},
+		{since: third.Add(time.Second), expected: []string{}},
+	}
+	for i, tt := range tests {
+		cpes, err := driver.GetCpesChangedSince(tt.generation, tt.since)
+		if err != nil {
+			t.Fatalf("[%d] %s", i, err)
+		}
+		actual := []string{}
+		for _, c := range cpes {
+			actual = append(actual, c.CpeURI)
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("[%d] actual %#v, expected %#v", i, actual, tt.expected)
+		}
+	}
+
+	cpes, err := driver.GetCpesChangedSince(2, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cpes) != 1 || !cpes[0].Deprecated || cpes[0].Generation != 3 || cpes[0].ChangedAt == nil || !cpes[0].ChangedAt.Equal(third) {
+		t.Errorf("actual %#v, expected ntp deprecated by the third generation", cpes)
+	}
+}
+
 // TestGetCpesByVendorProductSqliteFuzzy includes a % for some simple fuzzy matches not supported by all drivers.
 func TestGetCpesByVendorProductSqliteFuzzy(t *testing.T) {
 
@@ -79,3 +554,524 @@ func TestGetCpesByVendorProductSqliteFuzzy(t *testing.T) {
 		t.Errorf("actual %#v, expected %#v", deprecated, eDeprecated)
 	}
 }
+
+func TestGetCpesByVendorProductSqliteEscaped(t *testing.T) {
+	for _, fastRead := range []bool{false, true} {
+		driver := newFastReadSqlite(t, fastRead)
+		defer func() {
+			_ = driver.CloseDB()
+		}()
+		if err := prepareTestData(driver); err != nil {
+			t.Fatalf("Inserting CPEs: %s", err)
+		}
+
+		var tests = []struct {
+			vendor   string
+			product  string
+			glob     bool
+			expected []string
+		}{
+			{
+				vendor:   "vendorName_",
+				product:  "productName1-1",
+				expected: []string{},
+			},
+			{
+				vendor:   "vendorName%",
+				product:  "productName%",
+				expected: []string{},
+			},
+			{
+				vendor:   "vendorName?",
+				product:  "productName1??1",
+				glob:     true,
+				expected: []string{"cpe:/a:vendorName1:productName1-1:1.1::~~~targetSoftware1~targetHardware1~"},
+			},
+			{
+				vendor:  "vendorName1",
+				product: "productName1*",
+				glob:    true,
+				expected: []string{
+					"cpe:/a:vendorName1:productName1-1:1.1::~~~targetSoftware1~targetHardware1~",
+					"cpe:/a:vendorName1:productName1-2:1.2::~~~targetSoftware1~targetHardware1~",
+				},
+			},
+		}
+		for _, tt := range tests {
+			cpeURIs, _, err := driver.GetCpesByVendorProduct(LikePattern(tt.vendor, tt.glob), LikePattern(tt.product, tt.glob))
+			if err != nil {
+				t.Fatalf("GetCpesByVendorProduct: %s", err)
+			}
+			if len(cpeURIs) != len(tt.expected) || (0 < len(cpeURIs) && !reflect.DeepEqual(cpeURIs, tt.expected)) {
+				t.Errorf("fastRead %t, %s/%s: actual %#v, expected %#v", fastRead, tt.vendor, tt.product, cpeURIs, tt.expected)
+			}
+		}
+	}
+}
+
+func TestGCSqlite(t *testing.T) {
+	driver := newFastReadSqlite(t, false)
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	// a duplicate left by a concurrent fetch of the versions without the unique index, and a superseded FetchMeta
+	conn := driver.(tracedDriver).DB.(*RDBDriver).conn
+	dropUniqueIndex(t, conn)
+	if err := conn.Create(&models.CategorizedCpe{CpeURI: "cpe:/a:vendorName2:productName2:2.0::~~~targetSoftware2~targetHardware2~", Vendor: "vendorName2", Product: "productName2"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := conn.Create(&models.FetchMeta{}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := driver.GC()
+	if err != nil {
+		t.Fatalf("GC: %s", err)
+	}
+	if len(stats) != 3 {
+		t.Fatalf("actual %#v, expected stats of 2 tables and vacuum", stats)
+	}
+	// the duplicated CPE, and the FetchMeta rows except the first
+	for _, s := range stats[:2] {
+		if s.Rows != 1 {
+			t.Errorf("%s: actual %d rows removed, expected 1", s.Table, s.Rows)
+		}
+	}
+
+	cpeURIs, _, err := driver.GetCpesByVendorProduct("vendorName2", "productName2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cpeURIs, []string{"cpe:/a:vendorName2:productName2:2.0::~~~targetSoftware2~targetHardware2~"}) {
+		t.Errorf("actual %#v", cpeURIs)
+	}
+}
+
+// dropUniqueIndex makes the DB of the versions without the unique index on (cpe_uri, fetch_type)
+func dropUniqueIndex(t *testing.T, conn *gorm.DB) {
+	table := conn.NewScope(&models.CategorizedCpe{}).TableName()
+	if err := conn.Model(&models.CategorizedCpe{}).RemoveIndex(fmt.Sprintf("uix_%s_cpe_uri_fetch_type", table)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckIntegritySqlite(t *testing.T) {
+	driver := newFastReadSqlite(t, false)
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	r := driver.(tracedDriver).DB.(*RDBDriver)
+	dropUniqueIndex(t, r.conn)
+	for _, c := range []models.CategorizedCpe{
+		{CpeURI: "cpe:/a:vendorName2:productName2:2.0::~~~targetSoftware2~targetHardware2~", Vendor: "vendorName2", Product: "productName2"},
+		{CpeURI: "cpe:/a:vendorName7:productName7:7.0"},
+		{CpeURI: "cpe-a-vendorName8", Vendor: "vendorName8", Product: "productName8"},
+	} {
+		c := c
+		if err := r.conn.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := driver.CheckIntegrity(false)
+	if err != nil {
+		t.Fatalf("CheckIntegrity: %s", err)
+	}
+	kinds := []string{}
+	for _, i := range report.Issues {
+		kinds = append(kinds, i.Kind)
+	}
+	if expected := []string{IssueDuplicate, IssueEmptyVendor, IssueMalformedURI}; !reflect.DeepEqual(kinds, expected) || report.Repaired != 0 {
+		t.Errorf("actual %#v, %d repaired, expected %#v", kinds, report.Repaired, expected)
+	}
+
+	if report, err = driver.CheckIntegrity(true); err != nil {
+		t.Fatalf("CheckIntegrity: %s", err)
+	}
+	if report.Repaired != 3 {
+		t.Errorf("actual %d repaired, expected 3", report.Repaired)
+	}
+	if report, err = driver.CheckIntegrity(false); err != nil || len(report.Issues) != 0 {
+		t.Errorf("actual %#v, %v, expected no issues after repair", report, err)
+	}
+	cpeURIs, _, err := driver.GetCpesByVendorProduct("vendorName7", "productName7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cpeURIs, []string{"cpe:/a:vendorName7:productName7:7.0"}) {
+		t.Errorf("actual %#v", cpeURIs)
+	}
+	if err := r.conn.Create(&models.CategorizedCpe{CpeURI: "cpe:/a:vendorName7:productName7:7.0", Vendor: "vendorName7", Product: "productName7"}).Error; err == nil {
+		t.Errorf("a duplicate is inserted, expected the unique index to reject it")
+	}
+}
+
+func TestInsertCpesBatchSizeSqlite(t *testing.T) {
+	driver, err := Open("sqlite3", ":memory:", WithBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	// the test data is inserted in batches of 2 rows
+	testGetCpesByVendorProduct(t, driver)
+
+	// the stored CPEs and the duplicates in a call are updated rather than inserted again
+	cpe := models.CategorizedCpe{CpeURI: "cpe:/a:vendorName2:productName2:2.0::~~~targetSoftware2~targetHardware2~", Vendor: "vendorName2", Product: "productName2"}
+	popular := cpe
+	popular.Popularity = 10
+	if err := driver.InsertCpes([]models.CategorizedCpe{cpe, popular}); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+	if count, err := driver.CountCpes(""); err != nil || count != 10 {
+		t.Errorf("actual %d, %v, expected 10 CPEs", count, err)
+	}
+	var rows int
+	conn := driver.(tracedDriver).DB.(*RDBDriver).conn
+	if err := conn.Model(&models.CategorizedCpe{}).Count(&rows).Error; err != nil || rows != 10 {
+		t.Errorf("actual %d, %v, expected 10 rows", rows, err)
+	}
+	vendorProducts, err := driver.GetVendorProductsByPopularity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vendorProducts[0] != "vendorName2::productName2" {
+		t.Errorf("actual %#v, expected vendorName2::productName2 first", vendorProducts)
+	}
+}
+
+func TestDeleteBatchSqlite(t *testing.T) {
+	driver, err := Open("sqlite3", ":memory:", WithDeleteBatch(2, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	// 5 duplicates deleted in 3 statements of up to 2 rows
+	conn := driver.(tracedDriver).DB.(*RDBDriver).conn
+	dropUniqueIndex(t, conn)
+	for i := 0; i < 5; i++ {
+		if err := conn.Create(&models.CategorizedCpe{CpeURI: "cpe:/a:vendorName2:productName2:2.0::~~~targetSoftware2~targetHardware2~", Vendor: "vendorName2", Product: "productName2"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := driver.GC()
+	if err != nil {
+		t.Fatalf("GC: %s", err)
+	}
+	if stats[0].Rows != 5 {
+		t.Errorf("actual %d rows removed, expected 5", stats[0].Rows)
+	}
+	var rows int
+	if err := conn.Model(&models.CategorizedCpe{}).Count(&rows).Error; err != nil || rows != 10 {
+		t.Errorf("actual %d, %v, expected 10 rows", rows, err)
+	}
+}
+
+func TestReplaceCpesSqlite(t *testing.T) {
+	driver, err := Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testReplaceCpes(t, driver)
+}
+
+// testReplaceCpes checks a fetch removes the CPEs of its source missing from it, leaving those of the other sources
+func testReplaceCpes(t *testing.T, driver DB) {
+	ntp := models.CategorizedCpe{FetchType: models.NVD, CpeURI: "cpe:/a:ntp:ntp:4.2.8", Vendor: "ntp", Product: "ntp", Version: "4.2.8"}
+	openssl := models.CategorizedCpe{FetchType: models.NVD, CpeURI: "cpe:/a:openssl:openssl:1.1.1", Vendor: "openssl", Product: "openssl", Version: "1.1.1"}
+	jvn := models.CategorizedCpe{FetchType: models.JVN, CpeURI: "cpe:/a:openssl:openssl:1.1.1", Vendor: "openssl", Product: "openssl", Version: "1.1.1"}
+
+	if err := driver.InsertCpes([]models.CategorizedCpe{jvn}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.ReplaceCpes(models.NVD, []models.CategorizedCpe{ntp, openssl}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.ReplaceCpes(models.NVD, []models.CategorizedCpe{ntp}); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, err := driver.CountCpes(models.NVD); err != nil || count != 1 {
+		t.Errorf("actual %d, %v, expected 1 CPE of NVD", count, err)
+	}
+	sourced, err := driver.GetSourcedCpesByVendorProduct("openssl", "openssl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sourced) != 1 || !reflect.DeepEqual(sourced[0].Sources, []models.FetchType{models.JVN}) {
+		t.Errorf("actual %#v, expected the CPE of openssl of JVN only", sourced)
+	}
+	if err := driver.ReplaceCpes(models.NVD, []models.CategorizedCpe{jvn}); err == nil {
+		t.Errorf("expected an error replacing NVD by a CPE of JVN")
+	}
+}
+
+// TestReplaceCpesPartitionedPostgres checks a fetch truncates and reloads the partition of its source,
+// on the PostgreSQL DB given by the DSN of GO_CPE_DICTIONARY_TEST_POSTGRES. The tables are created by a new prefix and left.
+func TestReplaceCpesPartitionedPostgres(t *testing.T) {
+	dsn := os.Getenv("GO_CPE_DICTIONARY_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("GO_CPE_DICTIONARY_TEST_POSTGRES is not set")
+	}
+	driver, err := Open(dialectPostgreSQL, dsn, WithPartition(true), WithNamespace(fmt.Sprintf("test%d_", time.Now().UnixNano())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	testReplaceCpes(t, driver)
+}
+
+func TestPartitionSqlite(t *testing.T) {
+	// partitioning is PostgreSQL only, and ignored on sqlite3
+	driver, err := Open("sqlite3", ":memory:", WithPartition(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	testGetCpesByVendorProduct(t, driver)
+}
+
+func TestTuneBatchSize(t *testing.T) {
+	var tests = []struct {
+		name      string
+		batchSize int
+		expected  int
+	}{
+		{name: dialectSqlite3, expected: 62},
+		{name: dialectSqlite3, batchSize: 10, expected: 10},
+		{name: dialectSqlite3, batchSize: 100, expected: 62},
+		{name: dialectPostgreSQL, expected: 4095},
+	}
+	for i, tt := range tests {
+		r := &RDBDriver{name: tt.name, batchSize: tt.batchSize, log: log15.Root()}
+		if actual := r.tuneBatchSize(nil, 16); actual != tt.expected {
+			t.Errorf("[%d] actual %d, expected %d", i, actual, tt.expected)
+		}
+	}
+}
+
+func TestOpenReadOnlySqlite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpe.sqlite3")
+	driver, err := Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+	_ = driver.CloseDB()
+
+	driver, err = Open("sqlite3", path, WithReadOnly(true), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := driver.InsertCpes([]models.CategorizedCpe{}); !xerrors.Is(err, ErrReadOnly) {
+		t.Errorf("actual %v, expected ErrReadOnly", err)
+	}
+	if err := driver.UpsertFetchMeta(&models.FetchMeta{}); !xerrors.Is(err, ErrReadOnly) {
+		t.Errorf("actual %v, expected ErrReadOnly", err)
+	}
+	if err := driver.InsertAuditEntry(&models.AuditEntry{}); !xerrors.Is(err, ErrReadOnly) {
+		t.Errorf("actual %v, expected ErrReadOnly", err)
+	}
+	if count, err := driver.CountCpes(""); err != nil || count != 10 {
+		t.Errorf("actual %d, %v, expected 10 CPEs", count, err)
+	}
+}
+
+// TestOpenReadOnlyOutdatedSqlite checks a DB of an old schema version is not migrated when opened read-only
+func TestOpenReadOnlyOutdatedSqlite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpe.sqlite3")
+	driver, err := Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := driver.(tracedDriver).DB.(*RDBDriver).conn
+	if err := conn.Create(&models.FetchMeta{SchemaVersion: models.LatestSchemaVersion - 1, LastFetchedAt: time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	_ = driver.CloseDB()
+
+	if _, err := Open("sqlite3", path, WithReadOnly(true)); !xerrors.Is(err, ErrSchemaVersion) {
+		t.Errorf("actual %v, expected ErrSchemaVersion", err)
+	}
+}
+
+func TestSnapshotSqlite(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "cpe.sqlite3"), filepath.Join(dir, "cpe.sqlite3.swap")
+	driver, err := Open("sqlite3", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	// the DB is copied while it's open
+	if err := Snapshot("sqlite3", src, dst); err != nil {
+		t.Fatalf("Snapshot: %s", err)
+	}
+	copied, err := Open("sqlite3", dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = copied.CloseDB()
+	}()
+	if count, err := copied.CountCpes(""); err != nil || count != 10 {
+		t.Errorf("actual %d, %v, expected 10 CPEs", count, err)
+	}
+
+	if err := Snapshot("redis", "redis://localhost/0", dst); err == nil {
+		t.Errorf("expected an error for redis")
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	var tests = []struct {
+		dialect  string
+		dsn      string
+		expected string
+	}{
+		{dialect: dialectSqlite3, dsn: "cpe.sqlite3", expected: "cpe.sqlite3?_busy_timeout=1500"},
+		{dialect: dialectMysql, dsn: "user:pass@tcp(localhost:3306)/cpe?parseTime=true", expected: "user:pass@tcp(localhost:3306)/cpe?parseTime=true&timeout=1.5s"},
+		{dialect: dialectPostgreSQL, dsn: "postgres://user@localhost/cpe", expected: "postgres://user@localhost/cpe?connect_timeout=2"},
+		{dialect: dialectPostgreSQL, dsn: "host=localhost dbname=cpe", expected: "host=localhost dbname=cpe connect_timeout=2"},
+	}
+	for i, tt := range tests {
+		if actual := withTimeout(tt.dialect, tt.dsn, 1500*time.Millisecond); actual != tt.expected {
+			t.Errorf("[%d] actual %s, expected %s", i, actual, tt.expected)
+		}
+	}
+	if actual := withTimeout(dialectSqlite3, "cpe.sqlite3", 0); actual != "cpe.sqlite3" {
+		t.Errorf("actual %s, expected the DSN as is", actual)
+	}
+}
+
+func TestWithTransactionRetrySqlite(t *testing.T) {
+	driver, _, err := NewDB("sqlite3", ":memory:", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+	defer func(wait time.Duration) {
+		transactionRetryWait = wait
+	}(transactionRetryWait)
+	transactionRetryWait = time.Millisecond
+	r := driver.(tracedDriver).DB.(*RDBDriver)
+
+	// SQLITE_BUSY twice, then committed once
+	attempts := 0
+	err = r.withTransactionRetry(r.conn, func(tx *gorm.DB) error {
+		attempts++
+		if err := tx.Create(&models.WatchedProduct{Vendor: "apache", Product: "http_server"}).Error; err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return xerrors.Errorf("Failed to insert. err: %w", r.wrapLocked(sqlite3.Error{Code: sqlite3.ErrBusy}))
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("actual %d attempts, %v, expected 3 attempts", attempts, err)
+	}
+	var rows int
+	if err := r.conn.Model(&models.WatchedProduct{}).Count(&rows).Error; err != nil || rows != 1 {
+		t.Errorf("actual %d, %v, expected 1 row", rows, err)
+	}
+
+	// given up after the retries
+	attempts = 0
+	err = r.withTransactionRetry(r.conn, func(tx *gorm.DB) error {
+		attempts++
+		return sqlite3.Error{Code: sqlite3.ErrBusy}
+	})
+	if err == nil || attempts != maxTransactionRetries+1 {
+		t.Errorf("actual %d attempts, %v, expected %d attempts and an error", attempts, err, maxTransactionRetries+1)
+	}
+
+	// not retried
+	attempts = 0
+	err = r.withTransactionRetry(r.conn, func(tx *gorm.DB) error {
+		attempts++
+		return sqlite3.Error{Code: sqlite3.ErrConstraint}
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("actual %d attempts, %v, expected 1 attempt and an error", attempts, err)
+	}
+}
+
+func TestGormLogger(t *testing.T) {
+	var records []*log15.Record
+	log := log15.New()
+	log.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	statement := func(elapsed time.Duration) []interface{} {
+		return []interface{}{"sql", "rdb.go:1", elapsed, "SELECT * FROM categorized_cpes WHERE vendor = ?", []interface{}{"ntp"}, int64(1)}
+	}
+	var tests = []struct {
+		logger   gormLogger
+		v        []interface{}
+		expected []log15.Lvl
+	}{
+		// the statements and the errors are logged by debugSQL only
+		{logger: gormLogger{log: log}, v: statement(time.Millisecond)},
+		{logger: gormLogger{log: log, debugSQL: true}, v: statement(time.Millisecond), expected: []log15.Lvl{log15.LvlDebug}},
+		{logger: gormLogger{log: log}, v: []interface{}{"log", "rdb.go:1", xerrors.New("broken")}},
+		{logger: gormLogger{log: log, debugSQL: true}, v: []interface{}{"log", "rdb.go:1", xerrors.New("broken")}, expected: []log15.Lvl{log15.LvlDebug}},
+		// the slow ones are warned without debugSQL
+		{logger: gormLogger{log: log, slowQuery: time.Second}, v: statement(time.Millisecond)},
+		{logger: gormLogger{log: log, slowQuery: time.Second}, v: statement(2 * time.Second), expected: []log15.Lvl{log15.LvlWarn}},
+		{logger: gormLogger{log: log, debugSQL: true, slowQuery: time.Second}, v: statement(2 * time.Second), expected: []log15.Lvl{log15.LvlWarn}},
+	}
+	for i, tt := range tests {
+		records = nil
+		tt.logger.Print(tt.v...)
+		actual := []log15.Lvl{}
+		for _, r := range records {
+			actual = append(actual, r.Lvl)
+		}
+		if len(actual) != len(tt.expected) || (0 < len(actual) && !reflect.DeepEqual(actual, tt.expected)) {
+			t.Errorf("[%d] actual %v, expected %v", i, actual, tt.expected)
+		}
+	}
+}
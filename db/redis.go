@@ -1,29 +1,91 @@
+//go:build !noredis
+// +build !noredis
+
 package db
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cheggaaa/pb/v3"
 	"github.com/go-redis/redis/v8"
 	"github.com/inconshreveable/log15"
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/config"
 	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
 )
 
 const (
-	dialectRedis     = "redis"
 	hKeyPrefix       = "CPE#"
 	deprecatedPrefix = hKeyPrefix + "dep#"
 	sep              = "::"
+	fetchMetaKey     = hKeyPrefix + "FETCHMETA"
+	historyPrefix    = hKeyPrefix + "FETCHHISTORY#"
+	watchlistKey     = hKeyPrefix + "WATCHLIST"
+	watchChangesKey  = hKeyPrefix + "WATCHCHANGES"
+	auditKey         = hKeyPrefix + "AUDIT"
+	titleKey         = hKeyPrefix + "Title"
+	versionPrefix    = hKeyPrefix + "ver#"
+	// versionOrderPrefix + <vendor>::<product> holds the versions of the vendor/product scored by versionOrdinal
+	versionOrderPrefix = hKeyPrefix + "vorder#"
+	sourcePrefix       = hKeyPrefix + "src#"
+	// nameIDKey maps the cpeNameIds to the CPE URIs, and nameIDPrefix + CPE URI holds the cpeNameId of the CPE
+	nameIDKey    = hKeyPrefix + "NAMEID"
+	nameIDPrefix = hKeyPrefix + "nameid#"
+	// deprecatedByPrefix + CPE URI holds the CPE URIs replacing the deprecated CPE, one per line
+	deprecatedByPrefix = hKeyPrefix + "depby#"
+	// distroKey maps <distro>::<package> to the JSON of the distribution packages
+	distroKey = hKeyPrefix + "DISTRO"
+	// rejectedKey maps the sources to the JSON of their rejected CPEs
+	rejectedKey = hKeyPrefix + "REJECTED"
+	// knownExploitedKey maps <vendor>::<product> to the number of its CVEs in the CISA Known Exploited Vulnerabilities catalog
+	knownExploitedKey = hKeyPrefix + "KEV"
 )
 
+func init() {
+	drivers[dialectRedis] = func() DB { return &RedisDriver{name: dialectRedis} }
+	pathValidators[dialectRedis] = validateRedisPath
+}
+
+// validateRedisPath checks each URL of the shards
+func validateRedisPath(dbPath string) error {
+	urls := splitShardURLs(dbPath)
+	if len(urls) == 0 {
+		return fmt.Errorf("Empty redis url")
+	}
+	for _, url := range urls {
+		if _, err := redis.ParseURL(url); err != nil {
+			return fmt.Errorf("Invalid redis URL, expected redis://[:password@]host:6379/0, comma separated for the shards: %s", err)
+		}
+	}
+	return nil
+}
+
 // RedisDriver is Driver for Redis
 type RedisDriver struct {
 	name string
-	conn *redis.Client
+	log  log15.Logger
+	// conn is the first shard, which also holds the keys not tied to a vendor
+	conn   *redis.Client
+	shards []*redis.Client
+	ring   *hashRing
+	// keyTTL expires the keys of the CPEs of each vendor/product, 0 for never
+	keyTTL time.Duration
+	// threads bounds the workers reading the vendor/products found by a wildcard search
+	threads int
 }
 
+// ErrEvictingRedis is returned by opening a redis whose maxmemory-policy may evict the keys of the dictionary
+var ErrEvictingRedis = xerrors.New("redis may evict the dictionary")
+
 // Name return db name
 func (r *RedisDriver) Name() string {
 	return r.name
@@ -31,30 +93,107 @@ func (r *RedisDriver) Name() string {
 
 // OpenDB opens Database
 func (r *RedisDriver) OpenDB(dbType, dbPath string, debugSQL bool) (locked bool, err error) {
-	if err = r.connectRedis(dbPath); err != nil {
-		err = fmt.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %s", dbType, dbPath, err)
+	return r.openDB(dbType, dbPath, Option{DebugSQL: debugSQL})
+}
+
+// openDB opens Database with the options of Open
+func (r *RedisDriver) openDB(dbType, dbPath string, option Option) (locked bool, err error) {
+	r.log = option.Logger
+	if r.log == nil {
+		r.log = log15.Root()
 	}
-	return
+	if err = r.connectRedis(dbPath, option.Timeout); err != nil {
+		err = wrapRedisLocked(err)
+		return xerrors.Is(err, ErrLocked), xerrors.Errorf("Failed to open DB. dbtype: %s, dbpath: %s, err: %w", dbType, dbPath, err)
+	}
+	if err := r.checkEviction(option.AllowEviction); err != nil {
+		_ = r.CloseDB()
+		return false, err
+	}
+	r.keyTTL = option.KeyTTL
+	r.threads = option.Threads
+	if r.threads <= 0 {
+		r.threads = runtime.NumCPU()
+	}
+	return false, nil
 }
 
-func (r *RedisDriver) connectRedis(dbPath string) error {
-	var err error
-	var option *redis.Options
-	if option, err = redis.ParseURL(dbPath); err != nil {
-		log15.Error("Failed to parse url.", "err", err)
-		return err
+// checkEviction fails with ErrEvictingRedis when maxmemory-policy of a shard is allkeys-*, evicting the keys without TTLs,
+// i.e. the dictionary, silently under the memory pressure. With allow, it only warns.
+// The volatile-* policies evict only the keys expiring by Option.KeyTTL, refilled by the tiered driver.
+func (r *RedisDriver) checkEviction(allow bool) error {
+	for i, conn := range r.shards {
+		info, err := conn.Info(context.Background(), "memory").Result()
+		if err != nil {
+			// e.g. INFO is disabled by a managed redis
+			r.log.Warn("Failed to get maxmemory-policy of redis. Not checking the eviction", "shard", i, "err", err)
+			continue
+		}
+		policy := infoValue(info, "maxmemory_policy")
+		if !strings.HasPrefix(policy, "allkeys-") {
+			continue
+		}
+		if !allow {
+			return xerrors.Errorf("maxmemory-policy of redis is %s, evicting the CPEs silently. Set noeviction or a volatile-* policy. shard: %d, err: %w", policy, i, ErrEvictingRedis)
+		}
+		r.log.Warn("!!! maxmemory-policy of redis evicts the CPEs silently under the memory pressure, and the queries will miss them !!!", "policy", policy, "shard", i)
+	}
+	return nil
+}
+
+// infoValue returns the value of the field in the reply of INFO, "" when it's missing
+func infoValue(info, field string) string {
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, field+":") {
+			return strings.TrimPrefix(line, field+":")
+		}
+	}
+	return ""
+}
+
+// wrapRedisLocked marks BUSY errors (e.g. a script is running) as ErrLocked
+func wrapRedisLocked(err error) error {
+	if strings.HasPrefix(err.Error(), "BUSY") {
+		return &lockedError{err: err}
 	}
-	ctx := context.Background()
-	r.conn = redis.NewClient(option)
-	err = r.conn.Ping(ctx).Err()
 	return err
 }
 
+func (r *RedisDriver) connectRedis(dbPath string, timeout time.Duration) error {
+	urls := splitShardURLs(dbPath)
+	if len(urls) == 0 {
+		return fmt.Errorf("Empty redis url")
+	}
+
+	ctx := context.Background()
+	for _, url := range urls {
+		option, err := redis.ParseURL(url)
+		if err != nil {
+			r.log.Error("Failed to parse url.", "err", err)
+			return err
+		}
+		if 0 < timeout {
+			option.DialTimeout = timeout
+		}
+		conn := redis.NewClient(option)
+		r.shards = append(r.shards, conn)
+		if err := conn.Ping(ctx).Err(); err != nil {
+			return err
+		}
+	}
+	r.conn = r.shards[0]
+	r.ring = newHashRing(urls)
+	return nil
+}
+
 // CloseDB close Database
 func (r *RedisDriver) CloseDB() (err error) {
-	if err = r.conn.Close(); err != nil {
-		log15.Error("Failed to close DB.", "Type", r.name, "err", err)
-		return
+	for _, conn := range r.shards {
+		if err = conn.Close(); err != nil {
+			r.log.Error("Failed to close DB.", "Type", r.name, "err", err)
+			return
+		}
 	}
 	return
 }
@@ -64,6 +203,324 @@ func (r *RedisDriver) MigrateDB() error {
 	return nil
 }
 
+// GetFetchMeta get FetchMeta from Database
+func (r *RedisDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	ctx := context.Background()
+
+	exists, err := r.conn.Exists(ctx, fetchMetaKey).Result()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to Exists. err: %w", err)
+	}
+	if exists == 0 {
+		return &models.FetchMeta{GoCPEDictRevision: config.Revision, SchemaVersion: models.LatestSchemaVersion, LastFetchedAt: neverFetchedAt}, nil
+	}
+
+	revision, err := r.conn.HGet(ctx, fetchMetaKey, "Revision").Result()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to HGet Revision. err: %w", err)
+	}
+
+	verstr, err := r.conn.HGet(ctx, fetchMetaKey, "SchemaVersion").Result()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to HGet SchemaVersion. err: %w", err)
+	}
+	version, err := strconv.ParseUint(verstr, 10, 8)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to ParseUint. err: %w", err)
+	}
+
+	datestr, err := r.conn.HGet(ctx, fetchMetaKey, "LastFetchedAt").Result()
+	if err != nil {
+		if err != redis.Nil {
+			return nil, xerrors.Errorf("Failed to HGet LastFetchedAt. err: %w", err)
+		}
+		datestr = time.Date(1000, time.January, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	}
+	date, err := time.Parse(time.RFC3339, datestr)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to Parse date. err: %w", err)
+	}
+
+	fetchMeta := models.FetchMeta{GoCPEDictRevision: revision, SchemaVersion: uint(version), LastFetchedAt: date}
+
+	dictVersion, err := r.conn.HGet(ctx, fetchMetaKey, "NVDDictVersion").Result()
+	if err != nil && err != redis.Nil {
+		return nil, xerrors.Errorf("Failed to HGet NVDDictVersion. err: %w", err)
+	}
+	fetchMeta.NVDDictVersion = dictVersion
+
+	sourceHashes, err := r.conn.HGet(ctx, fetchMetaKey, "SourceHashes").Result()
+	if err != nil && err != redis.Nil {
+		return nil, xerrors.Errorf("Failed to HGet SourceHashes. err: %w", err)
+	}
+	fetchMeta.SourceHashes = sourceHashes
+
+	genstr, err := r.conn.HGet(ctx, fetchMetaKey, "Generation").Result()
+	if err != nil {
+		if err != redis.Nil {
+			return nil, xerrors.Errorf("Failed to HGet Generation. err: %w", err)
+		}
+	} else {
+		generation, err := strconv.ParseUint(genstr, 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to ParseUint. err: %w", err)
+		}
+		fetchMeta.Generation = generation
+	}
+
+	generatedstr, err := r.conn.HGet(ctx, fetchMetaKey, "NVDDictGeneratedAt").Result()
+	if err != nil {
+		if err != redis.Nil {
+			return nil, xerrors.Errorf("Failed to HGet NVDDictGeneratedAt. err: %w", err)
+		}
+	} else {
+		generated, err := time.Parse(time.RFC3339, generatedstr)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to Parse date. err: %w", err)
+		}
+		fetchMeta.NVDDictGeneratedAt = &generated
+	}
+
+	return &fetchMeta, nil
+}
+
+// UpsertFetchMeta upsert FetchMeta to Database
+func (r *RedisDriver) UpsertFetchMeta(fetchMeta *models.FetchMeta) error {
+	values := map[string]interface{}{"Revision": config.Revision, "SchemaVersion": models.LatestSchemaVersion, "LastFetchedAt": fetchMeta.LastFetchedAt.Format(time.RFC3339), "SourceHashes": fetchMeta.SourceHashes, "Generation": fetchMeta.Generation}
+	if fetchMeta.NVDDictGeneratedAt != nil {
+		values["NVDDictVersion"] = fetchMeta.NVDDictVersion
+		values["NVDDictGeneratedAt"] = fetchMeta.NVDDictGeneratedAt.Format(time.RFC3339)
+	}
+	if err := r.conn.HSet(context.Background(), fetchMetaKey, values).Err(); err != nil {
+		return xerrors.Errorf("Failed to HSet FetchMeta. err: %w", wrapRedisLocked(err))
+	}
+	return nil
+}
+
+// maxFetchHistories is the number of fetches kept for each source
+const maxFetchHistories = 100
+
+// InsertFetchHistory records a fetch of a source
+func (r *RedisDriver) InsertFetchHistory(history *models.FetchHistory) error {
+	ctx := context.Background()
+	j, err := json.Marshal(history)
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal FetchHistory. err: %w", err)
+	}
+	key := historyPrefix + string(history.FetchType)
+	pipe := r.conn.TxPipeline()
+	pipe.LPush(ctx, key, j)
+	pipe.LTrim(ctx, key, 0, maxFetchHistories-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return xerrors.Errorf("Failed to LPush FetchHistory. err: %w", wrapRedisLocked(err))
+	}
+	return nil
+}
+
+// GetLatestFetchHistories returns the latest fetch of each source
+func (r *RedisDriver) GetLatestFetchHistories() ([]models.FetchHistory, error) {
+	ctx := context.Background()
+	keys, err := scanKeys(ctx, r.conn, historyPrefix+"*")
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to scan FetchHistory. err: %w", err)
+	}
+	sort.Strings(keys)
+
+	histories := []models.FetchHistory{}
+	for _, key := range keys {
+		j, err := r.conn.LIndex(ctx, key, 0).Result()
+		if err != nil {
+			if err == redis.Nil {
+				continue
+			}
+			return nil, xerrors.Errorf("Failed to LIndex FetchHistory. err: %w", err)
+		}
+		var history models.FetchHistory
+		if err := json.Unmarshal([]byte(j), &history); err != nil {
+			return nil, xerrors.Errorf("Failed to unmarshal FetchHistory. err: %w", err)
+		}
+		histories = append(histories, history)
+	}
+	return histories, nil
+}
+
+// InsertAuditEntry records a data-modifying operation
+func (r *RedisDriver) InsertAuditEntry(entry *models.AuditEntry) error {
+	j, err := json.Marshal(entry)
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal AuditEntry. err: %w", err)
+	}
+	if err := r.conn.ZAdd(context.Background(), auditKey, &redis.Z{Score: float64(entry.OperatedAt.Unix()), Member: j}).Err(); err != nil {
+		return xerrors.Errorf("Failed to ZAdd AuditEntry. err: %w", wrapRedisLocked(err))
+	}
+	return nil
+}
+
+// GetAuditEntries returns the operations at or after since, oldest first
+func (r *RedisDriver) GetAuditEntries(since time.Time) ([]models.AuditEntry, error) {
+	values, err := r.conn.ZRangeByScore(context.Background(), auditKey, &redis.ZRangeBy{Min: strconv.FormatInt(since.Unix(), 10), Max: "+inf"}).Result()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to ZRangeByScore AuditEntry. err: %w", err)
+	}
+	entries := []models.AuditEntry{}
+	for _, j := range values {
+		var entry models.AuditEntry
+		if err := json.Unmarshal([]byte(j), &entry); err != nil {
+			return nil, xerrors.Errorf("Failed to unmarshal AuditEntry. err: %w", err)
+		}
+		if entry.OperatedAt.Before(since) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].OperatedAt.Before(entries[j].OperatedAt) })
+	return entries, nil
+}
+
+// GetWatchlist returns the watched products
+func (r *RedisDriver) GetWatchlist() ([]models.WatchedProduct, error) {
+	ctx := context.Background()
+	values, err := r.conn.HGetAll(ctx, watchlistKey).Result()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to HGetAll watchlist. err: %w", err)
+	}
+	watchlist := []models.WatchedProduct{}
+	for _, j := range values {
+		var watched redisWatchedProduct
+		if err := json.Unmarshal([]byte(j), &watched); err != nil {
+			return nil, xerrors.Errorf("Failed to unmarshal watched product. err: %w", err)
+		}
+		watched.WatchedProduct.Versions = watched.Versions
+		watched.WatchedProduct.DeprecatedCpes = watched.DeprecatedCpes
+		watchlist = append(watchlist, watched.WatchedProduct)
+	}
+	sort.Slice(watchlist, func(i, j int) bool {
+		if watchlist[i].Vendor != watchlist[j].Vendor {
+			return watchlist[i].Vendor < watchlist[j].Vendor
+		}
+		return watchlist[i].Product < watchlist[j].Product
+	})
+	return watchlist, nil
+}
+
+// redisWatchedProduct is the JSON of a watched product stored in redis, which keeps the fields hidden from the API
+type redisWatchedProduct struct {
+	models.WatchedProduct
+	Versions       string `json:"versions"`
+	DeprecatedCpes string `json:"deprecatedCpes"`
+}
+
+// UpsertWatchedProduct puts a product on the watchlist, or updates it
+func (r *RedisDriver) UpsertWatchedProduct(watched *models.WatchedProduct) error {
+	j, err := json.Marshal(redisWatchedProduct{WatchedProduct: *watched, Versions: watched.Versions, DeprecatedCpes: watched.DeprecatedCpes})
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal watched product. err: %w", err)
+	}
+	if err := r.conn.HSet(context.Background(), watchlistKey, watched.Vendor+sep+watched.Product, j).Err(); err != nil {
+		return xerrors.Errorf("Failed to HSet watchlist. err: %w", wrapRedisLocked(err))
+	}
+	return nil
+}
+
+// DeleteWatchedProduct removes a product from the watchlist, and returns whether it was there
+func (r *RedisDriver) DeleteWatchedProduct(vendor, product string) (bool, error) {
+	n, err := r.conn.HDel(context.Background(), watchlistKey, vendor+sep+product).Result()
+	if err != nil {
+		return false, xerrors.Errorf("Failed to HDel watchlist. err: %w", wrapRedisLocked(err))
+	}
+	return 0 < n, nil
+}
+
+// InsertWatchChanges records the changes of the watched products
+func (r *RedisDriver) InsertWatchChanges(changes []models.WatchChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	members := []*redis.Z{}
+	for _, c := range changes {
+		j, err := json.Marshal(c)
+		if err != nil {
+			return xerrors.Errorf("Failed to marshal watch change. err: %w", err)
+		}
+		members = append(members, &redis.Z{Score: float64(c.DetectedAt.Unix()), Member: j})
+	}
+	if err := r.conn.ZAdd(ctx, watchChangesKey, members...).Err(); err != nil {
+		return xerrors.Errorf("Failed to ZAdd watch changes. err: %w", wrapRedisLocked(err))
+	}
+	return nil
+}
+
+// GetWatchChanges returns the changes of the watched products detected at or after since, oldest first
+func (r *RedisDriver) GetWatchChanges(since time.Time) ([]models.WatchChange, error) {
+	ctx := context.Background()
+	values, err := r.conn.ZRangeByScore(ctx, watchChangesKey, &redis.ZRangeBy{Min: strconv.FormatInt(since.Unix(), 10), Max: "+inf"}).Result()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to ZRangeByScore watch changes. err: %w", err)
+	}
+	changes := []models.WatchChange{}
+	for _, j := range values {
+		var c models.WatchChange
+		if err := json.Unmarshal([]byte(j), &c); err != nil {
+			return nil, xerrors.Errorf("Failed to unmarshal watch change. err: %w", err)
+		}
+		if c.DetectedAt.Before(since) {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].DetectedAt.Before(changes[j].DetectedAt) })
+	return changes, nil
+}
+
+// ReplaceRejectedCpes replaces the rejected CPEs of the source
+func (r *RedisDriver) ReplaceRejectedCpes(source models.FetchType, rejects []models.RejectedCpe) error {
+	ctx := context.Background()
+	if len(rejects) == 0 {
+		if err := r.conn.HDel(ctx, rejectedKey, string(source)).Err(); err != nil {
+			return xerrors.Errorf("Failed to HDel rejected CPEs. err: %w", wrapRedisLocked(err))
+		}
+		return nil
+	}
+	cs := make([]models.RejectedCpe, 0, len(rejects))
+	for _, c := range rejects {
+		c.FetchType = source
+		cs = append(cs, c)
+	}
+	j, err := json.Marshal(cs)
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal rejected CPEs. err: %w", err)
+	}
+	if err := r.conn.HSet(ctx, rejectedKey, string(source), j).Err(); err != nil {
+		return xerrors.Errorf("Failed to HSet rejected CPEs. err: %w", wrapRedisLocked(err))
+	}
+	return nil
+}
+
+// GetRejectedCpes returns the rejected CPEs of the source, or of all the sources when source is empty
+func (r *RedisDriver) GetRejectedCpes(source models.FetchType) ([]models.RejectedCpe, error) {
+	values, err := r.conn.HGetAll(context.Background(), rejectedKey).Result()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to HGetAll rejected CPEs. err: %w", err)
+	}
+	sources := []string{}
+	for s := range values {
+		if source == "" || s == string(source) {
+			sources = append(sources, s)
+		}
+	}
+	sort.Strings(sources)
+	rejects := []models.RejectedCpe{}
+	for _, s := range sources {
+		var cs []models.RejectedCpe
+		if err := json.Unmarshal([]byte(values[s]), &cs); err != nil {
+			return nil, xerrors.Errorf("Failed to unmarshal rejected CPEs. err: %w", err)
+		}
+		rejects = append(rejects, cs...)
+	}
+	return rejects, nil
+}
+
 // GetVendorProducts : GetVendorProducts
 func (r *RedisDriver) GetVendorProducts() (vendorProducts []string, err error) {
 	ctx := context.Background()
@@ -71,7 +528,99 @@ func (r *RedisDriver) GetVendorProducts() (vendorProducts []string, err error) {
 	if result = r.conn.ZRange(ctx, hKeyPrefix+"VendorProduct", 0, -1); result.Err() != nil {
 		return nil, result.Err()
 	}
-	return result.Val(), nil
+	// scores hold the popularity, so sort lexically here
+	vendorProducts = result.Val()
+	sort.Strings(vendorProducts)
+	return vendorProducts, nil
+}
+
+// GetVendorProductsByPopularity : GetVendorProducts sorted by the number of referencing CVEs
+func (r *RedisDriver) GetVendorProductsByPopularity() ([]string, error) {
+	ctx := context.Background()
+	var result *redis.ZSliceCmd
+	if result = r.conn.ZRevRangeWithScores(ctx, hKeyPrefix+"VendorProduct", 0, -1); result.Err() != nil {
+		return nil, result.Err()
+	}
+
+	zs := result.Val()
+	sort.SliceStable(zs, func(i, j int) bool {
+		if zs[i].Score != zs[j].Score {
+			return zs[i].Score > zs[j].Score
+		}
+		return zs[i].Member.(string) < zs[j].Member.(string)
+	})
+	vendorProducts := make([]string, 0, len(zs))
+	for _, z := range zs {
+		vendorProducts = append(vendorProducts, z.Member.(string))
+	}
+	return vendorProducts, nil
+}
+
+// GetVendorProductTitles : GetVendorProductTitles returns the titles keyed by vendor::product
+func (r *RedisDriver) GetVendorProductTitles() (map[string]string, error) {
+	titles, err := r.conn.HGetAll(context.Background(), titleKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to HGetAll titles. err: %s", err)
+	}
+	return titles, nil
+}
+
+// GetProductSummaries : GetProductSummaries groups the CPEs by vendor/product
+func (r *RedisDriver) GetProductSummaries() ([]models.ProductSummary, error) {
+	ctx := context.Background()
+	zs, err := r.conn.ZRangeWithScores(ctx, hKeyPrefix+"VendorProduct", 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to zrange vendorProduct. err :%s", err)
+	}
+	// scores hold the popularity, so sort lexically here
+	sort.Slice(zs, func(i, j int) bool { return zs[i].Member.(string) < zs[j].Member.(string) })
+
+	summaries := make([]models.ProductSummary, 0, len(zs))
+	for _, z := range zs {
+		vp := z.Member.(string)
+		ss := strings.SplitN(vp, sep, 2)
+		if len(ss) != 2 {
+			continue
+		}
+		conn := r.shard(ss[0])
+		cpeURIs, err := conn.ZRange(ctx, hKeyPrefix+vp, 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to zrange CPE. err :%s", err)
+		}
+		pipe := conn.Pipeline()
+		cmds := make([]*redis.StringCmd, 0, len(cpeURIs))
+		for _, cpeURI := range cpeURIs {
+			cmds = append(cmds, pipe.Get(ctx, deprecatedPrefix+cpeURI))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("Failed to get deprecated CPE. err :%s", err)
+		}
+
+		summary := models.ProductSummary{Vendor: ss[0], Product: ss[1], CPEs: len(cpeURIs), Popularity: int(z.Score), Parts: []string{}}
+		versions, parts := map[string]bool{}, map[string]bool{}
+		for i, cpeURI := range cpeURIs {
+			if cmds[i].Val() == "true" {
+				summary.Deprecated++
+			}
+			wfn, err := naming.UnbindURI(cpeURI)
+			if err != nil {
+				continue
+			}
+			switch v := wfn.GetString(common.AttributeVersion); v {
+			case "", "ANY", "NA":
+			default:
+				versions[v] = true
+			}
+			parts[wfn.GetString(common.AttributePart)] = true
+		}
+		summary.Versions = len(versions)
+		for p := range parts {
+			summary.Parts = append(summary.Parts, p)
+		}
+		sort.Strings(summary.Parts)
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
 }
 
 // GetCpesByVendorProduct : GetCpesByVendorProduct
@@ -79,24 +628,204 @@ func (r *RedisDriver) GetCpesByVendorProduct(vendor, product string) ([]string,
 	if vendor == "" || product == "" {
 		return nil, nil, nil
 	}
-	result := r.conn.ZRange(context.Background(), hKeyPrefix+vendor+sep+product, 0, -1)
-	if result.Err() != nil {
-		return nil, nil, fmt.Errorf("Failed to zrange CPE. err :%s", result.Err())
+	details, err := r.GetCpeDetailsByVendorProduct(vendor, product)
+	if err != nil {
+		return nil, nil, err
+	}
+	cpeURIs, deprecated := details.CpeURIs()
+	return cpeURIs, deprecated, nil
+}
+
+// GetCpeDetailsByVendorProduct : GetCpeDetailsByVendorProduct
+// A vendor or a product with a wildcard is a LIKE pattern as on RDB, searched on the shards by searchCpeDetails.
+func (r *RedisDriver) GetCpeDetailsByVendorProduct(vendor, product string) (*models.CpeDetails, error) {
+	if vendor == "" || product == "" {
+		return cpeDetails(nil), nil
+	}
+	if HasLikeWildcard(vendor) || HasLikeWildcard(product) {
+		return r.searchCpeDetails(vendor, product)
+	}
+	vendor, product = UnescapeLike(vendor), UnescapeLike(product)
+	results, err := r.cpesOfKey(context.Background(), r.shard(vendor), hKeyPrefix+vendor+sep+product)
+	if err != nil {
+		return nil, err
+	}
+	return cpeDetails(results), nil
+}
+
+// cpesOfKey reads the CPEs in the sorted set of a vendor/product at key with their deprecations
+func (r *RedisDriver) cpesOfKey(ctx context.Context, conn *redis.Client, key string) ([]models.CategorizedCpe, error) {
+	cpeURIs, err := conn.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to zrange CPE. err :%s", err)
+	}
+
+	pipe := conn.Pipeline()
+	deprecatedCmds, byCmds := make([]*redis.StringCmd, 0, len(cpeURIs)), make([]*redis.StringCmd, 0, len(cpeURIs))
+	for _, cpeURI := range cpeURIs {
+		deprecatedCmds = append(deprecatedCmds, pipe.Get(ctx, deprecatedPrefix+cpeURI))
+		byCmds = append(byCmds, pipe.Get(ctx, deprecatedByPrefix+cpeURI))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("Failed to get deprecated CPE. err :%s", err)
+	}
+	results := make([]models.CategorizedCpe, 0, len(cpeURIs))
+	for i, cpeURI := range cpeURIs {
+		results = append(results, models.CategorizedCpe{CpeURI: cpeURI, Deprecated: deprecatedCmds[i].Val() == "true", DeprecatedBy: byCmds[i].Val()})
+	}
+	return results, nil
+}
+
+// GetSourcedCpesByVendorProduct : GetSourcedCpesByVendorProduct merges the CPEs over the sources.
+// Empty sources means all sources.
+func (r *RedisDriver) GetSourcedCpesByVendorProduct(vendor, product string, sources []models.FetchType) ([]models.SourcedCpe, error) {
+	if vendor == "" || product == "" {
+		return []models.SourcedCpe{}, nil
+	}
+	vendor, product = UnescapeLike(vendor), UnescapeLike(product)
+	ctx := context.Background()
+	conn := r.shard(vendor)
+	cpeURIs, err := conn.ZRange(ctx, hKeyPrefix+vendor+sep+product, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to zrange CPE. err :%s", err)
 	}
 
-	cpeURIs, deprecated := []string{}, []string{}
-	for _, cpeURI := range result.Val() {
-		ok, err := r.IsDeprecated(cpeURI)
+	wanted := map[models.FetchType]bool{}
+	for _, s := range sources {
+		wanted[s] = true
+	}
+	results := []models.CategorizedCpe{}
+	for _, cpeURI := range cpeURIs {
+		cpes, err := r.sourcedCpe(ctx, conn, cpeURI)
 		if err != nil {
-			return nil, nil, fmt.Errorf("Failed to get deprecated CPE. err :%s", err)
+			return nil, err
 		}
-		if ok {
-			deprecated = append(deprecated, cpeURI)
-		} else {
-			cpeURIs = append(cpeURIs, cpeURI)
+		for _, c := range cpes {
+			if len(wanted) == 0 || wanted[c.FetchType] {
+				results = append(results, c)
+			}
 		}
 	}
-	return cpeURIs, deprecated, nil
+	return mergeSources(results), nil
+}
+
+// sourcedCpe returns a CPE per source of cpeURI, stored on conn
+func (r *RedisDriver) sourcedCpe(ctx context.Context, conn *redis.Client, cpeURI string) ([]models.CategorizedCpe, error) {
+	fetchTypes, err := conn.SMembers(ctx, sourcePrefix+cpeURI).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to SMembers sources. err :%s", err)
+	}
+	deprecated, err := r.IsDeprecated(cpeURI)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get deprecated CPE. err :%s", err)
+	}
+	nameID, err := conn.Get(ctx, nameIDPrefix+cpeURI).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("Failed to get cpeNameId. err :%s", err)
+	}
+	deprecatedBy, err := conn.Get(ctx, deprecatedByPrefix+cpeURI).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("Failed to get the CPEs replacing the deprecated CPE. err :%s", err)
+	}
+	cpes := make([]models.CategorizedCpe, 0, len(fetchTypes))
+	for _, f := range fetchTypes {
+		cpes = append(cpes, models.CategorizedCpe{CpeURI: cpeURI, Deprecated: deprecated, FetchType: models.FetchType(f), CpeNameID: nameID, DeprecatedBy: deprecatedBy})
+	}
+	return cpes, nil
+}
+
+// GetCpeByNameID returns the CPE of the cpeNameId of NVD API 2.0 merged over the sources, nil when it's not found
+func (r *RedisDriver) GetCpeByNameID(id string) (*models.SourcedCpe, error) {
+	ctx := context.Background()
+	cpeURI, err := r.conn.HGet(ctx, nameIDKey, strings.ToUpper(id)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to HGet cpeNameId. err: %s", err)
+	}
+	results, err := r.sourcedCpe(ctx, r.shardByCpeURI(cpeURI), cpeURI)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	cpes := mergeSources(results)
+	return &cpes[0], nil
+}
+
+// GetProductsByVersion : GetProductsByVersion returns vendor::product having the version
+func (r *RedisDriver) GetProductsByVersion(version string) ([]string, error) {
+	vendorProducts, err := r.conn.SMembers(context.Background(), versionPrefix+quoteWFN(version)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to SMembers products. err: %s", err)
+	}
+	sort.Strings(vendorProducts)
+	return vendorProducts, nil
+}
+
+// GetVersionsByVendorProduct : GetVersionsByVendorProduct returns the versions of vendor/product between from and to.
+// The range is queried by the scores of the sorted set. The versions of the same ordinal are ordered by the version, as redis orders the members of the same score.
+func (r *RedisDriver) GetVersionsByVendorProduct(vendor, product, from, to string) ([]string, error) {
+	by := &redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if from != "" {
+		by.Min = strconv.FormatFloat(versionOrdinal(from), 'f', 0, 64)
+	}
+	if to != "" {
+		by.Max = strconv.FormatFloat(versionOrdinal(to), 'f', 0, 64)
+	}
+	versions, err := r.shard(vendor).ZRangeByScore(context.Background(), versionOrderPrefix+vendor+sep+product, by).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to ZRangeByScore versions. err: %s", err)
+	}
+	return versions, nil
+}
+
+// GetAttributeStats counts the attributes of the CPEs of every vendor/product
+func (r *RedisDriver) GetAttributeStats(attributes []string, top int) ([]models.AttributeStat, error) {
+	return attributeStats(r, attributes, top)
+}
+
+// CountCpes returns the number of CPEs defined by the source
+func (r *RedisDriver) CountCpes(fetchType models.FetchType) (int, error) {
+	ctx := context.Background()
+	count := 0
+	for _, conn := range r.shards {
+		keys, err := scanKeys(ctx, conn, sourcePrefix+"*")
+		if err != nil {
+			return 0, err
+		}
+		pipe := conn.Pipeline()
+		cmds := make([]*redis.BoolCmd, 0, len(keys))
+		for _, key := range keys {
+			cmds = append(cmds, pipe.SIsMember(ctx, key, string(fetchType)))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return 0, fmt.Errorf("Failed to SIsMember sources. err: %s", err)
+		}
+		for _, cmd := range cmds {
+			if cmd.Val() {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// GetCpesChangedSince returns an error, since redis doesn't track the changes of the CPEs
+func (r *RedisDriver) GetCpesChangedSince(uint64, time.Time) ([]models.CategorizedCpe, error) {
+	return nil, xerrors.New("The changes of the CPEs are not tracked by redis, only by the RDB")
+}
+
+// GetVendorProductsAsOf returns ErrNoHistory, since redis doesn't track the history of the CPEs
+func (r *RedisDriver) GetVendorProductsAsOf(time.Time) ([]string, error) {
+	return nil, xerrors.Errorf("Failed to query redis as of a time. err: %w", ErrNoHistory)
+}
+
+// GetCpeDetailsAsOf returns ErrNoHistory, since redis doesn't track the history of the CPEs
+func (r *RedisDriver) GetCpeDetailsAsOf(string, string, time.Time) (*models.CpeDetails, error) {
+	return nil, xerrors.Errorf("Failed to query redis as of a time. err: %w", ErrNoHistory)
 }
 
 // InsertCpes Select Cve information from DB.
@@ -105,34 +834,188 @@ func (r *RedisDriver) InsertCpes(cpes []models.CategorizedCpe) (err error) {
 	bar := pb.New(len(cpes))
 	bar.Start()
 	for chunked := range chunkSlice(cpes, 10) {
-		var pipe redis.Pipeliner
-		pipe = r.conn.Pipeline()
+		pipes := map[*redis.Client]redis.Pipeliner{}
+		pipeline := func(conn *redis.Client) redis.Pipeliner {
+			if _, ok := pipes[conn]; !ok {
+				pipes[conn] = conn.Pipeline()
+			}
+			return pipes[conn]
+		}
 		for _, c := range chunked {
 			bar.Increment()
-			if result := pipe.ZAdd(ctx, hKeyPrefix+"VendorProduct", &redis.Z{Score: 0, Member: c.Vendor + sep + c.Product}); result.Err() != nil {
-				return fmt.Errorf("Failed to ZAdd vendorProduct. err: %s", result.Err())
+			pipe := pipeline(r.conn)
+			// the score holds the popularity. Don't reset it when the source has no popularity.
+			vp := &redis.Z{Score: float64(c.Popularity), Member: c.Vendor + sep + c.Product}
+			if 0 < c.Popularity {
+				if result := pipe.ZAdd(ctx, hKeyPrefix+"VendorProduct", vp); result.Err() != nil {
+					return fmt.Errorf("Failed to ZAdd vendorProduct. err: %s", result.Err())
+				}
+			} else if result := pipe.ZAddNX(ctx, hKeyPrefix+"VendorProduct", vp); result.Err() != nil {
+				return fmt.Errorf("Failed to ZAddNX vendorProduct. err: %s", result.Err())
+			}
+			if c.Title != "" {
+				if result := pipe.HSet(ctx, titleKey, c.Vendor+sep+c.Product, c.Title); result.Err() != nil {
+					return fmt.Errorf("Failed to HSet title. err: %s", result.Err())
+				}
 			}
+			if hasVersion(c.Version) {
+				if result := pipe.SAdd(ctx, versionPrefix+c.Version, c.Vendor+sep+c.Product); result.Err() != nil {
+					return fmt.Errorf("Failed to SAdd version. err: %s", result.Err())
+				}
+			}
+			if c.CpeNameID != "" {
+				if result := pipe.HSet(ctx, nameIDKey, c.CpeNameID, c.CpeURI); result.Err() != nil {
+					return fmt.Errorf("Failed to HSet cpeNameId. err: %s", result.Err())
+				}
+			}
+
+			pipe = pipeline(r.shard(c.Vendor))
+			// the keys of the vendor/product and its CPEs, expiring by keyTTL
+			expiring := []string{hKeyPrefix + c.Vendor + sep + c.Product}
 			if result := pipe.ZAdd(ctx, hKeyPrefix+c.Vendor+sep+c.Product, &redis.Z{Score: 0, Member: c.CpeURI}); result.Err() != nil {
 				return fmt.Errorf("Failed to ZAdd CpeURI. err: %s", result.Err())
 			}
+			if hasVersion(c.Version) {
+				if result := pipe.ZAdd(ctx, versionOrderPrefix+c.Vendor+sep+c.Product, &redis.Z{Score: versionOrdinal(c.Version), Member: c.Version}); result.Err() != nil {
+					return fmt.Errorf("Failed to ZAdd version order. err: %s", result.Err())
+				}
+				expiring = append(expiring, versionOrderPrefix+c.Vendor+sep+c.Product)
+			}
+			if c.FetchType != "" {
+				if result := pipe.SAdd(ctx, sourcePrefix+c.CpeURI, string(c.FetchType)); result.Err() != nil {
+					return fmt.Errorf("Failed to SAdd source. err: %s", result.Err())
+				}
+				expiring = append(expiring, sourcePrefix+c.CpeURI)
+			}
 			if c.Deprecated {
 				if result := pipe.Set(ctx, fmt.Sprintf("%s%s", deprecatedPrefix, c.CpeURI), "true", time.Duration(0)); result.Err() != nil {
 					return fmt.Errorf("Failed to set to deprecated CPE. err: %s", result.Err())
 				}
+				expiring = append(expiring, deprecatedPrefix+c.CpeURI)
+			}
+			if c.CpeNameID != "" {
+				if result := pipe.Set(ctx, nameIDPrefix+c.CpeURI, c.CpeNameID, time.Duration(0)); result.Err() != nil {
+					return fmt.Errorf("Failed to set cpeNameId. err: %s", result.Err())
+				}
+				expiring = append(expiring, nameIDPrefix+c.CpeURI)
+			}
+			if c.DeprecatedBy != "" {
+				if result := pipe.Set(ctx, deprecatedByPrefix+c.CpeURI, c.DeprecatedBy, time.Duration(0)); result.Err() != nil {
+					return fmt.Errorf("Failed to set the CPEs replacing the deprecated CPE. err: %s", result.Err())
+				}
+				expiring = append(expiring, deprecatedByPrefix+c.CpeURI)
+			}
+			if 0 < r.keyTTL {
+				for _, key := range expiring {
+					pipe.Expire(ctx, key, r.keyTTL)
+				}
 			}
 		}
-		if _, err = pipe.Exec(ctx); err != nil {
-			return fmt.Errorf("Failed to exec pipeline. err: %s", err)
+		for _, pipe := range pipes {
+			if _, err = pipe.Exec(ctx); err != nil {
+				return xerrors.Errorf("Failed to exec pipeline. err: %w", wrapRedisLocked(err))
+			}
 		}
 	}
 	bar.Finish()
-	log15.Info(fmt.Sprintf("Refreshed %d CPEs.", len(cpes)))
+	r.log.Info(fmt.Sprintf("Refreshed %d CPEs.", len(cpes)))
 	return nil
 }
 
+// ReplaceCpes inserts the CPEs as InsertCpes does. The CPEs of source missing from them are kept,
+// since the keys of a CPE are shared by the sources and the vendor/products.
+func (r *RedisDriver) ReplaceCpes(_ models.FetchType, cpes []models.CategorizedCpe) error {
+	return r.InsertCpes(cpes)
+}
+
+// InsertDistroPackages replaces the mapping of the distribution packages
+func (r *RedisDriver) InsertDistroPackages(packages []models.DistroPackage) error {
+	ctx := context.Background()
+	grouped := map[string][]models.DistroPackage{}
+	for _, p := range packages {
+		field := p.Distro + sep + p.Package
+		grouped[field] = append(grouped[field], p)
+	}
+	pipe := r.conn.TxPipeline()
+	pipe.Del(ctx, distroKey)
+	for field, ps := range grouped {
+		j, err := json.Marshal(ps)
+		if err != nil {
+			return xerrors.Errorf("Failed to marshal distribution packages. err: %w", err)
+		}
+		pipe.HSet(ctx, distroKey, field, j)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return xerrors.Errorf("Failed to HSet distribution packages. err: %w", wrapRedisLocked(err))
+	}
+	return nil
+}
+
+// GetDistroPackages returns the vendor/products the package of the distribution is mapped to
+func (r *RedisDriver) GetDistroPackages(distro, pkg string) ([]models.DistroPackage, error) {
+	packages := []models.DistroPackage{}
+	j, err := r.conn.HGet(context.Background(), distroKey, distro+sep+pkg).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return packages, nil
+		}
+		return nil, xerrors.Errorf("Failed to HGet distribution packages. err: %w", err)
+	}
+	if err := json.Unmarshal([]byte(j), &packages); err != nil {
+		return nil, xerrors.Errorf("Failed to unmarshal distribution packages. err: %w", err)
+	}
+	return packages, nil
+}
+
+// GetCpesByDistroPackage returns the CPEs of the package of the distribution
+func (r *RedisDriver) GetCpesByDistroPackage(distro, pkg string) ([]string, []string, error) {
+	return cpesByDistroPackage(r, distro, pkg)
+}
+
+// ReplaceKnownExploited replaces the vendor/products of the CISA Known Exploited Vulnerabilities catalog
+func (r *RedisDriver) ReplaceKnownExploited(products []models.KnownExploitedProduct) error {
+	ctx := context.Background()
+	pipe := r.conn.TxPipeline()
+	pipe.Del(ctx, knownExploitedKey)
+	for _, p := range products {
+		pipe.HSet(ctx, knownExploitedKey, p.Vendor+sep+p.Product, p.CVEs)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return xerrors.Errorf("Failed to HSet known exploited products. err: %w", wrapRedisLocked(err))
+	}
+	return nil
+}
+
+// GetKnownExploited returns the vendor/products of the CISA Known Exploited Vulnerabilities catalog
+func (r *RedisDriver) GetKnownExploited() ([]models.KnownExploitedProduct, error) {
+	values, err := r.conn.HGetAll(context.Background(), knownExploitedKey).Result()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to HGetAll known exploited products. err: %w", err)
+	}
+	products := make([]models.KnownExploitedProduct, 0, len(values))
+	for vp, cves := range values {
+		ss := strings.SplitN(vp, sep, 2)
+		if len(ss) != 2 {
+			continue
+		}
+		n, err := strconv.Atoi(cves)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to Atoi. err: %w", err)
+		}
+		products = append(products, models.KnownExploitedProduct{Vendor: ss[0], Product: ss[1], CVEs: n})
+	}
+	sort.Slice(products, func(i, j int) bool {
+		if products[i].Vendor != products[j].Vendor {
+			return products[i].Vendor < products[j].Vendor
+		}
+		return products[i].Product < products[j].Product
+	})
+	return products, nil
+}
+
 // IsDeprecated : IsDeprecated
 func (r *RedisDriver) IsDeprecated(cpeURI string) (bool, error) {
-	cmd := r.conn.Get(context.Background(), fmt.Sprintf("%s%s", deprecatedPrefix, cpeURI))
+	cmd := r.shardByCpeURI(cpeURI).Get(context.Background(), fmt.Sprintf("%s%s", deprecatedPrefix, cpeURI))
 	if cmd.Err() == redis.Nil {
 		// key not found means the CPE is not deprecated
 		return false, nil
@@ -141,3 +1024,191 @@ func (r *RedisDriver) IsDeprecated(cpeURI string) (bool, error) {
 	}
 	return cmd.Val() == "true", nil
 }
+
+// GC removes the keys no longer reachable from the vendor/product list:
+// titles and versions of unlisted vendor/products, CPE lists and version orders of unlisted vendor/products,
+// sources, deprecated flags, the CPEs replacing them and cpeNameIds of unlisted CPEs, and the keys left on a shard
+// which no longer owns the vendor since a shard was added.
+func (r *RedisDriver) GC() ([]GCStat, error) {
+	ctx := context.Background()
+	listed := func(vendorProduct string) (bool, error) {
+		err := r.conn.ZScore(ctx, hKeyPrefix+"VendorProduct", vendorProduct).Err()
+		if err == redis.Nil {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	stats := []GCStat{}
+
+	vendorProducts, err := r.conn.HKeys(ctx, titleKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to HKeys titles. err: %s", err)
+	}
+	stat := GCStat{Table: titleKey}
+	for _, vp := range vendorProducts {
+		ok, err := listed(vp)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to ZScore vendorProduct. err: %s", err)
+		}
+		if !ok {
+			if err := r.conn.HDel(ctx, titleKey, vp).Err(); err != nil {
+				return nil, xerrors.Errorf("Failed to HDel title. err: %w", wrapRedisLocked(err))
+			}
+			stat.Rows++
+		}
+	}
+	stats = append(stats, stat)
+
+	keys, err := scanKeys(ctx, r.conn, versionPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	stat = GCStat{Table: versionPrefix + "*"}
+	for _, key := range keys {
+		vendorProducts, err := r.conn.SMembers(ctx, key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to SMembers products. err: %s", err)
+		}
+		for _, vp := range vendorProducts {
+			ok, err := listed(vp)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to ZScore vendorProduct. err: %s", err)
+			}
+			if !ok {
+				if err := r.conn.SRem(ctx, key, vp).Err(); err != nil {
+					return nil, xerrors.Errorf("Failed to SRem product. err: %w", wrapRedisLocked(err))
+				}
+				stat.Rows++
+			}
+		}
+	}
+	stats = append(stats, stat)
+
+	// CPE lists and version orders by vendor/product
+	stat = GCStat{Table: hKeyPrefix + "<vendor>::<product>"}
+	for _, conn := range r.shards {
+		keys, err := scanKeys(ctx, conn, hKeyPrefix+"*"+sep+"*")
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if strings.HasPrefix(key, deprecatedPrefix) || strings.HasPrefix(key, deprecatedByPrefix) || strings.HasPrefix(key, sourcePrefix) || strings.HasPrefix(key, versionPrefix) || strings.HasPrefix(key, nameIDPrefix) {
+				continue
+			}
+			vp := strings.TrimPrefix(key, hKeyPrefix)
+			if strings.HasPrefix(key, versionOrderPrefix) {
+				vp = strings.TrimPrefix(key, versionOrderPrefix)
+			}
+			ss := strings.SplitN(vp, sep, 2)
+			ok, err := listed(vp)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to ZScore vendorProduct. err: %s", err)
+			}
+			if ok && r.shard(ss[0]) == conn {
+				continue
+			}
+			if err := conn.Del(ctx, key).Err(); err != nil {
+				return nil, xerrors.Errorf("Failed to Del CPEs. err: %w", wrapRedisLocked(err))
+			}
+			stat.Rows++
+		}
+	}
+	stats = append(stats, stat)
+
+	for _, prefix := range []string{sourcePrefix, deprecatedPrefix, deprecatedByPrefix, nameIDPrefix} {
+		stat = GCStat{Table: prefix + "*"}
+		for _, conn := range r.shards {
+			keys, err := scanKeys(ctx, conn, prefix+"*")
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range keys {
+				cpeURI := strings.TrimPrefix(key, prefix)
+				if wfn, err := naming.UnbindURI(cpeURI); err == nil {
+					vendor, product := wfn.GetString(common.AttributeVendor), wfn.GetString(common.AttributeProduct)
+					if owner := r.shard(vendor); owner == conn {
+						err := owner.ZScore(ctx, hKeyPrefix+vendor+sep+product, cpeURI).Err()
+						if err == nil {
+							continue
+						} else if err != redis.Nil {
+							return nil, fmt.Errorf("Failed to ZScore CpeURI. err: %s", err)
+						}
+					}
+				}
+				if err := conn.Del(ctx, key).Err(); err != nil {
+					return nil, xerrors.Errorf("Failed to Del key. err: %w", wrapRedisLocked(err))
+				}
+				stat.Rows++
+			}
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// CheckIntegrity finds the vendor/products without the vendor or the product and the malformed CPE URIs
+// left by the older versions. A sorted set can't hold duplicates, so there are none to find.
+// With repair, they are removed along with the keys of them.
+func (r *RedisDriver) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	ctx := context.Background()
+	report := &IntegrityReport{Issues: []IntegrityIssue{}}
+
+	vendorProducts, err := r.conn.ZRange(ctx, hKeyPrefix+"VendorProduct", 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to ZRange vendorProduct. err: %s", err)
+	}
+	for _, vp := range vendorProducts {
+		ss := strings.SplitN(vp, sep, 2)
+		if len(ss) != 2 || ss[0] == "" || ss[1] == "" {
+			report.Issues = append(report.Issues, IntegrityIssue{Kind: IssueEmptyVendor, CpeURI: vp, Rows: 1})
+			if repair {
+				if err := r.conn.ZRem(ctx, hKeyPrefix+"VendorProduct", vp).Err(); err != nil {
+					return nil, xerrors.Errorf("Failed to ZRem vendorProduct. err: %w", wrapRedisLocked(err))
+				}
+				if err := r.conn.HDel(ctx, titleKey, vp).Err(); err != nil {
+					return nil, xerrors.Errorf("Failed to HDel title. err: %w", wrapRedisLocked(err))
+				}
+				report.Repaired++
+			}
+			continue
+		}
+
+		conn := r.shard(ss[0])
+		key := hKeyPrefix + vp
+		cpeURIs, err := conn.ZRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to ZRange CPE. err: %s", err)
+		}
+		for _, cpeURI := range cpeURIs {
+			if _, err := naming.UnbindURI(cpeURI); err == nil {
+				continue
+			}
+			report.Issues = append(report.Issues, IntegrityIssue{Kind: IssueMalformedURI, CpeURI: cpeURI, Rows: 1})
+			if !repair {
+				continue
+			}
+			if err := conn.ZRem(ctx, key, cpeURI).Err(); err != nil {
+				return nil, xerrors.Errorf("Failed to ZRem CpeURI. err: %w", wrapRedisLocked(err))
+			}
+			if err := conn.Del(ctx, sourcePrefix+cpeURI, deprecatedPrefix+cpeURI, deprecatedByPrefix+cpeURI, nameIDPrefix+cpeURI).Err(); err != nil {
+				return nil, xerrors.Errorf("Failed to Del the keys of CpeURI. err: %w", wrapRedisLocked(err))
+			}
+			report.Repaired++
+		}
+	}
+	return report, nil
+}
+
+// scanKeys returns the keys matching the pattern.
+// They are collected before deleting any, since SCAN may return a key twice while keys are deleted.
+func scanKeys(ctx context.Context, conn *redis.Client, pattern string) ([]string, error) {
+	keys := []string{}
+	iter := conn.Scan(ctx, 0, pattern, 1000).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to scan keys. pattern: %s, err: %s", pattern, err)
+	}
+	return keys, nil
+}
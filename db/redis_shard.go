@@ -0,0 +1,189 @@
+//go:build !noredis
+// +build !noredis
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+// number of virtual nodes per shard on the hash ring
+const ringReplicas = 160
+
+// hashRing assigns vendors to shards with consistent hashing,
+// so adding a shard only moves the vendors taken over by it.
+type hashRing struct {
+	hashes []uint32
+	shards map[uint32]int
+}
+
+// newHashRing places the shards identified by names on the ring
+func newHashRing(names []string) *hashRing {
+	ring := &hashRing{shards: map[uint32]int{}}
+	for i, name := range names {
+		for j := 0; j < ringReplicas; j++ {
+			h := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", name, j)))
+			ring.hashes = append(ring.hashes, h)
+			ring.shards[h] = i
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool { return ring.hashes[i] < ring.hashes[j] })
+	return ring
+}
+
+// get returns the index of the shard for the key
+func (ring *hashRing) get(key string) int {
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(ring.hashes), func(i int) bool { return ring.hashes[i] >= h })
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return ring.shards[ring.hashes[i]]
+}
+
+// splitShardURLs splits a multi-endpoint DSN, e.g. redis://host1:6379/0,redis://host2:6379/1
+func splitShardURLs(dbPath string) (urls []string) {
+	for _, u := range strings.Split(dbPath, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// shard returns the client holding the keys of the vendor.
+// Keys not tied to a vendor (vendor/product list, titles, FetchMeta) are on the first shard.
+func (r *RedisDriver) shard(vendor string) *redis.Client {
+	if len(r.shards) < 2 {
+		return r.conn
+	}
+	return r.shards[r.ring.get(vendor)]
+}
+
+// shardByCpeURI returns the client holding the keys of the vendor of cpeURI
+func (r *RedisDriver) shardByCpeURI(cpeURI string) *redis.Client {
+	if len(r.shards) < 2 {
+		return r.conn
+	}
+	wfn, err := naming.UnbindURI(cpeURI)
+	if err != nil {
+		return r.conn
+	}
+	return r.shard(wfn.GetString(common.AttributeVendor))
+}
+
+// searchCpeDetails finds the vendor/products matching the LIKE patterns, % for any characters and _ for one,
+// by SCAN on every shard in parallel, and reads their CPEs by r.threads workers
+func (r *RedisDriver) searchCpeDetails(vendor, product string) (*models.CpeDetails, error) {
+	ctx := context.Background()
+	pattern := hKeyPrefix + likeToGlob(vendor) + sep + likeToGlob(product)
+
+	type match struct {
+		conn *redis.Client
+		key  string
+	}
+	var (
+		mu      sync.Mutex
+		matches []match
+	)
+	errs := make(chan error, len(r.shards))
+	for _, conn := range r.shards {
+		go func(conn *redis.Client) {
+			keys, err := scanKeys(ctx, conn, pattern)
+			mu.Lock()
+			for _, key := range keys {
+				if isVendorProductKey(key) {
+					matches = append(matches, match{conn: conn, key: key})
+				}
+			}
+			mu.Unlock()
+			errs <- err
+		}(conn)
+	}
+	var scanErr error
+	for range r.shards {
+		if err := <-errs; err != nil && scanErr == nil {
+			scanErr = err
+		}
+	}
+	if scanErr != nil {
+		return nil, scanErr
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].key < matches[j].key })
+
+	results, readErrs := make([][]models.CategorizedCpe, len(matches)), make([]error, len(matches))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < r.threads && w < len(matches); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], readErrs[i] = r.cpesOfKey(ctx, matches[i].conn, matches[i].key)
+			}
+		}()
+	}
+	for i := range matches {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	merged := []models.CategorizedCpe{}
+	for i := range matches {
+		if readErrs[i] != nil {
+			return nil, readErrs[i]
+		}
+		merged = append(merged, results[i]...)
+	}
+	return cpeDetails(merged), nil
+}
+
+// likeToGlob converts a LIKE pattern of RDB into a glob pattern of SCAN, escaping the special characters of the glob.
+// A character escaped by LikeEscape matches itself.
+func likeToGlob(pattern string) string {
+	var b strings.Builder
+	escaped := false
+	for _, c := range pattern {
+		if !escaped && c == LikeEscape {
+			escaped = true
+			continue
+		}
+		if escaped {
+			escaped = false
+			if c == '%' || c == '_' || c == LikeEscape {
+				b.WriteRune(c)
+				continue
+			}
+		}
+		switch c {
+		case '%':
+			b.WriteByte('*')
+		case '_':
+			b.WriteByte('?')
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// isVendorProductKey tells the sorted set of the CPEs of a vendor/product from the other keys a glob may match,
+// e.g. dep#<CPE URI>, by the # of their prefixes, which a vendor has only quoted
+func isVendorProductKey(key string) bool {
+	vendor := strings.SplitN(strings.TrimPrefix(key, hKeyPrefix), sep, 2)[0]
+	return !strings.Contains(strings.ReplaceAll(vendor, `\#`, ""), "#")
+}
@@ -1,8 +1,15 @@
+//go:build !noredis
+// +build !noredis
+
 package db
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/go-redis/redis/v8"
@@ -47,6 +54,194 @@ func TestGetCpesByVendorProductRedis(t *testing.T) {
 	testGetCpesByVendorProduct(t, driver)
 }
 
+func TestGetVendorProductsByPopularityRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testGetVendorProductsByPopularity(t, driver)
+}
+
+func TestUpsertFetchMetaRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testUpsertFetchMeta(t, driver)
+}
+
+func TestFetchHistoryRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testFetchHistory(t, driver)
+}
+
+func TestAuditEntriesRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testAuditEntries(t, driver)
+}
+
+func TestWatchlistRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testWatchlist(t, driver)
+}
+
+func TestRejectedCpesRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testRejectedCpes(t, driver)
+}
+
+func TestGetProductsByVersionRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testGetProductsByVersion(t, driver)
+}
+
+func TestGetCpeDetailsByVendorProductRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testGetCpeDetailsByVendorProduct(t, driver)
+}
+
+func TestGetVersionsByVendorProductRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testGetVersionsByVendorProduct(t, driver)
+}
+
+func TestGetSourcedCpesByVendorProductRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testGetSourcedCpesByVendorProduct(t, driver)
+}
+
+func TestCountCpesRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testCountCpes(t, driver)
+}
+
+func TestGetAttributeStatsRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testGetAttributeStats(t, driver)
+}
+
+func TestGetCpeByNameIDRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testGetCpeByNameID(t, driver)
+}
+
+func TestGetCpesByDistroPackageRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testGetCpesByDistroPackage(t, driver)
+}
+
+func TestKnownExploitedRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testKnownExploited(t, driver)
+}
+
+func TestGetProductSummariesRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Errorf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+
+	testGetProductSummaries(t, driver)
+}
+
+func TestContractRedis(t *testing.T) {
+	t.Parallel()
+	testContract(t, func(t testing.TB) DB {
+		s, driver, err := setupRedis()
+		if err != nil {
+			t.Fatalf("Failed to parepare redis: %s", err)
+		}
+		t.Cleanup(func() { teardownRedis(s, driver) })
+		return driver
+	})
+}
+
 func TestRedisDriver_IsDeprecated(t *testing.T) {
 	t.Parallel()
 	s, driver, err := setupRedis()
@@ -101,3 +296,341 @@ func TestRedisDriver_IsDeprecated(t *testing.T) {
 		})
 	}
 }
+
+func setupShardedRedis(n int) ([]*miniredis.Miniredis, DB, error) {
+	ss := []*miniredis.Miniredis{}
+	urls := []string{}
+	for i := 0; i < n; i++ {
+		s, err := miniredis.Run()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to run miniredis: %s", err)
+		}
+		ss = append(ss, s)
+		urls = append(urls, "redis://"+s.Addr())
+	}
+	driver, _, err := NewDB("redis", strings.Join(urls, ","), false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to new db: %s", err)
+	}
+	return ss, driver, nil
+}
+
+func TestGetCpesByVendorProductShardedRedis(t *testing.T) {
+	t.Parallel()
+	ss, driver, err := setupShardedRedis(3)
+	if err != nil {
+		t.Fatalf("Failed to parepare redis: %s", err)
+	}
+	defer func() {
+		for _, s := range ss {
+			s.Close()
+		}
+		_ = driver.CloseDB()
+	}()
+
+	testGetCpesByVendorProduct(t, driver)
+
+	// vendors are spread over the shards
+	used := 0
+	for _, s := range ss {
+		if 0 < len(s.Keys()) {
+			used++
+		}
+	}
+	if used < 2 {
+		t.Errorf("actual %d shards used, expected at least 2", used)
+	}
+
+	deprecated, err := driver.IsDeprecated("cpe:/a:vendorName6:productName6:6.0::~~~targetSoftware6~targetHardware6~")
+	if err != nil {
+		t.Fatalf("IsDeprecated: %s", err)
+	}
+	if !deprecated {
+		t.Errorf("actual %t, expected %t", deprecated, true)
+	}
+}
+
+func TestGetCpesByVendorProductWildcardRedis(t *testing.T) {
+	t.Parallel()
+	for _, n := range []int{1, 3} {
+		ss, driver, err := setupShardedRedis(n)
+		if err != nil {
+			t.Fatalf("Failed to parepare redis: %s", err)
+		}
+		defer func() {
+			for _, s := range ss {
+				s.Close()
+			}
+			_ = driver.CloseDB()
+		}()
+		if err := prepareTestData(driver); err != nil {
+			t.Fatalf("Inserting CPEs: %s", err)
+		}
+
+		var tests = []struct {
+			vendor     string
+			product    string
+			expected   []string
+			deprecated []string
+		}{
+			{
+				vendor:  "vendor%",
+				product: "product%",
+				expected: []string{
+					"cpe:/a:vendorName1:productName1-1:1.1::~~~targetSoftware1~targetHardware1~",
+					"cpe:/a:vendorName1:productName1-2:1.2::~~~targetSoftware1~targetHardware1~",
+					"cpe:/a:vendorName2:productName2:2.0::~~~targetSoftware2~targetHardware2~",
+					"cpe:/a:vendorName3:productName3:3.0::~~~targetSoftware3~targetHardware3~",
+					"cpe:/a:vendorName4:productName4:4.0::~~~targetSoftware4~targetHardware4~",
+					"cpe:/a:vendorName5:productName5:5.0::~~~targetSoftware5~targetHardware5~",
+				},
+				deprecated: []string{"cpe:/a:vendorName6:productName6:6.0::~~~targetSoftware6~targetHardware6~"},
+			},
+			{
+				// the other keys of the vendor/product, e.g. of the versions, aren't matched
+				vendor:   "%",
+				product:  "productName2",
+				expected: []string{"cpe:/a:vendorName2:productName2:2.0::~~~targetSoftware2~targetHardware2~"},
+			},
+			{
+				vendor:   "vendorName_",
+				product:  `productName1\-%`,
+				expected: []string{"cpe:/a:vendorName1:productName1-1:1.1::~~~targetSoftware1~targetHardware1~", "cpe:/a:vendorName1:productName1-2:1.2::~~~targetSoftware1~targetHardware1~"},
+			},
+			{
+				vendor:  "nothing%",
+				product: "%",
+			},
+		}
+		for _, tt := range tests {
+			cpeURIs, deprecated, err := driver.GetCpesByVendorProduct(tt.vendor, tt.product)
+			if err != nil {
+				t.Fatalf("GetCpesByVendorProduct: %s", err)
+			}
+			sort.Strings(cpeURIs)
+			if len(cpeURIs) != len(tt.expected) || (0 < len(cpeURIs) && !reflect.DeepEqual(cpeURIs, tt.expected)) {
+				t.Errorf("%d shards, %s/%s: actual %#v, expected %#v", n, tt.vendor, tt.product, cpeURIs, tt.expected)
+			}
+			if len(deprecated) != len(tt.deprecated) || (0 < len(deprecated) && !reflect.DeepEqual(deprecated, tt.deprecated)) {
+				t.Errorf("%d shards, %s/%s: actual %#v, expected %#v", n, tt.vendor, tt.product, deprecated, tt.deprecated)
+			}
+		}
+	}
+}
+
+func TestLikeToGlob(t *testing.T) {
+	for like, expected := range map[string]string{
+		"cybozu":            "cybozu",
+		"office%":           "office*",
+		"linux_kernel":      "linux?kernel",
+		"linux!_kernel!!":   "linux_kernel!",
+		`productName1\-1*?`: `productName1\\-1\*\?`,
+	} {
+		if actual := likeToGlob(like); actual != expected {
+			t.Errorf("%s: actual %s, expected %s", like, actual, expected)
+		}
+	}
+}
+
+func TestHashRing(t *testing.T) {
+	names := []string{"redis://host1:6379/0", "redis://host1:6379/1", "redis://host2:6379/0"}
+	ring := newHashRing(names)
+
+	counts := make([]int, len(names))
+	moved := 0
+	grown := newHashRing(append(names, "redis://host3:6379/0"))
+	for i := 0; i < 3000; i++ {
+		vendor := fmt.Sprintf("vendor%d", i)
+		shard := ring.get(vendor)
+		if shard != ring.get(vendor) {
+			t.Fatalf("shard of %s is not stable", vendor)
+		}
+		counts[shard]++
+		if grown.get(vendor) != shard {
+			moved++
+		}
+	}
+	for i, c := range counts {
+		if c < 500 {
+			t.Errorf("shard %d has only %d of 3000 vendors", i, c)
+		}
+	}
+	// only the vendors taken over by the new shard move
+	if 1500 < moved {
+		t.Errorf("%d of 3000 vendors moved by adding a shard", moved)
+	}
+}
+
+func TestGCRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Fatalf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	// left by a vendor/product no longer listed
+	s.HSet(titleKey, "gone"+sep+"gone", "title")
+	if _, err := s.SetAdd(versionPrefix+"1.0", "gone"+sep+"gone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetAdd(sourcePrefix+"cpe:/a:gone:gone:1.0", "nvd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(deprecatedPrefix+"cpe:/a:gone:gone:1.0", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(deprecatedByPrefix+"cpe:/a:gone:gone:1.0", "cpe:/a:gone:gone:1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(nameIDPrefix+"cpe:/a:gone:gone:1.0", "00000000-0000-0000-0000-000000000000"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := driver.GC()
+	if err != nil {
+		t.Fatalf("GC: %s", err)
+	}
+	removed := map[string]int64{}
+	for _, stat := range stats {
+		removed[stat.Table] = stat.Rows
+	}
+	expected := map[string]int64{
+		titleKey:                           1,
+		versionPrefix + "*":                1,
+		hKeyPrefix + "<vendor>::<product>": 0,
+		sourcePrefix + "*":                 1,
+		deprecatedPrefix + "*":             1,
+		deprecatedByPrefix + "*":           1,
+		nameIDPrefix + "*":                 1,
+	}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Errorf("actual %#v, expected %#v", removed, expected)
+	}
+
+	deprecated, err := driver.IsDeprecated("cpe:/a:vendorName6:productName6:6.0::~~~targetSoftware6~targetHardware6~")
+	if err != nil {
+		t.Fatalf("IsDeprecated: %s", err)
+	}
+	if !deprecated {
+		t.Errorf("actual %t, expected %t", deprecated, true)
+	}
+}
+
+func TestCheckIntegrityRedis(t *testing.T) {
+	t.Parallel()
+	s, driver, err := setupRedis()
+	if err != nil {
+		t.Fatalf("Failed to parepare redis: %s", err)
+	}
+	defer teardownRedis(s, driver)
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	// left by the versions which stored CPEs without the vendor and malformed CPE URIs
+	if _, err := s.ZAdd(hKeyPrefix+"VendorProduct", 0, sep+"productName7"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ZAdd(hKeyPrefix+"vendorName2"+sep+"productName2", 0, "cpe-a-vendorName2"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := driver.CheckIntegrity(false)
+	if err != nil {
+		t.Fatalf("CheckIntegrity: %s", err)
+	}
+	kinds := []string{}
+	for _, i := range report.Issues {
+		kinds = append(kinds, i.Kind)
+	}
+	sort.Strings(kinds)
+	if expected := []string{IssueEmptyVendor, IssueMalformedURI}; !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("actual %#v, expected %#v", kinds, expected)
+	}
+
+	if report, err = driver.CheckIntegrity(true); err != nil {
+		t.Fatalf("CheckIntegrity: %s", err)
+	}
+	if report.Repaired != 2 {
+		t.Errorf("actual %d repaired, expected 2", report.Repaired)
+	}
+	if report, err = driver.CheckIntegrity(false); err != nil || len(report.Issues) != 0 {
+		t.Errorf("actual %#v, %v, expected no issues after repair", report, err)
+	}
+}
+
+func TestKeyTTLRedis(t *testing.T) {
+	t.Parallel()
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to run miniredis: %s", err)
+	}
+	driver, err := Open("redis", "redis://"+s.Addr(), WithKeyTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to new db: %s", err)
+	}
+	defer teardownRedis(s, driver)
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+
+	if ttl := s.TTL(hKeyPrefix + "ntp" + sep + "ntp"); ttl != time.Hour {
+		t.Errorf("actual TTL %s, expected 1h", ttl)
+	}
+	if ttl := s.TTL(hKeyPrefix + "VendorProduct"); ttl != 0 {
+		t.Errorf("actual TTL %s of the vendor/products, expected none", ttl)
+	}
+
+	s.FastForward(2 * time.Hour)
+	cpeURIs, deprecated, err := driver.GetCpesByVendorProduct("ntp", "ntp")
+	if err != nil {
+		t.Fatalf("GetCpesByVendorProduct: %s", err)
+	}
+	if len(cpeURIs)+len(deprecated) != 0 {
+		t.Errorf("actual %#v, %#v, expected expired", cpeURIs, deprecated)
+	}
+}
+
+func TestInfoValue(t *testing.T) {
+	info := "# Memory\r\nused_memory:1024\r\nmaxmemory:0\r\nmaxmemory_policy:allkeys-lru\r\n"
+	if v := infoValue(info, "maxmemory_policy"); v != "allkeys-lru" {
+		t.Errorf("actual %q", v)
+	}
+	if v := infoValue(info, "maxmemory_human"); v != "" {
+		t.Errorf("actual %q, expected missing", v)
+	}
+}
+
+func BenchmarkInsertCpesRedis(b *testing.B) {
+	s, driver, err := setupRedis()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer teardownRedis(s, driver)
+
+	benchInsertCpes(b, driver)
+}
+
+func BenchmarkGetVendorProductsRedis(b *testing.B) {
+	s, driver, err := setupRedis()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer teardownRedis(s, driver)
+
+	benchGetVendorProducts(b, driver)
+}
+
+func BenchmarkGetCpesByVendorProductRedis(b *testing.B) {
+	s, driver, err := setupRedis()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer teardownRedis(s, driver)
+
+	benchGetCpesByVendorProduct(b, driver)
+}
@@ -0,0 +1,545 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+// dialectTiered is the dbtype of TieredDriver
+const dialectTiered = "tiered"
+
+// cacheRetryInterval is how long TieredDriver reads only the store after the cache failed
+const cacheRetryInterval = 30 * time.Second
+
+func init() {
+	drivers[dialectTiered] = func() DB { return &TieredDriver{name: dialectTiered} }
+}
+
+// TieredDriver reads the cache (e.g. redis) first and falls back to the store (an RDB), the source of truth,
+// when the cache misses or fails. The writes go to the store, then to the cache.
+//
+// The cache is in sync when its FetchMeta is the same as the store's, i.e. all the fetches were written through.
+// Until then, only the CPEs of a vendor/product are read from the cache, and they are put in the cache on a miss.
+type TieredDriver struct {
+	name  string
+	cache DB
+	store DB
+	log   log15.Logger
+
+	mu        sync.Mutex
+	synced    bool
+	downUntil time.Time
+	// dirty is set when a write to the cache failed, so the cache is not in sync until it's rebuilt
+	dirty bool
+}
+
+// Name return db name
+func (t *TieredDriver) Name() string {
+	return t.name
+}
+
+// OpenDB fails without the cache, which is given by WithTiers of Open
+func (t *TieredDriver) OpenDB(dbType, dbPath string, debugSQL bool) (locked bool, err error) {
+	return t.openDB(dbType, dbPath, Option{DebugSQL: debugSQL})
+}
+
+// openDB opens option.Cache and option.Store. dbPath is used as the store when option.Store is empty.
+func (t *TieredDriver) openDB(dbType, dbPath string, option Option) (locked bool, err error) {
+	t.log = option.Logger
+	if t.log == nil {
+		t.log = log15.Root()
+	}
+	store := option.Store
+	if store == "" {
+		store = dbPath
+	}
+	if option.Cache == "" {
+		return false, fmt.Errorf("Failed to open tiered DB. The cache is not given")
+	}
+
+	if t.store, err = newDB(DetectType(store)); err != nil {
+		return false, err
+	}
+	// the store is the source of truth, never expiring
+	storeOption := option
+	storeOption.KeyTTL = 0
+	if locked, err = openDB(t.store, DetectType(store), store, storeOption); err != nil {
+		return locked, xerrors.Errorf("Failed to open the store. err: %w", err)
+	}
+	if t.cache, err = newDB(DetectType(option.Cache)); err != nil {
+		return false, err
+	}
+	if locked, err = openDB(t.cache, DetectType(option.Cache), option.Cache, option); err != nil {
+		_ = t.store.CloseDB()
+		return locked, xerrors.Errorf("Failed to open the cache. err: %w", err)
+	}
+	return false, nil
+}
+
+// CloseDB closes the cache and the store
+func (t *TieredDriver) CloseDB() error {
+	cacheErr := t.cache.CloseDB()
+	if err := t.store.CloseDB(); err != nil {
+		return err
+	}
+	return cacheErr
+}
+
+// MigrateDB migrates the cache and the store, and checks whether the cache is in sync
+func (t *TieredDriver) MigrateDB() error {
+	if err := t.store.MigrateDB(); err != nil {
+		return xerrors.Errorf("Failed to migrate the store. err: %w", err)
+	}
+	if err := t.cache.MigrateDB(); err != nil {
+		return xerrors.Errorf("Failed to migrate the cache. err: %w", err)
+	}
+	t.checkSync()
+	return nil
+}
+
+// checkSync compares the FetchMeta of the cache and the store
+func (t *TieredDriver) checkSync() {
+	stored, err := t.store.GetFetchMeta()
+	if err != nil {
+		t.log.Warn("Failed to get FetchMeta of the store.", "err", err)
+		return
+	}
+	cached, err := t.cache.GetFetchMeta()
+	if err != nil {
+		t.cacheFailed("GetFetchMeta", err)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.synced = !t.dirty && fetched(stored) && stored.LastFetchedAt.Equal(cached.LastFetchedAt)
+	if !t.synced {
+		t.log.Info("The cache is not in sync with the store. Reading the CPE lists from the store", "store", stored.LastFetchedAt, "cache", cached.LastFetchedAt)
+	}
+}
+
+// cacheUp tells whether the cache is worth trying
+func (t *TieredDriver) cacheUp() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Now().After(t.downUntil)
+}
+
+// cacheSynced tells whether the cache is in sync and up
+func (t *TieredDriver) cacheSynced() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.synced && time.Now().After(t.downUntil)
+}
+
+// cacheAnswers tells whether the cache is worth trying for vendor/product. A LIKE wildcard matches the vendor/products
+// the misses haven't put into the cache yet, so it's read from the cache only while the cache is in sync.
+func (t *TieredDriver) cacheAnswers(vendor, product string) bool {
+	if HasLikeWildcard(vendor) || HasLikeWildcard(product) {
+		return t.cacheSynced()
+	}
+	return t.cacheUp()
+}
+
+// cacheFailed stops reading the cache for cacheRetryInterval
+func (t *TieredDriver) cacheFailed(op string, err error) {
+	t.log.Warn("Failed to access the cache. Falling back to the store", "op", op, "retry in", cacheRetryInterval, "err", err)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.downUntil = time.Now().Add(cacheRetryInterval)
+}
+
+// cacheWriteFailed marks the cache out of sync
+func (t *TieredDriver) cacheWriteFailed(op string, err error) {
+	t.cacheFailed(op, err)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dirty = true
+	t.synced = false
+}
+
+// flushCache takes the cache out of sync, so that the listings are read from the store until a fetch is written through.
+// The CPEs of the vendor/products in the cache are still read, and refreshed as they expire by KeyTTL.
+func (t *TieredDriver) flushCache() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.synced, t.downUntil = false, time.Time{}
+	t.log.Info("Flushed the cache. Reading the CPE lists from the store")
+}
+
+// GetFetchMeta returns the FetchMeta of the store
+func (t *TieredDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	return t.store.GetFetchMeta()
+}
+
+// UpsertFetchMeta upserts the FetchMeta of the store, and of the cache unless a write to it failed
+func (t *TieredDriver) UpsertFetchMeta(fetchMeta *models.FetchMeta) error {
+	if err := t.store.UpsertFetchMeta(fetchMeta); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	dirty := t.dirty
+	t.mu.Unlock()
+	if !dirty {
+		if err := t.cache.UpsertFetchMeta(fetchMeta); err != nil {
+			t.cacheWriteFailed("UpsertFetchMeta", err)
+		}
+	}
+	t.checkSync()
+	return nil
+}
+
+// InsertFetchHistory inserts the history into the store
+func (t *TieredDriver) InsertFetchHistory(history *models.FetchHistory) error {
+	return t.store.InsertFetchHistory(history)
+}
+
+// GetLatestFetchHistories returns the histories of the store
+func (t *TieredDriver) GetLatestFetchHistories() ([]models.FetchHistory, error) {
+	return t.store.GetLatestFetchHistories()
+}
+
+// InsertAuditEntry inserts the entry into the store
+func (t *TieredDriver) InsertAuditEntry(entry *models.AuditEntry) error {
+	return t.store.InsertAuditEntry(entry)
+}
+
+// GetAuditEntries returns the entries of the store
+func (t *TieredDriver) GetAuditEntries(since time.Time) ([]models.AuditEntry, error) {
+	return t.store.GetAuditEntries(since)
+}
+
+// GetWatchlist returns the watchlist of the store
+func (t *TieredDriver) GetWatchlist() ([]models.WatchedProduct, error) {
+	return t.store.GetWatchlist()
+}
+
+// UpsertWatchedProduct upserts the watched product of the store
+func (t *TieredDriver) UpsertWatchedProduct(watched *models.WatchedProduct) error {
+	return t.store.UpsertWatchedProduct(watched)
+}
+
+// DeleteWatchedProduct deletes the watched product of the store
+func (t *TieredDriver) DeleteWatchedProduct(vendor, product string) (bool, error) {
+	return t.store.DeleteWatchedProduct(vendor, product)
+}
+
+// InsertWatchChanges inserts the changes into the store
+func (t *TieredDriver) InsertWatchChanges(changes []models.WatchChange) error {
+	return t.store.InsertWatchChanges(changes)
+}
+
+// GetWatchChanges returns the changes of the store
+func (t *TieredDriver) GetWatchChanges(since time.Time) ([]models.WatchChange, error) {
+	return t.store.GetWatchChanges(since)
+}
+
+// GetVendorProducts : GetVendorProducts
+func (t *TieredDriver) GetVendorProducts() ([]string, error) {
+	if t.cacheSynced() {
+		vendorProducts, err := t.cache.GetVendorProducts()
+		if err == nil {
+			return vendorProducts, nil
+		}
+		t.cacheFailed("GetVendorProducts", err)
+	}
+	return t.store.GetVendorProducts()
+}
+
+// GetVendorProductsByPopularity : GetVendorProductsByPopularity
+func (t *TieredDriver) GetVendorProductsByPopularity() ([]string, error) {
+	if t.cacheSynced() {
+		vendorProducts, err := t.cache.GetVendorProductsByPopularity()
+		if err == nil {
+			return vendorProducts, nil
+		}
+		t.cacheFailed("GetVendorProductsByPopularity", err)
+	}
+	return t.store.GetVendorProductsByPopularity()
+}
+
+// GetVendorProductTitles : GetVendorProductTitles
+func (t *TieredDriver) GetVendorProductTitles() (map[string]string, error) {
+	if t.cacheSynced() {
+		titles, err := t.cache.GetVendorProductTitles()
+		if err == nil {
+			return titles, nil
+		}
+		t.cacheFailed("GetVendorProductTitles", err)
+	}
+	return t.store.GetVendorProductTitles()
+}
+
+// GetProductSummaries : GetProductSummaries
+func (t *TieredDriver) GetProductSummaries() ([]models.ProductSummary, error) {
+	if t.cacheSynced() {
+		summaries, err := t.cache.GetProductSummaries()
+		if err == nil {
+			return summaries, nil
+		}
+		t.cacheFailed("GetProductSummaries", err)
+	}
+	return t.store.GetProductSummaries()
+}
+
+// GetCpesByVendorProduct reads the cache, and the store on a miss, putting the CPEs in the cache
+func (t *TieredDriver) GetCpesByVendorProduct(vendor, product string) ([]string, []string, error) {
+	if t.cacheAnswers(vendor, product) {
+		cpeURIs, deprecated, err := t.cache.GetCpesByVendorProduct(vendor, product)
+		if err == nil && (0 < len(cpeURIs) || 0 < len(deprecated)) {
+			return cpeURIs, deprecated, nil
+		}
+		if err != nil {
+			t.cacheFailed("GetCpesByVendorProduct", err)
+		}
+	}
+
+	cpeURIs, deprecated, err := t.store.GetCpesByVendorProduct(vendor, product)
+	if err != nil {
+		return nil, nil, err
+	}
+	if 0 < len(cpeURIs)+len(deprecated) {
+		t.populate(vendor, product)
+	}
+	return cpeURIs, deprecated, nil
+}
+
+// GetCpeDetailsByVendorProduct reads the cache, and the store on a miss, putting the CPEs in the cache
+func (t *TieredDriver) GetCpeDetailsByVendorProduct(vendor, product string) (*models.CpeDetails, error) {
+	if t.cacheAnswers(vendor, product) {
+		details, err := t.cache.GetCpeDetailsByVendorProduct(vendor, product)
+		if err == nil && 0 < len(details.Active)+len(details.Deprecated) {
+			return details, nil
+		}
+		if err != nil {
+			t.cacheFailed("GetCpeDetailsByVendorProduct", err)
+		}
+	}
+
+	details, err := t.store.GetCpeDetailsByVendorProduct(vendor, product)
+	if err != nil {
+		return nil, err
+	}
+	if 0 < len(details.Active)+len(details.Deprecated) {
+		t.populate(vendor, product)
+	}
+	return details, nil
+}
+
+// GetSourcedCpesByVendorProduct reads the cache, and the store on a miss, putting the CPEs in the cache
+func (t *TieredDriver) GetSourcedCpesByVendorProduct(vendor, product string, sources []models.FetchType) ([]models.SourcedCpe, error) {
+	if t.cacheAnswers(vendor, product) {
+		cpes, err := t.cache.GetSourcedCpesByVendorProduct(vendor, product, sources)
+		if err == nil && 0 < len(cpes) {
+			return cpes, nil
+		}
+		if err != nil {
+			t.cacheFailed("GetSourcedCpesByVendorProduct", err)
+		}
+	}
+
+	cpes, err := t.store.GetSourcedCpesByVendorProduct(vendor, product, sources)
+	if err != nil {
+		return nil, err
+	}
+	if 0 < len(cpes) {
+		t.populate(vendor, product)
+	}
+	return cpes, nil
+}
+
+// populate puts the CPEs of vendor/product in the store into the cache.
+// A failure is only logged, since the CPEs are read from the store anyway.
+func (t *TieredDriver) populate(vendor, product string) {
+	if !t.cacheUp() {
+		return
+	}
+	sourced, err := t.store.GetSourcedCpesByVendorProduct(vendor, product, nil)
+	if err != nil {
+		t.log.Warn("Failed to get CPEs to cache.", "vendor", vendor, "product", product, "err", err)
+		return
+	}
+	if err := t.cache.InsertCpes(splitSources(sourced)); err != nil {
+		t.cacheFailed("InsertCpes", err)
+	}
+}
+
+// GetProductsByVersion : GetProductsByVersion
+func (t *TieredDriver) GetProductsByVersion(version string) ([]string, error) {
+	if t.cacheSynced() {
+		vendorProducts, err := t.cache.GetProductsByVersion(version)
+		if err == nil {
+			return vendorProducts, nil
+		}
+		t.cacheFailed("GetProductsByVersion", err)
+	}
+	return t.store.GetProductsByVersion(version)
+}
+
+// GetVersionsByVendorProduct : GetVersionsByVendorProduct
+func (t *TieredDriver) GetVersionsByVendorProduct(vendor, product, from, to string) ([]string, error) {
+	if t.cacheSynced() {
+		versions, err := t.cache.GetVersionsByVendorProduct(vendor, product, from, to)
+		if err == nil {
+			return versions, nil
+		}
+		t.cacheFailed("GetVersionsByVendorProduct", err)
+	}
+	return t.store.GetVersionsByVendorProduct(vendor, product, from, to)
+}
+
+// CountCpes : CountCpes
+func (t *TieredDriver) CountCpes(fetchType models.FetchType) (int, error) {
+	if t.cacheSynced() {
+		count, err := t.cache.CountCpes(fetchType)
+		if err == nil {
+			return count, nil
+		}
+		t.cacheFailed("CountCpes", err)
+	}
+	return t.store.CountCpes(fetchType)
+}
+
+// GetAttributeStats : GetAttributeStats
+func (t *TieredDriver) GetAttributeStats(attributes []string, top int) ([]models.AttributeStat, error) {
+	if t.cacheSynced() {
+		stats, err := t.cache.GetAttributeStats(attributes, top)
+		if err == nil {
+			return stats, nil
+		}
+		t.cacheFailed("GetAttributeStats", err)
+	}
+	return t.store.GetAttributeStats(attributes, top)
+}
+
+// GetCpesChangedSince returns the CPEs changed in the store
+func (t *TieredDriver) GetCpesChangedSince(generation uint64, since time.Time) ([]models.CategorizedCpe, error) {
+	return t.store.GetCpesChangedSince(generation, since)
+}
+
+// GetVendorProductsAsOf returns the vendor/products of the store at asOf
+func (t *TieredDriver) GetVendorProductsAsOf(asOf time.Time) ([]string, error) {
+	return t.store.GetVendorProductsAsOf(asOf)
+}
+
+// GetCpeDetailsAsOf returns the CPEs of the store at asOf
+func (t *TieredDriver) GetCpeDetailsAsOf(vendor, product string, asOf time.Time) (*models.CpeDetails, error) {
+	return t.store.GetCpeDetailsAsOf(vendor, product, asOf)
+}
+
+// InsertCpes inserts the CPEs into the store, then into the cache
+func (t *TieredDriver) InsertCpes(cpes []models.CategorizedCpe) error {
+	if err := t.store.InsertCpes(cpes); err != nil {
+		return err
+	}
+	if err := t.cache.InsertCpes(cpes); err != nil {
+		t.cacheWriteFailed("InsertCpes", err)
+	}
+	return nil
+}
+
+// ReplaceCpes replaces the CPEs of the store, then inserts them into the cache, which keeps the CPEs removed from the store
+// until they expire by KeyTTL
+func (t *TieredDriver) ReplaceCpes(source models.FetchType, cpes []models.CategorizedCpe) error {
+	if err := t.store.ReplaceCpes(source, cpes); err != nil {
+		return err
+	}
+	if err := t.cache.ReplaceCpes(source, cpes); err != nil {
+		t.cacheWriteFailed("ReplaceCpes", err)
+	}
+	return nil
+}
+
+// IsDeprecated : IsDeprecated
+func (t *TieredDriver) IsDeprecated(cpeURI string) (bool, error) {
+	if t.cacheSynced() {
+		deprecated, err := t.cache.IsDeprecated(cpeURI)
+		if err == nil {
+			return deprecated, nil
+		}
+		t.cacheFailed("IsDeprecated", err)
+	}
+	return t.store.IsDeprecated(cpeURI)
+}
+
+// GetCpeByNameID : GetCpeByNameID
+func (t *TieredDriver) GetCpeByNameID(id string) (*models.SourcedCpe, error) {
+	if t.cacheSynced() {
+		cpe, err := t.cache.GetCpeByNameID(id)
+		if err == nil {
+			return cpe, nil
+		}
+		t.cacheFailed("GetCpeByNameID", err)
+	}
+	return t.store.GetCpeByNameID(id)
+}
+
+// ReplaceRejectedCpes replaces the rejected CPEs of the store
+func (t *TieredDriver) ReplaceRejectedCpes(source models.FetchType, rejects []models.RejectedCpe) error {
+	return t.store.ReplaceRejectedCpes(source, rejects)
+}
+
+// GetRejectedCpes returns the rejected CPEs of the store
+func (t *TieredDriver) GetRejectedCpes(source models.FetchType) ([]models.RejectedCpe, error) {
+	return t.store.GetRejectedCpes(source)
+}
+
+// InsertDistroPackages replaces the mapping of the store
+func (t *TieredDriver) InsertDistroPackages(packages []models.DistroPackage) error {
+	return t.store.InsertDistroPackages(packages)
+}
+
+// GetDistroPackages returns the mapping of the store
+func (t *TieredDriver) GetDistroPackages(distro, pkg string) ([]models.DistroPackage, error) {
+	return t.store.GetDistroPackages(distro, pkg)
+}
+
+// GetCpesByDistroPackage maps the package with the store, and reads the CPEs through the cache
+func (t *TieredDriver) GetCpesByDistroPackage(distro, pkg string) ([]string, []string, error) {
+	return cpesByDistroPackage(t, distro, pkg)
+}
+
+// ReplaceKnownExploited replaces the known exploited vendor/products of the store
+func (t *TieredDriver) ReplaceKnownExploited(products []models.KnownExploitedProduct) error {
+	return t.store.ReplaceKnownExploited(products)
+}
+
+// GetKnownExploited returns the known exploited vendor/products of the store
+func (t *TieredDriver) GetKnownExploited() ([]models.KnownExploitedProduct, error) {
+	return t.store.GetKnownExploited()
+}
+
+// GC collects the garbage of the store and the cache
+func (t *TieredDriver) GC() ([]GCStat, error) {
+	stats, err := t.store.GC()
+	if err != nil {
+		return nil, err
+	}
+	cached, err := t.cache.GC()
+	if err != nil {
+		t.cacheFailed("GC", err)
+		return stats, nil
+	}
+	return append(stats, cached...), nil
+}
+
+// CheckIntegrity checks the store and the cache
+func (t *TieredDriver) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	report, err := t.store.CheckIntegrity(repair)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := t.cache.CheckIntegrity(repair)
+	if err != nil {
+		t.cacheFailed("CheckIntegrity", err)
+		return report, nil
+	}
+	report.Issues = append(report.Issues, cached.Issues...)
+	report.Repaired += cached.Repaired
+	return report, nil
+}
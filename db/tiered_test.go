@@ -0,0 +1,117 @@
+//go:build !nosqlite && !noredis
+// +build !nosqlite,!noredis
+
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func setupTiered(t *testing.T) (*miniredis.Miniredis, DB, *TieredDriver) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to run miniredis: %s", err)
+	}
+	driver, err := Open("tiered", "", WithTiers("redis://"+s.Addr(), filepath.Join(t.TempDir(), "cpe.sqlite3")))
+	if err != nil {
+		t.Fatalf("Failed to open tiered db: %s", err)
+	}
+	return s, driver, driver.(tracedDriver).DB.(*TieredDriver)
+}
+
+func TestGetCpesByVendorProductTiered(t *testing.T) {
+	s, driver, _ := setupTiered(t)
+	defer teardownRedis(s, driver)
+
+	testGetCpesByVendorProduct(t, driver)
+}
+
+func TestGetSourcedCpesByVendorProductTiered(t *testing.T) {
+	s, driver, _ := setupTiered(t)
+	defer teardownRedis(s, driver)
+
+	testGetSourcedCpesByVendorProduct(t, driver)
+}
+
+func TestTieredSync(t *testing.T) {
+	s, driver, tiered := setupTiered(t)
+	defer teardownRedis(s, driver)
+	if tiered.cacheSynced() {
+		t.Errorf("the cache is in sync before any fetch")
+	}
+	if err := prepareTestData(driver); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+	if tiered.cacheSynced() {
+		t.Errorf("the cache is in sync before the fetch is finished")
+	}
+
+	if err := driver.UpsertFetchMeta(&models.FetchMeta{SchemaVersion: models.LatestSchemaVersion, LastFetchedAt: time.Now().Truncate(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if !tiered.cacheSynced() {
+		t.Errorf("the cache is not in sync after the fetch is written through")
+	}
+
+	// the CPE lists are read from the store while the cache is down
+	s.Close()
+	vendorProducts, err := driver.GetVendorProducts()
+	if err != nil {
+		t.Fatalf("GetVendorProducts: %s", err)
+	}
+	if len(vendorProducts) != 9 {
+		t.Errorf("actual %#v, expected 9 vendor/products", vendorProducts)
+	}
+	if tiered.cacheUp() {
+		t.Errorf("the cache is read after it failed")
+	}
+}
+
+func TestTieredPopulate(t *testing.T) {
+	s, driver, tiered := setupTiered(t)
+	defer teardownRedis(s, driver)
+
+	// CPEs fetched without the cache
+	if err := prepareTestData(tiered.store); err != nil {
+		t.Fatalf("Inserting CPEs: %s", err)
+	}
+	if cpeURIs, _, err := tiered.cache.GetCpesByVendorProduct("ntp", "ntp"); err != nil || len(cpeURIs) != 0 {
+		t.Fatalf("actual %#v, %v, expected the cache is empty", cpeURIs, err)
+	}
+
+	expected := []string{"cpe:/a:ntp:ntp:4.2.5p48", "cpe:/a:ntp:ntp:4.2.8:p1-beta1"}
+	cpeURIs, _, err := driver.GetCpesByVendorProduct("ntp", "ntp")
+	if err != nil {
+		t.Fatalf("GetCpesByVendorProduct: %s", err)
+	}
+	if !reflect.DeepEqual(cpeURIs, expected) {
+		t.Errorf("actual %#v, expected %#v", cpeURIs, expected)
+	}
+
+	// the miss put the CPEs in the cache
+	if cpeURIs, _, err = tiered.cache.GetCpesByVendorProduct("ntp", "ntp"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cpeURIs, expected) {
+		t.Errorf("actual %#v, expected %#v in the cache", cpeURIs, expected)
+	}
+
+	// a wildcard matches the vendor/products not in the cache yet
+	storeURIs, storeDeprecated, err := tiered.store.GetCpesByVendorProduct("%", "%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpeURIs, deprecated, err := driver.GetCpesByVendorProduct("%", "%")
+	if err != nil {
+		t.Fatalf("GetCpesByVendorProduct: %s", err)
+	}
+	if !reflect.DeepEqual(cpeURIs, storeURIs) || !reflect.DeepEqual(deprecated, storeDeprecated) {
+		t.Errorf("actual %#v %#v, expected %#v %#v of the store", cpeURIs, deprecated, storeURIs, storeDeprecated)
+	}
+}
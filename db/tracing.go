@@ -0,0 +1,319 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/kotakanbe/go-cpe-dictionary/db")
+
+// tracedDriver records a span for each query to the underlying driver
+type tracedDriver struct {
+	DB
+	// ctx is the parent of the spans. Nil starts a new trace for each query.
+	ctx context.Context
+}
+
+// WithContext returns driver recording the spans of its queries as children of the span in ctx,
+// e.g. that of the HTTP request. The drivers not traced are returned as they are.
+func WithContext(ctx context.Context, driver DB) DB {
+	switch d := driver.(type) {
+	case tracedDriver:
+		d.ctx = ctx
+		return d
+	case interface{ WithContext(context.Context) DB }:
+		return d.WithContext(ctx)
+	}
+	return driver
+}
+
+func (t tracedDriver) start(name string, attrs ...attribute.KeyValue) trace.Span {
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(append(attrs, semconv.DBSystemKey.String(t.Name()))...)
+	return span
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t tracedDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	span := t.start("GetFetchMeta")
+	fetchMeta, err := t.DB.GetFetchMeta()
+	end(span, err)
+	return fetchMeta, err
+}
+
+func (t tracedDriver) UpsertFetchMeta(fetchMeta *models.FetchMeta) error {
+	span := t.start("UpsertFetchMeta")
+	err := t.DB.UpsertFetchMeta(fetchMeta)
+	end(span, err)
+	return err
+}
+
+func (t tracedDriver) InsertFetchHistory(history *models.FetchHistory) error {
+	span := t.start("InsertFetchHistory")
+	err := t.DB.InsertFetchHistory(history)
+	end(span, err)
+	return err
+}
+
+func (t tracedDriver) GetLatestFetchHistories() ([]models.FetchHistory, error) {
+	span := t.start("GetLatestFetchHistories")
+	histories, err := t.DB.GetLatestFetchHistories()
+	end(span, err)
+	return histories, err
+}
+
+func (t tracedDriver) InsertAuditEntry(entry *models.AuditEntry) error {
+	span := t.start("InsertAuditEntry", attribute.String("operation", entry.Operation))
+	err := t.DB.InsertAuditEntry(entry)
+	end(span, err)
+	return err
+}
+
+func (t tracedDriver) GetAuditEntries(since time.Time) ([]models.AuditEntry, error) {
+	span := t.start("GetAuditEntries")
+	entries, err := t.DB.GetAuditEntries(since)
+	end(span, err)
+	return entries, err
+}
+
+func (t tracedDriver) GetWatchlist() ([]models.WatchedProduct, error) {
+	span := t.start("GetWatchlist")
+	watchlist, err := t.DB.GetWatchlist()
+	end(span, err)
+	return watchlist, err
+}
+
+func (t tracedDriver) UpsertWatchedProduct(watched *models.WatchedProduct) error {
+	span := t.start("UpsertWatchedProduct")
+	err := t.DB.UpsertWatchedProduct(watched)
+	end(span, err)
+	return err
+}
+
+func (t tracedDriver) DeleteWatchedProduct(vendor, product string) (bool, error) {
+	span := t.start("DeleteWatchedProduct")
+	deleted, err := t.DB.DeleteWatchedProduct(vendor, product)
+	end(span, err)
+	return deleted, err
+}
+
+func (t tracedDriver) InsertWatchChanges(changes []models.WatchChange) error {
+	span := t.start("InsertWatchChanges")
+	err := t.DB.InsertWatchChanges(changes)
+	end(span, err)
+	return err
+}
+
+func (t tracedDriver) GetWatchChanges(since time.Time) ([]models.WatchChange, error) {
+	span := t.start("GetWatchChanges")
+	changes, err := t.DB.GetWatchChanges(since)
+	end(span, err)
+	return changes, err
+}
+
+func (t tracedDriver) ReplaceRejectedCpes(source models.FetchType, rejects []models.RejectedCpe) error {
+	span := t.start("ReplaceRejectedCpes", attribute.String("fetchType", string(source)), attribute.Int("rejects", len(rejects)))
+	err := t.DB.ReplaceRejectedCpes(source, rejects)
+	end(span, err)
+	return err
+}
+
+func (t tracedDriver) GetRejectedCpes(source models.FetchType) ([]models.RejectedCpe, error) {
+	span := t.start("GetRejectedCpes", attribute.String("fetchType", string(source)))
+	rejects, err := t.DB.GetRejectedCpes(source)
+	end(span, err)
+	return rejects, err
+}
+
+func (t tracedDriver) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	span := t.start("CheckIntegrity")
+	report, err := t.DB.CheckIntegrity(repair)
+	end(span, err)
+	return report, err
+}
+
+func (t tracedDriver) GetVendorProducts() ([]string, error) {
+	span := t.start("GetVendorProducts")
+	vendorProducts, err := t.DB.GetVendorProducts()
+	end(span, err)
+	return vendorProducts, err
+}
+
+func (t tracedDriver) GetVendorProductsByPopularity() ([]string, error) {
+	span := t.start("GetVendorProductsByPopularity")
+	vendorProducts, err := t.DB.GetVendorProductsByPopularity()
+	end(span, err)
+	return vendorProducts, err
+}
+
+func (t tracedDriver) GetVendorProductTitles() (map[string]string, error) {
+	span := t.start("GetVendorProductTitles")
+	titles, err := t.DB.GetVendorProductTitles()
+	end(span, err)
+	return titles, err
+}
+
+func (t tracedDriver) GetSourcedCpesByVendorProduct(vendor, product string, sources []models.FetchType) ([]models.SourcedCpe, error) {
+	span := t.start("GetSourcedCpesByVendorProduct", attribute.String("vendor", vendor), attribute.String("product", product))
+	cpes, err := t.DB.GetSourcedCpesByVendorProduct(vendor, product, sources)
+	end(span, err)
+	return cpes, err
+}
+
+func (t tracedDriver) GetProductsByVersion(version string) ([]string, error) {
+	span := t.start("GetProductsByVersion", attribute.String("version", version))
+	vendorProducts, err := t.DB.GetProductsByVersion(version)
+	end(span, err)
+	return vendorProducts, err
+}
+
+func (t tracedDriver) GetVersionsByVendorProduct(vendor, product, from, to string) ([]string, error) {
+	span := t.start("GetVersionsByVendorProduct", attribute.String("vendor", vendor), attribute.String("product", product), attribute.String("from", from), attribute.String("to", to))
+	versions, err := t.DB.GetVersionsByVendorProduct(vendor, product, from, to)
+	end(span, err)
+	return versions, err
+}
+
+func (t tracedDriver) GetCpesByVendorProduct(vendor, product string) ([]string, []string, error) {
+	span := t.start("GetCpesByVendorProduct", attribute.String("vendor", vendor), attribute.String("product", product))
+	cpeURIs, deprecated, err := t.DB.GetCpesByVendorProduct(vendor, product)
+	end(span, err)
+	return cpeURIs, deprecated, err
+}
+
+func (t tracedDriver) GetCpeDetailsByVendorProduct(vendor, product string) (*models.CpeDetails, error) {
+	span := t.start("GetCpeDetailsByVendorProduct", attribute.String("vendor", vendor), attribute.String("product", product))
+	details, err := t.DB.GetCpeDetailsByVendorProduct(vendor, product)
+	end(span, err)
+	return details, err
+}
+
+func (t tracedDriver) CountCpes(fetchType models.FetchType) (int, error) {
+	span := t.start("CountCpes", attribute.String("fetchType", string(fetchType)))
+	count, err := t.DB.CountCpes(fetchType)
+	end(span, err)
+	return count, err
+}
+
+func (t tracedDriver) GetProductSummaries() ([]models.ProductSummary, error) {
+	span := t.start("GetProductSummaries")
+	summaries, err := t.DB.GetProductSummaries()
+	end(span, err)
+	return summaries, err
+}
+
+func (t tracedDriver) GetAttributeStats(attributes []string, top int) ([]models.AttributeStat, error) {
+	span := t.start("GetAttributeStats", attribute.StringSlice("attributes", attributes))
+	stats, err := t.DB.GetAttributeStats(attributes, top)
+	end(span, err)
+	return stats, err
+}
+
+func (t tracedDriver) GetCpesChangedSince(generation uint64, since time.Time) ([]models.CategorizedCpe, error) {
+	span := t.start("GetCpesChangedSince", attribute.Int64("generation", int64(generation)))
+	cpes, err := t.DB.GetCpesChangedSince(generation, since)
+	end(span, err)
+	return cpes, err
+}
+
+func (t tracedDriver) GetVendorProductsAsOf(asOf time.Time) ([]string, error) {
+	span := t.start("GetVendorProductsAsOf", attribute.String("asOf", asOf.Format(time.RFC3339)))
+	vendorProducts, err := t.DB.GetVendorProductsAsOf(asOf)
+	end(span, err)
+	return vendorProducts, err
+}
+
+func (t tracedDriver) GetCpeDetailsAsOf(vendor, product string, asOf time.Time) (*models.CpeDetails, error) {
+	span := t.start("GetCpeDetailsAsOf", attribute.String("vendor", vendor), attribute.String("product", product), attribute.String("asOf", asOf.Format(time.RFC3339)))
+	details, err := t.DB.GetCpeDetailsAsOf(vendor, product, asOf)
+	end(span, err)
+	return details, err
+}
+
+func (t tracedDriver) InsertCpes(cpes []models.CategorizedCpe) error {
+	span := t.start("InsertCpes", attribute.Int("cpes", len(cpes)))
+	err := t.DB.InsertCpes(cpes)
+	end(span, err)
+	return err
+}
+
+func (t tracedDriver) ReplaceCpes(source models.FetchType, cpes []models.CategorizedCpe) error {
+	span := t.start("ReplaceCpes", attribute.String("fetchType", string(source)), attribute.Int("cpes", len(cpes)))
+	err := t.DB.ReplaceCpes(source, cpes)
+	end(span, err)
+	return err
+}
+
+func (t tracedDriver) IsDeprecated(cpeURI string) (bool, error) {
+	span := t.start("IsDeprecated", attribute.String("cpeURI", cpeURI))
+	deprecated, err := t.DB.IsDeprecated(cpeURI)
+	end(span, err)
+	return deprecated, err
+}
+
+func (t tracedDriver) GetCpeByNameID(id string) (*models.SourcedCpe, error) {
+	span := t.start("GetCpeByNameID", attribute.String("cpeNameId", id))
+	cpe, err := t.DB.GetCpeByNameID(id)
+	end(span, err)
+	return cpe, err
+}
+
+func (t tracedDriver) InsertDistroPackages(packages []models.DistroPackage) error {
+	span := t.start("InsertDistroPackages", attribute.Int("packages", len(packages)))
+	err := t.DB.InsertDistroPackages(packages)
+	end(span, err)
+	return err
+}
+
+func (t tracedDriver) GetDistroPackages(distro, pkg string) ([]models.DistroPackage, error) {
+	span := t.start("GetDistroPackages", attribute.String("distro", distro), attribute.String("package", pkg))
+	packages, err := t.DB.GetDistroPackages(distro, pkg)
+	end(span, err)
+	return packages, err
+}
+
+func (t tracedDriver) GetCpesByDistroPackage(distro, pkg string) ([]string, []string, error) {
+	span := t.start("GetCpesByDistroPackage", attribute.String("distro", distro), attribute.String("package", pkg))
+	cpeURIs, deprecated, err := t.DB.GetCpesByDistroPackage(distro, pkg)
+	end(span, err)
+	return cpeURIs, deprecated, err
+}
+
+func (t tracedDriver) ReplaceKnownExploited(products []models.KnownExploitedProduct) error {
+	span := t.start("ReplaceKnownExploited", attribute.Int("products", len(products)))
+	err := t.DB.ReplaceKnownExploited(products)
+	end(span, err)
+	return err
+}
+
+func (t tracedDriver) GetKnownExploited() ([]models.KnownExploitedProduct, error) {
+	span := t.start("GetKnownExploited")
+	products, err := t.DB.GetKnownExploited()
+	end(span, err)
+	return products, err
+}
+
+func (t tracedDriver) GC() ([]GCStat, error) {
+	span := t.start("GC")
+	stats, err := t.DB.GC()
+	end(span, err)
+	return stats, err
+}
@@ -0,0 +1,23 @@
+package db
+
+import (
+	"fmt"
+)
+
+// pathValidators check the shape of dbPath of each dialect without connecting, registered by the file of each dialect
+var pathValidators = map[string]func(dbPath string) error{}
+
+// ValidatePath checks dbPath is of the shape dbType takes, so that a typo is told before connecting.
+// The error tells the expected shape.
+func ValidatePath(dbType, dbPath string) error {
+	if _, err := newDB(dbType); err != nil {
+		return err
+	}
+	if dbPath == "" {
+		return fmt.Errorf("The dbpath of %s is empty", dbType)
+	}
+	if validate, ok := pathValidators[dbType]; ok {
+		return validate(dbPath)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+var versionNumbers = regexp.MustCompile(`[0-9]+`)
+
+// ordinalDigits weight the first four numbers of a version, each capped so as not to overflow into the previous one.
+// The largest ordinal is below 2^53, so the ordinals are exact as a float64 score of a redis sorted set.
+var ordinalDigits = []struct {
+	weight float64
+	max    int64
+}{{1e10, 99999}, {1e6, 9999}, {1e2, 9999}, {1, 99}}
+
+// versionOrdinal normalizes a version into a number ordering the versions, e.g. 1.9 < 1.10 < 2.0.
+// The numbers after the fourth and the letters are ignored, so 1.0a and 1.0b have the same ordinal.
+// The backslashes of a quoted WFN value don't matter.
+func versionOrdinal(version string) float64 {
+	ordinal := 0.0
+	for i, s := range versionNumbers.FindAllString(version, len(ordinalDigits)) {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || ordinalDigits[i].max < n {
+			n = ordinalDigits[i].max
+		}
+		ordinal += float64(n) * ordinalDigits[i].weight
+	}
+	return ordinal
+}
+
+// hasVersion tells whether the version of a CPE is a version, not ANY or NA
+func hasVersion(version string) bool {
+	return version != "" && version != "ANY" && version != "NA"
+}
+
+// versionsInRange returns the distinct versions whose ordinals are between those of from and to,
+// ordered by the ordinal and then the version. An empty from or to doesn't bound the range.
+func versionsInRange(versions []string, from, to string) []string {
+	inRange, seen := []string{}, map[string]bool{}
+	for _, v := range versions {
+		if !hasVersion(v) || seen[v] {
+			continue
+		}
+		seen[v] = true
+		o := versionOrdinal(v)
+		if (from != "" && o < versionOrdinal(from)) || (to != "" && versionOrdinal(to) < o) {
+			continue
+		}
+		inRange = append(inRange, v)
+	}
+	sort.Slice(inRange, func(i, j int) bool {
+		oi, oj := versionOrdinal(inRange[i]), versionOrdinal(inRange[j])
+		if oi != oj {
+			return oi < oj
+		}
+		return inRange[i] < inRange[j]
+	})
+	return inRange
+}
+
+// GroupVersionRanges groups the versions ordered by GetVersionsByVendorProduct into the runs of successive versions.
+// A version succeeds another when the first number differing is larger by one and the numbers after it are 0,
+// e.g. 1.0.9 -> 1.0.10, 1.0.9 -> 1.1 and 1.9 -> 2.0, and the versions of the same ordinal, e.g. 1.0a and 1.0b, are in a run.
+func GroupVersionRanges(versions []string) []models.VersionRange {
+	ranges := []models.VersionRange{}
+	for i, v := range versions {
+		if 0 < i && succeeds(versions[i-1], v) {
+			r := &ranges[len(ranges)-1]
+			r.Max = v
+			r.Versions++
+			continue
+		}
+		if 0 < i {
+			ranges[len(ranges)-1].GapAfter = true
+		}
+		ranges = append(ranges, models.VersionRange{Min: v, Max: v, Versions: 1})
+	}
+	return ranges
+}
+
+// succeeds tells whether next is the version right after prev
+func succeeds(prev, next string) bool {
+	if versionOrdinal(prev) == versionOrdinal(next) {
+		return true
+	}
+	p, n := versionNumbers.FindAllString(prev, -1), versionNumbers.FindAllString(next, -1)
+	number := func(ss []string, i int) int64 {
+		if len(ss) <= i {
+			return 0
+		}
+		n, _ := strconv.ParseInt(ss[i], 10, 64)
+		return n
+	}
+	length := len(p)
+	if length < len(n) {
+		length = len(n)
+	}
+	for i := 0; i < length; i++ {
+		if number(p, i) == number(n, i) {
+			continue
+		}
+		if number(n, i) != number(p, i)+1 {
+			return false
+		}
+		for j := i + 1; j < len(n); j++ {
+			if number(n, j) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
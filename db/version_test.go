@@ -0,0 +1,68 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func TestVersionOrdinal(t *testing.T) {
+	var tests = []struct {
+		lower  string
+		higher string
+	}{
+		{lower: "1.9", higher: "1.10"},
+		{lower: "1.10", higher: "2.0"},
+		{lower: `2\.4\.49`, higher: "2.4.50"},
+		{lower: "1.0", higher: "1.0.1"},
+		{lower: "1.2.3.4", higher: "1.2.3.5"},
+		{lower: "99999.9999.9999.98", higher: "99999.9999.9999.99"},
+	}
+	for _, tt := range tests {
+		if !(versionOrdinal(tt.lower) < versionOrdinal(tt.higher)) {
+			t.Errorf("actual %s >= %s, expected %s < %s", tt.lower, tt.higher, tt.lower, tt.higher)
+		}
+	}
+	if versionOrdinal("1.0a") != versionOrdinal("1.0b") {
+		t.Errorf("actual %f != %f, expected the letters to be ignored", versionOrdinal("1.0a"), versionOrdinal("1.0b"))
+	}
+	if versionOrdinal("123456") != versionOrdinal("99999") {
+		t.Errorf("actual %f != %f, expected a number capped", versionOrdinal("123456"), versionOrdinal("99999"))
+	}
+}
+
+func TestVersionsInRange(t *testing.T) {
+	versions := []string{`1\.10`, `1\.9`, "ANY", `2\.0`, `1\.9`, "NA", `1\.0b`, `1\.0a`}
+	var tests = []struct {
+		from     string
+		to       string
+		expected []string
+	}{
+		{expected: []string{`1\.0a`, `1\.0b`, `1\.9`, `1\.10`, `2\.0`}},
+		{from: "1.9", to: "1.10", expected: []string{`1\.9`, `1\.10`}},
+		{from: "1.5", expected: []string{`1\.9`, `1\.10`, `2\.0`}},
+		{to: "1.0", expected: []string{`1\.0a`, `1\.0b`}},
+		{from: "3.0", expected: []string{}},
+	}
+	for _, tt := range tests {
+		if actual := versionsInRange(versions, tt.from, tt.to); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%q-%q: actual %#v, expected %#v", tt.from, tt.to, actual, tt.expected)
+		}
+	}
+}
+
+func TestGroupVersionRanges(t *testing.T) {
+	versions := []string{`1\.0`, `1\.0\.1`, `1\.0\.2`, `1\.0\.2a`, `1\.1`, `1\.3`, `2\.0`, `2\.0\.1`, `2\.0\.3`}
+	expected := []models.VersionRange{
+		{Min: `1\.0`, Max: `1\.1`, Versions: 5, GapAfter: true},
+		{Min: `1\.3`, Max: `2\.0\.1`, Versions: 3, GapAfter: true},
+		{Min: `2\.0\.3`, Max: `2\.0\.3`, Versions: 1},
+	}
+	if actual := GroupVersionRanges(versions); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual %#v, expected %#v", actual, expected)
+	}
+	if actual := GroupVersionRanges(nil); len(actual) != 0 {
+		t.Errorf("actual %#v, expected no ranges", actual)
+	}
+}
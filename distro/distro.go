@@ -0,0 +1,173 @@
+// Package distro maps the packages of Linux distributions (e.g. apache2 of Debian, httpd of RHEL) to the vendor/products of the CPEs.
+package distro
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+// families are the distributions whose packages are named after those of another one,
+// so a package not mapped for them is looked up in the other one
+var families = map[string]string{
+	"ubuntu":    "debian",
+	"linuxmint": "debian",
+	"raspbian":  "debian",
+	"kali":      "debian",
+	"redhat":    "rhel",
+	"centos":    "rhel",
+	"rocky":     "rhel",
+	"almalinux": "rhel",
+	"oracle":    "rhel",
+	"fedora":    "rhel",
+	"amazon":    "rhel",
+}
+
+// packages are the vendor/products of the well-known packages by the distribution.
+// Subpackages (e.g. openssh-server) and versioned names (e.g. postgresql-14) are found by Names.
+var packages = map[string]map[string][]string{
+	"debian": {
+		"apache2":     {"apache::http_server"},
+		"nginx":       {"f5::nginx", "nginx::nginx"},
+		"openssh":     {"openbsd::openssh"},
+		"openssl":     {"openssl::openssl"},
+		"libssl":      {"openssl::openssl"},
+		"bind":        {"isc::bind"},
+		"postgresql":  {"postgresql::postgresql"},
+		"mariadb":     {"mariadb::mariadb"},
+		"mysql":       {"oracle::mysql"},
+		"php":         {"php::php"},
+		"python":      {"python::python"},
+		"curl":        {"haxx::curl"},
+		"libcurl":     {"haxx::libcurl"},
+		"sudo":        {"sudo_project::sudo"},
+		"bash":        {"gnu::bash"},
+		"glibc":       {"gnu::glibc"},
+		"libc6":       {"gnu::glibc"},
+		"linux":       {"linux::linux_kernel"},
+		"git":         {"git-scm::git"},
+		"vim":         {"vim::vim"},
+		"tomcat":      {"apache::tomcat"},
+		"squid":       {"squid-cache::squid"},
+		"exim":        {"exim::exim"},
+		"postfix":     {"postfix::postfix"},
+		"dovecot":     {"dovecot::dovecot"},
+		"samba":       {"samba::samba"},
+		"zlib":        {"zlib::zlib"},
+		"zlib1g":      {"zlib::zlib"},
+		"libxml2":     {"xmlsoft::libxml2"},
+		"openjdk":     {"oracle::openjdk"},
+		"nodejs":      {"nodejs::node.js"},
+		"redis":       {"redis::redis"},
+		"systemd":     {"systemd_project::systemd"},
+		"firefox":     {"mozilla::firefox"},
+		"firefox-esr": {"mozilla::firefox_esr"},
+	},
+	"rhel": {
+		"httpd":              {"apache::http_server"},
+		"nginx":              {"f5::nginx", "nginx::nginx"},
+		"openssh":            {"openbsd::openssh"},
+		"openssl":            {"openssl::openssl"},
+		"bind":               {"isc::bind"},
+		"postgresql":         {"postgresql::postgresql"},
+		"mariadb":            {"mariadb::mariadb"},
+		"mysql":              {"oracle::mysql"},
+		"php":                {"php::php"},
+		"python":             {"python::python"},
+		"curl":               {"haxx::curl"},
+		"libcurl":            {"haxx::libcurl"},
+		"sudo":               {"sudo_project::sudo"},
+		"bash":               {"gnu::bash"},
+		"glibc":              {"gnu::glibc"},
+		"kernel":             {"linux::linux_kernel"},
+		"git":                {"git-scm::git"},
+		"vim-enhanced":       {"vim::vim"},
+		"vim-minimal":        {"vim::vim"},
+		"tomcat":             {"apache::tomcat"},
+		"squid":              {"squid-cache::squid"},
+		"exim":               {"exim::exim"},
+		"postfix":            {"postfix::postfix"},
+		"dovecot":            {"dovecot::dovecot"},
+		"samba":              {"samba::samba"},
+		"zlib":               {"zlib::zlib"},
+		"libxml2":            {"xmlsoft::libxml2"},
+		"java-1.8.0-openjdk": {"oracle::openjdk"},
+		"java-11-openjdk":    {"oracle::openjdk"},
+		"java-17-openjdk":    {"oracle::openjdk"},
+		"java-21-openjdk":    {"oracle::openjdk"},
+		"nodejs":             {"nodejs::node.js"},
+		"redis":              {"redis::redis"},
+		"systemd":            {"systemd_project::systemd"},
+		"firefox":            {"mozilla::firefox"},
+	},
+}
+
+// Packages returns the mapping loaded into the DB
+func Packages() []models.DistroPackage {
+	mapped := []models.DistroPackage{}
+	for distro, pkgs := range packages {
+		for pkg, vendorProducts := range pkgs {
+			for _, vp := range vendorProducts {
+				ss := strings.SplitN(vp, "::", 2)
+				mapped = append(mapped, models.DistroPackage{Distro: distro, Package: pkg, Vendor: ss[0], Product: ss[1]})
+			}
+		}
+	}
+	sort.Slice(mapped, func(i, j int) bool {
+		if mapped[i].Distro != mapped[j].Distro {
+			return mapped[i].Distro < mapped[j].Distro
+		}
+		if mapped[i].Package != mapped[j].Package {
+			return mapped[i].Package < mapped[j].Package
+		}
+		return mapped[i].Vendor+"::"+mapped[i].Product < mapped[j].Vendor+"::"+mapped[j].Product
+	})
+	return mapped
+}
+
+// Distros returns the distributions a package of distro is looked up in, distro first
+func Distros(distro string) []string {
+	distro = strings.ToLower(distro)
+	if family, ok := families[distro]; ok {
+		return []string{distro, family}
+	}
+	return []string{distro}
+}
+
+// subpackageSuffixes are trimmed from the names of the subpackages, e.g. openssh-server -> openssh
+var subpackageSuffixes = []string{"-server", "-client", "-common", "-core", "-libs", "-devel", "-dev", "-bin", "-headless", "-jre", "-jdk"}
+
+// versionSuffix is the version in a package name, e.g. postgresql-14, openssl1.1
+var versionSuffix = regexp.MustCompile(`[-.]?[0-9][0-9.]*$`)
+
+// Names returns the names a package is looked up by in order: the name as is,
+// the name of the main package of a subpackage, and that without the version
+func Names(pkg string) []string {
+	names := []string{pkg}
+	add := func(name string) {
+		if name == "" {
+			return
+		}
+		for _, n := range names {
+			if n == name {
+				return
+			}
+		}
+		names = append(names, name)
+	}
+
+	base := pkg
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, s := range subpackageSuffixes {
+			if strings.HasSuffix(base, s) && base != s {
+				base, trimmed = strings.TrimSuffix(base, s), true
+			}
+		}
+	}
+	add(base)
+	add(versionSuffix.ReplaceAllString(base, ""))
+	return names
+}
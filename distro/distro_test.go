@@ -0,0 +1,58 @@
+package distro
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	var tests = []struct {
+		pkg      string
+		expected []string
+	}{
+		{pkg: "nginx", expected: []string{"nginx"}},
+		{pkg: "openssh-server", expected: []string{"openssh-server", "openssh"}},
+		{pkg: "postgresql-14", expected: []string{"postgresql-14", "postgresql"}},
+		{pkg: "openssl1.1", expected: []string{"openssl1.1", "openssl"}},
+		{pkg: "libssl-dev", expected: []string{"libssl-dev", "libssl"}},
+		{pkg: "openjdk-11-jre-headless", expected: []string{"openjdk-11-jre-headless", "openjdk-11", "openjdk"}},
+		{pkg: "python3.9", expected: []string{"python3.9", "python"}},
+	}
+	for _, tt := range tests {
+		if actual := Names(tt.pkg); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%s: actual %#v, expected %#v", tt.pkg, actual, tt.expected)
+		}
+	}
+}
+
+func TestDistros(t *testing.T) {
+	var tests = []struct {
+		distro   string
+		expected []string
+	}{
+		{distro: "debian", expected: []string{"debian"}},
+		{distro: "Ubuntu", expected: []string{"ubuntu", "debian"}},
+		{distro: "rocky", expected: []string{"rocky", "rhel"}},
+		{distro: "alpine", expected: []string{"alpine"}},
+	}
+	for _, tt := range tests {
+		if actual := Distros(tt.distro); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%s: actual %#v, expected %#v", tt.distro, actual, tt.expected)
+		}
+	}
+}
+
+func TestPackages(t *testing.T) {
+	found := false
+	for _, p := range Packages() {
+		if p.Distro == "" || p.Package == "" || p.Vendor == "" || p.Product == "" {
+			t.Errorf("actual %#v, expected all the fields set", p)
+		}
+		if p.Distro == "rhel" && p.Package == "httpd" {
+			found = p.Vendor == "apache" && p.Product == "http_server"
+		}
+	}
+	if !found {
+		t.Errorf("httpd of rhel is not mapped to apache::http_server")
+	}
+}
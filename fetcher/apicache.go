@@ -0,0 +1,90 @@
+package fetcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// NVDAPICache caches the pages of the NVD CPE API, so that a fetch re-run within the TTL replays them
+// instead of requesting the rate limited API again. nil disables it.
+var NVDAPICache *PageCache
+
+// PageCache stores the pages of an API in a directory, content-addressed as the payloads of KeepRaw,
+// and returns them until they're older than the TTL
+type PageCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// pageCacheEntry is index/<SHA-256 of the URL>.json, pointing to the object of the page
+type pageCacheEntry struct {
+	URL       string    `json:"url"`
+	SHA256    string    `json:"sha256"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// NewPageCache creates the cache in dir, the pages being replayed for ttl after they're fetched
+func NewPageCache(dir string, ttl time.Duration) (*PageCache, error) {
+	for _, d := range []string{"objects", "index"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0700); err != nil {
+			return nil, fmt.Errorf("Failed to create dir. dir: %s, err: %s", dir, err)
+		}
+	}
+	return &PageCache{dir: dir, ttl: ttl}, nil
+}
+
+func (c *PageCache) indexPath(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(c.dir, "index", hex.EncodeToString(sum[:])+".json")
+}
+
+// get returns the page of the URL fetched within the TTL
+func (c *PageCache) get(u string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	b, err := ioutil.ReadFile(c.indexPath(u))
+	if err != nil {
+		return nil, false
+	}
+	var entry pageCacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil || entry.URL != u || c.ttl < time.Since(entry.FetchedAt) {
+		return nil, false
+	}
+	body, err := readObject(c.dir, entry.SHA256)
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
+
+// put stores the page of the URL
+func (c *PageCache) put(u string, body []byte) error {
+	if c == nil {
+		return nil
+	}
+	sum := sha256.Sum256(body)
+	entry := pageCacheEntry{URL: u, SHA256: hex.EncodeToString(sum[:]), FetchedAt: time.Now().UTC()}
+	if err := storeObject(c.dir, entry.SHA256, body); err != nil {
+		return err
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal the cache entry. err: %s", err)
+	}
+	path := c.indexPath(u)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("Failed to write the cache entry. path: %s, err: %s", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("Failed to rename the cache entry. path: %s, err: %s", path, err)
+	}
+	return nil
+}
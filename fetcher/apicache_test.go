@@ -0,0 +1,62 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchNVDAPICached(t *testing.T) {
+	names := []string{
+		"cpe:2.3:o:cisco:ios:12.0:*:*:*:*:*:*:*",
+		"cpe:2.3:o:cisco:ios:12.1:*:*:*:*:*:*:*",
+		"cpe:2.3:h:cisco:asa_5505:-:*:*:*:*:*:*:*",
+	}
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		products := []interface{}{}
+		for i := start; i < len(names) && i < start+2; i++ {
+			products = append(products, map[string]interface{}{"cpe": map[string]interface{}{"cpeName": names[i]}})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"resultsPerPage": 2, "startIndex": start, "totalResults": len(names), "products": products})
+	}))
+	defer ts.Close()
+	cache, err := NewPageCache(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	NVDAPIURL, nvdAPIPageSize, nvdAPIInterval, NVDAPICache = ts.URL, 2, 0, cache
+	defer func() {
+		NVDAPIURL, nvdAPIPageSize, nvdAPIInterval, NVDAPICache = DefaultNVDAPIURL, 10000, 6*time.Second, nil
+	}()
+
+	query := NVDAPIQuery{CpeMatchString: "cpe:2.3:*:cisco"}
+	for i, expected := range []int32{2, 2} {
+		cpes, err := FetchNVDAPI(context.Background(), query, nil)
+		if err != nil {
+			t.Fatalf("[%d] FetchNVDAPI: %s", i, err)
+		}
+		if len(cpes) != len(names) {
+			t.Errorf("[%d] actual %d CPEs, expected %d", i, len(cpes), len(names))
+		}
+		if actual := atomic.LoadInt32(&requests); actual != expected {
+			t.Errorf("[%d] actual %d requests, expected %d", i, actual, expected)
+		}
+	}
+
+	// the pages older than the TTL are requested again
+	cache.ttl = 0
+	if _, err := FetchNVDAPI(context.Background(), query, nil); err != nil {
+		t.Fatalf("FetchNVDAPI: %s", err)
+	}
+	if actual := atomic.LoadInt32(&requests); actual != 4 {
+		t.Errorf("actual %d requests, expected 4", actual)
+	}
+}
@@ -0,0 +1,82 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Policies applied when a feed can't be fetched even after retries
+const (
+	// OnErrorFail aborts the whole fetch
+	OnErrorFail = "fail"
+	// OnErrorSkip skips the feed and continues
+	OnErrorSkip = "skip"
+	// OnErrorRecord skips the feed and records it, to be reported as recovered once a later run fetches it.
+	// Every run fetches all the feeds, so the recorded feeds are fetched again along with the others.
+	OnErrorRecord = "record"
+)
+
+// FailedFeed is a feed that couldn't be fetched
+type FailedFeed struct {
+	URL      string    `json:"url"`
+	Err      string    `json:"err"`
+	FailedAt time.Time `json:"failedAt"`
+
+	err error
+}
+
+func newFailedFeed(url string, err error) FailedFeed {
+	return FailedFeed{
+		URL:      url,
+		Err:      err.Error(),
+		FailedAt: time.Now(),
+		err:      err,
+	}
+}
+
+// ValidateOnError validates the error policy
+func ValidateOnError(onError string) error {
+	switch onError {
+	case OnErrorFail, OnErrorSkip, OnErrorRecord:
+		return nil
+	}
+	return fmt.Errorf("Invalid on-error policy: %s. Specify %s, %s or %s", onError, OnErrorFail, OnErrorSkip, OnErrorRecord)
+}
+
+// LoadFailedFeeds loads the feeds failed in the previous run
+func LoadFailedFeeds(path string) ([]FailedFeed, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to read failed feeds. path: %s, err: %s", path, err)
+	}
+	var feeds []FailedFeed
+	if err := json.Unmarshal(b, &feeds); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal failed feeds. path: %s, err: %s", path, err)
+	}
+	return feeds, nil
+}
+
+// SaveFailedFeeds saves the failed feeds to be retried on the next run.
+// The file is removed when there are no failed feeds.
+func SaveFailedFeeds(path string, feeds []FailedFeed) error {
+	if len(feeds) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to remove failed feeds. path: %s, err: %s", path, err)
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(feeds, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal failed feeds. err: %s", err)
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return fmt.Errorf("Failed to write failed feeds. path: %s, err: %s", path, err)
+	}
+	return nil
+}
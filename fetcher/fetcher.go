@@ -0,0 +1,52 @@
+// Package fetcher fetches and parses the CPEs of NVD, JVN and the Windows products of MSRC,
+// and the vendor/products of the CISA Known Exploited Vulnerabilities catalog.
+// Programs embedding the fetch call FetchNVD, FetchJVN and FetchWindows; the package variables below point them at mirrors or a custom client.
+package fetcher
+
+import (
+	"net/http"
+
+	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("github.com/kotakanbe/go-cpe-dictionary/fetcher")
+
+// logger is the logger of the fetch component of --log-level
+var logger = util.Logger("fetch")
+
+// Default base URLs of the feeds
+const (
+	DefaultNVDBaseURL = "https://nvd.nist.gov"
+	DefaultJVNBaseURL = "https://jvndb.jvn.jp"
+	// DefaultMSRCBaseURL is the base URL of the CVRF API of MSRC
+	DefaultMSRCBaseURL = "https://api.msrc.microsoft.com"
+	// DefaultNVDAPIURL is the endpoint of the NVD CPE API 2.0
+	DefaultNVDAPIURL = "https://services.nvd.nist.gov/rest/json/cpes/2.0"
+	// DefaultKEVURL is the JSON of the CISA Known Exploited Vulnerabilities catalog
+	DefaultKEVURL = "https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json"
+)
+
+var (
+	// HTTPClient fetches the feeds. When nil, a client honoring --http-proxy is used.
+	HTTPClient *http.Client
+	// NVDBaseURL is replaced to fetch NVD feeds from a mirror
+	NVDBaseURL = DefaultNVDBaseURL
+	// JVNBaseURL is replaced to fetch JVN feeds from a mirror
+	JVNBaseURL = DefaultJVNBaseURL
+	// MSRCBaseURL is replaced to fetch the CVRF documents of MSRC from a mirror
+	MSRCBaseURL = DefaultMSRCBaseURL
+	// NVDAPIURL is replaced to query a mirror of the NVD CPE API
+	NVDAPIURL = DefaultNVDAPIURL
+	// NVDAPIKey is sent as the apiKey header of the requests to the NVD CPE API, raising its rate limit
+	NVDAPIKey string
+	// KEVURL is replaced to fetch the CISA Known Exploited Vulnerabilities catalog from a mirror
+	KEVURL = DefaultKEVURL
+)
+
+func httpClient() *http.Client {
+	if HTTPClient != nil {
+		return HTTPClient
+	}
+	return util.NewHTTPClient()
+}
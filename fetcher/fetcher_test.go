@@ -0,0 +1,73 @@
+package fetcher
+
+import (
+	"compress/gzip"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// newTestServer serves the file in testdata mapped from the base name of the requested path.
+// Paths ending with .gz are gzipped on the fly.
+func newTestServer(t *testing.T, files map[string]string) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Base(r.URL.Path)
+		for pattern, file := range files {
+			matched, err := filepath.Match(pattern, name)
+			if err != nil {
+				t.Errorf("Invalid pattern. pattern: %s, err: %s", pattern, err)
+			}
+			if !matched {
+				continue
+			}
+
+			b, err := ioutil.ReadFile(filepath.Join("testdata", file))
+			if err != nil {
+				t.Errorf("Failed to read testdata. file: %s, err: %s", file, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !strings.HasSuffix(name, ".gz") {
+				_, _ = w.Write(b)
+				return
+			}
+			gw := gzip.NewWriter(w)
+			_, _ = gw.Write(b)
+			_ = gw.Close()
+			return
+		}
+		http.NotFound(w, r)
+	}))
+
+	HTTPClient = ts.Client()
+	t.Cleanup(func() {
+		ts.Close()
+		HTTPClient = nil
+	})
+	return ts
+}
+
+// assertGolden compares actual with testdata/<name>.golden, or updates it with -update
+func assertGolden(t *testing.T, name string, actual string) {
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatalf("Failed to update golden file. err: %s", err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file. err: %s", err)
+	}
+	if actual != string(expected) {
+		t.Errorf("actual:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
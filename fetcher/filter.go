@@ -0,0 +1,49 @@
+package fetcher
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// VendorFilter is an allowlist of vendors. A nil VendorFilter allows all vendors.
+type VendorFilter map[string]struct{}
+
+// LoadVendorFilter loads an allowlist of vendors, one vendor per line.
+// Empty lines and lines starting with # are ignored.
+func LoadVendorFilter(path string) (VendorFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open vendor filter. path: %s, err: %s", path, err)
+	}
+	defer f.Close()
+
+	filter := VendorFilter{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		filter[normalizeVendor(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read vendor filter. path: %s, err: %s", path, err)
+	}
+	return filter, nil
+}
+
+// Allow reports whether the vendor is in the allowlist
+func (f VendorFilter) Allow(vendor string) bool {
+	if f == nil {
+		return true
+	}
+	_, ok := f[normalizeVendor(vendor)]
+	return ok
+}
+
+// normalizeVendor drops the WFN escape and case so that "foo\-bar" matches "Foo-Bar"
+func normalizeVendor(vendor string) string {
+	return strings.ToLower(strings.ReplaceAll(vendor, `\`, ""))
+}
@@ -0,0 +1,86 @@
+package fetcher
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadVendorFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vendors.txt")
+	if err := os.WriteFile(path, []byte("# vendors of the edge devices\nApache\n\n  cybozu  \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := LoadVendorFilter(path)
+	if err != nil {
+		t.Fatalf("LoadVendorFilter: %s", err)
+	}
+	expected := VendorFilter{"apache": {}, "cybozu": {}}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("actual %#v, expected %#v", filter, expected)
+	}
+}
+
+func TestVendorFilterAllow(t *testing.T) {
+	filter := VendorFilter{"foo-bar": {}}
+	var tests = []struct {
+		filter   VendorFilter
+		vendor   string
+		expected bool
+	}{
+		{filter: filter, vendor: `foo\-bar`, expected: true},
+		{filter: filter, vendor: "Foo-Bar", expected: true},
+		{filter: filter, vendor: "foo", expected: false},
+		{filter: nil, vendor: "foo", expected: true},
+	}
+	for i, tt := range tests {
+		if actual := tt.filter.Allow(tt.vendor); actual != tt.expected {
+			t.Errorf("[%d] actual %t, expected %t", i, actual, tt.expected)
+		}
+	}
+}
+
+// TestDecodeFilterVendors checks the CPEs of the vendors filtered out are dropped while decoding the feeds
+func TestDecodeFilterVendors(t *testing.T) {
+	vendors := VendorFilter{"cybozu": {}}
+
+	dictionary := `<?xml version="1.0" encoding="UTF-8"?>
+<cpe-list xmlns="http://cpe.mitre.org/dictionary/2.0" xmlns:cpe-23="http://scap.nist.gov/schema/cpe-extension/2.3">
+  <cpe-item name="cpe:/a:apache:http_server:2.4.49">
+    <title xml:lang="en-US">Apache HTTP Server 2.4.49</title>
+    <cpe-23:cpe23-item name="cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*"/>
+  </cpe-item>
+  <cpe-item name="cpe:/a:cybozu:office:10.0.0">
+    <title xml:lang="en-US">Cybozu Office 10.0.0</title>
+    <cpe-23:cpe23-item name="cpe:2.3:a:cybozu:office:10.0.0:*:*:*:*:*:*:*"/>
+  </cpe-item>
+</cpe-list>`
+	cpes, _, err := decodeCpeDictionary(strings.NewReader(dictionary), "official-cpe-dictionary_v2.3.xml", vendors)
+	if err != nil {
+		t.Fatalf("decodeCpeDictionary: %s", err)
+	}
+	if len(cpes) != 1 || cpes[0].CpeURI != "cpe:/a:cybozu:office:10.0.0" {
+		t.Errorf("actual %#v, expected cpe:/a:cybozu:office:10.0.0 only", cpes)
+	}
+
+	feed := `{"CVE_data_type": "CVE", "CVE_Items": [
+  {"cve": {"CVE_data_meta": {"ID": "CVE-2021-41773"}}, "configurations": {"nodes": [{"cpe_match": [{"cpe23Uri": "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*"}]}]}},
+  {"cve": {"CVE_data_meta": {"ID": "CVE-2021-20001"}}, "configurations": {"nodes": [{"cpe_match": [{"cpe23Uri": "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*"}, {"cpe23Uri": "cpe:2.3:a:cybozu:office:10.0.0:*:*:*:*:*:*:*"}]}]}}
+], "CVE_data_numberOfCVEs": "2"}`
+	nvd, err := decodeNvdFeed(strings.NewReader(feed), vendors)
+	if err != nil {
+		t.Fatalf("decodeNvdFeed: %s", err)
+	}
+	if len(nvd.CVEItems) != 1 || nvd.CVEItems[0].Cve.CVEDataMeta.ID != "CVE-2021-20001" || len(nvd.CVEItems[0].Configurations.Nodes[0].Cpe) != 1 {
+		t.Errorf("actual %#v, expected the CPE of cybozu of CVE-2021-20001 only", nvd.CVEItems)
+	}
+
+	if nvd, err = decodeNvdFeed(strings.NewReader(feed), nil); err != nil {
+		t.Fatalf("decodeNvdFeed: %s", err)
+	}
+	if len(nvd.CVEItems) != 2 || len(nvd.CVEItems[1].Configurations.Nodes[0].Cpe) != 2 {
+		t.Errorf("actual %#v, expected all the CVEs", nvd.CVEItems)
+	}
+}
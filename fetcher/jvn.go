@@ -1,15 +1,17 @@
 package fetcher
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
+	"strings"
 	"time"
 
-	"github.com/inconshreveable/log15"
 	"github.com/knqyf263/go-cpe/common"
 	"github.com/knqyf263/go-cpe/naming"
 	"github.com/kotakanbe/go-cpe-dictionary/models"
 	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"golang.org/x/xerrors"
 )
 
 type rdf struct {
@@ -23,63 +25,91 @@ type Item struct {
 
 type cpe struct {
 	Version string `xml:"version,attr"` // cpe:/a:mysql:mysql
-	Vendor  string `xml:"vendor,attr"`
-	Product string `xml:"product,attr"`
+	Vendor  string `xml:"vendor,attr"`  // vendor name in Japanese
+	Product string `xml:"product,attr"` // product name in Japanese
 	Value   string `xml:",chardata"`
 }
 
 // FetchJVN JVN feeds
-func FetchJVN() ([]models.CategorizedCpe, error) {
+// The feeds go through the stages of Pipeline, and a CPE in several feeds is taken from the first of them.
+func FetchJVN(ctx context.Context) ([]models.CategorizedCpe, error) {
+	ctx, span := tracer.Start(ctx, "FetchJVN")
+	defer span.End()
+
 	years, err := util.GetYearsUntilThisYear(2002)
 	if err != nil {
 		return nil, err
 	}
 	urls := makeJvnURLs(years)
 
-	cpeURIs := map[string]models.CategorizedCpe{}
-	for _, url := range urls {
-		bytes, err := util.FetchFeedFile(url, false)
-		if err != nil {
-			return nil, fmt.Errorf("Failed to fetch. url: %s, err: %s", url, err)
-		}
-		var rdf rdf
-		if err = xml.Unmarshal(bytes, &rdf); err != nil {
-			return nil, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", url, err)
+	feeds := make([][]models.CategorizedCpe, len(urls))
+	stages, buffer := feedStages(downloadJvnFeed, parseJvnFeed, transformJvnFeed)
+	err = runPipeline(ctx, urls, stages, buffer, func(job *feedJob) error {
+		if job.err != nil {
+			return job.err
 		}
+		feeds[job.index] = job.value.([]models.CategorizedCpe)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		for _, item := range rdf.Items {
-			cpes, err := convertJvnCpesToModel(item.Cpes)
-			if err != nil {
-				return nil, fmt.Errorf("Failed to convert. err: %s", err)
-			}
-
-			for _, c := range cpes {
-				if _, ok := cpeURIs[c.CpeURI]; !ok {
-					cpeURIs[c.CpeURI] = c
-				}
+	cpeURIs := map[string]bool{}
+	allCpes := []models.CategorizedCpe{}
+	for _, cpes := range feeds {
+		for _, c := range cpes {
+			if !cpeURIs[c.CpeURI] {
+				cpeURIs[c.CpeURI] = true
+				allCpes = append(allCpes, c)
 			}
 		}
 	}
+	return allCpes, nil
+}
 
-	allCpes := []models.CategorizedCpe{}
-	for _, c := range cpeURIs {
-		allCpes = append(allCpes, c)
+// downloadJvnFeed is the download stage of the JVN feeds
+func downloadJvnFeed(ctx context.Context, job *feedJob) (interface{}, error) {
+	bytes, err := util.FetchFeedFile(ctx, httpClient(), job.url, false)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to fetch. url: %s, err: %w", job.url, err)
+	}
+	return bytes, nil
+}
+
+// parseJvnFeed is the parse stage of the JVN feeds
+func parseJvnFeed(ctx context.Context, job *feedJob) (interface{}, error) {
+	var rdf rdf
+	if err := xml.Unmarshal(job.value.([]byte), &rdf); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", job.url, err)
 	}
+	return &rdf, nil
+}
 
+// transformJvnFeed is the transform stage of the JVN feeds, converting the CPEs of the items of a feed
+func transformJvnFeed(ctx context.Context, job *feedJob) (interface{}, error) {
+	allCpes := []models.CategorizedCpe{}
+	for _, item := range job.value.(*rdf).Items {
+		cpes, err := convertJvnCpesToModel(item.Cpes)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert. err: %s", err)
+		}
+		allCpes = append(allCpes, cpes...)
+	}
 	return allCpes, nil
 }
 
 func makeJvnURLs(years []int) (urls []string) {
 	latestFeeds := []string{
-		"https://jvndb.jvn.jp/ja/rss/jvndb_new.rdf",
-		"https://jvndb.jvn.jp/ja/rss/jvndb.rdf",
+		JVNBaseURL + "/ja/rss/jvndb_new.rdf",
+		JVNBaseURL + "/ja/rss/jvndb.rdf",
 	}
 
 	if len(years) == 0 {
 		return latestFeeds
 	}
 
-	urlFormat := "https://jvndb.jvn.jp/ja/rss/years/jvndb_%d.rdf"
+	urlFormat := JVNBaseURL + "/ja/rss/years/jvndb_%d.rdf"
 	for _, year := range years {
 		urls = append(urls, fmt.Sprintf(urlFormat, year))
 
@@ -95,11 +125,15 @@ func convertJvnCpesToModel(jvnCpes []cpe) (cpes []models.CategorizedCpe, err err
 	for _, c := range jvnCpes {
 		var wfn common.WellFormedName
 		if wfn, err = naming.UnbindURI(c.Value); err != nil {
-			// Logging only
-			log15.Warn("Failed to unbind", c.Value, err)
+			reject(models.JVN, c.Value, err.Error())
+			continue
+		}
+		if reason := missingComponent(wfn); reason != "" {
+			reject(models.JVN, c.Value, reason)
 			continue
 		}
 		cpes = append(cpes, models.CategorizedCpe{
+			FetchType:       models.JVN,
 			CpeURI:          naming.BindToURI(wfn),
 			CpeFS:           naming.BindToFS(wfn),
 			Part:            wfn.GetString(common.AttributePart),
@@ -113,6 +147,7 @@ func convertJvnCpesToModel(jvnCpes []cpe) (cpes []models.CategorizedCpe, err err
 			TargetSoftware:  wfn.GetString(common.AttributeTargetSw),
 			TargetHardware:  wfn.GetString(common.AttributeTargetHw),
 			Other:           wfn.GetString(common.AttributeOther),
+			Title:           strings.TrimSpace(c.Product),
 		})
 	}
 	return cpes, nil
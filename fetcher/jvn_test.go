@@ -0,0 +1,31 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFetchJVN(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"*.rdf": "jvndb.rdf",
+	})
+	JVNBaseURL = ts.URL
+	defer func() {
+		JVNBaseURL = DefaultJVNBaseURL
+	}()
+
+	cpes, err := FetchJVN(context.Background())
+	if err != nil {
+		t.Fatalf("FetchJVN: %s", err)
+	}
+
+	lines := []string{}
+	for _, c := range cpes {
+		lines = append(lines, fmt.Sprintf("%s\t%s\n", c.CpeURI, c.Title))
+	}
+	sort.Strings(lines)
+	assertGolden(t, "jvn", strings.Join(lines, ""))
+}
@@ -0,0 +1,105 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"golang.org/x/xerrors"
+)
+
+// kevCatalog ... https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json
+type kevCatalog struct {
+	CatalogVersion  string `json:"catalogVersion"`
+	Vulnerabilities []struct {
+		CveID         string `json:"cveID"`
+		VendorProject string `json:"vendorProject"`
+		Product       string `json:"product"`
+	} `json:"vulnerabilities"`
+}
+
+// FetchKEV fetches the CISA Known Exploited Vulnerabilities catalog, and returns its vendor/products
+// named as in the CPEs, e.g. "HTTP Server" of "Apache" is apache::http_server, and the version of the catalog
+func FetchKEV(ctx context.Context) ([]models.KnownExploitedProduct, string, error) {
+	ctx, span := tracer.Start(ctx, "FetchKEV")
+	defer span.End()
+
+	bytes, err := util.FetchFeedFile(ctx, httpClient(), KEVURL, false)
+	if err != nil {
+		return nil, "", xerrors.Errorf("Failed to fetch. url: %s, err: %w", KEVURL, err)
+	}
+	var catalog kevCatalog
+	if err := json.Unmarshal(bytes, &catalog); err != nil {
+		return nil, "", fmt.Errorf("Failed to unmarshal. url: %s, err: %s", KEVURL, err)
+	}
+
+	cves := map[[2]string]map[string]bool{}
+	for _, v := range catalog.Vulnerabilities {
+		vendor, product := kevName(v.VendorProject), kevName(v.Product)
+		if vendor == "" || product == "" {
+			continue
+		}
+		key := [2]string{vendor, product}
+		if cves[key] == nil {
+			cves[key] = map[string]bool{}
+		}
+		cves[key][v.CveID] = true
+	}
+	products := make([]models.KnownExploitedProduct, 0, len(cves))
+	for key, ids := range cves {
+		products = append(products, models.KnownExploitedProduct{Vendor: key[0], Product: key[1], CVEs: len(ids)})
+	}
+	sort.Slice(products, func(i, j int) bool {
+		if products[i].Vendor != products[j].Vendor {
+			return products[i].Vendor < products[j].Vendor
+		}
+		return products[i].Product < products[j].Product
+	})
+	return products, catalog.CatalogVersion, nil
+}
+
+// kevName names a vendor or a product of the catalog as in the CPEs, lower case joined by _
+func kevName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), "_"))
+}
+
+// MatchKEV returns the products of the catalog found among the vendor/products of the dictionary,
+// named as in the dictionary. A product prefixed by its vendor, e.g. "Microsoft Office" of Microsoft,
+// also matches without the prefix. unmatched is the number of the products not in the dictionary.
+func MatchKEV(products []models.KnownExploitedProduct, vendorProducts []string) (matched []models.KnownExploitedProduct, unmatched int) {
+	// the vendor/products of the dictionary are escaped as in WFN, e.g. node\.js
+	dict := map[string]string{}
+	for _, vp := range vendorProducts {
+		dict[strings.ReplaceAll(vp, `\`, "")] = vp
+	}
+
+	found := map[string]int{}
+	for _, p := range products {
+		vp, ok := dict[p.Vendor+"::"+p.Product]
+		if !ok {
+			vp, ok = dict[p.Vendor+"::"+strings.TrimPrefix(p.Product, p.Vendor+"_")]
+		}
+		if !ok {
+			unmatched++
+			continue
+		}
+		found[vp] += p.CVEs
+	}
+
+	matched = make([]models.KnownExploitedProduct, 0, len(found))
+	for vp, n := range found {
+		ss := strings.SplitN(vp, "::", 2)
+		matched = append(matched, models.KnownExploitedProduct{Vendor: ss[0], Product: ss[1], CVEs: n})
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Vendor != matched[j].Vendor {
+			return matched[i].Vendor < matched[j].Vendor
+		}
+		return matched[i].Product < matched[j].Product
+	})
+	return matched, unmatched
+}
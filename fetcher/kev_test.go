@@ -0,0 +1,49 @@
+package fetcher
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func TestFetchKEV(t *testing.T) {
+	ts := newTestServer(t, map[string]string{"known_exploited_vulnerabilities.json": "kev.json"})
+	KEVURL = ts.URL + "/known_exploited_vulnerabilities.json"
+	defer func() {
+		KEVURL = DefaultKEVURL
+	}()
+
+	products, version, err := FetchKEV(context.Background())
+	if err != nil {
+		t.Fatalf("FetchKEV: %s", err)
+	}
+	if version != "2024.01.10" {
+		t.Errorf("expected the catalog version 2024.01.10, actual %s", version)
+	}
+	expected := []models.KnownExploitedProduct{
+		{Vendor: "accellion", Product: "fta", CVEs: 1},
+		// a CVE listed twice is counted once
+		{Vendor: "apache", Product: "http_server", CVEs: 2},
+		{Vendor: "microsoft", Product: "microsoft_outlook", CVEs: 1},
+		{Vendor: "microsoft", Product: "office", CVEs: 1},
+		{Vendor: "nodejs", Product: "node.js", CVEs: 1},
+	}
+	if !reflect.DeepEqual(products, expected) {
+		t.Errorf("actual %#v, expected %#v", products, expected)
+	}
+
+	matched, unmatched := MatchKEV(products, []string{"apache::http_server", "microsoft::office", "microsoft::outlook", `nodejs::node\.js`, "openbsd::openssh"})
+	expected = []models.KnownExploitedProduct{
+		{Vendor: "apache", Product: "http_server", CVEs: 2},
+		{Vendor: "microsoft", Product: "office", CVEs: 1},
+		// without the prefix of the vendor
+		{Vendor: "microsoft", Product: "outlook", CVEs: 1},
+		// named as escaped in the dictionary
+		{Vendor: "nodejs", Product: `node\.js`, CVEs: 1},
+	}
+	if !reflect.DeepEqual(matched, expected) || unmatched != 1 {
+		t.Errorf("actual %#v, %d unmatched, expected %#v, 1 unmatched", matched, unmatched, expected)
+	}
+}
@@ -0,0 +1,68 @@
+package fetcher
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// LowMemory fetches the NVD feeds within little memory, e.g. on a scanner VM of 1GB: each feed is downloaded to a temp file
+	// and decoded from it, a feed at a time while the next one is downloaded.
+	// It's slower, since the feeds are decoded by a single worker and the cpe dictionary is fetched before the JSON feeds.
+	LowMemory bool
+	// TempDir is the directory of the temp files of LowMemory, the default temp directory when empty
+	TempDir string
+)
+
+// openFeedFile downloads the gzipped feed to a temp file and opens it decompressed.
+// The temp file is removed on closing it.
+func openFeedFile(ctx context.Context, url string) (io.ReadCloser, error) {
+	path, err := util.DownloadFeedFile(ctx, httpClient(), url, TempDir)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to fetch. url: %s, err: %w", url, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, xerrors.Errorf("Failed to open the feed. url: %s, err: %w", url, err)
+	}
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("Failed to decompress NVD feedfile. url: %s, err: %s", url, err)
+	}
+	return feedFile{Reader: r, f: f}, nil
+}
+
+// feedFile is a temp file of a feed decompressed
+type feedFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (f feedFile) Close() error {
+	_ = f.Reader.Close()
+	err := f.f.Close()
+	if rerr := os.Remove(f.f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// streamCpeDictionary fetches the cpe dictionary as FetchCpeDictionary does, decoding it from a temp file instead of memory
+func streamCpeDictionary(ctx context.Context, url string, vendors VendorFilter) ([]models.CategorizedCpe, DictionaryStamp, error) {
+	r, err := openFeedFile(ctx, url)
+	if err != nil {
+		return nil, DictionaryStamp{}, err
+	}
+	defer r.Close()
+	return decodeCpeDictionary(r, url, vendors)
+}
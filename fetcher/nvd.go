@@ -2,250 +2,514 @@ package fetcher
 
 import (
 	"bytes"
-	"compress/gzip"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
-	"math"
+	"io"
+	"strings"
 	"time"
 
-	"github.com/inconshreveable/log15"
 	"github.com/knqyf263/go-cpe/common"
 	"github.com/knqyf263/go-cpe/naming"
 	"github.com/kotakanbe/go-cpe-dictionary/models"
 	"github.com/kotakanbe/go-cpe-dictionary/util"
-	"github.com/parnurzeal/gorequest"
-	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
 )
 
 // CpeDictionary has cpe-item list
 // https://nvd.nist.gov/cpe.cfm
 type CpeDictionary struct {
-	Items []struct {
-		Name       string `xml:"name,attr"`
-		Deprecated string `xml:"deprecated,attr"`
-		Cpe23Item  struct {
-			Name string `xml:"name,attr"`
-		} `xml:"cpe23-item"`
-	} `xml:"cpe-item"`
+	Generator struct {
+		ProductVersion string `xml:"product_version"`
+		Timestamp      string `xml:"timestamp"`
+	} `xml:"generator"`
+	Items []CpeItem `xml:"cpe-item"`
+}
+
+// CpeItem is a cpe-item of CpeDictionary
+type CpeItem struct {
+	Name       string `xml:"name,attr"`
+	Deprecated string `xml:"deprecated,attr"`
+	References []struct {
+		Href string `xml:"href,attr"`
+		Type string `xml:",chardata"`
+	} `xml:"references>reference"`
+	Cpe23Item struct {
+		Name         string `xml:"name,attr"`
+		Deprecations []struct {
+			DeprecatedBy []struct {
+				Name string `xml:"name,attr"`
+			} `xml:"deprecated-by"`
+		} `xml:"deprecation"`
+	} `xml:"cpe23-item"`
 }
 
 // V3Feed : NvdV3Feed
 // https://scap.nist.gov/schema/nvd/feed/0.1/nvd_cve_feed_json_0.1_beta.schema
 type V3Feed struct {
-	CVEItems []struct {
-		Configurations struct {
-			Nodes []struct {
-				Cpe []struct {
-					Cpe23URI string `json:"cpe23Uri"`
-				} `json:"cpe_match"`
-			} `json:"nodes"`
-		} `json:"configurations"`
-	} `json:"CVE_Items"`
+	CVEItems []V3FeedItem `json:"CVE_Items"`
 }
 
-// FetchNVD NVD feeds
-func FetchNVD() ([]models.CategorizedCpe, error) {
-	cpeURIs := map[string]models.CategorizedCpe{}
+// V3FeedItem is a CVE of V3Feed
+type V3FeedItem struct {
+	Cve struct {
+		CVEDataMeta struct {
+			ID string `json:"ID"`
+		} `json:"CVE_data_meta"`
+	} `json:"cve"`
+	Configurations struct {
+		Nodes []struct {
+			Cpe []struct {
+				Cpe23URI string `json:"cpe23Uri"`
+			} `json:"cpe_match"`
+		} `json:"nodes"`
+	} `json:"configurations"`
+}
 
-	dictCpes, err := FetchCpeDictionary()
+// DictionaryStamp is the version and generation time stamped on the NVD CPE dictionary
+type DictionaryStamp struct {
+	Version     string
+	GeneratedAt *time.Time
+}
+
+// NVDOption : options for FetchNVD. The zero value fetches all the CPEs of the feeds, failing on any feed error.
+type NVDOption struct {
+	// CountCveRefs stores the number of CVEs referencing each vendor/product as Popularity
+	CountCveRefs bool
+	// OnError is the policy applied when a feed can't be fetched even after retries (default: OnErrorFail)
+	OnError string
+	// Vendors only persists CPEs of the allowed vendors
+	Vendors VendorFilter
+	// Query fetches the CPEs matching it from the NVD CPE API instead of the feeds, when it's not empty
+	Query NVDAPIQuery
+}
+
+func nvdCpeDictionaryURL() string {
+	return NVDBaseURL + "/feeds/xml/cpe/dictionary/official-cpe-dictionary_v2.3.xml.gz"
+}
+
+// NVDResult is what FetchNVDResult fetched
+type NVDResult struct {
+	CPEs []models.CategorizedCpe
+	// Stamp is empty when the cpe dictionary was skipped or the NVD API was queried
+	Stamp DictionaryStamp
+	// Failed are the feeds skipped under the skip or record policy
+	Failed []FailedFeed
+}
+
+// FetchNVD fetches the CPEs of NVD, the feeds or the NVD CPE API by option.Query.
+// This is the API for the programs embedding the fetch without the CLI, and keeps its signature;
+// options are added to NVDOption with the zero values keeping the behavior.
+// The feeds skipped under OnErrorSkip and OnErrorRecord are only logged, see FetchNVDResult for them.
+func FetchNVD(ctx context.Context, option NVDOption) ([]models.CategorizedCpe, error) {
+	result, err := FetchNVDResult(ctx, option)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to fetch cpe dictionary. err : %s", err)
+		return nil, err
+	}
+	return result.CPEs, nil
+}
+
+// FetchNVDResult fetches the CPEs of NVD as FetchNVD does, along with the stamp of the cpe dictionary and the skipped feeds
+func FetchNVDResult(ctx context.Context, option NVDOption) (result NVDResult, err error) {
+	ctx, span := tracer.Start(ctx, "FetchNVD")
+	defer span.End()
+
+	if option.OnError == "" {
+		option.OnError = OnErrorFail
 	}
+	if !option.Query.Empty() {
+		if option.CountCveRefs {
+			logger.Warn("--count-cve-refs is ignored, since the CVE feeds are not fetched for the NVD API query")
+		}
+		cpes, err := FetchNVDAPI(ctx, option.Query, option.Vendors)
+		if err != nil {
+			return result, xerrors.Errorf("Failed to fetch NVD API. err : %w", err)
+		}
+		result.CPEs = cpes
+		return result, nil
+	}
+
+	cpeURIs := map[string]models.CategorizedCpe{}
+
+	// the cpe dictionary is fetched along with the JSON feeds, or before them within little memory
+	var (
+		dictCpes []models.CategorizedCpe
+		stamp    DictionaryStamp
+		dictErr  error
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	dictDone := make(chan struct{})
+	go func() {
+		defer close(dictDone)
+		dictCpes, stamp, dictErr = FetchCpeDictionary(ctx, option.Vendors)
+	}()
+	if LowMemory {
+		<-dictDone
+	}
+	jsonCpes, cveRefs, jsonFailed, jsonErr := FetchJSONFeed(ctx, option.OnError, option.Vendors)
+	if jsonErr != nil {
+		cancel()
+	}
+	<-dictDone
+	if jsonErr != nil {
+		return result, xerrors.Errorf("Failed to fetch nvd JSON feed. err : %w", jsonErr)
+	}
+
+	if dictErr != nil {
+		if option.OnError == OnErrorFail {
+			return result, xerrors.Errorf("Failed to fetch cpe dictionary. err : %w", dictErr)
+		}
+		logger.Warn("Skip the cpe dictionary.", "err", dictErr)
+		result.Failed = append(result.Failed, newFailedFeed(nvdCpeDictionaryURL(), dictErr))
+	}
+	result.Stamp = stamp
 	for _, c := range dictCpes {
 		if _, ok := cpeURIs[c.CpeURI]; !ok {
 			cpeURIs[c.CpeURI] = c
 		}
 	}
 
-	jsonCpes, err := FetchJSONFeed()
-	if err != nil {
-		return nil, fmt.Errorf("Failed to fetch nvd JSON feed. err : %s", err)
-	}
+	result.Failed = append(result.Failed, jsonFailed...)
 	for _, c := range jsonCpes {
 		if _, ok := cpeURIs[c.CpeURI]; !ok {
 			cpeURIs[c.CpeURI] = c
 		}
 	}
 
-	allCpes := []models.CategorizedCpe{}
 	for _, c := range cpeURIs {
-		allCpes = append(allCpes, c)
+		if option.CountCveRefs {
+			c.Popularity = len(cveRefs[c.Vendor+"::"+c.Product])
+		}
+		result.CPEs = append(result.CPEs, c)
 	}
 
-	return allCpes, nil
+	return result, nil
 }
 
 // FetchCpeDictionary : FetchCpeDictionary
-func FetchCpeDictionary() ([]models.CategorizedCpe, error) {
-	url := "http://nvd.nist.gov/feeds/xml/cpe/dictionary/official-cpe-dictionary_v2.3.xml.gz"
-	log15.Info("Fetching...", "URL", url)
-	resp, body, errs := gorequest.New().Proxy(viper.GetString("http-proxy")).Get(url).End()
-	if len(errs) > 0 || resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP error. errs: %v, url: %s", errs, url)
-	}
-
-	b := bytes.NewBufferString(body)
-	reader, err := gzip.NewReader(b)
-	defer func() {
-		_ = reader.Close()
-	}()
-	if err != nil {
-		return nil, fmt.Errorf("Failed to decompress NVD feedfile. url: %s, err: %s", url, err)
+func FetchCpeDictionary(ctx context.Context, vendors VendorFilter) ([]models.CategorizedCpe, DictionaryStamp, error) {
+	ctx, span := tracer.Start(ctx, "FetchCpeDictionary")
+	defer span.End()
+
+	url := nvdCpeDictionaryURL()
+	if LowMemory {
+		return streamCpeDictionary(ctx, url, vendors)
 	}
-	bytes, err := ioutil.ReadAll(reader)
+	body, err := util.FetchFeedFile(ctx, httpClient(), url, true)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to Read NVD feedfile. url: %s, err: %s", url, err)
+		return nil, DictionaryStamp{}, xerrors.Errorf("Failed to fetch. url: %s, err: %w", url, err)
 	}
+	return decodeCpeDictionary(bytes.NewReader(body), url, vendors)
+}
 
-	var cpeDictionary CpeDictionary
-	if err = xml.Unmarshal(bytes, &cpeDictionary); err != nil {
-		return nil, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", url, err)
+// decodeCpeDictionary decodes the items of the cpe dictionary one by one, skipping those of the vendors filtered out
+// by the name of the cpe-item before decoding the rest of it
+func decodeCpeDictionary(r io.Reader, url string, vendors VendorFilter) ([]models.CategorizedCpe, DictionaryStamp, error) {
+	var dict CpeDictionary
+	cpes := []models.CategorizedCpe{}
+	d := xml.NewDecoder(r)
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, DictionaryStamp{}, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", url, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "generator":
+			if err := d.DecodeElement(&dict.Generator, &start); err != nil {
+				return nil, DictionaryStamp{}, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", url, err)
+			}
+		case "cpe-item":
+			if !allowCpeItem(start, vendors) {
+				if err := d.Skip(); err != nil {
+					return nil, DictionaryStamp{}, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", url, err)
+				}
+				continue
+			}
+			var item CpeItem
+			if err := d.DecodeElement(&item, &start); err != nil {
+				return nil, DictionaryStamp{}, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", url, err)
+			}
+			if c, ok := convertNvdCpeItemToModel(item, vendors); ok {
+				cpes = append(cpes, c)
+			}
+		}
 	}
+	return cpes, parseDictionaryStamp(dict), nil
+}
 
-	var cpes []models.CategorizedCpe
-	if cpes, err = convertNvdCpeDictionaryToModel(cpeDictionary); err != nil {
-		return nil, err
+// allowCpeItem tells whether the vendor of the CPE 2.2 name of the cpe-item is allowed.
+// A name not parsed is left to the cpe23-item, which rejects it or not.
+func allowCpeItem(start xml.StartElement, vendors VendorFilter) bool {
+	if vendors == nil {
+		return true
+	}
+	for _, attr := range start.Attr {
+		if attr.Name.Local != "name" {
+			continue
+		}
+		wfn, err := naming.UnbindURI(attr.Value)
+		if err != nil {
+			return true
+		}
+		return vendors.Allow(wfn.GetString(common.AttributeVendor))
 	}
+	return true
+}
 
-	return cpes, nil
+// parseDictionaryStamp reads the generator element of the cpe dictionary
+func parseDictionaryStamp(dict CpeDictionary) DictionaryStamp {
+	stamp := DictionaryStamp{Version: dict.Generator.ProductVersion}
+	if dict.Generator.Timestamp == "" {
+		return stamp
+	}
+	generatedAt, err := time.Parse(time.RFC3339, dict.Generator.Timestamp)
+	if err != nil {
+		logger.Warn("Failed to parse the timestamp of cpe dictionary", "timestamp", dict.Generator.Timestamp, "err", err)
+		return stamp
+	}
+	stamp.GeneratedAt = &generatedAt
+	return stamp
 }
 
 // FetchJSONFeed : FetchJSONFeed
-func FetchJSONFeed() ([]models.CategorizedCpe, error) {
+// cveRefs maps "vendor::product" to the set of CVE IDs referencing it.
+// The feeds go through the stages of Pipeline, and their CPEs are returned in the order of the years.
+func FetchJSONFeed(ctx context.Context, onError string, vendors VendorFilter) (allCpes []models.CategorizedCpe, cveRefs map[string]map[string]struct{}, failed []FailedFeed, err error) {
+	ctx, span := tracer.Start(ctx, "FetchJSONFeed")
+	defer span.End()
+
 	startYear := 2002
 	years, err := util.GetYearsUntilThisYear(startYear)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
+	urls := makeFeedURLs(years)
 
-	allCpes := []models.CategorizedCpe{}
-	urlBlocks := makeFeedURLBlocks(years, 2)
-	for _, urls := range urlBlocks {
-		nvds, err := fetchFeedFileConcurrently(urls)
-		if err != nil {
-			return nil, fmt.Errorf("Failed to get feeds. err : %s", err)
+	cveRefs = map[string]map[string]struct{}{}
+	feeds := make([][]models.CategorizedCpe, len(urls))
+	stages, buffer := feedStages(downloadNvdFeed, func(ctx context.Context, job *feedJob) (interface{}, error) {
+		return parseNvdFeed(job, vendors)
+	}, func(ctx context.Context, job *feedJob) (interface{}, error) {
+		return transformNvdFeed(job.value.(*V3Feed))
+	})
+	err = runPipeline(ctx, urls, stages, buffer, func(job *feedJob) error {
+		if job.err != nil {
+			f := newFailedFeed(job.url, job.err)
+			if onError == OnErrorFail {
+				return xerrors.Errorf("Failed to get feeds. feeds: %s, err : %w", []FailedFeed{f}, job.err)
+			}
+			logger.Warn("Skip the feed.", "URL", f.URL, "err", f.Err)
+			failed = append(failed, f)
+			return nil
 		}
-		cpes, err := convertNvdV3FeedToModel(nvds)
-		if err != nil {
-			return nil, err
+		feed := job.value.(nvdFeedCpes)
+		feeds[job.index] = feed.cpes
+		for key, ids := range feed.cveRefs {
+			if _, ok := cveRefs[key]; !ok {
+				cveRefs[key] = map[string]struct{}{}
+			}
+			for id := range ids {
+				cveRefs[key][id] = struct{}{}
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, cpes := range feeds {
 		allCpes = append(allCpes, cpes...)
 	}
-	return allCpes, nil
+	return allCpes, cveRefs, failed, nil
 }
 
-// makeFeedURLBlocks : makeFeedURLBlocks
-func makeFeedURLBlocks(years []int, n int) (urlBlocks [][]string) {
+// makeFeedURLs returns the URLs of the JSON feeds of the years
+func makeFeedURLs(years []int) (urls []string) {
 	//  http://nvd.nist.gov/feeds/xml/cve/nvdcve-2.0-2016.xml.gz
-	formatTemplate := "https://nvd.nist.gov/feeds/json/cve/1.1/nvdcve-1.1-%d.json.gz"
-	blockNum := int(math.Ceil(float64(len(years)) / float64(n)))
-	urlBlocks = make([][]string, blockNum, blockNum)
-	var i int
-	for j := range urlBlocks {
-		var urls []string
-		for k := 0; k < n; k++ {
-			urls = append(urls, fmt.Sprintf(formatTemplate, years[i]))
-			i++
-			if len(years) <= i {
-				break
-			}
-		}
-		urlBlocks[j] = urls
+	formatTemplate := NVDBaseURL + "/feeds/json/cve/1.1/nvdcve-1.1-%d.json.gz"
+	for _, year := range years {
+		urls = append(urls, fmt.Sprintf(formatTemplate, year))
 	}
-	return urlBlocks
+	return urls
 }
 
-func fetchFeedFileConcurrently(urls []string) (nvds []V3Feed, err error) {
-	reqChan := make(chan string, len(urls))
-	resChan := make(chan V3Feed, len(urls))
-	errChan := make(chan error, len(urls))
-	defer close(reqChan)
-	defer close(resChan)
-	defer close(errChan)
+// downloadNvdFeed is the download stage of the JSON feeds: the body of a feed, or its temp file under LowMemory
+func downloadNvdFeed(ctx context.Context, job *feedJob) (interface{}, error) {
+	if LowMemory {
+		return openFeedFile(ctx, job.url)
+	}
+	bytes, err := util.FetchFeedFile(ctx, httpClient(), job.url, true)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to fetch. url: %s, err: %w", job.url, err)
+	}
+	return bytes, nil
+}
 
-	go func() {
-		for _, url := range urls {
-			reqChan <- url
-		}
-	}()
+// parseNvdFeed is the parse stage of the JSON feeds, decoding the body or the temp file of downloadNvdFeed
+func parseNvdFeed(job *feedJob, vendors VendorFilter) (interface{}, error) {
+	var r io.Reader
+	switch v := job.value.(type) {
+	case io.ReadCloser:
+		defer v.Close()
+		r = v
+	case []byte:
+		r = bytes.NewReader(v)
+	}
+	nvd, err := decodeNvdFeed(r, vendors)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", job.url, err)
+	}
+	return nvd, nil
+}
 
-	concurrency := len(urls)
-	tasks := util.GenWorkers(concurrency)
-	for range urls {
-		tasks <- func() {
-			select {
-			case url := <-reqChan:
-				nvd, err := fetchFeedFile(url)
-				if err != nil {
-					errChan <- err
-					return
-				}
-				resChan <- *nvd
+// decodeNvdFeed decodes the CVE_Items of a JSON feed one by one, keeping only the CPEs of the vendors allowed
+// and the CVEs with any of them
+func decodeNvdFeed(r io.Reader, vendors VendorFilter) (*V3Feed, error) {
+	nvd := V3Feed{CVEItems: []V3FeedItem{}}
+	d := json.NewDecoder(r)
+	if _, err := d.Token(); err != nil {
+		return nil, err
+	}
+	for d.More() {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key, _ := token.(string); key != "CVE_Items" {
+			var skipped json.RawMessage
+			if err := d.Decode(&skipped); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := d.Token(); err != nil {
+			return nil, err
+		}
+		for d.More() {
+			var item V3FeedItem
+			if err := d.Decode(&item); err != nil {
+				return nil, err
+			}
+			if filterV3FeedItem(&item, vendors) {
+				nvd.CVEItems = append(nvd.CVEItems, item)
 			}
 		}
+		if _, err := d.Token(); err != nil {
+			return nil, err
+		}
 	}
+	return &nvd, nil
+}
 
-	errs := []error{}
-	timeout := time.After(10 * 60 * time.Second)
-	for range urls {
-		select {
-		case nvd := <-resChan:
-			nvds = append(nvds, nvd)
-		case err := <-errChan:
-			errs = append(errs, err)
-		case <-timeout:
-			return nvds, fmt.Errorf("Timeout Fetching Nvd")
+// filterV3FeedItem drops the CPEs of the vendors filtered out from item, and tells whether any CPE is left.
+// A CPE not parsed is kept to be rejected by convertNvdV3FeedToModel.
+func filterV3FeedItem(item *V3FeedItem, vendors VendorFilter) bool {
+	if vendors == nil {
+		return true
+	}
+	left := false
+	for i, node := range item.Configurations.Nodes {
+		cpes := node.Cpe[:0]
+		for _, cpe := range node.Cpe {
+			if wfn, err := naming.UnbindFS(cpe.Cpe23URI); err == nil && !vendors.Allow(wfn.GetString(common.AttributeVendor)) {
+				continue
+			}
+			cpes = append(cpes, cpe)
 		}
+		item.Configurations.Nodes[i].Cpe = cpes
+		left = left || 0 < len(cpes)
 	}
-	if 0 < len(errs) {
-		return nvds, fmt.Errorf("%s", errs)
+	return left
+}
+
+// nvdFeedCpes is the output of the transform stage of a JSON feed
+type nvdFeedCpes struct {
+	cpes    []models.CategorizedCpe
+	cveRefs map[string]map[string]struct{}
+}
+
+// transformNvdFeed is the transform stage of the JSON feeds, converting a feed into its CPEs and the CVEs referencing them
+func transformNvdFeed(nvd *V3Feed) (interface{}, error) {
+	nvds := []V3Feed{*nvd}
+	cpes, err := convertNvdV3FeedToModel(nvds)
+	if err != nil {
+		return nil, err
 	}
-	return nvds, nil
+	cveRefs := map[string]map[string]struct{}{}
+	countNvdV3FeedCveRefs(nvds, cveRefs)
+	return nvdFeedCpes{cpes: cpes, cveRefs: cveRefs}, nil
 }
 
-func fetchFeedFile(url string) (nvd *V3Feed, err error) {
-	bytes, err := util.FetchFeedFile(url, true)
+// convertNvdCpeItemToModel converts a cpe-item, false when it's rejected or of a vendor filtered out
+func convertNvdCpeItemToModel(item CpeItem, vendors VendorFilter) (models.CategorizedCpe, bool) {
+	wfn, err := naming.UnbindFS(item.Cpe23Item.Name)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to fetch. url: %s, err: %s", url, err)
+		reject(models.NVD, item.Cpe23Item.Name, err.Error())
+		return models.CategorizedCpe{}, false
 	}
-	if err = json.Unmarshal(bytes, &nvd); err != nil {
-		return nil, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", url, err)
+	if reason := missingComponent(wfn); reason != "" {
+		reject(models.NVD, item.Cpe23Item.Name, reason)
+		return models.CategorizedCpe{}, false
 	}
-	return nvd, nil
+	if !vendors.Allow(wfn.GetString(common.AttributeVendor)) {
+		return models.CategorizedCpe{}, false
+	}
+	names := []string{}
+	for _, d := range item.Cpe23Item.Deprecations {
+		for _, by := range d.DeprecatedBy {
+			names = append(names, by.Name)
+		}
+	}
+	references := []models.CpeReference{}
+	for _, r := range item.References {
+		references = append(references, models.CpeReference{Type: r.Type, URL: r.Href})
+	}
+	return models.CategorizedCpe{
+		FetchType:       models.NVD,
+		CpeURI:          naming.BindToURI(wfn),
+		CpeFS:           naming.BindToFS(wfn),
+		Part:            wfn.GetString(common.AttributePart),
+		Vendor:          wfn.GetString(common.AttributeVendor),
+		Product:         wfn.GetString(common.AttributeProduct),
+		Version:         wfn.GetString(common.AttributeVersion),
+		Update:          wfn.GetString(common.AttributeUpdate),
+		Edition:         wfn.GetString(common.AttributeEdition),
+		Language:        wfn.GetString(common.AttributeLanguage),
+		SoftwareEdition: wfn.GetString(common.AttributeSwEdition),
+		TargetSoftware:  wfn.GetString(common.AttributeTargetSw),
+		TargetHardware:  wfn.GetString(common.AttributeTargetHw),
+		Other:           wfn.GetString(common.AttributeOther),
+		Deprecated:      item.Deprecated == "true",
+		DeprecatedBy:    deprecatedBy(names),
+		References:      models.JoinReferences(references),
+	}, true
 }
 
-// convertNvdCpeDictionaryToModel :
-func convertNvdCpeDictionaryToModel(nvd CpeDictionary) (cpes []models.CategorizedCpe, err error) {
-	for _, item := range nvd.Items {
-		var wfn common.WellFormedName
-		if wfn, err = naming.UnbindFS(item.Cpe23Item.Name); err != nil {
+// deprecatedBy binds the CPEs in the formatted string replacing a deprecated CPE to the URIs, one per line
+func deprecatedBy(names []string) string {
+	uris := []string{}
+	for _, name := range names {
+		wfn, err := naming.UnbindFS(name)
+		if err != nil {
 			// Logging only
-			log15.Warn("Failed to unbind", item.Cpe23Item.Name, err)
+			logger.Warn("Failed to unbind", name, err)
 			continue
 		}
-		cpes = append(cpes, models.CategorizedCpe{
-			CpeURI:          naming.BindToURI(wfn),
-			CpeFS:           naming.BindToFS(wfn),
-			Part:            wfn.GetString(common.AttributePart),
-			Vendor:          wfn.GetString(common.AttributeVendor),
-			Product:         wfn.GetString(common.AttributeProduct),
-			Version:         wfn.GetString(common.AttributeVersion),
-			Update:          wfn.GetString(common.AttributeUpdate),
-			Edition:         wfn.GetString(common.AttributeEdition),
-			Language:        wfn.GetString(common.AttributeLanguage),
-			SoftwareEdition: wfn.GetString(common.AttributeSwEdition),
-			TargetSoftware:  wfn.GetString(common.AttributeTargetSw),
-			TargetHardware:  wfn.GetString(common.AttributeTargetHw),
-			Other:           wfn.GetString(common.AttributeOther),
-			Deprecated:      item.Deprecated == "true",
-		})
+		uris = append(uris, naming.BindToURI(wfn))
 	}
-	return cpes, nil
+	return strings.Join(uris, "\n")
 }
 
-// convertNvdV3FeedToModel :
+// convertNvdV3FeedToModel : the CPEs of the vendors filtered out are already dropped by decodeNvdFeed
 func convertNvdV3FeedToModel(nvds []V3Feed) (cpes []models.CategorizedCpe, err error) {
 	for _, nvd := range nvds {
 		for _, item := range nvd.CVEItems {
@@ -253,10 +517,15 @@ func convertNvdV3FeedToModel(nvds []V3Feed) (cpes []models.CategorizedCpe, err e
 				for _, cpe := range node.Cpe {
 					var wfn common.WellFormedName
 					if wfn, err = naming.UnbindFS(cpe.Cpe23URI); err != nil {
-						log15.Warn("Failed to unbind cpe.", "CPE URI", cpe.Cpe23URI, "err", err)
+						reject(models.NVD, cpe.Cpe23URI, err.Error())
+						continue
+					}
+					if reason := missingComponent(wfn); reason != "" {
+						reject(models.NVD, cpe.Cpe23URI, reason)
 						continue
 					}
 					cpes = append(cpes, models.CategorizedCpe{
+						FetchType:       models.NVD,
 						CpeURI:          naming.BindToURI(wfn),
 						CpeFS:           naming.BindToFS(wfn),
 						Part:            wfn.GetString(common.AttributePart),
@@ -277,3 +546,24 @@ func convertNvdV3FeedToModel(nvds []V3Feed) (cpes []models.CategorizedCpe, err e
 	}
 	return cpes, nil
 }
+
+// countNvdV3FeedCveRefs : collect CVE IDs per vendor/product into cveRefs
+func countNvdV3FeedCveRefs(nvds []V3Feed, cveRefs map[string]map[string]struct{}) {
+	for _, nvd := range nvds {
+		for _, item := range nvd.CVEItems {
+			for _, node := range item.Configurations.Nodes {
+				for _, cpe := range node.Cpe {
+					wfn, err := naming.UnbindFS(cpe.Cpe23URI)
+					if err != nil {
+						continue
+					}
+					key := wfn.GetString(common.AttributeVendor) + "::" + wfn.GetString(common.AttributeProduct)
+					if _, ok := cveRefs[key]; !ok {
+						cveRefs[key] = map[string]struct{}{}
+					}
+					cveRefs[key][item.Cve.CVEDataMeta.ID] = struct{}{}
+				}
+			}
+		}
+	}
+}
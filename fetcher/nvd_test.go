@@ -0,0 +1,108 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchNVD(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"official-cpe-dictionary_v2.3.xml.gz": "official-cpe-dictionary_v2.3.xml",
+		"nvdcve-1.1-*.json.gz":                "nvdcve-1.1.json",
+	})
+	NVDBaseURL = ts.URL
+	defer func() {
+		NVDBaseURL = DefaultNVDBaseURL
+	}()
+
+	result, err := FetchNVDResult(context.Background(), NVDOption{CountCveRefs: true, OnError: OnErrorFail})
+	if err != nil {
+		t.Fatalf("FetchNVDResult: %s", err)
+	}
+	cpes, stamp := result.CPEs, result.Stamp
+	if len(result.Failed) != 0 {
+		t.Errorf("actual %v, expected no failed feeds", result.Failed)
+	}
+
+	if stamp.Version != "4.9" {
+		t.Errorf("actual %s, expected %s", stamp.Version, "4.9")
+	}
+	generatedAt := time.Date(2021, time.October, 14, 3, 50, 57, 483000000, time.UTC)
+	if stamp.GeneratedAt == nil || !stamp.GeneratedAt.Equal(generatedAt) {
+		t.Errorf("actual %v, expected %s", stamp.GeneratedAt, generatedAt)
+	}
+
+	lines := []string{}
+	for _, c := range cpes {
+		lines = append(lines, fmt.Sprintf("%s\t%d\t%t\n", c.CpeURI, c.Popularity, c.Deprecated))
+	}
+	sort.Strings(lines)
+	assertGolden(t, "nvd", strings.Join(lines, ""))
+
+	referenced := false
+	for _, c := range cpes {
+		if c.CpeURI == "cpe:/a:cybozu:office:10.0.0" && c.DeprecatedBy != "cpe:/a:cybozu:cybozu_office:10.0.0" {
+			t.Errorf("actual %q, expected deprecated by cpe:/a:cybozu:cybozu_office:10.0.0", c.DeprecatedBy)
+		}
+		if c.CpeURI == "cpe:/a:apache:http_server:2.4.49" && c.References == "Product\thttps://httpd.apache.org/" {
+			referenced = true
+		}
+	}
+	if !referenced {
+		t.Errorf("expected cpe:/a:apache:http_server:2.4.49 referencing https://httpd.apache.org/")
+	}
+}
+
+// TestFetchNVDLowMemory checks the feeds streamed from the temp files are fetched as those read into memory
+func TestFetchNVDLowMemory(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"official-cpe-dictionary_v2.3.xml.gz": "official-cpe-dictionary_v2.3.xml",
+		"nvdcve-1.1-*.json.gz":                "nvdcve-1.1.json",
+	})
+	NVDBaseURL, LowMemory, TempDir = ts.URL, true, t.TempDir()
+	defer func() {
+		NVDBaseURL, LowMemory, TempDir = DefaultNVDBaseURL, false, ""
+	}()
+
+	result, err := FetchNVDResult(context.Background(), NVDOption{CountCveRefs: true, OnError: OnErrorFail})
+	if err != nil {
+		t.Fatalf("FetchNVDResult: %s", err)
+	}
+	if result.Stamp.Version != "4.9" {
+		t.Errorf("actual %s, expected %s", result.Stamp.Version, "4.9")
+	}
+	lines := []string{}
+	for _, c := range result.CPEs {
+		lines = append(lines, fmt.Sprintf("%s\t%d\t%t\n", c.CpeURI, c.Popularity, c.Deprecated))
+	}
+	sort.Strings(lines)
+	assertGolden(t, "nvd", strings.Join(lines, ""))
+
+	files, err := os.ReadDir(TempDir)
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("actual %d temp files, expected them removed", len(files))
+	}
+}
+
+// TestFetchNVDDefaultOption checks the zero NVDOption fails on a feed error
+func TestFetchNVDDefaultOption(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"official-cpe-dictionary_v2.3.xml.gz": "official-cpe-dictionary_v2.3.xml",
+	})
+	NVDBaseURL = ts.URL
+	defer func() {
+		NVDBaseURL = DefaultNVDBaseURL
+	}()
+
+	if _, err := FetchNVD(context.Background(), NVDOption{}); err == nil {
+		t.Errorf("actual nil, expected an error for the missing JSON feeds")
+	}
+}
@@ -0,0 +1,203 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// nvdAPIPageSize is resultsPerPage of the requests, the maximum of the API
+	nvdAPIPageSize = 10000
+	// nvdAPIInterval keeps the requests without an API key under the rate limit of the API (5 requests in 30 seconds)
+	nvdAPIInterval = 6 * time.Second
+	// nvdAPIKeyInterval keeps the requests with an API key under the rate limit of the API (50 requests in 30 seconds)
+	nvdAPIKeyInterval = 600 * time.Millisecond
+)
+
+// NVDAPIQuery is passed through to the NVD CPE API
+// https://nvd.nist.gov/developers/products
+type NVDAPIQuery struct {
+	// CpeMatchString is a CPE 2.3 formatted string prefix, e.g. cpe:2.3:*:cisco
+	CpeMatchString string
+	// KeywordSearch matches the words in the titles
+	KeywordSearch string
+}
+
+// Empty tells whether no parameter is given
+func (q NVDAPIQuery) Empty() bool {
+	return q.CpeMatchString == "" && q.KeywordSearch == ""
+}
+
+// Validate fails on a CpeMatchString the API rejects
+func (q NVDAPIQuery) Validate() error {
+	if q.CpeMatchString != "" && !strings.HasPrefix(q.CpeMatchString, "cpe:2.3:") {
+		return fmt.Errorf("Invalid cpeMatchString. It must be in the CPE 2.3 format, e.g. cpe:2.3:*:cisco: %s", q.CpeMatchString)
+	}
+	return nil
+}
+
+// NVDAPIResponse is a page of the NVD CPE API 2.0
+type NVDAPIResponse struct {
+	ResultsPerPage int `json:"resultsPerPage"`
+	StartIndex     int `json:"startIndex"`
+	TotalResults   int `json:"totalResults"`
+	Products       []struct {
+		Cpe struct {
+			Deprecated   bool   `json:"deprecated"`
+			CpeName      string `json:"cpeName"`
+			CpeNameID    string `json:"cpeNameId"`
+			DeprecatedBy []struct {
+				CpeName string `json:"cpeName"`
+			} `json:"deprecatedBy"`
+			Refs []struct {
+				Ref  string `json:"ref"`
+				Type string `json:"type"`
+			} `json:"refs"`
+		} `json:"cpe"`
+	} `json:"products"`
+}
+
+// FetchNVDAPI fetches the CPEs matching query from the NVD CPE API, page by page
+func FetchNVDAPI(ctx context.Context, query NVDAPIQuery, vendors VendorFilter) ([]models.CategorizedCpe, error) {
+	ctx, span := tracer.Start(ctx, "FetchNVDAPI")
+	defer span.End()
+
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	client, interval := httpClient(), nvdAPIInterval
+	if NVDAPIKey != "" {
+		client, interval = nvdAPIKeyClient(client, NVDAPIKey), nvdAPIKeyInterval
+	}
+	cpes := []models.CategorizedCpe{}
+	var requestedAt time.Time
+	for startIndex := 0; ; {
+		u := nvdAPIURL(query, startIndex)
+		bytes, cached := NVDAPICache.get(u)
+		if !cached {
+			// only the requests count for the rate limit, so the cached pages are replayed without waiting
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Until(requestedAt.Add(interval))):
+			}
+			requestedAt = time.Now()
+			var err error
+			if bytes, err = util.FetchFeedFile(ctx, client, u, false); err != nil {
+				return nil, xerrors.Errorf("Failed to fetch. url: %s, err: %w", u, nvdAPIError(err))
+			}
+		}
+		var page NVDAPIResponse
+		if err := json.Unmarshal(bytes, &page); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", u, err)
+		}
+		if !cached {
+			if err := NVDAPICache.put(u, bytes); err != nil {
+				logger.Warn("Failed to cache a page of NVD API.", "url", u, "err", err)
+			}
+		}
+		cpes = append(cpes, convertNvdAPIToModel(page, vendors)...)
+
+		startIndex += len(page.Products)
+		if len(page.Products) == 0 || page.TotalResults <= startIndex {
+			break
+		}
+		logger.Info("Fetched a page of NVD API", "fetched", startIndex, "total", page.TotalResults, "cached", cached)
+	}
+	return cpes, nil
+}
+
+// nvdAPIKeyClient returns a copy of client sending key as the apiKey header
+func nvdAPIKeyClient(client *http.Client, key string) *http.Client {
+	c := *client
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	c.Transport = apiKeyTransport{key: key, next: transport}
+	return &c
+}
+
+// apiKeyTransport sets the apiKey header of the requests
+type apiKeyTransport struct {
+	key  string
+	next http.RoundTripper
+}
+
+func (t apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("apiKey", t.key)
+	return t.next.RoundTrip(req)
+}
+
+func nvdAPIURL(query NVDAPIQuery, startIndex int) string {
+	values := url.Values{}
+	if query.CpeMatchString != "" {
+		values.Set("cpeMatchString", query.CpeMatchString)
+	}
+	if query.KeywordSearch != "" {
+		values.Set("keywordSearch", query.KeywordSearch)
+	}
+	values.Set("resultsPerPage", strconv.Itoa(nvdAPIPageSize))
+	values.Set("startIndex", strconv.Itoa(startIndex))
+	return NVDAPIURL + "?" + values.Encode()
+}
+
+func convertNvdAPIToModel(page NVDAPIResponse, vendors VendorFilter) (cpes []models.CategorizedCpe) {
+	for _, p := range page.Products {
+		wfn, err := naming.UnbindFS(p.Cpe.CpeName)
+		if err != nil {
+			reject(models.NVD, p.Cpe.CpeName, err.Error())
+			continue
+		}
+		if reason := missingComponent(wfn); reason != "" {
+			reject(models.NVD, p.Cpe.CpeName, reason)
+			continue
+		}
+		if !vendors.Allow(wfn.GetString(common.AttributeVendor)) {
+			continue
+		}
+		names := []string{}
+		for _, by := range p.Cpe.DeprecatedBy {
+			names = append(names, by.CpeName)
+		}
+		references := []models.CpeReference{}
+		for _, r := range p.Cpe.Refs {
+			references = append(references, models.CpeReference{Type: r.Type, URL: r.Ref})
+		}
+		cpes = append(cpes, models.CategorizedCpe{
+			FetchType:       models.NVD,
+			CpeURI:          naming.BindToURI(wfn),
+			CpeFS:           naming.BindToFS(wfn),
+			Part:            wfn.GetString(common.AttributePart),
+			Vendor:          wfn.GetString(common.AttributeVendor),
+			Product:         wfn.GetString(common.AttributeProduct),
+			Version:         wfn.GetString(common.AttributeVersion),
+			Update:          wfn.GetString(common.AttributeUpdate),
+			Edition:         wfn.GetString(common.AttributeEdition),
+			Language:        wfn.GetString(common.AttributeLanguage),
+			SoftwareEdition: wfn.GetString(common.AttributeSwEdition),
+			TargetSoftware:  wfn.GetString(common.AttributeTargetSw),
+			TargetHardware:  wfn.GetString(common.AttributeTargetHw),
+			Other:           wfn.GetString(common.AttributeOther),
+			Deprecated:      p.Cpe.Deprecated,
+			CpeNameID:       strings.ToUpper(p.Cpe.CpeNameID),
+			DeprecatedBy:    deprecatedBy(names),
+			References:      models.JoinReferences(references),
+		})
+	}
+	return cpes
+}
@@ -0,0 +1,133 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"golang.org/x/xerrors"
+)
+
+func TestFetchNVDAPI(t *testing.T) {
+	names := []string{
+		"cpe:2.3:o:cisco:ios:12.0:*:*:*:*:*:*:*",
+		"cpe:2.3:o:cisco:ios:12.1:*:*:*:*:*:*:*",
+		"cpe:2.3:h:cisco:asa_5505:-:*:*:*:*:*:*:*",
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("cpeMatchString") != "cpe:2.3:*:cisco" || q.Get("keywordSearch") != "ios" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		start, _ := strconv.Atoi(q.Get("startIndex"))
+		size, _ := strconv.Atoi(q.Get("resultsPerPage"))
+		page := map[string]interface{}{"resultsPerPage": size, "startIndex": start, "totalResults": len(names)}
+		products := []interface{}{}
+		for i := start; i < len(names) && i < start+size; i++ {
+			cpe := map[string]interface{}{"cpeName": names[i], "cpeNameId": fmt.Sprintf("87316812-5f2c-4286-94fe-cc98b9eaef5%d", i), "deprecated": i == 0}
+			if i == 0 {
+				cpe["deprecatedBy"] = []interface{}{map[string]interface{}{"cpeName": names[1]}}
+			}
+			products = append(products, map[string]interface{}{"cpe": cpe})
+		}
+		page["products"] = products
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer ts.Close()
+	NVDAPIURL, nvdAPIPageSize, nvdAPIInterval = ts.URL, 2, 0
+	defer func() {
+		NVDAPIURL, nvdAPIPageSize, nvdAPIInterval = DefaultNVDAPIURL, 10000, 6*time.Second
+	}()
+
+	cpes, err := FetchNVDAPI(context.Background(), NVDAPIQuery{CpeMatchString: "cpe:2.3:*:cisco", KeywordSearch: "ios"}, nil)
+	if err != nil {
+		t.Fatalf("FetchNVDAPI: %s", err)
+	}
+	actual := []string{}
+	for _, c := range cpes {
+		actual = append(actual, strings.TrimSpace(c.CpeURI+" "+strconv.FormatBool(c.Deprecated)+" "+c.CpeNameID+" "+c.DeprecatedBy))
+	}
+	expected := []string{
+		"cpe:/o:cisco:ios:12.0 true 87316812-5F2C-4286-94FE-CC98B9EAEF50 cpe:/o:cisco:ios:12.1",
+		"cpe:/o:cisco:ios:12.1 false 87316812-5F2C-4286-94FE-CC98B9EAEF51",
+		"cpe:/h:cisco:asa_5505:- false 87316812-5F2C-4286-94FE-CC98B9EAEF52",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual %#v, expected %#v", actual, expected)
+	}
+}
+
+func TestNVDAPIQueryValidate(t *testing.T) {
+	if err := (NVDAPIQuery{CpeMatchString: "cpe:/a:cisco"}).Validate(); err == nil {
+		t.Errorf("a CPE 2.2 URI is accepted")
+	}
+	if err := (NVDAPIQuery{KeywordSearch: "cisco"}).Validate(); err != nil {
+		t.Errorf("Validate: %s", err)
+	}
+}
+
+func TestFetchNVDAPIKeyInvalid(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apiKey") != "invalid" {
+			t.Errorf("unexpected apiKey: %s", r.Header.Get("apiKey"))
+		}
+		w.Header().Set("message", "Invalid apiKey")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	NVDAPIURL, NVDAPIKey = ts.URL, "invalid"
+	defer func() {
+		NVDAPIURL, NVDAPIKey = DefaultNVDAPIURL, ""
+	}()
+
+	_, err := FetchNVDAPI(context.Background(), NVDAPIQuery{KeywordSearch: "ios"}, nil)
+	if !xerrors.Is(err, ErrNVDAPIKeyInvalid) {
+		t.Errorf("actual %v, expected %v", err, ErrNVDAPIKeyInvalid)
+	}
+}
+
+func TestNVDAPIError(t *testing.T) {
+	var tests = []struct {
+		in       *util.HTTPError
+		expected error
+		until    string
+	}{
+		{
+			in:       &util.HTTPError{StatusCode: http.StatusServiceUnavailable, Body: "<p>The NVD is undergoing maintenance until 10:00 AM EST.</p>"},
+			expected: ErrNVDAPIMaintenance,
+			until:    "10:00 AM EST",
+		},
+		{
+			in:       &util.HTTPError{StatusCode: http.StatusForbidden},
+			expected: util.ErrRateLimited,
+		},
+		{
+			in: &util.HTTPError{StatusCode: http.StatusInternalServerError},
+		},
+	}
+	for i, tt := range tests {
+		err := nvdAPIError(xerrors.Errorf("Failed to fetch. err: %w", tt.in))
+		var apiErr *NVDAPIError
+		if tt.expected == nil {
+			if xerrors.As(err, &apiErr) {
+				t.Errorf("[%d] actual %v, expected the error as it is", i, err)
+			}
+			continue
+		}
+		if !xerrors.As(err, &apiErr) || !xerrors.Is(err, tt.expected) {
+			t.Errorf("[%d] actual %v, expected %v", i, err, tt.expected)
+			continue
+		}
+		if apiErr.Until != tt.until {
+			t.Errorf("[%d] actual until %q, expected %q", i, apiErr.Until, tt.until)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// ErrNVDAPIKeyInvalid is returned when the NVD API rejects the API key
+	ErrNVDAPIKeyInvalid = xerrors.New("NVD API key invalid")
+	// ErrNVDAPIMaintenance is returned when the NVD API is under maintenance
+	ErrNVDAPIMaintenance = xerrors.New("NVD API under maintenance")
+)
+
+// NVDAPIError is an error response of the NVD API, told by what to do about it
+type NVDAPIError struct {
+	StatusCode int
+	// Message is what the API told of the reason
+	Message string
+	// Until is when the maintenance ends as told by the API, empty when unknown
+	Until string
+	// Action is what to do about it
+	Action string
+
+	kind error
+}
+
+func (e *NVDAPIError) Error() string {
+	msg := e.kind.Error()
+	if e.Until != "" {
+		msg += " until " + e.Until
+	}
+	if e.Message != "" {
+		msg += fmt.Sprintf(" (%d: %s)", e.StatusCode, e.Message)
+	} else {
+		msg += fmt.Sprintf(" (%d)", e.StatusCode)
+	}
+	return msg + ". " + e.Action
+}
+
+// Unwrap returns ErrNVDAPIKeyInvalid, ErrNVDAPIMaintenance or util.ErrRateLimited
+func (e *NVDAPIError) Unwrap() error {
+	return e.kind
+}
+
+// maintenanceUntil finds when the maintenance ends in the message or the page of the API, e.g. "until 10:00 AM EST"
+var maintenanceUntil = regexp.MustCompile(`(?i)\buntil\s+([^.<\n]+)`)
+
+// nvdAPIError maps an error response of the NVD API to NVDAPIError, and returns the others as they are
+func nvdAPIError(err error) error {
+	var httpErr *util.HTTPError
+	if !xerrors.As(err, &httpErr) {
+		return err
+	}
+	message := strings.TrimSpace(httpErr.Message)
+	text := strings.ToLower(message + " " + httpErr.Body)
+	e := &NVDAPIError{StatusCode: httpErr.StatusCode, Message: message}
+	switch {
+	case strings.Contains(text, "apikey") || strings.Contains(text, "api key") || httpErr.StatusCode == http.StatusUnauthorized:
+		e.kind = ErrNVDAPIKeyInvalid
+		e.Action = "Check --api-key, or request a new key at https://nvd.nist.gov/developers/request-an-api-key"
+	case strings.Contains(text, "maintenance") || httpErr.StatusCode == http.StatusServiceUnavailable:
+		e.kind = ErrNVDAPIMaintenance
+		if m := maintenanceUntil.FindStringSubmatch(message + "\n" + httpErr.Body); m != nil {
+			e.Until = strings.TrimSpace(m[1])
+		} else {
+			e.Until = retryAfter(httpErr.RetryAfter)
+		}
+		e.Action = "Retry after the maintenance, or fetch the feeds without --cpe-match-string and --keyword-search"
+	case httpErr.StatusCode == http.StatusForbidden || httpErr.StatusCode == http.StatusTooManyRequests:
+		// the API answers 403 beyond the rate limit
+		e.kind = util.ErrRateLimited
+		e.Action = "Give --api-key to raise the rate limit, or retry later"
+	default:
+		return err
+	}
+	return e
+}
+
+// retryAfter returns the time of the Retry-After header in seconds or in the HTTP date, empty when it's neither
+func retryAfter(header string) string {
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Now().Add(time.Duration(seconds) * time.Second).Format(time.RFC3339)
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return t.Format(time.RFC3339)
+	}
+	return ""
+}
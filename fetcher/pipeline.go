@@ -0,0 +1,153 @@
+package fetcher
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// Stages is the number of the workers of each stage of the fetch of the feeds, download → parse → transform.
+// The stages are connected by channels of Buffer feeds, so that a slow stage holds back the ones before it
+// instead of piling the feeds up in memory, while the downloads overlap the decoding of the feeds fetched before.
+type Stages struct {
+	// Download is the number of the feeds downloaded concurrently (default: 2)
+	Download int
+	// Parse is the number of the feeds decoded concurrently (default: the number of CPUs)
+	Parse int
+	// Transform is the number of the feeds converted into the CPEs concurrently (default: the number of CPUs)
+	Transform int
+	// Buffer is the number of the feeds waiting between two stages (default: 1)
+	Buffer int
+}
+
+// Pipeline is the workers of the stages of FetchNVD and FetchJVN, the defaults on the zero values.
+// LowMemory overrides it: a feed is downloaded while another is decoded and converted by a single worker.
+var Pipeline Stages
+
+// withDefaults fills the zero values of s with the defaults
+func (s Stages) withDefaults() Stages {
+	if s.Download <= 0 {
+		s.Download = 2
+	}
+	if s.Parse <= 0 {
+		s.Parse = runtime.NumCPU()
+	}
+	if s.Transform <= 0 {
+		s.Transform = runtime.NumCPU()
+	}
+	if s.Buffer <= 0 {
+		s.Buffer = 1
+	}
+	return s
+}
+
+// feedJob is a feed going through the stages, index being its order in the feeds fetched
+type feedJob struct {
+	index int
+	url   string
+	// value is the output of the last stage the feed went through, e.g. the body downloaded or the document parsed
+	value interface{}
+	err   error
+}
+
+// stageFunc is a stage taking the value of the job from the stage before it, which it releases on an error
+type stageFunc func(ctx context.Context, job *feedJob) (interface{}, error)
+
+// stage is a stageFunc run by workers goroutines
+type stage struct {
+	workers int
+	fn      stageFunc
+}
+
+// feedStages returns the stages of Pipeline, the parse and the transform of a feed by one worker in a row under LowMemory
+func feedStages(download, parse, transform stageFunc) ([]stage, int) {
+	if LowMemory {
+		return []stage{
+			{workers: 1, fn: download},
+			{workers: 1, fn: func(ctx context.Context, job *feedJob) (interface{}, error) {
+				v, err := parse(ctx, job)
+				if err != nil {
+					return nil, err
+				}
+				return transform(ctx, &feedJob{index: job.index, url: job.url, value: v})
+			}},
+		}, 0
+	}
+	s := Pipeline.withDefaults()
+	return []stage{
+		{workers: s.Download, fn: download},
+		{workers: s.Parse, fn: parse},
+		{workers: s.Transform, fn: transform},
+	}, s.Buffer
+}
+
+// runPipeline sends the feeds of urls through the stages, and passes each of them to sink as it comes out of the last one, in any order.
+// A feed failing a stage skips the rest with its err. When sink returns an error, the feeds left are released and the error is returned.
+func runPipeline(ctx context.Context, urls []string, stages []stage, buffer int, sink func(job *feedJob) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	in := make(chan *feedJob, buffer)
+	go func() {
+		defer close(in)
+		for i, url := range urls {
+			in <- &feedJob{index: i, url: url}
+		}
+	}()
+	var out <-chan *feedJob = in
+	for _, s := range stages {
+		out = runStage(ctx, s, out, buffer)
+	}
+
+	// every feed comes out of the last stage, so that no worker is left blocked and no temp file is left behind
+	var err error
+	for job := range out {
+		if err != nil {
+			releaseValue(job.value)
+			continue
+		}
+		if err = sink(job); err != nil {
+			cancel()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// runStage runs s by its workers on the feeds of in, sending them to the channel returned, closed when in is drained
+func runStage(ctx context.Context, s stage, in <-chan *feedJob, buffer int) <-chan *feedJob {
+	out := make(chan *feedJob, buffer)
+	var wg sync.WaitGroup
+	for w := 0; w < s.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range in {
+				if job.err == nil {
+					if err := ctx.Err(); err != nil {
+						releaseValue(job.value)
+						job.value, job.err = nil, err
+					} else {
+						job.value, job.err = s.fn(ctx, job)
+					}
+				}
+				out <- job
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// releaseValue closes the value of a feed not going through the stages, e.g. the temp file of LowMemory
+func releaseValue(value interface{}) {
+	if c, ok := value.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
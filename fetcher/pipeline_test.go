@@ -0,0 +1,104 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/xerrors"
+)
+
+// countedFile is the value of the download stage, counting the ones left open
+type countedFile struct {
+	open *int64
+}
+
+func (f countedFile) Close() error {
+	atomic.AddInt64(f.open, -1)
+	return nil
+}
+
+func TestRunPipeline(t *testing.T) {
+	urls := []string{}
+	for i := 0; i < 20; i++ {
+		urls = append(urls, fmt.Sprintf("feed-%d", i))
+	}
+
+	var open int64
+	download := func(ctx context.Context, job *feedJob) (interface{}, error) {
+		atomic.AddInt64(&open, 1)
+		return countedFile{open: &open}, nil
+	}
+	parse := func(ctx context.Context, job *feedJob) (interface{}, error) {
+		defer job.value.(countedFile).Close()
+		if job.url == "feed-3" {
+			return nil, xerrors.New("broken")
+		}
+		return job.url, nil
+	}
+	transform := func(ctx context.Context, job *feedJob) (interface{}, error) {
+		return job.value.(string) + " transformed", nil
+	}
+	stages := []stage{{workers: 3, fn: download}, {workers: 2, fn: parse}, {workers: 4, fn: transform}}
+
+	feeds, failed := make([]string, len(urls)), []string{}
+	if err := runPipeline(context.Background(), urls, stages, 1, func(job *feedJob) error {
+		if job.err != nil {
+			failed = append(failed, job.url)
+			return nil
+		}
+		feeds[job.index] = job.value.(string)
+		return nil
+	}); err != nil {
+		t.Fatalf("runPipeline: %s", err)
+	}
+	for i, f := range feeds {
+		if expected := fmt.Sprintf("feed-%d transformed", i); i != 3 && f != expected {
+			t.Errorf("[%d] actual %q, expected %q", i, f, expected)
+		}
+	}
+	if len(failed) != 1 || failed[0] != "feed-3" {
+		t.Errorf("actual failed %v, expected feed-3", failed)
+	}
+
+	// the feeds left after an error of the sink are released
+	sunk := []string{}
+	err := runPipeline(context.Background(), urls, stages, 1, func(job *feedJob) error {
+		sunk = append(sunk, job.url)
+		return xerrors.New("stop")
+	})
+	if err == nil || err.Error() != "stop" {
+		t.Errorf("actual %v, expected stop", err)
+	}
+	if len(sunk) != 1 {
+		t.Errorf("actual %v, expected a feed sunk", sunk)
+	}
+	if open != 0 {
+		t.Errorf("actual %d files left open, expected none", open)
+	}
+
+	// the stages of LowMemory
+	LowMemory = true
+	defer func() {
+		LowMemory = false
+	}()
+	stages, buffer := feedStages(download, parse, transform)
+	if len(stages) != 2 || buffer != 0 {
+		t.Fatalf("actual %d stages, buffer %d, expected 2 stages without a buffer", len(stages), buffer)
+	}
+	sunk = []string{}
+	if err := runPipeline(context.Background(), urls, stages, buffer, func(job *feedJob) error {
+		if job.err == nil {
+			sunk = append(sunk, job.value.(string))
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("runPipeline: %s", err)
+	}
+	sort.Strings(sunk)
+	if len(sunk) != len(urls)-1 || sunk[0] != "feed-0 transformed" {
+		t.Errorf("actual %v", sunk)
+	}
+}
@@ -0,0 +1,209 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RawManifest lists the raw payloads archived by a fetch
+type RawManifest struct {
+	FetchedAt time.Time    `json:"fetchedAt"`
+	Payloads  []RawPayload `json:"payloads"`
+}
+
+// RawPayload is a payload archived as objects/<SHA256>(.gz)
+type RawPayload struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// KeepRaw archives the raw payloads fetched by HTTPClient to dir. They are stored under dir/objects,
+// compressed and named by the SHA-256 of the content, so a payload fetched by several runs is stored once.
+// Call the returned func after the fetch to write the manifest of the run, which ReplayRaw replays.
+func KeepRaw(dir string) (func() (string, error), error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0700); err != nil {
+		return nil, fmt.Errorf("Failed to create dir. dir: %s, err: %s", dir, err)
+	}
+	client := httpClient()
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	rec := &rawRecorder{next: next, dir: dir}
+	HTTPClient = &http.Client{Transport: rec, Timeout: client.Timeout}
+
+	return func() (string, error) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		manifest := RawManifest{FetchedAt: time.Now().UTC(), Payloads: rec.payloads}
+		b, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("Failed to marshal manifest. err: %s", err)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("manifest-%s.json", manifest.FetchedAt.Format("20060102T150405Z")))
+		if err := ioutil.WriteFile(path, b, 0600); err != nil {
+			return "", fmt.Errorf("Failed to write manifest. path: %s, err: %s", path, err)
+		}
+		return path, nil
+	}, nil
+}
+
+// rawRecorder archives the bodies of the successful responses
+type rawRecorder struct {
+	next http.RoundTripper
+	dir  string
+
+	mu       sync.Mutex
+	payloads []RawPayload
+}
+
+func (rec *rawRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rec.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	if err := storeObject(rec.dir, hash, body); err != nil {
+		return nil, err
+	}
+	rec.mu.Lock()
+	rec.payloads = append(rec.payloads, RawPayload{URL: req.URL.String(), SHA256: hash})
+	rec.mu.Unlock()
+	return resp, nil
+}
+
+// storeObject writes body as dir/objects/<hash>, gzipped as dir/objects/<hash>.gz unless it's already gzipped
+func storeObject(dir, hash string, body []byte) error {
+	path := filepath.Join(dir, "objects", hash)
+	data := body
+	if !isGzipped(body) {
+		path += ".gz"
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return fmt.Errorf("Failed to compress payload. err: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("Failed to compress payload. err: %s", err)
+		}
+		data = buf.Bytes()
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	// write to a temp file first not to leave a partial object named by the hash
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("Failed to write payload. path: %s, err: %s", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("Failed to rename payload. path: %s, err: %s", path, err)
+	}
+	return nil
+}
+
+func isGzipped(b []byte) bool {
+	return 2 <= len(b) && b[0] == 0x1f && b[1] == 0x8b
+}
+
+// ReplayRaw makes HTTPClient answer with the payloads archived by KeepRaw instead of fetching them.
+// Requests are matched by the path and query, so the manifest can be replayed regardless of --base-url.
+func ReplayRaw(manifestPath string) error {
+	b, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read manifest. path: %s, err: %s", manifestPath, err)
+	}
+	var manifest RawManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return fmt.Errorf("Failed to unmarshal manifest. path: %s, err: %s", manifestPath, err)
+	}
+	rep := &rawReplayer{dir: filepath.Dir(manifestPath), hashes: map[string]string{}}
+	for _, p := range manifest.Payloads {
+		req, err := http.NewRequest(http.MethodGet, p.URL, nil)
+		if err != nil {
+			return fmt.Errorf("Invalid URL in manifest. url: %s, err: %s", p.URL, err)
+		}
+		rep.hashes[req.URL.RequestURI()] = p.SHA256
+	}
+	HTTPClient = &http.Client{Transport: rep}
+	return nil
+}
+
+// rawReplayer answers the requests with the archived payloads, or 404 when not archived
+type rawReplayer struct {
+	dir    string
+	hashes map[string]string
+}
+
+func (rep *rawReplayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		Status:     "404 Not Found",
+		StatusCode: http.StatusNotFound,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		Request:    req,
+	}
+	hash, ok := rep.hashes[req.URL.RequestURI()]
+	if !ok {
+		return resp, nil
+	}
+
+	body, err := readObject(rep.dir, hash)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read archived payload. url: %s, err: %s", req.URL, err)
+	}
+
+	resp.Status, resp.StatusCode = "200 OK", http.StatusOK
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+// readObject reads the object written by storeObject, failing when its content doesn't have the hash
+func readObject(dir, hash string) ([]byte, error) {
+	path := filepath.Join(dir, "objects", hash)
+	body, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		var gz []byte
+		if gz, err = ioutil.ReadFile(path + ".gz"); err == nil {
+			body, err = gunzip(gz)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(body); hex.EncodeToString(sum[:]) != hash {
+		return nil, fmt.Errorf("The object is corrupted. sha256: %s", hash)
+	}
+	return body, nil
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
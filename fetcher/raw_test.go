@@ -0,0 +1,60 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestKeepRawAndReplay(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"*.rdf": "jvndb.rdf",
+	})
+	JVNBaseURL = ts.URL
+	defer func() {
+		JVNBaseURL = DefaultJVNBaseURL
+	}()
+
+	dir := t.TempDir()
+	writeManifest, err := KeepRaw(dir)
+	if err != nil {
+		t.Fatalf("KeepRaw: %s", err)
+	}
+	if _, err := FetchJVN(context.Background()); err != nil {
+		t.Fatalf("FetchJVN: %s", err)
+	}
+	manifest, err := writeManifest()
+	if err != nil {
+		t.Fatalf("writeManifest: %s", err)
+	}
+
+	// every feed serves the same content, so it's stored once
+	objects, err := ioutil.ReadDir(filepath.Join(dir, "objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || filepath.Ext(objects[0].Name()) != ".gz" {
+		t.Errorf("actual %d objects, expected 1 compressed object", len(objects))
+	}
+
+	// replayed without the server, from another base URL
+	ts.Close()
+	JVNBaseURL = "https://mirror.example.com"
+	if err := ReplayRaw(manifest); err != nil {
+		t.Fatalf("ReplayRaw: %s", err)
+	}
+	cpes, err := FetchJVN(context.Background())
+	if err != nil {
+		t.Fatalf("FetchJVN: %s", err)
+	}
+	lines := []string{}
+	for _, c := range cpes {
+		lines = append(lines, fmt.Sprintf("%s\t%s\n", c.CpeURI, c.Title))
+	}
+	sort.Strings(lines)
+	assertGolden(t, "jvn", strings.Join(lines, ""))
+}
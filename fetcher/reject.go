@@ -0,0 +1,98 @@
+package fetcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+// maxRejects bounds the rejected CPEs kept until TakeRejects, so that a broken feed doesn't exhaust the memory
+const maxRejects = 100000
+
+var rejects = struct {
+	sync.Mutex
+	cpes    []models.RejectedCpe
+	dropped int
+}{}
+
+// reject skips a CPE of the feed of the source that can't be parsed or misses a component, keeping it for TakeRejects
+func reject(source models.FetchType, cpe, reason string) {
+	logger.Warn("Reject the CPE.", "source", source, "CPE", cpe, "reason", reason)
+	rejects.Lock()
+	defer rejects.Unlock()
+	if maxRejects <= len(rejects.cpes) {
+		rejects.dropped++
+		return
+	}
+	rejects.cpes = append(rejects.cpes, models.RejectedCpe{FetchType: source, Cpe: cpe, Reason: reason, RejectedAt: time.Now().UTC()})
+}
+
+// TakeRejects returns the CPEs rejected by the fetches since the last call and forgets them,
+// with the number of the ones not kept beyond the bound
+func TakeRejects() ([]models.RejectedCpe, int) {
+	rejects.Lock()
+	defer rejects.Unlock()
+	cpes, dropped := rejects.cpes, rejects.dropped
+	rejects.cpes, rejects.dropped = nil, 0
+	return cpes, dropped
+}
+
+// missingComponent returns the reason to reject a WFN without the vendor or the product, or ""
+func missingComponent(wfn common.WellFormedName) string {
+	for _, a := range []string{common.AttributeVendor, common.AttributeProduct} {
+		switch wfn.GetString(a) {
+		case "", "ANY", "NA":
+			return "missing " + a
+		}
+	}
+	return ""
+}
+
+// Reparse parses a rejected CPE again as its source does, e.g. after the parser is fixed by an upgrade.
+// The attributes out of the CPE name, e.g. the title and the deprecation of NVD, are not restored.
+func Reparse(r models.RejectedCpe) (models.CategorizedCpe, error) {
+	if r.FetchType == models.Windows {
+		c, ok, err := convertWindowsProductToModel(r.Cpe)
+		if err != nil {
+			return models.CategorizedCpe{}, err
+		}
+		if !ok {
+			return models.CategorizedCpe{}, xerrors.New("not a Windows product")
+		}
+		return c, nil
+	}
+
+	var wfn common.WellFormedName
+	var err error
+	if r.FetchType == models.JVN {
+		wfn, err = naming.UnbindURI(r.Cpe)
+	} else {
+		wfn, err = naming.UnbindFS(r.Cpe)
+	}
+	if err != nil {
+		return models.CategorizedCpe{}, err
+	}
+	if reason := missingComponent(wfn); reason != "" {
+		return models.CategorizedCpe{}, xerrors.New(reason)
+	}
+	return models.CategorizedCpe{
+		FetchType:       r.FetchType,
+		CpeURI:          naming.BindToURI(wfn),
+		CpeFS:           naming.BindToFS(wfn),
+		Part:            wfn.GetString(common.AttributePart),
+		Vendor:          wfn.GetString(common.AttributeVendor),
+		Product:         wfn.GetString(common.AttributeProduct),
+		Version:         wfn.GetString(common.AttributeVersion),
+		Update:          wfn.GetString(common.AttributeUpdate),
+		Edition:         wfn.GetString(common.AttributeEdition),
+		Language:        wfn.GetString(common.AttributeLanguage),
+		SoftwareEdition: wfn.GetString(common.AttributeSwEdition),
+		TargetSoftware:  wfn.GetString(common.AttributeTargetSw),
+		TargetHardware:  wfn.GetString(common.AttributeTargetHw),
+		Other:           wfn.GetString(common.AttributeOther),
+	}, nil
+}
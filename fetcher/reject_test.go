@@ -0,0 +1,56 @@
+package fetcher
+
+import (
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func TestRejects(t *testing.T) {
+	TakeRejects()
+	cpes, err := convertJvnCpesToModel([]cpe{
+		{Value: "cpe:/a:ntp:ntp:4.2.8"},
+		{Value: "cpe:/a:ntp"},
+		{Value: "cpe:a:ntp:ntp"},
+	})
+	if err != nil {
+		t.Fatalf("convertJvnCpesToModel: %s", err)
+	}
+	if len(cpes) != 1 || cpes[0].CpeURI != "cpe:/a:ntp:ntp:4.2.8" {
+		t.Errorf("actual %#v", cpes)
+	}
+
+	rejects, dropped := TakeRejects()
+	if len(rejects) != 2 || dropped != 0 {
+		t.Fatalf("actual %#v, %d", rejects, dropped)
+	}
+	if r := rejects[0]; r.FetchType != models.JVN || r.Cpe != "cpe:/a:ntp" || r.Reason != "missing product" {
+		t.Errorf("actual %#v", r)
+	}
+	if r := rejects[1]; r.Cpe != "cpe:a:ntp:ntp" || r.Reason == "" {
+		t.Errorf("actual %#v", r)
+	}
+	if rejects, _ := TakeRejects(); len(rejects) != 0 {
+		t.Errorf("actual %#v, expected forgotten", rejects)
+	}
+}
+
+func TestReparse(t *testing.T) {
+	c, err := Reparse(models.RejectedCpe{FetchType: models.NVD, Cpe: "cpe:2.3:a:ntp:ntp:4.2.8:*:*:*:*:*:*:*"})
+	if err != nil {
+		t.Fatalf("Reparse: %s", err)
+	}
+	if c.FetchType != models.NVD || c.CpeURI != "cpe:/a:ntp:ntp:4.2.8" || c.Vendor != "ntp" || c.Version != "4.2.8" {
+		t.Errorf("actual %#v", c)
+	}
+
+	for _, r := range []models.RejectedCpe{
+		{FetchType: models.JVN, Cpe: "cpe:/a:ntp"},
+		{FetchType: models.JVN, Cpe: "cpe:a:ntp:ntp"},
+		{FetchType: models.Windows, Cpe: "Microsoft Office 2019"},
+	} {
+		if c, err := Reparse(r); err == nil {
+			t.Errorf("%s: actual %#v, expected an error", r.Cpe, c)
+		}
+	}
+}
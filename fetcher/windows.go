@@ -0,0 +1,179 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/util"
+	"golang.org/x/xerrors"
+)
+
+// msrcUpdates ... https://api.msrc.microsoft.com/cvrf/v3.0/updates
+type msrcUpdates struct {
+	Value []struct {
+		ID string `json:"ID"` // e.g. 2024-Jan
+	} `json:"value"`
+}
+
+// cvrfDoc is the product tree of a monthly CVRF document of MSRC
+type cvrfDoc struct {
+	ProductTree cvrfBranch `xml:"ProductTree"`
+}
+
+type cvrfBranch struct {
+	Branches []cvrfBranch `xml:"Branch"`
+	Products []string     `xml:"FullProductName"`
+}
+
+func (b cvrfBranch) productNames() []string {
+	names := append([]string{}, b.Products...)
+	for _, branch := range b.Branches {
+		names = append(names, branch.productNames()...)
+	}
+	return names
+}
+
+var (
+	// e.g. Windows 10 Version 1809 for x64-based Systems, Windows 7 for 32-bit Systems Service Pack 1
+	windowsClientRe = regexp.MustCompile(`^Windows (7|8\.1|RT 8\.1|10|11)(?: Version (\w+))?(?: for ([\w-]+?)(?:-[Bb]ased)? [Ss]ystems)?(?: Service Pack (\d))?$`)
+	// e.g. Windows Server 2008 R2 for x64-based Systems Service Pack 1 (Server Core installation)
+	windowsServerRe = regexp.MustCompile(`^Windows Server (\d{4})( R2)?(?: for ([\w-]+?)(?:-[Bb]ased)? [Ss]ystems)?(?: Service Pack (\d))?$`)
+	// e.g. Windows Server, version 20H2 (Server Core Installation)
+	windowsServerVersionRe = regexp.MustCompile(`^Windows Server, version (\w+)$`)
+	serverCoreRe           = regexp.MustCompile(`(?i) \(Server Core installation\)$`)
+)
+
+var windowsTargetHardware = map[string]string{
+	"x64":     "x64",
+	"32-bit":  "x86",
+	"ARM64":   "arm64",
+	"ARM":     "arm",
+	"Itanium": "itanium",
+}
+
+// FetchWindows fetches the Windows products of the MSRC security updates
+func FetchWindows(ctx context.Context) ([]models.CategorizedCpe, error) {
+	ctx, span := tracer.Start(ctx, "FetchWindows")
+	defer span.End()
+
+	client := httpClient()
+	url := MSRCBaseURL + "/cvrf/v3.0/updates"
+	bytes, err := util.FetchFeedFile(ctx, client, url, false)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to fetch. url: %s, err: %w", url, err)
+	}
+	var updates msrcUpdates
+	if err := json.Unmarshal(bytes, &updates); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", url, err)
+	}
+
+	cpeURIs := map[string]models.CategorizedCpe{}
+	for _, update := range updates.Value {
+		url := fmt.Sprintf("%s/cvrf/v3.0/cvrf/%s", MSRCBaseURL, update.ID)
+		bytes, err := util.FetchFeedFile(ctx, client, url, false)
+		if err != nil {
+			return nil, xerrors.Errorf("Failed to fetch. url: %s, err: %w", url, err)
+		}
+		var doc cvrfDoc
+		if err := xml.Unmarshal(bytes, &doc); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal. url: %s, err: %s", url, err)
+		}
+
+		for _, name := range doc.ProductTree.productNames() {
+			c, ok, err := convertWindowsProductToModel(name)
+			if err != nil {
+				reject(models.Windows, name, err.Error())
+				continue
+			}
+			if !ok {
+				// Office, Exchange, etc. aren't Windows products
+				continue
+			}
+			// the shortest name, without the Server Core suffix etc., is the title
+			if prev, ok := cpeURIs[c.CpeURI]; !ok || len(c.Title) < len(prev.Title) {
+				cpeURIs[c.CpeURI] = c
+			}
+		}
+	}
+
+	allCpes := []models.CategorizedCpe{}
+	for _, c := range cpeURIs {
+		allCpes = append(allCpes, c)
+	}
+	return allCpes, nil
+}
+
+// windowsFS maps a product name of MSRC to the CPE of NVD, false when it isn't a Windows product
+func windowsFS(name string) (string, bool) {
+	name = serverCoreRe.ReplaceAllString(strings.Join(strings.Fields(name), " "), "")
+
+	var product, version, update, hw string
+	if m := windowsClientRe.FindStringSubmatch(name); m != nil {
+		product = "windows_" + strings.ToLower(strings.ReplaceAll(m[1], " ", "_"))
+		version, hw = strings.ToLower(m[2]), m[3]
+		if m[4] != "" {
+			update = "sp" + m[4]
+		}
+	} else if m := windowsServerRe.FindStringSubmatch(name); m != nil {
+		product = "windows_server_" + m[1]
+		version, hw = strings.ToLower(strings.TrimSpace(m[2])), m[3]
+		if m[4] != "" {
+			update = "sp" + m[4]
+		}
+	} else if m := windowsServerVersionRe.FindStringSubmatch(name); m != nil {
+		product = "windows_server_" + strings.ToLower(m[1])
+	} else {
+		return "", false
+	}
+
+	if version == "" {
+		version = "-"
+	}
+	if update == "" {
+		update = "*"
+	}
+	targetHW := "*"
+	if hw != "" {
+		h, ok := windowsTargetHardware[hw]
+		if !ok {
+			return "", false
+		}
+		targetHW = h
+	}
+	return fmt.Sprintf("cpe:2.3:o:microsoft:%s:%s:%s:*:*:*:*:%s:*", product, version, update, targetHW), true
+}
+
+func convertWindowsProductToModel(name string) (models.CategorizedCpe, bool, error) {
+	fs, ok := windowsFS(name)
+	if !ok {
+		return models.CategorizedCpe{}, false, nil
+	}
+	wfn, err := naming.UnbindFS(fs)
+	if err != nil {
+		return models.CategorizedCpe{}, false, err
+	}
+	return models.CategorizedCpe{
+		FetchType:       models.Windows,
+		CpeURI:          naming.BindToURI(wfn),
+		CpeFS:           naming.BindToFS(wfn),
+		Part:            wfn.GetString(common.AttributePart),
+		Vendor:          wfn.GetString(common.AttributeVendor),
+		Product:         wfn.GetString(common.AttributeProduct),
+		Version:         wfn.GetString(common.AttributeVersion),
+		Update:          wfn.GetString(common.AttributeUpdate),
+		Edition:         wfn.GetString(common.AttributeEdition),
+		Language:        wfn.GetString(common.AttributeLanguage),
+		SoftwareEdition: wfn.GetString(common.AttributeSwEdition),
+		TargetSoftware:  wfn.GetString(common.AttributeTargetSw),
+		TargetHardware:  wfn.GetString(common.AttributeTargetHw),
+		Other:           wfn.GetString(common.AttributeOther),
+		Title:           strings.TrimSpace(name),
+	}, true, nil
+}
@@ -0,0 +1,33 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFetchWindows(t *testing.T) {
+	ts := newTestServer(t, map[string]string{
+		"updates":  "msrc-updates.json",
+		"2023-Dec": "msrc-2023-Dec.xml",
+		"2024-Jan": "msrc-2024-Jan.xml",
+	})
+	MSRCBaseURL = ts.URL
+	defer func() {
+		MSRCBaseURL = DefaultMSRCBaseURL
+	}()
+
+	cpes, err := FetchWindows(context.Background())
+	if err != nil {
+		t.Fatalf("FetchWindows: %s", err)
+	}
+
+	lines := []string{}
+	for _, c := range cpes {
+		lines = append(lines, fmt.Sprintf("%s\t%s\n", c.CpeFS, c.Title))
+	}
+	sort.Strings(lines)
+	assertGolden(t, "windows", strings.Join(lines, ""))
+}
@@ -0,0 +1,195 @@
+// Package fixture generates a small deterministic dictionary for the integration tests of the downstream projects.
+// The same CPEs are generated on every call and every version of the package unless the fixture is changed on purpose.
+package fixture
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+// FetchedAt is the LastFetchedAt of the fixture, fixed so that the DB is the same on every run
+var FetchedAt = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Version is stored as the NVDDictVersion of the fixture, to tell it from the DB fetched from NVD
+const Version = "fixture-1"
+
+// entry is a CPE of the fixture in the formatted string binding
+type entry struct {
+	fs         string
+	fetchType  models.FetchType
+	deprecated bool
+	// deprecatedBy is the CPE replacing the deprecated one in the formatted string binding
+	deprecatedBy string
+	title        string
+}
+
+// popularities are the numbers of the CVEs referencing the vendor/products of NVD, made up
+var popularities = map[string]int{
+	"apache::http_server":    250,
+	"openssl::openssl":       180,
+	"nginx::nginx":           90,
+	"linux::linux_kernel":    300,
+	"microsoft::windows_10":  400,
+	"python::python":         120,
+	"postgresql::postgresql": 60,
+	"cisco::ios":             70,
+	"cisco::catalyst_2960":   10,
+}
+
+func entries() []entry {
+	es := []entry{}
+	nvd := func(format string, args ...interface{}) {
+		es = append(es, entry{fs: fmt.Sprintf(format, args...), fetchType: models.NVD})
+	}
+
+	for i := 0; i <= 58; i++ {
+		nvd(`cpe:2.3:a:apache:http_server:2.4.%d:*:*:*:*:*:*:*`, i)
+	}
+	nvd(`cpe:2.3:a:openssl:openssl:1.0.2:*:*:*:*:*:*:*`)
+	for c := 'a'; c <= 'u'; c++ {
+		nvd(`cpe:2.3:a:openssl:openssl:1.0.2%c:*:*:*:*:*:*:*`, c)
+	}
+	nvd(`cpe:2.3:a:openssl:openssl:1.1.1:*:*:*:*:*:*:*`)
+	for c := 'a'; c <= 'w'; c++ {
+		nvd(`cpe:2.3:a:openssl:openssl:1.1.1%c:*:*:*:*:*:*:*`, c)
+	}
+	for i := 0; i <= 12; i++ {
+		nvd(`cpe:2.3:a:openssl:openssl:3.0.%d:*:*:*:*:*:*:*`, i)
+	}
+	for _, minor := range []struct{ minor, last int }{{20, 2}, {21, 6}, {22, 1}, {23, 4}, {24, 0}, {25, 3}} {
+		for i := 0; i <= minor.last; i++ {
+			nvd(`cpe:2.3:a:nginx:nginx:1.%d.%d:*:*:*:*:*:*:*`, minor.minor, i)
+		}
+	}
+	for i := 0; i <= 39; i++ {
+		nvd(`cpe:2.3:o:linux:linux_kernel:6.1.%d:*:*:*:*:*:*:*`, i)
+	}
+	nvd(`cpe:2.3:o:linux:linux_kernel:6.2:rc1:*:*:*:*:*:*`)
+	for _, version := range []string{"1809", "1903", "1909", "2004", "20h2", "21h1", "21h2", "22h2"} {
+		for _, hw := range []string{"arm64", "x64", "x86"} {
+			nvd(`cpe:2.3:o:microsoft:windows_10:%s:*:*:*:*:*:%s:*`, version, hw)
+		}
+	}
+	for i := 0; i <= 7; i++ {
+		nvd(`cpe:2.3:a:python:python:3.11.%d:*:*:*:*:*:*:*`, i)
+	}
+	for _, version := range []string{"15.0", "15.1", "15.2", "15.3", "15.4", "15.5", "16.0", "16.1"} {
+		nvd(`cpe:2.3:a:postgresql:postgresql:%s:*:*:*:*:*:*:*`, version)
+	}
+	// the versions of Cisco IOS have parentheses, quoted in the formatted string and percent-encoded in the URI
+	for _, version := range []string{`15.2\(4\)m`, `15.2\(4\)m1`, `15.2\(7\)e`, `15.5\(3\)s`, `15.9\(3\)m`} {
+		nvd(`cpe:2.3:o:cisco:ios:%s:*:*:*:*:*:*:*`, version)
+	}
+	// NA and ANY versions
+	nvd(`cpe:2.3:h:cisco:catalyst_2960:-:*:*:*:*:*:*:*`)
+	nvd(`cpe:2.3:h:cisco:catalyst_2960:*:*:*:*:*:*:*:*`)
+
+	// the punctuation quoted in the attributes
+	for _, fs := range []string{
+		`cpe:2.3:a:acme:widget\+\+:1.0:*:*:*:*:*:*:*`,
+		`cpe:2.3:a:acme:c\#_compiler:2.0:*:*:*:*:*:*:*`,
+		`cpe:2.3:a:acme:colon\:app:1.0:*:*:*:*:*:*:*`,
+		`cpe:2.3:a:acme:bang\!:1.0:*:*:*:*:*:*:*`,
+		`cpe:2.3:a:acme:tilde\~app:1.0:*:*:*:*:*:*:*`,
+		`cpe:2.3:a:acme:slash\/app:1.0:*:*:*:*:*:*:*`,
+		`cpe:2.3:a:acme:amp\&app:1.0:*:*:*:*:*:*:*`,
+		`cpe:2.3:a:acme:widget:1.0:rc\-1:*:*:*:*:*:*`,
+		`cpe:2.3:a:acme:widget:1.0:*:*:*:*:wordpress:*:*`,
+		`cpe:2.3:a:acme:widget:1.0:*:*:ja:*:*:*:*`,
+		`cpe:2.3:a:acme\.com:widget\.js:1.0.0:*:*:*:*:node\.js:*:*`,
+		`cpe:2.3:a:acme:widget:2.0:*:*:*:*:*:*:*`,
+	} {
+		nvd("%s", fs)
+	}
+
+	// the deprecated CPEs, as NVD deprecates the ones of the typos
+	for _, d := range []struct{ fs, by string }{
+		{`cpe:2.3:a:apache:http_sever:2.4.1:*:*:*:*:*:*:*`, `cpe:2.3:a:apache:http_server:2.4.1:*:*:*:*:*:*:*`},
+		{`cpe:2.3:a:openssl:open_ssl:1.0.2:*:*:*:*:*:*:*`, `cpe:2.3:a:openssl:openssl:1.0.2:*:*:*:*:*:*:*`},
+		{`cpe:2.3:a:nginx:nginx_server:1.20.0:*:*:*:*:*:*:*`, `cpe:2.3:a:nginx:nginx:1.20.0:*:*:*:*:*:*:*`},
+		{`cpe:2.3:o:microsoft:windows10:1809:*:*:*:*:*:*:*`, `cpe:2.3:o:microsoft:windows_10:1809:*:*:*:*:*:x64:*`},
+		{`cpe:2.3:a:python:python3:3.11.0:*:*:*:*:*:*:*`, `cpe:2.3:a:python:python:3.11.0:*:*:*:*:*:*:*`},
+	} {
+		es = append(es, entry{fs: d.fs, fetchType: models.NVD, deprecated: true, deprecatedBy: d.by})
+	}
+
+	// JVN with the titles in Japanese, partly overlapping NVD
+	jvn := func(title, format string, args ...interface{}) {
+		es = append(es, entry{fs: fmt.Sprintf(format, args...), fetchType: models.JVN, title: title})
+	}
+	for _, version := range []string{"5.0.0", "5.0.1", "5.0.2", "5.5.0", "5.5.1", "5.9.0", "5.9.1", "5.9.2", "5.15.0", "5.15.2"} {
+		jvn("サイボウズ ガルーン", `cpe:2.3:a:cybozu:garoon:%s:*:*:*:*:*:*:*`, version)
+	}
+	for _, version := range []string{"2019", "saas"} {
+		jvn("Trend Micro Apex One（ウイルスバスター コーポレートエディション後継）", `cpe:2.3:a:trendmicro:apex_one:%s:*:*:*:*:*:*:*`, version)
+	}
+	for _, version := range []string{"12.0.0", "12.1.0", "12.2.0", "13.0.0"} {
+		jvn("Interstage Application Server ─ 富士通", `cpe:2.3:a:fujitsu:interstage_application_server:%s:*:*:*:*:*:*:*`, version)
+	}
+	for _, version := range []string{"2.4.57", "2.4.58"} {
+		jvn("Apache HTTP Server", `cpe:2.3:a:apache:http_server:%s:*:*:*:*:*:*:*`, version)
+	}
+	jvn("テスト製品 ✓ «引用» 😀", `cpe:2.3:a:acme:widget:1.0:*:*:*:*:*:*:*`)
+	return es
+}
+
+// CPEs returns the CPEs of the fixture sorted by the CPE URI and the source.
+// The NVD CPEs have cpeNameIds derived from their URIs, so that the lookups by cpeNameId can be tested too.
+func CPEs() ([]models.CategorizedCpe, error) {
+	cpes := []models.CategorizedCpe{}
+	for _, e := range entries() {
+		wfn, err := naming.UnbindFS(e.fs)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unbind the fixture. fs: %s, err: %s", e.fs, err)
+		}
+		c := models.CategorizedCpe{
+			FetchType:       e.fetchType,
+			CpeURI:          naming.BindToURI(wfn),
+			CpeFS:           naming.BindToFS(wfn),
+			Part:            wfn.GetString(common.AttributePart),
+			Vendor:          wfn.GetString(common.AttributeVendor),
+			Product:         wfn.GetString(common.AttributeProduct),
+			Version:         wfn.GetString(common.AttributeVersion),
+			Update:          wfn.GetString(common.AttributeUpdate),
+			Edition:         wfn.GetString(common.AttributeEdition),
+			Language:        wfn.GetString(common.AttributeLanguage),
+			SoftwareEdition: wfn.GetString(common.AttributeSwEdition),
+			TargetSoftware:  wfn.GetString(common.AttributeTargetSw),
+			TargetHardware:  wfn.GetString(common.AttributeTargetHw),
+			Other:           wfn.GetString(common.AttributeOther),
+			Deprecated:      e.deprecated,
+			Title:           e.title,
+		}
+		if e.deprecatedBy != "" {
+			by, err := naming.UnbindFS(e.deprecatedBy)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to unbind the fixture. fs: %s, err: %s", e.deprecatedBy, err)
+			}
+			c.DeprecatedBy = naming.BindToURI(by)
+		}
+		if e.fetchType == models.NVD {
+			c.Popularity = popularities[c.Vendor+"::"+c.Product]
+			c.CpeNameID = nameID(c.CpeURI)
+		}
+		cpes = append(cpes, c)
+	}
+	sort.Slice(cpes, func(i, j int) bool {
+		if cpes[i].CpeURI != cpes[j].CpeURI {
+			return cpes[i].CpeURI < cpes[j].CpeURI
+		}
+		return cpes[i].FetchType < cpes[j].FetchType
+	})
+	return cpes, nil
+}
+
+// nameID derives a UUID of the shape of the cpeNameIds of NVD from the CPE URI
+func nameID(cpeURI string) string {
+	h := sha1.Sum([]byte(cpeURI))
+	return fmt.Sprintf("%X-%X-%X-%X-%X", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
@@ -0,0 +1,53 @@
+package fixture
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCPEs(t *testing.T) {
+	cpes, err := CPEs()
+	if err != nil {
+		t.Fatalf("CPEs: %s", err)
+	}
+	again, err := CPEs()
+	if err != nil {
+		t.Fatalf("CPEs: %s", err)
+	}
+	if !reflect.DeepEqual(cpes, again) {
+		t.Errorf("expected the same CPEs on every call")
+	}
+	if len(cpes) < 200 || 500 < len(cpes) {
+		t.Errorf("actual %d CPEs, expected a few hundred", len(cpes))
+	}
+
+	seen := map[string]bool{}
+	deprecated, unicode, quoted := 0, 0, 0
+	for _, c := range cpes {
+		key := c.CpeURI + "\t" + string(c.FetchType)
+		if seen[key] {
+			t.Errorf("duplicate %s", key)
+		}
+		seen[key] = true
+		if c.Vendor == "" || c.Product == "" {
+			t.Errorf("actual %#v, expected the vendor and the product", c)
+		}
+		if c.Deprecated {
+			deprecated++
+			if c.DeprecatedBy == "" {
+				t.Errorf("actual %s without deprecatedBy, expected the CPE replacing it", c.CpeURI)
+			}
+		}
+		if utf8.RuneCountInString(c.Title) != len(c.Title) {
+			unicode++
+		}
+		if strings.Contains(c.CpeURI, "%") {
+			quoted++
+		}
+	}
+	if deprecated == 0 || unicode == 0 || quoted == 0 {
+		t.Errorf("actual deprecated: %d, unicode titles: %d, percent-encoded URIs: %d, expected all of them", deprecated, unicode, quoted)
+	}
+}
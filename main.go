@@ -29,7 +29,7 @@ func main() {
 
 	if err := commands.RootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(commands.ExitCode(err))
 	}
 	os.Exit(0)
 }
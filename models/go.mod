@@ -0,0 +1,3 @@
+module github.com/kotakanbe/go-cpe-dictionary/models
+
+go 1.16
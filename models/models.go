@@ -1,15 +1,373 @@
+// Package models defines the types of go-cpe-dictionary shared with the downstream tools, e.g. Vuls.
+// It's a module of its own importing the standard library only, so importing it doesn't drag in gorm and the DB drivers.
 package models
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LatestSchemaVersion manages the Schema version used in the latest go-cpe-dictionary.
+const LatestSchemaVersion = 2
+
+// FetchMeta has meta information about fetched CPEs
+type FetchMeta struct {
+	ID                int64 `json:"-"`
+	GoCPEDictRevision string
+	SchemaVersion     uint
+	LastFetchedAt     time.Time
+	// version and generation time stamped on the NVD CPE dictionary, nil until it is fetched
+	NVDDictVersion     string
+	NVDDictGeneratedAt *time.Time
+	// SourceHashes are the HashCpes of the CPEs of the last fetch of each source, "<source>=<hash>" per line
+	SourceHashes string `gorm:"type:text"`
+	// Generation is incremented by each fetch, so that the clients tell a refresh between their requests
+	Generation uint64
+}
+
+// FetchHistory is a fetch of a source, recorded on each fetch
+type FetchHistory struct {
+	ID         int64     `json:"-"`
+	FetchType  FetchType `gorm:"index:idx_fetch_history_fetch_type" json:"fetchType"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// CPEs is the number of CPEs fetched
+	CPEs int `json:"cpes"`
+	// DataVersion is the version stamped on the upstream data, empty when the source has none
+	DataVersion string `json:"dataVersion"`
+}
+
+// Duration of the fetch
+func (h FetchHistory) Duration() time.Duration {
+	return h.FinishedAt.Sub(h.StartedAt)
+}
+
+// WatchedProduct is a vendor/product on the watchlist and what it had at the last check
+type WatchedProduct struct {
+	ID      int64  `json:"-"`
+	Vendor  string `gorm:"index:idx_watched_product_vendor_product" json:"vendor"`
+	Product string `gorm:"index:idx_watched_product_vendor_product" json:"product"`
+	// Versions and DeprecatedCpes are the versions and the deprecated CPE URIs at the last check, one per line
+	Versions       string    `gorm:"type:text" json:"-"`
+	DeprecatedCpes string    `gorm:"type:text" json:"-"`
+	CheckedAt      time.Time `json:"checkedAt"`
+}
+
+// Kinds of WatchChange
+const (
+	// WatchNewVersion : a version is added to the product
+	WatchNewVersion = "new_version"
+	// WatchDeprecated : a CPE of the product is deprecated
+	WatchDeprecated = "deprecated"
+)
+
+// WatchChange is a change of a watched product found after a fetch
+type WatchChange struct {
+	ID      int64  `json:"-"`
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	Kind    string `json:"kind"`
+	// Value is the version (new_version) or the CPE URI (deprecated)
+	Value      string    `json:"value"`
+	DetectedAt time.Time `gorm:"index:idx_watch_change_detected_at" json:"detectedAt"`
+}
+
+// Operations of AuditEntry
+const (
+	// AuditFetch : a fetch stored the CPEs of a source or the known exploited products
+	AuditFetch = "fetch"
+	// AuditWatch : a vendor/product is added to the watchlist
+	AuditWatch = "watch"
+	// AuditUnwatch : a vendor/product is removed from the watchlist
+	AuditUnwatch = "unwatch"
+	// AuditGC : gc removed the orphaned and superseded rows
+	AuditGC = "gc"
+	// AuditRepair : check-integrity --repair fixed the CPEs
+	AuditRepair = "repair"
+)
+
+// AuditEntry is a data-modifying operation on the DB, recorded for the change management
+type AuditEntry struct {
+	ID         int64     `json:"-"`
+	OperatedAt time.Time `gorm:"index:idx_audit_entry_operated_at" json:"operatedAt"`
+	// Actor is who ran the operation, e.g. user@host
+	Actor     string `json:"actor"`
+	Operation string `json:"operation"`
+	// Target is what the operation modified, e.g. the source of a fetch or the vendor::product of the watchlist
+	Target string `json:"target"`
+	// Count is the number of the rows modified, e.g. the CPEs of a fetch or the rows removed by gc
+	Count int64 `json:"count"`
+	// Detail is the rest, e.g. the data version of a fetch or the rows of each table removed by gc
+	Detail string `gorm:"type:text" json:"detail"`
+}
+
+// RejectedCpe is a CPE of a feed rejected at ingest, quarantined by a fetch with --lenient
+type RejectedCpe struct {
+	ID        int64     `json:"-"`
+	FetchType FetchType `gorm:"index:idx_rejected_cpe_fetch_type" json:"fetchType"`
+	// Cpe is the entry as written in the feed
+	Cpe        string    `gorm:"type:text" json:"cpe"`
+	Reason     string    `gorm:"type:text" json:"reason"`
+	RejectedAt time.Time `json:"rejectedAt"`
+}
+
+// DistroPackage maps a package of a Linux distribution to a vendor/product of the CPEs
+type DistroPackage struct {
+	ID      int64  `json:"-"`
+	Distro  string `gorm:"index:idx_distro_package_distro_package" json:"distro"`
+	Package string `gorm:"index:idx_distro_package_distro_package" json:"package"`
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+}
+
+// KnownExploitedProduct is a vendor/product of the dictionary in the CISA Known Exploited Vulnerabilities catalog
+type KnownExploitedProduct struct {
+	ID      int64  `json:"-"`
+	Vendor  string `gorm:"index:idx_known_exploited_product_vendor_product" json:"vendor"`
+	Product string `gorm:"index:idx_known_exploited_product_vendor_product" json:"product"`
+	// CVEs is the number of the CVEs of the vendor/product in the catalog
+	CVEs int `json:"cves"`
+}
+
+// OutDated checks whether last fetched feed is out dated
+func (f FetchMeta) OutDated() bool {
+	return f.SchemaVersion != LatestSchemaVersion
+}
+
+// SourceHash returns the hash of the CPEs of the last fetch of the source, empty when it's unknown
+func (f FetchMeta) SourceHash(source FetchType) string {
+	for _, line := range strings.Split(f.SourceHashes, "\n") {
+		if ss := strings.SplitN(line, "=", 2); len(ss) == 2 && ss[0] == string(source) {
+			return ss[1]
+		}
+	}
+	return ""
+}
+
+// SetSourceHash sets the hash of the CPEs of the last fetch of the source
+func (f *FetchMeta) SetSourceHash(source FetchType, hash string) {
+	lines := []string{}
+	for _, line := range strings.Split(f.SourceHashes, "\n") {
+		if line != "" && !strings.HasPrefix(line, string(source)+"=") {
+			lines = append(lines, line)
+		}
+	}
+	lines = append(lines, fmt.Sprintf("%s=%s", source, hash))
+	sort.Strings(lines)
+	f.SourceHashes = strings.Join(lines, "\n")
+}
+
+// HashCpes returns the SHA-256 of the CPEs regardless of their order, which tells whether a source changed since its last fetch
+func HashCpes(cpes []CategorizedCpe) string {
+	lines := make([]string, 0, len(cpes))
+	for _, c := range cpes {
+		c.ID = 0
+		b, _ := json.Marshal(c)
+		lines = append(lines, string(b))
+	}
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte("\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FetchType is the source of a CPE
+type FetchType string
+
+const (
+	// NVD : CPE dictionary and JSON feeds of NVD
+	NVD FetchType = "nvd"
+	// JVN : JVN RSS feeds
+	JVN FetchType = "jvn"
+	// Windows : Windows products of the MSRC security updates
+	Windows FetchType = "windows"
+)
+
+// ParseFetchTypes parses a comma separated list of the sources, e.g. nvd,jvn
+func ParseFetchTypes(param string) ([]FetchType, error) {
+	fetchTypes := []FetchType{}
+	for _, s := range strings.Split(param, ",") {
+		switch f := FetchType(strings.TrimSpace(s)); f {
+		case NVD, JVN, Windows:
+			fetchTypes = append(fetchTypes, f)
+		default:
+			return nil, fmt.Errorf("Unknown source: %s", s)
+		}
+	}
+	return fetchTypes, nil
+}
+
+// SourcedCpe is a CPE merged over the sources defining it
+type SourcedCpe struct {
+	CpeURI string `json:"cpeURI"`
+	// CpeNameID is the cpeNameId of NVD API 2.0, empty when the CPE isn't fetched from the API
+	CpeNameID  string      `json:"cpeNameId,omitempty"`
+	Deprecated bool        `json:"deprecated"`
+	Sources    []FetchType `json:"sources"`
+	// DeprecatedBy are the CPE URIs replacing the deprecated CPE, when the source tells them
+	DeprecatedBy []string `json:"deprecatedBy,omitempty"`
+}
+
+// VendorHashes are the hashes of the CPEs of a dictionary by the vendor, by GET /hashes
+type VendorHashes struct {
+	// Generation is that of the dictionary hashed
+	Generation uint64 `json:"generation"`
+	// Total is the hash of all the vendors
+	Total   string            `json:"total"`
+	Vendors map[string]string `json:"vendors"`
+}
+
+// ProductHashes are the hashes of the CPEs of the products of a vendor, by GET /hashes/:vendor
+type ProductHashes struct {
+	Generation uint64            `json:"generation"`
+	Vendor     string            `json:"vendor"`
+	Products   map[string]string `json:"products"`
+}
+
+// CpeExistence tells which of the CPEs of POST /cpes:exists are in the dictionary, in the order of the request.
+// Exists is set by default and Bitmap by ?format=bitmap
+type CpeExistence struct {
+	Generation uint64 `json:"generation"`
+	Count      int    `json:"count"`
+	Exists     []bool `json:"exists,omitempty"`
+	// Bitmap is base64 of the bits of the CPEs, the bit i%8 (the least significant first) of the byte i/8 set when the i-th CPE exists
+	Bitmap string `json:"bitmap,omitempty"`
+}
+
+// CpeDetail is a CPE of a vendor/product
+type CpeDetail struct {
+	CpeURI string `json:"cpeURI"`
+	// DeprecatedBy are the CPE URIs replacing the deprecated CPE, when the source tells them
+	DeprecatedBy []string `json:"deprecatedBy,omitempty"`
+	// Quality is CpeQuality of the CPE
+	Quality int `json:"quality"`
+}
+
+// CpeReference is a reference of a CPE told by NVD, e.g. the site of the vendor
+type CpeReference struct {
+	// Type is Advisory, Change Log, Product, Project, Vendor or Version
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// CpeQuality scores how well the CPE is defined from 0 to 100, so that the consumers can prefer the better ones:
+// 40 for a reference to the site of the vendor, 30 for a version, in the CPE or by a reference to a version or a change log,
+// and 30 for being active
+func CpeQuality(cpeURI string, references []CpeReference, deprecated bool) int {
+	quality := 0
+	// the version of cpe:/part:vendor:product:version, ANY when it's empty and NA by -
+	if ss := strings.Split(cpeURI, ":"); 4 < len(ss) && ss[4] != "" && ss[4] != "-" {
+		quality += 30
+	} else if hasReference(references, "Version", "Change Log") {
+		quality += 30
+	}
+	if hasReference(references, "Vendor") {
+		quality += 40
+	}
+	if !deprecated {
+		quality += 30
+	}
+	return quality
+}
+
+// hasReference tells whether references have one of the types, case-insensitively
+func hasReference(references []CpeReference, types ...string) bool {
+	for _, r := range references {
+		for _, t := range types {
+			if strings.EqualFold(r.Type, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CpeDetails are the CPEs of a vendor/product split by the deprecation
+type CpeDetails struct {
+	Active     []CpeDetail `json:"active"`
+	Deprecated []CpeDetail `json:"deprecated"`
+}
+
+// CpeURIs returns the URIs of the active and the deprecated CPEs, as GetCpesByVendorProduct does
+func (d CpeDetails) CpeURIs() (cpeURIs, deprecated []string) {
+	cpeURIs, deprecated = make([]string, 0, len(d.Active)), make([]string, 0, len(d.Deprecated))
+	for _, c := range d.Active {
+		cpeURIs = append(cpeURIs, c.CpeURI)
+	}
+	for _, c := range d.Deprecated {
+		deprecated = append(deprecated, c.CpeURI)
+	}
+	return cpeURIs, deprecated
+}
+
+// ProductSummary is a vendor/product with its CPEs grouped, for a catalog view
+type ProductSummary struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	// Versions is the number of distinct versions, except ANY and NA
+	Versions int `json:"versions"`
+	// CPEs is the number of CPEs
+	CPEs int `json:"cpes"`
+	// Deprecated is the number of deprecated CPEs
+	Deprecated int `json:"deprecated"`
+	// Popularity is the number of CVEs referencing the vendor/product
+	Popularity int      `json:"popularity"`
+	Parts      []string `json:"parts"`
+}
+
+// VersionRange is a run of the versions of a vendor/product, each the successor of the previous one
+type VersionRange struct {
+	Min string `json:"min"`
+	Max string `json:"max"`
+	// Versions is the number of the versions in the range
+	Versions int `json:"versions"`
+	// GapAfter tells that the versions between Max and the Min of the next range are missing
+	GapAfter bool `json:"gapAfter"`
+}
+
+// ProductVersionRanges are the versions of a vendor/product grouped into ranges
+type ProductVersionRanges struct {
+	Vendor   string         `json:"vendor"`
+	Product  string         `json:"product"`
+	Versions int            `json:"versions"`
+	Ranges   []VersionRange `json:"ranges"`
+}
+
+// AttributeStat is the distinct values of a WFN attribute over the CPEs
+type AttributeStat struct {
+	// Attribute is the name in the WFN, e.g. target_sw
+	Attribute string `json:"attribute"`
+	// Distinct is the number of distinct values, ANY and NA included
+	Distinct int `json:"distinct"`
+	// Top are the values of the most CPEs, the most first
+	Top []AttributeValueCount `json:"top"`
+}
+
+// AttributeValueCount is a value of a WFN attribute and the number of CPEs having it
+type AttributeValueCount struct {
+	Value string `json:"value"`
+	CPEs  int    `json:"cpes"`
+}
+
 // CategorizedCpe :
 // https://cpe.mitre.org/specification/CPE_2.3_for_ITSAC_Nov2011.pdf
 type CategorizedCpe struct {
-	ID              int64  `json:"-"`
-	CpeURI          string `gorm:"index:idx_categorized_cpe_cpe_uri"`
+	ID              int64     `json:"-"`
+	FetchType       FetchType `gorm:"index:idx_categorized_cpe_fetch_type"`
+	CpeURI          string    `gorm:"index:idx_categorized_cpe_cpe_uri"`
 	CpeFS           string
 	Part            string
 	Vendor          string `gorm:"index:idx_categorized_cpe_vendor"`
 	Product         string `gorm:"index:idx_categorized_cpe_product"`
-	Version         string
+	Version         string `gorm:"index:idx_categorized_cpe_version"`
 	Update          string
 	Edition         string
 	Language        string
@@ -18,4 +376,65 @@ type CategorizedCpe struct {
 	TargetHardware  string
 	Other           string
 	Deprecated      bool
+	Popularity      int    // number of CVEs referencing the vendor/product
+	Title           string // product name in Japanese (JVN)
+	// CpeNameID is the UUID assigned to the CPE by NVD API 2.0, upper case. Empty for the feeds.
+	CpeNameID string `gorm:"index:idx_categorized_cpe_cpe_name_id"`
+	// DeprecatedBy are the CPE URIs replacing the deprecated CPE, one per line
+	DeprecatedBy string `gorm:"type:text"`
+	// References are the references of the CPE as "<type>\t<url>", one per line (NVD only)
+	References string `gorm:"column:refs;type:text" json:",omitempty"`
+	// Generation is the generation of the fetch which added or last changed the CPE, 0 before it's tracked (RDB only)
+	Generation uint64 `gorm:"index:idx_categorized_cpe_generation;not null;default:0" json:",omitempty"`
+	// ChangedAt is when the CPE was added or last changed (RDB only)
+	ChangedAt *time.Time `json:",omitempty"`
+	// AddedAt is when the CPE was added, and DeprecatedAt when it was deprecated, kept by the later changes for the queries as of a past time.
+	// nil before they're tracked (RDB only)
+	AddedAt      *time.Time `json:",omitempty"`
+	DeprecatedAt *time.Time `json:",omitempty"`
+}
+
+// DeprecatedByURIs returns the CPE URIs replacing the deprecated CPE
+func (c CategorizedCpe) DeprecatedByURIs() []string {
+	if c.DeprecatedBy == "" {
+		return nil
+	}
+	return strings.Split(c.DeprecatedBy, "\n")
+}
+
+// ReferenceList returns the references of the CPE
+func (c CategorizedCpe) ReferenceList() []CpeReference {
+	if c.References == "" {
+		return nil
+	}
+	references := []CpeReference{}
+	for _, line := range strings.Split(c.References, "\n") {
+		ss := strings.SplitN(line, "\t", 2)
+		if len(ss) != 2 {
+			continue
+		}
+		references = append(references, CpeReference{Type: ss[0], URL: ss[1]})
+	}
+	return references
+}
+
+// JoinReferences joins references into CategorizedCpe.References
+func JoinReferences(references []CpeReference) string {
+	lines := make([]string, 0, len(references))
+	for _, r := range references {
+		if r.URL == "" {
+			continue
+		}
+		lines = append(lines, strings.TrimSpace(r.Type)+"\t"+strings.TrimSpace(r.URL))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// VendorProduct is a vendor/product of the CPEs, rebuilt on each fetch so that listing them doesn't scan the CPEs
+type VendorProduct struct {
+	ID         int64  `json:"-"`
+	Vendor     string `gorm:"unique_index:uix_vendor_product_vendor_product"`
+	Product    string `gorm:"unique_index:uix_vendor_product_vendor_product"`
+	Popularity int    // the largest of the CPEs
+	Title      string // the largest of the CPEs
 }
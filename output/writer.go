@@ -0,0 +1,112 @@
+package output
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Option : options for New
+type Option struct {
+	// Path is the file to write to. Empty writes to stdout.
+	Path string
+	// Gzip compresses the output
+	Gzip bool
+	// RotateSize starts a new file when the current one exceeds it in bytes (before compression). 0 disables rotation.
+	RotateSize int64
+}
+
+// New returns the writer for the option. Close it to flush the output.
+func New(option Option) (io.WriteCloser, error) {
+	if option.Path == "" {
+		if 0 < option.RotateSize {
+			return nil, fmt.Errorf("Rotation needs the output path")
+		}
+		if option.Gzip {
+			return gzip.NewWriter(os.Stdout), nil
+		}
+		return nopCloser{os.Stdout}, nil
+	}
+
+	w := &rotateWriter{option: option}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// rotateWriter writes to Path, then to the numbered files (e.g. cpes-1.tsv.gz) on rotation
+type rotateWriter struct {
+	option  Option
+	index   int
+	written int64
+	file    *os.File
+	w       io.WriteCloser
+}
+
+// Write starts a new file before p when the current file would exceed RotateSize,
+// so a line written at once is never split across files.
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	if 0 < w.option.RotateSize && 0 < w.written && w.option.RotateSize < w.written+int64(len(p)) {
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+		w.index++
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.w.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Close flushes and closes the current file
+func (w *rotateWriter) Close() error {
+	if w.w != w.file {
+		if err := w.w.Close(); err != nil {
+			return fmt.Errorf("Failed to close gzip writer. path: %s, err: %s", w.file.Name(), err)
+		}
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("Failed to close file. path: %s, err: %s", w.file.Name(), err)
+	}
+	return nil
+}
+
+func (w *rotateWriter) open() (err error) {
+	path := rotatedPath(w.option.Path, w.index)
+	if w.file, err = os.Create(path); err != nil {
+		return fmt.Errorf("Failed to create file. path: %s, err: %s", path, err)
+	}
+	w.w = w.file
+	if w.option.Gzip {
+		w.w = gzip.NewWriter(w.file)
+	}
+	w.written = 0
+	return nil
+}
+
+// rotatedPath inserts the index before the extensions, e.g. cpes.tsv.gz -> cpes-1.tsv.gz
+func rotatedPath(path string, index int) string {
+	if index == 0 {
+		return path
+	}
+	dir, base := filepath.Split(path)
+	stem, ext := base, ""
+	if i := strings.Index(base, "."); 0 < i {
+		stem, ext = base[:i], base[i:]
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, index, ext))
+}
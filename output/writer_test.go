@@ -0,0 +1,83 @@
+package output
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatedPath(t *testing.T) {
+	var tests = []struct {
+		path     string
+		index    int
+		expected string
+	}{
+		{path: "/tmp/cpes.tsv", index: 0, expected: "/tmp/cpes.tsv"},
+		{path: "/tmp/cpes.tsv", index: 1, expected: "/tmp/cpes-1.tsv"},
+		{path: "/tmp/cpes.tsv.gz", index: 2, expected: "/tmp/cpes-2.tsv.gz"},
+		{path: "cpes", index: 3, expected: "cpes-3"},
+		{path: "/tmp/.cpes", index: 1, expected: "/tmp/.cpes-1"},
+	}
+
+	for i, tt := range tests {
+		if actual := rotatedPath(tt.path, tt.index); actual != tt.expected {
+			t.Errorf("[%d] expected: %s, actual: %s", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestRotateWriter(t *testing.T) {
+	dir := t.TempDir()
+	w, err := New(Option{Path: filepath.Join(dir, "cpes.tsv.gz"), Gzip: true, RotateSize: 10})
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccccccccccc\n", "dd\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	expected := map[string]string{
+		"cpes.tsv.gz":   "aaaa\nbbbb\n",
+		"cpes-1.tsv.gz": "cccccccccccc\n",
+		"cpes-2.tsv.gz": "dd\n",
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %s", err)
+	}
+	if len(files) != len(expected) {
+		t.Errorf("actual %d files, expected %d", len(files), len(expected))
+	}
+	for name, content := range expected {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Open: %s", err)
+		}
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzip.NewReader: %s", err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll: %s", err)
+		}
+		_ = f.Close()
+		if actual := string(b); actual != content {
+			t.Errorf("%s: actual %q, expected %q", name, actual, content)
+		}
+	}
+}
+
+func TestNewWithoutPath(t *testing.T) {
+	if _, err := New(Option{RotateSize: 1}); err == nil || !strings.Contains(err.Error(), "Rotation") {
+		t.Errorf("actual %v, expected an error for rotation without path", err)
+	}
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/xerrors"
+)
+
+// Collator orders the listings of the vendor/products by the collation of a locale instead of the byte order of the DB,
+// e.g. ja orders the Japanese titles by their kana. The numbers in the names are ordered by their values, e.g. windows_7 before windows_10.
+// A nil Collator keeps the order of the DB, except for the titles ordered by the root collation
+type Collator struct {
+	tag language.Tag
+}
+
+// NewCollator returns the Collator of locale, e.g. ja or en-US
+func NewCollator(locale string) (*Collator, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, xerrors.Errorf("Invalid locale: %s, err: %w", locale, err)
+	}
+	return &Collator{tag: tag}, nil
+}
+
+// SortVendorProducts orders the vendor/products by the vendors and then by the products
+func (c *Collator) SortVendorProducts(vendorProducts []string) {
+	if c == nil {
+		return
+	}
+	c.Sort(len(vendorProducts), func(i int) []string {
+		return strings.SplitN(vendorProducts[i], "::", 2)
+	}, func(i, j int) { vendorProducts[i], vendorProducts[j] = vendorProducts[j], vendorProducts[i] })
+}
+
+// SortByTitles orders the vendor/products by their titles, the ones without a title by their products
+func (c *Collator) SortByTitles(vendorProducts []string, titles map[string]string) {
+	if c == nil {
+		c = &Collator{tag: language.Und}
+	}
+	c.Sort(len(vendorProducts), func(i int) []string {
+		if title := titles[vendorProducts[i]]; title != "" {
+			return []string{title}
+		}
+		ss := strings.SplitN(vendorProducts[i], "::", 2)
+		return ss[len(ss)-1:]
+	}, func(i, j int) { vendorProducts[i], vendorProducts[j] = vendorProducts[j], vendorProducts[i] })
+}
+
+// SortSummaries orders the product summaries by the vendors and then by the products
+func (c *Collator) SortSummaries(summaries []models.ProductSummary) {
+	if c == nil {
+		return
+	}
+	c.Sort(len(summaries), func(i int) []string {
+		return []string{summaries[i].Vendor, summaries[i].Product}
+	}, func(i, j int) { summaries[i], summaries[j] = summaries[j], summaries[i] })
+}
+
+// Sort orders the n items by their fields, compared one by one, and by the byte order of the fields on a tie.
+// The collation keys of the fields are computed once, since computing them is much slower than comparing them
+func (c *Collator) Sort(n int, fields func(i int) []string, swap func(i, j int)) {
+	col := collate.New(c.tag, collate.Loose, collate.Numeric)
+	var buf collate.Buffer
+	keys := make([][][]byte, n)
+	for i := range keys {
+		ff := fields(i)
+		for _, f := range ff {
+			// copied out of buf, which is reset for each key
+			keys[i] = append(keys[i], append([]byte{}, col.KeyFromString(&buf, f)...))
+			buf.Reset()
+		}
+		keys[i] = append(keys[i], []byte(strings.Join(ff, "\x00")))
+	}
+	sort.Stable(collated{keys: keys, swap: swap})
+}
+
+// collated sorts the items of keys, swapping the items along with them
+type collated struct {
+	keys [][][]byte
+	swap func(i, j int)
+}
+
+func (s collated) Len() int {
+	return len(s.keys)
+}
+
+func (s collated) Less(i, j int) bool {
+	for k := 0; k < len(s.keys[i]) && k < len(s.keys[j]); k++ {
+		if c := bytes.Compare(s.keys[i][k], s.keys[j][k]); c != 0 {
+			return c < 0
+		}
+	}
+	return len(s.keys[i]) < len(s.keys[j])
+}
+
+func (s collated) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.swap(i, j)
+}
@@ -0,0 +1,49 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func TestCollator(t *testing.T) {
+	ja, err := NewCollator("ja")
+	if err != nil {
+		t.Fatalf("NewCollator: %s", err)
+	}
+
+	vendorProducts := []string{"microsoft::windows_7", "Zope::zope", "microsoft::windows_10", "apache::http_server"}
+	ja.SortVendorProducts(vendorProducts)
+	expected := []string{"apache::http_server", "microsoft::windows_7", "microsoft::windows_10", "Zope::zope"}
+	if !reflect.DeepEqual(vendorProducts, expected) {
+		t.Errorf("actual %#v, expected %#v", vendorProducts, expected)
+	}
+
+	// the latin letters before the kana, and the katakana before the hiragana of the later kana, unlike the byte order
+	vendorProducts = []string{"sakura::sakura", "cybozu::office", "apuri::apuri"}
+	titles := map[string]string{"sakura::sakura": "さくらエディタ", "apuri::apuri": "アプリ"}
+	ja.SortByTitles(vendorProducts, titles)
+	expected = []string{"cybozu::office", "apuri::apuri", "sakura::sakura"}
+	if !reflect.DeepEqual(vendorProducts, expected) {
+		t.Errorf("actual %#v, expected %#v", vendorProducts, expected)
+	}
+
+	summaries := []models.ProductSummary{{Vendor: "microsoft", Product: "windows_10"}, {Vendor: "microsoft", Product: "windows_7"}}
+	ja.SortSummaries(summaries)
+	if summaries[0].Product != "windows_7" {
+		t.Errorf("actual %#v", summaries)
+	}
+
+	// nil keeps the order
+	var none *Collator
+	vendorProducts = []string{"b::b", "a::a"}
+	none.SortVendorProducts(vendorProducts)
+	if vendorProducts[0] != "b::b" {
+		t.Errorf("actual %#v", vendorProducts)
+	}
+
+	if _, err := NewCollator("not a locale"); err == nil {
+		t.Errorf("an invalid locale is accepted")
+	}
+}
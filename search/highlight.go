@@ -0,0 +1,189 @@
+package search
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"golang.org/x/xerrors"
+)
+
+// Fields searched by Search
+const (
+	FieldTitle   = "title"
+	FieldVendor  = "vendor"
+	FieldProduct = "product"
+)
+
+// Fields are all the fields searched by Search
+var Fields = []string{FieldTitle, FieldVendor, FieldProduct}
+
+// Match is a vendor/product matched by Search
+type Match struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	Title   string `json:"title,omitempty"`
+	// Highlights are the matched fields HTML escaped, the parts matching the query enclosed in <em> and </em>.
+	// A field matched only by the transliteration, e.g. a title in kana by a query in romaji, has no <em>.
+	Highlights map[string]string `json:"highlights"`
+	// KnownExploited tells the vendor/product is in the CISA Known Exploited Vulnerabilities catalog
+	KnownExploited bool `json:"knownExploited,omitempty"`
+}
+
+// Search searches vendor/products by the tokens of query in the fields, matched as by Products,
+// and highlights the matched parts. The matches of more tokens come first, the known exploited first among them.
+func Search(driver db.DB, query string, fields []string) ([]Match, error) {
+	if err := ValidateFields(fields); err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		fields = Fields
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []Match{}, nil
+	}
+
+	entries, known, err := indexEntries(driver)
+	if err != nil {
+		return nil, err
+	}
+	vendorProducts, titles := make([]string, 0, len(entries)), map[string]string{}
+	for _, e := range entries {
+		vp := e.Vendor + "::" + e.Product
+		vendorProducts = append(vendorProducts, vp)
+		if e.Title != "" {
+			titles[vp] = e.Title
+		}
+	}
+
+	matches, scores := search(vendorProducts, titles, query, fields)
+	idx := make([]int, len(matches))
+	for i := range idx {
+		idx[i] = i
+		matches[i].KnownExploited = known[matches[i].Vendor+"::"+matches[i].Product]
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		if scores[idx[i]] != scores[idx[j]] {
+			return scores[idx[i]] > scores[idx[j]]
+		}
+		return matches[idx[i]].KnownExploited && !matches[idx[j]].KnownExploited
+	})
+	sorted := make([]Match, 0, len(matches))
+	for _, i := range idx {
+		sorted = append(sorted, matches[i])
+	}
+	return sorted, nil
+}
+
+// ValidateFields rejects the fields Search doesn't search
+func ValidateFields(fields []string) error {
+	for _, f := range fields {
+		switch f {
+		case FieldTitle, FieldVendor, FieldProduct:
+		default:
+			return xerrors.Errorf("Unknown field: %s, expected title, vendor or product", f)
+		}
+	}
+	return nil
+}
+
+// search returns the vendor/products matching query in the fields, sorted by vendor/product, and the number of tokens each matches
+func search(vendorProducts []string, titles map[string]string, query string, fields []string) ([]Match, []int) {
+	tokens := Tokenize(query)
+	words := rawTokens(query)
+	sorted := append([]string{}, vendorProducts...)
+	sort.Strings(sorted)
+
+	matches, scores := []Match{}, []int{}
+	for _, vp := range sorted {
+		ss := strings.SplitN(vp, "::", 2)
+		if len(ss) != 2 {
+			continue
+		}
+		m := Match{Vendor: ss[0], Product: ss[1], Title: titles[vp], Highlights: map[string]string{}}
+		values := map[string]string{FieldTitle: m.Title, FieldVendor: m.Vendor, FieldProduct: m.Product}
+
+		r := Result{}
+		for _, f := range fields {
+			switch f {
+			case FieldTitle:
+				r.Title = m.Title
+			case FieldVendor:
+				r.Vendor = m.Vendor
+			case FieldProduct:
+				r.Product = m.Product
+			}
+		}
+		score := matchTokens(tokens, r)
+		if score < 0 {
+			continue
+		}
+		for _, f := range fields {
+			v := values[f]
+			if v == "" {
+				continue
+			}
+			for _, t := range tokens {
+				if strings.Contains(Normalize(v), t) {
+					m.Highlights[f] = highlight(v, words)
+					break
+				}
+			}
+		}
+		matches = append(matches, m)
+		scores = append(scores, score)
+	}
+	return matches, scores
+}
+
+// rawTokens splits query at the separators as Tokenize, but keeps the tokens as written and lower cased to find them in the fields
+func rawTokens(query string) []string {
+	tokens := []string{}
+	for _, f := range strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		tokens = append(tokens, strings.ToLower(f))
+	}
+	return tokens
+}
+
+// highlight escapes v and encloses the parts of v equal to any of the tokens, ignoring the case, in <em> and </em>
+func highlight(v string, tokens []string) string {
+	lower := []rune(strings.ToLower(v))
+	runes := []rune(v)
+	if len(lower) != len(runes) {
+		return html.EscapeString(v)
+	}
+	marked := make([]bool, len(runes))
+	for _, t := range tokens {
+		tr := []rune(t)
+		if len(tr) == 0 {
+			continue
+		}
+		for i := 0; i+len(tr) <= len(lower); i++ {
+			if string(lower[i:i+len(tr)]) == t {
+				for j := i; j < i+len(tr); j++ {
+					marked[j] = true
+				}
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && marked[j] == marked[i] {
+			j++
+		}
+		s := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			s = "<em>" + s + "</em>"
+		}
+		sb.WriteString(s)
+		i = j
+	}
+	return sb.String()
+}
@@ -0,0 +1,71 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	vendorProducts := []string{"microsoft::sql_server", "cybozu::office", "microsoft::office"}
+	titles := map[string]string{"cybozu::office": "サイボウズ Office"}
+
+	var tests = []struct {
+		query    string
+		fields   []string
+		expected []Match
+	}{
+		{
+			query:  "SQL Server",
+			fields: Fields,
+			expected: []Match{
+				{Vendor: "microsoft", Product: "sql_server", Highlights: map[string]string{"product": "<em>sql</em>_<em>server</em>"}},
+			},
+		},
+		{
+			query:  "office",
+			fields: []string{FieldTitle, FieldProduct},
+			expected: []Match{
+				{Vendor: "cybozu", Product: "office", Title: "サイボウズ Office", Highlights: map[string]string{"title": "サイボウズ <em>Office</em>", "product": "<em>office</em>"}},
+				{Vendor: "microsoft", Product: "office", Highlights: map[string]string{"product": "<em>office</em>"}},
+			},
+		},
+		{
+			query:    "office",
+			fields:   []string{FieldVendor},
+			expected: []Match{},
+		},
+		{
+			// matched by the transliteration, so nothing to enclose
+			query:  "saibozu",
+			fields: []string{FieldTitle},
+			expected: []Match{
+				{Vendor: "cybozu", Product: "office", Title: "サイボウズ Office", Highlights: map[string]string{"title": "サイボウズ Office"}},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		if actual, _ := search(vendorProducts, titles, tt.query, tt.fields); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("[%d] actual %#v, expected %#v", i, actual, tt.expected)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	var tests = []struct {
+		value    string
+		tokens   []string
+		expected string
+	}{
+		{value: "Apache HTTP Server", tokens: []string{"http", "server"}, expected: "Apache <em>HTTP</em> <em>Server</em>"},
+		{value: "openssl", tokens: []string{"ssl", "open"}, expected: "<em>openssl</em>"},
+		{value: "AT&T", tokens: []string{"t"}, expected: "A<em>T</em>&amp;<em>T</em>"},
+		{value: "nginx", tokens: []string{"apache"}, expected: "nginx"},
+	}
+
+	for i, tt := range tests {
+		if actual := highlight(tt.value, tt.tokens); actual != tt.expected {
+			t.Errorf("[%d] actual %s, expected %s", i, actual, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"golang.org/x/xerrors"
+)
+
+// maxIdentifications is the number of candidates returned for a component of a banner
+const maxIdentifications = 5
+
+// bannerAliases are the vendor/products of the names in well-known banners
+// which the vendor/product names don't tell, e.g. Apache means the HTTP server.
+var bannerAliases = map[string]string{
+	"apache":        "apache::http_server",
+	"httpd":         "apache::http_server",
+	"microsoft iis": "microsoft::internet_information_services",
+	"iis":           "microsoft::internet_information_services",
+	"openssh":       "openbsd::openssh",
+	"nginx":         "f5::nginx",
+	"php":           "php::php",
+	"openssl":       "openssl::openssl",
+	"tomcat":        "apache::tomcat",
+	"apache tomcat": "apache::tomcat",
+	"jetty":         "eclipse::jetty",
+	"lighttpd":      "lighttpd::lighttpd",
+	"vsftpd":        "vsftpd_project::vsftpd",
+	"proftpd":       "proftpd::proftpd",
+	"postfix":       "postfix::postfix",
+	"exim":          "exim::exim",
+	"dovecot":       "dovecot::dovecot",
+	"bind":          "isc::bind",
+	"squid":         "squid-cache::squid",
+	"varnish":       "varnish-cache::varnish",
+}
+
+// Identification is a CPE identified from a banner
+type Identification struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	Version string `json:"version"`
+	CpeURI  string `json:"cpeURI"`
+	// InDictionary tells whether the CPE of the version is in the dictionary,
+	// otherwise CpeURI is made from the vendor/product and the version of the banner
+	InDictionary bool `json:"inDictionary"`
+	// Confidence is from 0 to 1
+	Confidence float64 `json:"confidence"`
+	// Quality is models.CpeQuality of the CPE in the dictionary, 0 otherwise
+	Quality int `json:"quality"`
+	// KnownExploited tells the vendor/product is in the CISA Known Exploited Vulnerabilities catalog
+	KnownExploited bool `json:"knownExploited,omitempty"`
+}
+
+// BannerMatch is a component of a banner and the CPEs identified from it
+type BannerMatch struct {
+	// Component is the product and the version in the banner, e.g. Apache/2.4.41
+	Component  string           `json:"component"`
+	Candidates []Identification `json:"candidates"`
+}
+
+// BannerResult is what Identify found in a banner
+type BannerResult struct {
+	Banner  string        `json:"banner"`
+	Matches []BannerMatch `json:"matches"`
+}
+
+// component is a product and its version in a banner
+type component struct {
+	raw     string
+	name    string
+	version string
+}
+
+var (
+	bannerComment = regexp.MustCompile(`\([^)]*\)`)
+	// e.g. OpenSSH_8.2p1
+	underscoreVersion = regexp.MustCompile(`^([A-Za-z][A-Za-z-]*)_(\d.*)$`)
+	// the protocol version of SSH banners, e.g. SSH-2.0-OpenSSH_8.2p1
+	sshProtocol = regexp.MustCompile(`^SSH-\d+\.\d+-`)
+)
+
+// parseBanner splits a banner into the products and versions, e.g.
+// "Apache/2.4.41 (Unix) OpenSSL/1.1.1d" into Apache 2.4.41 and OpenSSL 1.1.1d,
+// and "Microsoft SQL Server 2019" into Microsoft SQL Server 2019.
+func parseBanner(banner string) []component {
+	components := []component{}
+	words := []string{}
+	flush := func(version string) {
+		if len(words) == 0 {
+			return
+		}
+		raw := strings.Join(words, " ")
+		if version != "" {
+			raw += " " + version
+		}
+		components = append(components, component{raw: raw, name: strings.Join(words, " "), version: version})
+		words = []string{}
+	}
+
+	for _, f := range strings.Fields(bannerComment.ReplaceAllString(banner, " ")) {
+		f = sshProtocol.ReplaceAllString(strings.Trim(f, ",;"), "")
+		if f == "" {
+			continue
+		}
+		if ss := strings.SplitN(f, "/", 2); len(ss) == 2 && ss[0] != "" {
+			flush("")
+			components = append(components, component{raw: f, name: ss[0], version: trimVersion(ss[1])})
+			continue
+		}
+		if m := underscoreVersion.FindStringSubmatch(f); m != nil {
+			flush("")
+			components = append(components, component{raw: f, name: m[1], version: trimVersion(m[2])})
+			continue
+		}
+		if v := trimVersion(f); v != "" && unicode.IsDigit([]rune(v)[0]) {
+			flush(v)
+			continue
+		}
+		words = append(words, f)
+	}
+	flush("")
+	return components
+}
+
+// trimVersion drops the v of v1.2.3
+func trimVersion(v string) string {
+	if 1 < len(v) && (v[0] == 'v' || v[0] == 'V') && unicode.IsDigit(rune(v[1])) {
+		return v[1:]
+	}
+	return v
+}
+
+// Identify returns the candidate CPEs of each product in a banner (e.g. the Server header of HTTP
+// or "product name 1.2.3"), most confident first.
+// The products are found by the well-known banner names and the search of Products.
+func Identify(driver db.DB, banner string) ([]BannerMatch, error) {
+	results, err := IdentifyBanners(driver, []string{banner})
+	if err != nil {
+		return nil, err
+	}
+	return results[0].Matches, nil
+}
+
+// IdentifyBanners runs Identify for each of banners
+func IdentifyBanners(driver db.DB, banners []string) ([]BannerResult, error) {
+	entries, _, err := indexEntries(driver)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, e := range entries {
+		known[e.Vendor+"::"+e.Product] = true
+	}
+	exploited, err := knownExploited(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BannerResult, 0, len(banners))
+	for _, banner := range banners {
+		matches, err := identify(driver, entries, known, exploited, banner)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, BannerResult{Banner: banner, Matches: matches})
+	}
+	return results, nil
+}
+
+func identify(driver db.DB, entries []IndexEntry, known, exploited map[string]bool, banner string) ([]BannerMatch, error) {
+	matches := []BannerMatch{}
+	for _, c := range parseBanner(banner) {
+		scores := map[string]float64{}
+		if vp, ok := bannerAliases[strings.Join(Tokenize(c.name), " ")]; ok && known[vp] {
+			scores[vp] = 1
+		}
+		results, matched := products(entries, exploited, c.name)
+		tokens := Tokenize(c.name)
+		for _, r := range results {
+			vp := r.Vendor + "::" + r.Product
+			if _, ok := scores[vp]; ok {
+				continue
+			}
+			scores[vp] = nameScore(tokens, r, matched[r])
+		}
+
+		// the versions are looked up for the best names only, since a vendor name like apache matches hundreds of products
+		vps := make([]string, 0, len(scores))
+		for vp := range scores {
+			vps = append(vps, vp)
+		}
+		sort.Slice(vps, func(i, j int) bool {
+			if scores[vps[i]] != scores[vps[j]] {
+				return scores[vps[i]] > scores[vps[j]]
+			}
+			return vps[i] < vps[j]
+		})
+		if maxIdentifications < len(vps) {
+			vps = vps[:maxIdentifications]
+		}
+
+		candidates := []Identification{}
+		for _, vp := range vps {
+			ss := strings.SplitN(vp, "::", 2)
+			id, err := identifyVersion(driver, ss[0], ss[1], c.version)
+			if err != nil {
+				return nil, err
+			}
+			id.Confidence = math.Round(scores[vp]*versionFactor(id, c.version)*100) / 100
+			id.KnownExploited = exploited[vp]
+			candidates = append(candidates, id)
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Confidence > candidates[j].Confidence
+		})
+		matches = append(matches, BannerMatch{Component: c.raw, Candidates: candidates})
+	}
+	return matches, nil
+}
+
+// nameScore is how well the name in a banner tells r: 0.9 when the product is the name,
+// otherwise up to 0.6 by the share of the name tokens found.
+func nameScore(tokens []string, r Result, matched int) float64 {
+	if strings.Join(tokens, "_") == strings.Join(Tokenize(r.Product), "_") {
+		return 0.9
+	}
+	if len(tokens) == 0 {
+		return 0
+	}
+	return 0.6 * float64(matched) / float64(len(tokens))
+}
+
+// versionFactor lowers the confidence when the version is not in the dictionary or not in the banner
+func versionFactor(id Identification, version string) float64 {
+	switch {
+	case version == "":
+		return 0.6
+	case id.InDictionary:
+		return 1
+	}
+	return 0.8
+}
+
+// identifyVersion returns the CPE of version of vendor/product, from the dictionary when it's there
+func identifyVersion(driver db.DB, vendor, product, version string) (Identification, error) {
+	id := Identification{Vendor: vendor, Product: product, Version: version}
+	details, err := driver.GetCpeDetailsByVendorProduct(db.LikePattern(vendor, false), db.LikePattern(product, false))
+	if err != nil {
+		return id, xerrors.Errorf("Failed to get CPEs. vendor: %s, product: %s, err: %w", vendor, product, err)
+	}
+
+	part := "a"
+	for _, detail := range append(details.Active, details.Deprecated...) {
+		uri := detail.CpeURI
+		wfn, err := naming.UnbindURI(uri)
+		if err != nil {
+			continue
+		}
+		// LIKE matches case-insensitively on MySQL
+		if wfn.GetString(common.AttributeVendor) != vendor || wfn.GetString(common.AttributeProduct) != product {
+			continue
+		}
+		part = wfn.GetString(common.AttributePart)
+		if version != "" && unescape(wfn.GetString(common.AttributeVersion)) == version {
+			id.CpeURI = uri
+			id.InDictionary = true
+			id.Quality = detail.Quality
+			return id, nil
+		}
+	}
+
+	uri := fmt.Sprintf("cpe:/%s:%s:%s", part, encodeURI(unescape(vendor)), encodeURI(unescape(product)))
+	if version != "" {
+		uri += ":" + encodeURI(version)
+	}
+	if wfn, err := naming.UnbindURI(uri); err == nil {
+		uri = naming.BindToURI(wfn)
+	}
+	id.CpeURI = uri
+	return id, nil
+}
+
+// encodeURI percent-encodes the characters not allowed in a component of a CPE 2.2 URI
+func encodeURI(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-~", r)):
+			b.WriteRune(r)
+		default:
+			for _, c := range []byte(string(r)) {
+				fmt.Fprintf(&b, "%%%02x", c)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func TestParseBanner(t *testing.T) {
+	var tests = []struct {
+		banner   string
+		expected []component
+	}{
+		{
+			banner: "Apache/2.4.41 (Unix) OpenSSL/1.1.1d PHP/7.3.11",
+			expected: []component{
+				{raw: "Apache/2.4.41", name: "Apache", version: "2.4.41"},
+				{raw: "OpenSSL/1.1.1d", name: "OpenSSL", version: "1.1.1d"},
+				{raw: "PHP/7.3.11", name: "PHP", version: "7.3.11"},
+			},
+		},
+		{
+			banner: "SSH-2.0-OpenSSH_8.2p1 Ubuntu-4ubuntu0.5",
+			expected: []component{
+				{raw: "OpenSSH_8.2p1", name: "OpenSSH", version: "8.2p1"},
+				{raw: "Ubuntu-4ubuntu0.5", name: "Ubuntu-4ubuntu0.5"},
+			},
+		},
+		{
+			banner: "OpenSSH_8.2p1",
+			expected: []component{
+				{raw: "OpenSSH_8.2p1", name: "OpenSSH", version: "8.2p1"},
+			},
+		},
+		{
+			banner: "Microsoft-IIS/10.0",
+			expected: []component{
+				{raw: "Microsoft-IIS/10.0", name: "Microsoft-IIS", version: "10.0"},
+			},
+		},
+		{
+			banner: "Microsoft SQL Server v2019",
+			expected: []component{
+				{raw: "Microsoft SQL Server 2019", name: "Microsoft SQL Server", version: "2019"},
+			},
+		},
+		{
+			banner: "nginx",
+			expected: []component{
+				{raw: "nginx", name: "nginx"},
+			},
+		},
+		{
+			banner:   "",
+			expected: []component{},
+		},
+	}
+
+	for i, tt := range tests {
+		if actual := parseBanner(tt.banner); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("[%d] actual %#v, expected %#v", i, actual, tt.expected)
+		}
+	}
+}
+
+func TestNameScore(t *testing.T) {
+	var tests = []struct {
+		name     string
+		r        Result
+		matched  int
+		expected float64
+	}{
+		{name: "SQL Server", r: Result{Vendor: "microsoft", Product: "sql_server"}, matched: 2, expected: 0.9},
+		{name: "Microsoft SQL Server", r: Result{Vendor: "microsoft", Product: "sql_server"}, matched: 3, expected: 0.6},
+		{name: "Microsoft SQL", r: Result{Vendor: "microsoft", Product: "sql_server_management_studio"}, matched: 1, expected: 0.3},
+	}
+	for i, tt := range tests {
+		if actual := nameScore(Tokenize(tt.name), tt.r, tt.matched); actual != tt.expected {
+			t.Errorf("[%d] actual %v, expected %v", i, actual, tt.expected)
+		}
+	}
+}
+
+func TestEncodeURI(t *testing.T) {
+	if actual := encodeURI("node.js+x_y"); actual != "node.js%2bx_y" {
+		t.Errorf("actual %s", actual)
+	}
+}
+
+// identifyDriver is indexDriver without the CPEs of the vendor/products in the dictionary
+type identifyDriver struct {
+	*indexDriver
+}
+
+func (d identifyDriver) GetCpeDetailsByVendorProduct(vendor, product string) (*models.CpeDetails, error) {
+	return &models.CpeDetails{}, nil
+}
+
+func TestIdentifyKnownExploited(t *testing.T) {
+	matches, err := Identify(identifyDriver{&indexDriver{}}, "Microsoft Exchange Server 2019")
+	if err != nil {
+		t.Fatalf("Identify: %s", err)
+	}
+	if len(matches) != 1 || len(matches[0].Candidates) == 0 || matches[0].Candidates[0].Product != "exchange_server" {
+		t.Fatalf("actual %#v", matches)
+	}
+	for _, c := range matches[0].Candidates {
+		if expected := c.Product == "exchange_server"; c.KnownExploited != expected {
+			t.Errorf("%s::%s: actual %t, expected %t", c.Vendor, c.Product, c.KnownExploited, expected)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package search
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+// indexFormat is the version of the file of Index, bumped when Index changes
+const indexFormat = 1
+
+// Index is what Products, Search, Rank and IdentifyBanners read from the DB: the vendor/products normalized and tokenized,
+// the product summaries and the known exploited vendor/products. It's built once per generation of the DB
+// and persisted to a file by Save, so that the server starts without scanning the CPEs to warm up
+type Index struct {
+	// Generation is that of the DB the index is built from
+	Generation     uint64
+	Entries        []IndexEntry
+	Summaries      []models.ProductSummary
+	KnownExploited []string
+
+	known map[string]bool
+}
+
+// IndexEntry is a vendor/product searched, its fields normalized and tokenized beforehand
+type IndexEntry struct {
+	Vendor  string
+	Product string
+	Title   string
+	// Normalized are the vendor, the product and the title by Normalize
+	Normalized []string
+	// Tokens are the tokens of the vendor, the product and the title by Tokenize
+	Tokens []string
+}
+
+// indexFile is the content of the file of Index
+type indexFile struct {
+	Format int
+	Index  *Index
+}
+
+// current is the *Index set by SetIndex
+var current atomic.Value
+
+// SetIndex makes the searches read ix while the DB is of its generation, instead of the DB
+func SetIndex(ix *Index) {
+	current.Store(ix)
+}
+
+// BuildIndex reads the vendor/products, their titles, the product summaries and the known exploited vendor/products from driver
+func BuildIndex(driver db.DB) (*Index, error) {
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get FetchMeta. err: %w", err)
+	}
+	vendorProducts, err := driver.GetVendorProducts()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get vendor products. err: %w", err)
+	}
+	titles, err := driver.GetVendorProductTitles()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get vendor product titles. err: %w", err)
+	}
+	summaries, err := driver.GetProductSummaries()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get product summaries. err: %w", err)
+	}
+	known, err := knownExploited(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	ix := &Index{
+		Generation:     fetchMeta.Generation,
+		Entries:        newEntries(vendorProducts, titles),
+		Summaries:      summaries,
+		KnownExploited: make([]string, 0, len(known)),
+		known:          known,
+	}
+	for vp := range known {
+		ix.KnownExploited = append(ix.KnownExploited, vp)
+	}
+	sort.Strings(ix.KnownExploited)
+	return ix, nil
+}
+
+// newEntries normalizes and tokenizes the vendor/products
+func newEntries(vendorProducts []string, titles map[string]string) []IndexEntry {
+	entries := make([]IndexEntry, 0, len(vendorProducts))
+	for _, vp := range vendorProducts {
+		ss := strings.SplitN(vp, "::", 2)
+		if len(ss) != 2 {
+			continue
+		}
+		e := IndexEntry{Vendor: ss[0], Product: ss[1], Title: titles[vp]}
+		for _, s := range []string{e.Vendor, e.Product, e.Title} {
+			if s != "" {
+				e.Normalized = append(e.Normalized, Normalize(s))
+			}
+		}
+		e.Tokens = Tokenize(strings.Join([]string{e.Vendor, e.Product, e.Title}, " "))
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// Save writes ix to path gzipped, replacing the file at once so that a server loading it never reads a partial one
+func (ix *Index) Save(path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return xerrors.Errorf("Failed to create the index file. err: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	w := gzip.NewWriter(f)
+	if err := gob.NewEncoder(w).Encode(indexFile{Format: indexFormat, Index: ix}); err != nil {
+		_ = f.Close()
+		return xerrors.Errorf("Failed to encode the index. err: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		_ = f.Close()
+		return xerrors.Errorf("Failed to write the index. err: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return xerrors.Errorf("Failed to write the index. err: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return xerrors.Errorf("Failed to rename the index file. err: %w", err)
+	}
+	return nil
+}
+
+// LoadIndex reads the index written by Save
+func LoadIndex(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to open the index file. err: %w", err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to read the index file. err: %w", err)
+	}
+	var file indexFile
+	if err := gob.NewDecoder(r).Decode(&file); err != nil {
+		return nil, xerrors.Errorf("Failed to decode the index. err: %w", err)
+	}
+	if file.Format != indexFormat || file.Index == nil {
+		return nil, xerrors.Errorf("The index is of another format. path: %s, format: %d, expected: %d", path, file.Format, indexFormat)
+	}
+	ix := file.Index
+	ix.known = make(map[string]bool, len(ix.KnownExploited))
+	for _, vp := range ix.KnownExploited {
+		ix.known[vp] = true
+	}
+	return ix, nil
+}
+
+// currentIndex returns the index set by SetIndex when it's of the generation of driver, otherwise nil
+func currentIndex(driver db.DB) *Index {
+	ix, _ := current.Load().(*Index)
+	if ix == nil {
+		return nil
+	}
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil || fetchMeta.Generation != ix.Generation {
+		return nil
+	}
+	return ix
+}
+
+// indexEntries returns the entries and the known exploited vendor/products of the index, or reads them from driver without one
+func indexEntries(driver db.DB) ([]IndexEntry, map[string]bool, error) {
+	if ix := currentIndex(driver); ix != nil {
+		return ix.Entries, ix.known, nil
+	}
+	vendorProducts, err := driver.GetVendorProducts()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("Failed to get vendor products. err: %w", err)
+	}
+	titles, err := driver.GetVendorProductTitles()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("Failed to get vendor product titles. err: %w", err)
+	}
+	known, err := knownExploited(driver)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newEntries(vendorProducts, titles), known, nil
+}
+
+// indexSummaries returns the product summaries and the known exploited vendor/products of the index, or reads them from driver without one
+func indexSummaries(driver db.DB) ([]models.ProductSummary, map[string]bool, error) {
+	if ix := currentIndex(driver); ix != nil {
+		return ix.Summaries, ix.known, nil
+	}
+	summaries, err := driver.GetProductSummaries()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("Failed to get product summaries. err: %w", err)
+	}
+	known, err := knownExploited(driver)
+	if err != nil {
+		return nil, nil, err
+	}
+	return summaries, known, nil
+}
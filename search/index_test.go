@@ -0,0 +1,87 @@
+package search
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+// indexDriver is a DB of a few vendor/products, counting the reads of them
+type indexDriver struct {
+	db.DB
+	generation uint64
+	reads      int
+}
+
+func (d *indexDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	return &models.FetchMeta{Generation: d.generation}, nil
+}
+
+func (d *indexDriver) GetVendorProducts() ([]string, error) {
+	d.reads++
+	return []string{"cybozu::office", "microsoft::sql_server", "microsoft::exchange_server"}, nil
+}
+
+func (d *indexDriver) GetVendorProductTitles() (map[string]string, error) {
+	return map[string]string{"cybozu::office": "サイボウズ Office"}, nil
+}
+
+func (d *indexDriver) GetProductSummaries() ([]models.ProductSummary, error) {
+	return []models.ProductSummary{{Vendor: "microsoft", Product: "sql_server", Versions: 3, CPEs: 3}}, nil
+}
+
+func (d *indexDriver) GetKnownExploited() ([]models.KnownExploitedProduct, error) {
+	return []models.KnownExploitedProduct{{Vendor: "microsoft", Product: "exchange_server", CVEs: 2}}, nil
+}
+
+func TestIndex(t *testing.T) {
+	defer SetIndex(nil)
+	driver := &indexDriver{generation: 2}
+	built, err := BuildIndex(driver)
+	if err != nil {
+		t.Fatalf("BuildIndex: %s", err)
+	}
+	path := filepath.Join(t.TempDir(), "cpe.sqlite3.search-index")
+	if err := built.Save(path); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+	ix, err := LoadIndex(path)
+	if err != nil {
+		t.Fatalf("LoadIndex: %s", err)
+	}
+	if !reflect.DeepEqual(ix, built) {
+		t.Errorf("actual %#v, expected %#v", ix, built)
+	}
+
+	SetIndex(ix)
+	driver.reads = 0
+	results, err := Products(driver, "saibozu")
+	if err != nil {
+		t.Fatalf("Products: %s", err)
+	}
+	if len(results) != 1 || results[0].Vendor != "cybozu" {
+		t.Errorf("actual %#v", results)
+	}
+	results, err = Products(driver, "server")
+	if err != nil {
+		t.Fatalf("Products: %s", err)
+	}
+	if len(results) != 2 || !results[0].KnownExploited || results[0].Product != "exchange_server" {
+		t.Errorf("actual %#v", results)
+	}
+	if driver.reads != 0 {
+		t.Errorf("actual %d reads, expected the index to be read", driver.reads)
+	}
+
+	// an index of another generation is stale, and the DB is read
+	driver.generation++
+	if _, err := Products(driver, "server"); err != nil {
+		t.Fatalf("Products: %s", err)
+	}
+	if driver.reads != 1 {
+		t.Errorf("actual %d reads, expected the DB to be read", driver.reads)
+	}
+}
@@ -0,0 +1,75 @@
+package search
+
+import (
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"golang.org/x/xerrors"
+)
+
+// PartInference is the part inferred for a CPE given without one
+type PartInference struct {
+	// Part is a, o or h
+	Part string `json:"part"`
+	// Basis is what Part is inferred from: "product" for the CPEs of the vendor/product in the dictionary,
+	// "vendor" for those of the other products of the vendor, and "default" for an application when there are neither
+	Basis string `json:"basis"`
+	// CPEs is the number of the CPEs of the basis, and Share is that of Part among them
+	CPEs  int     `json:"cpes"`
+	Share float64 `json:"share"`
+}
+
+// parts are the parts of the CPEs, in the order preferred on a tie
+var parts = []string{"a", "o", "h"}
+
+// InferPart infers the part of a CPE of vendor/product, given as in the dictionary, e.g. microsoft windows_10.
+// It's the part most of the dictionary CPEs of the vendor/product have, or of the vendor when the product isn't there.
+// The inference may be wrong, e.g. for a vendor of both firmware and hardware, so it's to be confirmed before used.
+func InferPart(driver db.DB, vendor, product string) (PartInference, error) {
+	for _, basis := range []struct {
+		name    string
+		product string
+	}{
+		{name: "product", product: db.LikePattern(product, false)},
+		{name: "vendor", product: "%"},
+	} {
+		cpeURIs, deprecated, err := driver.GetCpesByVendorProduct(db.LikePattern(vendor, false), basis.product)
+		if xerrors.Is(err, db.ErrWildcardUnsupported) {
+			// the other products of the vendor can't be listed on DynamoDB
+			continue
+		}
+		if err != nil {
+			return PartInference{}, xerrors.Errorf("Failed to get CPEs. vendor: %s, product: %s, err: %w", vendor, product, err)
+		}
+		if inference, ok := majorityPart(append(cpeURIs, deprecated...)); ok {
+			inference.Basis = basis.name
+			return inference, nil
+		}
+	}
+	return PartInference{Part: "a", Basis: "default"}, nil
+}
+
+// majorityPart returns the part most of cpeURIs have, false without any
+func majorityPart(cpeURIs []string) (PartInference, bool) {
+	counts := map[string]int{}
+	total := 0
+	for _, uri := range cpeURIs {
+		wfn, err := naming.UnbindURI(uri)
+		if err != nil {
+			continue
+		}
+		counts[wfn.GetString(common.AttributePart)]++
+		total++
+	}
+	if total == 0 {
+		return PartInference{}, false
+	}
+	inference := PartInference{CPEs: total}
+	for _, p := range parts {
+		if inference.Part == "" || counts[inference.Part] < counts[p] {
+			inference.Part = p
+		}
+	}
+	inference.Share = float64(counts[inference.Part]) / float64(total)
+	return inference, true
+}
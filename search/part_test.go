@@ -0,0 +1,52 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+)
+
+// partDriver is a DB of the CPEs of a few vendors
+type partDriver struct {
+	db.DB
+}
+
+func (d partDriver) GetCpesByVendorProduct(vendor, product string) ([]string, []string, error) {
+	cpes := map[string][]string{
+		"microsoft": {"cpe:/o:microsoft:windows_10:1809", "cpe:/o:microsoft:windows_10:1903", "cpe:/a:microsoft:office:2019"},
+		"cisco":     {"cpe:/h:cisco:asa_5505", "cpe:/o:cisco:adaptive_security_appliance_software:9.8"},
+	}[vendor]
+	if product == "%" {
+		return cpes, []string{}, nil
+	}
+	matched := []string{}
+	for _, uri := range cpes {
+		if strings.HasPrefix(uri[len("cpe:/x:"):], vendor+":"+product+":") {
+			matched = append(matched, uri)
+		}
+	}
+	return matched, []string{}, nil
+}
+
+func TestInferPart(t *testing.T) {
+	var tests = []struct {
+		vendor   string
+		product  string
+		expected PartInference
+	}{
+		{vendor: "microsoft", product: "windows_10", expected: PartInference{Part: "o", Basis: "product", CPEs: 2, Share: 1}},
+		{vendor: "microsoft", product: "windows_11", expected: PartInference{Part: "o", Basis: "vendor", CPEs: 3, Share: 2.0 / 3}},
+		{vendor: "cisco", product: "asa_5510", expected: PartInference{Part: "o", Basis: "vendor", CPEs: 2, Share: 0.5}},
+		{vendor: "cybozu", product: "office", expected: PartInference{Part: "a", Basis: "default"}},
+	}
+	for i, tt := range tests {
+		actual, err := InferPart(partDriver{}, tt.vendor, tt.product)
+		if err != nil {
+			t.Fatalf("[%d] InferPart: %s", i, err)
+		}
+		if actual != tt.expected {
+			t.Errorf("[%d] actual %v, expected %v", i, actual, tt.expected)
+		}
+	}
+}
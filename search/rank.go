@@ -0,0 +1,222 @@
+package search
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+// Default weights of the relevance score
+const (
+	exactProductBonus = 50.0
+	exactVendorBonus  = 20.0
+	prefixBonus       = 10.0
+	popularityWeight  = 30.0
+	deprecatedPenalty = 20.0
+	// knownExploitedBonus prefers the vendor/products in the CISA Known Exploited Vulnerabilities catalog
+	knownExploitedBonus = 10.0
+)
+
+// Weights are the weights of the relevance score of Rank
+type Weights struct {
+	// ExactProduct is added when the product is the one searched
+	ExactProduct float64 `mapstructure:"exact_product"`
+	// ExactVendor is added when the vendor is the one searched
+	ExactVendor float64 `mapstructure:"exact_vendor"`
+	// Prefix is added when the product starts with the one searched
+	Prefix float64 `mapstructure:"prefix"`
+	// Popularity is multiplied by the CVE-reference popularity on a log scale, 1 for the most popular candidate
+	Popularity float64 `mapstructure:"popularity"`
+	// Deprecated is subtracted by the share of the deprecated CPEs
+	Deprecated float64 `mapstructure:"deprecated"`
+	// KnownExploited is added for the vendor/products in the CISA Known Exploited Vulnerabilities catalog
+	KnownExploited float64 `mapstructure:"known_exploited"`
+	// Versions is multiplied by the number of versions on a log scale, 1 for the candidate of the most versions.
+	// The CPEs carry no dates, so the products released again and again stand for the recent ones.
+	Versions float64 `mapstructure:"versions"`
+}
+
+// DefaultWeights returns the weights Rank scores by unless SetRanking replaces them
+func DefaultWeights() Weights {
+	return Weights{
+		ExactProduct:   exactProductBonus,
+		ExactVendor:    exactVendorBonus,
+		Prefix:         prefixBonus,
+		Popularity:     popularityWeight,
+		Deprecated:     deprecatedPenalty,
+		KnownExploited: knownExploitedBonus,
+	}
+}
+
+// Scorer returns the score of c, a candidate of s already scored by the weights, e.g. the Score of a Go plugin
+type Scorer func(c Candidate, s models.ProductSummary) float64
+
+// Ranking is how Rank scores the candidates
+type Ranking struct {
+	Weights Weights
+	// Scorer rescores each candidate after the weights unless nil
+	Scorer Scorer
+}
+
+// ranking is the Ranking of Rank
+var ranking = Ranking{Weights: DefaultWeights()}
+
+// SetRanking replaces the Ranking of Rank, e.g. by the ranking config of an organization.
+// It's set at startup, since Rank reads it without a lock.
+func SetRanking(r Ranking) {
+	ranking = r
+}
+
+// Candidate is a vendor/product matched by Rank
+type Candidate struct {
+	Vendor     string  `json:"vendor"`
+	Product    string  `json:"product"`
+	Score      float64 `json:"score"`
+	Popularity int     `json:"popularity"`
+	CPEs       int     `json:"cpes"`
+	Deprecated int     `json:"deprecated"`
+	// KnownExploited tells the vendor/product is in the CISA Known Exploited Vulnerabilities catalog
+	KnownExploited bool `json:"knownExploited"`
+}
+
+// Rank returns the vendor/products matching vendor and product, most relevant first.
+// Both are LIKE patterns as in GetCpesByVendorProduct, and an empty vendor matches any vendor.
+// A product without wildcards also matches the products containing it, so "node" finds nodejs::node.js.
+// The score adds a bonus for an exact match, the CVE-reference popularity on a log scale,
+// a penalty by the share of deprecated CPEs, and a bonus for the vendor/products under active exploitation,
+// each by the Weights of SetRanking.
+func Rank(driver db.DB, vendor, product string) ([]Candidate, error) {
+	product = strings.TrimSpace(product)
+	if product == "" {
+		return []Candidate{}, nil
+	}
+
+	summaries, known, err := indexSummaries(driver)
+	if err != nil {
+		return nil, err
+	}
+	return rank(ranking, summaries, known, strings.TrimSpace(vendor), product), nil
+}
+
+func rank(r Ranking, summaries []models.ProductSummary, known map[string]bool, vendor, product string) []Candidate {
+	vendorMatch := likeMatcher(vendor, false)
+	productMatch := likeMatcher(product, true)
+
+	matched := []models.ProductSummary{}
+	maxPopularity, maxVersions := 0, 0
+	for _, s := range summaries {
+		if !vendorMatch(unescape(s.Vendor)) || !productMatch(unescape(s.Product)) {
+			continue
+		}
+		matched = append(matched, s)
+		if maxPopularity < s.Popularity {
+			maxPopularity = s.Popularity
+		}
+		if maxVersions < s.Versions {
+			maxVersions = s.Versions
+		}
+	}
+
+	candidates := make([]Candidate, 0, len(matched))
+	for _, s := range matched {
+		c := Candidate{
+			Vendor:         s.Vendor,
+			Product:        s.Product,
+			Score:          score(r.Weights, s, vendor, product, maxPopularity, maxVersions),
+			Popularity:     s.Popularity,
+			CPEs:           s.CPEs,
+			Deprecated:     s.Deprecated,
+			KnownExploited: known[s.Vendor+"::"+s.Product],
+		}
+		if c.KnownExploited {
+			c.Score += r.Weights.KnownExploited
+		}
+		if r.Scorer != nil {
+			c.Score = math.Round(r.Scorer(c, s)*100) / 100
+		}
+		candidates = append(candidates, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		if candidates[i].Vendor != candidates[j].Vendor {
+			return candidates[i].Vendor < candidates[j].Vendor
+		}
+		return candidates[i].Product < candidates[j].Product
+	})
+	return candidates
+}
+
+func score(w Weights, s models.ProductSummary, vendor, product string, maxPopularity, maxVersions int) float64 {
+	v, p := strings.ToLower(unescape(s.Vendor)), strings.ToLower(unescape(s.Product))
+	vendor, product = db.UnescapeLike(vendor), strings.ToLower(db.UnescapeLike(product))
+
+	var sc float64
+	switch {
+	case p == product:
+		sc += w.ExactProduct
+	case strings.HasPrefix(p, product):
+		sc += w.Prefix
+	}
+	if vendor != "" && v == strings.ToLower(vendor) {
+		sc += w.ExactVendor
+	}
+	if 0 < maxPopularity {
+		sc += w.Popularity * math.Log1p(float64(s.Popularity)) / math.Log1p(float64(maxPopularity))
+	}
+	if 0 < maxVersions {
+		sc += w.Versions * math.Log1p(float64(s.Versions)) / math.Log1p(float64(maxVersions))
+	}
+	if 0 < s.CPEs {
+		sc -= w.Deprecated * float64(s.Deprecated) / float64(s.CPEs)
+	}
+	return math.Round(sc*100) / 100
+}
+
+// likeMatcher matches case-insensitively like the LIKE operator escaping by db.LikeEscape.
+// Without wildcards, substring also matches the values containing pattern.
+func likeMatcher(pattern string, substring bool) func(string) bool {
+	if pattern == "" || pattern == "%" {
+		return func(string) bool { return true }
+	}
+	pattern = unescape(pattern)
+	if !db.HasLikeWildcard(pattern) {
+		pattern = strings.ToLower(db.UnescapeLike(pattern))
+		if substring {
+			return func(s string) bool { return strings.Contains(strings.ToLower(s), pattern) }
+		}
+		return func(s string) bool { return strings.ToLower(s) == pattern }
+	}
+
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		case r == db.LikeEscape:
+			escaped = true
+		case r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	re := regexp.MustCompile(b.String())
+	return re.MatchString
+}
+
+// unescape drops the WFN escapes, e.g. node\.js to node.js
+func unescape(s string) string {
+	return strings.ReplaceAll(s, `\`, "")
+}
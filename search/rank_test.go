@@ -0,0 +1,135 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func TestRank(t *testing.T) {
+	summaries := []models.ProductSummary{
+		{Vendor: "nodejs", Product: "node\\.js", CPEs: 100, Popularity: 300},
+		{Vendor: "node-red", Product: "node", CPEs: 2, Popularity: 1},
+		{Vendor: "nodebb", Product: "nodebb", CPEs: 10, Popularity: 20},
+		{Vendor: "old", Product: "node", CPEs: 4, Deprecated: 4},
+		{Vendor: "apache", Product: "http_server", CPEs: 50, Popularity: 1000},
+	}
+
+	var tests = []struct {
+		vendor   string
+		product  string
+		known    map[string]bool
+		expected []string
+	}{
+		{
+			product:  "node",
+			expected: []string{"node-red::node", "nodejs::node\\.js", "old::node", "nodebb::nodebb"},
+		},
+		{
+			vendor:   "nodejs",
+			product:  "node.js",
+			expected: []string{"nodejs::node\\.js"},
+		},
+		{
+			vendor:   "node%",
+			product:  "node",
+			expected: []string{"node-red::node", "nodejs::node\\.js", "nodebb::nodebb"},
+		},
+		{
+			product:  "http_server",
+			expected: []string{"apache::http_server"},
+		},
+		{
+			product:  "tomcat",
+			expected: []string{},
+		},
+		// the known exploited is preferred
+		{
+			product:  "node",
+			known:    map[string]bool{"old::node": true},
+			expected: []string{"node-red::node", "old::node", "nodejs::node\\.js", "nodebb::nodebb"},
+		},
+	}
+
+	for i, tt := range tests {
+		actual := []string{}
+		for _, c := range rank(Ranking{Weights: DefaultWeights()}, summaries, tt.known, tt.vendor, tt.product) {
+			actual = append(actual, c.Vendor+"::"+c.Product)
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("[%d] actual %#v, expected %#v", i, actual, tt.expected)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	var tests = []struct {
+		summary  models.ProductSummary
+		vendor   string
+		product  string
+		expected float64
+	}{
+		{
+			summary:  models.ProductSummary{Vendor: "nodejs", Product: "node\\.js", CPEs: 10, Popularity: 10},
+			vendor:   "nodejs",
+			product:  "node.js",
+			expected: exactProductBonus + exactVendorBonus + popularityWeight,
+		},
+		{
+			summary:  models.ProductSummary{Vendor: "old", Product: "node", CPEs: 4, Deprecated: 4},
+			product:  "node",
+			expected: exactProductBonus - deprecatedPenalty,
+		},
+		{
+			summary:  models.ProductSummary{Vendor: "nodebb", Product: "nodebb", CPEs: 4, Deprecated: 2},
+			product:  "node",
+			expected: prefixBonus - deprecatedPenalty/2,
+		},
+	}
+
+	for i, tt := range tests {
+		if actual := score(DefaultWeights(), tt.summary, tt.vendor, tt.product, 10, 0); actual != tt.expected {
+			t.Errorf("[%d] actual %v, expected %v", i, actual, tt.expected)
+		}
+	}
+}
+
+func TestRankBy(t *testing.T) {
+	summaries := []models.ProductSummary{
+		{Vendor: "nodejs", Product: "node\\.js", CPEs: 100, Versions: 300, Popularity: 300},
+		{Vendor: "node-red", Product: "node", CPEs: 2, Versions: 2, Popularity: 1},
+	}
+
+	var tests = []struct {
+		ranking  Ranking
+		expected []string
+	}{
+		{
+			ranking:  Ranking{Weights: DefaultWeights()},
+			expected: []string{"node-red::node", "nodejs::node\\.js"},
+		},
+		// the products of many versions outweigh the exact match
+		{
+			ranking:  Ranking{Weights: Weights{ExactProduct: 10, Versions: 100}},
+			expected: []string{"nodejs::node\\.js", "node-red::node"},
+		},
+		// the scorer has the last word
+		{
+			ranking: Ranking{Weights: DefaultWeights(), Scorer: func(c Candidate, s models.ProductSummary) float64 {
+				return float64(s.CPEs)
+			}},
+			expected: []string{"nodejs::node\\.js", "node-red::node"},
+		},
+	}
+
+	for i, tt := range tests {
+		actual := []string{}
+		for _, c := range rank(tt.ranking, summaries, nil, "", "node") {
+			actual = append(actual, c.Vendor+"::"+c.Product)
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("[%d] actual %#v, expected %#v", i, actual, tt.expected)
+		}
+	}
+}
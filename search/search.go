@@ -0,0 +1,98 @@
+package search
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"golang.org/x/xerrors"
+)
+
+// Result is a vendor/product matched by Products
+type Result struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	Title   string `json:"title,omitempty"`
+	// KnownExploited tells the vendor/product is in the CISA Known Exploited Vulnerabilities catalog
+	KnownExploited bool `json:"knownExploited,omitempty"`
+}
+
+// Products searches vendor/products by a query written in either romaji or kana.
+// The query is matched against the vendor, the product and the JVN title after
+// transliteration, so "サイボウズ" finds cybozu and "saibozu" finds its Japanese title.
+// A multi-word query also matches by tokens, so "sql server 2019" finds microsoft::sql_server.
+func Products(driver db.DB, query string) ([]Result, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []Result{}, nil
+	}
+
+	entries, known, err := indexEntries(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	results, scores := products(entries, known, query)
+	// the results matching more tokens come first, the known exploited first among them
+	sort.Slice(results, func(i, j int) bool {
+		if scores[results[i]] != scores[results[j]] {
+			return scores[results[i]] > scores[results[j]]
+		}
+		if results[i].KnownExploited != results[j].KnownExploited {
+			return results[i].KnownExploited
+		}
+		if results[i].Vendor != results[j].Vendor {
+			return results[i].Vendor < results[j].Vendor
+		}
+		return results[i].Product < results[j].Product
+	})
+	return results, nil
+}
+
+// products returns the vendor/products of entries matching query and how many tokens of query each matches
+func products(entries []IndexEntry, known map[string]bool, query string) ([]Result, map[Result]int) {
+	q := Normalize(query)
+	tokens := Tokenize(query)
+	results := []Result{}
+	scores := map[Result]int{}
+	for _, e := range entries {
+		r := Result{Vendor: e.Vendor, Product: e.Product, Title: e.Title, KnownExploited: known[e.Vendor+"::"+e.Product]}
+		score := matchFieldTokens(tokens, e.Tokens)
+		if match(q, query, e) {
+			score = len(tokens)
+		}
+		if 0 <= score {
+			results = append(results, r)
+			scores[r] = score
+		}
+	}
+	return results, scores
+}
+
+func match(normalized, raw string, e IndexEntry) bool {
+	if e.Title != "" && strings.Contains(e.Title, raw) {
+		return true
+	}
+	if normalized == "" {
+		return false
+	}
+	for _, s := range e.Normalized {
+		if s != "" && strings.Contains(s, normalized) {
+			return true
+		}
+	}
+	return false
+}
+
+// knownExploited returns the vendor::products in the CISA Known Exploited Vulnerabilities catalog
+func knownExploited(driver db.DB) (map[string]bool, error) {
+	products, err := driver.GetKnownExploited()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get known exploited products. err: %w", err)
+	}
+	known := make(map[string]bool, len(products))
+	for _, p := range products {
+		known[p.Vendor+"::"+p.Product] = true
+	}
+	return known, nil
+}
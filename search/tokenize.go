@@ -0,0 +1,64 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits s into normalized tokens at spaces, underscores, hyphens and the other separators,
+// so that "SQL Server 2019" and "sql_server" share the tokens "sql" and "server".
+func Tokenize(s string) []string {
+	tokens := []string{}
+	seen := map[string]bool{}
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if t := Normalize(f); t != "" && !seen[t] {
+			seen[t] = true
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// matchTokens returns how many of the query tokens are found in the vendor, product or title of r,
+// or -1 when r doesn't match. Tokens starting with a digit (e.g. the 2019 of "sql server 2019")
+// are usually versions rather than a part of the name, so they may be missing as long as
+// a word token is found.
+func matchTokens(tokens []string, r Result) int {
+	return matchFieldTokens(tokens, Tokenize(strings.Join([]string{r.Vendor, r.Product, r.Title}, " ")))
+}
+
+// matchFieldTokens is matchTokens against the tokens of the fields, e.g. those of an IndexEntry
+func matchFieldTokens(tokens, fields []string) int {
+	if len(tokens) == 0 {
+		return -1
+	}
+	matched, words := 0, 0
+	for _, t := range tokens {
+		found := false
+		for _, f := range fields {
+			if strings.Contains(f, t) {
+				found = true
+				break
+			}
+		}
+		switch {
+		case found:
+			matched++
+			if !isVersionToken(t) {
+				words++
+			}
+		case !isVersionToken(t):
+			return -1
+		}
+	}
+	if words == 0 && matched < len(tokens) {
+		return -1
+	}
+	return matched
+}
+
+func isVersionToken(t string) bool {
+	return t != "" && unicode.IsDigit([]rune(t)[0])
+}
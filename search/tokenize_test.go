@@ -0,0 +1,47 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	var tests = []struct {
+		in       string
+		expected []string
+	}{
+		{in: "SQL Server 2019", expected: []string{"sql", "server", "2019"}},
+		{in: "sql_server", expected: []string{"sql", "server"}},
+		{in: "internet-explorer  11.0", expected: []string{"internet", "explorer", "11", "0"}},
+		{in: "サイボウズ　Office", expected: []string{"saibozu", "office"}},
+		{in: " _-", expected: []string{}},
+	}
+
+	for i, tt := range tests {
+		if actual := Tokenize(tt.in); !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("[%d] expected: %#v, actual: %#v", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestMatchTokens(t *testing.T) {
+	var tests = []struct {
+		query    string
+		r        Result
+		expected int
+	}{
+		{query: "sql server 2019", r: Result{Vendor: "microsoft", Product: "sql_server"}, expected: 2},
+		{query: "sql server 2019", r: Result{Vendor: "microsoft", Product: "sql_server_2019"}, expected: 3},
+		{query: "microsoft sql", r: Result{Vendor: "microsoft", Product: "sql_server"}, expected: 2},
+		{query: "sql server", r: Result{Vendor: "microsoft", Product: "exchange_server"}, expected: -1},
+		{query: "2019", r: Result{Vendor: "microsoft", Product: "sql_server"}, expected: -1},
+		{query: "サイボウズ office", r: Result{Vendor: "cybozu", Product: "office", Title: "サイボウズ Office"}, expected: 2},
+		{query: "_", r: Result{Vendor: "microsoft", Product: "sql_server"}, expected: -1},
+	}
+
+	for i, tt := range tests {
+		if actual := matchTokens(Tokenize(tt.query), tt.r); actual != tt.expected {
+			t.Errorf("[%d] expected: %d, actual: %d", i, tt.expected, actual)
+		}
+	}
+}
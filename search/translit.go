@@ -0,0 +1,151 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// hiragana to Hepburn romaji
+var kanaRomaji = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ゔ': "vu",
+}
+
+// small kana combined with the preceding kana, e.g. き+ゃ = kya, ふ+ぁ = fa
+var smallKana = map[rune]string{
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o", 'ゎ': "wa",
+}
+
+// ToRomaji transliterates hiragana and katakana into Hepburn romaji.
+// Full-width ASCII is folded to half-width and other characters are kept as they are.
+func ToRomaji(s string) string {
+	rs := []rune(s)
+	var sb strings.Builder
+	sokuon := false
+	for i := 0; i < len(rs); i++ {
+		r := foldWidth(rs[i])
+		if 'ァ' <= r && r <= 'ヶ' {
+			// katakana to hiragana
+			r -= 'ァ' - 'ぁ'
+		}
+
+		switch {
+		case r == 'っ':
+			sokuon = true
+			continue
+		case r == 'ー':
+			// long vowel mark repeats the last vowel
+			if b := []rune(sb.String()); 0 < len(b) && strings.ContainsRune("aiueo", b[len(b)-1]) {
+				sb.WriteRune(b[len(b)-1])
+			}
+			continue
+		}
+
+		romaji, ok := kanaRomaji[r]
+		if !ok {
+			if small, ok := smallKana[r]; ok {
+				romaji = small
+			} else {
+				sokuon = false
+				sb.WriteRune(unicode.ToLower(r))
+				continue
+			}
+		}
+		if i+1 < len(rs) {
+			if small, ok := smallKana[foldKatakana(rs[i+1])]; ok && r != 'ん' {
+				romaji = combine(r, romaji, small)
+				i++
+			}
+		}
+		if sokuon {
+			if romaji[0] == 'c' {
+				sb.WriteByte('t')
+			} else if !strings.ContainsRune("aiueon", rune(romaji[0])) {
+				sb.WriteByte(romaji[0])
+			}
+			sokuon = false
+		}
+		sb.WriteString(romaji)
+	}
+	return sb.String()
+}
+
+// combine kana with the following small kana
+func combine(r rune, romaji, small string) string {
+	if r == 'う' {
+		// うぃ = wi, うぇ = we
+		return "w" + small
+	}
+	base := strings.TrimRight(romaji, "aiueo")
+	if strings.HasPrefix(small, "y") && (base == "sh" || base == "ch" || base == "j") {
+		// しゃ = sha, not shya
+		return base + small[1:]
+	}
+	return base + small
+}
+
+func foldKatakana(r rune) rune {
+	if 'ァ' <= r && r <= 'ヶ' {
+		return r - ('ァ' - 'ぁ')
+	}
+	return r
+}
+
+// foldWidth folds full-width ASCII and the ideographic space into half-width
+func foldWidth(r rune) rune {
+	switch {
+	case 0xFF01 <= r && r <= 0xFF5E:
+		return r - 0xFEE0
+	case r == 0x3000:
+		return ' '
+	}
+	return r
+}
+
+// looseReplacer absorbs the difference between Hepburn and Kunrei-shiki romaji
+var looseReplacer = strings.NewReplacer(
+	"shi", "si", "chi", "ti", "tsu", "tu", "fu", "hu", "ji", "zi",
+	"sh", "sy", "ch", "ty",
+)
+
+// Normalize returns a loose romaji form used for matching, so that e.g.
+// "サイボウズ", "saibouzu" and "Saibozu" all normalize to the same string.
+func Normalize(s string) string {
+	s = strings.ToLower(ToRomaji(s))
+
+	var sb strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	s = looseReplacer.Replace(sb.String())
+
+	// collapse long vowels: ou, oo, uu, aa, ii, ee
+	var out []rune
+	for _, r := range s {
+		if n := len(out); 0 < n && strings.ContainsRune("aiueo", r) {
+			prev := out[n-1]
+			if prev == r || (prev == 'o' && r == 'u') {
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
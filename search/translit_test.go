@@ -0,0 +1,43 @@
+package search
+
+import "testing"
+
+func TestToRomaji(t *testing.T) {
+	var tests = []struct {
+		in       string
+		expected string
+	}{
+		{in: "サイボウズ", expected: "saibouzu"},
+		{in: "ちゃっと", expected: "chatto"},
+		{in: "マッチ", expected: "matchi"},
+		{in: "サーバー", expected: "saabaa"},
+		{in: "ウィンドウズ", expected: "windouzu"},
+		{in: "ＡＢＣ　ソフト", expected: "abc sofuto"},
+		{in: "MySQL", expected: "mysql"},
+	}
+
+	for i, tt := range tests {
+		if actual := ToRomaji(tt.in); actual != tt.expected {
+			t.Errorf("[%d] expected: %s, actual: %s", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	var tests = []struct {
+		in       []string
+		expected string
+	}{
+		{in: []string{"サイボウズ", "saibouzu", "Saibozu"}, expected: "saibozu"},
+		{in: []string{"しすてむ", "shisutemu", "sisutemu"}, expected: "sisutemu"},
+		{in: []string{"ふじつう", "Fujitsu", "hujitu"}, expected: "huzitu"},
+	}
+
+	for i, tt := range tests {
+		for _, in := range tt.in {
+			if actual := Normalize(in); actual != tt.expected {
+				t.Errorf("[%d] in: %s, expected: %s, actual: %s", i, in, tt.expected, actual)
+			}
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build embedseed
+// +build embedseed
+
+package seed
+
+import (
+	// for go:embed
+	_ "embed"
+)
+
+//go:embed cpes.jsonl.gz
+var embedded []byte
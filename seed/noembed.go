@@ -0,0 +1,6 @@
+//go:build !embedseed
+// +build !embedseed
+
+package seed
+
+var embedded []byte
@@ -0,0 +1,81 @@
+// Package seed reads and writes the seed dictionary, a snapshot of the CPEs loaded into a new DB instead of fetching them.
+// A binary built with the embedseed tag embeds the seed at seed/cpes.jsonl.gz, written by the seed command before the build.
+package seed
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+// Header is the first line of a seed
+type Header struct {
+	SchemaVersion      uint       `json:"schemaVersion"`
+	FetchedAt          time.Time  `json:"fetchedAt"`
+	NVDDictVersion     string     `json:"nvdDictVersion,omitempty"`
+	NVDDictGeneratedAt *time.Time `json:"nvdDictGeneratedAt,omitempty"`
+	CPEs               int        `json:"cpes"`
+	// Source is the source of the CPEs written ahead by a fetch, empty in a seed
+	Source models.FetchType `json:"source,omitempty"`
+	// Generation is the generation of the DB exported, passed as --since-generation to the next delta export
+	Generation uint64 `json:"generation,omitempty"`
+	// SinceGeneration and Since are where a delta export starts, zero in a full one
+	SinceGeneration uint64     `json:"sinceGeneration,omitempty"`
+	Since           *time.Time `json:"since,omitempty"`
+}
+
+// Embedded returns the seed embedded in the binary, nil when it's built without the embedseed tag
+func Embedded() []byte {
+	return embedded
+}
+
+// Write writes the header and the CPEs to w as gzipped JSON Lines
+func Write(w io.Writer, header Header, cpes []models.CategorizedCpe) error {
+	gw := gzip.NewWriter(w)
+	enc := json.NewEncoder(gw)
+	header.CPEs = len(cpes)
+	if err := enc.Encode(header); err != nil {
+		return fmt.Errorf("Failed to write the header. err: %s", err)
+	}
+	for _, c := range cpes {
+		c.ID = 0
+		if err := enc.Encode(c); err != nil {
+			return fmt.Errorf("Failed to write CPEs. err: %s", err)
+		}
+	}
+	return gw.Close()
+}
+
+// Read reads a seed written by Write
+func Read(r io.Reader) (Header, []models.CategorizedCpe, error) {
+	var header Header
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return header, nil, fmt.Errorf("Failed to decompress the seed. err: %s", err)
+	}
+	defer gr.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(gr))
+	if err := dec.Decode(&header); err != nil {
+		return header, nil, fmt.Errorf("Failed to read the header. err: %s", err)
+	}
+	cpes := make([]models.CategorizedCpe, 0, header.CPEs)
+	for {
+		var c models.CategorizedCpe
+		if err := dec.Decode(&c); err == io.EOF {
+			break
+		} else if err != nil {
+			return header, nil, fmt.Errorf("Failed to read CPEs. err: %s", err)
+		}
+		cpes = append(cpes, c)
+	}
+	if len(cpes) != header.CPEs {
+		return header, nil, fmt.Errorf("The seed is truncated. expected: %d CPEs, got: %d", header.CPEs, len(cpes))
+	}
+	return header, cpes, nil
+}
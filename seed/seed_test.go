@@ -0,0 +1,50 @@
+package seed
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func TestWriteRead(t *testing.T) {
+	generatedAt := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	header := Header{SchemaVersion: models.LatestSchemaVersion, FetchedAt: generatedAt, NVDDictVersion: "2.3", NVDDictGeneratedAt: &generatedAt}
+	cpes := []models.CategorizedCpe{
+		{ID: 1, FetchType: models.NVD, CpeURI: "cpe:/a:apache:http_server:2.4.58", CpeFS: "cpe:2.3:a:apache:http_server:2.4.58:*:*:*:*:*:*:*", Part: "a", Vendor: "apache", Product: "http_server", Version: "2\\.4\\.58", Popularity: 250},
+		{ID: 2, FetchType: models.JVN, CpeURI: "cpe:/a:cybozu:office:9.0", Deprecated: true, DeprecatedBy: "cpe:/a:cybozu:cybozu_office:9.0", Title: "サイボウズ Office"},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, header, cpes); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	gotHeader, gotCpes, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read: %s", err)
+	}
+
+	header.CPEs = len(cpes)
+	if !reflect.DeepEqual(gotHeader, header) {
+		t.Errorf("expected %+v, got %+v", header, gotHeader)
+	}
+	// the IDs are assigned by the DB the seed is loaded into
+	for i := range cpes {
+		cpes[i].ID = 0
+	}
+	if !reflect.DeepEqual(gotCpes, cpes) {
+		t.Errorf("expected %+v, got %+v", cpes, gotCpes)
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, Header{}, []models.CategorizedCpe{{CpeURI: "cpe:/a:apache:http_server:2.4.58"}}); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if _, _, err := Read(bytes.NewReader(buf.Bytes()[:buf.Len()/2])); err == nil {
+		t.Errorf("expected an error of the truncated seed")
+	}
+}
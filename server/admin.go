@@ -0,0 +1,129 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
+	"github.com/labstack/echo"
+	"golang.org/x/xerrors"
+)
+
+// RebuildIndexFunc builds the search index from the DB and serves it, e.g. saving it for the next start too
+type RebuildIndexFunc func() (*search.Index, error)
+
+// adminRoutes adds the routes managing the server to r, which are authenticated by the bearer token
+func adminRoutes(r router, token string, s *scheduler, driver db.DB, rebuild RebuildIndexFunc) {
+	auth := adminAuth(token)
+	r.POST("/admin/fetch", triggerFetch(s), auth)
+	r.GET("/admin/fetch/status", fetchStatus(s), auth)
+	r.POST("/admin/cache/flush", flushCaches(driver), auth)
+	r.POST("/admin/index/rebuild", rebuildIndex(rebuild), auth)
+}
+
+// adminAuth rejects the requests without the bearer token with 401 Unauthorized
+func adminAuth(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			given := strings.TrimPrefix(auth, "Bearer ")
+			if given == auth || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// Handler starts fetching the sources of the comma separated source parameter in the background,
+// the sources configured without it. It responds 202 Accepted with the status, and 409 Conflict while fetching.
+func triggerFetch(s *scheduler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var sources []models.FetchType
+		if param := c.QueryParam("source"); param != "" {
+			var err error
+			if sources, err = models.ParseFetchTypes(param); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			}
+		}
+		log15.Info("Fetch requested", "sources", sources, "remote", c.RealIP())
+
+		if err := s.trigger(sources); err != nil {
+			switch {
+			case xerrors.Is(err, errFetchRunning):
+				return c.JSON(http.StatusConflict, s.getStatus())
+			case xerrors.Is(err, errFetchDisabled):
+				return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		c.Response().Header().Set(echo.HeaderLocation, "/admin/fetch/status")
+		return c.JSON(http.StatusAccepted, s.getStatus())
+	}
+}
+
+// Handler
+// POST /admin/cache/flush drops the caches of the server and of the DB, so that the requests read the DB as it is now,
+// e.g. after a fetch by another process or a cache gone inconsistent. It responds 200 OK with the caches flushed.
+func flushCaches(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		log15.Info("Cache flush requested", "remote", c.RealIP())
+		hashes.flush()
+		filters.flush()
+		collated.flush()
+		// the duplicate lookups are collapsed only while they run, so there's nothing of flightDriver to flush
+		if f, ok := driver.(*flightDriver); ok {
+			driver = f.DB
+		}
+		if err := db.FlushCache(driver); err != nil {
+			log15.Error("Failed to flush the cache of the DB", "err", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, map[string][]string{"flushed": {"hashes", "filters", "listings", "db"}})
+	}
+}
+
+// rebuilding serializes the rebuilds of the search index
+var rebuilding sync.Mutex
+
+// Handler
+// POST /admin/index/rebuild builds the search index again and serves it, responding 200 OK with its generation and size.
+// The rebuilds requested during one wait for it.
+func rebuildIndex(rebuild RebuildIndexFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		log15.Info("Index rebuild requested", "remote", c.RealIP())
+		rebuilding.Lock()
+		defer rebuilding.Unlock()
+
+		started := time.Now()
+		ix, err := rebuild()
+		if err != nil {
+			log15.Error("Failed to rebuild the search index", "err", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"generation":     ix.Generation,
+			"vendorProducts": len(ix.Entries),
+			"elapsed":        time.Since(started).String(),
+		})
+	}
+}
+
+// buildIndex is the RebuildIndexFunc of the server without Option.RebuildIndex, serving the index without saving it
+func buildIndex(driver db.DB) RebuildIndexFunc {
+	return func() (*search.Index, error) {
+		ix, err := search.BuildIndex(driver)
+		if err != nil {
+			return nil, err
+		}
+		search.SetIndex(ix)
+		return ix, nil
+	}
+}
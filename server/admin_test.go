@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
+	"github.com/labstack/echo"
+	"golang.org/x/xerrors"
+)
+
+func TestAdminFetch(t *testing.T) {
+	release, requested := make(chan struct{}), make(chan []models.FetchType, 1)
+	s := newScheduler(0, func(ctx context.Context, sources []models.FetchType) error {
+		requested <- sources
+		<-release
+		return nil
+	})
+	e := echo.New()
+	adminRoutes(e, "secret", s, &generationDriver{}, buildIndex(&generationDriver{}))
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var tests = []struct {
+		method   string
+		path     string
+		token    string
+		expected int
+	}{
+		{method: http.MethodPost, path: "/admin/fetch?source=nvd", expected: http.StatusUnauthorized},
+		{method: http.MethodPost, path: "/admin/fetch?source=nvd", token: "wrong", expected: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/admin/fetch/status", expected: http.StatusUnauthorized},
+		{method: http.MethodPost, path: "/admin/fetch?source=foo", token: "secret", expected: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/admin/fetch?source=nvd", token: "secret", expected: http.StatusAccepted},
+		{method: http.MethodPost, path: "/admin/fetch", token: "secret", expected: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if rec := do(tt.method, tt.path, tt.token); rec.Code != tt.expected {
+			t.Errorf("%s %s: actual %d, expected %d", tt.method, tt.path, rec.Code, tt.expected)
+		}
+	}
+
+	if sources := <-requested; !reflect.DeepEqual(sources, []models.FetchType{models.NVD}) {
+		t.Errorf("actual %v, expected [nvd]", sources)
+	}
+	rec := do(http.MethodGet, "/admin/fetch/status", "secret")
+	var status FetchStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to unmarshal the status: %s", err)
+	}
+	if !status.Running || !reflect.DeepEqual(status.Sources, []models.FetchType{models.NVD}) {
+		t.Errorf("actual %#v, expected running nvd", status)
+	}
+	close(release)
+}
+
+func TestAdminCacheAndIndex(t *testing.T) {
+	var rebuilds int
+	var rebuildErr error
+	rebuild := func() (*search.Index, error) {
+		rebuilds++
+		if rebuildErr != nil {
+			return nil, rebuildErr
+		}
+		return &search.Index{Generation: 3, Entries: make([]search.IndexEntry, 2)}, nil
+	}
+	driver := &generationDriver{generation: 3}
+	e := echo.New()
+	adminRoutes(e, "secret", newScheduler(0, nil), newFlightDriver(driver), rebuild)
+
+	do := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, path := range []string{"/admin/cache/flush", "/admin/index/rebuild"} {
+		if rec := do(path, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: actual %d, expected %d", path, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	if rebuilds != 0 {
+		t.Errorf("actual %d rebuilds without the token, expected none", rebuilds)
+	}
+
+	hashes = hashCache{generation: 3, hashes: &db.Hashes{}}
+	if rec := do("/admin/cache/flush", "secret"); rec.Code != http.StatusOK {
+		t.Errorf("flush: actual %d, expected %d", rec.Code, http.StatusOK)
+	}
+	if hashes.hashes != nil {
+		t.Errorf("actual the hashes left, expected them flushed")
+	}
+
+	rec := do("/admin/index/rebuild", "secret")
+	var body struct {
+		Generation     uint64 `json:"generation"`
+		VendorProducts int    `json:"vendorProducts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to unmarshal the response: %s", err)
+	}
+	if rec.Code != http.StatusOK || body.Generation != 3 || body.VendorProducts != 2 {
+		t.Errorf("rebuild: actual %d %#v, expected 200 of the generation 3 with 2 vendor/products", rec.Code, body)
+	}
+
+	rebuildErr = xerrors.New("broken")
+	if rec := do("/admin/index/rebuild", "secret"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("rebuild: actual %d, expected %d", rec.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/labstack/echo"
+	"golang.org/x/xerrors"
+)
+
+// parseAsOf parses the asOf parameter, a date (its start in UTC) or an RFC 3339 time, zero without it
+func parseAsOf(c echo.Context) (time.Time, error) {
+	param := c.QueryParam("asOf")
+	if param == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, param); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, xerrors.Errorf("invalid asOf: %s, expected a date or an RFC 3339 time, e.g. 2023-06-01", param)
+}
+
+// asOfFailed answers the error of a query as of a time, 501 Not Implemented on a DB not tracking the history
+func asOfFailed(c echo.Context, query string, err error) error {
+	if xerrors.Is(err, db.ErrNoHistory) {
+		return c.JSON(http.StatusNotImplemented, map[string]string{"error": "asOf is supported on the RDB only"})
+	}
+	log15.Error(fmt.Sprintf("Failed to %s", query), "err", err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+// getCpesAsOf answers GET /cpes/:vendor/:product?asOf= as getCpesByVendorProduct does, with the CPEs as they were at asOf
+func getCpesAsOf(c echo.Context, driver db.DB, vendor, product string, asOf time.Time) error {
+	if c.QueryParam("sources") != "" {
+		return badRequest(c, "asOf can't be combined with sources")
+	}
+	details, err := driver.GetCpeDetailsAsOf(vendor, product, asOf)
+	if err != nil {
+		return asOfFailed(c, "GetCpeDetailsAsOf", err)
+	}
+	if c.QueryParam("detail") == "true" {
+		return c.JSON(http.StatusOK, details)
+	}
+
+	cpeURIs, deprecated := details.CpeURIs()
+	if wantStream(c) {
+		return streamNDJSON(c, len(cpeURIs)+len(deprecated), func(i int) interface{} {
+			if i < len(cpeURIs) {
+				return streamedCpe{CpeURI: cpeURIs[i]}
+			}
+			return streamedCpe{CpeURI: deprecated[i-len(cpeURIs)], Deprecated: true}
+		})
+	}
+	return c.JSON(http.StatusOK, map[string][]string{"cpeURIs": cpeURIs, "deprecated": deprecated})
+}
+
+// getVendorProductsAsOf answers GET /products?asOf= with the vendor/products as they were at asOf, ordered by the collator
+func getVendorProductsAsOf(c echo.Context, driver db.DB, asOf time.Time) error {
+	if c.QueryParam("sort") != "" {
+		return badRequest(c, "asOf can't be combined with sort")
+	}
+	products, err := driver.GetVendorProductsAsOf(asOf)
+	if err != nil {
+		return asOfFailed(c, "GetVendorProductsAsOf", err)
+	}
+	collator.SortVendorProducts(products)
+
+	if wantStream(c) {
+		return streamNDJSON(c, len(products), func(i int) interface{} { return products[i] })
+	}
+	return c.JSON(http.StatusOK, products)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/labstack/echo"
+)
+
+// conditionalCache emits ETag/Last-Modified derived from FetchMeta and
+// answers 304 Not Modified when the client already has the response.
+func conditionalCache(driver db.DB) echo.MiddlewareFunc {
+	clock := &stateClock{}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			driver := db.WithContext(c.Request().Context(), driver)
+			req := c.Request()
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				return next(c)
+			}
+
+			fetchMeta, err := driver.GetFetchMeta()
+			if err != nil {
+				log15.Error("Failed to get FetchMeta", "err", err)
+				return next(c)
+			}
+
+			lastModified := clock.lastModified(fetchMeta, time.Now())
+			// the version negotiated by the Accept header is a part of the response too,
+			// and the generation changes by a fetch not touching LastFetchedAt, e.g. fetchkev
+			etag := fmt.Sprintf(`W/"%x"`, sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s", fetchState(fetchMeta), req.RequestURI, c.Response().Header().Get(headerAPIVersion)))))
+			c.Response().Header().Set("ETag", etag)
+			c.Response().Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+
+			if inm := req.Header.Get("If-None-Match"); inm != "" {
+				if etagMatch(inm, etag) {
+					return c.NoContent(http.StatusNotModified)
+				}
+			} else if ims := req.Header.Get("If-Modified-Since"); ims != "" {
+				if t, err := http.ParseTime(ims); err == nil && !lastModified.After(t) {
+					return c.NoContent(http.StatusNotModified)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// fetchState is the state of the DB the responses depend on
+func fetchState(fetchMeta *models.FetchMeta) string {
+	return fmt.Sprintf("%s:%d:%d:%d", fetchMeta.GoCPEDictRevision, fetchMeta.SchemaVersion, fetchMeta.LastFetchedAt.Unix(), fetchMeta.Generation)
+}
+
+// stateClock derives Last-Modified from the same state as the ETag: the state may change without LastFetchedAt,
+// e.g. the generation by fetchkev or the revision by an upgrade, so Last-Modified is when the server first saw
+// the state, moving forward whenever the ETag changes.
+type stateClock struct {
+	mu    sync.Mutex
+	state string
+	since time.Time
+}
+
+func (s *stateClock) lastModified(fetchMeta *models.FetchMeta, now time.Time) time.Time {
+	state := fetchState(fetchMeta)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state != s.state {
+		since := now.UTC().Truncate(time.Second)
+		// a change within the second seen last must still be newer for If-Modified-Since
+		if !since.After(s.since) && !s.since.IsZero() {
+			since = s.since.Add(time.Second)
+		}
+		s.state, s.since = state, since
+	}
+	if lastFetchedAt := fetchMeta.LastFetchedAt.UTC().Truncate(time.Second); lastFetchedAt.After(s.since) {
+		return lastFetchedAt
+	}
+	return s.since
+}
+
+// etagMatch reports whether etag is in the If-None-Match header value (weak comparison)
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
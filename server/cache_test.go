@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+// TestConditionalCacheGeneration checks a fetch changing the generation only, e.g. fetchkev, is told by If-Modified-Since too
+func TestConditionalCacheGeneration(t *testing.T) {
+	driver := &generationDriver{generation: 3}
+	e := echo.New()
+	e.GET("/products", func(c echo.Context) error { return c.JSON(http.StatusOK, []string{}) }, conditionalCache(driver))
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/products", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("", "")
+	etag, lastModified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+	if rec.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("expected 200 with ETag and Last-Modified, actual %d %v", rec.Code, rec.Header())
+	}
+	if rec := get("If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: expected 304, actual %d", rec.Code)
+	}
+	if rec := get("If-Modified-Since", lastModified); rec.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: expected 304, actual %d", rec.Code)
+	}
+
+	driver.generation++
+	if rec := get("If-None-Match", etag); rec.Code != http.StatusOK {
+		t.Errorf("If-None-Match: expected 200 after the generation changed, actual %d", rec.Code)
+	}
+	if rec := get("If-Modified-Since", lastModified); rec.Code != http.StatusOK {
+		t.Errorf("If-Modified-Since: expected 200 after the generation changed, actual %d", rec.Code)
+	}
+}
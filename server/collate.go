@@ -0,0 +1,114 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
+)
+
+// collator is Option.Collator of the server
+var collator *search.Collator
+
+// collatedCache keeps the listings ordered by the collator for a generation, ordered by the first request after a fetch,
+// since computing the collation keys of all the vendor/products takes a while
+type collatedCache struct {
+	mu         sync.Mutex
+	generation uint64
+	listings   map[string]interface{}
+}
+
+var collated collatedCache
+
+// get returns the listing of key of the current generation of the DB, made by list on the first request of the generation.
+// The requests during the ordering wait for it rather than ordering them again.
+func (l *collatedCache) get(driver db.DB, key string, list func() (interface{}, error)) (interface{}, error) {
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.listings == nil || l.generation != fetchMeta.Generation {
+		l.listings, l.generation = map[string]interface{}{}, fetchMeta.Generation
+	}
+	if listing, ok := l.listings[key]; ok {
+		return listing, nil
+	}
+	listing, err := list()
+	if err != nil {
+		return nil, err
+	}
+	l.listings[key] = listing
+	return listing, nil
+}
+
+// flush drops the listings, ordered again by the next requests
+func (l *collatedCache) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listings = nil
+}
+
+// collatedVendorProducts returns the vendor/products ordered by the collator, or in the order of the DB without it
+func collatedVendorProducts(driver db.DB) ([]string, error) {
+	if collator == nil {
+		return driver.GetVendorProducts()
+	}
+	listing, err := collated.get(driver, "products", func() (interface{}, error) {
+		products, err := driver.GetVendorProducts()
+		if err != nil {
+			return nil, err
+		}
+		// a copy, since the DB may share the slice with the other requests
+		products = append([]string{}, products...)
+		collator.SortVendorProducts(products)
+		return products, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing.([]string), nil
+}
+
+// vendorProductsByTitle returns the vendor/products ordered by their titles, by the root collation without the collator
+func vendorProductsByTitle(driver db.DB) ([]string, error) {
+	listing, err := collated.get(driver, "titles", func() (interface{}, error) {
+		products, err := driver.GetVendorProducts()
+		if err != nil {
+			return nil, err
+		}
+		titles, err := driver.GetVendorProductTitles()
+		if err != nil {
+			return nil, err
+		}
+		products = append([]string{}, products...)
+		collator.SortByTitles(products, titles)
+		return products, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing.([]string), nil
+}
+
+// collatedSummaries returns the product summaries ordered by the collator, or in the order of the DB without it
+func collatedSummaries(driver db.DB) ([]models.ProductSummary, error) {
+	if collator == nil {
+		return driver.GetProductSummaries()
+	}
+	listing, err := collated.get(driver, "summaries", func() (interface{}, error) {
+		summaries, err := driver.GetProductSummaries()
+		if err != nil {
+			return nil, err
+		}
+		summaries = append([]models.ProductSummary{}, summaries...)
+		collator.SortSummaries(summaries)
+		return summaries, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing.([]models.ProductSummary), nil
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/labstack/echo"
+)
+
+// vulsPaths are the unversioned paths Vuls requests, served as before the API versioning with --compat-vuls
+var vulsPaths = map[string]bool{
+	"/health":                true,
+	"/products":              true,
+	"/cpes/:vendor/:product": true,
+}
+
+// compatVulsRoutes adds the routes of vulsPaths responding in the shapes of the versions before the API versioning,
+// without the negotiation by the Accept header, so that the scanners of Vuls keep working across the upgrades
+func compatVulsRoutes(e *echo.Echo, driver db.DB) {
+	e.GET("/health", legacyHealth)
+	e.GET("/products", legacyVendorProducts(driver))
+	e.GET("/cpes/:vendor/:product", legacyCpesByVendorProduct(driver), countHot)
+}
+
+// exceptPaths skips the routes of the paths, e.g. the ones of vulsPaths added by compatVulsRoutes
+type exceptPaths struct {
+	router
+	paths map[string]bool
+}
+
+func (e exceptPaths) GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	if e.paths[path] {
+		return nil
+	}
+	return e.router.GET(path, h, m...)
+}
+
+func (e exceptPaths) POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	if e.paths[path] {
+		return nil
+	}
+	return e.router.POST(path, h, m...)
+}
+
+// legacyHealth responds 200 with an empty body
+func legacyHealth(c echo.Context) error {
+	return c.String(http.StatusOK, "")
+}
+
+// legacyVendorProducts responds the vendor/products, ignoring ?sort=
+func legacyVendorProducts(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		products, err := driver.GetVendorProducts()
+		if err != nil {
+			log15.Error("Failed to GetVendorProducts", "err", err)
+			return c.JSON(http.StatusInternalServerError, []string{})
+		}
+		if products == nil {
+			products = []string{}
+		}
+		return c.JSON(http.StatusOK, products)
+	}
+}
+
+// legacyCpesByVendorProduct responds the URIs of the CPEs, ignoring ?sources=, ?detail= and ?stream=
+func legacyCpesByVendorProduct(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		vendor, product := likeParams(c.Param("vendor"), c.Param("product"))
+		log15.Debug("Params", "vendor", vendor, "product", product)
+
+		cpeURIs, deprecated, err := driver.GetCpesByVendorProduct(vendor, product)
+		if err != nil {
+			log15.Error("Failed to GetCpesByVendorProduct", "err", err)
+			return c.JSON(http.StatusInternalServerError, map[string][]string{"cpeURIs": {}, "deprecated": {}})
+		}
+		if cpeURIs == nil {
+			cpeURIs = []string{}
+		}
+		if deprecated == nil {
+			deprecated = []string{}
+		}
+		return c.JSON(http.StatusOK, map[string][]string{"cpeURIs": cpeURIs, "deprecated": deprecated})
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestCompatVulsRoutes(t *testing.T) {
+	e := echo.New()
+	compatVulsRoutes(e, nil)
+	apiRoutes(exceptPaths{router: withMiddleware{router: e, m: []echo.MiddlewareFunc{negotiateVersion("")}}, paths: vulsPaths}, nil, nil)
+
+	counts := map[string]int{}
+	for _, r := range e.Routes() {
+		counts[r.Method+" "+r.Path]++
+	}
+	for path := range vulsPaths {
+		if counts["GET "+path] != 1 {
+			t.Errorf("GET %s: actual %d routes, expected 1", path, counts["GET "+path])
+		}
+	}
+	if counts["GET /schema"] != 1 {
+		t.Errorf("expected the other routes unversioned as well")
+	}
+
+	// an Accept header of an unsupported version isn't negotiated
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(echo.HeaderAccept, "application/vnd.go-cpe-dictionary.v2+json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("actual %d %q, expected 200 with the empty body", rec.Code, rec.Body.String())
+	}
+	if v := rec.Header().Get(headerAPIVersion); v != "" {
+		t.Errorf("actual version %q, expected none", v)
+	}
+}
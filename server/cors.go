@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+)
+
+// CORS lets the pages of other origins call the API from the browsers, e.g. the web UI or a dashboard hosted elsewhere
+type CORS struct {
+	// Origins are the origins allowed, e.g. https://dashboard.example.com, or * for any. Empty disables CORS.
+	Origins []string
+	// Methods are the methods allowed (default: GET, HEAD and POST)
+	Methods []string
+	// Headers are the request headers allowed (default: Accept, Authorization, Content-Type, If-None-Match and If-Modified-Since)
+	Headers []string
+}
+
+// corsExposeHeaders are the response headers the pages of the other origins read, e.g. to revalidate by ETag
+var corsExposeHeaders = []string{"ETag", "Last-Modified", echo.HeaderLocation, headerGeneration, headerAPIVersion}
+
+// middleware answers the preflight requests and adds the CORS headers to the responses to the allowed origins
+func (c CORS) middleware() echo.MiddlewareFunc {
+	methods := c.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	headers := c.Headers
+	if len(headers) == 0 {
+		headers = []string{echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderContentType, "If-None-Match", "If-Modified-Since"}
+	}
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:  c.Origins,
+		AllowMethods:  methods,
+		AllowHeaders:  headers,
+		ExposeHeaders: corsExposeHeaders,
+	})
+}
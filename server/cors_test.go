@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestCORS(t *testing.T) {
+	e := echo.New()
+	e.Use(CORS{Origins: []string{"https://dashboard.example.com"}}.middleware())
+	e.GET("/cpes/:vendor/:product", func(c echo.Context) error { return c.JSON(http.StatusOK, map[string][]string{}) })
+
+	var tests = []struct {
+		method      string
+		origin      string
+		status      int
+		allowOrigin string
+	}{
+		// the preflight of an allowed origin
+		{method: http.MethodOptions, origin: "https://dashboard.example.com", status: http.StatusNoContent, allowOrigin: "https://dashboard.example.com"},
+		{method: http.MethodGet, origin: "https://dashboard.example.com", status: http.StatusOK, allowOrigin: "https://dashboard.example.com"},
+		// another origin is answered without the CORS headers, so that the browser rejects it
+		{method: http.MethodGet, origin: "https://evil.example.com", status: http.StatusOK, allowOrigin: ""},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/cpes/ntp/ntp", nil)
+		req.Header.Set(echo.HeaderOrigin, tt.origin)
+		if tt.method == http.MethodOptions {
+			req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodGet)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("[%d] actual %d, expected %d", i, rec.Code, tt.status)
+		}
+		if actual := rec.Header().Get(echo.HeaderAccessControlAllowOrigin); actual != tt.allowOrigin {
+			t.Errorf("[%d] actual Access-Control-Allow-Origin %q, expected %q", i, actual, tt.allowOrigin)
+		}
+	}
+}
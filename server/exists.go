@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/binding"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/labstack/echo"
+)
+
+// filterCache keeps the bloom filter of the CPEs of a generation, built by the first request after a fetch
+type filterCache struct {
+	mu         sync.Mutex
+	generation uint64
+	filter     *db.CpeFilter
+}
+
+var filters filterCache
+
+// get returns the filter of the current generation of the DB.
+// The requests during the build wait for it rather than building it again.
+func (f *filterCache) get(driver db.DB) (*db.CpeFilter, uint64, error) {
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return nil, 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.filter != nil && f.generation == fetchMeta.Generation {
+		return f.filter, f.generation, nil
+	}
+	built, err := db.NewCpeFilter(driver)
+	if err != nil {
+		return nil, 0, err
+	}
+	f.filter, f.generation = built, fetchMeta.Generation
+	return f.filter, f.generation, nil
+}
+
+// flush drops the filter, built again by the next request
+func (f *filterCache) flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.filter = nil
+}
+
+// Handler
+// POST /cpes:exists, which echo routes as a param after /cpes, since it can't escape the colon
+func existCpes(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		if !strings.HasSuffix(c.Request().URL.Path, "/cpes:exists") {
+			return echo.ErrNotFound
+		}
+		var req struct {
+			Cpes []string `json:"cpes"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return badRequest(c, fmt.Sprintf("invalid body: %s", err))
+		}
+		if limits.MaxBatch < len(req.Cpes) {
+			log15.Debug("Too many CPEs", "cpes", len(req.Cpes))
+			return badRequest(c, fmt.Sprintf("%d cpes, more than %d", len(req.Cpes), limits.MaxBatch))
+		}
+		format := c.QueryParam("format")
+		if format != "" && format != "bitmap" {
+			return badRequest(c, fmt.Sprintf("unknown format: %s", format))
+		}
+		log15.Debug("Params", "cpes", len(req.Cpes), "format", format)
+
+		filter, generation, err := filters.get(driver)
+		if err != nil {
+			log15.Error("Failed to build the filter of the CPEs", "err", err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		exists, err := existences(driver, filter, req.Cpes)
+		if err != nil {
+			log15.Error("Failed to GetCpesByVendorProduct", "err", err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+
+		res := models.CpeExistence{Generation: generation, Count: len(exists)}
+		if format == "bitmap" {
+			res.Bitmap = bitmap(exists)
+		} else {
+			res.Exists = exists
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+}
+
+// existences tells which of the CPEs, in any of the bindings, are in the DB, active or deprecated.
+// The CPEs the filter rejects aren't looked up, and the others are looked up once per vendor/product.
+// A CPE failing to be parsed doesn't exist.
+func existences(driver db.DB, filter *db.CpeFilter, cpes []string) ([]bool, error) {
+	exists := make([]bool, len(cpes))
+	products := map[string]map[string]bool{}
+	for i, cpe := range cpes {
+		b, err := binding.Convert(cpe)
+		if err != nil || !filter.MayContain(b.URI) {
+			continue
+		}
+		vendor, product := b.WFNAttributes["vendor"], b.WFNAttributes["product"]
+		key := vendor + "::" + product
+		uris, ok := products[key]
+		if !ok {
+			active, deprecated, err := driver.GetCpesByVendorProduct(db.LikePattern(vendor, false), db.LikePattern(product, false))
+			if err != nil {
+				return nil, err
+			}
+			uris = map[string]bool{}
+			for _, uri := range active {
+				uris[uri] = true
+			}
+			for _, uri := range deprecated {
+				uris[uri] = true
+			}
+			products[key] = uris
+		}
+		exists[i] = uris[b.URI]
+	}
+	return exists, nil
+}
+
+// bitmap encodes exists as CpeExistence.Bitmap
+func bitmap(exists []bool) string {
+	bits := make([]byte, (len(exists)+7)/8)
+	for i, ok := range exists {
+		if ok {
+			bits[i/8] |= 1 << (i % 8)
+		}
+	}
+	return base64.StdEncoding.EncodeToString(bits)
+}
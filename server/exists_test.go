@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/labstack/echo"
+)
+
+// existsDriver is a DB of the CPEs, counting the lookups of the vendor/products
+type existsDriver struct {
+	db.DB
+	cpes    []models.CategorizedCpe
+	lookups int
+}
+
+func (d *existsDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	return &models.FetchMeta{Generation: 1}, nil
+}
+
+func (d *existsDriver) GetVendorProducts() ([]string, error) {
+	return []string{"apache::http_server", "ntp::ntp"}, nil
+}
+
+func (d *existsDriver) GetCpesChangedSince(uint64, time.Time) ([]models.CategorizedCpe, error) {
+	return d.cpes, nil
+}
+
+func (d *existsDriver) GetCpesByVendorProduct(vendor, product string) ([]string, []string, error) {
+	d.lookups++
+	active, deprecated := []string{}, []string{}
+	for _, c := range d.cpes {
+		if c.Vendor == vendor && c.Product == product {
+			if c.Deprecated {
+				deprecated = append(deprecated, c.CpeURI)
+			} else {
+				active = append(active, c.CpeURI)
+			}
+		}
+	}
+	return active, deprecated, nil
+}
+
+func TestExistCpes(t *testing.T) {
+	filters = filterCache{}
+	driver := &existsDriver{cpes: []models.CategorizedCpe{
+		{CpeURI: "cpe:/a:apache:http_server:2.4.49", Vendor: "apache", Product: "http_server"},
+		{CpeURI: "cpe:/a:apache:http_server:2.4.50", Vendor: "apache", Product: "http_server", Deprecated: true},
+		{CpeURI: "cpe:/a:ntp:ntp:4.2.8", Vendor: "ntp", Product: "ntp"},
+	}}
+	e := echo.New()
+	e.POST("/cpes:exists", existCpes(driver))
+	e.GET("/cpes/:vendor/:product", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	post := func(path, body string) (int, models.CpeExistence) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var res models.CpeExistence
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatalf("%s: %s", path, err)
+			}
+		}
+		return rec.Code, res
+	}
+
+	body := `{"cpes": [
+		"cpe:/a:apache:http_server:2.4.49",
+		"cpe:2.3:a:apache:http_server:2.4.50:*:*:*:*:*:*:*",
+		"cpe:/a:apache:http_server:2.4.51",
+		"cpe:/a:ntp:ntp:4.2.8",
+		"not a cpe",
+		"cpe:/a:unknown:unknown:1.0",
+		"cpe:/a:ntp:ntp:4.2.8",
+		"cpe:/a:ntp:ntp:4.2.6",
+		"cpe:/a:apache:http_server:2.4.49"
+	]}`
+	code, res := post("/cpes:exists", body)
+	if code != http.StatusOK {
+		t.Fatalf("actual %d", code)
+	}
+	expected := []bool{true, true, false, true, false, false, true, false, true}
+	if res.Generation != 1 || res.Count != len(expected) || len(res.Exists) != len(expected) {
+		t.Fatalf("actual %#v", res)
+	}
+	for i := range expected {
+		if res.Exists[i] != expected[i] {
+			t.Errorf("%d: actual %t, expected %t", i, res.Exists[i], expected[i])
+		}
+	}
+	// once per vendor/product passing the filter
+	if 2 < driver.lookups {
+		t.Errorf("actual %d lookups", driver.lookups)
+	}
+
+	// 1, 1, 0, 1, 0, 0, 1, 0 and 1
+	code, res = post("/cpes:exists?format=bitmap", body)
+	if code != http.StatusOK || res.Bitmap != "SwE=" || res.Exists != nil {
+		t.Errorf("actual %d %#v", code, res)
+	}
+
+	if code, _ := post("/cpes:exists?format=csv", body); code != http.StatusBadRequest {
+		t.Errorf("an unknown format: actual %d", code)
+	}
+	if code, _ := post("/cpesexists", body); code != http.StatusNotFound {
+		t.Errorf("another path: actual %d", code)
+	}
+}
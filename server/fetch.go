@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/labstack/echo"
+	"golang.org/x/xerrors"
+)
+
+// FetchFunc fetches the CPEs of the sources and stores them into the DB. Empty sources are the sources configured.
+type FetchFunc func(ctx context.Context, sources []models.FetchType) error
+
+// FetchEvent is a progress of the scheduled fetch streamed by GET /fetch/events
+type FetchEvent struct {
+	// Type is started, log, finished or failed
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// FetchStatus is the status of the scheduled fetch returned by GET /fetch/status
+type FetchStatus struct {
+	Enabled        bool       `json:"enabled"`
+	Interval       string     `json:"interval,omitempty"`
+	Running        bool       `json:"running"`
+	LastStartedAt  *time.Time `json:"lastStartedAt,omitempty"`
+	LastFinishedAt *time.Time `json:"lastFinishedAt,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	NextAt         *time.Time `json:"nextAt,omitempty"`
+	// Sources are the sources requested to the running or the last fetch, empty for the sources configured
+	Sources []models.FetchType `json:"sources,omitempty"`
+}
+
+// errFetchRunning is returned when a fetch is requested while another is running
+var errFetchRunning = xerrors.New("fetch is already running")
+
+// errFetchDisabled is returned when a fetch is requested to the server without a FetchFunc
+var errFetchDisabled = xerrors.New("fetch is disabled")
+
+// scheduler runs the fetch periodically and broadcasts its progress and logs to the subscribers
+type scheduler struct {
+	interval time.Duration
+	fetch    FetchFunc
+
+	mu     sync.Mutex
+	status FetchStatus
+	subs   map[chan FetchEvent]struct{}
+	// events of the running or the last fetch, replayed to a new subscriber
+	history []FetchEvent
+}
+
+func newScheduler(interval time.Duration, fetch FetchFunc) *scheduler {
+	s := &scheduler{
+		interval: interval,
+		fetch:    fetch,
+		status:   FetchStatus{Enabled: 0 < interval && fetch != nil},
+		subs:     map[chan FetchEvent]struct{}{},
+	}
+	if s.status.Enabled {
+		s.status.Interval = interval.String()
+	}
+	if fetch != nil {
+		// the logs are streamed while fetching
+		log15.Root().SetHandler(log15.MultiHandler(log15.Root().GetHandler(), log15.FuncHandler(s.log)))
+	}
+	return s
+}
+
+// start runs the fetch every interval until ctx is done
+func (s *scheduler) start(ctx context.Context) {
+	if !s.status.Enabled {
+		return
+	}
+	go func() {
+		for {
+			next := time.Now().Add(s.interval)
+			s.mu.Lock()
+			s.status.NextAt = &next
+			s.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			if err := s.run(ctx, nil); err != nil {
+				log15.Error("Failed to fetch.", "err", err)
+			}
+		}
+	}()
+}
+
+// run fetches the sources once unless another fetch is running
+func (s *scheduler) run(ctx context.Context, sources []models.FetchType) error {
+	if err := s.begin(sources); err != nil {
+		return err
+	}
+	return s.finish(s.fetch(ctx, sources))
+}
+
+// trigger starts fetching the sources in the background unless another fetch is running
+func (s *scheduler) trigger(sources []models.FetchType) error {
+	if err := s.begin(sources); err != nil {
+		return err
+	}
+	go func() {
+		if err := s.finish(s.fetch(context.Background(), sources)); err != nil {
+			log15.Error("Failed to fetch.", "err", err)
+		}
+	}()
+	return nil
+}
+
+// begin marks a fetch running
+func (s *scheduler) begin(sources []models.FetchType) error {
+	if s.fetch == nil {
+		return errFetchDisabled
+	}
+	s.mu.Lock()
+	if s.status.Running {
+		s.mu.Unlock()
+		return errFetchRunning
+	}
+	now := time.Now()
+	s.status.Running = true
+	s.status.LastStartedAt = &now
+	s.status.Sources = sources
+	s.history = nil
+	s.mu.Unlock()
+	s.publish(FetchEvent{Type: "started", Time: now})
+	return nil
+}
+
+// finish marks the running fetch finished with err
+func (s *scheduler) finish(err error) error {
+	now := time.Now()
+	s.mu.Lock()
+	s.status.Running = false
+	s.status.LastFinishedAt = &now
+	s.status.LastError = ""
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+	if err != nil {
+		s.publish(FetchEvent{Type: "failed", Time: now, Message: err.Error()})
+		return err
+	}
+	s.publish(FetchEvent{Type: "finished", Time: now})
+	return nil
+}
+
+// log publishes the log records while fetching
+func (s *scheduler) log(r *log15.Record) error {
+	s.mu.Lock()
+	running := s.status.Running
+	s.mu.Unlock()
+	if running {
+		s.publish(FetchEvent{
+			Type:    "log",
+			Time:    r.Time,
+			Level:   r.Lvl.String(),
+			Message: strings.TrimSpace(string(log15.LogfmtFormat().Format(r))),
+		})
+	}
+	return nil
+}
+
+func (s *scheduler) publish(e FetchEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = append(s.history, e)
+	for ch := range s.subs {
+		// don't let a slow subscriber block the fetch
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// subscribe returns the events so far and the channel of the following events
+func (s *scheduler) subscribe() ([]FetchEvent, chan FetchEvent, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan FetchEvent, 256)
+	s.subs[ch] = struct{}{}
+	history := append([]FetchEvent{}, s.history...)
+	return history, ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subs, ch)
+	}
+}
+
+func (s *scheduler) getStatus() FetchStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Handler
+func fetchStatus(s *scheduler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, s.getStatus())
+	}
+}
+
+// Handler streams the fetch events as Server-Sent Events
+func fetchEvents(s *scheduler) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		history, ch, unsubscribe := s.subscribe()
+		defer unsubscribe()
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set("Cache-Control", "no-cache")
+		res.WriteHeader(http.StatusOK)
+		write := func(e FetchEvent) error {
+			b, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", e.Type, b); err != nil {
+				return err
+			}
+			res.Flush()
+			return nil
+		}
+
+		for _, e := range history {
+			if err := write(e); err != nil {
+				return nil
+			}
+		}
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case e := <-ch:
+				if err := write(e); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+func TestScheduler(t *testing.T) {
+	release := make(chan struct{})
+	s := newScheduler(time.Hour, func(ctx context.Context, sources []models.FetchType) error {
+		log15.Info("Fetching...", "URL", "https://example.com/feed")
+		<-release
+		return nil
+	})
+	_, ch, unsubscribe := s.subscribe()
+	defer unsubscribe()
+
+	done := make(chan error)
+	go func() {
+		done <- s.run(context.Background(), nil)
+	}()
+
+	// started, then the log of the fetch
+	for _, expected := range []string{"started", "log"} {
+		e := <-ch
+		if e.Type != expected {
+			t.Fatalf("actual %s, expected %s", e.Type, expected)
+		}
+		if e.Type == "log" && !strings.Contains(e.Message, "Fetching...") {
+			t.Errorf("actual %s, expected the log of the fetch", e.Message)
+		}
+	}
+	if !s.getStatus().Running {
+		t.Errorf("expected running")
+	}
+	if err := s.run(context.Background(), nil); !xerrors.Is(err, errFetchRunning) {
+		t.Errorf("actual %v, expected %v", err, errFetchRunning)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("run: %s", err)
+	}
+	if e := <-ch; e.Type != "finished" {
+		t.Errorf("actual %s, expected finished", e.Type)
+	}
+
+	// a late subscriber gets the events of the last fetch
+	history, _, unsubscribe2 := s.subscribe()
+	defer unsubscribe2()
+	if len(history) != 3 {
+		t.Errorf("actual %d events, expected 3", len(history))
+	}
+	status := s.getStatus()
+	if status.Running || status.LastFinishedAt == nil || status.LastError != "" {
+		t.Errorf("actual %#v", status)
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/labstack/echo"
+)
+
+// headerGeneration is the response header telling the generation of the dictionary, incremented by each fetch
+const headerGeneration = "X-Dictionary-Generation"
+
+// headerIfGenerationMatch is the request header answered with 412 Precondition Failed
+// when the dictionary is of another generation, e.g. refreshed in the middle of the requests of a client
+const headerIfGenerationMatch = "If-Generation-Match"
+
+// generationMatch emits the generation of the dictionary and checks it against If-Generation-Match
+func generationMatch(driver db.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			driver := db.WithContext(c.Request().Context(), driver)
+			fetchMeta, err := driver.GetFetchMeta()
+			if err != nil {
+				log15.Error("Failed to get FetchMeta", "err", err)
+				return next(c)
+			}
+			generation := strconv.FormatUint(fetchMeta.Generation, 10)
+			c.Response().Header().Set(headerGeneration, generation)
+
+			if match := c.Request().Header.Get(headerIfGenerationMatch); match != "" {
+				expected, err := strconv.ParseUint(match, 10, 64)
+				if err != nil {
+					return c.JSON(http.StatusBadRequest, map[string]string{"error": "If-Generation-Match must be a generation number"})
+				}
+				if expected != fetchMeta.Generation {
+					return c.JSON(http.StatusPreconditionFailed, map[string]interface{}{"generation": fetchMeta.Generation})
+				}
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/labstack/echo"
+)
+
+// generationDriver is a DB of the generation
+type generationDriver struct {
+	db.DB
+	generation uint64
+}
+
+func (d *generationDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	return &models.FetchMeta{Generation: d.generation}, nil
+}
+
+func TestGenerationMatch(t *testing.T) {
+	driver := &generationDriver{generation: 3}
+	e := echo.New()
+	e.GET("/products", func(c echo.Context) error { return c.JSON(http.StatusOK, []string{}) }, generationMatch(driver))
+
+	var tests = []struct {
+		match    string
+		expected int
+	}{
+		{expected: http.StatusOK},
+		{match: "3", expected: http.StatusOK},
+		{match: "2", expected: http.StatusPreconditionFailed},
+		{match: "latest", expected: http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/products", nil)
+		if tt.match != "" {
+			req.Header.Set(headerIfGenerationMatch, tt.match)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.expected {
+			t.Errorf("[%d] expected %d, actual %d", i, tt.expected, rec.Code)
+		}
+		if g := rec.Header().Get(headerGeneration); g != "3" {
+			t.Errorf("[%d] expected the generation 3, actual %q", i, g)
+		}
+	}
+
+	// a refresh in the middle of the requests is told by the next one
+	driver.generation++
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req.Header.Set(headerIfGenerationMatch, "3")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var body struct {
+		Generation uint64 `json:"generation"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusPreconditionFailed || body.Generation != 4 {
+		t.Errorf("expected 412 with the generation 4, actual %d %s", rec.Code, rec.Body.String())
+	}
+}
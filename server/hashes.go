@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/labstack/echo"
+)
+
+// hashCache keeps the hashes of the CPEs of a generation, computed by the first request after a fetch
+type hashCache struct {
+	mu         sync.Mutex
+	generation uint64
+	hashes     *db.Hashes
+}
+
+var hashes hashCache
+
+// get returns the hashes of the current generation of the DB.
+// The requests during the computation wait for it rather than computing them again.
+func (h *hashCache) get(driver db.DB) (*db.Hashes, uint64, error) {
+	fetchMeta, err := driver.GetFetchMeta()
+	if err != nil {
+		return nil, 0, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.hashes != nil && h.generation == fetchMeta.Generation {
+		return h.hashes, h.generation, nil
+	}
+	computed, err := db.ComputeHashes(driver)
+	if err != nil {
+		return nil, 0, err
+	}
+	h.hashes, h.generation = computed, fetchMeta.Generation
+	return h.hashes, h.generation, nil
+}
+
+// flush drops the hashes, computed again by the next request
+func (h *hashCache) flush() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hashes = nil
+}
+
+// Handler
+func getVendorHashes(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		h, generation, err := hashes.get(driver)
+		if err != nil {
+			log15.Error("Failed to compute the hashes", "err", err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		return c.JSON(http.StatusOK, models.VendorHashes{Generation: generation, Total: h.Total, Vendors: h.Vendors})
+	}
+}
+
+// Handler
+func getProductHashes(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		vendor := c.Param("vendor")
+		log15.Debug("Params", "vendor", vendor)
+
+		h, generation, err := hashes.get(driver)
+		if err != nil {
+			log15.Error("Failed to compute the hashes", "err", err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		products, ok := h.Products[vendor]
+		if !ok {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.JSON(http.StatusOK, models.ProductHashes{Generation: generation, Vendor: vendor, Products: products})
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/labstack/echo"
+)
+
+// hashDriver is a DB of the CPEs, counting the loads of them
+type hashDriver struct {
+	db.DB
+	generation uint64
+	cpes       []models.CategorizedCpe
+	loads      int
+}
+
+func (d *hashDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	return &models.FetchMeta{Generation: d.generation}, nil
+}
+
+func (d *hashDriver) GetVendorProducts() ([]string, error) {
+	return []string{"apache::http_server", "ntp::ntp"}, nil
+}
+
+func (d *hashDriver) GetCpesChangedSince(uint64, time.Time) ([]models.CategorizedCpe, error) {
+	d.loads++
+	return d.cpes, nil
+}
+
+func TestHashes(t *testing.T) {
+	hashes = hashCache{}
+	driver := &hashDriver{generation: 1, cpes: []models.CategorizedCpe{
+		{FetchType: models.NVD, CpeURI: "cpe:/a:apache:http_server:2.4.49", Vendor: "apache", Product: "http_server"},
+		{FetchType: models.NVD, CpeURI: "cpe:/a:ntp:ntp:4.2.8", Vendor: "ntp", Product: "ntp"},
+	}}
+	e := echo.New()
+	e.GET("/hashes", getVendorHashes(driver))
+	e.GET("/hashes/:vendor", getProductHashes(driver))
+
+	get := func(path string, v interface{}) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+				t.Fatalf("%s: %s", path, err)
+			}
+		}
+		return rec.Code
+	}
+
+	var vendors models.VendorHashes
+	if code := get("/hashes", &vendors); code != http.StatusOK {
+		t.Fatalf("actual %d", code)
+	}
+	if vendors.Generation != 1 || vendors.Total == "" || len(vendors.Vendors) != 2 {
+		t.Errorf("actual %#v", vendors)
+	}
+	var products models.ProductHashes
+	if code := get("/hashes/ntp", &products); code != http.StatusOK {
+		t.Fatalf("actual %d", code)
+	}
+	if products.Vendor != "ntp" || len(products.Products) != 1 || products.Products["ntp"] == "" {
+		t.Errorf("actual %#v", products)
+	}
+	if code := get("/hashes/unknown", &products); code != http.StatusNotFound {
+		t.Errorf("actual %d, expected 404", code)
+	}
+	if driver.loads != 1 {
+		t.Errorf("actual %d loads, expected the hashes of the generation to be reused", driver.loads)
+	}
+
+	// a fetch changes the hashes of the vendor changed only
+	driver.generation++
+	driver.cpes[1].Deprecated = true
+	var changed models.VendorHashes
+	if code := get("/hashes", &changed); code != http.StatusOK {
+		t.Fatalf("actual %d", code)
+	}
+	if changed.Total == vendors.Total || changed.Vendors["apache"] != vendors.Vendors["apache"] || changed.Vendors["ntp"] == vendors.Vendors["ntp"] {
+		t.Errorf("actual %#v, before %#v", changed, vendors)
+	}
+}
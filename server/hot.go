@@ -0,0 +1,98 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/labstack/echo"
+)
+
+// hotCapacityFactor is the number of the vendor/products tracked per one reported,
+// so that a product climbing into the top isn't evicted before it gets there
+const hotCapacityFactor = 10
+
+// hotProducts counts the lookups of /cpes/:vendor/:product, nil when --hot-products is disabled
+var hotProducts *hotCounter
+
+func init() {
+	expvar.Publish("hot_products", expvar.Func(func() interface{} {
+		return hotProducts.top()
+	}))
+}
+
+// HotProduct is a vendor/product and the number of its lookups
+type HotProduct struct {
+	VendorProduct string `json:"vendorProduct"`
+	Count         int64  `json:"count"`
+}
+
+// hotCounter keeps the approximate top-N of the looked up vendor/products in bounded memory.
+// When it's full, the least counted vendor/product is replaced and the newcomer inherits its count (Space-Saving),
+// so the counts are upper bounds and the frequent ones are never missed.
+type hotCounter struct {
+	mu       sync.Mutex
+	n        int
+	capacity int
+	counts   map[string]int64
+}
+
+func newHotCounter(n int) *hotCounter {
+	if n <= 0 {
+		return nil
+	}
+	return &hotCounter{n: n, capacity: n * hotCapacityFactor, counts: map[string]int64{}}
+}
+
+func (h *hotCounter) add(vendorProduct string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.counts[vendorProduct]; !ok && h.capacity <= len(h.counts) {
+		minKey, minCount := "", int64(-1)
+		for k, c := range h.counts {
+			if minCount < 0 || c < minCount || (c == minCount && k < minKey) {
+				minKey, minCount = k, c
+			}
+		}
+		delete(h.counts, minKey)
+		h.counts[vendorProduct] = minCount
+	}
+	h.counts[vendorProduct]++
+}
+
+// top returns the N most looked up vendor/products, the most first
+func (h *hotCounter) top() []HotProduct {
+	hot := []HotProduct{}
+	if h == nil {
+		return hot
+	}
+	h.mu.Lock()
+	for k, c := range h.counts {
+		hot = append(hot, HotProduct{VendorProduct: k, Count: c})
+	}
+	h.mu.Unlock()
+
+	sort.Slice(hot, func(i, j int) bool {
+		if hot[i].Count != hot[j].Count {
+			return hot[j].Count < hot[i].Count
+		}
+		return hot[i].VendorProduct < hot[j].VendorProduct
+	})
+	if h.n < len(hot) {
+		hot = hot[:h.n]
+	}
+	return hot
+}
+
+// countHot counts the lookup of the vendor/product, including the ones answered by 304 Not Modified
+func countHot(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		hotProducts.add(fmt.Sprintf("%s::%s", c.Param("vendor"), c.Param("product")))
+		return next(c)
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestHotCounter(t *testing.T) {
+	h := newHotCounter(2)
+	for i := 0; i < 5; i++ {
+		h.add("apache::http_server")
+	}
+	for i := 0; i < 3; i++ {
+		h.add("nginx::nginx")
+	}
+	h.add("openbsd::openssh")
+
+	expected := []HotProduct{{VendorProduct: "apache::http_server", Count: 5}, {VendorProduct: "nginx::nginx", Count: 3}}
+	if top := h.top(); !reflect.DeepEqual(top, expected) {
+		t.Errorf("expected %v, got %v", expected, top)
+	}
+
+	// the rare vendor/products past the capacity don't push the frequent ones out
+	for i := 0; i < 2*hotCapacityFactor*2; i++ {
+		h.add(fmt.Sprintf("vendor%d::product", i))
+	}
+	if top := h.top(); top[0].VendorProduct != "apache::http_server" || top[1].VendorProduct != "nginx::nginx" {
+		t.Errorf("expected the frequent ones on the top, got %v", top)
+	}
+	if len(h.counts) != 2*hotCapacityFactor {
+		t.Errorf("expected %d tracked, got %d", 2*hotCapacityFactor, len(h.counts))
+	}
+}
+
+func TestHotCounterDisabled(t *testing.T) {
+	h := newHotCounter(0)
+	h.add("apache::http_server")
+	if top := h.top(); len(top) != 0 {
+		t.Errorf("expected nothing, got %v", top)
+	}
+}
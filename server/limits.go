@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/labstack/echo"
+)
+
+// Limits bound the requests to the server, answered with 400 Bad Request beyond them
+type Limits struct {
+	// MaxQueryLength is the max bytes of the query string
+	MaxQueryLength int
+	// MaxParamLength is the max bytes of a path or a query parameter, e.g. :product
+	MaxParamLength int
+	// MaxBodyBytes is the max bytes of a request body, e.g. of POST /identify
+	MaxBodyBytes int64
+	// MaxBatch is the max number of the items of a request, e.g. the banners of POST /identify
+	MaxBatch int
+}
+
+// DefaultLimits returns the limits of the server without the flags, far beyond the requests of the clients
+func DefaultLimits() Limits {
+	return Limits{
+		MaxQueryLength: 2048,
+		MaxParamLength: 256,
+		MaxBodyBytes:   1 << 20,
+		MaxBatch:       100,
+	}
+}
+
+// withDefaults fills the zero limits by DefaultLimits
+func (l Limits) withDefaults() Limits {
+	d := DefaultLimits()
+	if l.MaxQueryLength <= 0 {
+		l.MaxQueryLength = d.MaxQueryLength
+	}
+	if l.MaxParamLength <= 0 {
+		l.MaxParamLength = d.MaxParamLength
+	}
+	if l.MaxBodyBytes <= 0 {
+		l.MaxBodyBytes = d.MaxBodyBytes
+	}
+	if l.MaxBatch <= 0 {
+		l.MaxBatch = d.MaxBatch
+	}
+	return l
+}
+
+// limits are Option.Limits of the server
+var limits = DefaultLimits()
+
+// charset is the characters a parameter may have
+type charset struct {
+	// description tells them in the error
+	description string
+	allowed     func(r rune) bool
+}
+
+var (
+	// packageCharset is of the names of the distributions and their packages, e.g. libssl1.1 or python3-pip
+	packageCharset = charset{description: "letters, digits and ._+~-", allowed: func(r rune) bool {
+		return isASCIIAlnum(r) || strings.ContainsRune("._+~-", r)
+	}}
+	// keywordCharset is of the parameters taking the keywords, e.g. sort=popularity or sources=nvd,jvn
+	keywordCharset = charset{description: "letters, digits, spaces and ,_-", allowed: func(r rune) bool {
+		return isASCIIAlnum(r) || strings.ContainsRune(" ,_-", r)
+	}}
+	// timeCharset is of the parameters taking a time, e.g. since=2024-01-01T00:00:00Z or asOf=2023-06-01
+	timeCharset = charset{description: "digits and the characters of RFC 3339, e.g. 2024-01-01T00:00:00Z", allowed: func(r rune) bool {
+		return ('0' <= r && r <= '9') || strings.ContainsRune("TZ:+-.", r)
+	}}
+	// printableCharset is of the other parameters, e.g. a vendor or a product, which may have any printable characters
+	printableCharset = charset{description: "printable characters", allowed: unicode.IsPrint}
+)
+
+// paramCharsets are the charsets of the path and the query parameters but printableCharset
+var paramCharsets = map[string]charset{
+	"distro":  packageCharset,
+	"package": packageCharset,
+	"id": {description: "hexadecimal digits and -", allowed: func(r rune) bool {
+		return ('0' <= r && r <= '9') || ('a' <= r && r <= 'f') || ('A' <= r && r <= 'F') || r == '-'
+	}},
+	"since":   timeCharset,
+	"asOf":    timeCharset,
+	"sort":    keywordCharset,
+	"source":  keywordCharset,
+	"sources": keywordCharset,
+	"in":      keywordCharset,
+	"stream":  keywordCharset,
+	"detail":  keywordCharset,
+	"format":  keywordCharset,
+}
+
+func isASCIIAlnum(r rune) bool {
+	return ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+}
+
+// validateRequest rejects the requests beyond limits or with a parameter of the characters it can't have
+// with 400 Bad Request telling which, before they reach the DB
+func validateRequest(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		if n := len(req.URL.RawQuery); limits.MaxQueryLength < n {
+			return badRequest(c, fmt.Sprintf("the query string is %d bytes, longer than %d", n, limits.MaxQueryLength))
+		}
+		if limits.MaxBodyBytes < req.ContentLength {
+			return badRequest(c, fmt.Sprintf("the body is %d bytes, longer than %d", req.ContentLength, limits.MaxBodyBytes))
+		}
+		if req.Body != nil {
+			// the body of an unknown length, e.g. chunked, fails to be read beyond the limit
+			req.Body = http.MaxBytesReader(c.Response(), req.Body, limits.MaxBodyBytes)
+		}
+
+		for i, name := range c.ParamNames() {
+			if i < len(c.ParamValues()) {
+				if err := validateParam(name, c.ParamValues()[i]); err != nil {
+					return badRequest(c, err.Error())
+				}
+			}
+		}
+		for name, values := range c.QueryParams() {
+			for _, value := range values {
+				if err := validateParam(name, value); err != nil {
+					return badRequest(c, err.Error())
+				}
+			}
+		}
+		return next(c)
+	}
+}
+
+// validateParam checks the length and the characters of the parameter
+func validateParam(name, value string) error {
+	if limits.MaxParamLength < len(value) {
+		return fmt.Errorf("%s is %d bytes, longer than %d", name, len(value), limits.MaxParamLength)
+	}
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("%s is not UTF-8", name)
+	}
+	cs, ok := paramCharsets[name]
+	if !ok {
+		cs = printableCharset
+	}
+	for _, r := range value {
+		if !cs.allowed(r) {
+			return fmt.Errorf("%s has %q, expected %s", name, r, cs.description)
+		}
+	}
+	return nil
+}
+
+func badRequest(c echo.Context, message string) error {
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": message})
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestValidateRequest(t *testing.T) {
+	limits = Limits{MaxQueryLength: 64, MaxParamLength: 16, MaxBodyBytes: 32, MaxBatch: 2}
+	defer func() { limits = DefaultLimits() }()
+
+	ok := func(c echo.Context) error { return c.JSON(http.StatusOK, []string{}) }
+	e := echo.New()
+	e.GET("/cpes/:vendor/:product", ok, validateRequest)
+	e.GET("/distros/:distro/packages/:package", ok, validateRequest)
+	e.POST("/identify", ok, validateRequest)
+
+	var tests = []struct {
+		method   string
+		target   string
+		body     string
+		expected int
+	}{
+		{target: "/cpes/apache/http_server?sort=popularity", expected: http.StatusOK},
+		{target: "/cpes/apache/http_server?q=" + strings.Repeat("a", 64), expected: http.StatusBadRequest},
+		{target: "/cpes/apache/" + strings.Repeat("a", 17), expected: http.StatusBadRequest},
+		{target: "/cpes/apache/http%00server", expected: http.StatusBadRequest},
+		{target: "/cpes/apache/http_server?sort=popularity%3B", expected: http.StatusBadRequest},
+		{target: "/distros/debian/packages/libssl1.1", expected: http.StatusOK},
+		{target: "/distros/debian/packages/libssl%2A", expected: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/identify", body: `{"banners":["nginx/1.18.0"]}`, expected: http.StatusOK},
+		{method: http.MethodPost, target: "/identify", body: `{"banners":["` + strings.Repeat("a", 32) + `"]}`, expected: http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		method := tt.method
+		if method == "" {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, tt.target, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.expected {
+			t.Errorf("[%d] %s: expected %d, actual %d %s", i, tt.target, tt.expected, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestLimitsWithDefaults(t *testing.T) {
+	l := Limits{MaxBatch: 10}.withDefaults()
+	d := DefaultLimits()
+	if l.MaxBatch != 10 || l.MaxQueryLength != d.MaxQueryLength || l.MaxParamLength != d.MaxParamLength || l.MaxBodyBytes != d.MaxBodyBytes {
+		t.Errorf("unexpected limits: %+v", l)
+	}
+}
@@ -1,26 +1,72 @@
 package server
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/inconshreveable/log15"
+	"github.com/kotakanbe/go-cpe-dictionary/binding"
 	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"github.com/kotakanbe/go-cpe-dictionary/search"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
 	"github.com/spf13/viper"
 )
 
+// Option : options of Start
+type Option struct {
+	// FetchInterval runs Fetch periodically in the server. 0 disables it.
+	FetchInterval time.Duration
+	Fetch         FetchFunc
+	// UI serves the web UI at /
+	UI bool
+	// AdminToken is the bearer token of the admin endpoints, e.g. POST /admin/fetch. Empty disables them.
+	AdminToken string
+	// HotProducts is the number of the most looked up vendor/products reported as hot_products of /metrics. 0 disables the counting.
+	HotProducts int
+	// CompatVuls serves the unversioned /health, /products and /cpes/:vendor/:product as before the API versioning, for Vuls
+	CompatVuls bool
+	// Glob takes * and ? of the vendor/product params for any string and any character. Otherwise they match as they are, as % and _ do.
+	Glob bool
+	// Limits bound the requests. The zero ones are those of DefaultLimits.
+	Limits Limits
+	// Collator orders the listings of the vendor/products. Nil keeps the order of the DB.
+	Collator *search.Collator
+	// CORS lets the pages of other origins call the API. The zero value disables it.
+	CORS CORS
+	// RebuildIndex rebuilds the search index by POST /admin/index/rebuild. Nil builds it from the DB without saving it.
+	RebuildIndex RebuildIndexFunc
+}
+
+// globParams is Option.Glob of the server
+var globParams bool
+
+// likeParams returns the LIKE patterns of the vendor/product params of GetCpesByVendorProduct and the like
+func likeParams(vendor, product string) (string, string) {
+	return db.LikePattern(vendor, globParams), db.LikePattern(product, globParams)
+}
+
 // Start starts CVE dictionary HTTP Server.
-func Start(logDir string, driver db.DB) error {
+func Start(logDir string, driver db.DB, option Option) error {
 	e := echo.New()
 	e.Debug = viper.GetBool("debug")
 
 	// Middleware
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
+	// ahead of the validation, so that the preflight requests are answered as they are
+	if 0 < len(option.CORS.Origins) {
+		e.Use(option.CORS.middleware())
+	}
+	e.Use(tracing())
+	e.Use(validateRequest)
 
 	// setup access logger
 	logPath := filepath.Join(logDir, "access.log")
@@ -38,49 +84,443 @@ func Start(logDir string, driver db.DB) error {
 		Output: f,
 	}))
 
+	hotProducts = newHotCounter(option.HotProducts)
+	globParams = option.Glob
+	collator = option.Collator
+	limits = option.Limits.withDefaults()
+
+	s := newScheduler(option.FetchInterval, option.Fetch)
+	s.start(context.Background())
+
+	// collapse the duplicate lookups of the concurrent requests, e.g. from many scanners
+	driver = newFlightDriver(driver)
+
 	// Routes
-	e.GET("/health", health())
-	e.GET("/products", getVendorProducts(driver))
-	e.GET("/cpes/:vendor/:product", getCpesByVendorProduct(driver))
+	if option.UI {
+		e.GET("/", index)
+	}
+	e.GET("/metrics", echo.WrapHandler(expvar.Handler()))
+	// the API at /v1, and at the unversioned paths for the clients before the versioning, negotiated by the Accept header
+	apiRoutes(e.Group("/"+APIVersion, negotiateVersion(APIVersion), generationMatch(driver)), driver, s)
+	var unversioned router = withMiddleware{router: e, m: []echo.MiddlewareFunc{negotiateVersion(""), generationMatch(driver)}}
+	if option.CompatVuls {
+		compatVulsRoutes(e, driver)
+		unversioned = exceptPaths{router: unversioned, paths: vulsPaths}
+	}
+	apiRoutes(unversioned, driver, s)
+	if option.AdminToken != "" {
+		rebuild := option.RebuildIndex
+		if rebuild == nil {
+			rebuild = buildIndex(driver)
+		}
+		adminRoutes(e, option.AdminToken, s, driver, rebuild)
+	}
 
 	bindURL := fmt.Sprintf("%s:%s", viper.GetString("bind"), viper.GetString("port"))
 	log15.Info("Listening...", "URL", bindURL)
 	return e.Start(bindURL)
 }
 
+// apiRoutes adds the routes of the API to r
+func apiRoutes(r router, driver db.DB, s *scheduler) {
+	r.GET("/health", health(driver))
+	r.GET("/fetchmeta", getFetchMeta(driver))
+	r.GET("/fetch/status", fetchStatus(s))
+	r.GET("/fetch/events", fetchEvents(s))
+	r.GET("/products", getVendorProducts(driver), conditionalCache(driver))
+	r.GET("/products/search", searchProducts(driver), conditionalCache(driver))
+	r.GET("/products/catalog", getProductSummaries(driver), conditionalCache(driver))
+	r.GET("/products/rank", rankProducts(driver), conditionalCache(driver))
+	r.GET("/search", searchMatches(driver), conditionalCache(driver))
+	r.GET("/cpes/:vendor/:product", getCpesByVendorProduct(driver), countHot, conditionalCache(driver))
+	r.GET("/cpes/:vendor/:product/ranges", getVersionRanges(driver), conditionalCache(driver))
+	r.GET("/cpe-names/:id", getCpeByNameID(driver), conditionalCache(driver))
+	r.GET("/distros/:distro/packages/:package", getCpesByDistroPackage(driver), conditionalCache(driver))
+	r.GET("/versions/:version/products", getProductsByVersion(driver), conditionalCache(driver))
+	r.POST("/identify", identify(driver))
+	r.POST("/cpes:exists", existCpes(driver))
+	r.GET("/bindings", getBindings)
+	r.GET("/watchlist", getWatchlist(driver))
+	r.GET("/watchlist/changes", getWatchChanges(driver))
+	r.GET("/hashes", getVendorHashes(driver), conditionalCache(driver))
+	r.GET("/hashes/:vendor", getProductHashes(driver), conditionalCache(driver))
+	r.GET("/schema", getSchema)
+}
+
 // Handler
-func health() echo.HandlerFunc {
+func health(driver db.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		return c.String(http.StatusOK, "")
+		driver := db.WithContext(c.Request().Context(), driver)
+		fetchMeta, err := driver.GetFetchMeta()
+		if err != nil {
+			log15.Error("Failed to GetFetchMeta", "err", err)
+			return c.JSON(http.StatusInternalServerError, map[string]interface{}{"status": "error"})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"status":             "ok",
+			"lastFetchedAt":      fetchMeta.LastFetchedAt,
+			"nvdDictVersion":     fetchMeta.NVDDictVersion,
+			"nvdDictGeneratedAt": fetchMeta.NVDDictGeneratedAt,
+			"generation":         fetchMeta.Generation,
+		})
 	}
 }
 
 // Handler
 func getVendorProducts(driver db.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		products, err := driver.GetVendorProducts()
+		driver := db.WithContext(c.Request().Context(), driver)
+		asOf, err := parseAsOf(c)
+		if err != nil {
+			return badRequest(c, err.Error())
+		}
+		if !asOf.IsZero() {
+			return getVendorProductsAsOf(c, driver, asOf)
+		}
+
+		var products []string
+		switch c.QueryParam("sort") {
+		case "popularity":
+			products, err = driver.GetVendorProductsByPopularity()
+		case "title":
+			products, err = vendorProductsByTitle(driver)
+		case "":
+			products, err = collatedVendorProducts(driver)
+		default:
+			return c.JSON(http.StatusBadRequest, []string{})
+		}
 		if err != nil {
 			log15.Error("Failed to GetVendorProducts", "err", err)
 			return c.JSON(http.StatusInternalServerError, []string{})
 		}
 
+		if wantStream(c) {
+			return streamNDJSON(c, len(products), func(i int) interface{} { return products[i] })
+		}
 		return c.JSON(http.StatusOK, products)
 	}
 }
 
+// Handler
+func getProductSummaries(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		summaries, err := collatedSummaries(driver)
+		if err != nil {
+			log15.Error("Failed to GetProductSummaries", "err", err)
+			return c.JSON(http.StatusInternalServerError, []models.ProductSummary{})
+		}
+
+		if wantStream(c) {
+			return streamNDJSON(c, len(summaries), func(i int) interface{} { return summaries[i] })
+		}
+		return c.JSON(http.StatusOK, summaries)
+	}
+}
+
+// Handler
+func searchProducts(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		q := c.QueryParam("q")
+		log15.Debug("Params", "q", q)
+
+		results, err := search.Products(driver, q)
+		if err != nil {
+			log15.Error("Failed to search products", "err", err)
+			return c.JSON(http.StatusInternalServerError, []search.Result{})
+		}
+
+		return c.JSON(http.StatusOK, results)
+	}
+}
+
+// Handler
+func searchMatches(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		q := c.QueryParam("q")
+		in := c.QueryParam("in")
+		log15.Debug("Params", "q", q, "in", in)
+
+		fields := []string{}
+		for _, f := range strings.Split(in, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				fields = append(fields, f)
+			}
+		}
+		if err := search.ValidateFields(fields); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		matches, err := search.Search(driver, q, fields)
+		if err != nil {
+			log15.Error("Failed to search", "err", err)
+			return c.JSON(http.StatusInternalServerError, []search.Match{})
+		}
+
+		return c.JSON(http.StatusOK, matches)
+	}
+}
+
+// Handler
+func rankProducts(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		vendor, product := likeParams(c.QueryParam("vendor"), c.QueryParam("product"))
+		log15.Debug("Params", "vendor", vendor, "product", product)
+
+		candidates, err := search.Rank(driver, vendor, product)
+		if err != nil {
+			log15.Error("Failed to rank products", "err", err)
+			return c.JSON(http.StatusInternalServerError, []search.Candidate{})
+		}
+
+		return c.JSON(http.StatusOK, candidates)
+	}
+}
+
+// Handler
+func getFetchMeta(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		fetchMeta, err := driver.GetFetchMeta()
+		if err != nil {
+			log15.Error("Failed to GetFetchMeta", "err", err)
+			return c.JSON(http.StatusInternalServerError, map[string]interface{}{})
+		}
+		histories, err := driver.GetLatestFetchHistories()
+		if err != nil {
+			log15.Error("Failed to GetLatestFetchHistories", "err", err)
+			return c.JSON(http.StatusInternalServerError, map[string]interface{}{})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"lastFetchedAt":      fetchMeta.LastFetchedAt,
+			"schemaVersion":      fetchMeta.SchemaVersion,
+			"revision":           fetchMeta.GoCPEDictRevision,
+			"nvdDictVersion":     fetchMeta.NVDDictVersion,
+			"nvdDictGeneratedAt": fetchMeta.NVDDictGeneratedAt,
+			"generation":         fetchMeta.Generation,
+			"sources":            histories,
+		})
+	}
+}
+
+// Handler
+func getWatchlist(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		watchlist, err := driver.GetWatchlist()
+		if err != nil {
+			log15.Error("Failed to GetWatchlist", "err", err)
+			return c.JSON(http.StatusInternalServerError, []models.WatchedProduct{})
+		}
+		return c.JSON(http.StatusOK, watchlist)
+	}
+}
+
+// Handler
+func getWatchChanges(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		since := time.Now().Add(-7 * 24 * time.Hour)
+		if param := c.QueryParam("since"); param != "" {
+			t, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, []models.WatchChange{})
+			}
+			since = t
+		}
+		log15.Debug("Params", "since", since)
+
+		changes, err := driver.GetWatchChanges(since)
+		if err != nil {
+			log15.Error("Failed to GetWatchChanges", "err", err)
+			return c.JSON(http.StatusInternalServerError, []models.WatchChange{})
+		}
+		return c.JSON(http.StatusOK, changes)
+	}
+}
+
+// Handler
+func identify(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		var req struct {
+			Banners []string `json:"banners"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return badRequest(c, fmt.Sprintf("invalid body: %s", err))
+		}
+		if limits.MaxBatch < len(req.Banners) {
+			log15.Debug("Too many banners", "banners", len(req.Banners))
+			return badRequest(c, fmt.Sprintf("%d banners, more than %d", len(req.Banners), limits.MaxBatch))
+		}
+		log15.Debug("Params", "banners", req.Banners)
+
+		results, err := search.IdentifyBanners(driver, req.Banners)
+		if err != nil {
+			log15.Error("Failed to identify banners", "err", err)
+			return c.JSON(http.StatusInternalServerError, []search.BannerResult{})
+		}
+
+		return c.JSON(http.StatusOK, results)
+	}
+}
+
+// Handler
+func getBindings(c echo.Context) error {
+	cpe := c.QueryParam("cpe")
+	log15.Debug("Params", "cpe", cpe)
+
+	bindings, err := binding.Convert(cpe)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, bindings)
+}
+
+// streamedCpe is a line of GET /cpes/:vendor/:product?stream=true
+type streamedCpe struct {
+	CpeURI     string `json:"cpeURI"`
+	Deprecated bool   `json:"deprecated"`
+}
+
 // Handler
 func getCpesByVendorProduct(driver db.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		vendor := c.Param("vendor")
-		product := c.Param("product")
+		driver := db.WithContext(c.Request().Context(), driver)
+		vendor, product := likeParams(c.Param("vendor"), c.Param("product"))
 		log15.Debug("Params", "vendor", vendor, "product", product)
 
+		asOf, err := parseAsOf(c)
+		if err != nil {
+			return badRequest(c, err.Error())
+		}
+		if !asOf.IsZero() {
+			return getCpesAsOf(c, driver, vendor, product, asOf)
+		}
+
+		if param := c.QueryParam("sources"); param != "" {
+			sources, err := models.ParseFetchTypes(param)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, []models.SourcedCpe{})
+			}
+			cpes, err := driver.GetSourcedCpesByVendorProduct(vendor, product, sources)
+			if err != nil {
+				log15.Error("Failed to GetSourcedCpesByVendorProduct", "err", err)
+				return c.JSON(http.StatusInternalServerError, []models.SourcedCpe{})
+			}
+			if wantStream(c) {
+				return streamNDJSON(c, len(cpes), func(i int) interface{} { return cpes[i] })
+			}
+			return c.JSON(http.StatusOK, cpes)
+		}
+
+		if c.QueryParam("detail") == "true" {
+			details, err := driver.GetCpeDetailsByVendorProduct(vendor, product)
+			if err != nil {
+				log15.Error("Failed to GetCpeDetailsByVendorProduct", "err", err)
+				return c.JSON(http.StatusInternalServerError, models.CpeDetails{Active: []models.CpeDetail{}, Deprecated: []models.CpeDetail{}})
+			}
+			return c.JSON(http.StatusOK, details)
+		}
+
 		cpeURIs, deprecated, err := driver.GetCpesByVendorProduct(vendor, product)
 		if err != nil {
 			log15.Error("Failed to GetVendorProducts", "err", err)
 			return c.JSON(http.StatusInternalServerError, map[string][]string{"cpeURIs": {}, "deprecated": {}})
 		}
 
+		if wantStream(c) {
+			// a line per CPE, the deprecated ones after the others as in the JSON object
+			return streamNDJSON(c, len(cpeURIs)+len(deprecated), func(i int) interface{} {
+				if i < len(cpeURIs) {
+					return streamedCpe{CpeURI: cpeURIs[i]}
+				}
+				return streamedCpe{CpeURI: deprecated[i-len(cpeURIs)], Deprecated: true}
+			})
+		}
 		return c.JSON(http.StatusOK, map[string][]string{"cpeURIs": cpeURIs, "deprecated": deprecated})
 	}
 }
+
+// Handler
+func getCpeByNameID(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		id := c.Param("id")
+		log15.Debug("Params", "cpeNameId", id)
+
+		cpe, err := driver.GetCpeByNameID(id)
+		if err != nil {
+			log15.Error("Failed to GetCpeByNameID", "err", err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		if cpe == nil {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return c.JSON(http.StatusOK, cpe)
+	}
+}
+
+// Handler
+func getCpesByDistroPackage(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		distro := c.Param("distro")
+		pkg := c.Param("package")
+		log15.Debug("Params", "distro", distro, "package", pkg)
+
+		cpeURIs, deprecated, err := driver.GetCpesByDistroPackage(distro, pkg)
+		if err != nil {
+			log15.Error("Failed to GetCpesByDistroPackage", "err", err)
+			return c.JSON(http.StatusInternalServerError, map[string][]string{"cpeURIs": {}, "deprecated": {}})
+		}
+		return c.JSON(http.StatusOK, map[string][]string{"cpeURIs": cpeURIs, "deprecated": deprecated})
+	}
+}
+
+// Handler
+func getVersionRanges(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		vendor := c.Param("vendor")
+		product := c.Param("product")
+		log15.Debug("Params", "vendor", vendor, "product", product)
+
+		versions, err := driver.GetVersionsByVendorProduct(vendor, product, "", "")
+		if err != nil {
+			log15.Error("Failed to GetVersionsByVendorProduct", "err", err)
+			return c.JSON(http.StatusInternalServerError, models.ProductVersionRanges{Ranges: []models.VersionRange{}})
+		}
+
+		return c.JSON(http.StatusOK, models.ProductVersionRanges{
+			Vendor:   vendor,
+			Product:  product,
+			Versions: len(versions),
+			Ranges:   db.GroupVersionRanges(versions),
+		})
+	}
+}
+
+// Handler
+func getProductsByVersion(driver db.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		driver := db.WithContext(c.Request().Context(), driver)
+		version := c.Param("version")
+		log15.Debug("Params", "version", version)
+
+		products, err := driver.GetProductsByVersion(version)
+		if err != nil {
+			log15.Error("Failed to GetProductsByVersion", "err", err)
+			return c.JSON(http.StatusInternalServerError, []string{})
+		}
+
+		if wantStream(c) {
+			return streamNDJSON(c, len(products), func(i int) interface{} { return products[i] })
+		}
+		return c.JSON(http.StatusOK, products)
+	}
+}
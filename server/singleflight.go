@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"strings"
+	"sync"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+// flightStats counts the lookups per method: "<method>.requests" and "<method>.shared",
+// the requests answered by the query of another request in flight.
+var flightStats = expvar.NewMap("singleflight")
+
+func init() {
+	expvar.Publish("singleflight_hit_rate", expvar.Func(flightHitRates))
+}
+
+// flightHitRates returns the ratio of the shared requests per method
+func flightHitRates() interface{} {
+	requests := map[string]int64{}
+	shared := map[string]int64{}
+	flightStats.Do(func(kv expvar.KeyValue) {
+		i, ok := kv.Value.(*expvar.Int)
+		if !ok {
+			return
+		}
+		switch {
+		case strings.HasSuffix(kv.Key, ".requests"):
+			requests[strings.TrimSuffix(kv.Key, ".requests")] = i.Value()
+		case strings.HasSuffix(kv.Key, ".shared"):
+			shared[strings.TrimSuffix(kv.Key, ".shared")] = i.Value()
+		}
+	})
+	rates := map[string]float64{}
+	for method, n := range requests {
+		if 0 < n {
+			rates[method] = float64(shared[method]) / float64(n)
+		}
+	}
+	return rates
+}
+
+// flightGroup collapses the concurrent calls with the same key into one
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// do calls fn once for the concurrent calls of method with the same key, and returns its result to all of them
+func (g *flightGroup) do(method, key string, fn func() (interface{}, error)) (interface{}, error) {
+	flightStats.Add(method+".requests", 1)
+	key = method + "\x00" + key
+
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall{}
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		flightStats.Add(method+".shared", 1)
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return c.val, c.err
+}
+
+// flightDriver collapses the duplicate hot lookups of the concurrent requests into one DB query.
+// The results are shared between the requests, so the handlers must not modify them.
+type flightDriver struct {
+	db.DB
+	group *flightGroup
+}
+
+func newFlightDriver(driver db.DB) *flightDriver {
+	return &flightDriver{DB: driver, group: &flightGroup{}}
+}
+
+// WithContext returns the driver tracing the queries in ctx, which shares the lookups in flight with d
+func (d *flightDriver) WithContext(ctx context.Context) db.DB {
+	return &flightDriver{DB: db.WithContext(ctx, d.DB), group: d.group}
+}
+
+func (d *flightDriver) GetFetchMeta() (*models.FetchMeta, error) {
+	v, err := d.group.do("GetFetchMeta", "", func() (interface{}, error) {
+		return d.DB.GetFetchMeta()
+	})
+	fetchMeta, _ := v.(*models.FetchMeta)
+	return fetchMeta, err
+}
+
+func (d *flightDriver) GetVendorProducts() ([]string, error) {
+	v, err := d.group.do("GetVendorProducts", "", func() (interface{}, error) {
+		return d.DB.GetVendorProducts()
+	})
+	vendorProducts, _ := v.([]string)
+	return vendorProducts, err
+}
+
+func (d *flightDriver) GetVendorProductsByPopularity() ([]string, error) {
+	v, err := d.group.do("GetVendorProductsByPopularity", "", func() (interface{}, error) {
+		return d.DB.GetVendorProductsByPopularity()
+	})
+	vendorProducts, _ := v.([]string)
+	return vendorProducts, err
+}
+
+func (d *flightDriver) GetCpesByVendorProduct(vendor, product string) ([]string, []string, error) {
+	v, err := d.group.do("GetCpesByVendorProduct", vendor+"\x00"+product, func() (interface{}, error) {
+		cpeURIs, deprecated, err := d.DB.GetCpesByVendorProduct(vendor, product)
+		return [2][]string{cpeURIs, deprecated}, err
+	})
+	res, _ := v.([2][]string)
+	return res[0], res[1], err
+}
+
+func (d *flightDriver) GetCpeDetailsByVendorProduct(vendor, product string) (*models.CpeDetails, error) {
+	v, err := d.group.do("GetCpeDetailsByVendorProduct", vendor+"\x00"+product, func() (interface{}, error) {
+		return d.DB.GetCpeDetailsByVendorProduct(vendor, product)
+	})
+	details, _ := v.(*models.CpeDetails)
+	return details, err
+}
+
+func (d *flightDriver) GetSourcedCpesByVendorProduct(vendor, product string, sources []models.FetchType) ([]models.SourcedCpe, error) {
+	ss := make([]string, 0, len(sources))
+	for _, s := range sources {
+		ss = append(ss, string(s))
+	}
+	v, err := d.group.do("GetSourcedCpesByVendorProduct", vendor+"\x00"+product+"\x00"+strings.Join(ss, ","), func() (interface{}, error) {
+		return d.DB.GetSourcedCpesByVendorProduct(vendor, product, sources)
+	})
+	cpes, _ := v.([]models.SourcedCpe)
+	return cpes, err
+}
+
+func (d *flightDriver) GetProductsByVersion(version string) ([]string, error) {
+	v, err := d.group.do("GetProductsByVersion", version, func() (interface{}, error) {
+		return d.DB.GetProductsByVersion(version)
+	})
+	vendorProducts, _ := v.([]string)
+	return vendorProducts, err
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func flightCount(key string) int64 {
+	if v, ok := flightStats.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestFlightGroup(t *testing.T) {
+	var g flightGroup
+	requests, shared := flightCount("TestFlightGroup.requests"), flightCount("TestFlightGroup.shared")
+	var calls int32
+	release := make(chan struct{})
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := g.do("TestFlightGroup", "vendor\x00product", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "result", nil
+			})
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			results[i] = v
+		}(i)
+	}
+	// wait for all the calls to join the one in flight
+	for flightCount("TestFlightGroup.requests")-requests != n {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("actual %d calls, expected 1", calls)
+	}
+	for i, v := range results {
+		if v != "result" {
+			t.Errorf("[%d] actual %v, expected result", i, v)
+		}
+	}
+	if actual := flightCount("TestFlightGroup.shared") - shared; actual != n-1 {
+		t.Errorf("actual %d shared, expected %d", actual, n-1)
+	}
+
+	// calls after the flight query again
+	if _, err := g.do("TestFlightGroup", "vendor\x00product", func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return "result", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("actual %d calls, expected 2", calls)
+	}
+}
+
+func TestFlightHitRates(t *testing.T) {
+	flightStats.Add("TestFlightHitRates.requests", 4)
+	flightStats.Add("TestFlightHitRates.shared", 1)
+	if rate := flightHitRates().(map[string]float64)["TestFlightHitRates"]; rate != 0.25 {
+		t.Errorf("actual hit rate %f, expected 0.25", rate)
+	}
+}
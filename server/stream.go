@@ -0,0 +1,40 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo"
+)
+
+// mimeNDJSON is the Content-Type of the streamed responses
+const mimeNDJSON = "application/x-ndjson"
+
+// streamFlushEvery is the number of lines written between the flushes of a streamed response
+const streamFlushEvery = 1000
+
+// wantStream tells whether the client asked for the NDJSON stream by ?stream=true
+func wantStream(c echo.Context) bool {
+	stream, _ := strconv.ParseBool(c.QueryParam("stream"))
+	return stream
+}
+
+// streamNDJSON writes n items as NDJSON, a JSON value per line, with chunked transfer encoding,
+// so the response is not built in memory as a whole JSON array
+func streamNDJSON(c echo.Context, n int, item func(i int) interface{}) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, mimeNDJSON)
+	res.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(res)
+	for i := 0; i < n; i++ {
+		if err := enc.Encode(item(i)); err != nil {
+			return err
+		}
+		if (i+1)%streamFlushEvery == 0 {
+			res.Flush()
+		}
+	}
+	res.Flush()
+	return nil
+}
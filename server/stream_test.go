@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestStreamNDJSON(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/cpes/ntp/ntp?stream=true", nil), rec)
+	if !wantStream(c) {
+		t.Fatalf("stream=true is not a stream")
+	}
+
+	cpes := []streamedCpe{{CpeURI: "cpe:/a:ntp:ntp:4.2.8"}, {CpeURI: "cpe:/a:ntp:ntp:4.2.7", Deprecated: true}}
+	if err := streamNDJSON(c, len(cpes), func(i int) interface{} { return cpes[i] }); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Header().Get(echo.HeaderContentType) != mimeNDJSON {
+		t.Errorf("actual %s", rec.Header().Get(echo.HeaderContentType))
+	}
+	expected := `{"cpeURI":"cpe:/a:ntp:ntp:4.2.8","deprecated":false}
+{"cpeURI":"cpe:/a:ntp:ntp:4.2.7","deprecated":true}
+`
+	if rec.Body.String() != expected {
+		t.Errorf("actual %q, expected %q", rec.Body.String(), expected)
+	}
+	if !rec.Flushed {
+		t.Errorf("the stream is not flushed")
+	}
+}
@@ -0,0 +1,17 @@
+package server
+
+import (
+	// embeds the web UI
+	_ "embed"
+	"net/http"
+
+	"github.com/labstack/echo"
+)
+
+//go:embed ui/index.html
+var indexHTML []byte
+
+// Handler serves the single page UI, which looks up CPEs through the API
+func index(c echo.Context) error {
+	return c.HTMLBlob(http.StatusOK, indexHTML)
+}
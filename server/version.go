@@ -0,0 +1,112 @@
+package server
+
+import (
+	// embeds the JSON schema of the responses
+	_ "embed"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// APIVersion is the version of the JSON responses.
+// Fields are only added within a version; a change breaking the clients of a version makes a new one.
+const APIVersion = "v1"
+
+// supportedVersions are the versions the server responds in, the default first
+var supportedVersions = []string{APIVersion}
+
+// headerAPIVersion is the response header telling the version of the response
+const headerAPIVersion = "X-API-Version"
+
+// mediaTypePrefix and mediaTypeSuffix make the media type of a version in the Accept header,
+// e.g. application/vnd.go-cpe-dictionary.v1+json
+const (
+	mediaTypePrefix = "application/vnd.go-cpe-dictionary."
+	mediaTypeSuffix = "+json"
+)
+
+//go:embed schema/v1.json
+var schemaV1 []byte
+
+// schemas are the JSON schemas of the responses of each version
+var schemas = map[string][]byte{"v1": schemaV1}
+
+// router is what the routes are added to, the server itself for the unversioned paths and a group for /v1
+type router interface {
+	GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+}
+
+// withMiddleware adds the middleware to the routes added to the router
+type withMiddleware struct {
+	router
+	m []echo.MiddlewareFunc
+}
+
+func (w withMiddleware) GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return w.router.GET(path, h, append(append([]echo.MiddlewareFunc{}, w.m...), m...)...)
+}
+
+func (w withMiddleware) POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return w.router.POST(path, h, append(append([]echo.MiddlewareFunc{}, w.m...), m...)...)
+}
+
+// negotiateVersion picks the version of the response. The version of a versioned path is used as is.
+// The unversioned paths respond in the version of the media type in the Accept header, the default without one,
+// and 406 Not Acceptable when only unsupported versions are accepted.
+func negotiateVersion(pathVersion string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			version := pathVersion
+			if version == "" {
+				var ok bool
+				if version, ok = acceptedVersion(c.Request().Header.Get(echo.HeaderAccept)); !ok {
+					return c.JSON(http.StatusNotAcceptable, map[string]interface{}{"supportedVersions": supportedVersions})
+				}
+				c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+			}
+			c.Response().Header().Set(headerAPIVersion, version)
+			return next(c)
+		}
+	}
+}
+
+// acceptedVersion returns the first supported version of the media types in accept,
+// or the default when it has no versioned media type or accepts any JSON as well
+func acceptedVersion(accept string) (string, bool) {
+	requested, anyJSON := false, accept == ""
+	for _, r := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(r))
+		if err != nil {
+			continue
+		}
+		if !strings.HasPrefix(mediaType, mediaTypePrefix) || !strings.HasSuffix(mediaType, mediaTypeSuffix) {
+			if mediaType == echo.MIMEApplicationJSON || mediaType == "application/*" || mediaType == "*/*" {
+				anyJSON = true
+			}
+			continue
+		}
+		requested = true
+		v := strings.TrimSuffix(strings.TrimPrefix(mediaType, mediaTypePrefix), mediaTypeSuffix)
+		for _, s := range supportedVersions {
+			if v == s {
+				return v, true
+			}
+		}
+	}
+	if !requested || anyJSON {
+		return supportedVersions[0], true
+	}
+	return "", false
+}
+
+// Handler serves the JSON schema of the responses of the negotiated version
+func getSchema(c echo.Context) error {
+	schema, ok := schemas[c.Response().Header().Get(headerAPIVersion)]
+	if !ok {
+		return c.NoContent(http.StatusNotFound)
+	}
+	return c.Blob(http.StatusOK, "application/schema+json", schema)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestAcceptedVersion(t *testing.T) {
+	var tests = []struct {
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{accept: "", expected: "v1", ok: true},
+		{accept: "application/json", expected: "v1", ok: true},
+		{accept: "application/vnd.go-cpe-dictionary.v1+json", expected: "v1", ok: true},
+		{accept: "application/vnd.go-cpe-dictionary.v2+json, application/vnd.go-cpe-dictionary.v1+json", expected: "v1", ok: true},
+		{accept: "application/vnd.go-cpe-dictionary.v2+json, */*;q=0.1", expected: "v1", ok: true},
+		{accept: "application/vnd.go-cpe-dictionary.v2+json", ok: false},
+	}
+	for _, tt := range tests {
+		actual, ok := acceptedVersion(tt.accept)
+		if actual != tt.expected || ok != tt.ok {
+			t.Errorf("%q: actual %s, %t, expected %s, %t", tt.accept, actual, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	e := echo.New()
+	apiRoutes(e.Group("/"+APIVersion, negotiateVersion(APIVersion)), nil, nil)
+	apiRoutes(withMiddleware{router: e, m: []echo.MiddlewareFunc{negotiateVersion("")}}, nil, nil)
+
+	var tests = []struct {
+		path     string
+		accept   string
+		expected int
+	}{
+		{path: "/v1/schema", expected: http.StatusOK},
+		{path: "/schema", expected: http.StatusOK},
+		{path: "/schema", accept: "application/vnd.go-cpe-dictionary.v1+json", expected: http.StatusOK},
+		{path: "/schema", accept: "application/vnd.go-cpe-dictionary.v2+json", expected: http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set(echo.HeaderAccept, tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.expected {
+			t.Errorf("%s %q: actual %d, expected %d", tt.path, tt.accept, rec.Code, tt.expected)
+			continue
+		}
+		if tt.expected == http.StatusOK && rec.Header().Get(headerAPIVersion) != APIVersion {
+			t.Errorf("%s %q: actual version %q", tt.path, tt.accept, rec.Header().Get(headerAPIVersion))
+		}
+	}
+}
+
+// TestSchemaRoutes checks the schema documents every route of the API and nothing else
+func TestSchemaRoutes(t *testing.T) {
+	var schema struct {
+		Routes map[string]json.RawMessage `json:"x-routes"`
+	}
+	if err := json.Unmarshal(schemaV1, &schema); err != nil {
+		t.Fatalf("Failed to unmarshal the schema: %s", err)
+	}
+
+	e := echo.New()
+	apiRoutes(e.Group("/"+APIVersion), nil, nil)
+	routes := map[string]bool{}
+	for _, r := range e.Routes() {
+		routes[r.Method+" "+strings.TrimPrefix(r.Path, "/"+APIVersion)] = true
+	}
+	for route := range routes {
+		if _, ok := schema.Routes[route]; !ok {
+			t.Errorf("%s is not in the schema", route)
+		}
+	}
+	for route := range schema.Routes {
+		if !routes[route] {
+			t.Errorf("%s in the schema is not routed", route)
+		}
+	}
+}
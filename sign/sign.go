@@ -0,0 +1,178 @@
+// Package sign signs the dictionary snapshots (e.g. the SQLite DB) and the manifests of the raw feeds with Ed25519,
+// so the consumers can prove the file they loaded is the one published.
+// The keys are PEM encoded PKCS #8 / PKIX, so the keys of `openssl genpkey -algorithm ed25519` work too.
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// SignatureExt is appended to the path of a signed file to name its signature
+const SignatureExt = ".sig"
+
+// Signature is the detached signature of a file, stored as JSON in <file>.sig
+type Signature struct {
+	// KeyID is the SHA-256 of the public key, to tell which key signed
+	KeyID    string    `json:"keyID"`
+	SHA256   string    `json:"sha256"`
+	SignedAt time.Time `json:"signedAt"`
+	// Signature is the Ed25519 signature of Message, base64 encoded
+	Signature string `json:"signature"`
+}
+
+// Message is what is signed: the digest of the file and the time signed
+func (s Signature) Message() []byte {
+	return []byte(fmt.Sprintf("go-cpe-dictionary\nsha256:%s\nsignedAt:%s\n", s.SHA256, s.SignedAt.UTC().Format(time.RFC3339)))
+}
+
+// GenerateKey returns a new key pair, PEM encoded
+func GenerateKey() (privPEM, pubPEM []byte, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("Failed to generate key. err: %w", err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("Failed to marshal private key. err: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("Failed to marshal public key. err: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), nil
+}
+
+// LoadPrivateKey reads the PEM encoded PKCS #8 Ed25519 private key at path
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to parse private key. path: %s, err: %w", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Not an Ed25519 private key. path: %s", path)
+	}
+	return priv, nil
+}
+
+// LoadPublicKey reads the PEM encoded PKIX Ed25519 public key at path
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to parse public key. path: %s, err: %w", path, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Not an Ed25519 public key. path: %s", path)
+	}
+	return pub, nil
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to read key. path: %s, err: %w", path, err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("Failed to decode key. %s PEM block is not found. path: %s", blockType, path)
+	}
+	return block.Bytes, nil
+}
+
+// KeyID returns the ID of the public key in the signatures
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignFile signs the file at path with priv and writes the signature to path + SignatureExt
+func SignFile(path string, priv ed25519.PrivateKey) (string, error) {
+	digest, err := digestFile(path)
+	if err != nil {
+		return "", err
+	}
+	s := Signature{
+		KeyID:    KeyID(priv.Public().(ed25519.PublicKey)),
+		SHA256:   digest,
+		SignedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	s.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, s.Message()))
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", xerrors.Errorf("Failed to marshal signature. err: %w", err)
+	}
+	sigPath := path + SignatureExt
+	if err := ioutil.WriteFile(sigPath, b, 0644); err != nil {
+		return "", xerrors.Errorf("Failed to write signature. path: %s, err: %w", sigPath, err)
+	}
+	return sigPath, nil
+}
+
+// VerifyFile verifies the file at path with the signature at sigPath and pub
+func VerifyFile(path, sigPath string, pub ed25519.PublicKey) (*Signature, error) {
+	b, err := ioutil.ReadFile(sigPath)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to read signature. path: %s, err: %w", sigPath, err)
+	}
+	var s Signature
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, xerrors.Errorf("Failed to unmarshal signature. path: %s, err: %w", sigPath, err)
+	}
+	if s.KeyID != KeyID(pub) {
+		return nil, fmt.Errorf("Signed by another key. key ID: %s, expected: %s", s.KeyID, KeyID(pub))
+	}
+	sig, err := base64.StdEncoding.DecodeString(s.Signature)
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to decode signature. err: %w", err)
+	}
+	if !ed25519.Verify(pub, s.Message(), sig) {
+		return nil, fmt.Errorf("Invalid signature. path: %s", sigPath)
+	}
+
+	digest, err := digestFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if digest != s.SHA256 {
+		return nil, fmt.Errorf("The file is not the one signed. sha256: %s, signed: %s", digest, s.SHA256)
+	}
+	return &s, nil
+}
+
+func digestFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", xerrors.Errorf("Failed to open file. path: %s, err: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", xerrors.Errorf("Failed to read file. path: %s, err: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,76 @@
+package sign
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKeys(t *testing.T, dir string) (privPath, pubPath string) {
+	priv, pub, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPath, pubPath = filepath.Join(dir, "cpe.key"), filepath.Join(dir, "cpe.pub")
+	if err := ioutil.WriteFile(privPath, priv, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pubPath, pub, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privPath, pubPath
+}
+
+func TestSignFile(t *testing.T) {
+	dir := t.TempDir()
+	privPath, pubPath := writeKeys(t, dir)
+	priv, err := LoadPrivateKey(privPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := LoadPublicKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "cpe.sqlite3")
+	if err := ioutil.WriteFile(path, []byte("snapshot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sigPath, err := SignFile(path, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sigPath != path+SignatureExt {
+		t.Errorf("actual %s", sigPath)
+	}
+	if _, err := VerifyFile(path, sigPath, pub); err != nil {
+		t.Errorf("VerifyFile: %s", err)
+	}
+
+	// another key
+	_, otherPubPath := writeKeys(t, t.TempDir())
+	other, err := LoadPublicKey(otherPubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyFile(path, sigPath, other); err == nil || !strings.Contains(err.Error(), "another key") {
+		t.Errorf("actual %v, expected signed by another key", err)
+	}
+
+	// tampered
+	if err := ioutil.WriteFile(path, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyFile(path, sigPath, pub); err == nil || !strings.Contains(err.Error(), "not the one signed") {
+		t.Errorf("actual %v, expected the file is not the one signed", err)
+	}
+}
+
+func TestLoadPrivateKeyAsPublicKey(t *testing.T) {
+	privPath, _ := writeKeys(t, t.TempDir())
+	if _, err := LoadPublicKey(privPath); err == nil {
+		t.Errorf("a private key is loaded as a public key")
+	}
+}
@@ -3,22 +3,32 @@ package util
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
 	"github.com/inconshreveable/log15"
-	logger "github.com/inconshreveable/log15"
-	"github.com/parnurzeal/gorequest"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/xerrors"
 )
 
+// fetchLog is the logger of the fetches of the feeds
+var fetchLog = Logger("fetch")
+
 // GenWorkers generate workers
 func GenWorkers(num int) chan<- func() {
 	tasks := make(chan func())
@@ -41,8 +51,10 @@ func GetDefaultLogDir() string {
 	return defaultLogDir
 }
 
-// SetLogger set logger
-func SetLogger(logDir string, debug, logJSON bool) {
+// SetLogger set logger.
+// levels are those of --log-level: the logs of the components in levels are filtered by their levels on the file too,
+// and the others by the level without a component, or debug by debug and info otherwise, on stderr only.
+func SetLogger(logDir string, debug, logJSON bool, levels LogLevels) {
 	stderrHandler := log15.StderrHandler
 	logFormat := log15.LogfmtFormat()
 	if logJSON {
@@ -50,10 +62,14 @@ func SetLogger(logDir string, debug, logJSON bool) {
 		stderrHandler = log15.StreamHandler(os.Stderr, logFormat)
 	}
 
-	lvlHandler := log15.LvlFilterHandler(log15.LvlInfo, stderrHandler)
+	level := log15.LvlInfo
 	if debug {
-		lvlHandler = log15.LvlFilterHandler(log15.LvlDebug, stderrHandler)
+		level = log15.LvlDebug
+	}
+	if lvl, ok := levels[""]; ok {
+		level = lvl
 	}
+	lvlHandler := log15.LvlFilterHandler(level, stderrHandler)
 
 	if _, err := os.Stat(logDir); os.IsNotExist(err) {
 		if err := os.Mkdir(logDir, 0700); err != nil {
@@ -61,21 +77,97 @@ func SetLogger(logDir string, debug, logJSON bool) {
 		}
 	}
 	var handler log15.Handler
+	unfiltered := stderrHandler
 	if _, err := os.Stat(logDir); err == nil {
 		logPath := filepath.Join(logDir, "go-cpe-dictionary.log")
 		if _, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
 			log15.Error("Failed to create a log file", "err", err)
 			handler = lvlHandler
 		} else {
-			handler = log15.MultiHandler(
-				log15.Must.FileHandler(logPath, logFormat),
-				lvlHandler,
-			)
+			fileHandler := log15.Must.FileHandler(logPath, logFormat)
+			handler = log15.MultiHandler(fileHandler, lvlHandler)
+			unfiltered = log15.MultiHandler(fileHandler, stderrHandler)
 		}
 	} else {
 		handler = lvlHandler
 	}
 	log15.Root().SetHandler(handler)
+
+	componentsMu.Lock()
+	defer componentsMu.Unlock()
+	componentHandler, componentLevels = unfiltered, map[string]log15.Lvl{}
+	for c, lvl := range levels {
+		if c != "" {
+			componentLevels[c] = lvl
+		}
+	}
+}
+
+// Components are the components whose levels are set by --log-level
+var Components = []string{"db", "fetch"}
+
+// LogLevels are the levels of the logs by the components, the one of the empty component being that of the others
+type LogLevels map[string]log15.Lvl
+
+// ParseLogLevels parses the comma separated levels of --log-level as component=level, e.g. db=debug,fetch=info.
+// A level without a component is that of the others, e.g. warn,db=debug.
+func ParseLogLevels(param string) (LogLevels, error) {
+	levels := LogLevels{}
+	for _, s := range strings.Split(param, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		component, level := "", s
+		if ss := strings.SplitN(s, "=", 2); len(ss) == 2 {
+			component, level = strings.TrimSpace(ss[0]), strings.TrimSpace(ss[1])
+			if !isComponent(component) {
+				return nil, xerrors.Errorf("Unknown component of the log level: %s, expected one of %s", component, strings.Join(Components, ", "))
+			}
+		}
+		lvl, err := log15.LvlFromString(strings.ToLower(level))
+		if err != nil {
+			return nil, xerrors.Errorf("Invalid log level: %s, expected crit, error, warn, info or debug", level)
+		}
+		levels[component] = lvl
+	}
+	return levels, nil
+}
+
+func isComponent(component string) bool {
+	for _, c := range Components {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	componentsMu sync.RWMutex
+	// componentHandler is the handler of SetLogger without the level filters, nil before it's set
+	componentHandler log15.Handler
+	componentLevels  map[string]log15.Lvl
+)
+
+// Logger returns the logger of the component, e.g. db, whose logs are tagged by the component and filtered by its level of --log-level.
+// The logs of a component without a level are filtered as the others.
+func Logger(component string) log15.Logger {
+	l := log15.New("component", component)
+	l.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		componentsMu.RLock()
+		lvl, ok := componentLevels[component]
+		handler := componentHandler
+		componentsMu.RUnlock()
+		if !ok || handler == nil {
+			return log15.Root().GetHandler().Log(r)
+		}
+		if lvl < r.Lvl {
+			return nil
+		}
+		return handler.Log(r)
+	}))
+	return l
 }
 
 // GetYearsUntilThisYear : GetYearsUntilThisYear
@@ -91,49 +183,174 @@ func GetYearsUntilThisYear(startYear int) (years []int, err error) {
 	return years, nil
 }
 
-// FetchFeedFile : fetch feed files specified by arg
-func FetchFeedFile(url string, compressed bool) ([]byte, error) {
-	var body string
-	var errs []error
-	var resp *http.Response
-	f := func() (err error) {
-		log15.Info("Fetching...", "URL", url)
-		resp, body, errs = gorequest.New().Timeout(60 * time.Second).Proxy(viper.GetString("http-proxy")).Get(url).End()
-		defer func() {
-			if resp != nil && resp.Body != nil {
-				resp.Body.Close()
-			}
-		}()
-		if len(errs) > 0 || resp == nil || resp.StatusCode != 200 {
-			return fmt.Errorf("HTTP error. errs: %v, url: %s", errs, url)
-		}
-		return nil
+// ErrRateLimited is returned when the feed server keeps answering 429 Too Many Requests
+var ErrRateLimited = xerrors.New("rate limited")
+
+// HTTPError is a response of a status other than 200, keeping what the server told of the reason
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	// Message is the message header, by which the NVD API tells the reason, e.g. Invalid apiKey
+	Message string
+	// Body is the head of the response body
+	Body string
+	// RetryAfter is the Retry-After header
+	RetryAfter string
+}
+
+// httpErrorBodyLimit is how much of the response body HTTPError keeps
+const httpErrorBodyLimit = 4096
+
+func newHTTPError(url string, resp *http.Response) *HTTPError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, httpErrorBodyLimit))
+	return &HTTPError{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		Message:    resp.Header.Get("message"),
+		Body:       string(body),
+		RetryAfter: resp.Header.Get("Retry-After"),
 	}
-	notify := func(err error, t time.Duration) {
-		logger.Warn("Failed to HTTP GET", "retrying in", t)
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("HTTP error. status code: %d, url: %s", e.StatusCode, e.URL)
+	if e.Message != "" {
+		msg += ", message: " + e.Message
+	}
+	if e.StatusCode == http.StatusTooManyRequests {
+		msg += ", err: " + ErrRateLimited.Error()
 	}
-	err := backoff.RetryNotify(f, backoff.NewExponentialBackOff(), notify)
+	return msg
+}
+
+// Unwrap returns ErrRateLimited for 429 Too Many Requests
+func (e *HTTPError) Unwrap() error {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// NewHTTPClient returns the HTTP client used to fetch feeds, honoring --http-proxy
+func NewHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy := viper.GetString("http-proxy"); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			fetchLog.Warn("Failed to parse http-proxy. Fetch without proxy", "http-proxy", proxy, "err", err)
+		} else {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	return &http.Client{Timeout: 60 * time.Second, Transport: transport}
+}
+
+// FetchFeedFile : fetch feed files specified by arg
+func FetchFeedFile(ctx context.Context, client *http.Client, url string, compressed bool) ([]byte, error) {
+	_, span := otel.Tracer("github.com/kotakanbe/go-cpe-dictionary/util").Start(ctx, "FetchFeedFile")
+	defer span.End()
+	span.SetAttributes(attribute.String("http.url", url))
+
+	var body []byte
+	err := fetchFeed(ctx, client, url, func(r io.Reader) (err error) {
+		body, err = ioutil.ReadAll(r)
+		return err
+	})
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
-	b := bytes.NewBufferString(body)
 	if !compressed {
-		return b.Bytes(), nil
+		return body, nil
 	}
 
-	reader, err := gzip.NewReader(bytes.NewReader(b.Bytes()))
-	defer func() {
-		if reader != nil {
-			_ = reader.Close()
-		}
-	}()
+	reader, err := gzip.NewReader(bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to decompress NVD feedfile. url: %s, err: %s", url, err)
 	}
+	defer reader.Close()
 	bytes, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to Read NVD feedfile. url: %s, err: %s", url, err)
 	}
 	return bytes, nil
 }
+
+// DownloadFeedFile writes the feed to a temp file in dir, the default temp directory when empty, instead of reading it into memory,
+// and returns its path. The caller removes the file.
+func DownloadFeedFile(ctx context.Context, client *http.Client, url, dir string) (string, error) {
+	_, span := otel.Tracer("github.com/kotakanbe/go-cpe-dictionary/util").Start(ctx, "DownloadFeedFile")
+	defer span.End()
+	span.SetAttributes(attribute.String("http.url", url))
+
+	path := ""
+	err := fetchFeed(ctx, client, url, func(r io.Reader) error {
+		if path != "" {
+			// written partially by the previous try
+			_ = os.Remove(path)
+		}
+		f, err := ioutil.TempFile(dir, "go-cpe-dictionary-feed-*")
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("Failed to create a temp file. err: %s", err))
+		}
+		path = f.Name()
+		if _, err := io.Copy(f, r); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err != nil {
+		if path != "" {
+			_ = os.Remove(path)
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	return path, nil
+}
+
+// fetchFeed GETs url, retrying with backoff, and passes the body of 200 OK to read
+func fetchFeed(ctx context.Context, client *http.Client, url string, read func(r io.Reader) error) error {
+	f := func() error {
+		fetchLog.Info("Fetching...", "URL", url)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("Failed to create request. url: %s, err: %s", url, err))
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				// canceled, e.g. by the pipeline stopping on an error. Retrying won't get it.
+				return backoff.Permanent(ctx.Err())
+			}
+			return fmt.Errorf("HTTP error. err: %s, url: %s", err, url)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			// e.g. not archived by --keep-raw. It won't be found by retrying.
+			return backoff.Permanent(newHTTPError(url, resp))
+		}
+		if resp.StatusCode != http.StatusOK {
+			return newHTTPError(url, resp)
+		}
+		if err := read(resp.Body); err != nil {
+			if perr, ok := err.(*backoff.PermanentError); ok {
+				return perr
+			}
+			return fmt.Errorf("Failed to read response. err: %s, url: %s", err, url)
+		}
+		return nil
+	}
+	notify := func(err error, t time.Duration) {
+		fetchLog.Warn("Failed to HTTP GET", "retrying in", t)
+	}
+	err := backoff.RetryNotify(f, backoff.WithContext(backoff.NewExponentialBackOff(), ctx), notify)
+	if perr, ok := err.(*backoff.PermanentError); ok {
+		err = perr.Err
+	}
+	return err
+}
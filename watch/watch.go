@@ -0,0 +1,163 @@
+// Package watch keeps a watchlist of vendor/products and finds their new versions and deprecations after fetches.
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knqyf263/go-cpe/common"
+	"github.com/knqyf263/go-cpe/naming"
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+	"golang.org/x/xerrors"
+)
+
+// ParseVendorProduct splits vendor::product
+func ParseVendorProduct(vp string) (vendor, product string, err error) {
+	ss := strings.SplitN(vp, "::", 2)
+	if len(ss) != 2 || ss[0] == "" || ss[1] == "" {
+		return "", "", xerrors.Errorf("Invalid vendor::product: %s", vp)
+	}
+	return ss[0], ss[1], nil
+}
+
+// Add puts vendor/product on the watchlist. What it has now is the baseline of the next Check.
+func Add(driver db.DB, vendor, product string) error {
+	versions, deprecated, err := snapshot(driver, vendor, product)
+	if err != nil {
+		return err
+	}
+	return driver.UpsertWatchedProduct(&models.WatchedProduct{
+		Vendor:         vendor,
+		Product:        product,
+		Versions:       strings.Join(versions, "\n"),
+		DeprecatedCpes: strings.Join(deprecated, "\n"),
+		CheckedAt:      time.Now(),
+	})
+}
+
+// Check compares the watched products with the DB, records the new versions and deprecations
+// as the changes and makes the DB the baseline of the next Check.
+func Check(driver db.DB) ([]models.WatchChange, error) {
+	watchlist, err := driver.GetWatchlist()
+	if err != nil {
+		return nil, xerrors.Errorf("Failed to get watchlist. err: %w", err)
+	}
+
+	now := time.Now()
+	changes := []models.WatchChange{}
+	for _, w := range watchlist {
+		versions, deprecated, err := snapshot(driver, w.Vendor, w.Product)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range added(lines(w.Versions), versions) {
+			changes = append(changes, models.WatchChange{Vendor: w.Vendor, Product: w.Product, Kind: models.WatchNewVersion, Value: v, DetectedAt: now})
+		}
+		for _, uri := range added(lines(w.DeprecatedCpes), deprecated) {
+			changes = append(changes, models.WatchChange{Vendor: w.Vendor, Product: w.Product, Kind: models.WatchDeprecated, Value: uri, DetectedAt: now})
+		}
+
+		w.Versions = strings.Join(versions, "\n")
+		w.DeprecatedCpes = strings.Join(deprecated, "\n")
+		w.CheckedAt = now
+		if err := driver.UpsertWatchedProduct(&w); err != nil {
+			return nil, xerrors.Errorf("Failed to update watched product. err: %w", err)
+		}
+	}
+
+	if err := driver.InsertWatchChanges(changes); err != nil {
+		return nil, xerrors.Errorf("Failed to insert watch changes. err: %w", err)
+	}
+	return changes, nil
+}
+
+// snapshot returns the versions and the deprecated CPE URIs of vendor/product, sorted
+func snapshot(driver db.DB, vendor, product string) (versions, deprecated []string, err error) {
+	cpeURIs, deprecatedURIs, err := driver.GetCpesByVendorProduct(db.LikePattern(vendor, false), db.LikePattern(product, false))
+	if err != nil {
+		return nil, nil, xerrors.Errorf("Failed to get CPEs. vendor: %s, product: %s, err: %w", vendor, product, err)
+	}
+
+	// LIKE matches case-insensitively on MySQL
+	exact := func(uri string) (common.WellFormedName, bool) {
+		wfn, err := naming.UnbindURI(uri)
+		if err != nil {
+			return nil, false
+		}
+		return wfn, wfn.GetString(common.AttributeVendor) == vendor && wfn.GetString(common.AttributeProduct) == product
+	}
+
+	seen := map[string]bool{}
+	versions, deprecated = []string{}, []string{}
+	for _, uri := range append(cpeURIs, deprecatedURIs...) {
+		wfn, ok := exact(uri)
+		if !ok {
+			continue
+		}
+		v := wfn.GetString(common.AttributeVersion)
+		if v == "" || v == "ANY" || v == "NA" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		versions = append(versions, v)
+	}
+	for _, uri := range deprecatedURIs {
+		if _, ok := exact(uri); ok {
+			deprecated = append(deprecated, uri)
+		}
+	}
+	sort.Strings(versions)
+	sort.Strings(deprecated)
+	return versions, deprecated, nil
+}
+
+func lines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
+
+// added returns the values of current not in prev
+func added(prev, current []string) []string {
+	known := map[string]bool{}
+	for _, v := range prev {
+		known[v] = true
+	}
+	values := []string{}
+	for _, v := range current {
+		if !known[v] {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Notify posts the changes to the webhook at url as JSON: {"changes": [...]}
+func Notify(ctx context.Context, url string, changes []models.WatchChange) error {
+	j, err := json.Marshal(map[string][]models.WatchChange{"changes": changes})
+	if err != nil {
+		return xerrors.Errorf("Failed to marshal changes. err: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(j))
+	if err != nil {
+		return xerrors.Errorf("Failed to create request. url: %s, err: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return xerrors.Errorf("Failed to post changes. url: %s, err: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		return fmt.Errorf("Failed to post changes. url: %s, status code: %d", url, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kotakanbe/go-cpe-dictionary/db"
+	"github.com/kotakanbe/go-cpe-dictionary/models"
+)
+
+func cpe(uri, version string, deprecated bool) models.CategorizedCpe {
+	return models.CategorizedCpe{CpeURI: uri, Part: "a", Vendor: "ntp", Product: "ntp", Version: version, Deprecated: deprecated}
+}
+
+func TestCheck(t *testing.T) {
+	driver, err := db.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = driver.CloseDB()
+	}()
+
+	if err := driver.InsertCpes([]models.CategorizedCpe{cpe("cpe:/a:ntp:ntp:4.2.5p48", "4.2.5p48", false)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(driver, "ntp", "ntp"); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing changed since Add
+	changes, err := Check(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("actual %#v, expected no changes", changes)
+	}
+
+	if err := driver.InsertCpes([]models.CategorizedCpe{
+		cpe("cpe:/a:ntp:ntp:4.2.8", "4.2.8", false),
+		cpe("cpe:/a:ntp:ntp:4.2.7", "4.2.7", true),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if changes, err = Check(driver); err != nil {
+		t.Fatal(err)
+	}
+	actual := []string{}
+	for _, c := range changes {
+		actual = append(actual, c.Kind+" "+c.Value)
+	}
+	expected := []string{"new_version 4.2.7", "new_version 4.2.8", "deprecated cpe:/a:ntp:ntp:4.2.7"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("actual %#v, expected %#v", actual, expected)
+	}
+
+	recorded, err := driver.GetWatchChanges(changes[0].DetectedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != len(expected) {
+		t.Errorf("actual %#v, expected %d changes recorded", recorded, len(expected))
+	}
+
+	// the changes are the baseline of the next check
+	if changes, err = Check(driver); err != nil || len(changes) != 0 {
+		t.Errorf("actual %#v, %v, expected no changes", changes, err)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var received map[string][]models.WatchChange
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer ts.Close()
+
+	changes := []models.WatchChange{{Vendor: "ntp", Product: "ntp", Kind: models.WatchNewVersion, Value: "4.2.8"}}
+	if err := Notify(context.Background(), ts.URL, changes); err != nil {
+		t.Fatal(err)
+	}
+	if len(received["changes"]) != 1 || received["changes"][0].Value != "4.2.8" {
+		t.Errorf("actual %#v", received)
+	}
+}